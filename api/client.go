@@ -25,6 +25,7 @@ const EnvVaultInsecure = "VAULT_SKIP_VERIFY"
 const EnvVaultTLSServerName = "VAULT_TLS_SERVER_NAME"
 const EnvVaultWrapTTL = "VAULT_WRAP_TTL"
 const EnvVaultMaxRetries = "VAULT_MAX_RETRIES"
+const EnvVaultNamespace = "VAULT_NAMESPACE"
 
 // WrappingLookupFunc is a function that, given an HTTP verb and a path,
 // returns an optional string duration to be used for response wrapping (e.g.
@@ -222,6 +223,7 @@ type Client struct {
 	addr               *url.URL
 	config             *Config
 	token              string
+	namespace          string
 	wrappingLookupFunc WrappingLookupFunc
 }
 
@@ -229,7 +231,7 @@ type Client struct {
 //
 // If the environment variable `VAULT_TOKEN` is present, the token will be
 // automatically added to the client. Otherwise, you must manually call
-// `SetToken()`.
+// `SetToken()`. Likewise, `VAULT_NAMESPACE` sets the namespace of the client.
 func NewClient(c *Config) (*Client, error) {
 	if c == nil {
 		c = DefaultConfig()
@@ -272,6 +274,10 @@ func NewClient(c *Config) (*Client, error) {
 		client.SetToken(token)
 	}
 
+	if namespace := os.Getenv(EnvVaultNamespace); namespace != "" {
+		client.SetNamespace(namespace)
+	}
+
 	return client, nil
 }
 
@@ -315,6 +321,18 @@ func (c *Client) ClearToken() {
 	c.token = ""
 }
 
+// Namespace returns the namespace that request paths of this client are
+// relative to. It returns the empty string for the root namespace.
+func (c *Client) Namespace() string {
+	return c.namespace
+}
+
+// SetNamespace sets the namespace that request paths of this client are
+// relative to. The empty string selects the root namespace.
+func (c *Client) SetNamespace(namespace string) {
+	c.namespace = namespace
+}
+
 // NewRequest creates a new raw request object to query the Vault server
 // configured for this client. This is an advanced method and generally
 // doesn't need to be called externally.
@@ -327,6 +345,7 @@ func (c *Client) NewRequest(method, path string) *Request {
 			Path:   path,
 		},
 		ClientToken: c.token,
+		Namespace:   c.namespace,
 		Params:      make(map[string][]string),
 	}
 
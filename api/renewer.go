@@ -0,0 +1,235 @@
+package api
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+var (
+	ErrRenewerMissingInput  = errors.New("missing input to renewer")
+	ErrRenewerMissingSecret = errors.New("missing secret to renew")
+	ErrRenewerNotRenewable  = errors.New("secret is not renewable")
+	ErrRenewerNoSecretData  = errors.New("returned empty secret data")
+
+	// DefaultRenewerGrace is the default grace period
+	DefaultRenewerGrace = 15 * time.Second
+)
+
+// Renewer is a process for renewing a secret.
+//
+//	renewer, err := client.NewRenewer(&RenewerInput{
+//		Secret: mySecret,
+//	})
+//	go renewer.Renew()
+//	defer renewer.Stop()
+//
+//	for {
+//		select {
+//		case err := <-renewer.DoneCh():
+//			if err != nil {
+//				log.Fatal(err)
+//			}
+//
+//			// Renewal is now over
+//		case renewal := <-renewer.RenewCh():
+//			log.Printf("Successfully renewed: %#v", renewal)
+//		}
+//	}
+//
+// The Renewer renews the secret, or the token if the secret holds
+// authentication information, at two thirds of its lease duration until it
+// can no longer be renewed for longer than the grace period, after which the
+// DoneCh returns nil. Any error renewing is returned on the DoneCh as well.
+type Renewer struct {
+	l sync.Mutex
+
+	client  *Client
+	secret  *Secret
+	grace   time.Duration
+	doneCh  chan error
+	renewCh chan *RenewOutput
+
+	stopped bool
+	stopCh  chan struct{}
+}
+
+// RenewerInput is used as input to the renew function.
+type RenewerInput struct {
+	// Secret is the secret to renew
+	Secret *Secret
+
+	// Grace is a minimum renewal before returning so the upstream client
+	// can do a re-read. This can be used to prevent clients from waiting
+	// too long to read a new credential and incur downtime.
+	Grace time.Duration
+}
+
+// RenewOutput is the metadata returned to the client (if it's listening) to
+// renew messages.
+type RenewOutput struct {
+	// RenewedAt is the timestamp when the renewal took place (UTC).
+	RenewedAt time.Time
+
+	// Secret is the underlying renewal data. It's the same struct as all data
+	// that is returned from Vault, but since this is renewal data, it will not
+	// usually include the secret itself.
+	Secret *Secret
+}
+
+// NewRenewer creates a new renewer from the given input.
+func (c *Client) NewRenewer(i *RenewerInput) (*Renewer, error) {
+	if i == nil {
+		return nil, ErrRenewerMissingInput
+	}
+
+	secret := i.Secret
+	if secret == nil {
+		return nil, ErrRenewerMissingSecret
+	}
+
+	grace := i.Grace
+	if grace == 0 {
+		grace = DefaultRenewerGrace
+	}
+
+	return &Renewer{
+		client:  c,
+		secret:  secret,
+		grace:   grace,
+		doneCh:  make(chan error, 1),
+		renewCh: make(chan *RenewOutput, 5),
+
+		stopped: false,
+		stopCh:  make(chan struct{}),
+	}, nil
+}
+
+// DoneCh returns the channel where the renewer will publish when renewal
+// stops. If there is an error, this will be an error.
+func (r *Renewer) DoneCh() <-chan error {
+	return r.doneCh
+}
+
+// RenewCh is a channel that receives a message when a successful renewal takes
+// place and includes metadata about the renewal.
+func (r *Renewer) RenewCh() <-chan *RenewOutput {
+	return r.renewCh
+}
+
+// Stop stops the renewer.
+func (r *Renewer) Stop() {
+	r.l.Lock()
+	if !r.stopped {
+		close(r.stopCh)
+		r.stopped = true
+	}
+	r.l.Unlock()
+}
+
+// Renew starts a background process for renewing this secret. When the secret
+// has auth data, this attempts to renew the auth (token). When the secret
+// does not have auth data, this attempts to renew the lease. This blocks
+// until renewal stops, so it is usually run in a goroutine.
+func (r *Renewer) Renew() {
+	var result error
+	if r.secret.Auth != nil {
+		result = r.renewAuth()
+	} else {
+		result = r.renewLease()
+	}
+
+	r.doneCh <- result
+}
+
+// renewAuth is a helper for renewing authentication.
+func (r *Renewer) renewAuth() error {
+	if !r.secret.Auth.Renewable || r.secret.Auth.ClientToken == "" {
+		return ErrRenewerNotRenewable
+	}
+
+	token := r.secret.Auth.ClientToken
+	for {
+		// Check if we are stopped.
+		select {
+		case <-r.stopCh:
+			return nil
+		default:
+		}
+
+		renewal, err := r.client.Auth().Token().RenewTokenAsSelf(token, 0)
+		if err != nil {
+			return err
+		}
+		if renewal == nil || renewal.Auth == nil {
+			return ErrRenewerNoSecretData
+		}
+
+		r.publish(renewal)
+
+		if done := r.sleep(renewal.Auth.LeaseDuration); done {
+			return nil
+		}
+	}
+}
+
+// renewLease is a helper for renewing a lease.
+func (r *Renewer) renewLease() error {
+	if !r.secret.Renewable || r.secret.LeaseID == "" {
+		return ErrRenewerNotRenewable
+	}
+
+	leaseID := r.secret.LeaseID
+	for {
+		// Check if we are stopped.
+		select {
+		case <-r.stopCh:
+			return nil
+		default:
+		}
+
+		renewal, err := r.client.Sys().Renew(leaseID, 0)
+		if err != nil {
+			return err
+		}
+		if renewal == nil {
+			return ErrRenewerNoSecretData
+		}
+
+		r.publish(renewal)
+
+		if done := r.sleep(renewal.LeaseDuration); done {
+			return nil
+		}
+	}
+}
+
+// publish sends the renewal on the renew channel, dropping it if nobody is
+// listening
+func (r *Renewer) publish(renewal *Secret) {
+	select {
+	case r.renewCh <- &RenewOutput{
+		RenewedAt: time.Now().UTC(),
+		Secret:    renewal,
+	}:
+	default:
+	}
+}
+
+// sleep waits until the next renewal of a lease of the given number of
+// seconds is due, and returns true if renewal is over, either because the
+// renewer was stopped or because the lease cannot be extended beyond the
+// grace period anymore.
+func (r *Renewer) sleep(leaseDuration int) bool {
+	lease := time.Duration(leaseDuration) * time.Second
+	if lease <= r.grace {
+		return true
+	}
+
+	select {
+	case <-r.stopCh:
+		return true
+	case <-time.After(lease * 2 / 3):
+		return false
+	}
+}
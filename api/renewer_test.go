@@ -0,0 +1,90 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRenewer_renewAuth(t *testing.T) {
+	var l sync.Mutex
+	var renewals int
+	handler := func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != "/v1/auth/token/renew-self" || req.Header.Get("X-Vault-Token") != "secret-token" {
+			w.WriteHeader(400)
+			return
+		}
+
+		// The lease shrinks to below the grace period on the second renewal
+		l.Lock()
+		renewals++
+		leaseDuration := 3 - renewals
+		l.Unlock()
+
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"auth": {"client_token": "secret-token", "renewable": true, "lease_duration": %d}}`, leaseDuration)
+	}
+
+	config, ln := testHTTPServer(t, http.HandlerFunc(handler))
+	defer ln.Close()
+
+	client, err := NewClient(config)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	client.SetToken("other-token")
+
+	renewer, err := client.NewRenewer(&RenewerInput{
+		Secret: &Secret{
+			Auth: &SecretAuth{
+				ClientToken: "secret-token",
+				Renewable:   true,
+			},
+		},
+		Grace: time.Second,
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	go renewer.Renew()
+	defer renewer.Stop()
+
+	select {
+	case err := <-renewer.DoneCh():
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("renewer did not finish")
+	}
+
+	if renewals != 2 {
+		t.Fatalf("bad: %d renewals", renewals)
+	}
+	if len(renewer.RenewCh()) != 2 {
+		t.Fatalf("bad: %d renew outputs", len(renewer.RenewCh()))
+	}
+}
+
+func TestRenewer_notRenewable(t *testing.T) {
+	client, err := NewClient(DefaultConfig())
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	renewer, err := client.NewRenewer(&RenewerInput{
+		Secret: &Secret{
+			LeaseID: "secret/foo",
+		},
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	go renewer.Renew()
+
+	if err := <-renewer.DoneCh(); err != ErrRenewerNotRenewable {
+		t.Fatalf("bad: %v", err)
+	}
+}
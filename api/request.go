@@ -15,6 +15,7 @@ type Request struct {
 	URL         *url.URL
 	Params      url.Values
 	ClientToken string
+	Namespace   string
 	WrapTTL     string
 	Obj         interface{}
 	Body        io.Reader
@@ -67,5 +68,9 @@ func (r *Request) ToHTTP() (*http.Request, error) {
 		req.Header.Set("X-Vault-Wrap-TTL", r.WrapTTL)
 	}
 
+	if len(r.Namespace) != 0 {
+		req.Header.Set("X-Vault-Namespace", r.Namespace)
+	}
+
 	return req, nil
 }
@@ -35,6 +35,28 @@ func (c *Sys) AuditHash(path string, input string) (string, error) {
 	return result.Hash, err
 }
 
+func (c *Sys) AuditHashChainKey(path string) (string, error) {
+	r := c.c.NewRequest("GET", fmt.Sprintf("/v1/sys/audit-hash-chain-key/%s", path))
+
+	resp, err := c.c.RawRequest(r)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	type d struct {
+		Key string `json:"key"`
+	}
+
+	var result d
+	err = resp.DecodeJSON(&result)
+	if err != nil {
+		return "", err
+	}
+
+	return result.Key, err
+}
+
 func (c *Sys) ListAudit() (map[string]*Audit, error) {
 	r := c.c.NewRequest("GET", "/v1/sys/audit")
 	resp, err := c.c.RawRequest(r)
@@ -73,14 +95,16 @@ func (c *Sys) ListAudit() (map[string]*Audit, error) {
 
 func (c *Sys) EnableAudit(
 	path string, auditType string, desc string, opts map[string]string) error {
-	body := map[string]interface{}{
-		"type":        auditType,
-		"description": desc,
-		"options":     opts,
-	}
+	return c.EnableAuditWithOptions(path, &EnableAuditOptions{
+		Type:        auditType,
+		Description: desc,
+		Options:     opts,
+	})
+}
 
+func (c *Sys) EnableAuditWithOptions(path string, options *EnableAuditOptions) error {
 	r := c.c.NewRequest("PUT", fmt.Sprintf("/v1/sys/audit/%s", path))
-	if err := r.SetJSONBody(body); err != nil {
+	if err := r.SetJSONBody(options); err != nil {
 		return err
 	}
 
@@ -106,9 +130,18 @@ func (c *Sys) DisableAudit(path string) error {
 // individually documented because the map almost directly to the raw HTTP API
 // documentation. Please refer to that documentation for more details.
 
+type EnableAuditOptions struct {
+	Type        string            `json:"type"`
+	Description string            `json:"description"`
+	Options     map[string]string `json:"options"`
+	Filter      string            `json:"filter,omitempty"`
+}
+
 type Audit struct {
 	Path        string
 	Type        string
 	Description string
 	Options     map[string]string
+	Filter      string
+	Status      map[string]interface{}
 }
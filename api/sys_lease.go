@@ -46,3 +46,26 @@ func (c *Sys) RevokeForce(id string) error {
 	}
 	return err
 }
+
+func (c *Sys) LookupLease(id string) (*Secret, error) {
+	r := c.c.NewRequest("PUT", "/v1/sys/leases/lookup")
+
+	body := map[string]interface{}{
+		"lease_id": id,
+	}
+	if err := r.SetJSONBody(body); err != nil {
+		return nil, err
+	}
+
+	resp, err := c.c.RawRequest(r)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	return ParseSecret(resp.Body)
+}
+
+func (c *Sys) ListLeases(prefix string) (*Secret, error) {
+	return c.c.Logical().List("sys/leases/lookup/" + prefix)
+}
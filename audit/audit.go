@@ -31,6 +31,13 @@ type Backend interface {
 	Reload() error
 }
 
+// StatusReporter is implemented by audit backends that can report on their
+// current state, such as the position within the file being written to. The
+// status is included in audit backend listings.
+type StatusReporter interface {
+	Status() map[string]interface{}
+}
+
 type BackendConfig struct {
 	// The salt that should be used for any secret obfuscation
 	Salt *salt.Salt
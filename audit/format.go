@@ -70,12 +70,14 @@ func (f *AuditFormatter) FormatRequest(
 		if !config.HMACAccessor && req != nil && req.ClientTokenAccessor != "" {
 			clientTokenAccessor = req.ClientTokenAccessor
 		}
+		reqData := req.Data
 		if err := Hash(config.Salt, req); err != nil {
 			return err
 		}
 		if clientTokenAccessor != "" {
 			req.ClientTokenAccessor = clientTokenAccessor
 		}
+		restoreNonHMACKeys(req.Data, reqData, req.AuditNonHMACRequestKeys)
 	}
 
 	// If auth is nil, make an empty one
@@ -103,6 +105,7 @@ func (f *AuditFormatter) FormatRequest(
 			ClientTokenAccessor: req.ClientTokenAccessor,
 			Operation:           req.Operation,
 			Path:                req.Path,
+			Namespace:           req.Namespace,
 			Data:                req.Data,
 			RemoteAddr:          getRemoteAddr(req),
 			WrapTTL:             int(req.WrapTTL / time.Second),
@@ -166,7 +169,7 @@ func (f *AuditFormatter) FormatResponse(
 		// Hash any sensitive information
 
 		// Cache and restore accessor in the auth
-		var accessor, wrappedAccessor string
+		var accessor, wrappedAccessor, wrappingAccessor string
 		if !config.HMACAccessor && auth != nil && auth.Accessor != "" {
 			accessor = auth.Accessor
 		}
@@ -182,12 +185,14 @@ func (f *AuditFormatter) FormatResponse(
 		if !config.HMACAccessor && req != nil && req.ClientTokenAccessor != "" {
 			clientTokenAccessor = req.ClientTokenAccessor
 		}
+		reqData := req.Data
 		if err := Hash(config.Salt, req); err != nil {
 			return err
 		}
 		if clientTokenAccessor != "" {
 			req.ClientTokenAccessor = clientTokenAccessor
 		}
+		restoreNonHMACKeys(req.Data, reqData, req.AuditNonHMACRequestKeys)
 
 		// Cache and restore accessor in the response
 		accessor = ""
@@ -197,6 +202,13 @@ func (f *AuditFormatter) FormatResponse(
 		if !config.HMACAccessor && resp != nil && resp.WrapInfo != nil && resp.WrapInfo.WrappedAccessor != "" {
 			wrappedAccessor = resp.WrapInfo.WrappedAccessor
 		}
+		if !config.HMACAccessor && resp != nil && resp.WrapInfo != nil && resp.WrapInfo.Accessor != "" {
+			wrappingAccessor = resp.WrapInfo.Accessor
+		}
+		var respData map[string]interface{}
+		if resp != nil {
+			respData = resp.Data
+		}
 		if err := Hash(config.Salt, resp); err != nil {
 			return err
 		}
@@ -206,6 +218,12 @@ func (f *AuditFormatter) FormatResponse(
 		if wrappedAccessor != "" {
 			resp.WrapInfo.WrappedAccessor = wrappedAccessor
 		}
+		if wrappingAccessor != "" {
+			resp.WrapInfo.Accessor = wrappingAccessor
+		}
+		if resp != nil {
+			restoreNonHMACKeys(resp.Data, respData, req.AuditNonHMACResponseKeys)
+		}
 	}
 
 	// If things are nil, make empty to avoid panics
@@ -243,6 +261,7 @@ func (f *AuditFormatter) FormatResponse(
 		respWrapInfo = &AuditWrapInfo{
 			TTL:             int(resp.WrapInfo.TTL / time.Second),
 			Token:           resp.WrapInfo.Token,
+			Accessor:        resp.WrapInfo.Accessor,
 			CreationTime:    resp.WrapInfo.CreationTime.Format(time.RFC3339Nano),
 			WrappedAccessor: resp.WrapInfo.WrappedAccessor,
 		}
@@ -264,6 +283,7 @@ func (f *AuditFormatter) FormatResponse(
 			ClientTokenAccessor: req.ClientTokenAccessor,
 			Operation:           req.Operation,
 			Path:                req.Path,
+			Namespace:           req.Namespace,
 			Data:                req.Data,
 			RemoteAddr:          getRemoteAddr(req),
 			WrapTTL:             int(req.WrapTTL / time.Second),
@@ -310,6 +330,7 @@ type AuditRequest struct {
 	ClientToken         string                 `json:"client_token"`
 	ClientTokenAccessor string                 `json:"client_token_accessor"`
 	Path                string                 `json:"path"`
+	Namespace           string                 `json:"namespace,omitempty"`
 	Data                map[string]interface{} `json:"data"`
 	RemoteAddr          string                 `json:"remote_address"`
 	WrapTTL             int                    `json:"wrap_ttl"`
@@ -338,10 +359,24 @@ type AuditSecret struct {
 type AuditWrapInfo struct {
 	TTL             int    `json:"ttl"`
 	Token           string `json:"token"`
+	Accessor        string `json:"accessor,omitempty"`
 	CreationTime    string `json:"creation_time"`
 	WrappedAccessor string `json:"wrapped_accessor,omitempty"`
 }
 
+// restoreNonHMACKeys puts the original values of the given top-level keys
+// back into hashed data, so that they are logged in the clear
+func restoreNonHMACKeys(hashed, orig map[string]interface{}, keys []string) {
+	if hashed == nil {
+		return
+	}
+	for _, key := range keys {
+		if v, ok := orig[key]; ok {
+			hashed[key] = v
+		}
+	}
+}
+
 // getRemoteAddr safely gets the remote address avoiding a nil pointer
 func getRemoteAddr(req *logical.Request) string {
 	if req != nil && req.Connection != nil {
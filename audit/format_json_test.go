@@ -76,3 +76,57 @@ func TestFormatJSON_formatRequest(t *testing.T) {
 
 const testFormatJSONReqBasicStr = `{"time":"2015-08-05T13:45:46Z","type":"request","auth":{"display_name":"","policies":["root"],"metadata":null},"request":{"operation":"update","path":"/foo","data":null,"wrap_ttl":60,"remote_address":"127.0.0.1"},"error":"this is an error"}
 `
+
+func TestFormatJSON_nonHMACKeys(t *testing.T) {
+	formatter := AuditFormatter{
+		AuditFormatWriter: &JSONFormatWriter{},
+	}
+	salter, _ := salt.NewSalt(nil, nil)
+	config := FormatterConfig{
+		Salt: salter,
+	}
+
+	req := &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "pki/issue/example",
+		Data: map[string]interface{}{
+			"common_name": "example.com",
+			"ttl":         "1h",
+			"secret":      "hunter2",
+		},
+		AuditNonHMACRequestKeys:  []string{"common_name", "ttl"},
+		AuditNonHMACResponseKeys: []string{"serial_number"},
+	}
+	resp := &logical.Response{
+		Data: map[string]interface{}{
+			"serial_number": "01:02",
+			"private_key":   "hunter2",
+		},
+	}
+
+	var buf bytes.Buffer
+	if err := formatter.FormatResponse(&buf, config, nil, req, resp, nil); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	var entry AuditResponseEntry
+	if err := jsonutil.DecodeJSON(buf.Bytes(), &entry); err != nil {
+		t.Fatalf("bad json: %s", err)
+	}
+
+	hashed := salter.GetIdentifiedHMAC("hunter2")
+	if entry.Request.Data["common_name"] != "example.com" || entry.Request.Data["ttl"] != "1h" {
+		t.Fatalf("bad: %#v", entry.Request.Data)
+	}
+	if entry.Request.Data["secret"] != hashed {
+		t.Fatalf("bad: %#v", entry.Request.Data)
+	}
+	if entry.Response.Data["serial_number"] != "01:02" || entry.Response.Data["private_key"] != hashed {
+		t.Fatalf("bad: %#v", entry.Response.Data)
+	}
+
+	// The original request and response are left untouched
+	if req.Data["secret"] != "hunter2" || resp.Data["private_key"] != "hunter2" {
+		t.Fatalf("bad: %#v %#v", req.Data, resp.Data)
+	}
+}
@@ -0,0 +1,349 @@
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/vault/helper/salt"
+)
+
+const (
+	// hashChainKeyID is salted to derive the hash chain key. The key is not
+	// an HMAC of the salt so that it cannot be obtained through the audit
+	// hash endpoint.
+	hashChainKeyID = "audit-hash-chain"
+
+	// DefaultHashChainCheckpointInterval is the number of entries written
+	// between checkpoints if no interval is configured
+	DefaultHashChainCheckpointInterval = 1000
+)
+
+// HashChainKeyer is implemented by audit backends that chain the entries
+// they write. It returns the key used to compute the chain, or an empty
+// string if chaining is disabled.
+type HashChainKeyer interface {
+	HashChainKey() string
+}
+
+// HashChainKey derives the hex-encoded key used to chain audit entries from
+// the salt of an audit backend
+func HashChainKey(salter *salt.Salt) string {
+	return salter.SaltID(hashChainKeyID)
+}
+
+// HashChainEntry is a single line of a hash-chained audit log. Each line
+// carries a sequence number and an HMAC over the sequence number, the HMAC
+// of the line before it and the entry itself, so that lines cannot be
+// removed, reordered or modified without detection.
+type HashChainEntry struct {
+	Sequence uint64          `json:"sequence"`
+	HMAC     string          `json:"hmac"`
+	Entry    json.RawMessage `json:"entry"`
+}
+
+// HashChainCheckpoint is written into the chain periodically and whenever
+// the chain is started, resumed or continued in a new file, recording when
+// it was written. It carries the HMAC of the line before it, so that its own
+// HMAC can be checked without that line and a log that does not start at
+// the beginning of the chain can be verified from its first checkpoint.
+type HashChainCheckpoint struct {
+	Type     string `json:"type"`
+	Time     string `json:"time"`
+	Previous string `json:"previous,omitempty"`
+	Resumed  bool   `json:"resumed,omitempty"`
+}
+
+// HashChain computes the chain over the entries of an audit log. It is safe
+// for concurrent use.
+type HashChain struct {
+	key                []byte
+	checkpointInterval uint64
+
+	l sync.Mutex
+	hashChainState
+}
+
+// hashChainState is the position of a chain, which only moves on once the
+// lines computed from it have been written
+type hashChainState struct {
+	sequence        uint64
+	prev            string
+	sinceCheckpoint uint64
+	needsCheckpoint bool
+	resumed         bool
+}
+
+// NewHashChain returns a new chain using the given hex-encoded key that
+// writes a checkpoint every checkpointInterval entries. A checkpoint is also
+// written before the first entry.
+func NewHashChain(key string, checkpointInterval int) (*HashChain, error) {
+	keyBytes, err := hex.DecodeString(key)
+	if err != nil || len(keyBytes) == 0 {
+		return nil, fmt.Errorf("invalid hash chain key")
+	}
+	if checkpointInterval <= 0 {
+		checkpointInterval = DefaultHashChainCheckpointInterval
+	}
+	return &HashChain{
+		key:                keyBytes,
+		checkpointInterval: uint64(checkpointInterval),
+		hashChainState: hashChainState{
+			needsCheckpoint: true,
+		},
+	}, nil
+}
+
+// Resume continues the chain from the last line written to an existing
+// log. Lines that are not part of a chain are ignored, in which case the
+// chain starts from the beginning.
+func (c *HashChain) Resume(lastLine []byte) {
+	var entry HashChainEntry
+	if err := json.Unmarshal(lastLine, &entry); err != nil || entry.Sequence == 0 || entry.HMAC == "" {
+		return
+	}
+
+	c.l.Lock()
+	defer c.l.Unlock()
+	c.sequence = entry.Sequence
+	c.prev = entry.HMAC
+	c.resumed = true
+}
+
+// RequireCheckpoint makes the next line written be preceded by a checkpoint,
+// as needed when the chain continues in a new file
+func (c *HashChain) RequireCheckpoint() {
+	c.l.Lock()
+	defer c.l.Unlock()
+	c.needsCheckpoint = true
+}
+
+// Write chains a single encoded entry and writes it to w as one line
+func (c *HashChain) Write(w io.Writer, entry []byte) error {
+	entry = bytes.TrimSpace(entry)
+	if !json.Valid(entry) {
+		return fmt.Errorf("hash chained audit entries must be JSON")
+	}
+
+	c.l.Lock()
+	defer c.l.Unlock()
+
+	// Write all lines in one go so that a checkpoint is never separated from
+	// the entry that triggered it. The chain only moves on once they were
+	// written, so that a failed write leaves no gap.
+	state := c.hashChainState
+	var buf bytes.Buffer
+	if c.needsCheckpoint || c.sinceCheckpoint >= c.checkpointInterval {
+		if err := c.appendCheckpoint(&buf); err != nil {
+			c.hashChainState = state
+			return err
+		}
+	}
+	c.appendLine(&buf, entry)
+
+	if _, err := w.Write(buf.Bytes()); err != nil {
+		c.hashChainState = state
+		return err
+	}
+	return nil
+}
+
+// appendCheckpoint adds a checkpoint to the buffer. The lock must be held.
+func (c *HashChain) appendCheckpoint(buf *bytes.Buffer) error {
+	checkpoint, err := json.Marshal(&HashChainCheckpoint{
+		Type:     "checkpoint",
+		Time:     time.Now().UTC().Format(time.RFC3339),
+		Previous: c.prev,
+		Resumed:  c.needsCheckpoint && c.resumed,
+	})
+	if err != nil {
+		return err
+	}
+	c.appendLine(buf, checkpoint)
+	c.needsCheckpoint = false
+	c.resumed = false
+	c.sinceCheckpoint = 0
+	return nil
+}
+
+// appendLine chains an entry and adds it to the buffer. The lock must be
+// held.
+func (c *HashChain) appendLine(buf *bytes.Buffer, entry []byte) {
+	c.sequence++
+	c.prev = hashChainHMAC(c.key, c.sequence, c.prev, entry)
+	c.sinceCheckpoint++
+
+	buf.WriteString(`{"sequence":`)
+	buf.WriteString(strconv.FormatUint(c.sequence, 10))
+	buf.WriteString(`,"hmac":"`)
+	buf.WriteString(c.prev)
+	buf.WriteString(`","entry":`)
+	buf.Write(entry)
+	buf.WriteString("}\n")
+}
+
+// hashChainHMAC computes the HMAC of a line of the chain
+func hashChainHMAC(key []byte, sequence uint64, prev string, entry []byte) string {
+	hm := hmac.New(sha256.New, key)
+	hm.Write([]byte(strconv.FormatUint(sequence, 10)))
+	hm.Write([]byte{':'})
+	hm.Write([]byte(prev))
+	hm.Write([]byte{':'})
+	hm.Write(entry)
+	return hex.EncodeToString(hm.Sum(nil))
+}
+
+// HashChainFormatWriter is an AuditFormatWriter that chains the output of
+// another AuditFormatWriter, which must produce JSON
+type HashChainFormatWriter struct {
+	AuditFormatWriter
+	Chain *HashChain
+}
+
+func (f *HashChainFormatWriter) WriteRequest(w io.Writer, req *AuditRequestEntry) error {
+	var buf bytes.Buffer
+	if err := f.AuditFormatWriter.WriteRequest(&buf, req); err != nil {
+		return err
+	}
+	return f.Chain.Write(w, buf.Bytes())
+}
+
+func (f *HashChainFormatWriter) WriteResponse(w io.Writer, resp *AuditResponseEntry) error {
+	var buf bytes.Buffer
+	if err := f.AuditFormatWriter.WriteResponse(&buf, resp); err != nil {
+		return err
+	}
+	return f.Chain.Write(w, buf.Bytes())
+}
+
+// HashChainReport is the result of verifying a hash chained audit log
+type HashChainReport struct {
+	// Lines is the number of lines read
+	Lines int
+
+	// FirstSequence and LastSequence are the sequence numbers of the first
+	// and last chained lines
+	FirstSequence uint64
+	LastSequence  uint64
+
+	// Checkpoints is the number of verified checkpoints found, and
+	// LastCheckpoint the sequence number of the last of them
+	Checkpoints    int
+	LastCheckpoint uint64
+
+	// Problems describes each gap, reordering or modification found
+	Problems []string
+}
+
+// Valid returns whether no problems were found
+func (r *HashChainReport) Valid() bool {
+	return len(r.Problems) == 0
+}
+
+func (r *HashChainReport) problem(line int, format string, args ...interface{}) {
+	r.Problems = append(r.Problems, fmt.Sprintf("line %d: ", line)+fmt.Sprintf(format, args...))
+}
+
+// VerifyHashChain reads a hash chained audit log and checks that no lines
+// are missing, out of order or modified, using the given hex-encoded key.
+//
+// Lines are only trusted once they are anchored: either by the first line of
+// the chain, or by a checkpoint, whose HMAC covers the HMAC of the line
+// before it. A log that has been rotated is therefore verified from its
+// first checkpoint, and the lines before it are reported as unverifiable.
+// After a gap the chain likewise has to be anchored again by a checkpoint,
+// while a line that is out of order leaves the chain where it was so that
+// the rest of the log can still be checked.
+func VerifyHashChain(r io.Reader, key string) (*HashChainReport, error) {
+	keyBytes, err := hex.DecodeString(key)
+	if err != nil || len(keyBytes) == 0 {
+		return nil, fmt.Errorf("invalid hash chain key")
+	}
+
+	report := &HashChainReport{}
+	reader := bufio.NewReader(r)
+
+	var prev string
+	var expected uint64
+	anchored := false
+	for {
+		raw, err := reader.ReadBytes('\n')
+		if len(raw) == 0 && err == io.EOF {
+			break
+		}
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		report.Lines++
+		line := report.Lines
+
+		raw = bytes.TrimSpace(raw)
+		if len(raw) == 0 {
+			report.problem(line, "empty line")
+			continue
+		}
+
+		var entry HashChainEntry
+		if err := json.Unmarshal(raw, &entry); err != nil || entry.Sequence == 0 || entry.HMAC == "" || len(entry.Entry) == 0 {
+			report.problem(line, "not a hash chained audit entry")
+			continue
+		}
+		if report.FirstSequence == 0 {
+			report.FirstSequence = entry.Sequence
+		}
+
+		var checkpoint HashChainCheckpoint
+		isCheckpoint := json.Unmarshal(entry.Entry, &checkpoint) == nil && checkpoint.Type == "checkpoint"
+
+		if anchored {
+			switch {
+			case entry.Sequence < expected:
+				report.problem(line, "sequence %d is out of order, expected %d", entry.Sequence, expected)
+				continue
+			case entry.Sequence > expected:
+				report.problem(line, "missing sequence %d through %d", expected, entry.Sequence-1)
+				anchored = false
+			}
+		}
+		report.LastSequence = entry.Sequence
+
+		// Find the HMAC of the line before this one, which is only known
+		// without reading that line for the start of the chain and for
+		// checkpoints
+		var anchor string
+		switch {
+		case anchored:
+			anchor = prev
+		case entry.Sequence == 1:
+		case isCheckpoint:
+			anchor = checkpoint.Previous
+		default:
+			report.problem(line, "sequence %d cannot be verified before a checkpoint", entry.Sequence)
+			continue
+		}
+
+		if !hmac.Equal([]byte(entry.HMAC), []byte(hashChainHMAC(keyBytes, entry.Sequence, anchor, entry.Entry))) {
+			report.problem(line, "sequence %d has been modified", entry.Sequence)
+			if !anchored {
+				continue
+			}
+		} else if isCheckpoint {
+			report.Checkpoints++
+			report.LastCheckpoint = entry.Sequence
+		}
+
+		anchored = true
+		prev = entry.HMAC
+		expected = entry.Sequence + 1
+	}
+
+	return report, nil
+}
@@ -0,0 +1,204 @@
+package audit
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/vault/helper/salt"
+	"github.com/hashicorp/vault/logical"
+)
+
+func testHashChainLog(t *testing.T, chain *HashChain, paths ...string) []string {
+	salter, _ := salt.NewSalt(nil, nil)
+	formatter := AuditFormatter{
+		AuditFormatWriter: &HashChainFormatWriter{
+			AuditFormatWriter: &JSONFormatWriter{},
+			Chain:             chain,
+		},
+	}
+	config := FormatterConfig{
+		Salt: salter,
+	}
+
+	var buf bytes.Buffer
+	for _, path := range paths {
+		req := &logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      path,
+		}
+		if err := formatter.FormatRequest(&buf, config, nil, req, nil); err != nil {
+			t.Fatalf("err: %v", err)
+		}
+	}
+	lines := strings.SplitAfter(buf.String(), "\n")
+	return lines[:len(lines)-1]
+}
+
+func testVerifyHashChain(t *testing.T, lines []string, key string) *HashChainReport {
+	report, err := VerifyHashChain(strings.NewReader(strings.Join(lines, "")), key)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	return report
+}
+
+func TestHashChain(t *testing.T) {
+	salter, _ := salt.NewSalt(nil, nil)
+	key := HashChainKey(salter)
+	chain, err := NewHashChain(key, 2)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	// A checkpoint is written first and then after every two entries
+	lines := testHashChainLog(t, chain, "a", "b", "c", "d", "e")
+	if len(lines) != 8 {
+		t.Fatalf("bad: %d lines\n%s", len(lines), strings.Join(lines, ""))
+	}
+	var entry HashChainEntry
+	if err := json.Unmarshal([]byte(lines[1]), &entry); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	var req AuditRequestEntry
+	if err := json.Unmarshal(entry.Entry, &req); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if entry.Sequence != 2 || req.Request.Path != "a" {
+		t.Fatalf("bad: %d %#v", entry.Sequence, req)
+	}
+
+	report := testVerifyHashChain(t, lines, key)
+	if !report.Valid() || report.Lines != 8 || report.FirstSequence != 1 || report.LastSequence != 8 {
+		t.Fatalf("bad: %#v", report)
+	}
+	if report.Checkpoints != 3 || report.LastCheckpoint != 7 {
+		t.Fatalf("bad: %#v", report)
+	}
+
+	// The wrong key fails every line
+	other, _ := salt.NewSalt(nil, nil)
+	if report := testVerifyHashChain(t, lines, HashChainKey(other)); len(report.Problems) != 8 {
+		t.Fatalf("bad: %#v", report.Problems)
+	}
+
+	cases := map[string]struct {
+		Lines    []string
+		Problems []string
+	}{
+		"removed": {
+			append(append([]string{}, lines[:3]...), lines[4:]...),
+			[]string{
+				"line 4: missing sequence 4 through 4",
+				"line 4: sequence 5 cannot be verified before a checkpoint",
+				"line 5: sequence 6 cannot be verified before a checkpoint",
+			},
+		},
+		"reordered": {
+			append(append([]string{}, lines[:3]...), lines[4], lines[3], lines[5]),
+			[]string{
+				"line 4: missing sequence 4 through 4",
+				"line 4: sequence 5 cannot be verified before a checkpoint",
+				"line 6: missing sequence 5 through 5",
+				"line 6: sequence 6 cannot be verified before a checkpoint",
+			},
+		},
+		"modified": {
+			append(append([]string{}, lines[:2]...),
+				strings.Replace(lines[2], `"path":"b"`, `"path":"x"`, 1), lines[3]),
+			[]string{"line 3: sequence 3 has been modified"},
+		},
+		"inserted": {
+			append(append([]string{}, lines[:2]...), "not json\n", lines[2]),
+			[]string{"line 3: not a hash chained audit entry"},
+		},
+		"rotated": {
+			lines[3:],
+			nil,
+		},
+		"rotated without checkpoint": {
+			lines[4:],
+			[]string{
+				"line 1: sequence 5 cannot be verified before a checkpoint",
+				"line 2: sequence 6 cannot be verified before a checkpoint",
+			},
+		},
+		"forged start": {
+			append([]string{`{"sequence":5,"hmac":"00","entry":{"type":"request"}}` + "\n"}, lines[5:]...),
+			[]string{
+				"line 1: sequence 5 cannot be verified before a checkpoint",
+				"line 2: sequence 6 cannot be verified before a checkpoint",
+			},
+		},
+	}
+	for name, tc := range cases {
+		report := testVerifyHashChain(t, tc.Lines, key)
+		if strings.Join(report.Problems, "\n") != strings.Join(tc.Problems, "\n") {
+			t.Fatalf("%s: bad: %#v", name, report.Problems)
+		}
+	}
+}
+
+type failingWriter struct{}
+
+func (failingWriter) Write([]byte) (int, error) {
+	return 0, fmt.Errorf("failed")
+}
+
+func TestHashChain_FailedWrite(t *testing.T) {
+	salter, _ := salt.NewSalt(nil, nil)
+	key := HashChainKey(salter)
+	chain, _ := NewHashChain(key, 0)
+
+	// A failed write leaves the chain where it was
+	if err := chain.Write(failingWriter{}, []byte(`{"type":"request"}`)); err == nil {
+		t.Fatalf("expected error")
+	}
+	lines := testHashChainLog(t, chain, "a")
+	if len(lines) != 2 || !strings.HasPrefix(lines[0], `{"sequence":1,`) {
+		t.Fatalf("bad: %v", lines)
+	}
+
+	// A new file starts with a checkpoint
+	chain.RequireCheckpoint()
+	lines = append(lines, testHashChainLog(t, chain, "b")...)
+	report := testVerifyHashChain(t, lines, key)
+	if !report.Valid() || report.Checkpoints != 2 || report.LastCheckpoint != 3 {
+		t.Fatalf("bad: %#v", report)
+	}
+}
+
+func TestHashChain_Resume(t *testing.T) {
+	salter, _ := salt.NewSalt(nil, nil)
+	key := HashChainKey(salter)
+
+	chain, _ := NewHashChain(key, 0)
+	lines := testHashChainLog(t, chain, "a", "b")
+
+	// A new chain carries on from the last line and records that it resumed
+	resumed, _ := NewHashChain(key, 0)
+	resumed.Resume([]byte(strings.TrimSpace(lines[len(lines)-1])))
+	lines = append(lines, testHashChainLog(t, resumed, "c")...)
+
+	report := testVerifyHashChain(t, lines, key)
+	if !report.Valid() || report.LastSequence != 5 || report.Checkpoints != 2 {
+		t.Fatalf("bad: %#v", report)
+	}
+	var entry HashChainEntry
+	var checkpoint HashChainCheckpoint
+	if err := json.Unmarshal([]byte(lines[3]), &entry); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if err := json.Unmarshal(entry.Entry, &checkpoint); err != nil || !checkpoint.Resumed {
+		t.Fatalf("bad: %s", lines[3])
+	}
+
+	// Lines from outside a chain are ignored
+	fresh, _ := NewHashChain(key, 0)
+	fresh.Resume([]byte(`{"type":"request"}`))
+	if lines := testHashChainLog(t, fresh, "a"); !strings.HasPrefix(lines[0], `{"sequence":1,`) {
+		t.Fatalf("bad: %s", lines[0])
+	}
+}
@@ -1,11 +1,14 @@
 package file
 
 import (
+	"bytes"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"strconv"
 	"sync"
+	"time"
 
 	"github.com/hashicorp/vault/audit"
 	"github.com/hashicorp/vault/logical"
@@ -54,6 +57,31 @@ func Factory(conf *audit.BackendConfig) (audit.Backend, error) {
 		logRaw = b
 	}
 
+	// Check if entries should be hash chained
+	hashChain := false
+	if hashChainRaw, ok := conf.Config["hash_chain"]; ok {
+		value, err := strconv.ParseBool(hashChainRaw)
+		if err != nil {
+			return nil, err
+		}
+		hashChain = value
+	}
+	if hashChain && format != "json" {
+		return nil, fmt.Errorf("hash_chain requires the json format")
+	}
+
+	checkpointInterval := audit.DefaultHashChainCheckpointInterval
+	if intervalRaw, ok := conf.Config["hash_chain_checkpoint_interval"]; ok {
+		value, err := strconv.Atoi(intervalRaw)
+		if err != nil {
+			return nil, err
+		}
+		if value <= 0 {
+			return nil, fmt.Errorf("hash_chain_checkpoint_interval must be positive")
+		}
+		checkpointInterval = value
+	}
+
 	// Check if mode is provided
 	mode := os.FileMode(0600)
 	if modeRaw, ok := conf.Config["mode"]; ok {
@@ -64,9 +92,59 @@ func Factory(conf *audit.BackendConfig) (audit.Backend, error) {
 		mode = os.FileMode(m)
 	}
 
+	// Check if rotation is configured
+	var rotateBytes int64
+	if rotateBytesRaw, ok := conf.Config["rotate_bytes"]; ok {
+		value, err := strconv.ParseInt(rotateBytesRaw, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		if value < 0 {
+			return nil, fmt.Errorf("rotate_bytes cannot be negative")
+		}
+		rotateBytes = value
+	}
+
+	var rotateDuration time.Duration
+	if rotateDurationRaw, ok := conf.Config["rotate_duration"]; ok {
+		value, err := time.ParseDuration(rotateDurationRaw)
+		if err != nil {
+			return nil, err
+		}
+		if value < 0 {
+			return nil, fmt.Errorf("rotate_duration cannot be negative")
+		}
+		rotateDuration = value
+	}
+
+	var maxFiles int
+	if maxFilesRaw, ok := conf.Config["max_files"]; ok {
+		value, err := strconv.Atoi(maxFilesRaw)
+		if err != nil {
+			return nil, err
+		}
+		if value < 0 {
+			return nil, fmt.Errorf("max_files cannot be negative")
+		}
+		maxFiles = value
+	}
+
+	compress := false
+	if compressRaw, ok := conf.Config["compress"]; ok {
+		value, err := strconv.ParseBool(compressRaw)
+		if err != nil {
+			return nil, err
+		}
+		compress = value
+	}
+
 	b := &Backend{
-		path: path,
-		mode: mode,
+		path:           path,
+		mode:           mode,
+		rotateBytes:    rotateBytes,
+		rotateDuration: rotateDuration,
+		maxFiles:       maxFiles,
+		compress:       compress,
 		formatConfig: audit.FormatterConfig{
 			Raw:          logRaw,
 			Salt:         conf.Salt,
@@ -81,6 +159,27 @@ func Factory(conf *audit.BackendConfig) (audit.Backend, error) {
 		b.formatter.AuditFormatWriter = &audit.JSONxFormatWriter{}
 	}
 
+	if hashChain {
+		b.hashChainKey = audit.HashChainKey(conf.Salt)
+		chain, err := audit.NewHashChain(b.hashChainKey, checkpointInterval)
+		if err != nil {
+			return nil, err
+		}
+
+		// Carry on from the end of the existing log, if there is one
+		line, err := lastLine(path)
+		if err != nil && !os.IsNotExist(err) {
+			return nil, fmt.Errorf("unable to read %s to resume hash chain: %v", path, err)
+		}
+		chain.Resume(line)
+
+		b.chain = chain
+		b.formatter.AuditFormatWriter = &audit.HashChainFormatWriter{
+			AuditFormatWriter: b.formatter.AuditFormatWriter,
+			Chain:             chain,
+		}
+	}
+
 	// Ensure that the file can be successfully opened for writing;
 	// otherwise it will be too late to catch later without problems
 	// (ref: https://github.com/hashicorp/vault/issues/550)
@@ -93,24 +192,51 @@ func Factory(conf *audit.BackendConfig) (audit.Backend, error) {
 
 // Backend is the audit backend for the file-based audit store.
 //
-// NOTE: This audit backend is currently very simple: it appends to a file.
-// It doesn't do anything more at the moment to assist with rotation
-// or reset the write cursor, this should be done in the future.
+// Entries are appended to a file. If rotation is configured, the file is
+// renamed aside once it grows past rotate_bytes or has been open for longer
+// than rotate_duration, and a new file is started in its place. Rotated
+// segments are compressed and pruned in the background so that logging is
+// only held up for the rename itself.
 type Backend struct {
 	path string
 
 	formatter    audit.AuditFormatter
 	formatConfig audit.FormatterConfig
 
+	rotateBytes    int64
+	rotateDuration time.Duration
+	maxFiles       int
+	compress       bool
+
 	fileLock sync.RWMutex
 	f        *os.File
 	mode     os.FileMode
+	size     int64
+	opened   time.Time
+
+	// rotateErr is the error from the last failed rotation, if any
+	rotateErr error
+
+	// cleanupLock serializes compressing and pruning rotated segments, and
+	// cleanupWg tracks the goroutines doing so
+	cleanupLock sync.Mutex
+	cleanupWg   sync.WaitGroup
+
+	// hashChainKey and chain are set if entries are hash chained
+	hashChainKey string
+	chain        *audit.HashChain
 }
 
 func (b *Backend) GetHash(data string) string {
 	return audit.HashString(b.formatConfig.Salt, data)
 }
 
+// HashChainKey returns the key used to chain entries, or an empty string if
+// they are not chained
+func (b *Backend) HashChainKey() string {
+	return b.hashChainKey
+}
+
 func (b *Backend) LogRequest(auth *logical.Auth, req *logical.Request, outerErr error) error {
 	b.fileLock.Lock()
 	defer b.fileLock.Unlock()
@@ -118,8 +244,9 @@ func (b *Backend) LogRequest(auth *logical.Auth, req *logical.Request, outerErr
 	if err := b.open(); err != nil {
 		return err
 	}
+	b.rotateIfNeeded()
 
-	return b.formatter.FormatRequest(b.f, b.formatConfig, auth, req, outerErr)
+	return b.formatter.FormatRequest(&fileWriter{b}, b.formatConfig, auth, req, outerErr)
 }
 
 func (b *Backend) LogResponse(
@@ -134,8 +261,9 @@ func (b *Backend) LogResponse(
 	if err := b.open(); err != nil {
 		return err
 	}
+	b.rotateIfNeeded()
 
-	return b.formatter.FormatResponse(b.f, b.formatConfig, auth, req, resp, err)
+	return b.formatter.FormatResponse(&fileWriter{b}, b.formatConfig, auth, req, resp, err)
 }
 
 // The file lock must be held before calling this
@@ -159,6 +287,19 @@ func (b *Backend) open() error {
 		return err
 	}
 
+	info, err := b.f.Stat()
+	if err != nil {
+		return err
+	}
+	b.size = info.Size()
+	b.opened = time.Now()
+
+	// Start every file with a checkpoint, so that it can be verified on its
+	// own once rotated
+	if b.chain != nil {
+		b.chain.RequireCheckpoint()
+	}
+
 	return nil
 }
 
@@ -180,3 +321,42 @@ func (b *Backend) Reload() error {
 
 	return b.open()
 }
+
+// lastLine returns the last non-empty line of the file at path, reading
+// backwards from the end so that large logs are not read in full
+func lastLine(path string) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	end, err := f.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, err
+	}
+
+	const chunkSize = 4096
+	var line []byte
+	for offset := end; offset > 0; {
+		size := int64(chunkSize)
+		if offset < size {
+			size = offset
+		}
+		offset -= size
+
+		chunk := make([]byte, size)
+		if _, err := f.ReadAt(chunk, offset); err != nil {
+			return nil, err
+		}
+		line = append(chunk, line...)
+
+		// Skip trailing newlines, then stop once the start of the line is in
+		// hand
+		trimmed := bytes.TrimRight(line, "\r\n")
+		if i := bytes.LastIndexByte(trimmed, '\n'); i >= 0 {
+			return trimmed[i+1:], nil
+		}
+	}
+	return bytes.TrimRight(line, "\r\n"), nil
+}
@@ -5,10 +5,12 @@ import (
 	"os"
 	"path/filepath"
 	"strconv"
+	"strings"
 	"testing"
 
 	"github.com/hashicorp/vault/audit"
 	"github.com/hashicorp/vault/helper/salt"
+	"github.com/hashicorp/vault/logical"
 )
 
 func TestAuditFile_fileModeNew(t *testing.T) {
@@ -83,3 +85,116 @@ func TestAuditFile_fileModeExisting(t *testing.T) {
 		t.Fatalf("File mode does not match.")
 	}
 }
+
+func TestAuditFile_hashChain(t *testing.T) {
+	salter, _ := salt.NewSalt(nil, nil)
+
+	dir, err := ioutil.TempDir("", "vault-test_audit_file-hash_chain")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "audit.log")
+
+	config := map[string]string{
+		"path":       file,
+		"hash_chain": "true",
+	}
+
+	// Log with one backend, then carry on with another as after a restart
+	for _, path := range []string{"foo", "bar"} {
+		b, err := Factory(&audit.BackendConfig{
+			Salt:   salter,
+			Config: config,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if key := b.(audit.HashChainKeyer).HashChainKey(); key != audit.HashChainKey(salter) {
+			t.Fatalf("bad: %s", key)
+		}
+
+		req := &logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      path,
+		}
+		if err := b.LogRequest(nil, req, nil); err != nil {
+			t.Fatal(err)
+		}
+		if err := b.LogResponse(nil, req, nil, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	f, err := os.Open(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	report, err := audit.VerifyHashChain(f, audit.HashChainKey(salter))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.Valid() || report.LastSequence != 6 || report.Checkpoints != 2 {
+		t.Fatalf("bad: %#v", report)
+	}
+
+	// A file reopened after being moved aside starts with a checkpoint, so
+	// that it can be verified on its own
+	b, err := Factory(&audit.BackendConfig{
+		Salt:   salter,
+		Config: config,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(file, file+".old"); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.LogRequest(nil, &logical.Request{Path: "baz"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	rotated, err := os.Open(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rotated.Close()
+	report, err = audit.VerifyHashChain(rotated, audit.HashChainKey(salter))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.Valid() || report.FirstSequence != 7 || report.LastSequence != 8 || report.Checkpoints != 1 {
+		t.Fatalf("bad: %#v", report)
+	}
+
+	// Hash chaining needs JSON
+	config["format"] = "jsonx"
+	if _, err := Factory(&audit.BackendConfig{Salt: salter, Config: config}); err == nil {
+		t.Fatalf("expected error")
+	}
+}
+
+func TestAuditFile_lastLine(t *testing.T) {
+	f, err := ioutil.TempFile("", "vault-test_audit_file-last_line")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+
+	long := strings.Repeat("x", 10000)
+	if _, err := f.WriteString("first\n" + long + "\n\n"); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	line, err := lastLine(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(line) != long {
+		t.Fatalf("bad: %d bytes", len(line))
+	}
+}
@@ -0,0 +1,197 @@
+package file
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// segmentTimeFormat is used to name rotated segments so that they sort
+	// in the order they were written
+	segmentTimeFormat = "20060102T150405.000000000Z"
+
+	// compressedSuffix is appended to the name of compressed segments
+	compressedSuffix = ".gz"
+)
+
+// fileWriter writes to the current file, keeping track of its size. The
+// file lock must be held while it is used.
+type fileWriter struct {
+	b *Backend
+}
+
+func (w *fileWriter) Write(p []byte) (int, error) {
+	n, err := w.b.f.Write(p)
+	w.b.size += int64(n)
+	return n, err
+}
+
+// rotateIfNeeded rotates the file if it has reached the configured size or
+// age. A failed rotation is recorded rather than returned so that logging
+// carries on into the current file. The file lock must be held and the file
+// must be open before calling this.
+func (b *Backend) rotateIfNeeded() {
+	if b.size == 0 {
+		return
+	}
+	switch {
+	case b.rotateBytes > 0 && b.size >= b.rotateBytes:
+	case b.rotateDuration > 0 && time.Since(b.opened) >= b.rotateDuration:
+	default:
+		return
+	}
+
+	b.rotateErr = b.rotate()
+}
+
+// rotate renames the current file aside and opens a new one in its place.
+// The file lock must be held before calling this.
+func (b *Backend) rotate() error {
+	segment := b.path + "." + time.Now().UTC().Format(segmentTimeFormat)
+
+	if err := b.f.Close(); err != nil {
+		return err
+	}
+	b.f = nil
+
+	renameErr := os.Rename(b.path, segment)
+
+	// Always reopen, so that a failed rename leaves logging where it was
+	if err := b.open(); err != nil {
+		return err
+	}
+	if renameErr != nil {
+		return renameErr
+	}
+
+	if b.compress || b.maxFiles > 0 {
+		b.cleanupWg.Add(1)
+		go b.cleanup(segment)
+	}
+	return nil
+}
+
+// cleanup compresses a newly rotated segment if configured to, and then
+// removes the oldest segments beyond the configured maximum
+func (b *Backend) cleanup(segment string) {
+	defer b.cleanupWg.Done()
+
+	b.cleanupLock.Lock()
+	defer b.cleanupLock.Unlock()
+
+	// The segment may already have been pruned by an earlier cleanup if
+	// several rotations happened in quick succession
+	if b.compress {
+		if err := compressSegment(segment, b.mode); err != nil && !os.IsNotExist(err) {
+			b.fileLock.Lock()
+			b.rotateErr = fmt.Errorf("failed to compress %s: %v", segment, err)
+			b.fileLock.Unlock()
+		}
+	}
+
+	if b.maxFiles > 0 {
+		if err := pruneSegments(b.path, b.maxFiles); err != nil {
+			b.fileLock.Lock()
+			b.rotateErr = fmt.Errorf("failed to remove old segments: %v", err)
+			b.fileLock.Unlock()
+		}
+	}
+}
+
+// compressSegment gzips a rotated segment. The compressed file is written
+// under a temporary name and renamed into place before the original is
+// removed, so that a segment is never lost part way through. Plain gzip is
+// used rather than helper/compressutil so that the segments can be read with
+// standard tools.
+func compressSegment(segment string, mode os.FileMode) error {
+	in, err := os.Open(segment)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	tmp := segment + compressedSuffix + ".tmp"
+	out, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode)
+	if err != nil {
+		return err
+	}
+
+	gz := gzip.NewWriter(out)
+	gz.Name = filepath.Base(segment)
+	_, err = io.Copy(gz, in)
+	if closeErr := gz.Close(); err == nil {
+		err = closeErr
+	}
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp, segment+compressedSuffix)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	return os.Remove(segment)
+}
+
+// rotatedSegments returns the rotated segments of the log at path, oldest
+// first
+func rotatedSegments(path string) ([]string, error) {
+	matches, err := filepath.Glob(path + ".*")
+	if err != nil {
+		return nil, err
+	}
+
+	var segments []string
+	for _, match := range matches {
+		stamp := strings.TrimSuffix(strings.TrimPrefix(match, path+"."), compressedSuffix)
+		if _, err := time.Parse(segmentTimeFormat, stamp); err != nil {
+			continue
+		}
+		segments = append(segments, match)
+	}
+
+	sort.Strings(segments)
+	return segments, nil
+}
+
+// pruneSegments removes the oldest rotated segments so that at most
+// maxFiles remain
+func pruneSegments(path string, maxFiles int) error {
+	segments, err := rotatedSegments(path)
+	if err != nil {
+		return err
+	}
+
+	for len(segments) > maxFiles {
+		if err := os.Remove(segments[0]); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		segments = segments[1:]
+	}
+	return nil
+}
+
+// Status reports the file currently being written to and the position
+// within it
+func (b *Backend) Status() map[string]interface{} {
+	b.fileLock.RLock()
+	defer b.fileLock.RUnlock()
+
+	status := map[string]interface{}{
+		"file_path":     b.path,
+		"file_position": b.size,
+	}
+	if b.rotateErr != nil {
+		status["rotate_error"] = b.rotateErr.Error()
+	}
+	return status
+}
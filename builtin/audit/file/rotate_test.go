@@ -0,0 +1,166 @@
+package file
+
+import (
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/audit"
+	"github.com/hashicorp/vault/helper/salt"
+	"github.com/hashicorp/vault/logical"
+)
+
+func testRotateBackend(t *testing.T, config map[string]string) (*Backend, string, func()) {
+	dir, err := ioutil.TempDir("", "vault-test_audit_file-rotate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(dir, "audit.log")
+	config["path"] = file
+
+	salter, _ := salt.NewSalt(nil, nil)
+	b, err := Factory(&audit.BackendConfig{
+		Salt:   salter,
+		Config: config,
+	})
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	return b.(*Backend), file, func() { os.RemoveAll(dir) }
+}
+
+func testRotateLog(t *testing.T, b *Backend, path string) {
+	req := &logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      path,
+	}
+	if err := b.LogRequest(nil, req, nil); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAuditFile_rotateBytes(t *testing.T) {
+	b, file, cleanup := testRotateBackend(t, map[string]string{
+		"rotate_bytes": "1",
+		"max_files":    "2",
+		"compress":     "true",
+	})
+	defer cleanup()
+
+	// Every entry after the first starts a new file
+	for _, path := range []string{"one", "two", "three", "four"} {
+		testRotateLog(t, b, path)
+	}
+	b.cleanupWg.Wait()
+
+	if status := b.Status(); status["rotate_error"] != nil {
+		t.Fatalf("bad: %#v", status)
+	}
+
+	current, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(current), "four") || strings.Contains(string(current), "three") {
+		t.Fatalf("bad: %s", current)
+	}
+
+	segments, err := rotatedSegments(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(segments) != 2 {
+		t.Fatalf("bad: %v", segments)
+	}
+
+	// The newest segments are kept, compressed
+	for i, expected := range []string{"two", "three"} {
+		if !strings.HasSuffix(segments[i], compressedSuffix) {
+			t.Fatalf("bad: %s", segments[i])
+		}
+		f, err := os.Open(segments[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		contents, err := ioutil.ReadAll(gz)
+		f.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(string(contents), expected) {
+			t.Fatalf("bad: %s: %s", segments[i], contents)
+		}
+	}
+}
+
+func TestAuditFile_rotateDuration(t *testing.T) {
+	b, file, cleanup := testRotateBackend(t, map[string]string{
+		"rotate_duration": "50ms",
+	})
+	defer cleanup()
+
+	testRotateLog(t, b, "one")
+	testRotateLog(t, b, "two")
+	if segments, _ := rotatedSegments(file); len(segments) != 0 {
+		t.Fatalf("bad: %v", segments)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	testRotateLog(t, b, "three")
+
+	segments, err := rotatedSegments(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(segments) != 1 || strings.HasSuffix(segments[0], compressedSuffix) {
+		t.Fatalf("bad: %v", segments)
+	}
+	old, err := ioutil.ReadFile(segments[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(old), "two") || strings.Contains(string(old), "three") {
+		t.Fatalf("bad: %s", old)
+	}
+}
+
+func TestAuditFile_status(t *testing.T) {
+	b, file, cleanup := testRotateBackend(t, map[string]string{})
+	defer cleanup()
+
+	testRotateLog(t, b, "foo")
+
+	info, err := os.Stat(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	status := b.Status()
+	if status["file_path"] != file || status["file_position"] != info.Size() {
+		t.Fatalf("bad: %#v", status)
+	}
+}
+
+func TestAuditFile_rotateInvalid(t *testing.T) {
+	salter, _ := salt.NewSalt(nil, nil)
+	for _, config := range []map[string]string{
+		{"rotate_bytes": "-1"},
+		{"rotate_bytes": "big"},
+		{"rotate_duration": "-1s"},
+		{"max_files": "-1"},
+		{"compress": "maybe"},
+	} {
+		config["path"] = "/dev/null"
+		if _, err := Factory(&audit.BackendConfig{Salt: salter, Config: config}); err == nil {
+			t.Fatalf("expected error for %v", config)
+		}
+	}
+}
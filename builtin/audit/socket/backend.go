@@ -0,0 +1,296 @@
+package socket
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/vault/audit"
+	"github.com/hashicorp/vault/logical"
+)
+
+const (
+	// minReconnectBackoff and maxReconnectBackoff bound the time waited
+	// between failed attempts to connect to the socket
+	minReconnectBackoff = 250 * time.Millisecond
+	maxReconnectBackoff = 30 * time.Second
+)
+
+func Factory(conf *audit.BackendConfig) (audit.Backend, error) {
+	if conf.Salt == nil {
+		return nil, fmt.Errorf("nil salt")
+	}
+
+	address, ok := conf.Config["address"]
+	if !ok {
+		return nil, fmt.Errorf("address is required")
+	}
+
+	socketType, ok := conf.Config["socket_type"]
+	if !ok {
+		socketType = "tcp"
+	}
+	switch socketType {
+	case "tcp", "udp", "unix":
+	default:
+		return nil, fmt.Errorf("unknown socket type %s", socketType)
+	}
+
+	writeTimeout := 2 * time.Second
+	if writeTimeoutRaw, ok := conf.Config["write_timeout"]; ok {
+		value, err := time.ParseDuration(writeTimeoutRaw)
+		if err != nil {
+			return nil, err
+		}
+		if value <= 0 {
+			return nil, fmt.Errorf("write_timeout must be positive")
+		}
+		writeTimeout = value
+	}
+
+	bufferSize := 1024
+	if bufferSizeRaw, ok := conf.Config["buffer_size"]; ok {
+		value, err := strconv.Atoi(bufferSizeRaw)
+		if err != nil {
+			return nil, err
+		}
+		if value <= 0 {
+			return nil, fmt.Errorf("buffer_size must be positive")
+		}
+		bufferSize = value
+	}
+
+	format, ok := conf.Config["format"]
+	if !ok {
+		format = "json"
+	}
+	switch format {
+	case "json", "jsonx":
+	default:
+		return nil, fmt.Errorf("unknown format type %s", format)
+	}
+
+	// Check if hashing of accessor is disabled
+	hmacAccessor := true
+	if hmacAccessorRaw, ok := conf.Config["hmac_accessor"]; ok {
+		value, err := strconv.ParseBool(hmacAccessorRaw)
+		if err != nil {
+			return nil, err
+		}
+		hmacAccessor = value
+	}
+
+	// Check if raw logging is enabled
+	logRaw := false
+	if raw, ok := conf.Config["log_raw"]; ok {
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return nil, err
+		}
+		logRaw = b
+	}
+
+	b := &Backend{
+		address:      address,
+		socketType:   socketType,
+		writeTimeout: writeTimeout,
+		bufferSize:   bufferSize,
+		formatConfig: audit.FormatterConfig{
+			Raw:          logRaw,
+			Salt:         conf.Salt,
+			HMACAccessor: hmacAccessor,
+		},
+	}
+
+	switch format {
+	case "json":
+		b.formatter.AuditFormatWriter = &audit.JSONFormatWriter{}
+	case "jsonx":
+		b.formatter.AuditFormatWriter = &audit.JSONxFormatWriter{}
+	}
+
+	// Try to connect up front, but don't fail if the other end is down;
+	// entries are buffered until it comes back, and failing here would
+	// prevent Vault from unsealing while the collector is unavailable
+	b.connect()
+
+	return b, nil
+}
+
+// Backend is the audit backend for the socket-based audit store.
+//
+// Entries are written synchronously, and logging an entry only succeeds once
+// it was written in full, so that requests are not serviced without being
+// audited. Entries that could not be written, or that are queued behind such
+// entries, are held in a bounded buffer and written in order once a
+// connection is re-established. Attempts to reconnect are made as entries
+// are logged, backing off exponentially between failures.
+type Backend struct {
+	address      string
+	socketType   string
+	writeTimeout time.Duration
+	bufferSize   int
+
+	formatter    audit.AuditFormatter
+	formatConfig audit.FormatterConfig
+
+	// l protects the connection and the buffer. written is the number of
+	// bytes of the first buffered entry already written to the connection.
+	l        sync.Mutex
+	conn     net.Conn
+	buffer   [][]byte
+	written  int
+	backoff  time.Duration
+	nextDial time.Time
+}
+
+func (b *Backend) GetHash(data string) string {
+	return audit.HashString(b.formatConfig.Salt, data)
+}
+
+func (b *Backend) LogRequest(auth *logical.Auth, req *logical.Request, outerErr error) error {
+	var buf bytes.Buffer
+	if err := b.formatter.FormatRequest(&buf, b.formatConfig, auth, req, outerErr); err != nil {
+		return err
+	}
+
+	return b.write(buf.Bytes())
+}
+
+func (b *Backend) LogResponse(auth *logical.Auth, req *logical.Request,
+	resp *logical.Response, err error) error {
+	var buf bytes.Buffer
+	if err := b.formatter.FormatResponse(&buf, b.formatConfig, auth, req, resp, err); err != nil {
+		return err
+	}
+
+	return b.write(buf.Bytes())
+}
+
+// write queues an entry behind any that are already buffered and then
+// writes out as many as possible. An error is returned unless the entry was
+// written in full; it then stays buffered to be written later.
+func (b *Backend) write(entry []byte) error {
+	b.l.Lock()
+	defer b.l.Unlock()
+
+	if len(b.buffer) >= b.bufferSize {
+		// Make room if the socket has come back
+		b.flush()
+		if len(b.buffer) >= b.bufferSize {
+			return fmt.Errorf("audit buffer full; unable to write to %s socket %s",
+				b.socketType, b.address)
+		}
+	}
+
+	b.buffer = append(b.buffer, entry)
+	b.flush()
+	if len(b.buffer) > 0 {
+		return fmt.Errorf("unable to write audit entry to %s socket %s; %d entries buffered",
+			b.socketType, b.address, len(b.buffer))
+	}
+	return nil
+}
+
+// flush writes buffered entries to the socket in order, connecting first if
+// necessary. A write that timed out after making progress is resumed on the
+// same connection; any other failed write drops the connection, after which
+// a single reconnection is attempted and the entry is sent again in full.
+// The lock must be held before calling this.
+func (b *Backend) flush() {
+	for attempt := 0; attempt < 2 && len(b.buffer) > 0; attempt++ {
+		if b.conn == nil {
+			if time.Now().Before(b.nextDial) {
+				return
+			}
+			if err := b.connect(); err != nil {
+				return
+			}
+		}
+
+		for len(b.buffer) > 0 {
+			if err := b.writeEntry(b.buffer[0]); err != nil {
+				break
+			}
+			b.buffer[0] = nil
+			b.buffer = b.buffer[1:]
+			b.written = 0
+		}
+	}
+}
+
+// writeEntry writes the remainder of an entry, starting after the bytes
+// already written to the connection. On failure the connection is dropped,
+// unless the write timed out after making progress, in which case the rest
+// can still be written to it. The lock must be held before calling this.
+func (b *Backend) writeEntry(entry []byte) error {
+	if err := b.conn.SetWriteDeadline(time.Now().Add(b.writeTimeout)); err != nil {
+		b.disconnect()
+		return err
+	}
+	n, err := b.conn.Write(entry[b.written:])
+	b.written += n
+	if err != nil {
+		if netErr, ok := err.(net.Error); !ok || !netErr.Timeout() || n == 0 {
+			b.disconnect()
+		}
+		return err
+	}
+	return nil
+}
+
+// connect dials the socket, backing off further attempts if it fails. The
+// lock must be held before calling this.
+func (b *Backend) connect() error {
+	conn, err := net.DialTimeout(b.socketType, b.address, b.writeTimeout)
+	if err != nil {
+		switch {
+		case b.backoff == 0:
+			b.backoff = minReconnectBackoff
+		case b.backoff < maxReconnectBackoff:
+			b.backoff *= 2
+			if b.backoff > maxReconnectBackoff {
+				b.backoff = maxReconnectBackoff
+			}
+		}
+		b.nextDial = time.Now().Add(b.backoff)
+		return err
+	}
+
+	b.conn = conn
+	b.backoff = 0
+	b.nextDial = time.Time{}
+	return nil
+}
+
+// disconnect closes the connection, if any. A partially written entry is
+// sent again in full on the next connection. The lock must be held before
+// calling this.
+func (b *Backend) disconnect() {
+	b.written = 0
+	if b.conn == nil {
+		return
+	}
+	b.conn.Close()
+	b.conn = nil
+}
+
+func (b *Backend) Reload() error {
+	b.l.Lock()
+	defer b.l.Unlock()
+
+	b.disconnect()
+
+	// Reconnect right away, regardless of any backoff in effect
+	b.backoff = 0
+	b.nextDial = time.Time{}
+	if err := b.connect(); err != nil {
+		return err
+	}
+
+	b.flush()
+	return nil
+}
@@ -0,0 +1,254 @@
+package socket
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/audit"
+	"github.com/hashicorp/vault/helper/salt"
+	"github.com/hashicorp/vault/logical"
+)
+
+func testSocketBackend(t *testing.T, config map[string]string) *Backend {
+	salter, _ := salt.NewSalt(nil, nil)
+	b, err := Factory(&audit.BackendConfig{
+		Salt:   salter,
+		Config: config,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b.(*Backend)
+}
+
+func testSocketLogRequest(b *Backend, path string) error {
+	return b.LogRequest(
+		&logical.Auth{ClientToken: "foo", Policies: []string{"root"}},
+		&logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      path,
+			Connection: &logical.Connection{
+				RemoteAddr: "127.0.0.1",
+			},
+		},
+		nil)
+}
+
+// testSocketReadPaths reads n JSON entries from the listener's first
+// connection and returns their request paths
+func testSocketReadPaths(t *testing.T, ln net.Listener, n int) []string {
+	conn, err := ln.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	var paths []string
+	r := bufio.NewReader(conn)
+	for i := 0; i < n; i++ {
+		line, err := r.ReadBytes('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+		var entry audit.AuditRequestEntry
+		if err := json.Unmarshal(line, &entry); err != nil {
+			t.Fatal(err)
+		}
+		if entry.Type != "request" {
+			t.Fatalf("bad: %#v", entry)
+		}
+		paths = append(paths, entry.Request.Path)
+	}
+	return paths
+}
+
+func TestAuditSocket_tcp(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	b := testSocketBackend(t, map[string]string{
+		"address": ln.Addr().String(),
+	})
+	defer b.disconnect()
+
+	for _, path := range []string{"foo", "bar"} {
+		if err := testSocketLogRequest(b, path); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	paths := testSocketReadPaths(t, ln, 2)
+	if strings.Join(paths, ",") != "foo,bar" {
+		t.Fatalf("bad: %v", paths)
+	}
+}
+
+func TestAuditSocket_unix(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vault-test_audit_socket")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "audit.sock")
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	b := testSocketBackend(t, map[string]string{
+		"address":     path,
+		"socket_type": "unix",
+	})
+	defer b.disconnect()
+
+	if err := testSocketLogRequest(b, "foo"); err != nil {
+		t.Fatal(err)
+	}
+
+	paths := testSocketReadPaths(t, ln, 1)
+	if strings.Join(paths, ",") != "foo" {
+		t.Fatalf("bad: %v", paths)
+	}
+}
+
+func TestAuditSocket_buffer(t *testing.T) {
+	// Find a free address and leave nothing listening on it
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	b := testSocketBackend(t, map[string]string{
+		"address":     addr,
+		"buffer_size": "2",
+	})
+	defer b.disconnect()
+
+	// Entries are buffered while the socket is down, until the buffer
+	// fills, but logging them fails
+	for _, path := range []string{"foo", "bar"} {
+		if err := testSocketLogRequest(b, path); err == nil || !strings.Contains(err.Error(), "unable to write") {
+			t.Fatalf("expected write error, got: %v", err)
+		}
+	}
+	if err := testSocketLogRequest(b, "baz"); err == nil || !strings.Contains(err.Error(), "buffer full") {
+		t.Fatalf("expected buffer full error, got: %v", err)
+	}
+	if b.backoff < minReconnectBackoff {
+		t.Fatalf("expected reconnection to back off, got %s", b.backoff)
+	}
+
+	ln, err = net.Listen("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	// Reloading reconnects immediately and flushes the buffer in order
+	if err := b.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if err := testSocketLogRequest(b, "baz"); err != nil {
+		t.Fatal(err)
+	}
+
+	paths := testSocketReadPaths(t, ln, 3)
+	if strings.Join(paths, ",") != "foo,bar,baz" {
+		t.Fatalf("bad: %v", paths)
+	}
+	if len(b.buffer) != 0 || b.backoff != 0 {
+		t.Fatalf("bad: %d buffered, backoff %s", len(b.buffer), b.backoff)
+	}
+}
+
+// partialConn accepts only part of the first write before timing out
+type partialConn struct {
+	net.Conn
+	buf    bytes.Buffer
+	writes int
+	closed bool
+}
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func (c *partialConn) Write(p []byte) (int, error) {
+	c.writes++
+	if c.writes == 1 {
+		c.buf.Write(p[:5])
+		return 5, timeoutError{}
+	}
+	return c.buf.Write(p)
+}
+
+func (c *partialConn) SetWriteDeadline(time.Time) error { return nil }
+
+func (c *partialConn) Close() error {
+	c.closed = true
+	return nil
+}
+
+func TestAuditSocket_partialWrite(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	b := testSocketBackend(t, map[string]string{
+		"address": ln.Addr().String(),
+	})
+	b.disconnect()
+	conn := &partialConn{}
+	b.conn = conn
+
+	// The rest of the entry is written to the same connection
+	if err := testSocketLogRequest(b, "foo"); err != nil {
+		t.Fatal(err)
+	}
+	if conn.closed || conn.writes != 2 || len(b.buffer) != 0 {
+		t.Fatalf("bad: closed %v, %d writes, %d buffered", conn.closed, conn.writes, len(b.buffer))
+	}
+
+	var entry audit.AuditRequestEntry
+	if err := json.Unmarshal(conn.buf.Bytes(), &entry); err != nil {
+		t.Fatalf("err: %s: %q", err, conn.buf.String())
+	}
+	if entry.Request.Path != "foo" {
+		t.Fatalf("bad: %#v", entry)
+	}
+}
+
+func TestAuditSocket_badConfig(t *testing.T) {
+	salter, _ := salt.NewSalt(nil, nil)
+	for _, config := range []map[string]string{
+		{},
+		{"address": "127.0.0.1:9090", "socket_type": "sctp"},
+		{"address": "127.0.0.1:9090", "write_timeout": "0s"},
+		{"address": "127.0.0.1:9090", "buffer_size": "-1"},
+		{"address": "127.0.0.1:9090", "format": "xml"},
+	} {
+		if _, err := Factory(&audit.BackendConfig{Salt: salter, Config: config}); err == nil {
+			t.Fatalf("expected error for %v", config)
+		}
+	}
+}
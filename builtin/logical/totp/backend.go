@@ -0,0 +1,47 @@
+package totp
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+)
+
+// Factory creates and configures the backend
+func Factory(conf *logical.BackendConfig) (logical.Backend, error) {
+	return Backend().Setup(conf)
+}
+
+// Creates a new backend with all the paths belonging to it
+func Backend() *backend {
+	var b backend
+	b.Backend = &framework.Backend{
+		Help: strings.TrimSpace(backendHelp),
+
+		Paths: []*framework.Path{
+			pathListKeys(&b),
+			pathKeys(&b),
+			pathCode(&b),
+		},
+	}
+
+	return &b
+}
+
+type backend struct {
+	*framework.Backend
+
+	// codeLock serializes validating codes and recording their use
+	codeLock sync.Mutex
+}
+
+const backendHelp = `
+The TOTP backend generates and validates time-based one-time passcodes.
+
+Keys are either generated by the backend, returning a barcode and URL to
+share with the user's authenticator app, or imported from another provider,
+in which case the backend generates passcodes for them. The secrets of the
+keys never leave Vault. Passcodes are generated and validated at the
+"code/" path.
+`
@@ -0,0 +1,264 @@
+package totp
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/logical"
+	logicaltest "github.com/hashicorp/vault/logical/testing"
+	"github.com/pquerna/otp"
+	"github.com/pquerna/otp/totp"
+)
+
+func TestBackend_generatedKey(t *testing.T) {
+	var url string
+	logicaltest.Test(t, logicaltest.TestCase{
+		Factory: Factory,
+		Steps: []logicaltest.TestStep{
+			testAccStepCreateKey(t, "test", map[string]interface{}{
+				"generate":     true,
+				"issuer":       "Vault",
+				"account_name": "test@example.com",
+				"digits":       8,
+			}, func(resp *logical.Response) error {
+				if resp == nil {
+					return fmt.Errorf("expected url and barcode")
+				}
+				url = resp.Data["url"].(string)
+				if !strings.HasPrefix(url, "otpauth://totp/Vault:test@example.com?") {
+					return fmt.Errorf("bad url: %s", url)
+				}
+				if resp.Data["barcode"].(string) == "" {
+					return fmt.Errorf("missing barcode")
+				}
+				return nil
+			}),
+			testAccStepReadKey(t, "test", map[string]interface{}{
+				"issuer":       "Vault",
+				"account_name": "test@example.com",
+				"period":       30,
+				"algorithm":    "SHA1",
+				"digits":       8,
+			}),
+			testAccStepListKeys(t, []string{"test"}),
+			testAccStepReadCode(t, "test", func() string { return url }),
+			testAccStepValidateCode(t, "test", "00000000", false),
+			testAccStepDeleteKey(t, "test"),
+			testAccStepListKeys(t, nil),
+		},
+	})
+}
+
+func TestBackend_generatedKeyNotExported(t *testing.T) {
+	logicaltest.Test(t, logicaltest.TestCase{
+		Factory: Factory,
+		Steps: []logicaltest.TestStep{
+			testAccStepCreateKey(t, "test", map[string]interface{}{
+				"generate":     true,
+				"exported":     false,
+				"issuer":       "Vault",
+				"account_name": "test@example.com",
+			}, func(resp *logical.Response) error {
+				if resp != nil {
+					return fmt.Errorf("bad: %#v", resp)
+				}
+				return nil
+			}),
+		},
+	})
+}
+
+func TestBackend_importedKey(t *testing.T) {
+	// Secrets of other providers are usually unpadded
+	const secret = "JBSWY3DPEHPK3PXPAA"
+	url := "otpauth://totp/Google:test@gmail.com?secret=" + secret + "&issuer=Google&algorithm=SHA256&period=60"
+
+	padded, err := normalizeSecret(secret)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if padded != secret+"======" {
+		t.Fatalf("bad: %s", padded)
+	}
+
+	code := func(period uint, algorithm otp.Algorithm) string {
+		c, err := totp.GenerateCodeCustom(padded, time.Now(), totp.ValidateOpts{
+			Period:    period,
+			Digits:    otp.DigitsSix,
+			Algorithm: algorithm,
+		})
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		return c
+	}
+
+	logicaltest.Test(t, logicaltest.TestCase{
+		Factory: Factory,
+		Steps: []logicaltest.TestStep{
+			testAccStepCreateKey(t, "url", map[string]interface{}{
+				"url": url,
+			}, nil),
+			testAccStepReadKey(t, "url", map[string]interface{}{
+				"issuer":       "Google",
+				"account_name": "test@gmail.com",
+				"period":       60,
+				"algorithm":    "SHA256",
+				"digits":       6,
+			}),
+			testAccStepValidateCode(t, "url", code(60, otp.AlgorithmSHA256), true),
+			testAccStepCreateKey(t, "key", map[string]interface{}{
+				"key": strings.ToLower(secret),
+			}, nil),
+			testAccStepValidateCode(t, "key", code(30, otp.AlgorithmSHA1), true),
+			testAccStepValidateCodeUsed(t, "key", code(30, otp.AlgorithmSHA1)),
+		},
+	})
+}
+
+func TestBackend_invalidKeys(t *testing.T) {
+	for name, data := range map[string]map[string]interface{}{
+		"no key":                  {},
+		"bad key":                 {"key": "1!"},
+		"bad url":                 {"url": "https://example.com"},
+		"bad digits":              {"key": "JBSWY3DP", "digits": 7},
+		"bad algorithm":           {"key": "JBSWY3DP", "algorithm": "MD5"},
+		"bad skew":                {"key": "JBSWY3DP", "skew": 2},
+		"generate without issuer": {"generate": true, "account_name": "test"},
+		"generate with key":       {"generate": true, "issuer": "Vault", "account_name": "test", "key": "JBSWY3DP"},
+	} {
+		logicaltest.Test(t, logicaltest.TestCase{
+			Factory: Factory,
+			Steps: []logicaltest.TestStep{
+				logicaltest.TestStep{
+					Operation: logical.UpdateOperation,
+					Path:      "keys/test",
+					Data:      data,
+					ErrorOk:   true,
+					Check: func(resp *logical.Response) error {
+						if resp == nil || !resp.IsError() {
+							return fmt.Errorf("%s: expected error, got %#v", name, resp)
+						}
+						return nil
+					},
+				},
+			},
+		})
+	}
+}
+
+func testAccStepCreateKey(t *testing.T, name string, data map[string]interface{}, check logicaltest.TestCheckFunc) logicaltest.TestStep {
+	return logicaltest.TestStep{
+		Operation: logical.UpdateOperation,
+		Path:      "keys/" + name,
+		Data:      data,
+		Check:     check,
+	}
+}
+
+func testAccStepReadKey(t *testing.T, name string, expected map[string]interface{}) logicaltest.TestStep {
+	return logicaltest.TestStep{
+		Operation: logical.ReadOperation,
+		Path:      "keys/" + name,
+		Check: func(resp *logical.Response) error {
+			if resp == nil {
+				return fmt.Errorf("key %s not found", name)
+			}
+			actual := make(map[string]interface{})
+			for k, v := range resp.Data {
+				actual[k] = fmt.Sprint(v)
+			}
+			for k, v := range expected {
+				expected[k] = fmt.Sprint(v)
+			}
+			if !reflect.DeepEqual(actual, expected) {
+				return fmt.Errorf("bad: %#v", resp.Data)
+			}
+			return nil
+		},
+	}
+}
+
+func testAccStepListKeys(t *testing.T, expected []string) logicaltest.TestStep {
+	return logicaltest.TestStep{
+		Operation: logical.ListOperation,
+		Path:      "keys/",
+		Check: func(resp *logical.Response) error {
+			keys, _ := resp.Data["keys"].([]string)
+			if !reflect.DeepEqual(keys, expected) {
+				return fmt.Errorf("bad: %#v", resp.Data)
+			}
+			return nil
+		},
+	}
+}
+
+// testAccStepReadCode checks the generated code against the key of the url
+func testAccStepReadCode(t *testing.T, name string, url func() string) logicaltest.TestStep {
+	return logicaltest.TestStep{
+		Operation: logical.ReadOperation,
+		Path:      "code/" + name,
+		Check: func(resp *logical.Response) error {
+			key, err := otp.NewKeyFromURL(url())
+			if err != nil {
+				return err
+			}
+			code := resp.Data["code"].(string)
+			valid, err := totp.ValidateCustom(code, key.Secret(), time.Now(), totp.ValidateOpts{
+				Skew:      1,
+				Digits:    otp.DigitsEight,
+				Algorithm: otp.AlgorithmSHA1,
+			})
+			if err != nil {
+				return err
+			}
+			if !valid {
+				return fmt.Errorf("invalid code: %s", code)
+			}
+			return nil
+		},
+	}
+}
+
+func testAccStepValidateCode(t *testing.T, name, code string, valid bool) logicaltest.TestStep {
+	return logicaltest.TestStep{
+		Operation: logical.UpdateOperation,
+		Path:      "code/" + name,
+		Data: map[string]interface{}{
+			"code": code,
+		},
+		Check: func(resp *logical.Response) error {
+			if resp.Data["valid"] != valid {
+				return fmt.Errorf("bad: %#v", resp.Data)
+			}
+			return nil
+		},
+	}
+}
+
+func testAccStepValidateCodeUsed(t *testing.T, name, code string) logicaltest.TestStep {
+	return logicaltest.TestStep{
+		Operation: logical.UpdateOperation,
+		Path:      "code/" + name,
+		Data: map[string]interface{}{
+			"code": code,
+		},
+		ErrorOk: true,
+		Check: func(resp *logical.Response) error {
+			if resp == nil || !resp.IsError() {
+				return fmt.Errorf("expected error, got %#v", resp)
+			}
+			return nil
+		},
+	}
+}
+
+func testAccStepDeleteKey(t *testing.T, name string) logicaltest.TestStep {
+	return logicaltest.TestStep{
+		Operation: logical.DeleteOperation,
+		Path:      "keys/" + name,
+	}
+}
@@ -0,0 +1,139 @@
+package totp
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/vault/helper/otputil"
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+	"github.com/pquerna/otp"
+	"github.com/pquerna/otp/hotp"
+	"github.com/pquerna/otp/totp"
+)
+
+func pathCode(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "code/" + framework.GenericNameRegex("name"),
+		Fields: map[string]*framework.FieldSchema{
+			"name": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Name of the key.",
+			},
+			"code": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "TOTP code to be validated.",
+			},
+		},
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ReadOperation:   b.pathReadCode,
+			logical.UpdateOperation: b.pathValidateCode,
+		},
+		HelpSynopsis:    pathCodeHelpSyn,
+		HelpDescription: pathCodeHelpDesc,
+	}
+}
+
+// Generates the current passcode of a key
+func (b *backend) pathReadCode(req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	name := d.Get("name").(string)
+	if name == "" {
+		return logical.ErrorResponse("missing name"), nil
+	}
+
+	key, err := b.Key(req.Storage, name)
+	if err != nil {
+		return nil, err
+	}
+	if key == nil {
+		return logical.ErrorResponse(fmt.Sprintf("unknown key: %s", name)), nil
+	}
+
+	code, err := totp.GenerateCodeCustom(key.Key, time.Now(), key.validateOpts())
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate code: %v", err)
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"code": code,
+		},
+	}, nil
+}
+
+// Validates a passcode against a key
+func (b *backend) pathValidateCode(req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	name := d.Get("name").(string)
+	if name == "" {
+		return logical.ErrorResponse("missing name"), nil
+	}
+	code := d.Get("code").(string)
+	if code == "" {
+		return logical.ErrorResponse("missing code"), nil
+	}
+
+	// Validating a code and recording its use is serialized, so that
+	// concurrent requests can't use the same code twice
+	b.codeLock.Lock()
+	defer b.codeLock.Unlock()
+
+	key, err := b.Key(req.Storage, name)
+	if err != nil {
+		return nil, err
+	}
+	if key == nil {
+		return logical.ErrorResponse(fmt.Sprintf("unknown key: %s", name)), nil
+	}
+
+	opts := key.validateOpts()
+	counter, valid := otputil.ValidatePasscode(code, key.Key, time.Now(), key.Period, key.Skew, hotp.ValidateOpts{
+		Digits:    opts.Digits,
+		Algorithm: opts.Algorithm,
+	})
+	if !valid {
+		return &logical.Response{
+			Data: map[string]interface{}{
+				"valid": false,
+			},
+		}, nil
+	}
+
+	// A code, or one of an earlier time step, may only be used once
+	if counter <= key.LastCounter {
+		return logical.ErrorResponse("code already used; wait until the next time period"), nil
+	}
+	key.LastCounter = counter
+	if err := b.putKey(req.Storage, name, key); err != nil {
+		return nil, err
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"valid": true,
+		},
+	}, nil
+}
+
+func (k *keyEntry) validateOpts() totp.ValidateOpts {
+	// The algorithm was validated when the key was created
+	algorithm, _ := otputil.ParseAlgorithm(k.Algorithm)
+	return totp.ValidateOpts{
+		Period:    k.Period,
+		Skew:      k.Skew,
+		Digits:    otp.Digits(k.Digits),
+		Algorithm: algorithm,
+	}
+}
+
+const pathCodeHelpSyn = `
+Request a time-based one-time use password or validate a password for a certain key.
+`
+
+const pathCodeHelpDesc = `
+This path generates and validates passcodes for the keys of this backend.
+
+Reading the path returns the current passcode of the key. Writing a "code"
+to the path returns whether it is valid for the key, allowing for the skew
+of the key. A valid code can only be used once, and once it has been used,
+codes of earlier time periods are rejected as well.
+`
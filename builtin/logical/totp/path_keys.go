@@ -0,0 +1,384 @@
+package totp
+
+import (
+	"bytes"
+	"encoding/base32"
+	"encoding/base64"
+	"fmt"
+	"image/png"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/hashicorp/vault/helper/otputil"
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+	"github.com/pquerna/otp"
+	"github.com/pquerna/otp/totp"
+)
+
+func pathListKeys(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "keys/?$",
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ListOperation: b.pathKeyList,
+		},
+		HelpSynopsis:    pathKeyHelpSyn,
+		HelpDescription: pathKeyHelpDesc,
+	}
+}
+
+func pathKeys(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "keys/" + framework.GenericNameRegex("name"),
+		Fields: map[string]*framework.FieldSchema{
+			"name": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Name of the key.",
+			},
+			"generate": &framework.FieldSchema{
+				Type:        framework.TypeBool,
+				Default:     false,
+				Description: "Determines if a key should be generated by Vault or if a key is being passed from another service.",
+			},
+			"exported": &framework.FieldSchema{
+				Type:        framework.TypeBool,
+				Default:     true,
+				Description: "Determines if a QR code and url are returned upon generating a key. Only used if generate is true.",
+			},
+			"key_size": &framework.FieldSchema{
+				Type:        framework.TypeInt,
+				Default:     20,
+				Description: "Determines the size in bytes of the generated key. Only used if generate is true.",
+			},
+			"url": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "A TOTP url string containing all of the parameters for key setup. Only used if generate is false.",
+			},
+			"key": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "The shared master key used to generate a TOTP token. Only used if generate is false.",
+			},
+			"issuer": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "The name of the key's issuing organization.",
+			},
+			"account_name": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "The name of the account associated with the key.",
+			},
+			"period": &framework.FieldSchema{
+				Type:        framework.TypeInt,
+				Default:     30,
+				Description: "The length of time in seconds used to generate a counter for the TOTP token calculation.",
+			},
+			"algorithm": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Default:     "SHA1",
+				Description: "The hashing algorithm used to generate the TOTP token. Options include SHA1, SHA256 and SHA512.",
+			},
+			"digits": &framework.FieldSchema{
+				Type:        framework.TypeInt,
+				Default:     6,
+				Description: "The number of digits in the generated TOTP token. This value can either be 6 or 8.",
+			},
+			"skew": &framework.FieldSchema{
+				Type:        framework.TypeInt,
+				Default:     1,
+				Description: "The number of delay periods that are allowed when validating a TOTP token. This value can either be 0 or 1.",
+			},
+			"qr_size": &framework.FieldSchema{
+				Type:        framework.TypeInt,
+				Default:     200,
+				Description: "The pixel size of the generated square QR code. Only used if generate is true and exported is true. If this value is 0, a QR code will not be returned.",
+			},
+		},
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ReadOperation:   b.pathKeyRead,
+			logical.UpdateOperation: b.pathKeyCreate,
+			logical.DeleteOperation: b.pathKeyDelete,
+		},
+		HelpSynopsis:    pathKeyHelpSyn,
+		HelpDescription: pathKeyHelpDesc,
+	}
+}
+
+// Reads the key from the storage
+func (b *backend) Key(s logical.Storage, n string) (*keyEntry, error) {
+	entry, err := s.Get("key/" + n)
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, nil
+	}
+
+	var result keyEntry
+	if err := entry.DecodeJSON(&result); err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+// Writes the key to the storage
+func (b *backend) putKey(s logical.Storage, n string, key *keyEntry) error {
+	entry, err := logical.StorageEntryJSON("key/"+n, key)
+	if err != nil {
+		return err
+	}
+	return s.Put(entry)
+}
+
+// Deletes an existing key
+func (b *backend) pathKeyDelete(req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	name := d.Get("name").(string)
+	if name == "" {
+		return logical.ErrorResponse("missing name"), nil
+	}
+
+	return nil, req.Storage.Delete("key/" + name)
+}
+
+// Reads an existing key, leaving out its secret
+func (b *backend) pathKeyRead(req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	name := d.Get("name").(string)
+	if name == "" {
+		return logical.ErrorResponse("missing name"), nil
+	}
+
+	key, err := b.Key(req.Storage, name)
+	if err != nil {
+		return nil, err
+	}
+	if key == nil {
+		return nil, nil
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"issuer":       key.Issuer,
+			"account_name": key.AccountName,
+			"period":       key.Period,
+			"algorithm":    key.Algorithm,
+			"digits":       key.Digits,
+		},
+	}, nil
+}
+
+// Lists all the keys registered with the backend
+func (b *backend) pathKeyList(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	keys, err := req.Storage.List("key/")
+	if err != nil {
+		return nil, err
+	}
+
+	return logical.ListResponse(keys), nil
+}
+
+// Generates a new key or imports one from another provider
+func (b *backend) pathKeyCreate(req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	name := d.Get("name").(string)
+	if name == "" {
+		return logical.ErrorResponse("missing name"), nil
+	}
+
+	generate := d.Get("generate").(bool)
+	exported := d.Get("exported").(bool)
+	keySize := d.Get("key_size").(int)
+	inputURL := d.Get("url").(string)
+	inputKey := d.Get("key").(string)
+	qrSize := d.Get("qr_size").(int)
+	period := d.Get("period").(int)
+	skew := d.Get("skew").(int)
+
+	if period <= 0 {
+		return logical.ErrorResponse("the period value must be greater than zero"), nil
+	}
+	if skew != 0 && skew != 1 {
+		return logical.ErrorResponse("the skew value must be 0 or 1"), nil
+	}
+
+	key := &keyEntry{
+		Issuer:      d.Get("issuer").(string),
+		AccountName: d.Get("account_name").(string),
+		Period:      uint(period),
+		Algorithm:   d.Get("algorithm").(string),
+		Digits:      d.Get("digits").(int),
+		Skew:        uint(skew),
+	}
+
+	// Imported keys take their parameters from the url, if given
+	if !generate && inputURL != "" {
+		if err := key.parseURL(inputURL); err != nil {
+			return logical.ErrorResponse(err.Error()), nil
+		}
+		inputKey = key.Key
+	}
+
+	if _, err := otputil.ParseAlgorithm(key.Algorithm); err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+	if key.Digits != 6 && key.Digits != 8 {
+		return logical.ErrorResponse("the digits value can only be 6 or 8"), nil
+	}
+	if key.Period == 0 {
+		return logical.ErrorResponse("the period value must be greater than zero"), nil
+	}
+
+	var resp *logical.Response
+	if generate {
+		if inputURL != "" || inputKey != "" {
+			return logical.ErrorResponse("a url or key cannot be given when generating a key"), nil
+		}
+		if key.Issuer == "" {
+			return logical.ErrorResponse("the issuer value is required when generating a key"), nil
+		}
+		if key.AccountName == "" {
+			return logical.ErrorResponse("the account_name value is required when generating a key"), nil
+		}
+		if keySize <= 0 {
+			return logical.ErrorResponse("the key_size value must be greater than zero"), nil
+		}
+		if qrSize < 0 {
+			return logical.ErrorResponse("the qr_size value must be zero or greater"), nil
+		}
+
+		algorithm, _ := otputil.ParseAlgorithm(key.Algorithm)
+		otpKey, err := totp.Generate(totp.GenerateOpts{
+			Issuer:      key.Issuer,
+			AccountName: key.AccountName,
+			Period:      key.Period,
+			SecretSize:  uint(keySize),
+			Digits:      otp.Digits(key.Digits),
+			Algorithm:   algorithm,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate key: %v", err)
+		}
+		key.Key = otpKey.Secret()
+
+		if exported {
+			resp = &logical.Response{
+				Data: map[string]interface{}{
+					"url": otpKey.String(),
+				},
+			}
+			if qrSize > 0 {
+				img, err := otpKey.Image(qrSize, qrSize)
+				if err != nil {
+					return nil, fmt.Errorf("failed to generate QR code image: %v", err)
+				}
+				var buf bytes.Buffer
+				if err := png.Encode(&buf, img); err != nil {
+					return nil, err
+				}
+				resp.Data["barcode"] = base64.StdEncoding.EncodeToString(buf.Bytes())
+			}
+		}
+	} else {
+		if inputKey == "" {
+			return logical.ErrorResponse("a url or key is required when importing a key"), nil
+		}
+		secret, err := normalizeSecret(inputKey)
+		if err != nil {
+			return logical.ErrorResponse(err.Error()), nil
+		}
+		key.Key = secret
+	}
+
+	// Store it
+	if err := b.putKey(req.Storage, name, key); err != nil {
+		return nil, err
+	}
+
+	return resp, nil
+}
+
+// parseURL sets the parameters of the key from an otpauth:// url
+func (k *keyEntry) parseURL(inputURL string) error {
+	u, err := url.Parse(inputURL)
+	if err != nil {
+		return fmt.Errorf("failed to parse url: %v", err)
+	}
+	if u.Scheme != "otpauth" || u.Host != "totp" {
+		return fmt.Errorf("url must be an otpauth://totp/ url")
+	}
+
+	otpKey, err := otp.NewKeyFromURL(inputURL)
+	if err != nil {
+		return fmt.Errorf("failed to parse url: %v", err)
+	}
+	k.Key = otpKey.Secret()
+	k.Issuer = otpKey.Issuer()
+	k.AccountName = otpKey.AccountName()
+
+	q := u.Query()
+	if v := q.Get("period"); v != "" {
+		period, err := strconv.ParseUint(v, 10, 32)
+		if err != nil {
+			return fmt.Errorf("invalid period in url: %v", v)
+		}
+		k.Period = uint(period)
+	}
+	if v := q.Get("digits"); v != "" {
+		digits, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("invalid digits in url: %v", v)
+		}
+		k.Digits = digits
+	}
+	if v := q.Get("algorithm"); v != "" {
+		k.Algorithm = strings.ToUpper(v)
+	}
+	return nil
+}
+
+// normalizeSecret returns the base32 secret in the padded, upper case form
+// the passcode generation expects
+func normalizeSecret(secret string) (string, error) {
+	secret = strings.ToUpper(strings.Replace(secret, " ", "", -1))
+	secret = strings.TrimRight(secret, "=")
+	if n := len(secret) % 8; n != 0 {
+		secret += strings.Repeat("=", 8-n)
+	}
+	if _, err := base32.StdEncoding.DecodeString(secret); err != nil {
+		return "", fmt.Errorf("invalid key value: %v", err)
+	}
+	return secret, nil
+}
+
+// A TOTP key along with the parameters its passcodes are generated with
+type keyEntry struct {
+	Key         string `json:"key"`
+	Issuer      string `json:"issuer"`
+	AccountName string `json:"account_name"`
+	Period      uint   `json:"period"`
+	Algorithm   string `json:"algorithm"`
+	Digits      int    `json:"digits"`
+	Skew        uint   `json:"skew"`
+
+	// LastCounter is the time step of the last code validated, which
+	// can't be used again
+	LastCounter uint64 `json:"last_counter"`
+}
+
+const pathKeyHelpSyn = `
+Manage the keys that can be used to generate and validate TOTP passcodes.
+`
+
+const pathKeyHelpDesc = `
+This path lets you manage the keys used to generate and validate TOTP
+passcodes.
+
+If "generate" is true, the key is generated by Vault and returned once as an
+otpauth:// url along with a base64 encoded PNG of its QR code, unless
+"exported" is false. "issuer" and "account_name" are required in that case.
+
+Otherwise, the key is imported from another provider, either as an
+otpauth:// "url" holding all of its parameters, or as a base32 encoded "key"
+using the parameters given alongside it.
+
+Reading a key returns its parameters, but never the key itself.
+`
@@ -1,6 +1,8 @@
 package transit
 
 import (
+	"strings"
+
 	"github.com/hashicorp/vault/helper/keysutil"
 	"github.com/hashicorp/vault/logical"
 	"github.com/hashicorp/vault/logical/framework"
@@ -19,6 +21,24 @@ func Factory(conf *logical.BackendConfig) (logical.Backend, error) {
 func Backend(conf *logical.BackendConfig) *backend {
 	var b backend
 	b.Backend = &framework.Backend{
+		PathsSpecial: &logical.Paths{
+			// Key management updates the cached policy before persisting
+			// it, so only the paths that use keys are served locally
+			PerformanceStandby: []string{
+				"encrypt/*",
+				"decrypt/*",
+				"rewrap/*",
+				"datakey/*",
+				"random",
+				"random/*",
+				"hash",
+				"hash/*",
+				"hmac/*",
+				"sign/*",
+				"verify/*",
+			},
+		},
+
 		Paths: []*framework.Path{
 			// Rotate/Config needs to come before Keys
 			// as the handler is greedy
@@ -38,6 +58,8 @@ func Backend(conf *logical.BackendConfig) *backend {
 		},
 
 		Secrets: []*framework.Secret{},
+
+		Invalidate: b.invalidate,
 	}
 
 	b.lm = keysutil.NewLockManager(conf.System.CachingDisabled())
@@ -49,3 +71,9 @@ type backend struct {
 	*framework.Backend
 	lm *keysutil.LockManager
 }
+
+func (b *backend) invalidate(key string) {
+	if strings.HasPrefix(key, "policy/") {
+		b.lm.InvalidatePolicy(strings.TrimPrefix(key, "policy/"))
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"os"
 
 	auditFile "github.com/hashicorp/vault/builtin/audit/file"
+	auditSocket "github.com/hashicorp/vault/builtin/audit/socket"
 	auditSyslog "github.com/hashicorp/vault/builtin/audit/syslog"
 	"github.com/hashicorp/vault/version"
 
@@ -26,6 +27,7 @@ import (
 	"github.com/hashicorp/vault/builtin/logical/postgresql"
 	"github.com/hashicorp/vault/builtin/logical/rabbitmq"
 	"github.com/hashicorp/vault/builtin/logical/ssh"
+	"github.com/hashicorp/vault/builtin/logical/totp"
 	"github.com/hashicorp/vault/builtin/logical/transit"
 
 	"github.com/hashicorp/vault/audit"
@@ -58,12 +60,20 @@ func Commands(metaPtr *meta.Meta) map[string]cli.CommandFactory {
 			}, nil
 		},
 
+		"agent": func() (cli.Command, error) {
+			return &command.AgentCommand{
+				Meta:       *metaPtr,
+				ShutdownCh: command.MakeShutdownCh(),
+			}, nil
+		},
+
 		"server": func() (cli.Command, error) {
 			return &command.ServerCommand{
 				Meta: *metaPtr,
 				AuditBackends: map[string]audit.Factory{
 					"file":   auditFile.Factory,
 					"syslog": auditSyslog.Factory,
+					"socket": auditSocket.Factory,
 				},
 				CredentialBackends: map[string]logical.Factory{
 					"approle":  credAppRole.Factory,
@@ -87,6 +97,7 @@ func Commands(metaPtr *meta.Meta) map[string]cli.CommandFactory {
 					"mysql":      mysql.Factory,
 					"ssh":        ssh.Factory,
 					"rabbitmq":   rabbitmq.Factory,
+					"totp":       totp.Factory,
 				},
 				ShutdownCh: command.MakeShutdownCh(),
 				SighupCh:   command.MakeSighupCh(),
@@ -147,6 +158,12 @@ func Commands(metaPtr *meta.Meta) map[string]cli.CommandFactory {
 			}, nil
 		},
 
+		"audit-verify": func() (cli.Command, error) {
+			return &command.AuditVerifyCommand{
+				Meta: *metaPtr,
+			}, nil
+		},
+
 		"key-status": func() (cli.Command, error) {
 			return &command.KeyStatusCommand{
 				Meta: *metaPtr,
@@ -225,6 +242,12 @@ func Commands(metaPtr *meta.Meta) map[string]cli.CommandFactory {
 			}, nil
 		},
 
+		"lease-lookup": func() (cli.Command, error) {
+			return &command.LeaseLookupCommand{
+				Meta: *metaPtr,
+			}, nil
+		},
+
 		"seal": func() (cli.Command, error) {
 			return &command.SealCommand{
 				Meta: *metaPtr,
@@ -273,6 +296,12 @@ func Commands(metaPtr *meta.Meta) map[string]cli.CommandFactory {
 			}, nil
 		},
 
+		"operator migrate": func() (cli.Command, error) {
+			return &command.OperatorMigrateCommand{
+				Meta: *metaPtr,
+			}, nil
+		},
+
 		"rotate": func() (cli.Command, error) {
 			return &command.RotateCommand{
 				Meta: *metaPtr,
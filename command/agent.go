@@ -0,0 +1,381 @@
+package command
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	colorable "github.com/mattn/go-colorable"
+	log "github.com/mgutz/logxi/v1"
+
+	"github.com/hashicorp/vault/api"
+	"github.com/hashicorp/vault/command/agent/auth"
+	"github.com/hashicorp/vault/command/agent/auth/approle"
+	"github.com/hashicorp/vault/command/agent/auth/awsec2"
+	"github.com/hashicorp/vault/command/agent/auth/cert"
+	"github.com/hashicorp/vault/command/agent/cache"
+	"github.com/hashicorp/vault/command/agent/config"
+	"github.com/hashicorp/vault/command/agent/sink"
+	"github.com/hashicorp/vault/command/agent/sink/file"
+	"github.com/hashicorp/vault/command/agent/template"
+	"github.com/hashicorp/vault/command/server"
+	"github.com/hashicorp/vault/helper/gated-writer"
+	"github.com/hashicorp/vault/helper/logformat"
+	"github.com/hashicorp/vault/meta"
+)
+
+// AgentCommand is a Command that starts a Vault agent, which logs in to
+// Vault on behalf of applications and keeps the token renewed.
+type AgentCommand struct {
+	meta.Meta
+
+	ShutdownCh chan struct{}
+
+	logger log.Logger
+}
+
+func (c *AgentCommand) Run(args []string) int {
+	var configPath, logLevel string
+	flags := c.Meta.FlagSet("agent", meta.FlagSetNone)
+	flags.StringVar(&configPath, "config", "", "")
+	flags.StringVar(&logLevel, "log-level", "info", "")
+	flags.Usage = func() { c.Ui.Output(c.Help()) }
+	if err := flags.Parse(args); err != nil {
+		return 1
+	}
+
+	if configPath == "" {
+		c.Ui.Error("A config path must be specified with -config")
+		flags.Usage()
+		return 1
+	}
+
+	// Create a logger. We wrap it in a gated writer so that it doesn't
+	// start logging too early.
+	logGate := &gatedwriter.Writer{Writer: colorable.NewColorable(os.Stderr)}
+	var level int
+	switch logLevel {
+	case "trace":
+		level = log.LevelTrace
+	case "debug":
+		level = log.LevelDebug
+	case "info":
+		level = log.LevelInfo
+	case "notice":
+		level = log.LevelNotice
+	case "warn":
+		level = log.LevelWarn
+	case "err":
+		level = log.LevelError
+	default:
+		c.Ui.Error(fmt.Sprintf("Unknown log level %s", logLevel))
+		return 1
+	}
+	c.logger = logformat.NewVaultLoggerWithWriter(logGate, level)
+
+	agentConfig, err := config.LoadConfig(configPath)
+	if err != nil {
+		c.Ui.Error(fmt.Sprintf("Error loading configuration from %s: %s", configPath, err))
+		return 1
+	}
+	if agentConfig.AutoAuth == nil && agentConfig.Cache == nil {
+		c.Ui.Error("No 'auto_auth' or 'cache' stanza found in the configuration")
+		return 1
+	}
+
+	clientConfig, err := agentClientConfig(agentConfig.Vault)
+	if err != nil {
+		c.Ui.Error(fmt.Sprintf("Error creating Vault client: %s", err))
+		return 1
+	}
+	client, err := agentClient(clientConfig)
+	if err != nil {
+		c.Ui.Error(fmt.Sprintf("Error creating Vault client: %s", err))
+		return 1
+	}
+
+	if agentConfig.PidFile != "" {
+		if err := ioutil.WriteFile(agentConfig.PidFile, []byte(strconv.Itoa(os.Getpid())), 0644); err != nil {
+			c.Ui.Error(fmt.Sprintf("Error writing pid file: %s", err))
+			return 1
+		}
+		defer func() {
+			if err := os.Remove(agentConfig.PidFile); err != nil {
+				c.Ui.Error(fmt.Sprintf("Error removing pid file: %s", err))
+			}
+		}()
+	}
+
+	// Everything started below is stopped by closing this channel
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+
+	info := map[string]string{
+		"vault address": client.Address(),
+		"log level":     logLevel,
+	}
+
+	var proxy *cache.Proxy
+	if agentConfig.Cache != nil {
+		proxy = cache.NewProxy(&cache.ProxyConfig{
+			Logger:           c.logger,
+			Client:           client,
+			UseAutoAuthToken: agentConfig.Cache.UseAutoAuthToken,
+		})
+
+		var addrs []string
+		for _, lnConfig := range agentConfig.Listeners {
+			ln, props, _, err := server.NewListener(lnConfig.Type, lnConfig.Config, logGate)
+			if err != nil {
+				c.Ui.Error(fmt.Sprintf("Error initializing listener of type %s: %s", lnConfig.Type, err))
+				return 1
+			}
+			defer ln.Close()
+
+			srv := &http.Server{
+				Handler: proxy,
+			}
+			go srv.Serve(ln)
+
+			var propsList []string
+			for k, v := range props {
+				propsList = append(propsList, fmt.Sprintf("%s: %q", k, v))
+			}
+			sort.Strings(propsList)
+			addrs = append(addrs, fmt.Sprintf("%s (%s)", lnConfig.Type, strings.Join(propsList, ", ")))
+		}
+		info["listener"] = strings.Join(addrs, ", ")
+	}
+
+	if agentConfig.AutoAuth != nil {
+		method, err := c.authMethod(agentConfig.AutoAuth.Method)
+		if err != nil {
+			c.Ui.Error(fmt.Sprintf("Error creating %s auth method: %s", agentConfig.AutoAuth.Method.Type, err))
+			return 1
+		}
+
+		sinks, err := c.sinks(agentConfig.AutoAuth.Sinks)
+		if err != nil {
+			c.Ui.Error(fmt.Sprintf("Error creating sinks: %s", err))
+			return 1
+		}
+
+		ah := auth.NewAuthHandler(&auth.AuthHandlerConfig{
+			Logger: c.logger,
+			Client: client,
+		})
+		ss := sink.NewSinkServer(&sink.SinkServerConfig{
+			Logger: c.logger,
+			Client: client,
+		})
+
+		var ts *template.Server
+		var templateCh chan string
+		if len(agentConfig.Templates) > 0 {
+			var templates []*template.TemplateConfig
+			for _, t := range agentConfig.Templates {
+				templates = append(templates, &template.TemplateConfig{
+					Source:         t.Source,
+					Destination:    t.Destination,
+					Perms:          t.Perms,
+					Command:        t.Command,
+					CommandTimeout: t.CommandTimeout,
+				})
+			}
+			ts, err = template.NewServer(&template.ServerConfig{
+				Logger:       c.logger,
+				ClientConfig: clientConfig,
+			}, templates)
+			if err != nil {
+				c.Ui.Error(fmt.Sprintf("Error creating template server: %s", err))
+				return 1
+			}
+			templateCh = make(chan string)
+			info["templates"] = strconv.Itoa(len(templates))
+		}
+
+		// New tokens go to the sinks, the templates and the proxy
+		sinkCh := make(chan string)
+		go func() {
+			for {
+				select {
+				case <-stopCh:
+					return
+				case token := <-ah.OutputCh:
+					if proxy != nil {
+						proxy.SetToken(token)
+					}
+					select {
+					case <-stopCh:
+						return
+					case sinkCh <- token:
+					}
+					if ts != nil {
+						select {
+						case <-stopCh:
+							return
+						case templateCh <- token:
+						}
+					}
+				}
+			}
+		}()
+
+		go ah.Run(stopCh, method)
+		go ss.Run(stopCh, sinkCh, sinks)
+		if ts != nil {
+			go ts.Run(stopCh, templateCh)
+		}
+
+		info["auth method"] = fmt.Sprintf("%s (mounted at %s)", agentConfig.AutoAuth.Method.Type, agentConfig.AutoAuth.Method.MountPath)
+	}
+
+	infoKeys := make([]string, 0, len(info))
+	for k := range info {
+		infoKeys = append(infoKeys, k)
+	}
+	sort.Strings(infoKeys)
+
+	c.Ui.Output("==> Vault agent configuration:\n")
+	for _, k := range infoKeys {
+		c.Ui.Output(fmt.Sprintf("%24s: %s", strings.Title(k), info[k]))
+	}
+	c.Ui.Output("")
+	c.Ui.Output("==> Vault agent started! Log data will stream in below:\n")
+
+	// Release the log gate.
+	logGate.Flush()
+
+	<-c.ShutdownCh
+	c.Ui.Output("==> Vault agent shutdown triggered")
+
+	return 0
+}
+
+// authMethod creates the configured auth method
+func (c *AgentCommand) authMethod(m *config.Method) (auth.AuthMethod, error) {
+	authConfig := &auth.AuthConfig{
+		Logger:    c.logger,
+		MountPath: m.MountPath,
+		Config:    m.Config,
+	}
+
+	switch m.Type {
+	case "approle":
+		return approle.NewApproleAuthMethod(authConfig)
+	case "aws-ec2":
+		return awsec2.NewAWSEC2AuthMethod(authConfig)
+	case "cert":
+		return cert.NewCertAuthMethod(authConfig)
+	default:
+		return nil, fmt.Errorf("unknown auth method type %q", m.Type)
+	}
+}
+
+// sinks creates the configured sinks
+func (c *AgentCommand) sinks(configs []*config.Sink) ([]*sink.SinkConfig, error) {
+	var sinks []*sink.SinkConfig
+	for _, sc := range configs {
+		sinkConfig := &sink.SinkConfig{
+			Logger:  c.logger,
+			Config:  sc.Config,
+			WrapTTL: sc.WrapTTL,
+			DHType:  sc.DHType,
+			DHPath:  sc.DHPath,
+			AAD:     sc.AAD,
+		}
+
+		var err error
+		switch sc.Type {
+		case "file":
+			sinkConfig.Sink, err = file.NewFileSink(sinkConfig)
+		default:
+			err = fmt.Errorf("unknown sink type %q", sc.Type)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		sinks = append(sinks, sinkConfig)
+	}
+	return sinks, nil
+}
+
+// agentClientConfig creates the client configuration of the agent from the
+// environment and the vault stanza of the configuration.
+func agentClientConfig(v *config.Vault) (*api.Config, error) {
+	clientConfig := api.DefaultConfig()
+	if err := clientConfig.ReadEnvironment(); err != nil {
+		return nil, fmt.Errorf("error reading environment: %s", err)
+	}
+
+	if v != nil {
+		if v.Address != "" {
+			clientConfig.Address = v.Address
+		}
+		if v.CACert != "" || v.CAPath != "" || v.ClientCert != "" || v.ClientKey != "" || v.TLSSkipVerify {
+			if err := clientConfig.ConfigureTLS(&api.TLSConfig{
+				CACert:     v.CACert,
+				CAPath:     v.CAPath,
+				ClientCert: v.ClientCert,
+				ClientKey:  v.ClientKey,
+				Insecure:   v.TLSSkipVerify,
+			}); err != nil {
+				return nil, fmt.Errorf("error configuring TLS: %s", err)
+			}
+		}
+	}
+
+	return clientConfig, nil
+}
+
+// agentClient creates the client of the agent. Tokens from the environment
+// are not used, as the agent logs in by itself.
+func agentClient(clientConfig *api.Config) (*api.Client, error) {
+	client, err := api.NewClient(clientConfig)
+	if err != nil {
+		return nil, err
+	}
+	client.ClearToken()
+
+	// Wrapping is only done for sinks that ask for it
+	client.SetWrappingLookupFunc(func(string, string) string { return "" })
+
+	return client, nil
+}
+
+func (c *AgentCommand) Synopsis() string {
+	return "Start a Vault agent"
+}
+
+func (c *AgentCommand) Help() string {
+	helpText := `
+Usage: vault agent [options]
+
+  Start a Vault agent.
+
+  The agent logs in to Vault with the auth method of its configuration,
+  keeps the resulting token renewed, and logs in again when the token
+  cannot be renewed anymore. Every new token is written to the configured
+  sinks, optionally response-wrapped or encrypted for a public key. Templates
+  are rendered with secrets read using the token, and rendered again before
+  the leases of the secrets expire or when their data changes.
+
+  If a cache is configured, the agent also listens for requests, forwards
+  them to Vault, and caches responses with leases until they expire. The
+  token of the agent can be used for requests without a token.
+
+Agent Options:
+
+  -config=<path>          Path to the configuration file of the agent.
+
+  -log-level=info         Log verbosity. Defaults to "info", will be output to
+                          stderr. Supported values: "trace", "debug", "info",
+                          "notice", "warn", "err"
+`
+	return strings.TrimSpace(helpText)
+}
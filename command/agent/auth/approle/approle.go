@@ -0,0 +1,118 @@
+package approle
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/hashicorp/vault/api"
+	"github.com/hashicorp/vault/command/agent/auth"
+	log "github.com/mgutz/logxi/v1"
+)
+
+type approleMethod struct {
+	logger    log.Logger
+	mountPath string
+
+	roleIDFilePath                 string
+	secretIDFilePath               string
+	removeSecretIDFileAfterReading bool
+
+	// The secret ID is remembered for the following logins, since the file
+	// is usually removed after it was read
+	cachedSecretID string
+}
+
+// NewApproleAuthMethod returns an auth method logging in with the role ID and
+// secret ID read from the configured files.
+func NewApproleAuthMethod(conf *auth.AuthConfig) (auth.AuthMethod, error) {
+	if conf == nil {
+		return nil, errors.New("empty config")
+	}
+	if conf.Config == nil {
+		return nil, errors.New("empty config data")
+	}
+
+	a := &approleMethod{
+		logger:                         conf.Logger,
+		mountPath:                      conf.MountPath,
+		removeSecretIDFileAfterReading: true,
+	}
+
+	roleIDFilePathRaw, ok := conf.Config["role_id_file_path"]
+	if !ok {
+		return nil, errors.New("missing 'role_id_file_path' value")
+	}
+	a.roleIDFilePath, ok = roleIDFilePathRaw.(string)
+	if !ok || a.roleIDFilePath == "" {
+		return nil, errors.New("could not convert 'role_id_file_path' config value to string")
+	}
+
+	// The secret ID is optional for roles that do not bind it
+	if secretIDFilePathRaw, ok := conf.Config["secret_id_file_path"]; ok {
+		a.secretIDFilePath, ok = secretIDFilePathRaw.(string)
+		if !ok {
+			return nil, errors.New("could not convert 'secret_id_file_path' config value to string")
+		}
+	}
+
+	if removeRaw, ok := conf.Config["remove_secret_id_file_after_reading"]; ok {
+		switch remove := removeRaw.(type) {
+		case bool:
+			a.removeSecretIDFileAfterReading = remove
+		case string:
+			var err error
+			if a.removeSecretIDFileAfterReading, err = strconv.ParseBool(remove); err != nil {
+				return nil, fmt.Errorf("error parsing 'remove_secret_id_file_after_reading' value: %v", err)
+			}
+		default:
+			return nil, errors.New("could not convert 'remove_secret_id_file_after_reading' config value to bool")
+		}
+	}
+
+	return a, nil
+}
+
+func (a *approleMethod) Authenticate(client *api.Client) (string, map[string]interface{}, error) {
+	a.logger.Trace("auth.approle: beginning authentication")
+
+	roleID, err := ioutil.ReadFile(a.roleIDFilePath)
+	if err != nil {
+		return "", nil, fmt.Errorf("error reading role ID file: %v", err)
+	}
+	if len(strings.TrimSpace(string(roleID))) == 0 {
+		return "", nil, errors.New("role ID file is empty")
+	}
+
+	data := map[string]interface{}{
+		"role_id": strings.TrimSpace(string(roleID)),
+	}
+
+	if a.secretIDFilePath != "" {
+		secretID, err := ioutil.ReadFile(a.secretIDFilePath)
+		switch {
+		case err == nil && len(strings.TrimSpace(string(secretID))) > 0:
+			a.cachedSecretID = strings.TrimSpace(string(secretID))
+			if a.removeSecretIDFileAfterReading {
+				if err := os.Remove(a.secretIDFilePath); err != nil {
+					a.logger.Error("auth.approle: error removing secret ID file after reading", "error", err)
+				}
+			}
+		case err != nil && !os.IsNotExist(err):
+			return "", nil, fmt.Errorf("error reading secret ID file: %v", err)
+		case a.cachedSecretID == "":
+			return "", nil, errors.New("no secret ID file found and no secret ID read previously")
+		default:
+			a.logger.Trace("auth.approle: no new secret ID found, using the previous one")
+		}
+		data["secret_id"] = a.cachedSecretID
+	}
+
+	return fmt.Sprintf("%s/login", a.mountPath), data, nil
+}
+
+func (a *approleMethod) Shutdown() {
+}
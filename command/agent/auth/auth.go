@@ -0,0 +1,202 @@
+package auth
+
+import (
+	"errors"
+	"time"
+
+	"github.com/hashicorp/vault/api"
+	log "github.com/mgutz/logxi/v1"
+)
+
+const (
+	initialBackoff = 1 * time.Second
+	maxBackoff     = 5 * time.Minute
+)
+
+var errNoToken = errors.New("login response did not contain a token")
+
+// AuthMethod is a way of logging in to Vault on behalf of the agent.
+type AuthMethod interface {
+	// Authenticate returns the path to log in at, and the data to log in
+	// with. It is called for every login so that the method can pick up
+	// credentials that changed in the meantime.
+	Authenticate(client *api.Client) (string, map[string]interface{}, error)
+
+	// Shutdown releases the resources of the method.
+	Shutdown()
+}
+
+// AuthMethodWithClient is an AuthMethod that needs its own client to log in,
+// for instance because it authenticates using TLS client certificates.
+type AuthMethodWithClient interface {
+	AuthMethod
+
+	// AuthClient returns the client to log in with, based on the client
+	// of the agent.
+	AuthClient(client *api.Client) (*api.Client, error)
+}
+
+// AuthConfig is the configuration of an auth method.
+type AuthConfig struct {
+	Logger    log.Logger
+	MountPath string
+	Config    map[string]interface{}
+}
+
+// AuthHandlerConfig is the configuration of an AuthHandler.
+type AuthHandlerConfig struct {
+	Logger log.Logger
+	Client *api.Client
+}
+
+// AuthHandler logs in using an AuthMethod and keeps the resulting token
+// renewed, logging in again when the token cannot be renewed anymore. Every
+// new token is sent on OutputCh.
+type AuthHandler struct {
+	OutputCh chan string
+
+	logger log.Logger
+	client *api.Client
+
+	initialBackoff time.Duration
+}
+
+// NewAuthHandler creates a new AuthHandler.
+func NewAuthHandler(conf *AuthHandlerConfig) *AuthHandler {
+	return &AuthHandler{
+		// The receiver is usually busy writing the previous token to sinks
+		OutputCh: make(chan string, 1),
+
+		logger: conf.Logger,
+		client: conf.Client,
+
+		initialBackoff: initialBackoff,
+	}
+}
+
+// Run logs in with the given method until the stop channel is closed. It
+// blocks, so it is usually run in a goroutine.
+func (ah *AuthHandler) Run(stopCh <-chan struct{}, am AuthMethod) {
+	if am == nil {
+		panic("nil auth method")
+	}
+	defer am.Shutdown()
+
+	backoff := ah.initialBackoff
+
+	// wait sleeps for the current backoff and doubles it, returning false
+	// if the handler was stopped in the meantime
+	wait := func() bool {
+		select {
+		case <-stopCh:
+			return false
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+		if backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+		return true
+	}
+
+	for {
+		select {
+		case <-stopCh:
+			return
+		default:
+		}
+
+		secret, err := ah.login(am)
+		if err != nil {
+			ah.logger.Error("auth.handler: error authenticating", "error", err, "backoff", backoff)
+			if !wait() {
+				return
+			}
+			continue
+		}
+
+		ah.logger.Info("auth.handler: authentication successful, sending token to sinks")
+		backoff = ah.initialBackoff
+
+		select {
+		case <-stopCh:
+			return
+		case ah.OutputCh <- secret.Auth.ClientToken:
+		}
+
+		if !ah.keepAlive(stopCh, secret) {
+			return
+		}
+	}
+}
+
+// login logs in once with the given method
+func (ah *AuthHandler) login(am AuthMethod) (*api.Secret, error) {
+	client := ah.client
+	if amc, ok := am.(AuthMethodWithClient); ok {
+		var err error
+		if client, err = amc.AuthClient(client); err != nil {
+			return nil, err
+		}
+	}
+
+	path, data, err := am.Authenticate(client)
+	if err != nil {
+		return nil, err
+	}
+
+	secret, err := client.Logical().Write(path, data)
+	if err != nil {
+		return nil, err
+	}
+	if secret == nil || secret.Auth == nil || secret.Auth.ClientToken == "" {
+		return nil, errNoToken
+	}
+
+	return secret, nil
+}
+
+// keepAlive renews the token of the given login until it cannot be renewed
+// anymore, and returns false if the handler was stopped in the meantime.
+func (ah *AuthHandler) keepAlive(stopCh <-chan struct{}, secret *api.Secret) bool {
+	// Tokens that cannot be renewed are used until shortly before they
+	// expire, and tokens without a TTL forever
+	if !secret.Auth.Renewable {
+		ah.logger.Info("auth.handler: token is not renewable, logging in again before it expires")
+		var expiryCh <-chan time.Time
+		if secret.Auth.LeaseDuration > 0 {
+			expiryCh = time.After(time.Duration(secret.Auth.LeaseDuration) * time.Second * 2 / 3)
+		}
+		select {
+		case <-stopCh:
+			return false
+		case <-expiryCh:
+			return true
+		}
+	}
+
+	renewer, err := ah.client.NewRenewer(&api.RenewerInput{
+		Secret: secret,
+	})
+	if err != nil {
+		ah.logger.Error("auth.handler: error creating renewer", "error", err)
+		return true
+	}
+	go renewer.Renew()
+	defer renewer.Stop()
+
+	for {
+		select {
+		case <-stopCh:
+			return false
+		case err := <-renewer.DoneCh():
+			if err != nil {
+				ah.logger.Error("auth.handler: error renewing token", "error", err)
+			}
+			ah.logger.Info("auth.handler: token can no longer be renewed, logging in again")
+			return true
+		case <-renewer.RenewCh():
+			ah.logger.Trace("auth.handler: renewed auth token")
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package awsec2
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/go-cleanhttp"
+	"github.com/hashicorp/go-uuid"
+	"github.com/hashicorp/vault/api"
+	"github.com/hashicorp/vault/command/agent/auth"
+	log "github.com/mgutz/logxi/v1"
+)
+
+// The PKCS#7 signature of the instance identity document is served by the
+// metadata service of every EC2 instance
+const defaultPKCS7URL = "http://169.254.169.254/latest/dynamic/instance-identity/pkcs7"
+
+type awsec2Method struct {
+	logger    log.Logger
+	mountPath string
+
+	role  string
+	nonce string
+
+	pkcs7URL   string
+	httpClient *http.Client
+}
+
+// NewAWSEC2AuthMethod returns an auth method logging in with the signed
+// instance identity document of the EC2 instance the agent runs on.
+func NewAWSEC2AuthMethod(conf *auth.AuthConfig) (auth.AuthMethod, error) {
+	if conf == nil {
+		return nil, errors.New("empty config")
+	}
+
+	a := &awsec2Method{
+		logger:     conf.Logger,
+		mountPath:  conf.MountPath,
+		pkcs7URL:   defaultPKCS7URL,
+		httpClient: cleanhttp.DefaultClient(),
+	}
+	a.httpClient.Timeout = 10 * time.Second
+
+	if roleRaw, ok := conf.Config["role"]; ok {
+		if a.role, ok = roleRaw.(string); !ok {
+			return nil, errors.New("could not convert 'role' config value to string")
+		}
+	}
+
+	// Logins after the first one must present the same nonce, so generate
+	// one unless it was configured
+	if nonceRaw, ok := conf.Config["nonce"]; ok {
+		if a.nonce, ok = nonceRaw.(string); !ok {
+			return nil, errors.New("could not convert 'nonce' config value to string")
+		}
+	}
+	if a.nonce == "" {
+		nonce, err := uuid.GenerateUUID()
+		if err != nil {
+			return nil, fmt.Errorf("error generating nonce: %v", err)
+		}
+		a.nonce = nonce
+	}
+
+	return a, nil
+}
+
+func (a *awsec2Method) Authenticate(client *api.Client) (string, map[string]interface{}, error) {
+	a.logger.Trace("auth.awsec2: beginning authentication")
+
+	resp, err := a.httpClient.Get(a.pkcs7URL)
+	if err != nil {
+		return "", nil, fmt.Errorf("error fetching instance identity signature: %v", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", nil, fmt.Errorf("error reading instance identity signature: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", nil, fmt.Errorf("error fetching instance identity signature: status code %d", resp.StatusCode)
+	}
+
+	data := map[string]interface{}{
+		"pkcs7": strings.Replace(strings.TrimSpace(string(body)), "\n", "", -1),
+		"nonce": a.nonce,
+	}
+	if a.role != "" {
+		data["role"] = a.role
+	}
+
+	return fmt.Sprintf("%s/login", a.mountPath), data, nil
+}
+
+func (a *awsec2Method) Shutdown() {
+}
@@ -0,0 +1,86 @@
+package cert
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/hashicorp/vault/api"
+	"github.com/hashicorp/vault/command/agent/auth"
+	log "github.com/mgutz/logxi/v1"
+)
+
+type certMethod struct {
+	logger    log.Logger
+	mountPath string
+
+	clientCert string
+	clientKey  string
+	caCert     string
+}
+
+// NewCertAuthMethod returns an auth method logging in with a TLS client
+// certificate. Unless a certificate is configured for the method, the client
+// certificate of the agent's Vault connection is used.
+func NewCertAuthMethod(conf *auth.AuthConfig) (auth.AuthMethod, error) {
+	if conf == nil {
+		return nil, errors.New("empty config")
+	}
+
+	c := &certMethod{
+		logger:    conf.Logger,
+		mountPath: conf.MountPath,
+	}
+
+	for key, field := range map[string]*string{
+		"client_cert": &c.clientCert,
+		"client_key":  &c.clientKey,
+		"ca_cert":     &c.caCert,
+	} {
+		if raw, ok := conf.Config[key]; ok {
+			if *field, ok = raw.(string); !ok {
+				return nil, fmt.Errorf("could not convert '%s' config value to string", key)
+			}
+		}
+	}
+
+	if (c.clientCert == "") != (c.clientKey == "") {
+		return nil, errors.New("'client_cert' and 'client_key' must be set together")
+	}
+
+	return c, nil
+}
+
+func (c *certMethod) Authenticate(client *api.Client) (string, map[string]interface{}, error) {
+	c.logger.Trace("auth.cert: beginning authentication")
+
+	// The certificate is verified from the TLS connection
+	return fmt.Sprintf("%s/login", c.mountPath), nil, nil
+}
+
+// AuthClient returns a client presenting the configured certificate, or the
+// given client if no certificate is configured.
+func (c *certMethod) AuthClient(client *api.Client) (*api.Client, error) {
+	if c.clientCert == "" {
+		return client, nil
+	}
+
+	config := api.DefaultConfig()
+	config.Address = client.Address()
+	if err := config.ConfigureTLS(&api.TLSConfig{
+		CACert:     c.caCert,
+		ClientCert: c.clientCert,
+		ClientKey:  c.clientKey,
+	}); err != nil {
+		return nil, fmt.Errorf("error configuring TLS: %v", err)
+	}
+
+	authClient, err := api.NewClient(config)
+	if err != nil {
+		return nil, err
+	}
+	authClient.ClearToken()
+	return authClient, nil
+}
+
+func (c *certMethod) Shutdown() {
+}
@@ -0,0 +1,292 @@
+package cache
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/vault/api"
+	log "github.com/mgutz/logxi/v1"
+)
+
+// ProxyConfig is the configuration of a Proxy.
+type ProxyConfig struct {
+	Logger log.Logger
+	Client *api.Client
+
+	// UseAutoAuthToken makes the proxy send the token of the agent with
+	// requests that do not carry a token themselves
+	UseAutoAuthToken bool
+}
+
+// Proxy is an http.Handler forwarding requests to Vault. Responses to reads
+// holding a lease are cached until the lease expires, so that clients asking
+// for the same secret with the same token share the lease instead of
+// creating a new one with every request. Cached responses are evicted when
+// their lease, or any token, is revoked through the proxy.
+type Proxy struct {
+	logger           log.Logger
+	client           *api.Client
+	useAutoAuthToken bool
+
+	l     sync.RWMutex
+	token string
+	cache map[string]*cachedResponse
+}
+
+// cachedResponse is a response of Vault held by the proxy until expiration
+type cachedResponse struct {
+	leaseID    string
+	statusCode int
+	header     http.Header
+	body       []byte
+	expiration time.Time
+}
+
+// NewProxy creates a new Proxy.
+func NewProxy(conf *ProxyConfig) *Proxy {
+	return &Proxy{
+		logger:           conf.Logger,
+		client:           conf.Client,
+		useAutoAuthToken: conf.UseAutoAuthToken,
+		cache:            make(map[string]*cachedResponse),
+	}
+}
+
+// SetToken sets the token of the agent used for requests without a token.
+func (p *Proxy) SetToken(token string) {
+	p.l.Lock()
+	p.token = token
+	p.l.Unlock()
+}
+
+func (p *Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, fmt.Errorf("error reading request body: %v", err))
+		return
+	}
+
+	token := r.Header.Get("X-Vault-Token")
+	if token == "" && p.useAutoAuthToken {
+		p.l.RLock()
+		token = p.token
+		p.l.RUnlock()
+	}
+
+	path := strings.TrimPrefix(r.URL.Path, "/v1/")
+	cacheable := r.Method == "GET" && !matchesPath(path, uncacheablePaths)
+
+	key := cacheKey(token, r, body)
+	if cacheable {
+		if cached := p.lookup(key); cached != nil {
+			p.logger.Trace("cache.proxy: returning cached response", "method", r.Method, "path", r.URL.Path)
+			cached.write(w)
+			return
+		}
+	}
+
+	req := p.client.NewRequest(r.Method, r.URL.Path)
+	req.Params = r.URL.Query()
+	req.ClientToken = token
+	req.WrapTTL = r.Header.Get("X-Vault-Wrap-TTL")
+	req.Namespace = r.Header.Get("X-Vault-Namespace")
+	if len(body) > 0 {
+		// Going through the JSON body keeps the body intact on redirects
+		if err := req.SetJSONBody(json.RawMessage(body)); err != nil {
+			req.Body = bytes.NewReader(body)
+			req.BodySize = int64(len(body))
+		}
+	}
+
+	resp, err := p.client.RawRequest(req)
+	if resp == nil {
+		p.logger.Error("cache.proxy: error forwarding request", "method", r.Method, "path", r.URL.Path, "error", err)
+		respondError(w, http.StatusBadGateway, fmt.Errorf("error forwarding request to Vault: %v", err))
+		return
+	}
+	defer resp.Body.Close()
+
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		respondError(w, http.StatusBadGateway, fmt.Errorf("error reading response from Vault: %v", err))
+		return
+	}
+
+	result := &cachedResponse{
+		statusCode: resp.StatusCode,
+		header:     resp.Header,
+		body:       respBody,
+	}
+
+	switch {
+	case resp.StatusCode < 200 || resp.StatusCode >= 300:
+	case cacheable:
+		if secret, err := api.ParseSecret(bytes.NewReader(respBody)); err == nil &&
+			secret.LeaseID != "" && secret.LeaseDuration > 0 {
+			result.leaseID = secret.LeaseID
+			result.expiration = time.Now().Add(time.Duration(secret.LeaseDuration) * time.Second)
+			p.store(key, result)
+			p.logger.Trace("cache.proxy: cached leased response", "method", r.Method, "path", r.URL.Path, "expiration", result.expiration)
+		}
+	default:
+		p.evict(path)
+	}
+
+	result.write(w)
+}
+
+// lookup returns the cached response for the key, unless it expired
+func (p *Proxy) lookup(key string) *cachedResponse {
+	p.l.RLock()
+	defer p.l.RUnlock()
+
+	cached, ok := p.cache[key]
+	if !ok || time.Now().After(cached.expiration) {
+		return nil
+	}
+	return cached
+}
+
+// store caches the response under the key, and removes expired responses
+func (p *Proxy) store(key string, resp *cachedResponse) {
+	p.l.Lock()
+	defer p.l.Unlock()
+
+	now := time.Now()
+	for k, cached := range p.cache {
+		if now.After(cached.expiration) {
+			delete(p.cache, k)
+		}
+	}
+	p.cache[key] = resp
+}
+
+// evict removes the cached responses affected by a successful request to
+// the given path. A revoked lease evicts the responses holding it. A revoked
+// token evicts every response, since the proxy doesn't know which tokens
+// descend from it or which token an accessor belongs to.
+func (p *Proxy) evict(path string) {
+	evictAll := matchesPath(path, tokenRevokePaths)
+	leaseID, prefix := revokedLease(path)
+	if !evictAll && leaseID == "" {
+		return
+	}
+
+	p.l.Lock()
+	defer p.l.Unlock()
+
+	var evicted int
+	for k, cached := range p.cache {
+		if evictAll || cached.leaseID == leaseID ||
+			(prefix && strings.HasPrefix(cached.leaseID, leaseID)) {
+			delete(p.cache, k)
+			evicted++
+		}
+	}
+	p.logger.Trace("cache.proxy: evicted cached responses", "path", path, "evicted", evicted)
+}
+
+// revokedLease returns the lease ID, or the prefix of the lease IDs, revoked
+// by a request to the given path, if any
+func revokedLease(path string) (string, bool) {
+	for _, revokePath := range leaseRevokePaths {
+		if i := pathIndex(path, revokePath); i >= 0 {
+			prefix := revokePath != "sys/revoke/" && revokePath != "sys/leases/revoke/"
+			return path[i+len(revokePath):], prefix
+		}
+	}
+	return "", false
+}
+
+func (c *cachedResponse) write(w http.ResponseWriter) {
+	for k, v := range c.header {
+		// The length is set by the response writer
+		if k == "Content-Length" {
+			continue
+		}
+		w.Header()[k] = v
+	}
+	w.WriteHeader(c.statusCode)
+	io.Copy(w, bytes.NewReader(c.body))
+}
+
+var (
+	// uncacheablePaths are never cached, as renewing or revoking a lease
+	// must reach Vault every time
+	uncacheablePaths = []string{
+		"sys/renew",
+		"sys/leases/renew",
+		"sys/revoke",
+		"sys/leases/revoke",
+		"auth/token/renew",
+		"auth/token/revoke",
+	}
+
+	// leaseRevokePaths revoke the lease, or the leases under the prefix,
+	// following them in the path
+	leaseRevokePaths = []string{
+		"sys/revoke/",
+		"sys/revoke-prefix/",
+		"sys/revoke-force/",
+		"sys/leases/revoke/",
+		"sys/leases/revoke-prefix/",
+		"sys/leases/revoke-force/",
+	}
+
+	// tokenRevokePaths revoke tokens
+	tokenRevokePaths = []string{
+		"auth/token/revoke",
+	}
+)
+
+// matchesPath returns whether the path, with or without a namespace ahead of
+// it, starts with any of the prefixes
+func matchesPath(path string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if pathIndex(path, prefix) >= 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// pathIndex returns the index of the prefix in the path, which is either 0
+// or after the namespace the path starts with, or -1 if it is not found
+func pathIndex(path, prefix string) int {
+	if strings.HasPrefix(path, prefix) {
+		return 0
+	}
+	if i := strings.Index(path, "/"+prefix); i >= 0 {
+		return i + 1
+	}
+	return -1
+}
+
+// cacheKey identifies a request by its token, method, path, query and body
+func cacheKey(token string, r *http.Request, body []byte) string {
+	h := sha256.New()
+	for _, s := range []string{token, r.Method, r.URL.Path, r.URL.RawQuery,
+		r.Header.Get("X-Vault-Wrap-TTL"), r.Header.Get("X-Vault-Namespace")} {
+		h.Write([]byte(s))
+		h.Write([]byte{0})
+	}
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func respondError(w http.ResponseWriter, status int, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string][]string{
+		"errors": []string{err.Error()},
+	})
+}
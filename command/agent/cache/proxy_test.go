@@ -0,0 +1,204 @@
+package cache
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/hashicorp/vault/api"
+	"github.com/hashicorp/vault/helper/logformat"
+	log "github.com/mgutz/logxi/v1"
+)
+
+func TestProxy_cache(t *testing.T) {
+	var l sync.Mutex
+	hits := make(map[string]int)
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		l.Lock()
+		hits[r.URL.Path+" "+r.Header.Get("X-Vault-Token")]++
+		l.Unlock()
+
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/v1/leased":
+			fmt.Fprint(w, `{"lease_id": "leased/1", "lease_duration": 60, "data": {"foo": "bar"}}`)
+		case "/v1/unleased":
+			fmt.Fprint(w, `{"data": {"foo": "bar"}}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"errors": []}`)
+		}
+	}))
+	defer upstream.Close()
+
+	config := api.DefaultConfig()
+	config.Address = upstream.URL
+	client, err := api.NewClient(config)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	proxy := NewProxy(&ProxyConfig{
+		Logger:           logformat.NewVaultLogger(log.LevelTrace),
+		Client:           client,
+		UseAutoAuthToken: true,
+	})
+	proxy.SetToken("agent-token")
+	server := httptest.NewServer(proxy)
+	defer server.Close()
+
+	get := func(path, token string) int {
+		req, err := http.NewRequest("GET", server.URL+path, nil)
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if token != "" {
+			req.Header.Set("X-Vault-Token", token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		defer resp.Body.Close()
+		ioutil.ReadAll(resp.Body)
+		return resp.StatusCode
+	}
+
+	for i := 0; i < 2; i++ {
+		for _, path := range []string{"/v1/leased", "/v1/unleased"} {
+			if code := get(path, ""); code != 200 {
+				t.Fatalf("bad: %s: %d", path, code)
+			}
+			if code := get(path, "other-token"); code != 200 {
+				t.Fatalf("bad: %s: %d", path, code)
+			}
+		}
+		if code := get("/v1/missing", ""); code != 404 {
+			t.Fatalf("bad: %d", code)
+		}
+	}
+
+	expected := map[string]int{
+		"/v1/leased agent-token":   1,
+		"/v1/leased other-token":   1,
+		"/v1/unleased agent-token": 2,
+		"/v1/unleased other-token": 2,
+		"/v1/missing agent-token":  2,
+	}
+	for k, v := range expected {
+		if hits[k] != v {
+			t.Fatalf("bad: %s: %d hits", k, hits[k])
+		}
+	}
+}
+
+func TestProxy_evict(t *testing.T) {
+	var l sync.Mutex
+	hits := make(map[string]int)
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		l.Lock()
+		hits[r.Method+" "+r.URL.Path]++
+		l.Unlock()
+
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/v1/aws/creds/foo":
+			fmt.Fprint(w, `{"lease_id": "aws/creds/foo/1", "lease_duration": 60}`)
+		case "/v1/aws/creds/bar":
+			fmt.Fprint(w, `{"lease_id": "aws/creds/bar/1", "lease_duration": 60}`)
+		case "/v1/db/creds/foo":
+			fmt.Fprint(w, `{"lease_id": "db/creds/foo/1", "lease_duration": 60}`)
+		case "/v1/sys/renew/aws/creds/foo/1":
+			fmt.Fprint(w, `{"lease_id": "aws/creds/foo/1", "lease_duration": 60}`)
+		default:
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	defer upstream.Close()
+
+	config := api.DefaultConfig()
+	config.Address = upstream.URL
+	client, err := api.NewClient(config)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	proxy := NewProxy(&ProxyConfig{
+		Logger: logformat.NewVaultLogger(log.LevelTrace),
+		Client: client,
+	})
+	server := httptest.NewServer(proxy)
+	defer server.Close()
+
+	do := func(method, path string) {
+		req, err := http.NewRequest(method, server.URL+path, nil)
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		req.Header.Set("X-Vault-Token", "token")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		defer resp.Body.Close()
+		ioutil.ReadAll(resp.Body)
+	}
+	readAll := func() {
+		for _, path := range []string{"/v1/aws/creds/foo", "/v1/aws/creds/bar", "/v1/db/creds/foo"} {
+			do("GET", path)
+		}
+	}
+	check := func(expected map[string]int) {
+		l.Lock()
+		defer l.Unlock()
+		for k, v := range expected {
+			if hits[k] != v {
+				t.Fatalf("bad: %s: %d hits", k, hits[k])
+			}
+		}
+	}
+
+	readAll()
+	readAll()
+
+	// Writes and renewals are never cached
+	do("PUT", "/v1/aws/creds/foo")
+	do("PUT", "/v1/aws/creds/foo")
+	do("GET", "/v1/sys/renew/aws/creds/foo/1")
+	do("GET", "/v1/sys/renew/aws/creds/foo/1")
+	check(map[string]int{
+		"GET /v1/aws/creds/foo":             1,
+		"PUT /v1/aws/creds/foo":             2,
+		"GET /v1/sys/renew/aws/creds/foo/1": 2,
+	})
+
+	// Revoking a lease evicts its response only
+	do("PUT", "/v1/sys/revoke/aws/creds/foo/1")
+	readAll()
+	check(map[string]int{
+		"GET /v1/aws/creds/foo": 2,
+		"GET /v1/aws/creds/bar": 1,
+		"GET /v1/db/creds/foo":  1,
+	})
+
+	// Revoking a prefix evicts the responses under it
+	do("PUT", "/v1/sys/revoke-prefix/aws/")
+	readAll()
+	check(map[string]int{
+		"GET /v1/aws/creds/foo": 3,
+		"GET /v1/aws/creds/bar": 2,
+		"GET /v1/db/creds/foo":  1,
+	})
+
+	// Revoking a token evicts every response
+	do("PUT", "/v1/auth/token/revoke-self")
+	readAll()
+	check(map[string]int{
+		"GET /v1/aws/creds/foo": 4,
+		"GET /v1/aws/creds/bar": 3,
+		"GET /v1/db/creds/foo":  2,
+	})
+}
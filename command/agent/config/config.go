@@ -0,0 +1,475 @@
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/go-multierror"
+	"github.com/hashicorp/hcl"
+	"github.com/hashicorp/hcl/hcl/ast"
+	"github.com/hashicorp/vault/command/server"
+	"github.com/hashicorp/vault/helper/duration"
+)
+
+// Config is the configuration for the vault agent.
+type Config struct {
+	AutoAuth  *AutoAuth          `hcl:"-"`
+	Cache     *Cache             `hcl:"-"`
+	Vault     *Vault             `hcl:"-"`
+	Listeners []*server.Listener `hcl:"-"`
+	Templates []*Template        `hcl:"-"`
+
+	PidFile string `hcl:"pid_file"`
+}
+
+// Vault contains the configuration for connecting to the Vault server.
+type Vault struct {
+	Address       string `hcl:"address"`
+	CACert        string `hcl:"ca_cert"`
+	CAPath        string `hcl:"ca_path"`
+	ClientCert    string `hcl:"client_cert"`
+	ClientKey     string `hcl:"client_key"`
+	TLSSkipVerify bool   `hcl:"tls_skip_verify"`
+}
+
+// AutoAuth is the configured authentication method and the sinks the
+// resulting token is written to.
+type AutoAuth struct {
+	Method *Method `hcl:"-"`
+	Sinks  []*Sink `hcl:"-"`
+}
+
+// Method is an authentication method used by the agent.
+type Method struct {
+	Type      string
+	MountPath string                 `hcl:"mount_path"`
+	Config    map[string]interface{} `hcl:"config"`
+}
+
+// Sink is a destination of the token of the agent. The token is optionally
+// response-wrapped with WrapTTL, and encrypted for the public key at DHPath.
+type Sink struct {
+	Type       string
+	WrapTTLRaw interface{}            `hcl:"wrap_ttl"`
+	WrapTTL    time.Duration          `hcl:"-"`
+	DHType     string                 `hcl:"dh_type"`
+	DHPath     string                 `hcl:"dh_path"`
+	AAD        string                 `hcl:"aad"`
+	Config     map[string]interface{} `hcl:"config"`
+}
+
+// Cache configures the caching proxy served on the listeners.
+type Cache struct {
+	UseAutoAuthToken bool `hcl:"use_auto_auth_token"`
+}
+
+// Template is a template rendered with secrets of Vault to a file, using
+// the token of the agent.
+type Template struct {
+	Source            string        `hcl:"source"`
+	Destination       string        `hcl:"destination"`
+	PermsRaw          string        `hcl:"perms"`
+	Perms             os.FileMode   `hcl:"-"`
+	Command           string        `hcl:"command"`
+	CommandTimeoutRaw interface{}   `hcl:"command_timeout"`
+	CommandTimeout    time.Duration `hcl:"-"`
+}
+
+// LoadConfig loads the configuration at the given path.
+func LoadConfig(path string) (*Config, error) {
+	d, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return ParseConfig(string(d))
+}
+
+// ParseConfig parses the given configuration.
+func ParseConfig(d string) (*Config, error) {
+	// Parse!
+	obj, err := hcl.Parse(d)
+	if err != nil {
+		return nil, err
+	}
+
+	// Start building the result
+	var result Config
+	if err := hcl.DecodeObject(&result, obj); err != nil {
+		return nil, err
+	}
+
+	list, ok := obj.Node.(*ast.ObjectList)
+	if !ok {
+		return nil, fmt.Errorf("error parsing: file doesn't contain a root object")
+	}
+
+	valid := []string{
+		"auto_auth",
+		"cache",
+		"listener",
+		"pid_file",
+		"template",
+		"vault",
+	}
+	if err := checkHCLKeys(list, valid); err != nil {
+		return nil, err
+	}
+
+	if err := parseVault(&result, list); err != nil {
+		return nil, fmt.Errorf("error parsing 'vault': %s", err)
+	}
+
+	if err := parseAutoAuth(&result, list); err != nil {
+		return nil, fmt.Errorf("error parsing 'auto_auth': %s", err)
+	}
+
+	if err := parseCache(&result, list); err != nil {
+		return nil, fmt.Errorf("error parsing 'cache': %s", err)
+	}
+
+	if o := list.Filter("listener"); len(o.Items) > 0 {
+		if err := parseListeners(&result, o); err != nil {
+			return nil, fmt.Errorf("error parsing 'listener': %s", err)
+		}
+	}
+
+	if o := list.Filter("template"); len(o.Items) > 0 {
+		if err := parseTemplates(&result, o); err != nil {
+			return nil, fmt.Errorf("error parsing 'template': %s", err)
+		}
+	}
+
+	if result.Cache != nil && len(result.Listeners) == 0 {
+		return nil, fmt.Errorf("a 'cache' stanza requires at least one 'listener'")
+	}
+	if len(result.Listeners) > 0 && result.Cache == nil {
+		return nil, fmt.Errorf("a 'listener' requires a 'cache' stanza")
+	}
+	if result.Cache != nil && result.Cache.UseAutoAuthToken && result.AutoAuth == nil {
+		return nil, fmt.Errorf("'use_auto_auth_token' requires an 'auto_auth' stanza")
+	}
+	if len(result.Templates) > 0 && result.AutoAuth == nil {
+		return nil, fmt.Errorf("a 'template' requires an 'auto_auth' stanza")
+	}
+
+	return &result, nil
+}
+
+func parseVault(result *Config, list *ast.ObjectList) error {
+	name := "vault"
+
+	vaultList := list.Filter(name)
+	if len(vaultList.Items) == 0 {
+		return nil
+	}
+	if len(vaultList.Items) > 1 {
+		return fmt.Errorf("one and only one %q block is required", name)
+	}
+
+	item := vaultList.Items[0]
+	valid := []string{
+		"address",
+		"ca_cert",
+		"ca_path",
+		"client_cert",
+		"client_key",
+		"tls_skip_verify",
+	}
+	if err := checkHCLKeys(item.Val, valid); err != nil {
+		return multierror.Prefix(err, name+":")
+	}
+
+	var v Vault
+	if err := hcl.DecodeObject(&v, item.Val); err != nil {
+		return err
+	}
+
+	result.Vault = &v
+	return nil
+}
+
+func parseAutoAuth(result *Config, list *ast.ObjectList) error {
+	name := "auto_auth"
+
+	autoAuthList := list.Filter(name)
+	if len(autoAuthList.Items) == 0 {
+		return nil
+	}
+	if len(autoAuthList.Items) > 1 {
+		return fmt.Errorf("one and only one %q block is required", name)
+	}
+
+	item := autoAuthList.Items[0]
+	if err := checkHCLKeys(item.Val, []string{"method", "sink"}); err != nil {
+		return multierror.Prefix(err, name+":")
+	}
+
+	subList, ok := item.Val.(*ast.ObjectType)
+	if !ok {
+		return fmt.Errorf("could not parse %q as an object", name)
+	}
+
+	var a AutoAuth
+	if err := parseMethod(&a, subList.List); err != nil {
+		return fmt.Errorf("error parsing 'method': %s", err)
+	}
+	if err := parseSinks(&a, subList.List); err != nil {
+		return fmt.Errorf("error parsing 'sink': %s", err)
+	}
+
+	result.AutoAuth = &a
+	return nil
+}
+
+func parseMethod(result *AutoAuth, list *ast.ObjectList) error {
+	methodList := list.Filter("method")
+	if len(methodList.Items) != 1 {
+		return fmt.Errorf("one and only one \"method\" block is required")
+	}
+
+	item := methodList.Items[0]
+	if len(item.Keys) != 1 {
+		return fmt.Errorf("method type must be specified")
+	}
+	if err := checkHCLKeys(item.Val, []string{"mount_path", "config"}); err != nil {
+		return err
+	}
+
+	var m Method
+	if err := hcl.DecodeObject(&m, item.Val); err != nil {
+		return err
+	}
+	m.Type = strings.ToLower(item.Keys[0].Token.Value().(string))
+
+	// Methods are mounted at their type by default
+	if m.MountPath == "" {
+		m.MountPath = "auth/" + m.Type
+	}
+	m.MountPath = strings.TrimSuffix(m.MountPath, "/")
+
+	result.Method = &m
+	return nil
+}
+
+func parseSinks(result *AutoAuth, list *ast.ObjectList) error {
+	sinkList := list.Filter("sink")
+	if len(sinkList.Items) < 1 {
+		return fmt.Errorf("at least one \"sink\" block is required")
+	}
+
+	var sinks []*Sink
+	for _, item := range sinkList.Items {
+		if len(item.Keys) != 1 {
+			return fmt.Errorf("sink type must be specified")
+		}
+		sinkType := strings.ToLower(item.Keys[0].Token.Value().(string))
+
+		valid := []string{
+			"aad",
+			"config",
+			"dh_path",
+			"dh_type",
+			"wrap_ttl",
+		}
+		if err := checkHCLKeys(item.Val, valid); err != nil {
+			return multierror.Prefix(err, fmt.Sprintf("sink.%s:", sinkType))
+		}
+
+		var s Sink
+		if err := hcl.DecodeObject(&s, item.Val); err != nil {
+			return multierror.Prefix(err, fmt.Sprintf("sink.%s:", sinkType))
+		}
+		s.Type = sinkType
+
+		if s.WrapTTLRaw != nil {
+			var err error
+			if s.WrapTTL, err = parseDuration(s.WrapTTLRaw); err != nil {
+				return multierror.Prefix(err, fmt.Sprintf("sink.%s:", sinkType))
+			}
+			s.WrapTTLRaw = nil
+		}
+
+		switch s.DHType {
+		case "":
+			if s.DHPath != "" {
+				return fmt.Errorf("sink.%s: 'dh_path' requires 'dh_type'", sinkType)
+			}
+			if s.AAD != "" {
+				return fmt.Errorf("sink.%s: 'aad' requires 'dh_type'", sinkType)
+			}
+		case "curve25519":
+			if s.DHPath == "" {
+				return fmt.Errorf("sink.%s: 'dh_type' requires 'dh_path'", sinkType)
+			}
+		default:
+			return fmt.Errorf("sink.%s: invalid 'dh_type' %q", sinkType, s.DHType)
+		}
+
+		sinks = append(sinks, &s)
+	}
+
+	result.Sinks = sinks
+	return nil
+}
+
+func parseCache(result *Config, list *ast.ObjectList) error {
+	name := "cache"
+
+	cacheList := list.Filter(name)
+	if len(cacheList.Items) == 0 {
+		return nil
+	}
+	if len(cacheList.Items) > 1 {
+		return fmt.Errorf("one and only one %q block is required", name)
+	}
+
+	item := cacheList.Items[0]
+	if err := checkHCLKeys(item.Val, []string{"use_auto_auth_token"}); err != nil {
+		return multierror.Prefix(err, name+":")
+	}
+
+	var c Cache
+	if err := hcl.DecodeObject(&c, item.Val); err != nil {
+		return err
+	}
+
+	result.Cache = &c
+	return nil
+}
+
+func parseListeners(result *Config, list *ast.ObjectList) error {
+	listeners := make([]*server.Listener, 0, len(list.Items))
+	for _, item := range list.Items {
+		key := "listener"
+		if len(item.Keys) > 0 {
+			key = item.Keys[0].Token.Value().(string)
+		}
+
+		valid := []string{
+			"address",
+			"tls_disable",
+			"tls_cert_file",
+			"tls_key_file",
+			"tls_min_version",
+		}
+		if err := checkHCLKeys(item.Val, valid); err != nil {
+			return multierror.Prefix(err, fmt.Sprintf("listeners.%s:", key))
+		}
+
+		var m map[string]string
+		if err := hcl.DecodeObject(&m, item.Val); err != nil {
+			return multierror.Prefix(err, fmt.Sprintf("listeners.%s:", key))
+		}
+
+		lnType := strings.ToLower(key)
+		if lnType != "tcp" {
+			return fmt.Errorf("listeners.%s: only 'tcp' listeners are supported", key)
+		}
+
+		listeners = append(listeners, &server.Listener{
+			Type:   lnType,
+			Config: m,
+		})
+	}
+
+	result.Listeners = listeners
+	return nil
+}
+
+func parseTemplates(result *Config, list *ast.ObjectList) error {
+	templates := make([]*Template, 0, len(list.Items))
+	for i, item := range list.Items {
+		valid := []string{
+			"command",
+			"command_timeout",
+			"destination",
+			"perms",
+			"source",
+		}
+		if err := checkHCLKeys(item.Val, valid); err != nil {
+			return multierror.Prefix(err, fmt.Sprintf("template[%d]:", i))
+		}
+
+		var t Template
+		if err := hcl.DecodeObject(&t, item.Val); err != nil {
+			return multierror.Prefix(err, fmt.Sprintf("template[%d]:", i))
+		}
+
+		if t.Source == "" {
+			return fmt.Errorf("template[%d]: 'source' must be specified", i)
+		}
+		if t.Destination == "" {
+			return fmt.Errorf("template[%d]: 'destination' must be specified", i)
+		}
+
+		t.Perms = 0644
+		if t.PermsRaw != "" {
+			perms, err := strconv.ParseUint(t.PermsRaw, 8, 32)
+			if err != nil || perms > 0777 {
+				return fmt.Errorf("template[%d]: invalid 'perms' %q", i, t.PermsRaw)
+			}
+			t.Perms = os.FileMode(perms)
+			t.PermsRaw = ""
+		}
+
+		t.CommandTimeout = 30 * time.Second
+		if t.CommandTimeoutRaw != nil {
+			var err error
+			if t.CommandTimeout, err = parseDuration(t.CommandTimeoutRaw); err != nil {
+				return multierror.Prefix(err, fmt.Sprintf("template[%d]:", i))
+			}
+			t.CommandTimeoutRaw = nil
+		}
+
+		templates = append(templates, &t)
+	}
+
+	result.Templates = templates
+	return nil
+}
+
+// parseDuration parses a duration given as a string such as "5m", or as a
+// number of seconds
+func parseDuration(raw interface{}) (time.Duration, error) {
+	switch v := raw.(type) {
+	case int:
+		return time.Duration(v) * time.Second, nil
+	case string:
+		return duration.ParseDurationSecond(v)
+	default:
+		return 0, fmt.Errorf("invalid duration %v", raw)
+	}
+}
+
+func checkHCLKeys(node ast.Node, valid []string) error {
+	var list *ast.ObjectList
+	switch n := node.(type) {
+	case *ast.ObjectList:
+		list = n
+	case *ast.ObjectType:
+		list = n.List
+	default:
+		return fmt.Errorf("cannot check HCL keys of type %T", n)
+	}
+
+	validMap := make(map[string]struct{}, len(valid))
+	for _, v := range valid {
+		validMap[v] = struct{}{}
+	}
+
+	var result error
+	for _, item := range list.Items {
+		key := item.Keys[0].Token.Value().(string)
+		if _, ok := validMap[key]; !ok {
+			result = multierror.Append(result, fmt.Errorf(
+				"invalid key '%s' on line %d", key, item.Assign.Line))
+		}
+	}
+
+	return result
+}
@@ -0,0 +1,165 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/command/server"
+)
+
+func TestLoadConfig(t *testing.T) {
+	config, err := LoadConfig("./test-fixtures/config.hcl")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	expected := &Config{
+		AutoAuth: &AutoAuth{
+			Method: &Method{
+				Type:      "approle",
+				MountPath: "auth/approle-prod",
+				Config: map[string]interface{}{
+					"role_id_file_path":   "/etc/vault/role-id",
+					"secret_id_file_path": "/etc/vault/secret-id",
+				},
+			},
+			Sinks: []*Sink{
+				&Sink{
+					Type: "file",
+					Config: map[string]interface{}{
+						"path": "/tmp/file-foo",
+					},
+				},
+				&Sink{
+					Type:    "file",
+					WrapTTL: 5 * time.Minute,
+					DHType:  "curve25519",
+					DHPath:  "/tmp/file-foo-dhpath",
+					AAD:     "foobar",
+					Config: map[string]interface{}{
+						"path": "/tmp/file-bar",
+					},
+				},
+			},
+		},
+		Cache: &Cache{
+			UseAutoAuthToken: true,
+		},
+		Vault: &Vault{
+			Address:       "https://127.0.0.1:8200",
+			CACert:        "/etc/vault/ca.pem",
+			TLSSkipVerify: true,
+		},
+		Listeners: []*server.Listener{
+			&server.Listener{
+				Type: "tcp",
+				Config: map[string]string{
+					"address":     "127.0.0.1:8300",
+					"tls_disable": "true",
+				},
+			},
+		},
+		Templates: []*Template{
+			&Template{
+				Source:         "/etc/vault/db.tmpl",
+				Destination:    "/etc/app/db.conf",
+				Perms:          0600,
+				Command:        "touch /tmp/reloaded",
+				CommandTimeout: 30 * time.Second,
+			},
+			&Template{
+				Source:         "/etc/vault/web.tmpl",
+				Destination:    "/etc/app/web.conf",
+				Perms:          0644,
+				CommandTimeout: time.Minute,
+			},
+		},
+		PidFile: "./pidfile",
+	}
+
+	if !reflect.DeepEqual(config, expected) {
+		t.Fatalf("expected \n\n%#v\n\n to be \n\n%#v\n\n", config, expected)
+	}
+}
+
+func TestParseConfig_invalid(t *testing.T) {
+	cases := map[string]string{
+		"unknown key": `
+foo = "bar"
+`,
+		"no method": `
+auto_auth {
+	sink "file" {}
+}
+`,
+		"no sink": `
+auto_auth {
+	method "approle" {}
+}
+`,
+		"dh_path without dh_type": `
+auto_auth {
+	method "approle" {}
+	sink "file" {
+		dh_path = "/tmp/foo"
+	}
+}
+`,
+		"bad dh_type": `
+auto_auth {
+	method "approle" {}
+	sink "file" {
+		dh_type = "rsa"
+		dh_path = "/tmp/foo"
+	}
+}
+`,
+		"cache without listener": `
+cache {}
+`,
+		"auto auth token without auto auth": `
+cache {
+	use_auto_auth_token = true
+}
+listener "tcp" {}
+`,
+		"template without auto auth": `
+template {
+	source = "/tmp/foo"
+	destination = "/tmp/bar"
+}
+`,
+		"template without destination": `
+auto_auth {
+	method "approle" {}
+	sink "file" {}
+}
+template {
+	source = "/tmp/foo"
+}
+`,
+		"bad perms": `
+auto_auth {
+	method "approle" {}
+	sink "file" {}
+}
+template {
+	source = "/tmp/foo"
+	destination = "/tmp/bar"
+	perms = "rw"
+}
+`,
+		"unix listener": `
+cache {}
+listener "unix" {}
+`,
+	}
+
+	for name, c := range cases {
+		if _, err := ParseConfig(strings.TrimSpace(c)); err == nil {
+			t.Fatalf("%s: expected error", name)
+		}
+	}
+}
@@ -0,0 +1,55 @@
+pid_file = "./pidfile"
+
+vault {
+	address = "https://127.0.0.1:8200"
+	ca_cert = "/etc/vault/ca.pem"
+	tls_skip_verify = true
+}
+
+auto_auth {
+	method "AppRole" {
+		mount_path = "auth/approle-prod/"
+		config = {
+			role_id_file_path = "/etc/vault/role-id"
+			secret_id_file_path = "/etc/vault/secret-id"
+		}
+	}
+
+	sink "file" {
+		config = {
+			path = "/tmp/file-foo"
+		}
+	}
+
+	sink "file" {
+		wrap_ttl = "5m"
+		dh_type = "curve25519"
+		dh_path = "/tmp/file-foo-dhpath"
+		aad = "foobar"
+		config = {
+			path = "/tmp/file-bar"
+		}
+	}
+}
+
+cache {
+	use_auto_auth_token = true
+}
+
+listener "tcp" {
+	address = "127.0.0.1:8300"
+	tls_disable = "true"
+}
+
+template {
+	source = "/etc/vault/db.tmpl"
+	destination = "/etc/app/db.conf"
+	perms = "0600"
+	command = "touch /tmp/reloaded"
+}
+
+template {
+	source = "/etc/vault/web.tmpl"
+	destination = "/etc/app/web.conf"
+	command_timeout = "1m"
+}
@@ -0,0 +1,90 @@
+package file
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/hashicorp/vault/command/agent/sink"
+	log "github.com/mgutz/logxi/v1"
+)
+
+// fileSink is a Sink implementation that writes a token to a file
+type fileSink struct {
+	path   string
+	logger log.Logger
+}
+
+// NewFileSink creates a new file sink with the given configuration
+func NewFileSink(conf *sink.SinkConfig) (sink.Sink, error) {
+	if conf.Logger == nil {
+		return nil, errors.New("nil logger provided")
+	}
+
+	pathRaw, ok := conf.Config["path"]
+	if !ok {
+		return nil, errors.New("'path' not specified for file sink")
+	}
+	path, ok := pathRaw.(string)
+	if !ok || path == "" {
+		return nil, errors.New("could not parse 'path' as string")
+	}
+
+	f := &fileSink{
+		path:   path,
+		logger: conf.Logger,
+	}
+
+	// Fail early if the token cannot be written
+	if err := f.write(""); err != nil {
+		return nil, fmt.Errorf("error during write check: %v", err)
+	}
+
+	return f, nil
+}
+
+// WriteToken implements the Sink interface and writes the token to the file
+func (f *fileSink) WriteToken(token string) error {
+	f.logger.Trace("sink.file: writing token", "path", f.path)
+
+	if err := f.write(token); err != nil {
+		return err
+	}
+
+	f.logger.Info("sink.file: token written", "path", f.path)
+	return nil
+}
+
+// write replaces the contents of the file atomically, so that readers never
+// see a partially written token
+func (f *fileSink) write(contents string) error {
+	tmpFile, err := ioutil.TempFile(filepath.Dir(f.path), filepath.Base(f.path)+".tmp")
+	if err != nil {
+		return fmt.Errorf("error creating temp file in %s: %v", filepath.Dir(f.path), err)
+	}
+	tmpPath := tmpFile.Name()
+
+	if err := tmpFile.Chmod(0640); err != nil {
+		tmpFile.Close()
+		os.Remove(tmpPath)
+		return fmt.Errorf("error setting permissions of temp file: %v", err)
+	}
+	if _, err := tmpFile.WriteString(contents); err != nil {
+		tmpFile.Close()
+		os.Remove(tmpPath)
+		return fmt.Errorf("error writing token to temp file: %v", err)
+	}
+	if err := tmpFile.Close(); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("error closing temp file: %v", err)
+	}
+
+	if err := os.Rename(tmpPath, f.path); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("error renaming temp file to %s: %v", f.path, err)
+	}
+
+	return nil
+}
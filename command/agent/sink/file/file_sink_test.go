@@ -0,0 +1,72 @@
+package file
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hashicorp/vault/command/agent/sink"
+	"github.com/hashicorp/vault/helper/logformat"
+	log "github.com/mgutz/logxi/v1"
+)
+
+func TestFileSink(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vault-sink")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "token")
+	fs, err := NewFileSink(&sink.SinkConfig{
+		Logger: logformat.NewVaultLogger(log.LevelTrace),
+		Config: map[string]interface{}{
+			"path": path,
+		},
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	for _, token := range []string{"first-token", "second-token"} {
+		if err := fs.WriteToken(token); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+
+		contents, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if string(contents) != token {
+			t.Fatalf("bad: %s", contents)
+		}
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if info.Mode().Perm() != 0640 {
+		t.Fatalf("bad: %v", info.Mode())
+	}
+
+	// No temp files are left behind
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if len(files) != 1 {
+		t.Fatalf("bad: %d files", len(files))
+	}
+
+	// A directory that cannot be written to fails the write check
+	if _, err := NewFileSink(&sink.SinkConfig{
+		Logger: logformat.NewVaultLogger(log.LevelTrace),
+		Config: map[string]interface{}{
+			"path": filepath.Join(dir, "missing", "token"),
+		},
+	}); err == nil {
+		t.Fatal("expected error")
+	}
+}
@@ -0,0 +1,213 @@
+package sink
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"time"
+
+	"github.com/hashicorp/vault/api"
+	"github.com/hashicorp/vault/helper/dhutil"
+	log "github.com/mgutz/logxi/v1"
+)
+
+const (
+	initialBackoff = 1 * time.Second
+	maxBackoff     = 5 * time.Minute
+)
+
+// Sink is a destination the token of the agent is written to.
+type Sink interface {
+	WriteToken(string) error
+}
+
+// SinkConfig is the configuration of a sink. Before the token is written to
+// the sink, it is response-wrapped if WrapTTL is set, and then encrypted for
+// the public key at DHPath if DHType is set.
+type SinkConfig struct {
+	Sink
+	Logger  log.Logger
+	Config  map[string]interface{}
+	WrapTTL time.Duration
+	DHType  string
+	DHPath  string
+	AAD     string
+}
+
+// SinkServerConfig is the configuration of a SinkServer.
+type SinkServerConfig struct {
+	Logger log.Logger
+	Client *api.Client
+}
+
+// SinkServer writes the tokens it receives to the configured sinks.
+type SinkServer struct {
+	logger log.Logger
+	client *api.Client
+
+	initialBackoff time.Duration
+}
+
+// NewSinkServer creates a new SinkServer.
+func NewSinkServer(conf *SinkServerConfig) *SinkServer {
+	return &SinkServer{
+		logger: conf.Logger,
+		client: conf.Client,
+
+		initialBackoff: initialBackoff,
+	}
+}
+
+// Run writes every token received on the incoming channel to all sinks until
+// the stop channel is closed. Writes that fail are retried with a backoff
+// until they succeed or a newer token arrives. Run blocks, so it is usually
+// run in a goroutine.
+func (ss *SinkServer) Run(stopCh <-chan struct{}, incoming <-chan string, sinks []*SinkConfig) {
+	if incoming == nil {
+		panic("incoming channel is nil")
+	}
+
+	var token string
+	var pending []*SinkConfig
+	var retryCh <-chan time.Time
+	backoff := ss.initialBackoff
+
+	for {
+		select {
+		case <-stopCh:
+			return
+
+		case token = <-incoming:
+			ss.logger.Trace("sink.server: received new token")
+			pending = sinks
+			backoff = ss.initialBackoff
+
+		case <-retryCh:
+			ss.logger.Trace("sink.server: retrying failed writes", "num_sinks", len(pending))
+			backoff *= 2
+			if backoff > maxBackoff {
+				backoff = maxBackoff
+			}
+		}
+
+		var failed []*SinkConfig
+		for _, sc := range pending {
+			if err := ss.writeToken(sc, token); err != nil {
+				ss.logger.Error("sink.server: error writing token to sink", "error", err, "backoff", backoff)
+				failed = append(failed, sc)
+			}
+		}
+
+		pending = failed
+		retryCh = nil
+		if len(pending) > 0 {
+			retryCh = time.After(backoff)
+		}
+	}
+}
+
+// writeToken wraps and encrypts the token as configured and writes it to the
+// sink of the configuration
+func (ss *SinkServer) writeToken(sc *SinkConfig, token string) error {
+	if sc.WrapTTL > 0 {
+		wrapped, err := ss.wrapToken(sc.WrapTTL, token)
+		if err != nil {
+			return err
+		}
+		token = wrapped
+	}
+
+	if sc.DHType != "" {
+		encrypted, err := encryptToken(sc, token)
+		if err != nil {
+			return err
+		}
+		token = encrypted
+	}
+
+	return sc.WriteToken(token)
+}
+
+// wrapToken response-wraps the token using the token itself, and returns the
+// JSON encoded wrapping information. Unwrapping it returns the token in the
+// "token" field.
+func (ss *SinkServer) wrapToken(wrapTTL time.Duration, token string) (string, error) {
+	r := ss.client.NewRequest("PUT", "/v1/sys/wrapping/wrap")
+	r.ClientToken = token
+	r.WrapTTL = fmt.Sprintf("%ds", int64(wrapTTL.Seconds()))
+	if err := r.SetJSONBody(map[string]interface{}{
+		"token": token,
+	}); err != nil {
+		return "", err
+	}
+
+	resp, err := ss.client.RawRequest(r)
+	if resp != nil {
+		defer resp.Body.Close()
+	}
+	if err != nil {
+		return "", fmt.Errorf("error wrapping token: %v", err)
+	}
+
+	secret, err := api.ParseSecret(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("error parsing wrapping response: %v", err)
+	}
+	if secret == nil || secret.WrapInfo == nil {
+		return "", errors.New("wrapping response did not contain wrapping information")
+	}
+
+	m, err := json.Marshal(secret.WrapInfo)
+	if err != nil {
+		return "", fmt.Errorf("error marshaling wrapping information: %v", err)
+	}
+	return string(m), nil
+}
+
+// encryptToken encrypts the token with a key shared with the owner of the
+// public key at the DH path of the configuration, and returns the JSON
+// encoded envelope.
+func encryptToken(sc *SinkConfig, token string) (string, error) {
+	if sc.DHType != "curve25519" {
+		return "", fmt.Errorf("unsupported dh_type %q", sc.DHType)
+	}
+
+	raw, err := ioutil.ReadFile(sc.DHPath)
+	if err != nil {
+		return "", fmt.Errorf("error reading public key file: %v", err)
+	}
+
+	var pkInfo dhutil.PublicKeyInfo
+	if err := json.Unmarshal(raw, &pkInfo); err != nil {
+		return "", fmt.Errorf("error parsing public key file: %v", err)
+	}
+	if len(pkInfo.Curve25519PublicKey) == 0 {
+		return "", errors.New("public key file does not contain a curve25519 public key")
+	}
+
+	// A new key pair is used for every token
+	pub, priv, err := dhutil.GeneratePublicPrivateKey()
+	if err != nil {
+		return "", fmt.Errorf("error generating key pair: %v", err)
+	}
+	key, err := dhutil.GenerateSharedKey(priv, pkInfo.Curve25519PublicKey)
+	if err != nil {
+		return "", fmt.Errorf("error generating shared key: %v", err)
+	}
+
+	ciphertext, nonce, err := dhutil.EncryptAES(key, []byte(token), []byte(sc.AAD))
+	if err != nil {
+		return "", fmt.Errorf("error encrypting token: %v", err)
+	}
+
+	m, err := json.Marshal(&dhutil.Envelope{
+		Curve25519PublicKey: pub,
+		Nonce:               nonce,
+		EncryptedPayload:    ciphertext,
+	})
+	if err != nil {
+		return "", fmt.Errorf("error marshaling envelope: %v", err)
+	}
+	return string(m), nil
+}
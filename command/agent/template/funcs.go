@@ -0,0 +1,200 @@
+package template
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/hashicorp/vault/api"
+)
+
+// Secrets without a lease are fetched again at least this often, to pick up
+// changes of their data
+const staticRefreshInterval = 5 * time.Minute
+
+// PKICert is a certificate issued by a PKI backend.
+type PKICert struct {
+	Cert string
+	Key  string
+	CA   string
+}
+
+// cachedSecret is a secret fetched for the templates. Secrets with renewable
+// leases are renewed until they cannot be renewed anymore, other secrets are
+// fetched again at refreshAt.
+type cachedSecret struct {
+	key  string
+	path string
+
+	secret        *api.Secret
+	fetchedAt     time.Time
+	leaseDuration time.Duration
+	refreshAt     time.Time
+
+	renewer *api.Renewer
+	err     error
+	stopCh  chan struct{}
+}
+
+func (cs *cachedSecret) stop() {
+	if cs.renewer != nil {
+		cs.renewer.Stop()
+	}
+	close(cs.stopCh)
+}
+
+// placeholderFuncs are used to validate templates
+var placeholderFuncs = template.FuncMap{
+	"secret": func(string, ...string) (*api.Secret, error) {
+		return nil, nil
+	},
+	"pkiCert": func(string, ...string) (*PKICert, error) {
+		return nil, nil
+	},
+}
+
+// funcs returns the functions of the templates, recording the secrets used
+// by them
+func (s *Server) funcs(used map[string]struct{}) template.FuncMap {
+	return template.FuncMap{
+		// secret reads the secret at the path, or writes the given
+		// "key=value" arguments to it, as needed for instance to issue
+		// credentials with parameters
+		"secret": func(path string, args ...string) (*api.Secret, error) {
+			cs, err := s.fetch(used, "secret", path, args)
+			if err != nil {
+				return nil, err
+			}
+			return cs.secret, nil
+		},
+
+		// pkiCert issues a certificate by writing the given "key=value"
+		// arguments to the path, such as "pki/issue/<role>"
+		"pkiCert": func(path string, args ...string) (*PKICert, error) {
+			cs, err := s.fetch(used, "pkiCert", path, args)
+			if err != nil {
+				return nil, err
+			}
+
+			cert := &PKICert{}
+			cert.Cert, _ = cs.secret.Data["certificate"].(string)
+			cert.Key, _ = cs.secret.Data["private_key"].(string)
+			cert.CA, _ = cs.secret.Data["issuing_ca"].(string)
+			return cert, nil
+		},
+	}
+}
+
+// fetch returns the secret of the given kind at the path, fetching it unless
+// it is cached
+func (s *Server) fetch(used map[string]struct{}, kind, path string, args []string) (*cachedSecret, error) {
+	sortedArgs := make([]string, len(args))
+	copy(sortedArgs, args)
+	sort.Strings(sortedArgs)
+	key := strings.Join(append([]string{kind, path}, sortedArgs...), "\x00")
+	used[key] = struct{}{}
+
+	if cs, ok := s.secrets[key]; ok {
+		return cs, nil
+	}
+
+	data := make(map[string]interface{}, len(args))
+	for _, arg := range args {
+		parts := strings.SplitN(arg, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid argument %q for %s, expected key=value", arg, path)
+		}
+		data[parts[0]] = parts[1]
+	}
+
+	var secret *api.Secret
+	var err error
+	if kind == "secret" && len(data) == 0 {
+		secret, err = s.client.Logical().Read(path)
+	} else {
+		secret, err = s.client.Logical().Write(path, data)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error fetching %s: %v", path, err)
+	}
+	if secret == nil {
+		return nil, fmt.Errorf("no secret found at %s", path)
+	}
+
+	now := time.Now()
+	cs := &cachedSecret{
+		key:           key,
+		path:          path,
+		secret:        secret,
+		fetchedAt:     now,
+		leaseDuration: time.Duration(secret.LeaseDuration) * time.Second,
+		stopCh:        make(chan struct{}),
+	}
+
+	switch {
+	case secret.LeaseID != "" && secret.Renewable:
+		renewer, err := s.client.NewRenewer(&api.RenewerInput{
+			Secret: secret,
+		})
+		if err != nil {
+			return nil, err
+		}
+		cs.renewer = renewer
+		go renewer.Renew()
+		go s.watchRenewer(cs)
+
+	case secret.LeaseID != "":
+		cs.refreshAt = now.Add(cs.leaseDuration * 2 / 3)
+
+	case kind == "pkiCert":
+		validity, err := certValidity(secret, now)
+		if err != nil {
+			return nil, err
+		}
+		cs.refreshAt = now.Add(validity * 2 / 3)
+
+	default:
+		interval := cs.leaseDuration
+		if interval <= 0 || interval > staticRefreshInterval {
+			interval = staticRefreshInterval
+		}
+		cs.refreshAt = now.Add(interval)
+	}
+
+	s.logger.Trace("template.server: fetched secret", "path", path)
+	s.secrets[key] = cs
+	return cs, nil
+}
+
+// watchRenewer notifies the server once the secret cannot be renewed anymore
+func (s *Server) watchRenewer(cs *cachedSecret) {
+	select {
+	case <-cs.stopCh:
+	case err := <-cs.renewer.DoneCh():
+		cs.err = err
+		select {
+		case <-cs.stopCh:
+		case s.doneCh <- cs:
+		}
+	}
+}
+
+// certValidity returns the remaining validity of the certificate of the
+// secret
+func certValidity(secret *api.Secret, now time.Time) (time.Duration, error) {
+	certPEM, _ := secret.Data["certificate"].(string)
+	block, _ := pem.Decode([]byte(certPEM))
+	if block == nil {
+		return 0, errors.New("response did not contain a PEM encoded certificate")
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return 0, fmt.Errorf("error parsing certificate: %v", err)
+	}
+	return cert.NotAfter.Sub(now), nil
+}
@@ -0,0 +1,323 @@
+package template
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"text/template"
+	"time"
+
+	"github.com/hashicorp/go-multierror"
+	"github.com/hashicorp/vault/api"
+	log "github.com/mgutz/logxi/v1"
+)
+
+const (
+	initialBackoff = 1 * time.Second
+	maxBackoff     = 5 * time.Minute
+)
+
+// TemplateConfig is the configuration of a template rendered to a file.
+type TemplateConfig struct {
+	Source         string
+	Destination    string
+	Perms          os.FileMode
+	Command        string
+	CommandTimeout time.Duration
+}
+
+// ServerConfig is the configuration of a Server.
+type ServerConfig struct {
+	Logger log.Logger
+
+	// ClientConfig is used to create a client for every token received,
+	// since the token of a client cannot be changed safely while renewers
+	// use it
+	ClientConfig *api.Config
+}
+
+// Server renders templates with the secrets of Vault to files. Templates are
+// rendered again when a new token is received, when a secret they use is
+// about to expire, and when the data of a secret without a lease may have
+// changed. Files are only written, and commands only run, when the rendered
+// contents changed.
+type Server struct {
+	logger       log.Logger
+	clientConfig *api.Config
+
+	templates []*parsedTemplate
+
+	client  *api.Client
+	secrets map[string]*cachedSecret
+	doneCh  chan *cachedSecret
+
+	initialBackoff time.Duration
+}
+
+// parsedTemplate is a template whose source was read and validated
+type parsedTemplate struct {
+	*TemplateConfig
+	contents string
+}
+
+// NewServer creates a new Server for the given templates, failing if a
+// template cannot be read or parsed.
+func NewServer(conf *ServerConfig, templates []*TemplateConfig) (*Server, error) {
+	s := &Server{
+		logger:       conf.Logger,
+		clientConfig: conf.ClientConfig,
+		secrets:      make(map[string]*cachedSecret),
+		doneCh:       make(chan *cachedSecret),
+
+		initialBackoff: initialBackoff,
+	}
+
+	for _, tc := range templates {
+		contents, err := ioutil.ReadFile(tc.Source)
+		if err != nil {
+			return nil, fmt.Errorf("error reading template %s: %v", tc.Source, err)
+		}
+		pt := &parsedTemplate{
+			TemplateConfig: tc,
+			contents:       string(contents),
+		}
+		if _, err := pt.parse(nil); err != nil {
+			return nil, err
+		}
+		s.templates = append(s.templates, pt)
+	}
+
+	return s, nil
+}
+
+// Run renders the templates with the tokens received on the incoming channel
+// until the stop channel is closed. Rendering starts with the first token.
+// Run blocks, so it is usually run in a goroutine.
+func (s *Server) Run(stopCh <-chan struct{}, incoming <-chan string) {
+	if incoming == nil {
+		panic("incoming channel is nil")
+	}
+	defer s.reset()
+
+	backoff := s.initialBackoff
+	var wakeCh <-chan time.Time
+
+	for {
+		select {
+		case <-stopCh:
+			return
+
+		case token := <-incoming:
+			s.logger.Trace("template.server: received new token")
+
+			// The leases of the secrets belong to the previous token
+			s.reset()
+			client, err := api.NewClient(s.clientConfig)
+			if err != nil {
+				s.logger.Error("template.server: error creating client", "error", err)
+				continue
+			}
+			client.SetToken(token)
+			s.client = client
+			backoff = s.initialBackoff
+
+		case cs := <-s.doneCh:
+			if s.secrets[cs.key] != cs {
+				continue
+			}
+			if cs.err != nil {
+				s.logger.Warn("template.server: error renewing secret", "path", cs.path, "error", cs.err)
+			}
+			// Fetch the secret again once it got old enough, so that
+			// short leases do not make templates render continuously
+			cs.refreshAt = cs.fetchedAt.Add(cs.leaseDuration * 2 / 3)
+			if wait := cs.refreshAt.Sub(time.Now()); wait > 0 {
+				wakeCh = s.nextWake(wakeCh)
+				continue
+			}
+
+		case <-wakeCh:
+		}
+
+		if s.client == nil {
+			continue
+		}
+
+		// Secrets that are due are fetched again while rendering
+		now := time.Now()
+		for key, cs := range s.secrets {
+			if !cs.refreshAt.IsZero() && !now.Before(cs.refreshAt) {
+				cs.stop()
+				delete(s.secrets, key)
+			}
+		}
+
+		if err := s.renderAll(); err != nil {
+			s.logger.Error("template.server: error rendering templates", "error", err, "backoff", backoff)
+			wakeCh = time.After(backoff)
+			backoff *= 2
+			if backoff > maxBackoff {
+				backoff = maxBackoff
+			}
+			continue
+		}
+		backoff = s.initialBackoff
+		wakeCh = s.nextWake(nil)
+	}
+}
+
+// nextWake returns a channel firing when the next secret is due to be fetched
+// again, or nil if no secret is due
+func (s *Server) nextWake(current <-chan time.Time) <-chan time.Time {
+	var next time.Time
+	for _, cs := range s.secrets {
+		if cs.refreshAt.IsZero() {
+			continue
+		}
+		if next.IsZero() || cs.refreshAt.Before(next) {
+			next = cs.refreshAt
+		}
+	}
+	if next.IsZero() {
+		return current
+	}
+	return time.After(next.Sub(time.Now()))
+}
+
+// renderAll renders every template, and removes the secrets no template uses
+// anymore
+func (s *Server) renderAll() error {
+	var result error
+	used := make(map[string]struct{})
+	for _, pt := range s.templates {
+		if err := s.render(pt, used); err != nil {
+			result = multierror.Append(result, fmt.Errorf("%s: %v", pt.Source, err))
+		}
+	}
+
+	// Failed templates may not have asked for all of their secrets
+	if result != nil {
+		return result
+	}
+
+	for key, cs := range s.secrets {
+		if _, ok := used[key]; !ok {
+			cs.stop()
+			delete(s.secrets, key)
+		}
+	}
+	return nil
+}
+
+// render renders a template and writes it to its destination if the contents
+// changed, running its command afterwards
+func (s *Server) render(pt *parsedTemplate, used map[string]struct{}) error {
+	tmpl, err := pt.parse(s.funcs(used))
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, nil); err != nil {
+		return err
+	}
+
+	existing, err := ioutil.ReadFile(pt.Destination)
+	if err == nil && bytes.Equal(existing, buf.Bytes()) {
+		s.logger.Trace("template.server: template unchanged", "destination", pt.Destination)
+		return nil
+	}
+
+	if err := writeFile(pt.Destination, buf.Bytes(), pt.Perms); err != nil {
+		return err
+	}
+	s.logger.Info("template.server: rendered template", "destination", pt.Destination)
+
+	if pt.Command != "" {
+		if err := runCommand(pt.Command, pt.CommandTimeout); err != nil {
+			// The file was rendered, so the command is not retried
+			s.logger.Error("template.server: error running command", "command", pt.Command, "error", err)
+		}
+	}
+	return nil
+}
+
+// reset stops the renewal of all secrets and forgets them
+func (s *Server) reset() {
+	for key, cs := range s.secrets {
+		cs.stop()
+		delete(s.secrets, key)
+	}
+}
+
+func (pt *parsedTemplate) parse(funcs template.FuncMap) (*template.Template, error) {
+	if funcs == nil {
+		funcs = placeholderFuncs
+	}
+	tmpl, err := template.New(filepath.Base(pt.Source)).Funcs(funcs).Parse(pt.contents)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing template %s: %v", pt.Source, err)
+	}
+	return tmpl, nil
+}
+
+// writeFile replaces the contents of the file atomically
+func writeFile(path string, contents []byte, perms os.FileMode) error {
+	tmpFile, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return fmt.Errorf("error creating temp file in %s: %v", filepath.Dir(path), err)
+	}
+	tmpPath := tmpFile.Name()
+
+	if err := tmpFile.Chmod(perms); err != nil {
+		tmpFile.Close()
+		os.Remove(tmpPath)
+		return fmt.Errorf("error setting permissions of temp file: %v", err)
+	}
+	if _, err := tmpFile.Write(contents); err != nil {
+		tmpFile.Close()
+		os.Remove(tmpPath)
+		return fmt.Errorf("error writing temp file: %v", err)
+	}
+	if err := tmpFile.Close(); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("error closing temp file: %v", err)
+	}
+
+	if err := os.Rename(tmpPath, path); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("error renaming temp file to %s: %v", path, err)
+	}
+	return nil
+}
+
+// runCommand runs the command with the shell, killing it after the timeout
+func runCommand(command string, timeout time.Duration) error {
+	cmd := exec.Command("/bin/sh", "-c", command)
+	var output bytes.Buffer
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- cmd.Wait()
+	}()
+
+	select {
+	case err := <-errCh:
+		if err != nil {
+			return fmt.Errorf("%v: %s", err, output.String())
+		}
+		return nil
+	case <-time.After(timeout):
+		cmd.Process.Kill()
+		<-errCh
+		return fmt.Errorf("command timed out after %s", timeout)
+	}
+}
@@ -0,0 +1,174 @@
+package template
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/api"
+	"github.com/hashicorp/vault/builtin/logical/pki"
+	"github.com/hashicorp/vault/helper/logformat"
+	vaulthttp "github.com/hashicorp/vault/http"
+	"github.com/hashicorp/vault/vault"
+	log "github.com/mgutz/logxi/v1"
+)
+
+func TestServer_render(t *testing.T) {
+	if err := vault.AddTestLogicalBackend("pki", pki.Factory); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	core, _, token := vault.TestCoreUnsealed(t)
+	ln, addr := vaulthttp.TestServer(t, core)
+	defer ln.Close()
+
+	config := api.DefaultConfig()
+	config.Address = addr
+	client, err := api.NewClient(config)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	client.SetToken(token)
+
+	// The short TTL makes the secret be fetched again quickly
+	if _, err := client.Logical().Write("secret/foo", map[string]interface{}{
+		"password": "one",
+		"ttl":      "1",
+	}); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if err := client.Sys().Mount("pki", &api.MountInput{Type: "pki"}); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if _, err := client.Logical().Write("pki/root/generate/internal", map[string]interface{}{
+		"common_name": "example.com",
+		"ttl":         "720h",
+	}); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if _, err := client.Logical().Write("pki/roles/web", map[string]interface{}{
+		"allowed_domains":  "example.com",
+		"allow_subdomains": true,
+		"max_ttl":          "1h",
+	}); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	dir, err := ioutil.TempDir("", "vault-template")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	sources := map[string]string{
+		"password.tmpl": `{{ with secret "secret/foo" }}password={{ .Data.password }}{{ end }}`,
+		"cert.tmpl":     `{{ with pkiCert "pki/issue/web" "common_name=www.example.com" }}{{ .Cert }}{{ .Key }}{{ end }}`,
+	}
+	for name, contents := range sources {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(contents), 0600); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+
+	passwordPath := filepath.Join(dir, "password")
+	certPath := filepath.Join(dir, "cert")
+	logPath := filepath.Join(dir, "log")
+
+	server, err := NewServer(&ServerConfig{
+		Logger:       logformat.NewVaultLogger(log.LevelTrace),
+		ClientConfig: config,
+	}, []*TemplateConfig{
+		&TemplateConfig{
+			Source:         filepath.Join(dir, "password.tmpl"),
+			Destination:    passwordPath,
+			Perms:          0600,
+			Command:        "echo rendered >> " + logPath,
+			CommandTimeout: 5 * time.Second,
+		},
+		&TemplateConfig{
+			Source:      filepath.Join(dir, "cert.tmpl"),
+			Destination: certPath,
+			Perms:       0644,
+		},
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	incoming := make(chan string)
+	go server.Run(stopCh, incoming)
+	incoming <- token
+
+	waitFor := func(path, expected string) {
+		for i := 0; ; i++ {
+			contents, _ := ioutil.ReadFile(path)
+			if strings.Contains(string(contents), expected) {
+				return
+			}
+			if i == 100 {
+				t.Fatalf("%s was not rendered with %q: %q", path, expected, contents)
+			}
+			time.Sleep(100 * time.Millisecond)
+		}
+	}
+
+	waitFor(passwordPath, "password=one")
+	waitFor(certPath, "-----BEGIN CERTIFICATE-----")
+
+	info, err := os.Stat(passwordPath)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Fatalf("bad: %v", info.Mode())
+	}
+
+	// Changed data is picked up when the secret is fetched again
+	if _, err := client.Logical().Write("secret/foo", map[string]interface{}{
+		"password": "two",
+		"ttl":      "1",
+	}); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	waitFor(passwordPath, "password=two")
+
+	// Fetching unchanged data does not render the template again
+	time.Sleep(2 * time.Second)
+	runs, err := ioutil.ReadFile(logPath)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if n := strings.Count(string(runs), "rendered"); n != 2 {
+		t.Fatalf("bad: command ran %d times", n)
+	}
+}
+
+func TestNewServer_invalidTemplate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vault-template")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	source := filepath.Join(dir, "bad.tmpl")
+	if err := ioutil.WriteFile(source, []byte(`{{ secret "secret/foo" `), 0600); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if _, err := NewServer(&ServerConfig{
+		Logger:       logformat.NewVaultLogger(log.LevelTrace),
+		ClientConfig: api.DefaultConfig(),
+	}, []*TemplateConfig{
+		&TemplateConfig{
+			Source:      source,
+			Destination: filepath.Join(dir, "bad"),
+		},
+	}); err == nil {
+		t.Fatal("expected error")
+	}
+}
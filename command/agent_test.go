@@ -0,0 +1,235 @@
+package command
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/api"
+	credAppRole "github.com/hashicorp/vault/builtin/credential/approle"
+	"github.com/hashicorp/vault/helper/dhutil"
+	vaulthttp "github.com/hashicorp/vault/http"
+	"github.com/hashicorp/vault/meta"
+	"github.com/hashicorp/vault/vault"
+	"github.com/mitchellh/cli"
+)
+
+func TestAgent_approle(t *testing.T) {
+	if err := vault.AddTestCredentialBackend("approle", credAppRole.Factory); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	core, _, token := vault.TestCoreUnsealed(t)
+	ln, addr := vaulthttp.TestServer(t, core)
+	defer ln.Close()
+
+	config := api.DefaultConfig()
+	config.Address = addr
+	client, err := api.NewClient(config)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	client.SetToken(token)
+
+	if err := client.Sys().EnableAuth("approle", "approle", ""); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if _, err := client.Logical().Write("auth/approle/role/test", map[string]interface{}{
+		"policies": "default",
+	}); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	roleID, err := client.Logical().Read("auth/approle/role/test/role-id")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	secretID, err := client.Logical().Write("auth/approle/role/test/secret-id", nil)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	dir, err := ioutil.TempDir("", "vault-agent")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	roleIDPath := filepath.Join(dir, "role-id")
+	secretIDPath := filepath.Join(dir, "secret-id")
+	dhPath := filepath.Join(dir, "dh-pub")
+	tokenPath := filepath.Join(dir, "token")
+	envelopePath := filepath.Join(dir, "envelope")
+	templatePath := filepath.Join(dir, "token.tmpl")
+	renderedPath := filepath.Join(dir, "rendered")
+
+	pub, priv, err := dhutil.GeneratePublicPrivateKey()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	pubInfo, err := json.Marshal(&dhutil.PublicKeyInfo{Curve25519PublicKey: pub})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	for path, contents := range map[string]string{
+		roleIDPath:   roleID.Data["role_id"].(string),
+		secretIDPath: secretID.Data["secret_id"].(string),
+		dhPath:       string(pubInfo),
+		templatePath: `{{ with secret "auth/token/lookup-self" }}{{ .Data.id }}{{ end }}`,
+	} {
+		if err := ioutil.WriteFile(path, []byte(contents), 0600); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+
+	// Find a free port for the listener of the agent
+	proxyLn, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	proxyAddr := proxyLn.Addr().String()
+	proxyLn.Close()
+
+	configPath := filepath.Join(dir, "agent.hcl")
+	if err := ioutil.WriteFile(configPath, []byte(fmt.Sprintf(`
+vault {
+	address = %q
+}
+
+auto_auth {
+	method "approle" {
+		config = {
+			role_id_file_path = %q
+			secret_id_file_path = %q
+		}
+	}
+
+	sink "file" {
+		config = {
+			path = %q
+		}
+	}
+
+	sink "file" {
+		wrap_ttl = "5m"
+		dh_type = "curve25519"
+		dh_path = %q
+		aad = "foobar"
+		config = {
+			path = %q
+		}
+	}
+}
+
+cache {
+	use_auto_auth_token = true
+}
+
+listener "tcp" {
+	address = %q
+	tls_disable = "true"
+}
+
+template {
+	source = %q
+	destination = %q
+}
+`, addr, roleIDPath, secretIDPath, tokenPath, dhPath, envelopePath, proxyAddr, templatePath, renderedPath)), 0600); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	ui := new(cli.MockUi)
+	cmd := &AgentCommand{
+		Meta: meta.Meta{
+			Ui: ui,
+		},
+		ShutdownCh: make(chan struct{}),
+	}
+
+	doneCh := make(chan int)
+	go func() {
+		doneCh <- cmd.Run([]string{"-config", configPath})
+	}()
+	defer func() {
+		close(cmd.ShutdownCh)
+		if code := <-doneCh; code != 0 {
+			t.Fatalf("bad: %d\n\n%s", code, ui.ErrorWriter.String())
+		}
+	}()
+
+	// Wait for both sinks to be written and the template to be rendered
+	var agentToken, envelope, rendered []byte
+	for i := 0; ; i++ {
+		agentToken, _ = ioutil.ReadFile(tokenPath)
+		envelope, _ = ioutil.ReadFile(envelopePath)
+		rendered, _ = ioutil.ReadFile(renderedPath)
+		if len(agentToken) > 0 && len(envelope) > 0 && len(rendered) > 0 {
+			break
+		}
+		if i == 100 {
+			t.Fatalf("sinks were not written or template not rendered\n\n%s", ui.ErrorWriter.String())
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	if _, err := os.Stat(secretIDPath); !os.IsNotExist(err) {
+		t.Fatalf("secret ID file should have been removed: %v", err)
+	}
+
+	agentClient, err := api.NewClient(config)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	agentClient.SetToken(string(agentToken))
+	if _, err := agentClient.Auth().Token().LookupSelf(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if string(rendered) != string(agentToken) {
+		t.Fatalf("bad: %s", rendered)
+	}
+
+	// Decrypt the envelope and unwrap the token in it
+	var env dhutil.Envelope
+	if err := json.Unmarshal(envelope, &env); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	key, err := dhutil.GenerateSharedKey(priv, env.Curve25519PublicKey)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	plaintext, err := dhutil.DecryptAES(key, env.EncryptedPayload, env.Nonce, []byte("foobar"))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	var wrapInfo api.SecretWrapInfo
+	if err := json.Unmarshal(plaintext, &wrapInfo); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	unwrapped, err := client.Logical().Unwrap(wrapInfo.Token)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if unwrapped.Data["token"] != string(agentToken) {
+		t.Fatalf("bad: %#v", unwrapped.Data)
+	}
+
+	// Requests without a token through the listener use the agent's token
+	proxyConfig := api.DefaultConfig()
+	proxyConfig.Address = "http://" + proxyAddr
+	proxyClient, err := api.NewClient(proxyConfig)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	proxyClient.ClearToken()
+	self, err := proxyClient.Logical().Read("auth/token/lookup-self")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if self.Data["id"] != string(agentToken) {
+		t.Fatalf("bad: %#v", self.Data)
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"os"
 	"strings"
 
+	"github.com/hashicorp/vault/api"
 	"github.com/hashicorp/vault/helper/kv-builder"
 	"github.com/hashicorp/vault/meta"
 	"github.com/mitchellh/mapstructure"
@@ -20,10 +21,11 @@ type AuditEnableCommand struct {
 }
 
 func (c *AuditEnableCommand) Run(args []string) int {
-	var desc, path string
+	var desc, path, filter string
 	flags := c.Meta.FlagSet("audit-enable", meta.FlagSetDefault)
 	flags.StringVar(&desc, "description", "", "")
 	flags.StringVar(&path, "path", "", "")
+	flags.StringVar(&filter, "filter", "", "")
 	flags.Usage = func() { c.Ui.Error(c.Help()) }
 	if err := flags.Parse(args); err != nil {
 		return 1
@@ -68,7 +70,12 @@ func (c *AuditEnableCommand) Run(args []string) int {
 		return 1
 	}
 
-	err = client.Sys().EnableAudit(path, auditType, desc, opts)
+	err = client.Sys().EnableAuditWithOptions(path, &api.EnableAuditOptions{
+		Type:        auditType,
+		Description: desc,
+		Options:     opts,
+		Filter:      filter,
+	})
 	if err != nil {
 		c.Ui.Error(fmt.Sprintf(
 			"Error enabling audit backend: %s", err))
@@ -113,6 +120,15 @@ Audit Enable Options:
                           is purely for referencing this audit backend. By
                           default this will be the backend type.
 
+  -filter=<expr>          Only send requests matching this expression to the
+                          backend, for example:
+                          'mount_type != "transit" or error'. Expressions
+                          compare mount_path, mount_type, operation, path
+                          and display_name to quoted strings using ==, !=
+                          or prefix, and combine them with and, or, not and
+                          parentheses. The word error matches failed
+                          requests.
+
 `
 	return strings.TrimSpace(helpText)
 }
@@ -0,0 +1,131 @@
+package command
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/hashicorp/vault/audit"
+	"github.com/hashicorp/vault/meta"
+)
+
+// AuditVerifyCommand is a Command that checks a hash chained audit log for
+// missing, reordered or modified entries.
+type AuditVerifyCommand struct {
+	meta.Meta
+}
+
+func (c *AuditVerifyCommand) Run(args []string) int {
+	var path, key string
+	flags := c.Meta.FlagSet("audit-verify", meta.FlagSetDefault)
+	flags.StringVar(&path, "path", "", "")
+	flags.StringVar(&key, "key", "", "")
+	flags.Usage = func() { c.Ui.Error(c.Help()) }
+	if err := flags.Parse(args); err != nil {
+		return 1
+	}
+
+	args = flags.Args()
+	if len(args) != 1 {
+		flags.Usage()
+		c.Ui.Error(fmt.Sprintf(
+			"\naudit-verify expects one argument: the audit log file"))
+		return 1
+	}
+
+	switch {
+	case path == "" && key == "":
+		c.Ui.Error("Either -path or -key must be specified")
+		return 1
+	case path != "" && key != "":
+		c.Ui.Error("Only one of -path and -key may be specified")
+		return 1
+	}
+
+	if key == "" {
+		client, err := c.Client()
+		if err != nil {
+			c.Ui.Error(fmt.Sprintf(
+				"Error initializing client: %s", err))
+			return 2
+		}
+
+		key, err = client.Sys().AuditHashChainKey(path)
+		if err != nil {
+			c.Ui.Error(fmt.Sprintf(
+				"Error reading hash chain key: %s", err))
+			return 2
+		}
+	}
+
+	f, err := os.Open(args[0])
+	if err != nil {
+		c.Ui.Error(fmt.Sprintf(
+			"Error opening audit log: %s", err))
+		return 2
+	}
+	defer f.Close()
+
+	report, err := audit.VerifyHashChain(f, key)
+	if err != nil {
+		c.Ui.Error(fmt.Sprintf(
+			"Error verifying audit log: %s", err))
+		return 2
+	}
+
+	c.Ui.Output(fmt.Sprintf("Lines:           %d", report.Lines))
+	c.Ui.Output(fmt.Sprintf("Sequence:        %d to %d", report.FirstSequence, report.LastSequence))
+	c.Ui.Output(fmt.Sprintf("Checkpoints:     %d", report.Checkpoints))
+	if report.Checkpoints > 0 {
+		c.Ui.Output(fmt.Sprintf("Last checkpoint: %d", report.LastCheckpoint))
+	}
+
+	if !report.Valid() {
+		c.Ui.Error(fmt.Sprintf(
+			"\nVerification failed with %d problem(s):\n\n  %s",
+			len(report.Problems), strings.Join(report.Problems, "\n  ")))
+		return 2
+	}
+
+	c.Ui.Output("\nSuccess! The audit log is intact.")
+	return 0
+}
+
+func (c *AuditVerifyCommand) Synopsis() string {
+	return "Verify the integrity of a hash chained audit log"
+}
+
+func (c *AuditVerifyCommand) Help() string {
+	helpText := `
+Usage: vault audit-verify [options] file
+
+  Verify the integrity of a hash chained audit log.
+
+  Audit backends enabled with hash_chain=true write each entry with a
+  sequence number and an HMAC chained to the entry before it. This command
+  walks such a log and reports any entries that are missing, out of order
+  or modified.
+
+  The key used to compute the chain is read from the audit backend given
+  by -path, which requires sudo capability, or can be given directly with
+  -key to verify a log offline:
+
+      $ vault audit-verify -path=file /var/log/vault_audit.log
+
+  A log that does not begin at the start of the chain, such as one that has
+  been rotated, is checked from its first checkpoint onwards. Entries before
+  that checkpoint cannot be verified and are reported as problems.
+
+General Options:
+` + meta.GeneralOptionsUsage() + `
+Audit Verify Options:
+
+  -path=<path>            The path of the audit backend that wrote the log,
+                          used to read the hash chain key from Vault.
+
+  -key=<key>              The hex-encoded hash chain key, as returned by
+                          sys/audit-hash-chain-key/<path>.
+
+`
+	return strings.TrimSpace(helpText)
+}
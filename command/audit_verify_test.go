@@ -0,0 +1,93 @@
+package command
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/vault/audit"
+	"github.com/hashicorp/vault/helper/salt"
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/meta"
+	"github.com/mitchellh/cli"
+)
+
+func TestAuditVerify(t *testing.T) {
+	salter, _ := salt.NewSalt(nil, nil)
+	key := audit.HashChainKey(salter)
+	chain, err := audit.NewHashChain(key, 0)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	formatter := audit.AuditFormatter{
+		AuditFormatWriter: &audit.HashChainFormatWriter{
+			AuditFormatWriter: &audit.JSONFormatWriter{},
+			Chain:             chain,
+		},
+	}
+
+	var buf bytes.Buffer
+	for _, path := range []string{"foo", "bar"} {
+		req := &logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      path,
+		}
+		if err := formatter.FormatRequest(&buf, audit.FormatterConfig{Salt: salter}, nil, req, nil); err != nil {
+			t.Fatalf("err: %v", err)
+		}
+	}
+
+	f, err := ioutil.TempFile("", "vault-audit-verify")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(buf.Bytes()); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	f.Close()
+
+	ui := new(cli.MockUi)
+	c := &AuditVerifyCommand{
+		Meta: meta.Meta{
+			Ui: ui,
+		},
+	}
+	if code := c.Run([]string{"-key", key, f.Name()}); code != 0 {
+		t.Fatalf("bad: %d\n\n%s", code, ui.ErrorWriter.String())
+	}
+	if !strings.Contains(ui.OutputWriter.String(), "Success!") {
+		t.Fatalf("bad: %s", ui.OutputWriter.String())
+	}
+
+	// Tampering is reported
+	tampered := strings.Replace(buf.String(), `"path":"bar"`, `"path":"baz"`, 1)
+	if err := ioutil.WriteFile(f.Name(), []byte(tampered), 0600); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	ui = new(cli.MockUi)
+	c.Ui = ui
+	if code := c.Run([]string{"-key", key, f.Name()}); code != 2 {
+		t.Fatalf("bad: %d", code)
+	}
+	if !strings.Contains(ui.ErrorWriter.String(), "sequence 3 has been modified") {
+		t.Fatalf("bad: %s", ui.ErrorWriter.String())
+	}
+
+	// One of -path and -key is required
+	if code := c.Run([]string{f.Name()}); code != 1 {
+		t.Fatalf("bad: %d", code)
+	}
+
+	// As is the audit log
+	ui = new(cli.MockUi)
+	c.Ui = ui
+	if code := c.Run([]string{"-key", key}); code != 1 {
+		t.Fatalf("bad: %d", code)
+	}
+	if !strings.Contains(ui.ErrorWriter.String(), "audit-verify expects one argument") {
+		t.Fatalf("bad: %s", ui.ErrorWriter.String())
+	}
+}
@@ -0,0 +1,112 @@
+package command
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/hashicorp/vault/api"
+	"github.com/hashicorp/vault/meta"
+)
+
+// LeaseLookupCommand is a Command that outputs details about a lease, or
+// lists the leases under a prefix.
+type LeaseLookupCommand struct {
+	meta.Meta
+}
+
+func (c *LeaseLookupCommand) Run(args []string) int {
+	var format string
+	var prefix bool
+	flags := c.Meta.FlagSet("lease-lookup", meta.FlagSetDefault)
+	flags.BoolVar(&prefix, "prefix", false, "")
+	flags.StringVar(&format, "format", "table", "")
+	flags.Usage = func() { c.Ui.Error(c.Help()) }
+	if err := flags.Parse(args); err != nil {
+		return 1
+	}
+
+	args = flags.Args()
+	switch {
+	case prefix && len(args) > 1:
+		flags.Usage()
+		c.Ui.Error(fmt.Sprintf(
+			"\nlease-lookup -prefix expects at most one argument: the prefix to list"))
+		return 1
+	case !prefix && len(args) != 1:
+		flags.Usage()
+		c.Ui.Error(fmt.Sprintf(
+			"\nlease-lookup expects one argument: the ID of the lease"))
+		return 1
+	}
+
+	client, err := c.Client()
+	if err != nil {
+		c.Ui.Error(fmt.Sprintf(
+			"Error initializing client: %s", err))
+		return 2
+	}
+
+	if !prefix {
+		secret, err := client.Sys().LookupLease(args[0])
+		if err != nil {
+			c.Ui.Error(fmt.Sprintf(
+				"Error looking up lease: %s", err))
+			return 1
+		}
+		return OutputSecret(c.Ui, format, secret)
+	}
+
+	var path string
+	if len(args) == 1 {
+		path = strings.TrimPrefix(args[0], "/")
+		if path != "" && !strings.HasSuffix(path, "/") {
+			path = path + "/"
+		}
+	}
+
+	var secret *api.Secret
+	secret, err = client.Sys().ListLeases(path)
+	if err != nil {
+		c.Ui.Error(fmt.Sprintf(
+			"Error listing leases: %s", err))
+		return 1
+	}
+	if secret == nil || secret.Data["keys"] == nil {
+		c.Ui.Error("No leases found")
+		return 0
+	}
+	return OutputList(c.Ui, format, secret)
+}
+
+func (c *LeaseLookupCommand) Synopsis() string {
+	return "Display information about a lease or list leases"
+}
+
+func (c *LeaseLookupCommand) Help() string {
+	helpText := `
+Usage: vault lease-lookup [options] id
+
+  Display information about a lease.
+
+  This command shows when the lease with the given ID was issued, when it
+  expires, when it was last renewed and whether it can be renewed.
+
+  With the -prefix flag, the leases under the given prefix are listed
+  instead. Lease IDs begin with the path of the request that created them,
+  so listing a mount path such as "postgresql/" shows the prefixes of the
+  leases outstanding for that mount, which can then be listed in turn.
+  Listing requires sudo capability on sys/leases/lookup/.
+
+General Options:
+` + meta.GeneralOptionsUsage() + `
+Lease Lookup Options:
+
+  -prefix=true            List the leases under the given prefix rather
+                          than looking up a single lease.
+
+  -format=table           The format for output. By default it is a
+                          whitespace-delimited table. This can also be json
+                          or yaml.
+`
+	return strings.TrimSpace(helpText)
+}
@@ -0,0 +1,62 @@
+package command
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/vault/http"
+	"github.com/hashicorp/vault/meta"
+	"github.com/hashicorp/vault/vault"
+	"github.com/mitchellh/cli"
+)
+
+func TestLeaseLookup(t *testing.T) {
+	core, _, token := vault.TestCoreUnsealed(t)
+	ln, addr := http.TestServer(t, core)
+	defer ln.Close()
+
+	// create a token to get a lease
+	client := testClient(t, addr, token)
+	if _, err := client.Auth().Token().Create(nil); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// the lease of a token is stored under its creation path
+	ui := new(cli.MockUi)
+	c := &LeaseLookupCommand{
+		Meta: meta.Meta{
+			ClientToken: token,
+			Ui:          ui,
+		},
+	}
+	args := []string{
+		"-address", addr,
+		"-prefix",
+		"auth/token/create",
+	}
+	if code := c.Run(args); code != 0 {
+		t.Fatalf("bad: %d\n\n%s", code, ui.ErrorWriter.String())
+	}
+	// the output is the table header followed by the lease
+	leases := strings.Fields(ui.OutputWriter.String())
+	if len(leases) != 3 {
+		t.Fatalf("bad: %q", ui.OutputWriter.String())
+	}
+	leaseID := "auth/token/create/" + leases[2]
+
+	ui = new(cli.MockUi)
+	c.Meta.Ui = ui
+	args = []string{
+		"-address", addr,
+		leaseID,
+	}
+	if code := c.Run(args); code != 0 {
+		t.Fatalf("bad: %d\n\n%s", code, ui.ErrorWriter.String())
+	}
+	output := ui.OutputWriter.String()
+	for _, key := range []string{"issue_time", "expire_time", "renewable"} {
+		if !strings.Contains(output, key) {
+			t.Fatalf("missing %s: %s", key, output)
+		}
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"strings"
 
 	"github.com/hashicorp/vault/api"
+	"github.com/hashicorp/vault/helper/flag-slice"
 	"github.com/hashicorp/vault/meta"
 )
 
@@ -15,10 +16,14 @@ type MountTuneCommand struct {
 }
 
 func (c *MountTuneCommand) Run(args []string) int {
-	var defaultLeaseTTL, maxLeaseTTL string
+	var defaultLeaseTTL, maxLeaseTTL, tokenType string
+	var auditNonHMACRequestKeys, auditNonHMACResponseKeys []string
 	flags := c.Meta.FlagSet("mount-tune", meta.FlagSetDefault)
 	flags.StringVar(&defaultLeaseTTL, "default-lease-ttl", "", "")
 	flags.StringVar(&maxLeaseTTL, "max-lease-ttl", "", "")
+	flags.Var((*sliceflag.StringFlag)(&auditNonHMACRequestKeys), "audit-non-hmac-request-keys", "")
+	flags.Var((*sliceflag.StringFlag)(&auditNonHMACResponseKeys), "audit-non-hmac-response-keys", "")
+	flags.StringVar(&tokenType, "token-type", "", "")
 	flags.Usage = func() { c.Ui.Error(c.Help()) }
 	if err := flags.Parse(args); err != nil {
 		return 1
@@ -37,6 +42,11 @@ func (c *MountTuneCommand) Run(args []string) int {
 	mountConfig := api.MountConfigInput{
 		DefaultLeaseTTL: defaultLeaseTTL,
 		MaxLeaseTTL:     maxLeaseTTL,
+
+		AuditNonHMACRequestKeys:  auditNonHMACRequestKeys,
+		AuditNonHMACResponseKeys: auditNonHMACResponseKeys,
+
+		TokenType: tokenType,
 	}
 
 	client, err := c.Client()
@@ -84,6 +94,21 @@ Mount Options:
                                  the previously set value. Set to 'system' to
                                  explicitly set it to use the system default.
 
+  -audit-non-hmac-request-keys=<key>
+                                 A key in the request data that audit backends
+                                 will log without hashing its value. Can be
+                                 specified multiple times.
+
+  -audit-non-hmac-response-keys=<key>
+                                 A key in the response data that audit backends
+                                 will log without hashing its value. Can be
+                                 specified multiple times.
+
+  -token-type=<type>             The type of token issued by logins to an auth
+                                 backend, either "service" or "batch". Batch
+                                 tokens are not persisted to storage and cannot
+                                 be renewed or revoked.
+
 `
 	return strings.TrimSpace(helpText)
 }
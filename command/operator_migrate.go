@@ -0,0 +1,456 @@
+package command
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/errwrap"
+	"github.com/hashicorp/hcl"
+	"github.com/hashicorp/hcl/hcl/ast"
+	"github.com/hashicorp/vault/helper/logformat"
+	"github.com/hashicorp/vault/meta"
+	"github.com/hashicorp/vault/physical"
+	"github.com/hashicorp/vault/vault"
+	log "github.com/mgutz/logxi/v1"
+)
+
+const (
+	// migrationProgressPath is where the progress of an in-flight
+	// migration is checkpointed in the destination, so that a failed
+	// migration can be resumed. It is removed once the migration has
+	// been verified.
+	migrationProgressPath = "core/migration-progress"
+
+	// migrationCheckpointInterval is the number of keys copied between
+	// progress checkpoints.
+	migrationCheckpointInterval = 100
+
+	// migrationLockTimeout is how long to wait for the HA lock of a backend
+	// that no server appears to hold.
+	migrationLockTimeout = 30 * time.Second
+)
+
+// OperatorMigrateCommand is a Command that copies all data from one
+// physical backend to another.
+type OperatorMigrateCommand struct {
+	meta.Meta
+
+	logger log.Logger
+}
+
+// migratorConfig is the configuration for a storage migration.
+type migratorConfig struct {
+	StorageSource      *migratorStorage
+	StorageDestination *migratorStorage
+}
+
+// migratorStorage is a physical backend stanza in the migration
+// configuration.
+type migratorStorage struct {
+	Type   string
+	Config map[string]string
+}
+
+// migrationProgress is checkpointed in the destination while a migration
+// is running.
+type migrationProgress struct {
+	SourceType string    `json:"source_type"`
+	LastKey    string    `json:"last_key"`
+	Copied     int       `json:"copied"`
+	StartTime  time.Time `json:"start_time"`
+}
+
+func (c *OperatorMigrateCommand) Run(args []string) int {
+	var configPath string
+	var reset bool
+	flags := c.Meta.FlagSet("operator migrate", meta.FlagSetNone)
+	flags.StringVar(&configPath, "config", "", "")
+	flags.BoolVar(&reset, "reset", false, "")
+	flags.Usage = func() { c.Ui.Error(c.Help()) }
+	if err := flags.Parse(args); err != nil {
+		return 1
+	}
+
+	if configPath == "" {
+		c.Ui.Error("A configuration file must be specified with -config")
+		flags.Usage()
+		return 1
+	}
+
+	config, err := loadMigratorConfig(configPath)
+	if err != nil {
+		c.Ui.Error(fmt.Sprintf("Error loading configuration from %s: %s", configPath, err))
+		return 1
+	}
+
+	if c.logger == nil {
+		c.logger = logformat.NewVaultLoggerWithWriter(os.Stderr, log.LevelWarn)
+	}
+
+	from, err := physical.NewBackend(config.StorageSource.Type, c.logger, config.StorageSource.Config)
+	if err != nil {
+		c.Ui.Error(fmt.Sprintf(
+			"Error initializing storage source of type %s: %s",
+			config.StorageSource.Type, err))
+		return 1
+	}
+
+	to, err := physical.NewBackend(config.StorageDestination.Type, c.logger, config.StorageDestination.Config)
+	if err != nil {
+		c.Ui.Error(fmt.Sprintf(
+			"Error initializing storage destination of type %s: %s",
+			config.StorageDestination.Type, err))
+		return 1
+	}
+
+	if err := c.migrate(config, from, to, reset); err != nil {
+		c.Ui.Error(fmt.Sprintf("Error migrating storage: %s", err))
+		return 1
+	}
+
+	return 0
+}
+
+// migrate copies every key from the source to the destination and then
+// verifies that the destination matches the source.
+func (c *OperatorMigrateCommand) migrate(config *migratorConfig, from, to physical.Backend, reset bool) error {
+	// The HA locks are held until the migration is done, so that no server
+	// can become active and write to either backend in the meantime
+	srcLost, srcUnlock, err := acquireMigrationLock(from, "source")
+	if err != nil {
+		return err
+	}
+	defer srcUnlock()
+	dstLost, dstUnlock, err := acquireMigrationLock(to, "destination")
+	if err != nil {
+		return err
+	}
+	defer dstUnlock()
+
+	progress, err := loadMigrationProgress(to)
+	if err != nil {
+		return err
+	}
+	switch {
+	case progress == nil || reset:
+		progress = &migrationProgress{
+			SourceType: config.StorageSource.Type,
+			StartTime:  time.Now().UTC(),
+		}
+	case progress.SourceType != config.StorageSource.Type:
+		return fmt.Errorf(
+			"destination holds an incomplete migration from a %q source; use -reset to start over",
+			progress.SourceType)
+	default:
+		c.Ui.Output(fmt.Sprintf(
+			"Resuming migration started at %s after key %q (%d keys copied)",
+			progress.StartTime.Format(time.RFC3339), progress.LastKey, progress.Copied))
+	}
+
+	keys, err := migrationKeys(from)
+	if err != nil {
+		return errwrap.Wrapf("error listing source keys: {{err}}", err)
+	}
+
+	for i, key := range keys {
+		if progress.LastKey != "" && key <= progress.LastKey {
+			continue
+		}
+
+		select {
+		case <-srcLost:
+			return fmt.Errorf("lost the HA lock on storage source")
+		case <-dstLost:
+			return fmt.Errorf("lost the HA lock on storage destination")
+		default:
+		}
+
+		entry, err := from.Get(key)
+		if err != nil {
+			return errwrap.Wrapf(fmt.Sprintf("error reading %q from source: {{err}}", key), err)
+		}
+		if entry != nil {
+			if err := to.Put(entry); err != nil {
+				return errwrap.Wrapf(fmt.Sprintf("error writing %q to destination: {{err}}", key), err)
+			}
+		}
+
+		progress.LastKey = key
+		progress.Copied++
+		if progress.Copied%migrationCheckpointInterval == 0 || i == len(keys)-1 {
+			if err := saveMigrationProgress(to, progress); err != nil {
+				return err
+			}
+		}
+	}
+
+	c.Ui.Output(fmt.Sprintf("Copied %d keys, verifying destination", progress.Copied))
+
+	srcCount, srcSum, err := migrationChecksum(from)
+	if err != nil {
+		return errwrap.Wrapf("error checksumming source: {{err}}", err)
+	}
+	dstCount, dstSum, err := migrationChecksum(to)
+	if err != nil {
+		return errwrap.Wrapf("error checksumming destination: {{err}}", err)
+	}
+	c.Ui.Output(fmt.Sprintf("Source:      %d keys, checksum %s", srcCount, srcSum))
+	c.Ui.Output(fmt.Sprintf("Destination: %d keys, checksum %s", dstCount, dstSum))
+
+	if srcCount != dstCount {
+		return fmt.Errorf(
+			"verification failed: source has %d keys but destination has %d",
+			srcCount, dstCount)
+	}
+	if srcSum != dstSum {
+		return fmt.Errorf("verification failed: source and destination checksums differ")
+	}
+
+	if err := to.Delete(migrationProgressPath); err != nil {
+		return errwrap.Wrapf("error clearing migration progress: {{err}}", err)
+	}
+
+	c.Ui.Output("Success! Storage migration complete.")
+	return nil
+}
+
+// acquireMigrationLock takes the HA lock on the given backend, returning an
+// error if a Vault server currently holds it. It returns a channel that is
+// closed if the lock is lost and a function releasing the lock. Backends
+// without HA have no lock, and a nil channel is returned for them.
+func acquireMigrationLock(b physical.Backend, name string) (<-chan struct{}, func(), error) {
+	ha, ok := b.(physical.HABackend)
+	if !ok || !ha.HAEnabled() {
+		return nil, func() {}, nil
+	}
+
+	lock, err := ha.LockWith(vault.CoreLockPath, "migrate")
+	if err != nil {
+		return nil, nil, errwrap.Wrapf(fmt.Sprintf("error checking HA lock on storage %s: {{err}}", name), err)
+	}
+	held, leader, err := lock.Value()
+	if err != nil {
+		return nil, nil, errwrap.Wrapf(fmt.Sprintf("error checking HA lock on storage %s: {{err}}", name), err)
+	}
+	if held {
+		return nil, nil, fmt.Errorf(
+			"a Vault server (%s) holds the HA lock on the storage %s; stop all servers before migrating",
+			leader, name)
+	}
+
+	// A server may take the lock between the check and here, so don't wait
+	// on it forever
+	stopCh := make(chan struct{})
+	timer := time.AfterFunc(migrationLockTimeout, func() { close(stopCh) })
+	lostCh, err := lock.Lock(stopCh)
+	timer.Stop()
+	if err != nil {
+		return nil, nil, errwrap.Wrapf(fmt.Sprintf("error acquiring HA lock on storage %s: {{err}}", name), err)
+	}
+	if lostCh == nil {
+		return nil, nil, fmt.Errorf("timed out acquiring HA lock on storage %s", name)
+	}
+
+	return lostCh, func() { lock.Unlock() }, nil
+}
+
+// migrationKeys returns every key in the backend in sorted order, skipping
+// the HA lock and the migration's own progress checkpoint.
+func migrationKeys(b physical.Backend) ([]string, error) {
+	var keys []string
+	var walk func(prefix string) error
+	walk = func(prefix string) error {
+		children, err := b.List(prefix)
+		if err != nil {
+			return err
+		}
+		for _, child := range children {
+			key := prefix + child
+			if strings.HasSuffix(child, "/") {
+				if err := walk(key); err != nil {
+					return err
+				}
+				continue
+			}
+			if key == vault.CoreLockPath || key == migrationProgressPath {
+				continue
+			}
+			keys = append(keys, key)
+		}
+		return nil
+	}
+	if err := walk(""); err != nil {
+		return nil, err
+	}
+
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// migrationChecksum returns the number of keys in the backend along with a
+// digest over every key and value.
+func migrationChecksum(b physical.Backend) (int, string, error) {
+	keys, err := migrationKeys(b)
+	if err != nil {
+		return 0, "", err
+	}
+
+	h := sha256.New()
+	for _, key := range keys {
+		entry, err := b.Get(key)
+		if err != nil {
+			return 0, "", err
+		}
+		if entry == nil {
+			return 0, "", fmt.Errorf("key %q disappeared while verifying", key)
+		}
+		valueSum := sha256.Sum256(entry.Value)
+		h.Write([]byte(key))
+		h.Write([]byte{0})
+		h.Write(valueSum[:])
+	}
+
+	return len(keys), hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func loadMigrationProgress(b physical.Backend) (*migrationProgress, error) {
+	entry, err := b.Get(migrationProgressPath)
+	if err != nil {
+		return nil, errwrap.Wrapf("error reading migration progress: {{err}}", err)
+	}
+	if entry == nil {
+		return nil, nil
+	}
+
+	var progress migrationProgress
+	if err := json.Unmarshal(entry.Value, &progress); err != nil {
+		return nil, errwrap.Wrapf("error decoding migration progress: {{err}}", err)
+	}
+	return &progress, nil
+}
+
+func saveMigrationProgress(b physical.Backend, progress *migrationProgress) error {
+	buf, err := json.Marshal(progress)
+	if err != nil {
+		return errwrap.Wrapf("error encoding migration progress: {{err}}", err)
+	}
+	if err := b.Put(&physical.Entry{Key: migrationProgressPath, Value: buf}); err != nil {
+		return errwrap.Wrapf("error saving migration progress: {{err}}", err)
+	}
+	return nil
+}
+
+// loadMigratorConfig reads the migration configuration from the given file.
+func loadMigratorConfig(path string) (*migratorConfig, error) {
+	d, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return parseMigratorConfig(string(d))
+}
+
+func parseMigratorConfig(d string) (*migratorConfig, error) {
+	obj, err := hcl.Parse(d)
+	if err != nil {
+		return nil, err
+	}
+
+	list, ok := obj.Node.(*ast.ObjectList)
+	if !ok {
+		return nil, fmt.Errorf("error parsing: file doesn't contain a root object")
+	}
+
+	valid := []string{
+		"storage_source",
+		"storage_destination",
+	}
+	if err := checkHCLKeys(list, valid); err != nil {
+		return nil, err
+	}
+
+	var result migratorConfig
+	if result.StorageSource, err = parseMigratorStorage(list, "storage_source"); err != nil {
+		return nil, err
+	}
+	if result.StorageDestination, err = parseMigratorStorage(list, "storage_destination"); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+func parseMigratorStorage(list *ast.ObjectList, name string) (*migratorStorage, error) {
+	o := list.Filter(name)
+	if len(o.Items) == 0 {
+		return nil, fmt.Errorf("missing '%s' block", name)
+	}
+	if len(o.Items) > 1 {
+		return nil, fmt.Errorf("only one '%s' block is permitted", name)
+	}
+
+	item := o.Items[0]
+	if len(item.Keys) == 0 {
+		return nil, fmt.Errorf("'%s' block must specify a storage type", name)
+	}
+	key := item.Keys[0].Token.Value().(string)
+
+	var m map[string]string
+	if err := hcl.DecodeObject(&m, item.Val); err != nil {
+		return nil, errwrap.Wrapf(fmt.Sprintf("error parsing '%s.%s': {{err}}", name, key), err)
+	}
+
+	return &migratorStorage{
+		Type:   strings.ToLower(key),
+		Config: m,
+	}, nil
+}
+
+func (c *OperatorMigrateCommand) Synopsis() string {
+	return "Migrate Vault data between storage backends"
+}
+
+func (c *OperatorMigrateCommand) Help() string {
+	helpText := `
+Usage: vault operator migrate [options]
+
+  Copy all data from one storage backend to another.
+
+  This operates directly on the storage backends, so every key is copied,
+  including the encrypted keyring and other core/ entries. All Vault servers
+  using either backend must be stopped first; the migration refuses to run
+  while a server holds the HA lock, and holds the lock itself until it is
+  done so that no server can become active in the meantime.
+
+  Once every key has been copied, the key counts and a checksum over all
+  keys and values are compared between the source and destination.
+
+  Progress is checkpointed in the destination. If a migration fails, running
+  the same command again resumes where it left off.
+
+  The configuration file names the two backends using the same options as
+  the server's backend stanza:
+
+      storage_source "file" {
+        path = "/var/lib/vault"
+      }
+
+      storage_destination "consul" {
+        address = "127.0.0.1:8500"
+        path    = "vault"
+      }
+
+Migrate Options:
+
+  -config=<path>   Path to the migration configuration file. Required.
+
+  -reset           Ignore any saved progress in the destination and copy
+                   every key again.
+`
+	return strings.TrimSpace(helpText)
+}
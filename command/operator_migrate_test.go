@@ -0,0 +1,325 @@
+package command
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/vault/helper/logformat"
+	"github.com/hashicorp/vault/meta"
+	"github.com/hashicorp/vault/physical"
+	"github.com/hashicorp/vault/vault"
+	log "github.com/mgutz/logxi/v1"
+	"github.com/mitchellh/cli"
+)
+
+func testMigrationData() map[string]string {
+	data := map[string]string{
+		"core/keyring":        "keyring",
+		"core/master":         "master",
+		"core/mounts":         "mounts",
+		"logical/abc/foo":     "foo",
+		"logical/abc/foo/bar": "bar",
+		"sys/token/id/abcd":   "token",
+	}
+	for i := 0; i < 2*migrationCheckpointInterval+5; i++ {
+		data[fmt.Sprintf("logical/def/%04d", i)] = fmt.Sprintf("value-%d", i)
+	}
+	return data
+}
+
+func testMigrationSeed(t *testing.T, b physical.Backend, data map[string]string) {
+	for k, v := range data {
+		if err := b.Put(&physical.Entry{Key: k, Value: []byte(v)}); err != nil {
+			t.Fatalf("err: %v", err)
+		}
+	}
+}
+
+func testMigrationContents(t *testing.T, b physical.Backend) map[string]string {
+	keys, err := migrationKeys(b)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	result := make(map[string]string, len(keys))
+	for _, k := range keys {
+		entry, err := b.Get(k)
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		result[k] = string(entry.Value)
+	}
+	return result
+}
+
+// failingBackend fails every Put after the first n.
+type failingBackend struct {
+	physical.Backend
+	n int
+}
+
+func (f *failingBackend) Put(entry *physical.Entry) error {
+	if f.n <= 0 {
+		return errors.New("injected failure")
+	}
+	f.n--
+	return f.Backend.Put(entry)
+}
+
+func TestOperatorMigrate(t *testing.T) {
+	logger := logformat.NewVaultLogger(log.LevelTrace)
+
+	dir, err := ioutil.TempDir("", "vault-migrate")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	srcPath := filepath.Join(dir, "src")
+	dstPath := filepath.Join(dir, "dst")
+
+	src, err := physical.NewBackend("file", logger, map[string]string{"path": srcPath})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	data := testMigrationData()
+	testMigrationSeed(t, src, data)
+
+	configPath := filepath.Join(dir, "migrate.hcl")
+	config := fmt.Sprintf(`
+storage_source "file" {
+  path = %q
+}
+
+storage_destination "file" {
+  path = %q
+}
+`, srcPath, dstPath)
+	if err := ioutil.WriteFile(configPath, []byte(config), 0644); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	ui := new(cli.MockUi)
+	c := &OperatorMigrateCommand{
+		Meta: meta.Meta{
+			Ui: ui,
+		},
+		logger: logger,
+	}
+
+	if code := c.Run([]string{"-config", configPath}); code != 0 {
+		t.Fatalf("bad: %d\n\n%s", code, ui.ErrorWriter.String())
+	}
+	if !strings.Contains(ui.OutputWriter.String(), "Success!") {
+		t.Fatalf("bad: %s", ui.OutputWriter.String())
+	}
+
+	dst, err := physical.NewBackend("file", logger, map[string]string{"path": dstPath})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if actual := testMigrationContents(t, dst); !reflect.DeepEqual(actual, data) {
+		t.Fatalf("bad: %#v", actual)
+	}
+	if entry, err := dst.Get(migrationProgressPath); err != nil || entry != nil {
+		t.Fatalf("expected progress to be cleared: %v %v", entry, err)
+	}
+}
+
+func TestOperatorMigrate_resume(t *testing.T) {
+	logger := logformat.NewVaultLogger(log.LevelTrace)
+	config := &migratorConfig{
+		StorageSource:      &migratorStorage{Type: "inmem"},
+		StorageDestination: &migratorStorage{Type: "inmem"},
+	}
+
+	src := physical.NewInmem(logger)
+	data := testMigrationData()
+	testMigrationSeed(t, src, data)
+
+	// Fail partway through, after at least one checkpoint
+	dst := physical.NewInmem(logger)
+	ui := new(cli.MockUi)
+	c := &OperatorMigrateCommand{
+		Meta: meta.Meta{
+			Ui: ui,
+		},
+	}
+	failing := &failingBackend{Backend: dst, n: migrationCheckpointInterval + 10}
+	if err := c.migrate(config, src, failing, false); err == nil {
+		t.Fatalf("expected error")
+	}
+	progress, err := loadMigrationProgress(dst)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if progress == nil || progress.Copied != migrationCheckpointInterval {
+		t.Fatalf("bad: %#v", progress)
+	}
+
+	// A mismatched source is not resumed
+	other := &migratorConfig{
+		StorageSource:      &migratorStorage{Type: "file"},
+		StorageDestination: config.StorageDestination,
+	}
+	if err := c.migrate(other, src, dst, false); err == nil || !strings.Contains(err.Error(), "-reset") {
+		t.Fatalf("expected incomplete migration error, got: %v", err)
+	}
+
+	if err := c.migrate(config, src, dst, false); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if !strings.Contains(ui.OutputWriter.String(), "Resuming migration") {
+		t.Fatalf("bad: %s", ui.OutputWriter.String())
+	}
+	if actual := testMigrationContents(t, dst); !reflect.DeepEqual(actual, data) {
+		t.Fatalf("bad: %#v", actual)
+	}
+
+	// Verification catches keys that do not exist in the source
+	if err := dst.Put(&physical.Entry{Key: "logical/extra", Value: []byte("x")}); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if err := c.migrate(config, src, dst, false); err == nil || !strings.Contains(err.Error(), "verification failed") {
+		t.Fatalf("expected verification error, got: %v", err)
+	}
+}
+
+func TestOperatorMigrate_lockHeld(t *testing.T) {
+	logger := logformat.NewVaultLogger(log.LevelTrace)
+	config := &migratorConfig{
+		StorageSource:      &migratorStorage{Type: "inmem_ha"},
+		StorageDestination: &migratorStorage{Type: "inmem"},
+	}
+
+	src := physical.NewInmemHA(logger)
+	lock, err := src.LockWith(vault.CoreLockPath, "server")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if _, err := lock.Lock(nil); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	c := &OperatorMigrateCommand{
+		Meta: meta.Meta{
+			Ui: new(cli.MockUi),
+		},
+	}
+	err = c.migrate(config, src, physical.NewInmem(logger), false)
+	if err == nil || !strings.Contains(err.Error(), "HA lock") {
+		t.Fatalf("expected lock error, got: %v", err)
+	}
+
+	if err := lock.Unlock(); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if err := c.migrate(config, src, physical.NewInmem(logger), false); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+}
+
+// lockCheckingBackend records whether the core HA lock of ha is held when
+// keys are written to it.
+type lockCheckingBackend struct {
+	physical.Backend
+	ha       physical.HABackend
+	unlocked bool
+}
+
+func (l *lockCheckingBackend) Put(entry *physical.Entry) error {
+	lock, err := l.ha.LockWith(vault.CoreLockPath, "check")
+	if err != nil {
+		return err
+	}
+	held, _, err := lock.Value()
+	if err != nil {
+		return err
+	}
+	if !held {
+		l.unlocked = true
+	}
+	return l.Backend.Put(entry)
+}
+
+func TestOperatorMigrate_holdsLock(t *testing.T) {
+	logger := logformat.NewVaultLogger(log.LevelTrace)
+	config := &migratorConfig{
+		StorageSource:      &migratorStorage{Type: "inmem_ha"},
+		StorageDestination: &migratorStorage{Type: "inmem"},
+	}
+
+	src := physical.NewInmemHA(logger)
+	testMigrationSeed(t, src, testMigrationData())
+	dst := &lockCheckingBackend{Backend: physical.NewInmem(logger), ha: src}
+
+	c := &OperatorMigrateCommand{
+		Meta: meta.Meta{
+			Ui: new(cli.MockUi),
+		},
+	}
+	if err := c.migrate(config, src, dst, false); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if dst.unlocked {
+		t.Fatalf("HA lock was not held while copying")
+	}
+
+	// The lock is released afterwards
+	lock, err := src.LockWith(vault.CoreLockPath, "server")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	held, _, err := lock.Value()
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if held {
+		t.Fatalf("HA lock still held after migrating")
+	}
+}
+
+func TestParseMigratorConfig(t *testing.T) {
+	config, err := parseMigratorConfig(`
+storage_source "File" {
+  path = "/tmp/src"
+}
+storage_destination "consul" {
+  address = "127.0.0.1:8500"
+}
+`)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	expected := &migratorConfig{
+		StorageSource: &migratorStorage{
+			Type:   "file",
+			Config: map[string]string{"path": "/tmp/src"},
+		},
+		StorageDestination: &migratorStorage{
+			Type:   "consul",
+			Config: map[string]string{"address": "127.0.0.1:8500"},
+		},
+	}
+	if !reflect.DeepEqual(config, expected) {
+		t.Fatalf("bad: %#v", config)
+	}
+
+	for _, bad := range []string{
+		`storage_source "file" {}`,
+		`storage_source "file" {}
+storage_source "file" {}
+storage_destination "file" {}`,
+		`storage_source "file" {}
+storage_destination "file" {}
+backend "file" {}`,
+	} {
+		if _, err := parseMigratorConfig(bad); err == nil {
+			t.Fatalf("expected error parsing %q", bad)
+		}
+	}
+}
@@ -30,6 +30,7 @@ import (
 	"github.com/hashicorp/vault/helper/flag-slice"
 	"github.com/hashicorp/vault/helper/gated-writer"
 	"github.com/hashicorp/vault/helper/logformat"
+	"github.com/hashicorp/vault/helper/metricsutil"
 	"github.com/hashicorp/vault/helper/mlock"
 	vaulthttp "github.com/hashicorp/vault/http"
 	"github.com/hashicorp/vault/logical"
@@ -184,7 +185,8 @@ func (c *ServerCommand) Run(args []string) int {
 		c.Ui.Output("  Vault on an mlockall(2) enabled system is much more secure.\n")
 	}
 
-	if err := c.setupTelemetry(config); err != nil {
+	metricsHelper, err := c.setupTelemetry(config)
+	if err != nil {
 		c.Ui.Output(fmt.Sprintf("Error initializing telemetry: %s", err))
 		return 1
 	}
@@ -220,20 +222,27 @@ func (c *ServerCommand) Run(args []string) int {
 	}
 
 	coreConfig := &vault.CoreConfig{
-		Physical:           backend,
-		RedirectAddr:       config.Backend.RedirectAddr,
-		HAPhysical:         nil,
-		Seal:               seal,
-		AuditBackends:      c.AuditBackends,
-		CredentialBackends: c.CredentialBackends,
-		LogicalBackends:    c.LogicalBackends,
-		Logger:             c.logger,
-		DisableCache:       config.DisableCache,
-		DisableMlock:       config.DisableMlock,
-		MaxLeaseTTL:        config.MaxLeaseTTL,
-		DefaultLeaseTTL:    config.DefaultLeaseTTL,
-		ClusterName:        config.ClusterName,
-		CacheSize:          config.CacheSize,
+		Physical:              backend,
+		RedirectAddr:          config.Backend.RedirectAddr,
+		HAPhysical:            nil,
+		Seal:                  seal,
+		AuditBackends:         c.AuditBackends,
+		CredentialBackends:    c.CredentialBackends,
+		LogicalBackends:       c.LogicalBackends,
+		Logger:                c.logger,
+		DisableCache:          config.DisableCache,
+		DisableMlock:          config.DisableMlock,
+		MaxLeaseTTL:           config.MaxLeaseTTL,
+		DefaultLeaseTTL:       config.DefaultLeaseTTL,
+		ClusterName:           config.ClusterName,
+		CacheSize:             config.CacheSize,
+		CacheMaxBytes:         config.CacheMaxBytes,
+		CacheMaxStaleness:     config.CacheMaxStaleness,
+		CacheExcludedPrefixes: config.CacheExcludedPrefixes,
+		PerformanceStandby:    config.PerformanceStandby,
+
+		AuditRequireUnfiltered: config.AuditRequireUnfiltered,
+		MetricsHelper:          metricsHelper,
 	}
 
 	var disableClustering bool
@@ -390,6 +399,7 @@ func (c *ServerCommand) Run(args []string) int {
 	// Initialize the listeners
 	c.reloadFuncsLock.Lock()
 	lns := make([]net.Listener, 0, len(config.Listeners))
+	lnProps := make([]*vaulthttp.HandlerProperties, 0, len(config.Listeners))
 	for i, lnConfig := range config.Listeners {
 		if lnConfig.Type == "atlas" {
 			if config.ClusterName == "" {
@@ -410,6 +420,18 @@ func (c *ServerCommand) Run(args []string) int {
 
 		lns = append(lns, ln)
 
+		handlerProps := &vaulthttp.HandlerProperties{}
+		if raw, ok := lnConfig.Config["unauthenticated_metrics_access"]; ok {
+			handlerProps.UnauthenticatedMetricsAccess, err = strconv.ParseBool(raw)
+			if err != nil {
+				c.Ui.Output(fmt.Sprintf(
+					"Error parsing unauthenticated_metrics_access for listener of type %s: %s",
+					lnConfig.Type, err))
+				return 1
+			}
+		}
+		lnProps = append(lnProps, handlerProps)
+
 		if reloadFunc != nil {
 			relSlice := (*c.reloadFuncs)["listener|"+lnConfig.Type]
 			relSlice = append(relSlice, reloadFunc)
@@ -572,11 +594,19 @@ func (c *ServerCommand) Run(args []string) int {
 		))
 	}
 
-	// Initialize the HTTP server
+	// Initialize the HTTP servers, giving listeners with their own settings
+	// a handler of their own
 	server := &http.Server{}
 	server.Handler = handler
-	for _, ln := range lns {
-		go server.Serve(ln)
+	for i, ln := range lns {
+		if *lnProps[i] == (vaulthttp.HandlerProperties{}) {
+			go server.Serve(ln)
+			continue
+		}
+		lnServer := &http.Server{
+			Handler: vaulthttp.HandlerWithProperties(core, lnProps[i]),
+		}
+		go lnServer.Serve(ln)
 	}
 
 	if newCoreError != nil {
@@ -787,8 +817,9 @@ func (c *ServerCommand) detectRedirect(detect physical.RedirectDetect,
 	return url.String(), nil
 }
 
-// setupTelemetry is used to setup the telemetry sub-systems
-func (c *ServerCommand) setupTelemetry(config *server.Config) error {
+// setupTelemetry is used to setup the telemetry sub-systems and returns the
+// helper used to serve the metrics kept in memory
+func (c *ServerCommand) setupTelemetry(config *server.Config) (*metricsutil.MetricsHelper, error) {
 	/* Setup telemetry
 	Aggregate on 10 second intervals for 1 minute. Expose the
 	metrics over stderr when there is a SIGUSR1 received.
@@ -811,7 +842,7 @@ func (c *ServerCommand) setupTelemetry(config *server.Config) error {
 	if telConfig.StatsiteAddr != "" {
 		sink, err := metrics.NewStatsiteSink(telConfig.StatsiteAddr)
 		if err != nil {
-			return err
+			return nil, err
 		}
 		fanout = append(fanout, sink)
 	}
@@ -820,7 +851,7 @@ func (c *ServerCommand) setupTelemetry(config *server.Config) error {
 	if telConfig.StatsdAddr != "" {
 		sink, err := metrics.NewStatsdSink(telConfig.StatsdAddr)
 		if err != nil {
-			return err
+			return nil, err
 		}
 		fanout = append(fanout, sink)
 	}
@@ -852,12 +883,26 @@ func (c *ServerCommand) setupTelemetry(config *server.Config) error {
 
 		sink, err := circonus.NewCirconusSink(cfg)
 		if err != nil {
-			return err
+			return nil, err
 		}
 		sink.Start()
 		fanout = append(fanout, sink)
 	}
 
+	// Configure the Prometheus sink
+	var prometheusSink *metricsutil.PrometheusSink
+	if telConfig.PrometheusRetentionTime > 0 {
+		node, err := os.Hostname()
+		if err != nil {
+			return nil, err
+		}
+		if metricsConf.EnableHostname {
+			metricsConf.HostName = node
+		}
+		prometheusSink = metricsutil.NewPrometheusSink(metricsConf.ServiceName, node, telConfig.PrometheusRetentionTime)
+		fanout = append(fanout, prometheusSink)
+	}
+
 	// Initialize the global sink
 	if len(fanout) > 0 {
 		fanout = append(fanout, inm)
@@ -866,7 +911,7 @@ func (c *ServerCommand) setupTelemetry(config *server.Config) error {
 		metricsConf.EnableHostname = false
 		metrics.NewGlobal(metricsConf, inm)
 	}
-	return nil
+	return metricsutil.NewMetricsHelper(inm, prometheusSink), nil
 }
 
 func (c *ServerCommand) Reload(configPath []string) error {
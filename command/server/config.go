@@ -27,6 +27,11 @@ type Config struct {
 	DisableCache bool `hcl:"disable_cache"`
 	DisableMlock bool `hcl:"disable_mlock"`
 
+	CacheMaxBytes         int           `hcl:"cache_max_bytes"`
+	CacheMaxStaleness     time.Duration `hcl:"-"`
+	CacheMaxStalenessRaw  string        `hcl:"cache_max_staleness"`
+	CacheExcludedPrefixes []string      `hcl:"cache_excluded_prefixes"`
+
 	Telemetry *Telemetry `hcl:"telemetry"`
 
 	MaxLeaseTTL        time.Duration `hcl:"-"`
@@ -35,6 +40,10 @@ type Config struct {
 	DefaultLeaseTTLRaw string        `hcl:"default_lease_ttl"`
 
 	ClusterName string `hcl:"cluster_name"`
+
+	PerformanceStandby bool `hcl:"performance_standby"`
+
+	AuditRequireUnfiltered bool `hcl:"audit_require_unfiltered"`
 }
 
 // DevConfig is a Config that is used for dev mode of Vault.
@@ -100,6 +109,12 @@ type Telemetry struct {
 
 	DisableHostname bool `hcl:"disable_hostname"`
 
+	// PrometheusRetentionTime is how long metrics are kept for serving in
+	// the Prometheus format after they were last updated. Prometheus metrics
+	// are disabled if it is zero.
+	PrometheusRetentionTime    time.Duration `hcl:"-"`
+	PrometheusRetentionTimeRaw string        `hcl:"prometheus_retention_time"`
+
 	// Circonus: see https://github.com/circonus-labs/circonus-gometrics
 	// for more details on the various configuration options.
 	// Valid configuration combinations:
@@ -210,6 +225,19 @@ func (c *Config) Merge(c2 *Config) *Config {
 		result.CacheSize = c2.CacheSize
 	}
 
+	result.CacheMaxBytes = c.CacheMaxBytes
+	if c2.CacheMaxBytes != 0 {
+		result.CacheMaxBytes = c2.CacheMaxBytes
+	}
+
+	result.CacheMaxStaleness = c.CacheMaxStaleness
+	if c2.CacheMaxStaleness != 0 {
+		result.CacheMaxStaleness = c2.CacheMaxStaleness
+	}
+
+	result.CacheExcludedPrefixes = append(result.CacheExcludedPrefixes, c.CacheExcludedPrefixes...)
+	result.CacheExcludedPrefixes = append(result.CacheExcludedPrefixes, c2.CacheExcludedPrefixes...)
+
 	// merging these booleans via an OR operation
 	result.DisableCache = c.DisableCache
 	if c2.DisableCache {
@@ -237,6 +265,16 @@ func (c *Config) Merge(c2 *Config) *Config {
 		result.ClusterName = c2.ClusterName
 	}
 
+	result.PerformanceStandby = c.PerformanceStandby
+	if c2.PerformanceStandby {
+		result.PerformanceStandby = c2.PerformanceStandby
+	}
+
+	result.AuditRequireUnfiltered = c.AuditRequireUnfiltered
+	if c2.AuditRequireUnfiltered {
+		result.AuditRequireUnfiltered = c2.AuditRequireUnfiltered
+	}
+
 	return result
 }
 
@@ -288,6 +326,11 @@ func ParseConfig(d string, logger log.Logger) (*Config, error) {
 			return nil, err
 		}
 	}
+	if result.CacheMaxStalenessRaw != "" {
+		if result.CacheMaxStaleness, err = time.ParseDuration(result.CacheMaxStalenessRaw); err != nil {
+			return nil, err
+		}
+	}
 
 	list, ok := obj.Node.(*ast.ObjectList)
 	if !ok {
@@ -300,12 +343,17 @@ func ParseConfig(d string, logger log.Logger) (*Config, error) {
 		"ha_backend",
 		"listener",
 		"cache_size",
+		"cache_max_bytes",
+		"cache_max_staleness",
+		"cache_excluded_prefixes",
 		"disable_cache",
 		"disable_mlock",
 		"telemetry",
 		"default_lease_ttl",
 		"max_lease_ttl",
 		"cluster_name",
+		"performance_standby",
+		"audit_require_unfiltered",
 	}
 	if err := checkHCLKeys(list, valid); err != nil {
 		return nil, err
@@ -546,6 +594,7 @@ func parseListeners(result *Config, list *ast.ObjectList) error {
 			"tls_key_file",
 			"tls_min_version",
 			"token",
+			"unauthenticated_metrics_access",
 		}
 		if err := checkHCLKeys(item.Val, valid); err != nil {
 			return multierror.Prefix(err, fmt.Sprintf("listeners.%s:", key))
@@ -609,6 +658,7 @@ func parseTelemetry(result *Config, list *ast.ObjectList) error {
 		"circonus_broker_id",
 		"circonus_broker_select_tag",
 		"disable_hostname",
+		"prometheus_retention_time",
 		"statsd_address",
 		"statsite_address",
 	}
@@ -628,6 +678,13 @@ func parseTelemetry(result *Config, list *ast.ObjectList) error {
 	if err := hcl.DecodeObject(&result.Telemetry, item.Val); err != nil {
 		return multierror.Prefix(err, "telemetry:")
 	}
+
+	if result.Telemetry.PrometheusRetentionTimeRaw != "" {
+		var err error
+		if result.Telemetry.PrometheusRetentionTime, err = time.ParseDuration(result.Telemetry.PrometheusRetentionTimeRaw); err != nil {
+			return multierror.Prefix(err, "telemetry:")
+		}
+	}
 	return nil
 }
 
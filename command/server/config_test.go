@@ -32,7 +32,8 @@ func TestLoadConfigFile(t *testing.T) {
 			&Listener{
 				Type: "tcp",
 				Config: map[string]string{
-					"address": "127.0.0.1:443",
+					"address":                        "127.0.0.1:443",
+					"unauthenticated_metrics_access": "true",
 				},
 			},
 		},
@@ -55,9 +56,11 @@ func TestLoadConfigFile(t *testing.T) {
 		},
 
 		Telemetry: &Telemetry{
-			StatsdAddr:      "bar",
-			StatsiteAddr:    "foo",
-			DisableHostname: false,
+			StatsdAddr:                 "bar",
+			StatsiteAddr:               "foo",
+			DisableHostname:            false,
+			PrometheusRetentionTime:    30 * time.Second,
+			PrometheusRetentionTimeRaw: "30s",
 		},
 
 		DisableCache: true,
@@ -68,6 +71,7 @@ func TestLoadConfigFile(t *testing.T) {
 		DefaultLeaseTTL:    10 * time.Hour,
 		DefaultLeaseTTLRaw: "10h",
 		ClusterName:        "testcluster",
+		PerformanceStandby: true,
 	}
 	if !reflect.DeepEqual(config, expected) {
 		t.Fatalf("expected \n\n%#v\n\n to be \n\n%#v\n\n", config, expected)
@@ -178,7 +182,13 @@ func TestLoadConfigFile_json2(t *testing.T) {
 			},
 		},
 
-		CacheSize: 45678,
+		CacheSize:             45678,
+		CacheMaxBytes:         1048576,
+		CacheMaxStaleness:     5 * time.Second,
+		CacheMaxStalenessRaw:  "5s",
+		CacheExcludedPrefixes: []string{"sys/expire/"},
+
+		AuditRequireUnfiltered: true,
 
 		Telemetry: &Telemetry{
 			StatsiteAddr:                       "foo",
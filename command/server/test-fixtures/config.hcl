@@ -10,6 +10,7 @@ listener "atlas" {
 
 listener "tcp" {
     address = "127.0.0.1:443"
+    unauthenticated_metrics_access = "true"
 }
 
 backend "consul" {
@@ -26,8 +27,10 @@ ha_backend "consul" {
 telemetry {
     statsd_address = "bar"
     statsite_address = "foo"
+    prometheus_retention_time = "30s"
 }
 
 max_lease_ttl = "10h"
 default_lease_ttl = "10h"
 cluster_name = "testcluster"
+performance_standby = true
@@ -17,11 +17,11 @@ type TokenCreateCommand struct {
 
 func (c *TokenCreateCommand) Run(args []string) int {
 	var format string
-	var id, displayName, lease, ttl, explicitMaxTTL, period, role string
+	var id, displayName, lease, ttl, explicitMaxTTL, period, role, tokenType string
 	var orphan, noDefaultPolicy, renewable bool
 	var metadata map[string]string
 	var numUses int
-	var policies []string
+	var policies, boundCIDRs []string
 	flags := c.Meta.FlagSet("mount", meta.FlagSetDefault)
 	flags.StringVar(&format, "format", "table", "")
 	flags.StringVar(&displayName, "display-name", "", "")
@@ -31,12 +31,14 @@ func (c *TokenCreateCommand) Run(args []string) int {
 	flags.StringVar(&explicitMaxTTL, "explicit-max-ttl", "", "")
 	flags.StringVar(&period, "period", "", "")
 	flags.StringVar(&role, "role", "", "")
+	flags.StringVar(&tokenType, "type", "", "")
 	flags.BoolVar(&orphan, "orphan", false, "")
 	flags.BoolVar(&renewable, "renewable", true, "")
 	flags.BoolVar(&noDefaultPolicy, "no-default-policy", false, "")
 	flags.IntVar(&numUses, "use-limit", 0, "")
 	flags.Var((*kvFlag.Flag)(&metadata), "metadata", "")
 	flags.Var((*sliceflag.StringFlag)(&policies), "policy", "")
+	flags.Var((*sliceflag.StringFlag)(&boundCIDRs), "bound-cidr", "")
 	flags.Usage = func() { c.Ui.Error(c.Help()) }
 	if err := flags.Parse(args); err != nil {
 		return 1
@@ -73,6 +75,8 @@ func (c *TokenCreateCommand) Run(args []string) int {
 		Renewable:       new(bool),
 		ExplicitMaxTTL:  explicitMaxTTL,
 		Period:          period,
+		Type:            tokenType,
+		BoundCIDRs:      boundCIDRs,
 	}
 	*tcr.Renewable = renewable
 
@@ -164,6 +168,12 @@ Token Options:
   -use-limit=5            The number of times this token can be used until
                           it is automatically revoked.
 
+  -bound-cidr="10.0.0.0/8"
+                          A CIDR block the token can be used from. This can
+                          be specified multiple times. If not specified, the
+                          token can be used from any address unless the role
+                          restricts it.
+
   -format=table           The format for output. By default it is a whitespace-
                           delimited table. This can also be json or yaml.
 
@@ -171,6 +181,12 @@ Token Options:
                           role. The role may override other parameters. This
                           requires the client to have permissions on the
                           appropriate endpoint (auth/token/create/<name>).
+
+  -type=service           The type of token to create, either "service" or
+                          "batch". Batch tokens are not persisted to storage
+                          and cannot be renewed, revoked or used to create
+                          child tokens. If not set, the role's token type or
+                          "service" is used.
 `
 	return strings.TrimSpace(helpText)
 }
@@ -53,6 +53,8 @@ func PrintRawField(ui cli.Ui, secret *api.Secret, field string) int {
 		switch field {
 		case "wrapping_token":
 			val = secret.WrapInfo.Token
+		case "wrapping_accessor":
+			val = secret.WrapInfo.Accessor
 		case "wrapping_token_ttl":
 			val = secret.WrapInfo.TTL
 		case "wrapping_token_creation_time":
@@ -0,0 +1,104 @@
+// Package dhutil provides a curve25519 Diffie-Hellman exchange and AES-GCM
+// encryption with the resulting key, so that a value can be encrypted for
+// the holder of a private key without sharing a secret ahead of time.
+package dhutil
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+
+	"golang.org/x/crypto/curve25519"
+	"golang.org/x/crypto/hkdf"
+)
+
+// PublicKeyInfo is the JSON document holding the public key values are
+// encrypted for
+type PublicKeyInfo struct {
+	Curve25519PublicKey []byte `json:"curve25519_public_key"`
+}
+
+// Envelope is the JSON document holding an encrypted value along with the
+// public key of the sender, needed to derive the key to decrypt it
+type Envelope struct {
+	Curve25519PublicKey []byte `json:"curve25519_public_key"`
+	Nonce               []byte `json:"nonce"`
+	EncryptedPayload    []byte `json:"encrypted_payload"`
+}
+
+// GeneratePublicPrivateKey generates a curve25519 key pair, returning the
+// public key first
+func GeneratePublicPrivateKey() ([]byte, []byte, error) {
+	var scalar, public [32]byte
+
+	if _, err := io.ReadFull(rand.Reader, scalar[:]); err != nil {
+		return nil, nil, err
+	}
+
+	curve25519.ScalarBaseMult(&public, &scalar)
+	return public[:], scalar[:], nil
+}
+
+// GenerateSharedKey derives the AES-256 key shared by the holders of the
+// given private key and of the private key of the given public key
+func GenerateSharedKey(ourPrivate, theirPublic []byte) ([]byte, error) {
+	if len(ourPrivate) != 32 {
+		return nil, fmt.Errorf("invalid private key length: %d", len(ourPrivate))
+	}
+	if len(theirPublic) != 32 {
+		return nil, fmt.Errorf("invalid public key length: %d", len(theirPublic))
+	}
+
+	var scalar, pub, secret [32]byte
+	copy(scalar[:], ourPrivate)
+	copy(pub[:], theirPublic)
+	curve25519.ScalarMult(&secret, &scalar, &pub)
+
+	key := make([]byte, 32)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, secret[:], nil, nil), key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// EncryptAES encrypts the plaintext with AES-GCM, returning the ciphertext
+// and the nonce it was encrypted with
+func EncryptAES(key, plaintext, aad []byte) ([]byte, []byte, error) {
+	aesGCM, err := newGCM(key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	nonce := make([]byte, aesGCM.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, nil, err
+	}
+
+	return aesGCM.Seal(nil, nonce, plaintext, aad), nonce, nil
+}
+
+// DecryptAES decrypts a ciphertext produced by EncryptAES
+func DecryptAES(key, ciphertext, nonce, aad []byte) ([]byte, error) {
+	aesGCM, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(nonce) != aesGCM.NonceSize() {
+		return nil, errors.New("invalid nonce length")
+	}
+
+	return aesGCM.Open(nil, nonce, ciphertext, aad)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
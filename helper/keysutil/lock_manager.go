@@ -312,6 +312,18 @@ func (lm *LockManager) getPolicyCommon(req PolicyRequest, lockType bool) (*Polic
 	return p, lock, false, nil
 }
 
+// InvalidatePolicy drops the named policy from the cache so that it is read
+// from storage the next time it is used
+func (lm *LockManager) InvalidatePolicy(name string) {
+	if !lm.CacheActive() {
+		return
+	}
+
+	lm.cacheMutex.Lock()
+	defer lm.cacheMutex.Unlock()
+	delete(lm.cache, name)
+}
+
 func (lm *LockManager) DeletePolicy(storage logical.Storage, name string) error {
 	lm.cacheMutex.Lock()
 	lock := lm.policyLock(name, exclusive)
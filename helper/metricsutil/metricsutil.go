@@ -0,0 +1,121 @@
+package metricsutil
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/armon/go-metrics"
+	"github.com/hashicorp/vault/logical"
+)
+
+const (
+	// FormatJSON returns the most recent interval of the in-memory sink
+	FormatJSON = "json"
+
+	// FormatPrometheus returns the Prometheus sink in the text exposition
+	// format
+	FormatPrometheus = "prometheus"
+
+	// PrometheusContentType is the content type of the text exposition
+	// format
+	PrometheusContentType = "text/plain; version=0.0.4"
+)
+
+// MetricsHelper serves the metrics kept in memory by the server in the
+// supported formats
+type MetricsHelper struct {
+	inmemSink      *metrics.InmemSink
+	prometheusSink *PrometheusSink
+}
+
+// NewMetricsHelper returns a helper for the given sinks. The Prometheus sink
+// may be nil if Prometheus metrics are not enabled.
+func NewMetricsHelper(inmem *metrics.InmemSink, prometheus *PrometheusSink) *MetricsHelper {
+	return &MetricsHelper{
+		inmemSink:      inmem,
+		prometheusSink: prometheus,
+	}
+}
+
+// PrometheusEnabled returns whether metrics can be served in the Prometheus
+// format
+func (m *MetricsHelper) PrometheusEnabled() bool {
+	return m != nil && m.prometheusSink != nil
+}
+
+// ResponseForFormat returns the metrics in the given format. An empty format
+// is taken to be JSON.
+func (m *MetricsHelper) ResponseForFormat(format string) (*logical.Response, error) {
+	switch format {
+	case "", FormatJSON:
+		return m.jsonResponse(), nil
+
+	case FormatPrometheus:
+		if !m.PrometheusEnabled() {
+			return logical.ErrorResponse("prometheus metrics are not enabled; set prometheus_retention_time in the telemetry configuration"), nil
+		}
+
+		var buf bytes.Buffer
+		m.prometheusSink.WritePrometheus(&buf)
+		return &logical.Response{
+			Data: map[string]interface{}{
+				logical.HTTPContentType: PrometheusContentType,
+				logical.HTTPRawBody:     buf.Bytes(),
+				logical.HTTPStatusCode:  http.StatusOK,
+			},
+		}, nil
+
+	default:
+		return logical.ErrorResponse(fmt.Sprintf("unknown metrics format %q", format)), nil
+	}
+}
+
+// jsonResponse summarizes the most recent interval of the in-memory sink
+func (m *MetricsHelper) jsonResponse() *logical.Response {
+	gauges := map[string]interface{}{}
+	counters := map[string]interface{}{}
+	samples := map[string]interface{}{}
+	var timestamp string
+
+	if m != nil && m.inmemSink != nil {
+		data := m.inmemSink.Data()
+		if len(data) > 0 {
+			intv := data[len(data)-1]
+			intv.RLock()
+			timestamp = intv.Interval.UTC().Format(time.RFC3339)
+			for name, value := range intv.Gauges {
+				gauges[name] = value
+			}
+			for name, agg := range intv.Counters {
+				counters[name] = aggregateSummary(agg)
+			}
+			for name, agg := range intv.Samples {
+				samples[name] = aggregateSummary(agg)
+			}
+			intv.RUnlock()
+		}
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"timestamp": timestamp,
+			"gauges":    gauges,
+			"counters":  counters,
+			"samples":   samples,
+		},
+	}
+}
+
+func aggregateSummary(agg *metrics.AggregateSample) map[string]interface{} {
+	return map[string]interface{}{
+		"count":  agg.Count,
+		"rate":   agg.Rate,
+		"sum":    agg.Sum,
+		"min":    agg.Min,
+		"max":    agg.Max,
+		"mean":   agg.Mean(),
+		"stddev": agg.Stddev(),
+	}
+}
@@ -0,0 +1,72 @@
+package metricsutil
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/armon/go-metrics"
+	"github.com/hashicorp/vault/logical"
+)
+
+func TestMetricsHelper_ResponseForFormat(t *testing.T) {
+	inm := metrics.NewInmemSink(10*time.Second, time.Minute)
+	inm.SetGauge([]string{"vault", "expire", "num_leases"}, 2)
+	inm.IncrCounter([]string{"vault", "audit", "file/", "filtered"}, 1)
+	inm.AddSample([]string{"vault", "core", "handle_request"}, 5)
+
+	helper := NewMetricsHelper(inm, nil)
+
+	for _, format := range []string{"", FormatJSON} {
+		resp, err := helper.ResponseForFormat(format)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.IsError() {
+			t.Fatalf("bad: %#v", resp)
+		}
+		if resp.Data["gauges"].(map[string]interface{})["vault.expire.num_leases"] != float32(2) {
+			t.Fatalf("bad: %#v", resp.Data)
+		}
+		counter := resp.Data["counters"].(map[string]interface{})["vault.audit.file/.filtered"].(map[string]interface{})
+		if counter["count"] != 1 {
+			t.Fatalf("bad: %#v", counter)
+		}
+		sample := resp.Data["samples"].(map[string]interface{})["vault.core.handle_request"].(map[string]interface{})
+		if sample["mean"] != float64(5) {
+			t.Fatalf("bad: %#v", sample)
+		}
+	}
+
+	// Prometheus must be enabled
+	resp, err := helper.ResponseForFormat(FormatPrometheus)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !resp.IsError() {
+		t.Fatalf("expected error: %#v", resp)
+	}
+
+	resp, err = helper.ResponseForFormat("xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !resp.IsError() {
+		t.Fatalf("expected error: %#v", resp)
+	}
+
+	prom := NewPrometheusSink("vault", "node1", time.Hour)
+	prom.SetGauge([]string{"vault", "expire", "num_leases"}, 2)
+	helper = NewMetricsHelper(inm, prom)
+	resp, err = helper.ResponseForFormat(FormatPrometheus)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Data[logical.HTTPContentType] != PrometheusContentType {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+	body := string(resp.Data[logical.HTTPRawBody].([]byte))
+	if !strings.Contains(body, `vault_expire_num_leases{node="node1"} 2`) {
+		t.Fatalf("bad: %s", body)
+	}
+}
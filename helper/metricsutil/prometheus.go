@@ -0,0 +1,250 @@
+package metricsutil
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	prometheusGauge   = "gauge"
+	prometheusCounter = "counter"
+	prometheusSummary = "summary"
+)
+
+// labelRule turns a metric key into a Prometheus metric name and labels.
+// Parts of the key given as a label name are removed from the name and
+// attached as labels instead; the other parts must match exactly.
+type labelRule []string
+
+// prometheusLabelRules are checked in order against each key, after the
+// service name and hostname have been removed from it
+var prometheusLabelRules = []labelRule{
+	{"route", ":operation", ":mount"},
+	{"rollback", "attempt", ":mount"},
+	{"expire", "revoke", "failure", ":mount"},
+	{"audit", ":mount", "log_request"},
+	{"audit", ":mount", "log_response"},
+	{"audit", ":mount", "filtered"},
+	{"quota", "rate_limit", ":name", "violation"},
+}
+
+// match returns the name parts and labels of a key if it matches the rule
+func (r labelRule) match(key []string) ([]string, map[string]string, bool) {
+	if len(key) != len(r) {
+		return nil, nil, false
+	}
+
+	var name []string
+	labels := make(map[string]string)
+	for i, part := range r {
+		switch {
+		case strings.HasPrefix(part, ":"):
+			labels[part[1:]] = key[i]
+		case part == key[i]:
+			name = append(name, part)
+		default:
+			return nil, nil, false
+		}
+	}
+	return name, labels, true
+}
+
+// prometheusSeries is a single series of a metric, identified by its name
+// and labels
+type prometheusSeries struct {
+	name    string
+	kind    string
+	labels  string
+	value   float64
+	count   uint64
+	updated time.Time
+}
+
+// prometheusSeriesSorter sorts series by name and then labels, so that the
+// series of each metric are written together
+type prometheusSeriesSorter []*prometheusSeries
+
+func (s prometheusSeriesSorter) Len() int      { return len(s) }
+func (s prometheusSeriesSorter) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s prometheusSeriesSorter) Less(i, j int) bool {
+	if s[i].name != s[j].name {
+		return s[i].name < s[j].name
+	}
+	return s[i].labels < s[j].labels
+}
+
+// PrometheusSink is a go-metrics sink that keeps the values needed to serve
+// metrics in the Prometheus text format. Unlike the in-memory sink, which
+// aggregates over short intervals, counters and samples are accumulated for
+// as long as they keep being updated. Series that are not updated within
+// the retention time are dropped.
+type PrometheusSink struct {
+	serviceName string
+	node        string
+	retention   time.Duration
+
+	l      sync.Mutex
+	series map[string]*prometheusSeries
+}
+
+// NewPrometheusSink returns a sink for metrics whose keys are prefixed with
+// the given service name. All series are labelled with the given node name.
+func NewPrometheusSink(serviceName, node string, retention time.Duration) *PrometheusSink {
+	return &PrometheusSink{
+		serviceName: serviceName,
+		node:        node,
+		retention:   retention,
+		series:      make(map[string]*prometheusSeries),
+	}
+}
+
+func (p *PrometheusSink) SetGauge(key []string, val float32) {
+	p.update(prometheusGauge, key, func(s *prometheusSeries) {
+		s.value = float64(val)
+	})
+}
+
+func (p *PrometheusSink) EmitKey(key []string, val float32) {
+	p.AddSample(key, val)
+}
+
+func (p *PrometheusSink) IncrCounter(key []string, val float32) {
+	p.update(prometheusCounter, key, func(s *prometheusSeries) {
+		s.value += float64(val)
+	})
+}
+
+func (p *PrometheusSink) AddSample(key []string, val float32) {
+	p.update(prometheusSummary, key, func(s *prometheusSeries) {
+		s.value += float64(val)
+		s.count++
+	})
+}
+
+// update applies a change to the series for a key, creating it if needed
+func (p *PrometheusSink) update(kind string, key []string, f func(*prometheusSeries)) {
+	name, labels := p.nameAndLabels(key)
+	id := kind + " " + name + labels
+
+	p.l.Lock()
+	defer p.l.Unlock()
+
+	s, ok := p.series[id]
+	if !ok {
+		s = &prometheusSeries{
+			name:   name,
+			kind:   kind,
+			labels: labels,
+		}
+		p.series[id] = s
+	}
+	f(s)
+	s.updated = time.Now()
+}
+
+// nameAndLabels converts a key into a metric name and its rendered labels
+func (p *PrometheusSink) nameAndLabels(key []string) (string, string) {
+	prefix := []string{}
+	if len(key) > 0 && p.serviceName != "" && key[0] == p.serviceName {
+		prefix = append(prefix, key[0])
+		key = key[1:]
+	}
+
+	// Gauges have the hostname inserted after the service name, which is
+	// given as a label instead
+	if len(key) > 0 && p.node != "" && key[0] == p.node {
+		key = key[1:]
+	}
+
+	parts := key
+	labels := map[string]string{}
+	for _, rule := range prometheusLabelRules {
+		if name, ruleLabels, ok := rule.match(key); ok {
+			parts = name
+			labels = ruleLabels
+			break
+		}
+	}
+	if p.node != "" {
+		labels["node"] = p.node
+	}
+
+	return sanitizePrometheusName(strings.Join(append(prefix, parts...), "_")), renderPrometheusLabels(labels)
+}
+
+// WritePrometheus writes the current metrics in the Prometheus text format,
+// dropping any series that have expired
+func (p *PrometheusSink) WritePrometheus(buf *bytes.Buffer) {
+	p.l.Lock()
+	var series []*prometheusSeries
+	for id, s := range p.series {
+		if p.retention > 0 && time.Since(s.updated) > p.retention {
+			delete(p.series, id)
+			continue
+		}
+		copied := *s
+		series = append(series, &copied)
+	}
+	p.l.Unlock()
+
+	sort.Sort(prometheusSeriesSorter(series))
+
+	var last string
+	for _, s := range series {
+		if s.name != last {
+			fmt.Fprintf(buf, "# TYPE %s %s\n", s.name, s.kind)
+			last = s.name
+		}
+
+		switch s.kind {
+		case prometheusSummary:
+			fmt.Fprintf(buf, "%s_sum%s %s\n", s.name, s.labels, formatPrometheusValue(s.value))
+			fmt.Fprintf(buf, "%s_count%s %d\n", s.name, s.labels, s.count)
+		default:
+			fmt.Fprintf(buf, "%s%s %s\n", s.name, s.labels, formatPrometheusValue(s.value))
+		}
+	}
+}
+
+// sanitizePrometheusName replaces characters that are not allowed in
+// Prometheus metric names
+func sanitizePrometheusName(name string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '_', r == ':':
+			return r
+		default:
+			return '_'
+		}
+	}, name)
+}
+
+// renderPrometheusLabels renders labels sorted by name, escaping their
+// values
+func renderPrometheusLabels(labels map[string]string) string {
+	if len(labels) == 0 {
+		return ""
+	}
+
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	escaper := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	rendered := make([]string, 0, len(names))
+	for _, name := range names {
+		rendered = append(rendered, fmt.Sprintf(`%s="%s"`, name, escaper.Replace(labels[name])))
+	}
+	return "{" + strings.Join(rendered, ",") + "}"
+}
+
+func formatPrometheusValue(value float64) string {
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
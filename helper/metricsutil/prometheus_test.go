@@ -0,0 +1,69 @@
+package metricsutil
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPrometheusSink(t *testing.T) {
+	sink := NewPrometheusSink("vault", "node1", time.Hour)
+
+	sink.AddSample([]string{"vault", "route", "read", "secret-"}, 2)
+	sink.AddSample([]string{"vault", "route", "read", "secret-"}, 3)
+	sink.AddSample([]string{"vault", "route", "update", "transit-"}, 1.5)
+	sink.IncrCounter([]string{"vault", "audit", "file/", "filtered"}, 1)
+	sink.IncrCounter([]string{"vault", "audit", "file/", "filtered"}, 1)
+	sink.SetGauge([]string{"vault", "node1", "expire", "num_leases"}, 3)
+	sink.SetGauge([]string{"vault", "node1", "expire", "num_leases"}, 4)
+	sink.AddSample([]string{"vault", "token", "revoke-tree"}, 1)
+
+	var buf bytes.Buffer
+	sink.WritePrometheus(&buf)
+
+	expected := strings.TrimLeft(`
+# TYPE vault_audit_filtered counter
+vault_audit_filtered{mount="file/",node="node1"} 2
+# TYPE vault_expire_num_leases gauge
+vault_expire_num_leases{node="node1"} 4
+# TYPE vault_route summary
+vault_route_sum{mount="secret-",node="node1",operation="read"} 5
+vault_route_count{mount="secret-",node="node1",operation="read"} 2
+vault_route_sum{mount="transit-",node="node1",operation="update"} 1.5
+vault_route_count{mount="transit-",node="node1",operation="update"} 1
+# TYPE vault_token_revoke_tree summary
+vault_token_revoke_tree_sum{node="node1"} 1
+vault_token_revoke_tree_count{node="node1"} 1
+`, "\n")
+	if buf.String() != expected {
+		t.Fatalf("bad:\n%s\nexpected:\n%s", buf.String(), expected)
+	}
+}
+
+func TestPrometheusSink_retention(t *testing.T) {
+	sink := NewPrometheusSink("vault", "node1", 50*time.Millisecond)
+	sink.IncrCounter([]string{"vault", "old"}, 1)
+	time.Sleep(100 * time.Millisecond)
+	sink.IncrCounter([]string{"vault", "new"}, 1)
+
+	var buf bytes.Buffer
+	sink.WritePrometheus(&buf)
+	if strings.Contains(buf.String(), "vault_old") || !strings.Contains(buf.String(), "vault_new") {
+		t.Fatalf("bad: %s", buf.String())
+	}
+	if len(sink.series) != 1 {
+		t.Fatalf("bad: %#v", sink.series)
+	}
+}
+
+func TestPrometheusSink_labelEscaping(t *testing.T) {
+	sink := NewPrometheusSink("vault", "", 0)
+	sink.AddSample([]string{"vault", "route", "read", `a"b\c`}, 1)
+
+	var buf bytes.Buffer
+	sink.WritePrometheus(&buf)
+	if !strings.Contains(buf.String(), `vault_route_sum{mount="a\"b\\c",operation="read"} 1`) {
+		t.Fatalf("bad: %s", buf.String())
+	}
+}
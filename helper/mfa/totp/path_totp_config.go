@@ -0,0 +1,163 @@
+package totp
+
+import (
+	"github.com/hashicorp/vault/helper/otputil"
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+)
+
+func pathTOTPConfig() *framework.Path {
+	return &framework.Path{
+		Pattern: `totp/config`,
+		Fields: map[string]*framework.FieldSchema{
+			"issuer": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Default:     "Vault",
+				Description: "Issuer shown by authenticator apps for enrolled keys (default \"Vault\")",
+			},
+			"period": &framework.FieldSchema{
+				Type:        framework.TypeInt,
+				Default:     30,
+				Description: "Number of seconds a passcode of enrolled keys is valid for (default 30)",
+			},
+			"digits": &framework.FieldSchema{
+				Type:        framework.TypeInt,
+				Default:     6,
+				Description: "Number of digits in passcodes of enrolled keys, 6 or 8 (default 6)",
+			},
+			"algorithm": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Default:     "SHA1",
+				Description: "Hash algorithm of enrolled keys: SHA1, SHA256 or SHA512 (default SHA1)",
+			},
+			"skew": &framework.FieldSchema{
+				Type:        framework.TypeInt,
+				Default:     1,
+				Description: "Number of periods before or after the current one whose passcodes are accepted (default 1)",
+			},
+			"qr_size": &framework.FieldSchema{
+				Type:        framework.TypeInt,
+				Default:     200,
+				Description: "Pixel size of the QR code returned on enrollment, 0 to disable (default 200)",
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.UpdateOperation: pathTOTPConfigWrite,
+			logical.ReadOperation:   pathTOTPConfigRead,
+		},
+
+		HelpSynopsis:    pathTOTPConfigHelpSyn,
+		HelpDescription: pathTOTPConfigHelpDesc,
+	}
+}
+
+func GetTOTPConfig(req *logical.Request) (*TOTPConfig, error) {
+	// all config parameters are optional, so path need not exist
+	result := TOTPConfig{
+		Issuer:    "Vault",
+		Period:    30,
+		Digits:    6,
+		Algorithm: "SHA1",
+		Skew:      1,
+		QRSize:    200,
+	}
+	entry, err := req.Storage.Get("totp/config")
+	if err != nil {
+		return nil, err
+	}
+	if entry != nil {
+		if err := entry.DecodeJSON(&result); err != nil {
+			return nil, err
+		}
+	}
+	return &result, nil
+}
+
+func pathTOTPConfigWrite(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	config := TOTPConfig{
+		Issuer:    d.Get("issuer").(string),
+		Algorithm: d.Get("algorithm").(string),
+	}
+
+	period := d.Get("period").(int)
+	if period <= 0 {
+		return logical.ErrorResponse("period must be greater than 0"), nil
+	}
+	config.Period = uint(period)
+
+	config.Digits = d.Get("digits").(int)
+	if config.Digits != 6 && config.Digits != 8 {
+		return logical.ErrorResponse("digits must be 6 or 8"), nil
+	}
+
+	if _, err := otputil.ParseAlgorithm(config.Algorithm); err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+
+	skew := d.Get("skew").(int)
+	if skew < 0 {
+		return logical.ErrorResponse("skew cannot be negative"), nil
+	}
+	config.Skew = uint(skew)
+
+	config.QRSize = d.Get("qr_size").(int)
+	if config.QRSize < 0 {
+		return logical.ErrorResponse("qr_size cannot be negative"), nil
+	}
+
+	if config.Issuer == "" {
+		return logical.ErrorResponse("issuer cannot be empty"), nil
+	}
+
+	entry, err := logical.StorageEntryJSON("totp/config", config)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := req.Storage.Put(entry); err != nil {
+		return nil, err
+	}
+
+	return nil, nil
+}
+
+func pathTOTPConfigRead(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+
+	config, err := GetTOTPConfig(req)
+	if err != nil {
+		return nil, err
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"issuer":    config.Issuer,
+			"period":    config.Period,
+			"digits":    config.Digits,
+			"algorithm": config.Algorithm,
+			"skew":      config.Skew,
+			"qr_size":   config.QRSize,
+		},
+	}, nil
+}
+
+type TOTPConfig struct {
+	Issuer    string `json:"issuer"`
+	Period    uint   `json:"period"`
+	Digits    int    `json:"digits"`
+	Algorithm string `json:"algorithm"`
+	Skew      uint   `json:"skew"`
+	QRSize    int    `json:"qr_size"`
+}
+
+const pathTOTPConfigHelpSyn = `
+Configure TOTP second factor behavior.
+`
+
+const pathTOTPConfigHelpDesc = `
+This endpoint allows you to configure the keys enrolled through "totp/keys",
+and how many periods of clock skew are tolerated when validating passcodes.
+Changes to the key parameters only apply to keys enrolled afterwards.
+`
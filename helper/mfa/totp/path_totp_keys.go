@@ -0,0 +1,205 @@
+package totp
+
+import (
+	"bytes"
+	"encoding/base64"
+	"image/png"
+	"strings"
+
+	"github.com/hashicorp/vault/helper/otputil"
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+	"github.com/pquerna/otp"
+	"github.com/pquerna/otp/totp"
+)
+
+func pathTOTPKeysList() *framework.Path {
+	return &framework.Path{
+		Pattern: `totp/keys/?$`,
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ListOperation: pathTOTPKeysListRead,
+		},
+
+		HelpSynopsis:    pathTOTPKeysHelpSyn,
+		HelpDescription: pathTOTPKeysHelpDesc,
+	}
+}
+
+func pathTOTPKeys() *framework.Path {
+	return &framework.Path{
+		Pattern: `totp/keys/(?P<username>.+)`,
+		Fields: map[string]*framework.FieldSchema{
+			"username": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Auth backend username to enroll a TOTP key for",
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.UpdateOperation: pathTOTPKeysWrite,
+			logical.ReadOperation:   pathTOTPKeysRead,
+			logical.DeleteOperation: pathTOTPKeysDelete,
+		},
+
+		HelpSynopsis:    pathTOTPKeysHelpSyn,
+		HelpDescription: pathTOTPKeysHelpDesc,
+	}
+}
+
+// Usernames are stored lowercased, as auth backends such as userpass
+// lowercase the username they log in with.
+func getTOTPKey(req *logical.Request, username string) (*TOTPKey, error) {
+	entry, err := req.Storage.Get("totp/keys/" + strings.ToLower(username))
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, nil
+	}
+	var result TOTPKey
+	if err := entry.DecodeJSON(&result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+func putTOTPKey(req *logical.Request, username string, key *TOTPKey) error {
+	entry, err := logical.StorageEntryJSON("totp/keys/"+strings.ToLower(username), key)
+	if err != nil {
+		return err
+	}
+	return req.Storage.Put(entry)
+}
+
+func pathTOTPKeysListRead(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	usernames, err := req.Storage.List("totp/keys/")
+	if err != nil {
+		return nil, err
+	}
+	return logical.ListResponse(usernames), nil
+}
+
+// pathTOTPKeysWrite enrolls a new key for the user, replacing any existing
+// one. The key is only ever returned here, as an otpauth:// URL and as a
+// base64 encoded PNG of its QR code.
+func pathTOTPKeysWrite(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	username := d.Get("username").(string)
+
+	config, err := GetTOTPConfig(req)
+	if err != nil {
+		return nil, err
+	}
+	algorithm, err := otputil.ParseAlgorithm(config.Algorithm)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := totp.Generate(totp.GenerateOpts{
+		Issuer:      config.Issuer,
+		AccountName: username,
+		Period:      config.Period,
+		Digits:      otp.Digits(config.Digits),
+		Algorithm:   algorithm,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := putTOTPKey(req, username, &TOTPKey{
+		URL:       key.String(),
+		Secret:    key.Secret(),
+		Period:    config.Period,
+		Digits:    config.Digits,
+		Algorithm: config.Algorithm,
+	}); err != nil {
+		return nil, err
+	}
+
+	resp := &logical.Response{
+		Data: map[string]interface{}{
+			"url": key.String(),
+		},
+	}
+	if config.QRSize > 0 {
+		img, err := key.Image(config.QRSize, config.QRSize)
+		if err != nil {
+			return nil, err
+		}
+		var buf bytes.Buffer
+		if err := png.Encode(&buf, img); err != nil {
+			return nil, err
+		}
+		resp.Data["barcode"] = base64.StdEncoding.EncodeToString(buf.Bytes())
+	}
+	return resp, nil
+}
+
+func pathTOTPKeysRead(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	key, err := getTOTPKey(req, d.Get("username").(string))
+	if err != nil {
+		return nil, err
+	}
+	if key == nil {
+		return nil, nil
+	}
+
+	otpKey, err := otp.NewKeyFromURL(key.URL)
+	if err != nil {
+		return nil, err
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"issuer":       otpKey.Issuer(),
+			"account_name": otpKey.AccountName(),
+			"period":       key.Period,
+			"digits":       key.Digits,
+			"algorithm":    key.Algorithm,
+		},
+	}, nil
+}
+
+func pathTOTPKeysDelete(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	if err := req.Storage.Delete("totp/keys/" + strings.ToLower(d.Get("username").(string))); err != nil {
+		return nil, err
+	}
+	return nil, nil
+}
+
+// TOTPKey is the key enrolled for a user. LastCounter is the time step of
+// the last passcode used to log in, which cannot be used again.
+type TOTPKey struct {
+	URL         string `json:"url"`
+	Secret      string `json:"secret"`
+	Period      uint   `json:"period"`
+	Digits      int    `json:"digits"`
+	Algorithm   string `json:"algorithm"`
+	LastCounter uint64 `json:"last_counter"`
+}
+
+func (k *TOTPKey) digits() otp.Digits {
+	return otp.Digits(k.Digits)
+}
+
+func (k *TOTPKey) algorithm() otp.Algorithm {
+	// The algorithm was validated when the key was enrolled
+	algorithm, _ := otputil.ParseAlgorithm(k.Algorithm)
+	return algorithm
+}
+
+const pathTOTPKeysHelpSyn = `
+Enroll TOTP keys for users.
+`
+
+const pathTOTPKeysHelpDesc = `
+Writing to "totp/keys/<username>" generates a new TOTP key for the user,
+replacing any existing one, and returns it as an otpauth:// URL along with
+a base64 encoded PNG of its QR code, to be imported into an authenticator
+app. The key cannot be retrieved afterwards. Reading the path returns the
+parameters of the key, and deleting it removes the key.
+`
@@ -0,0 +1,98 @@
+// Package totp provides a TOTP MFA handler to authenticate users
+// with time-based one-time passcodes. This handler is registered as
+// the "totp" type in mfa_config.
+package totp
+
+import (
+	"sync"
+	"time"
+
+	"github.com/hashicorp/vault/helper/otputil"
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+	"github.com/pquerna/otp/hotp"
+)
+
+// keyLock serializes validating a passcode and recording its use, so that
+// concurrent logins cannot use the same passcode twice.
+var keyLock sync.Mutex
+
+// TOTPPaths returns path functions to configure TOTP.
+func TOTPPaths() []*framework.Path {
+	return []*framework.Path{
+		pathTOTPConfig(),
+		pathTOTPKeysList(),
+		pathTOTPKeys(),
+	}
+}
+
+// TOTPRootPaths returns the paths that are used to configure TOTP.
+func TOTPRootPaths() []string {
+	return []string{
+		"totp/config",
+		"totp/keys",
+		"totp/keys/*",
+	}
+}
+
+// TOTPHandler validates the passcode of a login request against the
+// TOTP key enrolled for the user. If successful, the original response
+// from the login backend is returned.
+func TOTPHandler(req *logical.Request, d *framework.FieldData, resp *logical.Response) (
+	*logical.Response, error) {
+	totpConfig, err := GetTOTPConfig(req)
+	if err != nil || totpConfig == nil {
+		return logical.ErrorResponse("Could not load TOTP configuration"), nil
+	}
+
+	username, ok := resp.Auth.Metadata["username"]
+	if !ok {
+		return logical.ErrorResponse("Could not read username for MFA"), nil
+	}
+
+	passcode := d.Get("passcode").(string)
+	if passcode == "" {
+		return logical.ErrorResponse("Missing TOTP passcode"), nil
+	}
+
+	return totpHandler(req, totpConfig, username, passcode, time.Now(), resp)
+}
+
+func totpHandler(req *logical.Request, totpConfig *TOTPConfig, username, passcode string,
+	now time.Time, successResp *logical.Response) (*logical.Response, error) {
+	keyLock.Lock()
+	defer keyLock.Unlock()
+
+	key, err := getTOTPKey(req, username)
+	if err != nil {
+		return nil, err
+	}
+	if key == nil {
+		return logical.ErrorResponse("No TOTP key enrolled for user"), nil
+	}
+
+	counter, ok := key.validate(passcode, now, totpConfig.Skew)
+	if !ok {
+		return logical.ErrorResponse("Invalid TOTP passcode"), nil
+	}
+
+	// A passcode, or one of an earlier time step, may only be used once
+	if counter <= key.LastCounter {
+		return logical.ErrorResponse("TOTP passcode has already been used"), nil
+	}
+	key.LastCounter = counter
+	if err := putTOTPKey(req, username, key); err != nil {
+		return nil, err
+	}
+
+	return successResp, nil
+}
+
+// validate returns the time step counter matching the passcode, allowing
+// the given number of time steps of skew either way.
+func (k *TOTPKey) validate(passcode string, now time.Time, skew uint) (uint64, bool) {
+	return otputil.ValidatePasscode(passcode, k.Secret, now, k.Period, skew, hotp.ValidateOpts{
+		Digits:    k.digits(),
+		Algorithm: k.algorithm(),
+	})
+}
@@ -0,0 +1,179 @@
+package totp
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+	"github.com/pquerna/otp"
+	"github.com/pquerna/otp/totp"
+)
+
+func testTOTPRequest(t *testing.T, storage logical.Storage, path *framework.Path,
+	op logical.Operation, data map[string]interface{}) *logical.Response {
+	d := &framework.FieldData{
+		Raw:    data,
+		Schema: path.Fields,
+	}
+	resp, err := path.Callbacks[op](&logical.Request{Storage: storage}, d)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if resp != nil && resp.IsError() {
+		t.Fatalf("bad: %#v", resp)
+	}
+	return resp
+}
+
+func TestTOTPEnroll(t *testing.T) {
+	storage := &logical.InmemStorage{}
+
+	testTOTPRequest(t, storage, pathTOTPConfig(), logical.UpdateOperation, map[string]interface{}{
+		"issuer": "Example",
+		"digits": 8,
+	})
+
+	resp := testTOTPRequest(t, storage, pathTOTPKeys(), logical.UpdateOperation, map[string]interface{}{
+		"username": "user",
+	})
+	url := resp.Data["url"].(string)
+	if !strings.HasPrefix(url, "otpauth://totp/Example:user?") || !strings.Contains(url, "digits=8") {
+		t.Fatalf("bad: %s", url)
+	}
+	barcode, err := base64.StdEncoding.DecodeString(resp.Data["barcode"].(string))
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if !strings.HasPrefix(string(barcode), "\x89PNG") {
+		t.Fatalf("barcode is not a PNG")
+	}
+
+	// The secret is not returned after enrollment
+	resp = testTOTPRequest(t, storage, pathTOTPKeys(), logical.ReadOperation, map[string]interface{}{
+		"username": "user",
+	})
+	if resp.Data["account_name"] != "user" || resp.Data["digits"] != 8 {
+		t.Fatalf("bad: %#v", resp)
+	}
+	if _, ok := resp.Data["url"]; ok {
+		t.Fatalf("bad: %#v", resp)
+	}
+
+	resp = testTOTPRequest(t, storage, pathTOTPKeysList(), logical.ListOperation, nil)
+	if keys := resp.Data["keys"].([]string); len(keys) != 1 || keys[0] != "user" {
+		t.Fatalf("bad: %#v", resp)
+	}
+}
+
+func TestTOTPHandler(t *testing.T) {
+	storage := &logical.InmemStorage{}
+	req := &logical.Request{Storage: storage}
+	successResp := &logical.Response{
+		Auth: &logical.Auth{},
+	}
+
+	config, err := GetTOTPConfig(req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	resp, err := totpHandler(req, config, "user", "123456", time.Now(), successResp)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if resp == successResp {
+		t.Fatalf("expected error without enrolled key")
+	}
+
+	testTOTPRequest(t, storage, pathTOTPKeys(), logical.UpdateOperation, map[string]interface{}{
+		"username": "user",
+	})
+	key, err := getTOTPKey(req, "user")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	now := time.Now()
+	passcode := func(t *testing.T, ts time.Time) string {
+		code, err := totp.GenerateCodeCustom(key.Secret, ts, totp.ValidateOpts{
+			Digits: otp.DigitsSix,
+		})
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		return code
+	}
+
+	testCases := []struct {
+		name     string
+		passcode string
+		success  bool
+	}{
+		{"wrong passcode", "000000", false},
+		{"wrong length", "1234", false},
+		{"outside skew", passcode(t, now.Add(-2*time.Minute)), false},
+		{"within skew", passcode(t, now.Add(-30*time.Second)), true},
+		{"current", passcode(t, now), true},
+		{"replayed", passcode(t, now), false},
+		{"earlier than last used", passcode(t, now.Add(-30*time.Second)), false},
+	}
+	for _, tc := range testCases {
+		resp, err := totpHandler(req, config, "user", tc.passcode, now, successResp)
+		if err != nil {
+			t.Fatalf("%s: err: %v", tc.name, err)
+		}
+		if (resp == successResp) != tc.success {
+			t.Fatalf("%s: bad: %#v", tc.name, resp)
+		}
+	}
+}
+
+func TestTOTPHandler_username(t *testing.T) {
+	storage := &logical.InmemStorage{}
+	req := &logical.Request{Storage: storage}
+	successResp := &logical.Response{
+		Auth: &logical.Auth{},
+	}
+
+	config, err := GetTOTPConfig(req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	// Userpass logs Alice in as "alice"
+	testTOTPRequest(t, storage, pathTOTPKeys(), logical.UpdateOperation, map[string]interface{}{
+		"username": "Alice",
+	})
+	key, err := getTOTPKey(req, "alice")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if key == nil {
+		t.Fatalf("missing key")
+	}
+
+	now := time.Now()
+	code, err := totp.GenerateCodeCustom(key.Secret, now, totp.ValidateOpts{
+		Digits: otp.DigitsSix,
+	})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	resp, err := totpHandler(req, config, "alice", code, now, successResp)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if resp != successResp {
+		t.Fatalf("bad: %#v", resp)
+	}
+
+	testTOTPRequest(t, storage, pathTOTPKeys(), logical.DeleteOperation, map[string]interface{}{
+		"username": "ALICE",
+	})
+	if key, err := getTOTPKey(req, "alice"); err != nil || key != nil {
+		t.Fatalf("expected key to be deleted: %v %#v", err, key)
+	}
+}
@@ -0,0 +1,51 @@
+// Package otputil contains the helpers shared by the TOTP backend and the
+// TOTP MFA handler to validate time-based one-time passcodes.
+package otputil
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/pquerna/otp"
+	"github.com/pquerna/otp/hotp"
+)
+
+// ParseAlgorithm returns the hash algorithm of the given name.
+func ParseAlgorithm(algorithm string) (otp.Algorithm, error) {
+	switch algorithm {
+	case "SHA1":
+		return otp.AlgorithmSHA1, nil
+	case "SHA256":
+		return otp.AlgorithmSHA256, nil
+	case "SHA512":
+		return otp.AlgorithmSHA512, nil
+	default:
+		return 0, fmt.Errorf("unsupported algorithm %q", algorithm)
+	}
+}
+
+// ValidatePasscode returns the time step counter matching the passcode,
+// allowing the given number of time steps of skew either way. Callers
+// record the counter so that a passcode can't be used twice.
+func ValidatePasscode(passcode, secret string, now time.Time, period, skew uint, opts hotp.ValidateOpts) (uint64, bool) {
+	if period == 0 {
+		period = 30
+	}
+
+	counter := uint64(now.Unix()) / uint64(period)
+	counters := []uint64{counter}
+	for i := uint64(1); i <= uint64(skew); i++ {
+		counters = append(counters, counter+i)
+		if counter >= i {
+			counters = append(counters, counter-i)
+		}
+	}
+
+	for _, c := range counters {
+		// Passcodes of the wrong length are reported as errors
+		if ok, err := hotp.ValidateCustom(passcode, c, secret, opts); err == nil && ok {
+			return c, true
+		}
+	}
+	return 0, false
+}
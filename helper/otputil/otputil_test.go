@@ -0,0 +1,56 @@
+package otputil
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pquerna/otp"
+	"github.com/pquerna/otp/hotp"
+)
+
+func TestParseAlgorithm(t *testing.T) {
+	for name, expected := range map[string]otp.Algorithm{
+		"SHA1":   otp.AlgorithmSHA1,
+		"SHA256": otp.AlgorithmSHA256,
+		"SHA512": otp.AlgorithmSHA512,
+	} {
+		algorithm, err := ParseAlgorithm(name)
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		if algorithm != expected {
+			t.Fatalf("bad: %s: %v", name, algorithm)
+		}
+	}
+
+	if _, err := ParseAlgorithm("MD5"); err == nil {
+		t.Fatalf("expected error")
+	}
+}
+
+func TestValidatePasscode(t *testing.T) {
+	secret := "JBSWY3DPEHPK3PXP"
+	opts := hotp.ValidateOpts{
+		Digits:    otp.DigitsSix,
+		Algorithm: otp.AlgorithmSHA1,
+	}
+	now := time.Unix(3000, 0)
+
+	// The passcode of the previous time step is accepted within the skew
+	passcode, err := hotp.GenerateCodeCustom(secret, 99, opts)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	counter, ok := ValidatePasscode(passcode, secret, now, 30, 1, opts)
+	if !ok || counter != 99 {
+		t.Fatalf("bad: %d %v", counter, ok)
+	}
+	if _, ok := ValidatePasscode(passcode, secret, now, 30, 0, opts); ok {
+		t.Fatalf("passcode should be outside of the skew")
+	}
+
+	// Passcodes of the wrong length are invalid
+	if _, ok := ValidatePasscode("123", secret, now, 30, 1, opts); ok {
+		t.Fatalf("passcode should be invalid")
+	}
+}
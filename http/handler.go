@@ -1,15 +1,20 @@
 package http
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"io"
+	"io/ioutil"
+	"math"
 	"net/http"
 	"net/url"
+	"strconv"
 	"strings"
 
 	"github.com/hashicorp/errwrap"
 	"github.com/hashicorp/vault/helper/duration"
+	"github.com/hashicorp/vault/helper/forwarding"
 	"github.com/hashicorp/vault/helper/jsonutil"
 	"github.com/hashicorp/vault/logical"
 	"github.com/hashicorp/vault/vault"
@@ -27,6 +32,10 @@ const (
 	// not to use request forwarding
 	NoRequestForwardingHeaderName = "X-Vault-No-Request-Forwarding"
 
+	// NamespaceHeaderName is the name of the header containing the namespace
+	// that request paths are relative to
+	NamespaceHeaderName = "X-Vault-Namespace"
+
 	// MaxRequestSize is the maximum accepted request size. This is to prevent
 	// a denial of service attack where no Content-Length is provided and the server
 	// is fed ever more data until it exhausts memory.
@@ -36,6 +45,19 @@ const (
 // Handler returns an http.Handler for the API. This can be used on
 // its own to mount the Vault API within another web server.
 func Handler(core *vault.Core) http.Handler {
+	return HandlerWithProperties(core, &HandlerProperties{})
+}
+
+// HandlerProperties holds the listener specific settings of a handler
+type HandlerProperties struct {
+	// UnauthenticatedMetricsAccess allows sys/metrics to be read without a
+	// token
+	UnauthenticatedMetricsAccess bool
+}
+
+// HandlerWithProperties returns an http.Handler for the API configured with
+// the settings of a particular listener
+func HandlerWithProperties(core *vault.Core, props *HandlerProperties) http.Handler {
 	// Create the muxer to handle the actual endpoints
 	mux := http.NewServeMux()
 	mux.Handle("/v1/sys/init", handleSysInit(core))
@@ -47,6 +69,9 @@ func Handler(core *vault.Core) http.Handler {
 	mux.Handle("/v1/sys/renew/", handleRequestForwarding(core, handleLogical(core, false, nil)))
 	mux.Handle("/v1/sys/leader", handleSysLeader(core))
 	mux.Handle("/v1/sys/health", handleSysHealth(core))
+	mux.Handle("/v1/sys/replication/status", handleSysReplicationStatus(core))
+	mux.Handle("/v1/sys/replication/dr/secondary/promote", handleSysReplicationDRSecondary(core, core.PromoteDRSecondary))
+	mux.Handle("/v1/sys/replication/dr/secondary/reindex", handleSysReplicationDRSecondary(core, core.ReindexDRSecondary))
 	mux.Handle("/v1/sys/generate-root/attempt", handleRequestForwarding(core, handleSysGenerateRootAttempt(core)))
 	mux.Handle("/v1/sys/generate-root/update", handleRequestForwarding(core, handleSysGenerateRootUpdate(core)))
 	mux.Handle("/v1/sys/rekey/init", handleRequestForwarding(core, handleSysRekeyInit(core, false)))
@@ -56,16 +81,21 @@ func Handler(core *vault.Core) http.Handler {
 	mux.Handle("/v1/sys/wrapping/lookup", handleRequestForwarding(core, handleLogical(core, false, wrappingVerificationFunc)))
 	mux.Handle("/v1/sys/wrapping/rewrap", handleRequestForwarding(core, handleLogical(core, false, wrappingVerificationFunc)))
 	mux.Handle("/v1/sys/wrapping/unwrap", handleRequestForwarding(core, handleLogical(core, false, wrappingVerificationFunc)))
+	mux.Handle("/v1/sys/metrics", handleSysMetrics(core, props))
 	mux.Handle("/v1/sys/capabilities-self", handleRequestForwarding(core, handleLogical(core, true, nil)))
-	mux.Handle("/v1/sys/", handleRequestForwarding(core, handleLogical(core, true, nil)))
-	mux.Handle("/v1/", handleRequestForwarding(core, handleLogical(core, false, nil)))
+	mux.Handle("/v1/sys/", handlePerformanceStandby(core, handleLogical(core, true, nil)))
+	mux.Handle("/v1/", handlePerformanceStandby(core, handleLogical(core, false, nil)))
 
 	// Wrap the handler in another handler to trigger all help paths.
 	helpWrappedHandler := wrapHelpHandler(mux, core)
 
-	// Wrap the help wrapped handler with another layer with a generic
+	// Wrap the help wrapped handler so that rate limit quotas apply to all
+	// requests, including help requests
+	quotaWrappedHandler := wrapQuotaHandler(helpWrappedHandler, core)
+
+	// Wrap the quota wrapped handler with another layer with a generic
 	// handler
-	genericWrappedHandler := wrapGenericHandler(helpWrappedHandler)
+	genericWrappedHandler := wrapGenericHandler(quotaWrappedHandler)
 
 	return genericWrappedHandler
 }
@@ -83,6 +113,42 @@ func wrapGenericHandler(h http.Handler) http.Handler {
 	})
 }
 
+// wrapQuotaHandler wraps the handler with a layer that rejects requests that
+// exceed a rate limit quota, before they are forwarded or handled.
+func wrapQuotaHandler(h http.Handler, core *vault.Core) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path, ok := stripPrefix("/v1/", r.URL.Path)
+		if !ok {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		allowed, retryAfter := core.ApplyRateLimitQuota(&vault.QuotaRequest{
+			Path:          namespacedPath(r, path),
+			ClientToken:   r.Header.Get(AuthHeaderName),
+			ClientAddress: getConnection(r).RemoteAddr,
+		})
+		if !allowed {
+			seconds := int(math.Ceil(retryAfter.Seconds()))
+			w.Header().Set("Retry-After", strconv.Itoa(seconds))
+			respondError(w, http.StatusTooManyRequests, fmt.Errorf("rate limit quota exceeded"))
+			return
+		}
+
+		h.ServeHTTP(w, r)
+		return
+	})
+}
+
+// namespacedPath returns the path of a request made within the namespace
+// given by the namespace header, which is relative to the namespace's path
+func namespacedPath(r *http.Request, path string) string {
+	if ns := strings.Trim(r.Header.Get(NamespaceHeaderName), "/"); ns != "" {
+		return ns + "/" + path
+	}
+	return path
+}
+
 // A lookup on a token that is about to expire returns nil, which means by the
 // time we can validate a wrapping token lookup will return nil since it will
 // be revoked after the call. So we have to do the validation here.
@@ -211,11 +277,64 @@ func handleRequestForwarding(core *vault.Core, handler http.Handler) http.Handle
 	})
 }
 
+// perfStandbyResponseWriter buffers the response to a request that a
+// performance standby attempts to serve locally, so that it can be thrown
+// away if the request has to be forwarded to the active node after all
+type perfStandbyResponseWriter struct {
+	*forwarding.RPCResponseWriter
+	forward bool
+}
+
+// handlePerformanceStandby serves requests locally when the core is a
+// performance standby, falling back on request forwarding for anything the
+// standby cannot handle itself
+func handlePerformanceStandby(core *vault.Core, handler http.Handler) http.Handler {
+	forwardingHandler := handleRequestForwarding(core, handler)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !core.PerformanceStandby() {
+			forwardingHandler.ServeHTTP(w, r)
+			return
+		}
+
+		// The body may need to be sent on to the active node, so buffer it
+		body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, MaxRequestSize))
+		if err != nil {
+			respondError(w, http.StatusBadRequest, err)
+			return
+		}
+		r.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+		sw := &perfStandbyResponseWriter{
+			RPCResponseWriter: forwarding.NewRPCResponseWriter(),
+		}
+		handler.ServeHTTP(sw, r)
+
+		if sw.forward {
+			r.Body = ioutil.NopCloser(bytes.NewReader(body))
+			forwardingHandler.ServeHTTP(w, r)
+			return
+		}
+
+		for k, v := range sw.Header() {
+			for _, j := range v {
+				w.Header().Add(k, j)
+			}
+		}
+		w.WriteHeader(sw.StatusCode())
+		w.Write(sw.Body().Bytes())
+	})
+}
+
 // request is a helper to perform a request and properly exit in the
 // case of an error.
 func request(core *vault.Core, w http.ResponseWriter, rawReq *http.Request, r *logical.Request) (*logical.Response, bool) {
 	resp, err := core.HandleRequest(r)
 	if errwrap.Contains(err, vault.ErrStandby.Error()) {
+		// A performance standby hands the request on to the active node
+		if sw, ok := w.(*perfStandbyResponseWriter); ok {
+			sw.forward = true
+			return resp, false
+		}
 		respondStandby(core, w, rawReq.URL)
 		return resp, false
 	}
@@ -360,6 +479,8 @@ func respondErrorCommon(w http.ResponseWriter, resp *logical.Response, err error
 			statusCode = http.StatusBadRequest
 		case errwrap.Contains(err, logical.ErrPermissionDenied.Error()):
 			statusCode = http.StatusForbidden
+		case errwrap.Contains(err, vault.ErrControlGroupNotAuthorized.Error()):
+			statusCode = http.StatusForbidden
 		case errwrap.Contains(err, logical.ErrUnsupportedOperation.Error()):
 			statusCode = http.StatusMethodNotAllowed
 		case errwrap.Contains(err, logical.ErrUnsupportedPath.Error()):
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"encoding/json"
 	"io"
+	"net/http"
 	"reflect"
 	"strconv"
 	"testing"
@@ -144,6 +145,7 @@ func TestLogical_StandbyRedirect(t *testing.T) {
 			"ttl":              json.Number("0"),
 			"creation_ttl":     json.Number("0"),
 			"explicit_max_ttl": json.Number("0"),
+			"type":             "service",
 		},
 		"warnings":  nilWarnings,
 		"wrap_info": nil,
@@ -244,3 +246,33 @@ func TestLogical_RequestSizeLimit(t *testing.T) {
 	})
 	testResponseStatus(t, resp, 413)
 }
+
+func TestLogical_NamespaceHeader(t *testing.T) {
+	core, _, token := vault.TestCoreUnsealed(t)
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+	TestServerAuth(t, addr, token)
+
+	resp := testHttpPut(t, token, addr+"/v1/sys/namespaces/team1", nil)
+	testResponseStatus(t, resp, 200)
+
+	// Paths are relative to the namespace given in the header
+	req, err := http.NewRequest("PUT", addr+"/v1/sys/mounts/secret", bytes.NewBufferString(`{"type":"generic"}`))
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	req.Header.Set(AuthHeaderName, token)
+	req.Header.Set(NamespaceHeaderName, "/team1/")
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	testResponseStatus(t, resp, 204)
+
+	resp = testHttpPut(t, token, addr+"/v1/team1/secret/foo", map[string]interface{}{
+		"data": "bar",
+	})
+	testResponseStatus(t, resp, 204)
+	resp = testHttpGet(t, token, addr+"/v1/secret/foo")
+	testResponseStatus(t, resp, 404)
+}
@@ -104,6 +104,7 @@ func getSysHealth(core *vault.Core, r *http.Request) (int, *HealthResponse, erro
 	// Check system status
 	sealed, _ := core.Sealed()
 	standby, _ := core.Standby()
+	perfStandby := core.PerformanceStandby()
 	init, err := core.Initialized()
 	if err != nil {
 		return http.StatusInternalServerError, nil, err
@@ -136,23 +137,25 @@ func getSysHealth(core *vault.Core, r *http.Request) (int, *HealthResponse, erro
 
 	// Format the body
 	body := &HealthResponse{
-		Initialized:   init,
-		Sealed:        sealed,
-		Standby:       standby,
-		ServerTimeUTC: time.Now().UTC().Unix(),
-		Version:       version.GetVersion().VersionNumber(),
-		ClusterName:   clusterName,
-		ClusterID:     clusterID,
+		Initialized:        init,
+		Sealed:             sealed,
+		Standby:            standby,
+		PerformanceStandby: perfStandby,
+		ServerTimeUTC:      time.Now().UTC().Unix(),
+		Version:            version.GetVersion().VersionNumber(),
+		ClusterName:        clusterName,
+		ClusterID:          clusterID,
 	}
 	return code, body, nil
 }
 
 type HealthResponse struct {
-	Initialized   bool   `json:"initialized"`
-	Sealed        bool   `json:"sealed"`
-	Standby       bool   `json:"standby"`
-	ServerTimeUTC int64  `json:"server_time_utc"`
-	Version       string `json:"version"`
-	ClusterName   string `json:"cluster_name,omitempty"`
-	ClusterID     string `json:"cluster_id,omitempty"`
+	Initialized        bool   `json:"initialized"`
+	Sealed             bool   `json:"sealed"`
+	Standby            bool   `json:"standby"`
+	PerformanceStandby bool   `json:"performance_standby"`
+	ServerTimeUTC      int64  `json:"server_time_utc"`
+	Version            string `json:"version"`
+	ClusterName        string `json:"cluster_name,omitempty"`
+	ClusterID          string `json:"cluster_id,omitempty"`
 }
@@ -23,9 +23,10 @@ func TestSysHealth_get(t *testing.T) {
 
 	var actual map[string]interface{}
 	expected := map[string]interface{}{
-		"initialized": false,
-		"sealed":      true,
-		"standby":     true,
+		"initialized":         false,
+		"sealed":              true,
+		"standby":             true,
+		"performance_standby": false,
 	}
 	testResponseStatus(t, resp, 501)
 	testResponseBody(t, resp, &actual)
@@ -53,9 +54,10 @@ func TestSysHealth_get(t *testing.T) {
 
 	actual = map[string]interface{}{}
 	expected = map[string]interface{}{
-		"initialized": true,
-		"sealed":      true,
-		"standby":     true,
+		"initialized":         true,
+		"sealed":              true,
+		"standby":             true,
+		"performance_standby": false,
 	}
 	testResponseStatus(t, resp, 503)
 	testResponseBody(t, resp, &actual)
@@ -85,9 +87,10 @@ func TestSysHealth_get(t *testing.T) {
 
 	actual = map[string]interface{}{}
 	expected = map[string]interface{}{
-		"initialized": true,
-		"sealed":      false,
-		"standby":     false,
+		"initialized":         true,
+		"sealed":              false,
+		"standby":             false,
+		"performance_standby": false,
 	}
 	testResponseStatus(t, resp, 200)
 	testResponseBody(t, resp, &actual)
@@ -125,9 +128,10 @@ func TestSysHealth_customcodes(t *testing.T) {
 
 	var actual map[string]interface{}
 	expected := map[string]interface{}{
-		"initialized": false,
-		"sealed":      true,
-		"standby":     true,
+		"initialized":         false,
+		"sealed":              true,
+		"standby":             true,
+		"performance_standby": false,
 	}
 	testResponseStatus(t, resp, 581)
 	testResponseBody(t, resp, &actual)
@@ -156,9 +160,10 @@ func TestSysHealth_customcodes(t *testing.T) {
 
 	actual = map[string]interface{}{}
 	expected = map[string]interface{}{
-		"initialized": true,
-		"sealed":      true,
-		"standby":     true,
+		"initialized":         true,
+		"sealed":              true,
+		"standby":             true,
+		"performance_standby": false,
 	}
 	testResponseStatus(t, resp, 523)
 	testResponseBody(t, resp, &actual)
@@ -189,9 +194,10 @@ func TestSysHealth_customcodes(t *testing.T) {
 
 	actual = map[string]interface{}{}
 	expected = map[string]interface{}{
-		"initialized": true,
-		"sealed":      false,
-		"standby":     false,
+		"initialized":         true,
+		"sealed":              false,
+		"standby":             false,
+		"performance_standby": false,
 	}
 	testResponseStatus(t, resp, 202)
 	testResponseBody(t, resp, &actual)
@@ -0,0 +1,78 @@
+package http
+
+import (
+	"net/http"
+
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/vault"
+)
+
+// handleSysMetrics serves sys/metrics, passing the format query parameter
+// through to the request. If the listener allows unauthenticated access to
+// metrics they are served without a token from the node's own sink, even on
+// a standby; the active node would otherwise ask the forwarded request for a
+// token. Without it the request is handled like any other and so is subject
+// to ACLs and forwarded by standbys. Either way a sealed node refuses the
+// request.
+func handleSysMetrics(core *vault.Core, props *HandlerProperties) http.Handler {
+	authenticated := handlePerformanceStandby(core, handleSysMetricsRequest(core))
+	unauthenticated := handleSysMetricsUnauthenticated(core)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" {
+			respondError(w, http.StatusMethodNotAllowed, nil)
+			return
+		}
+
+		if !props.UnauthenticatedMetricsAccess {
+			authenticated.ServeHTTP(w, r)
+			return
+		}
+		unauthenticated.ServeHTTP(w, r)
+	})
+}
+
+// handleSysMetricsUnauthenticated serves the metrics of the node without a
+// token, unless it is sealed
+func handleSysMetricsUnauthenticated(core *vault.Core) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sealed, err := core.Sealed()
+		if err != nil {
+			respondError(w, http.StatusInternalServerError, err)
+			return
+		}
+		if sealed {
+			respondError(w, http.StatusServiceUnavailable, vault.ErrSealed)
+			return
+		}
+
+		resp, err := core.MetricsHelper().ResponseForFormat(r.URL.Query().Get("format"))
+		if respondErrorCommon(w, resp, err) {
+			return
+		}
+		if _, ok := resp.Data[logical.HTTPStatusCode]; ok {
+			respondRaw(w, r, resp)
+			return
+		}
+		respondOk(w, resp.Data)
+	})
+}
+
+func handleSysMetricsRequest(core *vault.Core) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req, statusCode, err := buildLogicalRequest(core, w, r)
+		if err != nil || statusCode != 0 {
+			respondError(w, statusCode, err)
+			return
+		}
+		req.Data = map[string]interface{}{
+			"format": r.URL.Query().Get("format"),
+		}
+
+		resp, ok := request(core, w, r, req)
+		if !ok {
+			return
+		}
+		respondLogical(w, r, req, true, resp)
+	})
+}
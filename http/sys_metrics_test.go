@@ -0,0 +1,116 @@
+package http
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	cleanhttp "github.com/hashicorp/go-cleanhttp"
+	"github.com/hashicorp/vault/api"
+	"github.com/hashicorp/vault/vault"
+)
+
+func TestSysMetrics(t *testing.T) {
+	core, _, token := vault.TestCoreUnsealed(t)
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+
+	// A token is required by default
+	resp := testHttpGet(t, "", addr+"/v1/sys/metrics")
+	testResponseStatus(t, resp, 400)
+
+	resp = testHttpGet(t, token, addr+"/v1/sys/metrics")
+	testResponseStatus(t, resp, 200)
+	var actual map[string]interface{}
+	testResponseBody(t, resp, &actual)
+	for _, key := range []string{"timestamp", "gauges", "counters", "samples"} {
+		if _, ok := actual[key]; !ok {
+			t.Fatalf("missing %s: %#v", key, actual)
+		}
+	}
+
+	// Prometheus is not enabled on the test core
+	resp = testHttpGet(t, token, addr+"/v1/sys/metrics?format=prometheus")
+	testResponseStatus(t, resp, 400)
+}
+
+func TestSysMetrics_unauthenticated(t *testing.T) {
+	core, _, token := vault.TestCoreUnsealed(t)
+	ln, addr := TestListener(t)
+	defer ln.Close()
+
+	server := &http.Server{
+		Handler: HandlerWithProperties(core, &HandlerProperties{
+			UnauthenticatedMetricsAccess: true,
+		}),
+	}
+	go server.Serve(ln)
+
+	resp := testHttpGet(t, "", addr+"/v1/sys/metrics")
+	testResponseStatus(t, resp, 200)
+	var actual map[string]interface{}
+	testResponseBody(t, resp, &actual)
+	if _, ok := actual["gauges"]; !ok {
+		t.Fatalf("bad: %#v", actual)
+	}
+
+	resp = testHttpGet(t, "", addr+"/v1/sys/metrics?format=xml")
+	testResponseStatus(t, resp, 400)
+
+	// Other paths still require a token
+	resp = testHttpGet(t, "", addr+"/v1/sys/mounts")
+	testResponseStatus(t, resp, 400)
+
+	// A sealed node does not serve metrics
+	if err := core.Seal(token); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	resp = testHttpGet(t, "", addr+"/v1/sys/metrics")
+	testResponseStatus(t, resp, 503)
+}
+
+func TestSysMetrics_unauthenticatedStandby(t *testing.T) {
+	handler1 := http.NewServeMux()
+	handler2 := http.NewServeMux()
+	handler3 := http.NewServeMux()
+
+	cores := vault.TestCluster(t, []http.Handler{handler1, handler2, handler3}, nil, true)
+	for _, core := range cores {
+		defer core.CloseListeners()
+	}
+	// Forwarded requests are served by the cluster handler of the active
+	// node, which does not have the properties of any listener
+	props := &HandlerProperties{
+		UnauthenticatedMetricsAccess: true,
+	}
+	handler1.Handle("/", Handler(cores[0].Core))
+	handler2.Handle("/", HandlerWithProperties(cores[1].Core, props))
+	handler3.Handle("/", HandlerWithProperties(cores[2].Core, props))
+
+	vault.TestWaitActive(t, cores[0].Core)
+
+	config := api.DefaultConfig()
+	config.Address = fmt.Sprintf("https://127.0.0.1:%d", cores[1].Listeners[0].Address.Port)
+	config.HttpClient = cleanhttp.DefaultClient()
+	config.HttpClient.Transport.(*http.Transport).TLSClientConfig = cores[0].TLSConfig
+	client, err := api.NewClient(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.ClearToken()
+
+	// The standby serves the scrape itself rather than forwarding it to the
+	// active node, which would require a token
+	resp, err := client.RawRequest(client.NewRequest("GET", "/v1/sys/metrics"))
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer resp.Body.Close()
+	var actual map[string]interface{}
+	if err := resp.DecodeJSON(&actual); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if _, ok := actual["gauges"]; !ok {
+		t.Fatalf("bad: %#v", actual)
+	}
+}
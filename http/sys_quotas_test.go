@@ -0,0 +1,150 @@
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/hashicorp/go-cleanhttp"
+	"github.com/hashicorp/vault/vault"
+)
+
+func TestSysRateLimitQuota(t *testing.T) {
+	core, _, token := vault.TestCoreUnsealed(t)
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+	TestServerAuth(t, addr, token)
+
+	resp := testHttpPut(t, token, addr+"/v1/sys/quotas/rate-limit/mounts", map[string]interface{}{
+		"path":     "sys/mounts",
+		"rate":     1,
+		"interval": "1h",
+	})
+	testResponseStatus(t, resp, 204)
+
+	resp = testHttpGet(t, token, addr+"/v1/sys/quotas/rate-limit/mounts")
+	testResponseStatus(t, resp, 200)
+	var actual map[string]interface{}
+	testResponseBody(t, resp, &actual)
+	data := actual["data"].(map[string]interface{})
+	if data["path"] != "sys/mounts/" || data["burst"] != json.Number("0") || data["interval"] != json.Number("3600") {
+		t.Fatalf("bad: %#v", data)
+	}
+
+	resp = testHttpGet(t, token, addr+"/v1/sys/mounts")
+	testResponseStatus(t, resp, 200)
+
+	resp = testHttpGet(t, token, addr+"/v1/sys/mounts")
+	testResponseStatus(t, resp, 429)
+	if resp.Header.Get("Retry-After") == "" {
+		t.Fatalf("missing Retry-After header")
+	}
+
+	// The quota endpoints themselves are never limited
+	resp = testHttpDelete(t, token, addr+"/v1/sys/quotas/rate-limit/mounts")
+	testResponseStatus(t, resp, 204)
+
+	resp = testHttpGet(t, token, addr+"/v1/sys/mounts")
+	testResponseStatus(t, resp, 200)
+}
+
+func TestSysRateLimitQuota_namespace(t *testing.T) {
+	core, _, token := vault.TestCoreUnsealed(t)
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+	TestServerAuth(t, addr, token)
+
+	resp := testHttpPut(t, token, addr+"/v1/sys/quotas/rate-limit/ns", map[string]interface{}{
+		"path":     "ns1/secret/",
+		"rate":     1,
+		"interval": "1h",
+	})
+	testResponseStatus(t, resp, 204)
+
+	// Requests within a namespace are limited by the path they resolve to
+	get := func() *http.Response {
+		req, err := http.NewRequest("GET", addr+"/v1/secret/foo", nil)
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		req.Header.Set(AuthHeaderName, token)
+		req.Header.Set(NamespaceHeaderName, "ns1")
+		resp, err := cleanhttp.DefaultClient().Do(req)
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		return resp
+	}
+	if resp := get(); resp.StatusCode == 429 {
+		t.Fatalf("first request should be allowed")
+	}
+	testResponseStatus(t, get(), 429)
+
+	// Requests outside of the namespace are not
+	resp = testHttpGet(t, token, addr+"/v1/secret/foo")
+	testResponseStatus(t, resp, 404)
+}
+
+func TestSysRateLimitQuota_role(t *testing.T) {
+	core, _, token := vault.TestCoreUnsealed(t)
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+	TestServerAuth(t, addr, token)
+
+	// Roles need the mount of their auth backend
+	resp := testHttpPut(t, token, addr+"/v1/sys/quotas/rate-limit/role", map[string]interface{}{
+		"role": "web",
+		"rate": 1,
+	})
+	testResponseStatus(t, resp, 400)
+	resp = testHttpPut(t, token, addr+"/v1/sys/quotas/rate-limit/role", map[string]interface{}{
+		"role":       "web",
+		"role_mount": "auth/missing",
+		"rate":       1,
+	})
+	testResponseStatus(t, resp, 400)
+
+	resp = testHttpPut(t, token, addr+"/v1/sys/quotas/rate-limit/role", map[string]interface{}{
+		"role":       "web",
+		"role_mount": "auth/token",
+		"rate":       1,
+	})
+	testResponseStatus(t, resp, 204)
+
+	resp = testHttpGet(t, token, addr+"/v1/sys/quotas/rate-limit/role")
+	testResponseStatus(t, resp, 200)
+	var actual map[string]interface{}
+	testResponseBody(t, resp, &actual)
+	data := actual["data"].(map[string]interface{})
+	if data["role"] != "web" || data["role_mount"] != "auth/token/" {
+		t.Fatalf("bad: %#v", data)
+	}
+}
+
+func TestSysLeaseCountQuota(t *testing.T) {
+	core, _, token := vault.TestCoreUnsealed(t)
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+	TestServerAuth(t, addr, token)
+
+	resp := testHttpPut(t, token, addr+"/v1/sys/quotas/lease-count/tokens", map[string]interface{}{
+		"path":       "auth/token/create",
+		"max_leases": 1,
+	})
+	testResponseStatus(t, resp, 204)
+
+	resp = testHttpPost(t, token, addr+"/v1/auth/token/create", map[string]interface{}{})
+	testResponseStatus(t, resp, 200)
+
+	resp = testHttpPost(t, token, addr+"/v1/auth/token/create", map[string]interface{}{})
+	testResponseStatus(t, resp, 429)
+
+	resp = testHttpGet(t, token, addr+"/v1/sys/quotas/lease-count/tokens")
+	testResponseStatus(t, resp, 200)
+	var actual map[string]interface{}
+	testResponseBody(t, resp, &actual)
+	data := actual["data"].(map[string]interface{})
+	if data["path"] != "auth/token/create/" || data["count"] != json.Number("1") {
+		t.Fatalf("bad: %#v", data)
+	}
+}
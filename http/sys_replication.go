@@ -0,0 +1,67 @@
+package http
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/hashicorp/errwrap"
+	"github.com/hashicorp/vault/vault"
+)
+
+func handleSysReplicationStatus(core *vault.Core) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" {
+			respondError(w, http.StatusMethodNotAllowed, nil)
+			return
+		}
+
+		respondOk(w, &ReplicationStatusResponse{
+			DR: core.DRReplicationStatus(),
+		})
+	})
+}
+
+// handleSysReplicationDRSecondary serves the DR secondary endpoints. They
+// are authenticated with the activation token rather than a Vault token,
+// since a DR secondary is sealed and its token store is the primary's.
+func handleSysReplicationDRSecondary(core *vault.Core, f func(string) error) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case "PUT":
+		case "POST":
+		default:
+			respondError(w, http.StatusMethodNotAllowed, nil)
+			return
+		}
+
+		var req DRSecondaryRequest
+		if err := parseRequest(r, w, &req); err != nil {
+			respondError(w, http.StatusBadRequest, err)
+			return
+		}
+		if req.Token == "" {
+			respondError(w, http.StatusBadRequest, errors.New("'token' must be specified in request body as JSON"))
+			return
+		}
+
+		if err := f(req.Token); err != nil {
+			switch {
+			case errwrap.Contains(err, vault.ErrInvalidActivationToken.Error()):
+				respondError(w, http.StatusForbidden, err)
+			default:
+				respondError(w, http.StatusBadRequest, err)
+			}
+			return
+		}
+
+		respondOk(w, nil)
+	})
+}
+
+type ReplicationStatusResponse struct {
+	DR map[string]interface{} `json:"dr"`
+}
+
+type DRSecondaryRequest struct {
+	Token string `json:"token"`
+}
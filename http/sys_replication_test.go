@@ -0,0 +1,52 @@
+package http
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/hashicorp/vault/vault"
+)
+
+func TestSysReplicationStatus(t *testing.T) {
+	core, _, _ := vault.TestCoreUnsealed(t)
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+
+	resp, err := http.Get(addr + "/v1/sys/replication/status")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	var actual map[string]interface{}
+	expected := map[string]interface{}{
+		"dr": map[string]interface{}{
+			"mode": "disabled",
+		},
+	}
+	testResponseStatus(t, resp, 200)
+	testResponseBody(t, resp, &actual)
+	if !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("bad: %#v", actual)
+	}
+}
+
+func TestSysReplicationDRSecondaryPromote_notSecondary(t *testing.T) {
+	core, _, _ := vault.TestCoreUnsealed(t)
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+
+	resp := testHttpPut(t, "", addr+"/v1/sys/replication/dr/secondary/promote", map[string]interface{}{})
+	testResponseStatus(t, resp, 400)
+
+	resp = testHttpPut(t, "", addr+"/v1/sys/replication/dr/secondary/promote", map[string]interface{}{
+		"token": "foo",
+	})
+	testResponseStatus(t, resp, 400)
+
+	resp, err := http.Get(addr + "/v1/sys/replication/dr/secondary/promote")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	testResponseStatus(t, resp, 405)
+}
@@ -127,6 +127,7 @@ func handleSysUnseal(core *vault.Core) http.Handler {
 				case errwrap.Contains(err, vault.ErrBarrierNotInit.Error()):
 				case errwrap.Contains(err, vault.ErrBarrierSealed.Error()):
 				case errwrap.Contains(err, vault.ErrStandby.Error()):
+				case errwrap.Contains(err, vault.ErrDRSecondary.Error()):
 				default:
 					respondError(w, http.StatusInternalServerError, err)
 					return
@@ -68,6 +68,11 @@ type Backend struct {
 	// to the backend, if required.
 	Clean CleanupFunc
 
+	// Invalidate is called when a key belonging to the backend is modified
+	// by another node, such as the active node when running as a
+	// performance standby. It should drop any cached state for the key.
+	Invalidate InvalidateFunc
+
 	// AuthRenew is the callback to call when a RenewRequest for an
 	// authentication comes in. By default, renewal won't be allowed.
 	// See the built-in AuthRenew helpers in lease.go for common callbacks.
@@ -92,6 +97,9 @@ type WALRollbackFunc func(*logical.Request, string, interface{}) error
 // CleanupFunc is the callback for backend unload.
 type CleanupFunc func()
 
+// InvalidateFunc is the callback for backend key invalidation.
+type InvalidateFunc func(string)
+
 func (b *Backend) HandleExistenceCheck(req *logical.Request) (checkFound bool, exists bool, err error) {
 	b.once.Do(b.init)
 
@@ -224,6 +232,13 @@ func (b *Backend) Cleanup() {
 	}
 }
 
+// InvalidateKey is used to clear caches and reset internal state on key changes
+func (b *Backend) InvalidateKey(key string) {
+	if b.Invalidate != nil {
+		b.Invalidate(key)
+	}
+}
+
 // Logger can be used to get the logger. If no logger has been set,
 // the logs will be discarded.
 func (b *Backend) Logger() log.Logger {
@@ -523,6 +538,8 @@ func (t FieldType) Zero() interface{} {
 		return map[string]interface{}{}
 	case TypeDurationSecond:
 		return 0
+	case TypeCommaStringSlice:
+		return []string{}
 	default:
 		panic("unknown type: " + t.String())
 	}
@@ -146,6 +146,37 @@ func TestFieldDataGet(t *testing.T) {
 			"foo",
 			0,
 		},
+
+		"comma string slice type, string value": {
+			map[string]*FieldSchema{
+				"foo": &FieldSchema{Type: TypeCommaStringSlice},
+			},
+			map[string]interface{}{
+				"foo": "bar, baz,,Qux",
+			},
+			"foo",
+			[]string{"bar", "baz", "Qux"},
+		},
+
+		"comma string slice type, list value": {
+			map[string]*FieldSchema{
+				"foo": &FieldSchema{Type: TypeCommaStringSlice},
+			},
+			map[string]interface{}{
+				"foo": []interface{}{"bar", "baz"},
+			},
+			"foo",
+			[]string{"bar", "baz"},
+		},
+
+		"comma string slice type, unset value": {
+			map[string]*FieldSchema{
+				"foo": &FieldSchema{Type: TypeCommaStringSlice},
+			},
+			map[string]interface{}{},
+			"foo",
+			[]string{},
+		},
 	}
 
 	for name, tc := range cases {
@@ -13,6 +13,10 @@ const (
 	// TypeDurationSecond represent as seconds, this can be either an
 	// integer or go duration format string (e.g. 24h)
 	TypeDurationSecond
+
+	// TypeCommaStringSlice represents a list of strings, which can be given
+	// either as a list or as a comma-separated string
+	TypeCommaStringSlice
 )
 
 func (t FieldType) String() string {
@@ -27,6 +31,8 @@ func (t FieldType) String() string {
 		return "map"
 	case TypeDurationSecond:
 		return "duration (sec)"
+	case TypeCommaStringSlice:
+		return "comma-separated string slice"
 	default:
 		return "unknown type"
 	}
@@ -36,6 +36,11 @@ type Backend interface {
 	HandleExistenceCheck(*Request) (bool, bool, error)
 
 	Cleanup()
+
+	// InvalidateKey may be invoked when an object is modified that belongs
+	// to the backend. The backend can use this to clear any caches or reset
+	// internal state as needed.
+	InvalidateKey(string)
 }
 
 // BackendConfig is provided to the factory to initialize the backend
@@ -64,4 +69,9 @@ type Paths struct {
 
 	// Unauthenticated are the paths that can be accessed without any auth.
 	Unauthenticated []string
+
+	// PerformanceStandby are the paths that a performance standby node may
+	// serve locally. Requests to these paths that turn out to need a write
+	// to storage are still forwarded to the active node.
+	PerformanceStandby []string
 }
@@ -61,9 +61,21 @@ type Request struct {
 	// request path with the MountPoint trimmed off.
 	MountPoint string `json:"mount_point" structs:"mount_point" mapstructure:"mount_point"`
 
+	// Namespace is the path of the namespace the request is made in, such
+	// as "team1/", and is empty for the root namespace. It is set by the
+	// core from the request path.
+	Namespace string `json:"namespace" structs:"namespace" mapstructure:"namespace"`
+
 	// WrapTTL contains the requested TTL of the token used to wrap the
 	// response in a cubbyhole.
 	WrapTTL time.Duration `json:"wrap_ttl" struct:"wrap_ttl" mapstructure:"wrap_ttl"`
+
+	// AuditNonHMACRequestKeys and AuditNonHMACResponseKeys list the keys of
+	// the request and response data that audit backends log without hashing
+	// their values. They are set by the core from the configuration of the
+	// mount handling the request.
+	AuditNonHMACRequestKeys  []string `json:"audit_non_hmac_request_keys" structs:"audit_non_hmac_request_keys" mapstructure:"audit_non_hmac_request_keys"`
+	AuditNonHMACResponseKeys []string `json:"audit_non_hmac_response_keys" structs:"audit_non_hmac_response_keys" mapstructure:"audit_non_hmac_response_keys"`
 }
 
 // Get returns a data field and guards for nil Data
@@ -160,4 +172,8 @@ var (
 
 	// ErrPermissionDenied is returned if the client is not authorized
 	ErrPermissionDenied = errors.New("permission denied")
+
+	// ErrReadOnly is returned when a write is attempted against storage
+	// that is only available for reading, such as on a performance standby
+	ErrReadOnly = errors.New("cannot write to readonly storage")
 )
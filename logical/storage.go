@@ -4,8 +4,13 @@ import (
 	"fmt"
 
 	"github.com/hashicorp/vault/helper/jsonutil"
+	"github.com/hashicorp/vault/physical"
 )
 
+// ErrTransactionUnsupported is returned by Transactional storage when the
+// physical backend underneath it cannot apply transactions.
+var ErrTransactionUnsupported = physical.ErrTransactionUnsupported
+
 // Storage is the way that logical backends are able read/write data.
 type Storage interface {
 	List(prefix string) ([]string, error)
@@ -14,6 +19,20 @@ type Storage interface {
 	Delete(string) error
 }
 
+// Transactional is an optional interface for Storage implementations that
+// can apply a set of operations atomically.
+type Transactional interface {
+	Transaction([]TxnEntry) error
+}
+
+// TxnEntry is an operation that takes place atomically as part of a
+// transactional update. For delete operations only the key of the entry
+// is used.
+type TxnEntry struct {
+	Operation physical.Operation
+	Entry     *StorageEntry
+}
+
 // StorageEntry is the entry for an item in a Storage implementation.
 type StorageEntry struct {
 	Key   string
@@ -37,3 +56,36 @@ func StorageEntryJSON(k string, v interface{}) (*StorageEntry, error) {
 		Value: encodedBytes,
 	}, nil
 }
+
+// ApplyTxn applies the given operations to the storage. If the storage is
+// Transactional they are applied atomically; otherwise they are applied one
+// at a time in the given order, so callers should order operations such
+// that a partial application is the least harmful.
+func ApplyTxn(s Storage, txns []TxnEntry) error {
+	if txnStorage, ok := s.(Transactional); ok {
+		err := txnStorage.Transaction(txns)
+		if err != ErrTransactionUnsupported {
+			return err
+		}
+	}
+
+	for _, txn := range txns {
+		if txn.Entry == nil {
+			return fmt.Errorf("transaction entry is missing an entry")
+		}
+
+		var err error
+		switch txn.Operation {
+		case physical.PutOperation:
+			err = s.Put(txn.Entry)
+		case physical.DeleteOperation:
+			err = s.Delete(txn.Entry.Key)
+		default:
+			err = fmt.Errorf("unsupported transaction operation %q", txn.Operation)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -48,6 +48,24 @@ func (s *InmemStorage) Delete(k string) error {
 	return s.phys.Delete(k)
 }
 
+func (s *InmemStorage) Transaction(txns []TxnEntry) error {
+	s.once.Do(s.init)
+	physTxns := make([]physical.TxnEntry, 0, len(txns))
+	for _, txn := range txns {
+		physTxn := physical.TxnEntry{
+			Operation: txn.Operation,
+		}
+		if txn.Entry != nil {
+			physTxn.Entry = &physical.Entry{
+				Key:   txn.Entry.Key,
+				Value: txn.Entry.Value,
+			}
+		}
+		physTxns = append(physTxns, physTxn)
+	}
+	return s.phys.Transaction(physTxns)
+}
+
 func (s *InmemStorage) init() {
 	s.phys = physical.NewInmem(nil)
 }
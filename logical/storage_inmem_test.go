@@ -2,8 +2,57 @@ package logical
 
 import (
 	"testing"
+
+	"github.com/hashicorp/vault/physical"
 )
 
 func TestInmemStorage(t *testing.T) {
 	TestStorage(t, new(InmemStorage))
 }
+
+func TestApplyTxn(t *testing.T) {
+	inm := new(InmemStorage)
+
+	// Embedding only the Storage interface hides Transaction, exercising
+	// the non-transactional fallback
+	nonTxn := struct{ Storage }{inm}
+
+	for _, s := range []Storage{inm, nonTxn} {
+		if err := s.Put(&StorageEntry{Key: "delete", Value: []byte("old")}); err != nil {
+			t.Fatalf("err: %v", err)
+		}
+
+		err := ApplyTxn(s, []TxnEntry{
+			TxnEntry{
+				Operation: physical.PutOperation,
+				Entry:     &StorageEntry{Key: "foo", Value: []byte("bar")},
+			},
+			TxnEntry{
+				Operation: physical.DeleteOperation,
+				Entry:     &StorageEntry{Key: "delete"},
+			},
+		})
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+
+		out, err := s.Get("foo")
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		if out == nil || string(out.Value) != "bar" {
+			t.Fatalf("bad: %#v", out)
+		}
+		out, err = s.Get("delete")
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		if out != nil {
+			t.Fatalf("bad: %#v", out)
+		}
+
+		if err := s.Delete("foo"); err != nil {
+			t.Fatalf("err: %v", err)
+		}
+	}
+}
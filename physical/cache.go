@@ -2,8 +2,11 @@ package physical
 
 import (
 	"strings"
+	"sync"
+	"time"
 
-	"github.com/hashicorp/golang-lru"
+	"github.com/armon/go-metrics"
+	"github.com/hashicorp/golang-lru/simplelru"
 	log "github.com/mgutz/logxi/v1"
 )
 
@@ -12,53 +15,168 @@ const (
 	DefaultCacheSize = 32 * 1024
 )
 
+// DefaultCacheExcludedPrefixes are never cached, regardless of
+// configuration. The HA lock is owned by whichever node holds it and must
+// always be read from the backend.
+var DefaultCacheExcludedPrefixes = []string{
+	"core/lock",
+}
+
+// CacheConfig is used to configure a Cache
+type CacheConfig struct {
+	// Size is the maximum number of entries held in the cache. If zero,
+	// DefaultCacheSize is used.
+	Size int
+
+	// MaxBytes is the maximum combined size of the keys and values held in
+	// the cache. If zero, only the number of entries is limited.
+	MaxBytes int
+
+	// MaxStaleness bounds how long an entry may be served from the cache
+	// before it is read from the backend again. This bounds how out of date
+	// a node can be when it does not see every write, such as a standby.
+	// If zero, entries are served until they are evicted or invalidated.
+	MaxStaleness time.Duration
+
+	// ExcludedPrefixes lists key prefixes that are never cached, in
+	// addition to DefaultCacheExcludedPrefixes.
+	ExcludedPrefixes []string
+}
+
 // Cache is used to wrap an underlying physical backend
 // and provide an LRU cache layer on top. Most of the reads done by
 // Vault are for policy objects so there is a large read reduction
 // by using a simple write-through cache.
 type Cache struct {
-	backend Backend
-	lru     *lru.TwoQueueCache
+	backend  Backend
+	excluded []string
+
+	maxBytes     int
+	maxStaleness time.Duration
+
+	// l protects the LRU and the byte count, which are updated together
+	l     sync.Mutex
+	lru   *simplelru.LRU
+	bytes int
+}
+
+// cacheEntry is a value held in the LRU. A nil entry caches the absence of
+// a key.
+type cacheEntry struct {
+	entry    *Entry
+	size     int
+	cachedAt time.Time
+}
+
+// TransactionalCache is a Cache that wraps a Transactional backend and
+// passes transactions through to it, keeping the cache up to date with
+// their results.
+type TransactionalCache struct {
+	*Cache
+	transactional Transactional
+}
+
+// Purgable is implemented by caching layers that can be cleared
+type Purgable interface {
+	Purge()
+}
+
+// Invalidatable is implemented by caching layers that can drop individual
+// keys, which is used to apply modifications made by another node
+type Invalidatable interface {
+	// Invalidate drops a single key
+	Invalidate(key string)
+
+	// InvalidatePrefix drops every key under the given prefix
+	InvalidatePrefix(prefix string)
 }
 
 // NewCache returns a physical cache of the given size.
 // If no size is provided, the default size is used.
 func NewCache(b Backend, size int, logger log.Logger) *Cache {
+	return NewCacheWithConfig(b, &CacheConfig{Size: size}, logger)
+}
+
+// NewCacheWithConfig returns a physical cache using the given
+// configuration.
+func NewCacheWithConfig(b Backend, conf *CacheConfig, logger log.Logger) *Cache {
+	size := conf.Size
 	if size <= 0 {
 		size = DefaultCacheSize
 	}
 	if logger.IsTrace() {
-		logger.Trace("physical/cache: creating LRU cache", "size", size)
+		logger.Trace("physical/cache: creating LRU cache", "size", size,
+			"max_bytes", conf.MaxBytes, "max_staleness", conf.MaxStaleness)
 	}
-	cache, _ := lru.New2Q(size)
+
+	excluded := make([]string, 0, len(DefaultCacheExcludedPrefixes)+len(conf.ExcludedPrefixes))
+	excluded = append(excluded, DefaultCacheExcludedPrefixes...)
+	excluded = append(excluded, conf.ExcludedPrefixes...)
+
 	c := &Cache{
-		backend: b,
-		lru:     cache,
+		backend:      b,
+		excluded:     excluded,
+		maxBytes:     conf.MaxBytes,
+		maxStaleness: conf.MaxStaleness,
+	}
+	c.lru, _ = simplelru.NewLRU(size, c.onRemove)
+	return c
+}
+
+// NewTransactionalCache returns a physical cache of the given size wrapping
+// a backend that supports transactions.
+func NewTransactionalCache(b Backend, size int, logger log.Logger) *TransactionalCache {
+	return NewTransactionalCacheWithConfig(b, &CacheConfig{Size: size}, logger)
+}
+
+// NewTransactionalCacheWithConfig returns a physical cache using the given
+// configuration wrapping a backend that supports transactions.
+func NewTransactionalCacheWithConfig(b Backend, conf *CacheConfig, logger log.Logger) *TransactionalCache {
+	c := &TransactionalCache{
+		Cache:         NewCacheWithConfig(b, conf, logger),
+		transactional: b.(Transactional),
 	}
 	return c
 }
 
 // Purge is used to clear the cache
 func (c *Cache) Purge() {
+	c.l.Lock()
+	defer c.l.Unlock()
 	c.lru.Purge()
+	c.emitSize()
+}
+
+// Invalidate is used to drop a single key from the cache
+func (c *Cache) Invalidate(key string) {
+	c.remove(key)
+}
+
+// InvalidatePrefix is used to drop every key under the given prefix from
+// the cache
+func (c *Cache) InvalidatePrefix(prefix string) {
+	c.l.Lock()
+	defer c.l.Unlock()
+	for _, raw := range c.lru.Keys() {
+		if key := raw.(string); strings.HasPrefix(key, prefix) {
+			c.lru.Remove(key)
+		}
+	}
+	c.emitSize()
 }
 
 func (c *Cache) Put(entry *Entry) error {
 	err := c.backend.Put(entry)
 	if err == nil {
-		c.lru.Add(entry.Key, entry)
+		c.add(entry.Key, entry)
 	}
 	return err
 }
 
 func (c *Cache) Get(key string) (*Entry, error) {
 	// Check the LRU first
-	if raw, ok := c.lru.Get(key); ok {
-		if raw == nil {
-			return nil, nil
-		} else {
-			return raw.(*Entry), nil
-		}
+	if ent, ok := c.get(key); ok {
+		return ent, nil
 	}
 
 	// Read from the underlying backend
@@ -73,7 +191,7 @@ func (c *Cache) Get(key string) (*Entry, error) {
 	// we could potentially negatively cache the leader entry and cause
 	// leader discovery to fail.
 	if ent != nil || !strings.HasPrefix(key, "core/") {
-		c.lru.Add(key, ent)
+		c.add(key, ent)
 	}
 	return ent, err
 }
@@ -81,7 +199,7 @@ func (c *Cache) Get(key string) (*Entry, error) {
 func (c *Cache) Delete(key string) error {
 	err := c.backend.Delete(key)
 	if err == nil {
-		c.lru.Remove(key)
+		c.remove(key)
 	}
 	return err
 }
@@ -90,3 +208,121 @@ func (c *Cache) List(prefix string) ([]string, error) {
 	// Always pass-through as this would be difficult to cache.
 	return c.backend.List(prefix)
 }
+
+// cacheable returns whether the given key may be held in the cache
+func (c *Cache) cacheable(key string) bool {
+	for _, prefix := range c.excluded {
+		if strings.HasPrefix(key, prefix) {
+			return false
+		}
+	}
+	return true
+}
+
+// get returns the cached entry for a key, if there is one that is not too
+// stale to serve
+func (c *Cache) get(key string) (*Entry, bool) {
+	c.l.Lock()
+	defer c.l.Unlock()
+
+	raw, ok := c.lru.Get(key)
+	if !ok {
+		metrics.IncrCounter([]string{"cache", "miss"}, 1)
+		return nil, false
+	}
+
+	ce := raw.(*cacheEntry)
+	if c.maxStaleness > 0 && time.Since(ce.cachedAt) > c.maxStaleness {
+		c.lru.Remove(key)
+		c.emitSize()
+		metrics.IncrCounter([]string{"cache", "stale"}, 1)
+		metrics.IncrCounter([]string{"cache", "miss"}, 1)
+		return nil, false
+	}
+
+	metrics.IncrCounter([]string{"cache", "hit"}, 1)
+	return ce.entry, true
+}
+
+// add caches an entry for a key, evicting the least recently used entries
+// as needed to stay within the configured limits
+func (c *Cache) add(key string, entry *Entry) {
+	if !c.cacheable(key) {
+		return
+	}
+
+	size := len(key)
+	if entry != nil {
+		size += len(entry.Value)
+	}
+
+	c.l.Lock()
+	defer c.l.Unlock()
+
+	// Remove any previous value first so that its size is accounted for
+	c.lru.Remove(key)
+
+	// An entry larger than the whole cache would only evict everything else
+	if c.maxBytes > 0 && size > c.maxBytes {
+		c.emitSize()
+		return
+	}
+
+	c.bytes += size
+	if c.lru.Add(key, &cacheEntry{entry: entry, size: size, cachedAt: time.Now()}) {
+		metrics.IncrCounter([]string{"cache", "evict"}, 1)
+	}
+	for c.maxBytes > 0 && c.bytes > c.maxBytes {
+		if _, _, ok := c.lru.RemoveOldest(); !ok {
+			break
+		}
+		metrics.IncrCounter([]string{"cache", "evict"}, 1)
+	}
+	c.emitSize()
+}
+
+// remove drops a key from the cache
+func (c *Cache) remove(key string) {
+	c.l.Lock()
+	defer c.l.Unlock()
+	if c.lru.Remove(key) {
+		c.emitSize()
+	}
+}
+
+// onRemove is called by the LRU whenever an entry leaves it, for any
+// reason, and must be called with the lock held
+func (c *Cache) onRemove(_ interface{}, value interface{}) {
+	c.bytes -= value.(*cacheEntry).size
+}
+
+// emitSize reports the current size of the cache and must be called with
+// the lock held
+func (c *Cache) emitSize() {
+	metrics.SetGauge([]string{"cache", "entries"}, float32(c.lru.Len()))
+	metrics.SetGauge([]string{"cache", "bytes"}, float32(c.bytes))
+}
+
+func (c *TransactionalCache) Transaction(txns []TxnEntry) error {
+	// Drop any cached values first so that a failed transaction can never
+	// leave stale entries behind
+	for _, txn := range txns {
+		if txn.Entry != nil {
+			c.remove(txn.Entry.Key)
+		}
+	}
+
+	if err := c.transactional.Transaction(txns); err != nil {
+		return err
+	}
+
+	for _, txn := range txns {
+		switch txn.Operation {
+		case PutOperation:
+			c.add(txn.Entry.Key, txn.Entry)
+		case DeleteOperation:
+			c.remove(txn.Entry.Key)
+		}
+	}
+	return nil
+}
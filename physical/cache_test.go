@@ -2,7 +2,9 @@ package physical
 
 import (
 	"testing"
+	"time"
 
+	"github.com/armon/go-metrics"
 	"github.com/hashicorp/vault/helper/logformat"
 	log "github.com/mgutz/logxi/v1"
 )
@@ -16,6 +18,37 @@ func TestCache(t *testing.T) {
 	testBackend_ListPrefix(t, cache)
 }
 
+func TestTransactionalCache(t *testing.T) {
+	logger := logformat.NewVaultLogger(log.LevelTrace)
+
+	inm := NewInmem(logger)
+	cache := NewTransactionalCache(inm, 0, logger)
+	testBackend(t, cache)
+	testBackend_ListPrefix(t, cache)
+	testTransactionalBackend(t, cache)
+
+	// Prime the cache and then delete through a transaction
+	if err := cache.Put(&Entry{Key: "foo", Value: []byte("bar")}); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	err := cache.Transaction([]TxnEntry{
+		TxnEntry{
+			Operation: DeleteOperation,
+			Entry:     &Entry{Key: "foo"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	out, err := cache.Get("foo")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if out != nil {
+		t.Fatalf("should not have key")
+	}
+}
+
 func TestCache_Purge(t *testing.T) {
 	logger := logformat.NewVaultLogger(log.LevelTrace)
 
@@ -55,3 +88,196 @@ func TestCache_Purge(t *testing.T) {
 		t.Fatalf("should not have key")
 	}
 }
+
+func TestCache_Invalidate(t *testing.T) {
+	logger := logformat.NewVaultLogger(log.LevelTrace)
+
+	inm := NewInmem(logger)
+	cache := NewCache(inm, 0, logger)
+
+	for _, key := range []string{"foo", "bar"} {
+		err := cache.Put(&Entry{
+			Key:   key,
+			Value: []byte("baz"),
+		})
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+	}
+
+	// Modify from under
+	inm.Put(&Entry{Key: "foo", Value: []byte("zip")})
+	inm.Put(&Entry{Key: "bar", Value: []byte("zip")})
+
+	// Only the invalidated key should be re-read
+	cache.Invalidate("foo")
+
+	out, err := cache.Get("foo")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if out == nil || string(out.Value) != "zip" {
+		t.Fatalf("bad: %#v", out)
+	}
+
+	out, err = cache.Get("bar")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if out == nil || string(out.Value) != "baz" {
+		t.Fatalf("bad: %#v", out)
+	}
+}
+
+func TestCache_InvalidatePrefix(t *testing.T) {
+	logger := logformat.NewVaultLogger(log.LevelTrace)
+
+	inm := NewInmem(logger)
+	cache := NewCache(inm, 0, logger)
+
+	for _, key := range []string{"foo/a", "foo/b", "bar/a"} {
+		if err := cache.Put(&Entry{Key: key, Value: []byte("baz")}); err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		inm.Put(&Entry{Key: key, Value: []byte("zip")})
+	}
+
+	cache.InvalidatePrefix("foo/")
+
+	for key, expected := range map[string]string{"foo/a": "zip", "foo/b": "zip", "bar/a": "baz"} {
+		out, err := cache.Get(key)
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		if out == nil || string(out.Value) != expected {
+			t.Fatalf("%s: bad: %#v", key, out)
+		}
+	}
+}
+
+func TestCache_MaxBytes(t *testing.T) {
+	logger := logformat.NewVaultLogger(log.LevelTrace)
+
+	inm := NewInmem(logger)
+	cache := NewCacheWithConfig(inm, &CacheConfig{MaxBytes: 20}, logger)
+
+	// Each entry is 8 bytes, so only two fit
+	for _, key := range []string{"k1", "k2", "k3"} {
+		if err := cache.Put(&Entry{Key: key, Value: []byte("123456")}); err != nil {
+			t.Fatalf("err: %v", err)
+		}
+	}
+	if cache.lru.Len() != 2 || cache.bytes != 16 {
+		t.Fatalf("bad: %d entries, %d bytes", cache.lru.Len(), cache.bytes)
+	}
+	if cache.lru.Contains("k1") {
+		t.Fatalf("expected least recently used entry to be evicted")
+	}
+
+	// Replacing an entry accounts for the old value
+	if err := cache.Put(&Entry{Key: "k3", Value: []byte("12")}); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if cache.lru.Len() != 2 || cache.bytes != 12 {
+		t.Fatalf("bad: %d entries, %d bytes", cache.lru.Len(), cache.bytes)
+	}
+
+	// Entries larger than the cache are not held at all
+	if err := cache.Put(&Entry{Key: "big", Value: make([]byte, 32)}); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if cache.lru.Contains("big") || cache.lru.Len() != 2 {
+		t.Fatalf("expected large entry to be skipped")
+	}
+
+	cache.Purge()
+	if cache.lru.Len() != 0 || cache.bytes != 0 {
+		t.Fatalf("bad: %d entries, %d bytes", cache.lru.Len(), cache.bytes)
+	}
+}
+
+func TestCache_ExcludedPrefixes(t *testing.T) {
+	logger := logformat.NewVaultLogger(log.LevelTrace)
+
+	inm := NewInmem(logger)
+	cache := NewCacheWithConfig(inm, &CacheConfig{ExcludedPrefixes: []string{"sys/expire/"}}, logger)
+
+	for _, key := range []string{"core/lock", "sys/expire/id/foo", "foo"} {
+		if err := cache.Put(&Entry{Key: key, Value: []byte("bar")}); err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		if _, err := cache.Get(key); err != nil {
+			t.Fatalf("err: %v", err)
+		}
+	}
+
+	keys := cache.lru.Keys()
+	if len(keys) != 1 || keys[0].(string) != "foo" {
+		t.Fatalf("bad: %v", keys)
+	}
+}
+
+func TestCache_MaxStaleness(t *testing.T) {
+	logger := logformat.NewVaultLogger(log.LevelTrace)
+
+	inm := NewInmem(logger)
+	cache := NewCacheWithConfig(inm, &CacheConfig{MaxStaleness: 50 * time.Millisecond}, logger)
+
+	if err := cache.Put(&Entry{Key: "foo", Value: []byte("bar")}); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	// Modify from under, as another node would
+	inm.Put(&Entry{Key: "foo", Value: []byte("baz")})
+
+	out, err := cache.Get("foo")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if out == nil || string(out.Value) != "bar" {
+		t.Fatalf("bad: %#v", out)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+
+	out, err = cache.Get("foo")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if out == nil || string(out.Value) != "baz" {
+		t.Fatalf("bad: %#v", out)
+	}
+}
+
+func TestCache_Metrics(t *testing.T) {
+	logger := logformat.NewVaultLogger(log.LevelTrace)
+
+	sink := metrics.NewInmemSink(time.Hour, time.Hour)
+	conf := metrics.DefaultConfig("vault")
+	conf.EnableHostname = false
+	conf.EnableRuntimeMetrics = false
+	metrics.NewGlobal(conf, sink)
+	defer metrics.NewGlobal(metrics.DefaultConfig(""), &metrics.BlackholeSink{})
+
+	inm := NewInmem(logger)
+	cache := NewCacheWithConfig(inm, &CacheConfig{Size: 1}, logger)
+
+	cache.Put(&Entry{Key: "foo", Value: []byte("bar")})
+	cache.Get("foo")
+	cache.Put(&Entry{Key: "bar", Value: []byte("baz")})
+	cache.Get("foo")
+
+	data := sink.Data()[0]
+	for key, expected := range map[string]int{
+		"vault.cache.hit":   1,
+		"vault.cache.miss":  1,
+		"vault.cache.evict": 2,
+	} {
+		if c := data.Counters[key]; c == nil || c.Count != expected {
+			t.Fatalf("%s: bad: %v", key, c)
+		}
+	}
+	if data.Gauges["vault.cache.entries"] != 1 || data.Gauges["vault.cache.bytes"] != 6 {
+		t.Fatalf("bad: %v", data.Gauges)
+	}
+}
@@ -21,6 +21,7 @@ import (
 	"github.com/hashicorp/consul/lib"
 	"github.com/hashicorp/errwrap"
 	"github.com/hashicorp/go-cleanhttp"
+	"github.com/hashicorp/go-multierror"
 	"github.com/hashicorp/vault/helper/strutil"
 	"github.com/hashicorp/vault/helper/tlsutil"
 )
@@ -47,6 +48,10 @@ const (
 	// reconcileTimeout is how often Vault should query Consul to detect
 	// and fix any state drift.
 	reconcileTimeout = 60 * time.Second
+
+	// consulMaxTxnOps is the maximum number of operations Consul accepts
+	// in a single transaction.
+	consulMaxTxnOps = 64
 )
 
 type notifyEvent struct{}
@@ -263,6 +268,55 @@ func setupTLSConfig(conf map[string]string) (*tls.Config, error) {
 	return tlsClientConfig, nil
 }
 
+// Transaction is used to run multiple entries via a transaction. This
+// requires Consul 0.7 or later.
+func (c *ConsulBackend) Transaction(txns []TxnEntry) error {
+	defer metrics.MeasureSince([]string{"consul", "transaction"}, time.Now())
+	if err := validateTxn(txns); err != nil {
+		return err
+	}
+	if len(txns) > consulMaxTxnOps {
+		return ErrTransactionTooLarge
+	}
+
+	ops := make([]*api.KVTxnOp, 0, len(txns))
+	for _, txn := range txns {
+		cop := &api.KVTxnOp{
+			Key: c.path + txn.Entry.Key,
+		}
+		switch txn.Operation {
+		case PutOperation:
+			cop.Verb = api.KVSet
+			cop.Value = txn.Entry.Value
+		case DeleteOperation:
+			cop.Verb = api.KVDelete
+		}
+		ops = append(ops, cop)
+	}
+
+	c.permitPool.Acquire()
+	defer c.permitPool.Release()
+
+	ok, resp, _, err := c.kv.Txn(ops, nil)
+	if err != nil {
+		return err
+	}
+	if ok {
+		return nil
+	}
+
+	var retErr *multierror.Error
+	if resp != nil {
+		for _, txnErr := range resp.Errors {
+			retErr = multierror.Append(retErr, fmt.Errorf("operation %d: %s", txnErr.OpIndex, txnErr.What))
+		}
+	}
+	if retErr == nil {
+		return fmt.Errorf("transaction was rolled back by Consul")
+	}
+	return retErr
+}
+
 // Put is used to insert or update an entry
 func (c *ConsulBackend) Put(entry *Entry) error {
 	defer metrics.MeasureSince([]string{"consul", "put"}, time.Now())
@@ -74,8 +74,25 @@ type EtcdBackend struct {
 	haEnabled  bool
 }
 
-// newEtcdBackend constructs a etcd backend using a given machine address.
+// newEtcdBackend constructs an etcd backend using the API version selected
+// by the etcd_api option. The v2 API is used unless v3 is requested.
 func newEtcdBackend(conf map[string]string, logger log.Logger) (Backend, error) {
+	etcdAPI := os.Getenv("ETCD_API")
+	if etcdAPI == "" {
+		etcdAPI = conf["etcd_api"]
+	}
+	switch etcdAPI {
+	case "", "2", "v2":
+		return newEtcd2Backend(conf, logger)
+	case "3", "v3":
+		return newEtcd3Backend(conf, logger)
+	default:
+		return nil, fmt.Errorf("value of 'etcd_api' could not be understood")
+	}
+}
+
+// newEtcd2Backend constructs a etcd backend using a given machine address.
+func newEtcd2Backend(conf map[string]string, logger log.Logger) (Backend, error) {
 	// Get the etcd path form the configuration.
 	path, ok := conf["path"]
 	if !ok {
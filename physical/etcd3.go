@@ -0,0 +1,410 @@
+package physical
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/mgutz/logxi/v1"
+
+	"github.com/armon/go-metrics"
+	"github.com/coreos/etcd/clientv3"
+	"github.com/coreos/etcd/clientv3/concurrency"
+	"github.com/coreos/etcd/pkg/transport"
+	"github.com/hashicorp/vault/helper/strutil"
+	"golang.org/x/net/context"
+)
+
+const (
+	// etcd3RequestTimeout bounds every request made to the etcd v3 API.
+	etcd3RequestTimeout = 5 * time.Second
+
+	// etcd3LockTTL is the TTL, in seconds, of the session lease backing a
+	// lock. It matches the TTL used for the v2 semaphore keys.
+	etcd3LockTTL = int(EtcdLockTTL / time.Second)
+
+	// etcd3MaxTxnOps is the maximum number of operations etcd accepts in a
+	// single transaction.
+	etcd3MaxTxnOps = 128
+)
+
+// Etcd3Backend is a physical backend that stores data at a specific prefix
+// within etcd using the v3 API. Unlike the v2 keys API, the v3 API supports
+// multi-key transactions.
+type Etcd3Backend struct {
+	path       string
+	etcd       *clientv3.Client
+	permitPool *PermitPool
+	logger     log.Logger
+	haEnabled  bool
+}
+
+// newEtcd3Backend constructs an etcd backend that uses the v3 API.
+func newEtcd3Backend(conf map[string]string, logger log.Logger) (Backend, error) {
+	// Get the etcd path form the configuration.
+	prefix, ok := conf["path"]
+	if !ok {
+		prefix = "/vault"
+	}
+
+	// Ensure path is prefixed.
+	if !strings.HasPrefix(prefix, "/") {
+		prefix = "/" + prefix
+	}
+
+	// Set a default machines list and check for an overriding address value.
+	machines := "http://127.0.0.1:2379"
+	if address, ok := conf["address"]; ok {
+		machines = address
+	}
+	machinesEnv := os.Getenv("ETCD_ADDR")
+	if machinesEnv != "" {
+		machines = machinesEnv
+	}
+	machinesParsed := strings.Split(machines, EtcdMachineDelimiter)
+
+	// Verify that the machines are valid URLs
+	for _, machine := range machinesParsed {
+		u, urlErr := url.Parse(machine)
+		if urlErr != nil || u.Scheme == "" {
+			return nil, EtcdAddressError
+		}
+	}
+
+	haEnabled := os.Getenv("ETCD_HA_ENABLED")
+	if haEnabled == "" {
+		haEnabled = conf["ha_enabled"]
+	}
+	haEnabledBool, _ := strconv.ParseBool(haEnabled)
+
+	cfg := clientv3.Config{
+		Endpoints:   machinesParsed,
+		DialTimeout: etcd3RequestTimeout,
+	}
+
+	cert, hasCert := conf["tls_cert_file"]
+	key, hasKey := conf["tls_key_file"]
+	ca, hasCa := conf["tls_ca_file"]
+	if (hasCert && hasKey) || hasCa {
+		tls := transport.TLSInfo{
+			CAFile:   ca,
+			CertFile: cert,
+			KeyFile:  key,
+		}
+		tlsConfig, err := tls.ClientConfig()
+		if err != nil {
+			return nil, err
+		}
+		cfg.TLS = tlsConfig
+	}
+
+	// Set credentials.
+	username := os.Getenv("ETCD_USERNAME")
+	if username == "" {
+		username, _ = conf["username"]
+	}
+
+	password := os.Getenv("ETCD_PASSWORD")
+	if password == "" {
+		password, _ = conf["password"]
+	}
+
+	if username != "" && password != "" {
+		cfg.Username = username
+		cfg.Password = password
+	}
+
+	etcd, err := clientv3.New(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	sync, ok := conf["sync"]
+	if !ok {
+		sync = "yes"
+	}
+	switch sync {
+	case "yes", "true", "y", "1":
+		ctx, cancel := context.WithTimeout(context.Background(), etcd3RequestTimeout)
+		syncErr := etcd.Sync(ctx)
+		cancel()
+		if syncErr != nil {
+			etcd.Close()
+			return nil, fmt.Errorf("%s: %s", EtcdSyncClusterError, syncErr)
+		}
+	case "no", "false", "n", "0":
+	default:
+		etcd.Close()
+		return nil, fmt.Errorf("value of 'sync' could not be understood")
+	}
+
+	return &Etcd3Backend{
+		path:       prefix,
+		etcd:       etcd,
+		permitPool: NewPermitPool(DefaultParallelOperations),
+		logger:     logger,
+		haEnabled:  haEnabledBool,
+	}, nil
+}
+
+// Put is used to insert or update an entry.
+func (c *Etcd3Backend) Put(entry *Entry) error {
+	defer metrics.MeasureSince([]string{"etcd", "put"}, time.Now())
+
+	c.permitPool.Acquire()
+	defer c.permitPool.Release()
+
+	ctx, cancel := context.WithTimeout(context.Background(), etcd3RequestTimeout)
+	defer cancel()
+	_, err := c.etcd.Put(ctx, c.keyPath(entry.Key), string(entry.Value))
+	return err
+}
+
+// Get is used to fetch an entry.
+func (c *Etcd3Backend) Get(key string) (*Entry, error) {
+	defer metrics.MeasureSince([]string{"etcd", "get"}, time.Now())
+
+	c.permitPool.Acquire()
+	defer c.permitPool.Release()
+
+	ctx, cancel := context.WithTimeout(context.Background(), etcd3RequestTimeout)
+	defer cancel()
+	resp, err := c.etcd.Get(ctx, c.keyPath(key))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(resp.Kvs) == 0 {
+		return nil, nil
+	}
+	if len(resp.Kvs) > 1 {
+		return nil, errors.New("unexpected number of keys from a get request")
+	}
+	return &Entry{
+		Key:   key,
+		Value: resp.Kvs[0].Value,
+	}, nil
+}
+
+// Delete is used to permanently delete an entry.
+func (c *Etcd3Backend) Delete(key string) error {
+	defer metrics.MeasureSince([]string{"etcd", "delete"}, time.Now())
+
+	c.permitPool.Acquire()
+	defer c.permitPool.Release()
+
+	ctx, cancel := context.WithTimeout(context.Background(), etcd3RequestTimeout)
+	defer cancel()
+	_, err := c.etcd.Delete(ctx, c.keyPath(key))
+	return err
+}
+
+// List is used to list all the keys under a given prefix, up to the next
+// prefix.
+func (c *Etcd3Backend) List(prefix string) ([]string, error) {
+	defer metrics.MeasureSince([]string{"etcd", "list"}, time.Now())
+
+	c.permitPool.Acquire()
+	defer c.permitPool.Release()
+
+	// The v3 keyspace is flat, so fetch every key under the prefix and fold
+	// the ones that are nested further into their first path segment.
+	dir := c.keyPath(prefix) + "/"
+	ctx, cancel := context.WithTimeout(context.Background(), etcd3RequestTimeout)
+	defer cancel()
+	resp, err := c.etcd.Get(ctx, dir, clientv3.WithPrefix(), clientv3.WithKeysOnly())
+	if err != nil {
+		return nil, err
+	}
+
+	keys := []string{}
+	for _, kv := range resp.Kvs {
+		key := strings.TrimPrefix(string(kv.Key), dir)
+		if key == "" {
+			continue
+		}
+		if i := strings.Index(key, "/"); i == -1 {
+			keys = append(keys, key)
+		} else if !strutil.StrListContains(keys, key[:i+1]) {
+			keys = append(keys, key[:i+1])
+		}
+	}
+	return keys, nil
+}
+
+// Transaction is used to run multiple entries via an etcd transaction. etcd
+// rejects transactions that touch the same key twice, so only the last
+// operation on each key is sent; the outcome is the same as applying all of
+// them in order.
+func (c *Etcd3Backend) Transaction(txns []TxnEntry) error {
+	defer metrics.MeasureSince([]string{"etcd", "transaction"}, time.Now())
+	if err := validateTxn(txns); err != nil {
+		return err
+	}
+
+	last := make(map[string]int, len(txns))
+	for i, txn := range txns {
+		last[txn.Entry.Key] = i
+	}
+	if len(last) > etcd3MaxTxnOps {
+		return ErrTransactionTooLarge
+	}
+
+	ops := make([]clientv3.Op, 0, len(last))
+	for i, txn := range txns {
+		if last[txn.Entry.Key] != i {
+			continue
+		}
+		switch txn.Operation {
+		case PutOperation:
+			ops = append(ops, clientv3.OpPut(c.keyPath(txn.Entry.Key), string(txn.Entry.Value)))
+		case DeleteOperation:
+			ops = append(ops, clientv3.OpDelete(c.keyPath(txn.Entry.Key)))
+		}
+	}
+
+	c.permitPool.Acquire()
+	defer c.permitPool.Release()
+
+	ctx, cancel := context.WithTimeout(context.Background(), etcd3RequestTimeout)
+	defer cancel()
+	resp, err := c.etcd.Txn(ctx).Then(ops...).Commit()
+	if err != nil {
+		return err
+	}
+	if !resp.Succeeded {
+		return fmt.Errorf("transaction was not applied by etcd")
+	}
+	return nil
+}
+
+// keyPath returns the etcd key for the given storage key.
+func (c *Etcd3Backend) keyPath(key string) string {
+	return path.Join(c.path, key)
+}
+
+// lockPath returns the etcd prefix for the lock with the given key. Locks
+// live beside the data prefix rather than under it so that their keys never
+// show up in listings.
+func (c *Etcd3Backend) lockPath(key string) string {
+	return path.Join(c.path+EtcdNodeLockPrefix+"locks", key)
+}
+
+// LockWith is used for mutual exclusion based on the given key.
+func (c *Etcd3Backend) LockWith(key, value string) (Lock, error) {
+	return &Etcd3Lock{
+		etcd:   c.etcd,
+		prefix: c.lockPath(key),
+		value:  value,
+	}, nil
+}
+
+// HAEnabled indicates whether the HA functionality should be exposed.
+func (c *Etcd3Backend) HAEnabled() bool {
+	return c.haEnabled
+}
+
+// Etcd3Lock implements a lock using an etcd v3 session and mutex. The lock
+// is lost when the session's lease can no longer be kept alive.
+type Etcd3Lock struct {
+	etcd          *clientv3.Client
+	prefix, value string
+
+	lock    sync.Mutex
+	session *concurrency.Session
+	mutex   *concurrency.Mutex
+}
+
+// Lock attempts to acquire the lock, blocking until it is successful or the
+// provided channel is closed. The returned channel is closed when the lock
+// is lost.
+func (c *Etcd3Lock) Lock(stopCh <-chan struct{}) (<-chan struct{}, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.session != nil {
+		return nil, EtcdLockHeldError
+	}
+
+	session, err := concurrency.NewSession(c.etcd, concurrency.WithTTL(etcd3LockTTL))
+	if err != nil {
+		return nil, err
+	}
+	mutex := concurrency.NewMutex(session, c.prefix)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-stopCh:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	if err := mutex.Lock(ctx); err != nil {
+		session.Close()
+		if ctx.Err() == context.Canceled {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	// The mutex key is created empty; store our value on it so that other
+	// nodes can find the current holder.
+	putCtx, putCancel := context.WithTimeout(context.Background(), etcd3RequestTimeout)
+	_, err = c.etcd.Put(putCtx, mutex.Key(), c.value, clientv3.WithLease(session.Lease()))
+	putCancel()
+	if err != nil {
+		session.Close()
+		return nil, err
+	}
+
+	c.session = session
+	c.mutex = mutex
+	return session.Done(), nil
+}
+
+// Unlock releases the lock and revokes the session backing it.
+func (c *Etcd3Lock) Unlock() error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.session == nil {
+		return EtcdLockNotHeldError
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), etcd3RequestTimeout)
+	err := c.mutex.Unlock(ctx)
+	cancel()
+	if closeErr := c.session.Close(); err == nil {
+		err = closeErr
+	}
+	c.session = nil
+	c.mutex = nil
+	return err
+}
+
+// Value checks whether or not the lock is held by any instance of
+// Etcd3Lock, including this one, and returns the current value.
+func (c *Etcd3Lock) Value() (bool, string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), etcd3RequestTimeout)
+	defer cancel()
+
+	// The oldest key under the prefix belongs to the holder.
+	resp, err := c.etcd.Get(ctx, c.prefix+"/", clientv3.WithPrefix(),
+		clientv3.WithSort(clientv3.SortByCreateRevision, clientv3.SortAscend))
+	if err != nil {
+		return false, "", err
+	}
+	if len(resp.Kvs) == 0 {
+		return false, "", nil
+	}
+	return true, string(resp.Kvs[0].Value), nil
+}
@@ -10,6 +10,7 @@ import (
 	log "github.com/mgutz/logxi/v1"
 
 	"github.com/coreos/etcd/client"
+	"github.com/coreos/etcd/clientv3"
 	"golang.org/x/net/context"
 )
 
@@ -68,3 +69,56 @@ func TestEtcdBackend(t *testing.T) {
 	}
 	testHABackend(t, ha, ha)
 }
+
+func TestEtcd3Backend(t *testing.T) {
+	addr := os.Getenv("ETCD_ADDR")
+	if addr == "" {
+		t.SkipNow()
+	}
+
+	randPath := fmt.Sprintf("/vault-%d", time.Now().Unix())
+
+	logger := logformat.NewVaultLogger(log.LevelTrace)
+
+	b, err := NewBackend("etcd", logger, map[string]string{
+		"path":     randPath,
+		"etcd_api": "3",
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer func() {
+		etcd := b.(*Etcd3Backend).etcd
+		if _, err := etcd.Delete(context.Background(), randPath, clientv3.WithPrefix()); err != nil {
+			t.Fatalf("err: %v", err)
+		}
+	}()
+
+	testBackend(t, b)
+	testBackend_ListPrefix(t, b)
+	testTransactionalBackend(t, b)
+
+	ha, ok := b.(HABackend)
+	if !ok {
+		t.Fatalf("etcd does not implement HABackend")
+	}
+	testHABackend(t, ha, ha)
+}
+
+func TestEtcd3Backend_TransactionTooLarge(t *testing.T) {
+	b := &Etcd3Backend{
+		path:       "/vault",
+		permitPool: NewPermitPool(DefaultParallelOperations),
+	}
+
+	txns := make([]TxnEntry, 0, etcd3MaxTxnOps+1)
+	for i := 0; i <= etcd3MaxTxnOps; i++ {
+		txns = append(txns, TxnEntry{
+			Operation: DeleteOperation,
+			Entry:     &Entry{Key: fmt.Sprintf("foo/%d", i)},
+		})
+	}
+	if err := b.Transaction(txns); err != ErrTransactionTooLarge {
+		t.Fatalf("bad: %v", err)
+	}
+}
@@ -9,11 +9,18 @@ import (
 	"strings"
 	"sync"
 
+	"github.com/hashicorp/errwrap"
+
 	log "github.com/mgutz/logxi/v1"
 
 	"github.com/hashicorp/vault/helper/jsonutil"
 )
 
+// fileJournalName is the name of the journal file kept at the root of
+// the storage path while a transaction is being applied. Since all entries
+// are stored with a leading underscore it can never collide with a key.
+const fileJournalName = ".txn_journal"
+
 // FileBackend is a physical backend that stores data on disk
 // at a given file path. It can be used for durable single server
 // situations, or to develop locally where durability is not critical.
@@ -34,20 +41,34 @@ func newFileBackend(conf map[string]string, logger log.Logger) (Backend, error)
 		return nil, fmt.Errorf("'path' must be set")
 	}
 
-	return &FileBackend{
+	b := &FileBackend{
 		Path:   path,
 		logger: logger,
-	}, nil
+	}
+
+	// Finish any transaction that was interrupted before it could be
+	// fully applied
+	if err := b.replayJournal(); err != nil {
+		return nil, errwrap.Wrapf("failed to replay transaction journal: {{err}}", err)
+	}
+
+	return b, nil
 }
 
 func (b *FileBackend) Delete(path string) error {
+	b.l.Lock()
+	defer b.l.Unlock()
+
+	return b.delete(path)
+}
+
+// delete removes the entry at the given path. The caller must hold the
+// lock.
+func (b *FileBackend) delete(path string) error {
 	if path == "" {
 		return nil
 	}
 
-	b.l.Lock()
-	defer b.l.Unlock()
-
 	basePath, key := b.path(path)
 	fullPath := filepath.Join(basePath, key)
 
@@ -121,11 +142,16 @@ func (b *FileBackend) Get(k string) (*Entry, error) {
 }
 
 func (b *FileBackend) Put(entry *Entry) error {
-	path, key := b.path(entry.Key)
-
 	b.l.Lock()
 	defer b.l.Unlock()
 
+	return b.put(entry)
+}
+
+// put writes the given entry to disk. The caller must hold the lock.
+func (b *FileBackend) put(entry *Entry) error {
+	path, key := b.path(entry.Key)
+
 	// Make the parent tree
 	if err := os.MkdirAll(path, 0755); err != nil {
 		return err
@@ -169,15 +195,21 @@ func (b *FileBackend) List(prefix string) ([]string, error) {
 		return nil, err
 	}
 
-	for i, name := range names {
+	out := make([]string, 0, len(names))
+	for _, name := range names {
+		// The journal is not an entry and must never be listed
+		if prefix == "" && name == fileJournalName {
+			continue
+		}
+
 		if name[0] == '_' {
-			names[i] = name[1:]
+			out = append(out, name[1:])
 		} else {
-			names[i] = name + "/"
+			out = append(out, name+"/")
 		}
 	}
 
-	return names, nil
+	return out, nil
 }
 
 func (b *FileBackend) path(k string) (string, string) {
@@ -186,3 +218,132 @@ func (b *FileBackend) path(k string) (string, string) {
 	path = filepath.Dir(path)
 	return path, "_" + key
 }
+
+// Transaction is used to run multiple entries via a transaction. The
+// operations are first written to a journal which is atomically moved into
+// place before any entry is touched. If Vault stops before the operations
+// have all been applied, the journal is replayed the next time the backend
+// is created, so either every operation takes effect or none does. The lock
+// is held from writing the journal until it is removed.
+func (b *FileBackend) Transaction(txns []TxnEntry) error {
+	if err := validateTxn(txns); err != nil {
+		return err
+	}
+
+	b.l.Lock()
+	defer b.l.Unlock()
+
+	if err := os.MkdirAll(b.Path, 0755); err != nil {
+		return err
+	}
+
+	// A journal left behind by a transaction that failed to apply must be
+	// finished first, or it would be overwritten by this one
+	if err := b.replayJournalLocked(); err != nil {
+		return errwrap.Wrapf("failed to replay transaction journal: {{err}}", err)
+	}
+
+	// Write the journal to a temporary file and rename it so that a partially
+	// written journal is never mistaken for a committed one
+	journalPath := filepath.Join(b.Path, fileJournalName)
+	tmpPath := journalPath + ".tmp"
+	f, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	if err := json.NewEncoder(f).Encode(txns); err != nil {
+		f.Close()
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to encode transaction journal: %v", err)
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		os.Remove(tmpPath)
+		return err
+	}
+	f.Close()
+	if err := os.Rename(tmpPath, journalPath); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+
+	// The transaction is now committed; apply it and retire the journal. If
+	// applying fails the journal stays in place and is replayed by the next
+	// transaction or when the backend is created again.
+	if err := b.applyTxns(txns); err != nil {
+		return err
+	}
+	return os.Remove(journalPath)
+}
+
+// applyTxns applies the given operations in order. The caller must hold
+// the lock.
+func (b *FileBackend) applyTxns(txns []TxnEntry) error {
+	for _, txn := range txns {
+		var err error
+		switch txn.Operation {
+		case PutOperation:
+			err = b.put(txn.Entry)
+		case DeleteOperation:
+			err = b.delete(txn.Entry.Key)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// replayJournal applies and removes a journal left behind by a transaction
+// that was committed but not fully applied.
+func (b *FileBackend) replayJournal() error {
+	b.l.Lock()
+	defer b.l.Unlock()
+
+	return b.replayJournalLocked()
+}
+
+// replayJournalLocked does the work of replayJournal. Operations are
+// idempotent so replaying a journal that was partially applied is safe. The
+// caller must hold the lock.
+func (b *FileBackend) replayJournalLocked() error {
+	// Nothing can have been journaled unless the path is a directory
+	info, err := os.Stat(b.Path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	if !info.IsDir() {
+		return nil
+	}
+
+	// An uncommitted journal is simply discarded
+	journalPath := filepath.Join(b.Path, fileJournalName)
+	if err := os.Remove(journalPath + ".tmp"); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	f, err := os.Open(journalPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	defer f.Close()
+
+	var txns []TxnEntry
+	if err := jsonutil.DecodeJSONFromReader(f, &txns); err != nil {
+		return err
+	}
+
+	if b.logger != nil {
+		b.logger.Warn("physical/file: replaying interrupted transaction", "operations", len(txns))
+	}
+	if err := b.applyTxns(txns); err != nil {
+		return err
+	}
+	return os.Remove(journalPath)
+}
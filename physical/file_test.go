@@ -1,8 +1,10 @@
 package physical
 
 import (
+	"encoding/json"
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/hashicorp/vault/helper/logformat"
@@ -27,4 +29,127 @@ func TestFileBackend(t *testing.T) {
 
 	testBackend(t, b)
 	testBackend_ListPrefix(t, b)
+	testTransactionalBackend(t, b)
+}
+
+func TestFileBackend_JournalReplay(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vault")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	logger := logformat.NewVaultLogger(log.LevelTrace)
+
+	// Simulate a transaction that was committed but never applied
+	txns := []TxnEntry{
+		TxnEntry{
+			Operation: PutOperation,
+			Entry:     &Entry{Key: "foo/bar", Value: []byte("baz")},
+		},
+	}
+	buf, err := json.Marshal(txns)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, fileJournalName), buf, 0600); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	b, err := NewBackend("file", logger, map[string]string{
+		"path": dir,
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	out, err := b.Get("foo/bar")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if out == nil || string(out.Value) != "baz" {
+		t.Fatalf("bad: %v", out)
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, fileJournalName)); !os.IsNotExist(err) {
+		t.Fatalf("expected journal to be removed, got: %v", err)
+	}
+
+	keys, err := b.List("")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if len(keys) != 1 || keys[0] != "foo/" {
+		t.Fatalf("bad: %v", keys)
+	}
+}
+
+func TestFileBackend_TransactionReplaysJournal(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vault")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	logger := logformat.NewVaultLogger(log.LevelTrace)
+
+	b, err := NewBackend("file", logger, map[string]string{
+		"path": dir,
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// Simulate a transaction whose journal was left behind because applying
+	// it failed
+	buf, err := json.Marshal([]TxnEntry{
+		TxnEntry{
+			Operation: PutOperation,
+			Entry:     &Entry{Key: "foo", Value: []byte("bar")},
+		},
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, fileJournalName), buf, 0600); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	err = b.(Transactional).Transaction([]TxnEntry{
+		TxnEntry{
+			Operation: PutOperation,
+			Entry:     &Entry{Key: "zip", Value: []byte("zap")},
+		},
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	for key, value := range map[string]string{"foo": "bar", "zip": "zap"} {
+		out, err := b.Get(key)
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if out == nil || string(out.Value) != value {
+			t.Fatalf("bad: %s: %v", key, out)
+		}
+	}
+}
+
+func TestFileBackend_NotDirectory(t *testing.T) {
+	f, err := ioutil.TempFile("", "vault")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	f.Close()
+	defer os.Remove(f.Name())
+
+	logger := logformat.NewVaultLogger(log.LevelTrace)
+
+	// The path is only used once entries are accessed
+	if _, err := NewBackend("file", logger, map[string]string{
+		"path": f.Name(),
+	}); err != nil {
+		t.Fatalf("err: %s", err)
+	}
 }
@@ -67,6 +67,31 @@ func (i *InmemBackend) Delete(key string) error {
 	return nil
 }
 
+// Transaction is used to run multiple entries via a transaction. All of
+// the operations are applied while holding the write lock so that no
+// reader can observe a partially applied transaction.
+func (i *InmemBackend) Transaction(txns []TxnEntry) error {
+	if err := validateTxn(txns); err != nil {
+		return err
+	}
+
+	i.permitPool.Acquire()
+	defer i.permitPool.Release()
+
+	i.l.Lock()
+	defer i.l.Unlock()
+
+	for _, txn := range txns {
+		switch txn.Operation {
+		case PutOperation:
+			i.root.Insert(txn.Entry.Key, txn.Entry)
+		case DeleteOperation:
+			i.root.Delete(txn.Entry.Key)
+		}
+	}
+	return nil
+}
+
 // List is used ot list all the keys under a given
 // prefix, up to the next prefix.
 func (i *InmemBackend) List(prefix string) ([]string, error) {
@@ -165,6 +165,34 @@ func (m *MySQLBackend) Delete(key string) error {
 	return nil
 }
 
+// Transaction is used to run multiple entries via a transaction.
+func (m *MySQLBackend) Transaction(txns []TxnEntry) error {
+	defer metrics.MeasureSince([]string{"mysql", "transaction"}, time.Now())
+	if err := validateTxn(txns); err != nil {
+		return err
+	}
+
+	tx, err := m.client.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %v", err)
+	}
+
+	for _, txn := range txns {
+		switch txn.Operation {
+		case PutOperation:
+			_, err = tx.Stmt(m.statements["put"]).Exec(txn.Entry.Key, txn.Entry.Value)
+		case DeleteOperation:
+			_, err = tx.Stmt(m.statements["delete"]).Exec(txn.Entry.Key)
+		}
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
 // List is used to list all the keys under a given
 // prefix, up to the next prefix.
 func (m *MySQLBackend) List(prefix string) ([]string, error) {
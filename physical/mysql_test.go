@@ -54,5 +54,6 @@ func TestMySQLBackend(t *testing.T) {
 
 	testBackend(t, b)
 	testBackend_ListPrefix(t, b)
+	testTransactionalBackend(t, b)
 
 }
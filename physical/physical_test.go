@@ -281,6 +281,112 @@ func testBackend_ListPrefix(t *testing.T, b Backend) {
 
 }
 
+func testTransactionalBackend(t *testing.T, b Backend) {
+	txnBackend, ok := b.(Transactional)
+	if !ok {
+		t.Fatalf("backend does not implement Transactional")
+	}
+
+	// Seed an entry that the transaction will delete
+	err := b.Put(&Entry{Key: "txn/delete", Value: []byte("old")})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	txns := []TxnEntry{
+		TxnEntry{
+			Operation: PutOperation,
+			Entry:     &Entry{Key: "txn/foo", Value: []byte("bar")},
+		},
+		TxnEntry{
+			Operation: PutOperation,
+			Entry:     &Entry{Key: "txn/nested/zip", Value: []byte("zap")},
+		},
+		TxnEntry{
+			Operation: DeleteOperation,
+			Entry:     &Entry{Key: "txn/delete"},
+		},
+	}
+	if err := txnBackend.Transaction(txns); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	out, err := b.Get("txn/foo")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if out == nil || string(out.Value) != "bar" {
+		t.Fatalf("bad: %v", out)
+	}
+	out, err = b.Get("txn/nested/zip")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if out == nil || string(out.Value) != "zap" {
+		t.Fatalf("bad: %v", out)
+	}
+	out, err = b.Get("txn/delete")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if out != nil {
+		t.Fatalf("bad: %v", out)
+	}
+
+	keys, err := b.List("txn/")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	sort.Strings(keys)
+	if !reflect.DeepEqual(keys, []string{"foo", "nested/"}) {
+		t.Fatalf("bad: %v", keys)
+	}
+
+	// Invalid transactions should be rejected without applying anything
+	err = txnBackend.Transaction([]TxnEntry{
+		TxnEntry{
+			Operation: PutOperation,
+			Entry:     &Entry{Key: "txn/invalid", Value: []byte("bad")},
+		},
+		TxnEntry{
+			Operation: Operation("frob"),
+			Entry:     &Entry{Key: "txn/foo"},
+		},
+	})
+	if err == nil {
+		t.Fatalf("expected error")
+	}
+	out, err = b.Get("txn/invalid")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if out != nil {
+		t.Fatalf("bad: %v", out)
+	}
+
+	// Clean up
+	err = txnBackend.Transaction([]TxnEntry{
+		TxnEntry{
+			Operation: DeleteOperation,
+			Entry:     &Entry{Key: "txn/foo"},
+		},
+		TxnEntry{
+			Operation: DeleteOperation,
+			Entry:     &Entry{Key: "txn/nested/zip"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	keys, err = b.List("txn/")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if len(keys) != 0 {
+		t.Fatalf("bad: %v", keys)
+	}
+}
+
 func testHABackend(t *testing.T, b HABackend, b2 HABackend) {
 	// Get the lock
 	lock, err := b.LockWith("foo", "bar")
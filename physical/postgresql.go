@@ -150,6 +150,35 @@ func (m *PostgreSQLBackend) Delete(fullPath string) error {
 	return nil
 }
 
+// Transaction is used to run multiple entries via a transaction.
+func (m *PostgreSQLBackend) Transaction(txns []TxnEntry) error {
+	defer metrics.MeasureSince([]string{"postgres", "transaction"}, time.Now())
+	if err := validateTxn(txns); err != nil {
+		return err
+	}
+
+	tx, err := m.client.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %v", err)
+	}
+
+	for _, txn := range txns {
+		parentPath, path, key := m.splitKey(txn.Entry.Key)
+		switch txn.Operation {
+		case PutOperation:
+			_, err = tx.Exec(m.put_query, parentPath, path, key, txn.Entry.Value)
+		case DeleteOperation:
+			_, err = tx.Exec(m.delete_query, path, key)
+		}
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
 // List is used to list all the keys under a given
 // prefix, up to the next prefix.
 func (m *PostgreSQLBackend) List(prefix string) ([]string, error) {
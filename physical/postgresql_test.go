@@ -43,5 +43,6 @@ func TestPostgreSQLBackend(t *testing.T) {
 
 	testBackend(t, b)
 	testBackend_ListPrefix(t, b)
+	testTransactionalBackend(t, b)
 
 }
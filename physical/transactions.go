@@ -0,0 +1,55 @@
+package physical
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrTransactionUnsupported is returned when a transaction is requested
+// against a storage layer whose underlying physical backend does not
+// implement the Transactional interface.
+var ErrTransactionUnsupported = errors.New("physical backend does not support transactions")
+
+// ErrTransactionTooLarge is returned when a transaction contains more
+// operations than the physical backend can apply atomically.
+var ErrTransactionTooLarge = errors.New("transaction contains more operations than the physical backend supports")
+
+// Operation is the type of a single operation within a transaction
+type Operation string
+
+const (
+	DeleteOperation Operation = "delete"
+	PutOperation    Operation = "put"
+)
+
+// TxnEntry is an operation that takes place atomically as part of
+// a transactional update. For delete operations only the key of the
+// entry is used.
+type TxnEntry struct {
+	Operation Operation
+	Entry     *Entry
+}
+
+// Transactional is an optional interface for backends that
+// support doing transactional updates of multiple keys. Either
+// all of the given operations are applied or none of them are.
+type Transactional interface {
+	// Transaction is used to run multiple entries via a transaction
+	Transaction([]TxnEntry) error
+}
+
+// validateTxn is used to sanity check a set of transaction entries
+// before they are handed to a backend
+func validateTxn(txns []TxnEntry) error {
+	for i, txn := range txns {
+		if txn.Entry == nil {
+			return fmt.Errorf("transaction entry %d is missing an entry", i)
+		}
+		switch txn.Operation {
+		case PutOperation, DeleteOperation:
+		default:
+			return fmt.Errorf("transaction entry %d has unsupported operation %q", i, txn.Operation)
+		}
+	}
+	return nil
+}
@@ -14,6 +14,11 @@ type ACL struct {
 	// globRules contains the path policies that glob
 	globRules *radix.Tree
 
+	// exactControlGroups and globControlGroups contain the control groups
+	// of the rules with the same prefix in exactRules and globRules
+	exactControlGroups *radix.Tree
+	globControlGroups  *radix.Tree
+
 	// root is enabled if the "root" named policy is present.
 	root bool
 }
@@ -22,9 +27,11 @@ type ACL struct {
 func NewACL(policies []*Policy) (*ACL, error) {
 	// Initialize
 	a := &ACL{
-		exactRules: radix.New(),
-		globRules:  radix.New(),
-		root:       false,
+		exactRules:         radix.New(),
+		globRules:          radix.New(),
+		exactControlGroups: radix.New(),
+		globControlGroups:  radix.New(),
+		root:               false,
 	}
 
 	// Inject each policy
@@ -40,8 +47,29 @@ func NewACL(policies []*Policy) (*ACL, error) {
 		for _, pc := range policy.Paths {
 			// Check which tree to use
 			tree := a.exactRules
+			cgTree := a.exactControlGroups
 			if pc.Glob {
 				tree = a.globRules
+				cgTree = a.globControlGroups
+			}
+
+			// Control groups of the same path are combined so that the
+			// factors of all of them have to be satisfied
+			if pc.ControlGroup != nil {
+				raw, ok := cgTree.Get(pc.Prefix)
+				if !ok {
+					cgTree.Insert(pc.Prefix, pc.ControlGroup)
+				} else {
+					existing := raw.(*ControlGroup)
+					merged := &ControlGroup{
+						TTL:     existing.TTL,
+						Factors: append(append([]*ControlGroupFactor{}, existing.Factors...), pc.ControlGroup.Factors...),
+					}
+					if merged.TTL == 0 || (pc.ControlGroup.TTL != 0 && pc.ControlGroup.TTL < merged.TTL) {
+						merged.TTL = pc.ControlGroup.TTL
+					}
+					cgTree.Insert(pc.Prefix, merged)
+				}
 			}
 
 			// Check for an existing policy
@@ -121,6 +149,28 @@ CHECK:
 	return
 }
 
+// ControlGroup returns the control group of the rule matching the given path,
+// or nil if there is none
+func (a *ACL) ControlGroup(path string) *ControlGroup {
+	// Root is never held back
+	if a.root {
+		return nil
+	}
+
+	// The control group is the one of the rule used to check capabilities
+	var raw interface{}
+	var ok bool
+	if _, exact := a.exactRules.Get(path); exact {
+		raw, ok = a.exactControlGroups.Get(path)
+	} else if prefix, _, glob := a.globRules.LongestPrefix(path); glob {
+		raw, ok = a.globControlGroups.Get(prefix)
+	}
+	if !ok {
+		return nil
+	}
+	return raw.(*ControlGroup)
+}
+
 // AllowOperation is used to check if the given operation is permitted. The
 // first bool indicates if an op is allowed, the second whether sudo priviliges
 // exist for that op and path.
@@ -3,6 +3,7 @@ package vault
 import (
 	"reflect"
 	"testing"
+	"time"
 
 	"github.com/hashicorp/vault/logical"
 )
@@ -206,6 +207,68 @@ path "auth/token/create*" {
 }
 `
 
+func TestACL_ControlGroup(t *testing.T) {
+	var policies []*Policy
+	for _, raw := range []string{`
+path "secret/*" {
+	capabilities = ["read"]
+	control_group {
+		ttl = "4h"
+		factor "managers" {
+			policies = ["managers"]
+		}
+	}
+}
+path "secret/open" {
+	capabilities = ["read"]
+}
+`, `
+path "secret/*" {
+	capabilities = ["list"]
+	control_group {
+		ttl = "1h"
+		factor "security" {
+			policies = ["security"]
+		}
+	}
+}
+`} {
+		p, err := Parse(raw)
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		policies = append(policies, p)
+	}
+
+	acl, err := NewACL(policies)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	// The control groups of both policies are combined
+	cg := acl.ControlGroup("secret/foo")
+	if cg == nil || cg.TTL != time.Hour || len(cg.Factors) != 2 {
+		t.Fatalf("bad: %#v", cg)
+	}
+
+	// The exact rule takes precedence and has no control group
+	if cg := acl.ControlGroup("secret/open"); cg != nil {
+		t.Fatalf("bad: %#v", cg)
+	}
+	if cg := acl.ControlGroup("other/foo"); cg != nil {
+		t.Fatalf("bad: %#v", cg)
+	}
+
+	// Root is never held back
+	acl, err = NewACL(append(policies, &Policy{Name: "root"}))
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if cg := acl.ControlGroup("secret/foo"); cg != nil {
+		t.Fatalf("bad: %#v", cg)
+	}
+}
+
 var aclPolicy = `
 name = "dev"
 path "dev/*" {
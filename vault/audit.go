@@ -68,6 +68,18 @@ func (c *Core) enableAudit(entry *MountEntry) error {
 		}
 	}
 
+	// Compile the filter before anything is created
+	filter, err := entryAuditFilter(entry)
+	if err != nil {
+		return err
+	}
+
+	newTable := c.audit.shallowClone()
+	newTable.Entries = append(newTable.Entries, entry)
+	if err := c.checkAuditFilters(newTable); err != nil {
+		return err
+	}
+
 	// Generate a new UUID and view
 	entryUUID, err := uuid.GenerateUUID()
 	if err != nil {
@@ -82,8 +94,6 @@ func (c *Core) enableAudit(entry *MountEntry) error {
 		return err
 	}
 
-	newTable := c.audit.shallowClone()
-	newTable.Entries = append(newTable.Entries, entry)
 	if err := c.persistAudit(newTable); err != nil {
 		return errors.New("failed to update audit table")
 	}
@@ -91,7 +101,7 @@ func (c *Core) enableAudit(entry *MountEntry) error {
 	c.audit = newTable
 
 	// Register the backend
-	c.auditBroker.Register(entry.Path, backend, view)
+	c.auditBroker.RegisterWithFilter(entry.Path, backend, view, filter)
 	if c.logger.IsInfo() {
 		c.logger.Info("core: enabled audit backend", "path", entry.Path, "type", entry.Type)
 	}
@@ -117,6 +127,10 @@ func (c *Core) disableAudit(path string) (bool, error) {
 		return false, fmt.Errorf("no matching backend")
 	}
 
+	if err := c.checkAuditFilters(newTable); err != nil {
+		return true, err
+	}
+
 	c.removeAuditReloadFunc(entry)
 
 	// Update the audit table
@@ -228,16 +242,28 @@ func (c *Core) persistAudit(table *MountTable) error {
 // initialize the audit backends
 func (c *Core) setupAudits() error {
 	broker := NewAuditBroker(c.logger)
+	broker.router = c.router
+	broker.requireUnfiltered = c.auditRequireUnfiltered
 
 	c.auditLock.Lock()
 	defer c.auditLock.Unlock()
 
+	if err := c.checkAuditFilters(c.audit); err != nil {
+		c.logger.Warn("core: audit table does not meet filter requirements", "error", err)
+	}
+
 	var successCount int
 
 	for _, entry := range c.audit.Entries {
 		// Create a barrier view using the UUID
 		view := NewBarrierView(c.barrier, auditBarrierPrefix+entry.UUID+"/")
 
+		filter, err := entryAuditFilter(entry)
+		if err != nil {
+			c.logger.Error("core: failed to parse audit filter", "path", entry.Path, "error", err)
+			continue
+		}
+
 		// Initialize the backend
 		audit, err := c.newAuditBackend(entry, view, entry.Options)
 		if err != nil {
@@ -246,7 +272,7 @@ func (c *Core) setupAudits() error {
 		}
 
 		// Mount the backend
-		broker.Register(entry.Path, audit, view)
+		broker.RegisterWithFilter(entry.Path, audit, view, filter)
 
 		successCount += 1
 	}
@@ -339,6 +365,34 @@ func (c *Core) newAuditBackend(entry *MountEntry, view logical.Storage, conf map
 	return be, err
 }
 
+// entryAuditFilter compiles the filter of an audit table entry, returning
+// nil if it has none
+func entryAuditFilter(entry *MountEntry) (*auditFilter, error) {
+	if strings.TrimSpace(entry.Filter) == "" {
+		return nil, nil
+	}
+	filter, err := parseAuditFilter(entry.Filter)
+	if err != nil {
+		return nil, fmt.Errorf("invalid audit filter: %v", err)
+	}
+	return filter, nil
+}
+
+// checkAuditFilters ensures that, if required, an audit table with any
+// backends has at least one backend without a filter, so that every request
+// is sent to some backend
+func (c *Core) checkAuditFilters(table *MountTable) error {
+	if !c.auditRequireUnfiltered || table == nil || len(table.Entries) == 0 {
+		return nil
+	}
+	for _, entry := range table.Entries {
+		if strings.TrimSpace(entry.Filter) == "" {
+			return nil
+		}
+	}
+	return fmt.Errorf("at least one audit backend must be enabled without a filter")
+}
+
 // defaultAuditTable creates a default audit table
 func defaultAuditTable() *MountTable {
 	table := &MountTable{
@@ -350,6 +404,7 @@ func defaultAuditTable() *MountTable {
 type backendEntry struct {
 	backend audit.Backend
 	view    *BarrierView
+	filter  *auditFilter
 }
 
 // AuditBroker is used to provide a single ingest interface to auditable
@@ -358,6 +413,14 @@ type AuditBroker struct {
 	sync.RWMutex
 	backends map[string]backendEntry
 	logger   log.Logger
+
+	// router is used to find the mount serving a request when evaluating
+	// filters. If nil, filters see no mount path or type.
+	router *Router
+
+	// requireUnfiltered fails requests and responses excluded by the
+	// filters of every backend, rather than leaving them unaudited
+	requireUnfiltered bool
 }
 
 // NewAuditBroker creates a new audit broker
@@ -371,11 +434,18 @@ func NewAuditBroker(log log.Logger) *AuditBroker {
 
 // Register is used to add new audit backend to the broker
 func (a *AuditBroker) Register(name string, b audit.Backend, v *BarrierView) {
+	a.RegisterWithFilter(name, b, v, nil)
+}
+
+// RegisterWithFilter is used to add a new audit backend to the broker that
+// only receives the events matched by the given filter
+func (a *AuditBroker) RegisterWithFilter(name string, b audit.Backend, v *BarrierView, filter *auditFilter) {
 	a.Lock()
 	defer a.Unlock()
 	a.backends[name] = backendEntry{
 		backend: b,
 		view:    v,
+		filter:  filter,
 	}
 }
 
@@ -406,6 +476,40 @@ func (a *AuditBroker) GetHash(name string, input string) (string, error) {
 	return be.backend.GetHash(input), nil
 }
 
+// GetHashChainKey returns the key that the given backend uses to chain its
+// entries
+func (a *AuditBroker) GetHashChainKey(name string) (string, error) {
+	a.RLock()
+	defer a.RUnlock()
+	be, ok := a.backends[name]
+	if !ok {
+		return "", fmt.Errorf("unknown audit backend %s", name)
+	}
+
+	keyer, ok := be.backend.(audit.HashChainKeyer)
+	if !ok || keyer.HashChainKey() == "" {
+		return "", fmt.Errorf("audit backend %s does not hash chain its entries", name)
+	}
+	return keyer.HashChainKey(), nil
+}
+
+// GetStatus returns the status reported by the given backend, or nil if the
+// backend does not report one
+func (a *AuditBroker) GetStatus(name string) map[string]interface{} {
+	a.RLock()
+	defer a.RUnlock()
+	be, ok := a.backends[name]
+	if !ok {
+		return nil
+	}
+
+	reporter, ok := be.backend.(audit.StatusReporter)
+	if !ok {
+		return nil
+	}
+	return reporter.Status()
+}
+
 // LogRequest is used to ensure all the audit backends have an opportunity to
 // log the given request and that *at least one* succeeds.
 func (a *AuditBroker) LogRequest(auth *logical.Auth, req *logical.Request, outerErr error) (retErr error) {
@@ -426,9 +530,20 @@ func (a *AuditBroker) LogRequest(auth *logical.Auth, req *logical.Request, outer
 	//	return
 	//}
 
-	// Ensure at least one backend logs
+	event := newAuditEvent(a.router, auth, req, nil, outerErr)
+
+	// Ensure at least one backend logs. A request excluded by the filters
+	// of every backend is not audited, which is only an error if every
+	// request is required to reach some backend.
 	anyLogged := false
+	anyMatched := false
 	for name, be := range a.backends {
+		if !be.filter.MatchesRequest(event) {
+			metrics.IncrCounter([]string{"audit", name, "filtered"}, 1)
+			continue
+		}
+		anyMatched = true
+
 		start := time.Now()
 		err := be.backend.LogRequest(auth, req, outerErr)
 		metrics.MeasureSince([]string{"audit", name, "log_request"}, start)
@@ -438,7 +553,14 @@ func (a *AuditBroker) LogRequest(auth *logical.Auth, req *logical.Request, outer
 			anyLogged = true
 		}
 	}
-	if !anyLogged && len(a.backends) > 0 {
+	if len(a.backends) > 0 && !anyMatched {
+		metrics.IncrCounter([]string{"audit", "log_request_filtered"}, 1)
+		if a.requireUnfiltered {
+			retErr = multierror.Append(retErr, fmt.Errorf("request was excluded by the filters of every audit backend"))
+		}
+		return
+	}
+	if anyMatched && !anyLogged {
 		retErr = multierror.Append(retErr, fmt.Errorf("no audit backend succeeded in logging the request"))
 		return
 	}
@@ -459,9 +581,19 @@ func (a *AuditBroker) LogResponse(auth *logical.Auth, req *logical.Request,
 		}
 	}()
 
-	// Ensure at least one backend logs
+	event := newAuditEvent(a.router, auth, req, resp, err)
+
+	// Ensure at least one backend logs. As with requests, a response
+	// excluded by the filters of every backend only fails if required.
 	anyLogged := false
+	anyMatched := false
 	for name, be := range a.backends {
+		if !be.filter.Matches(event) {
+			metrics.IncrCounter([]string{"audit", name, "filtered"}, 1)
+			continue
+		}
+		anyMatched = true
+
 		start := time.Now()
 		err := be.backend.LogResponse(auth, req, resp, err)
 		metrics.MeasureSince([]string{"audit", name, "log_response"}, start)
@@ -471,7 +603,14 @@ func (a *AuditBroker) LogResponse(auth *logical.Auth, req *logical.Request,
 			anyLogged = true
 		}
 	}
-	if !anyLogged && len(a.backends) > 0 {
+	if len(a.backends) > 0 && !anyMatched {
+		metrics.IncrCounter([]string{"audit", "log_response_filtered"}, 1)
+		if a.requireUnfiltered {
+			return fmt.Errorf("response was excluded by the filters of every audit backend")
+		}
+		return nil
+	}
+	if anyMatched && !anyLogged {
 		return fmt.Errorf("no audit backend succeeded in logging the response")
 	}
 	return nil
@@ -0,0 +1,384 @@
+package vault
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/hashicorp/vault/logical"
+)
+
+// auditFilter is a compiled audit filter expression. Only events for which
+// the expression evaluates to true are sent to the audit backend it is
+// attached to.
+//
+// The expression language is small: comparisons of an event field against a
+// quoted string, combined with "and", "or", "not" and parentheses, where
+// "and" binds tighter than "or". The supported fields are:
+//
+//	mount_path   - the path of the mount serving the request, e.g. "transit/"
+//	mount_type   - the type of the mount serving the request, e.g. "transit"
+//	operation    - the request operation, e.g. "read" or "update"
+//	path         - the full request path
+//	display_name - the display name of the token making the request
+//
+// Fields are compared with "==", "!=" or "prefix". The bare word "error"
+// is true when the request failed, whether it was rejected or returned an
+// error response. For example:
+//
+//	mount_type != "transit" or error
+//	operation == "update" and not (path prefix "secret/public/")
+type auditFilter struct {
+	expr   string
+	filter filterNode
+}
+
+// auditEvent holds the properties of a request that filters match against
+type auditEvent struct {
+	MountPath   string
+	MountType   string
+	Operation   logical.Operation
+	Path        string
+	DisplayName string
+	Error       bool
+}
+
+// newAuditEvent builds the event for a request and, once it was handled, its
+// response. The router is used to find the mount serving the request and may
+// be nil.
+func newAuditEvent(router *Router, auth *logical.Auth, req *logical.Request,
+	resp *logical.Response, err error) *auditEvent {
+	event := &auditEvent{
+		Operation: req.Operation,
+		Path:      req.Path,
+		Error:     err != nil || resp.IsError(),
+	}
+	if auth != nil {
+		event.DisplayName = auth.DisplayName
+	}
+	if router != nil {
+		event.MountPath = router.MatchingMount(req.Path)
+		if entry := router.MatchingMountEntry(req.Path); entry != nil {
+			event.MountType = entry.Type
+		}
+	}
+	return event
+}
+
+// parseAuditFilter compiles a filter expression
+func parseAuditFilter(expr string) (*auditFilter, error) {
+	tokens, err := lexAuditFilter(expr)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &filterParser{tokens: tokens}
+	node, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if tok := p.peek(); tok.kind != filterTokenEOF {
+		return nil, fmt.Errorf("unexpected %s at position %d", tok, tok.pos)
+	}
+
+	return &auditFilter{
+		expr:   expr,
+		filter: node,
+	}, nil
+}
+
+// Matches returns whether an event passes the filter. A nil filter matches
+// every event.
+func (f *auditFilter) Matches(event *auditEvent) bool {
+	if f == nil {
+		return true
+	}
+	return f.filter.eval(event)
+}
+
+// MatchesRequest returns whether the request of an event may be followed by
+// a response passing the filter. Unless it was rejected, whether a request
+// fails is only known once it was handled, so it is matched if it passes the
+// filter either way. This way every backend logging a response has also
+// logged its request. A nil filter matches every request.
+func (f *auditFilter) MatchesRequest(event *auditEvent) bool {
+	if f == nil || event.Error {
+		return f.Matches(event)
+	}
+	failed := *event
+	failed.Error = true
+	return f.Matches(event) || f.Matches(&failed)
+}
+
+func (f *auditFilter) String() string {
+	if f == nil {
+		return ""
+	}
+	return f.expr
+}
+
+// filterNode is a node of a parsed filter expression
+type filterNode interface {
+	eval(event *auditEvent) bool
+}
+
+type filterAnd struct {
+	left, right filterNode
+}
+
+func (n *filterAnd) eval(event *auditEvent) bool {
+	return n.left.eval(event) && n.right.eval(event)
+}
+
+type filterOr struct {
+	left, right filterNode
+}
+
+func (n *filterOr) eval(event *auditEvent) bool {
+	return n.left.eval(event) || n.right.eval(event)
+}
+
+type filterNot struct {
+	node filterNode
+}
+
+func (n *filterNot) eval(event *auditEvent) bool {
+	return !n.node.eval(event)
+}
+
+type filterError struct{}
+
+func (n *filterError) eval(event *auditEvent) bool {
+	return event.Error
+}
+
+type filterCompare struct {
+	field string
+	op    string
+	value string
+}
+
+func (n *filterCompare) eval(event *auditEvent) bool {
+	var actual string
+	switch n.field {
+	case "mount_path":
+		actual = event.MountPath
+	case "mount_type":
+		actual = event.MountType
+	case "operation":
+		actual = string(event.Operation)
+	case "path":
+		actual = event.Path
+	case "display_name":
+		actual = event.DisplayName
+	}
+
+	switch n.op {
+	case "==":
+		return actual == n.value
+	case "!=":
+		return actual != n.value
+	case "prefix":
+		return strings.HasPrefix(actual, n.value)
+	}
+	return false
+}
+
+// auditFilterFields are the event fields that may be compared
+var auditFilterFields = map[string]bool{
+	"mount_path":   true,
+	"mount_type":   true,
+	"operation":    true,
+	"path":         true,
+	"display_name": true,
+}
+
+type filterTokenKind int
+
+const (
+	filterTokenEOF filterTokenKind = iota
+	filterTokenIdent
+	filterTokenString
+	filterTokenEqual
+	filterTokenNotEqual
+	filterTokenLParen
+	filterTokenRParen
+)
+
+type filterToken struct {
+	kind  filterTokenKind
+	value string
+	pos   int
+}
+
+func (t filterToken) String() string {
+	switch t.kind {
+	case filterTokenEOF:
+		return "end of filter"
+	case filterTokenString:
+		return strconv.Quote(t.value)
+	default:
+		return fmt.Sprintf("%q", t.value)
+	}
+}
+
+// lexAuditFilter splits a filter expression into tokens
+func lexAuditFilter(expr string) ([]filterToken, error) {
+	var tokens []filterToken
+	for i := 0; i < len(expr); {
+		c := expr[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '(':
+			tokens = append(tokens, filterToken{filterTokenLParen, "(", i})
+			i++
+		case c == ')':
+			tokens = append(tokens, filterToken{filterTokenRParen, ")", i})
+			i++
+		case strings.HasPrefix(expr[i:], "=="):
+			tokens = append(tokens, filterToken{filterTokenEqual, "==", i})
+			i += 2
+		case strings.HasPrefix(expr[i:], "!="):
+			tokens = append(tokens, filterToken{filterTokenNotEqual, "!=", i})
+			i += 2
+		case c == '"':
+			value, n, err := unquoteFilterString(expr[i:])
+			if err != nil {
+				return nil, fmt.Errorf("invalid string at position %d: %v", i, err)
+			}
+			tokens = append(tokens, filterToken{filterTokenString, value, i})
+			i += n
+		case c == '_' || unicode.IsLetter(rune(c)):
+			start := i
+			for i < len(expr) && (expr[i] == '_' || unicode.IsLetter(rune(expr[i])) || unicode.IsDigit(rune(expr[i]))) {
+				i++
+			}
+			tokens = append(tokens, filterToken{filterTokenIdent, expr[start:i], start})
+		default:
+			return nil, fmt.Errorf("unexpected character %q at position %d", c, i)
+		}
+	}
+	tokens = append(tokens, filterToken{filterTokenEOF, "", len(expr)})
+	return tokens, nil
+}
+
+// unquoteFilterString reads a double-quoted string from the start of s,
+// returning its value and the number of bytes consumed
+func unquoteFilterString(s string) (string, int, error) {
+	escaped := false
+	for i := 1; i < len(s); i++ {
+		switch {
+		case escaped:
+			escaped = false
+		case s[i] == '\\':
+			escaped = true
+		case s[i] == '"':
+			value, err := strconv.Unquote(s[:i+1])
+			return value, i + 1, err
+		}
+	}
+	return "", 0, fmt.Errorf("unterminated string")
+}
+
+// filterParser is a recursive descent parser for filter expressions
+type filterParser struct {
+	tokens []filterToken
+	pos    int
+}
+
+func (p *filterParser) peek() filterToken {
+	return p.tokens[p.pos]
+}
+
+func (p *filterParser) next() filterToken {
+	tok := p.tokens[p.pos]
+	if tok.kind != filterTokenEOF {
+		p.pos++
+	}
+	return tok
+}
+
+func (p *filterParser) isKeyword(keyword string) bool {
+	tok := p.peek()
+	return tok.kind == filterTokenIdent && tok.value == keyword
+}
+
+func (p *filterParser) parseOr() (filterNode, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.isKeyword("or") {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &filterOr{left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *filterParser) parseAnd() (filterNode, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.isKeyword("and") {
+		p.next()
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = &filterAnd{left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *filterParser) parseUnary() (filterNode, error) {
+	tok := p.next()
+	switch {
+	case tok.kind == filterTokenLParen:
+		node, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if closing := p.next(); closing.kind != filterTokenRParen {
+			return nil, fmt.Errorf("expected \")\" at position %d, got %s", closing.pos, closing)
+		}
+		return node, nil
+
+	case tok.kind == filterTokenIdent && tok.value == "not":
+		node, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &filterNot{node: node}, nil
+
+	case tok.kind == filterTokenIdent && tok.value == "error":
+		return &filterError{}, nil
+
+	case tok.kind == filterTokenIdent && auditFilterFields[tok.value]:
+		op := p.next()
+		switch {
+		case op.kind == filterTokenEqual, op.kind == filterTokenNotEqual:
+		case op.kind == filterTokenIdent && op.value == "prefix":
+		default:
+			return nil, fmt.Errorf("expected \"==\", \"!=\" or \"prefix\" after %q at position %d, got %s",
+				tok.value, op.pos, op)
+		}
+		value := p.next()
+		if value.kind != filterTokenString {
+			return nil, fmt.Errorf("expected a quoted string at position %d, got %s", value.pos, value)
+		}
+		return &filterCompare{field: tok.value, op: op.value, value: value.value}, nil
+
+	case tok.kind == filterTokenIdent:
+		return nil, fmt.Errorf("unknown field %q at position %d", tok.value, tok.pos)
+
+	default:
+		return nil, fmt.Errorf("unexpected %s at position %d", tok, tok.pos)
+	}
+}
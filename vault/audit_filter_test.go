@@ -0,0 +1,81 @@
+package vault
+
+import (
+	"testing"
+
+	"github.com/hashicorp/vault/logical"
+)
+
+func TestAuditFilter_Matches(t *testing.T) {
+	event := &auditEvent{
+		MountPath:   "transit/",
+		MountType:   "transit",
+		Operation:   logical.UpdateOperation,
+		Path:        "transit/encrypt/foo",
+		DisplayName: "approle-app",
+	}
+	failed := *event
+	failed.Error = true
+
+	cases := []struct {
+		Expr   string
+		Event  *auditEvent
+		Result bool
+	}{
+		{`mount_type == "transit"`, event, true},
+		{`mount_type != "transit"`, event, false},
+		{`mount_path == "transit/"`, event, true},
+		{`operation == "read"`, event, false},
+		{`path prefix "transit/encrypt/"`, event, true},
+		{`path prefix "transit/decrypt/"`, event, false},
+		{`display_name prefix "approle"`, event, true},
+		{`error`, event, false},
+		{`error`, &failed, true},
+		{`not error`, event, true},
+		{`mount_type != "transit" or error`, event, false},
+		{`mount_type != "transit" or error`, &failed, true},
+		{`mount_type == "transit" and operation == "update"`, event, true},
+		{`mount_type == "transit" and operation == "read"`, event, false},
+		// "and" binds tighter than "or"
+		{`operation == "read" and error or mount_type == "transit"`, event, true},
+		{`operation == "read" and (error or mount_type == "transit")`, event, false},
+		{`not (mount_type == "transit" and path prefix "transit/encrypt/")`, event, false},
+		{`path == "with \"quotes\""`, &auditEvent{Path: `with "quotes"`}, true},
+	}
+
+	for _, tc := range cases {
+		filter, err := parseAuditFilter(tc.Expr)
+		if err != nil {
+			t.Fatalf("%s: err: %v", tc.Expr, err)
+		}
+		if actual := filter.Matches(tc.Event); actual != tc.Result {
+			t.Fatalf("%s: expected %v, got %v", tc.Expr, tc.Result, actual)
+		}
+	}
+
+	var filter *auditFilter
+	if !filter.Matches(event) {
+		t.Fatalf("nil filter should match every event")
+	}
+}
+
+func TestAuditFilter_Invalid(t *testing.T) {
+	for _, expr := range []string{
+		``,
+		`mount_type`,
+		`mount_type ==`,
+		`mount_type == transit`,
+		`mount_type = "transit"`,
+		`mount_type == "transit`,
+		`mount_kind == "transit"`,
+		`mount_type == "transit" and`,
+		`(mount_type == "transit"`,
+		`mount_type == "transit")`,
+		`mount_type == "transit" error`,
+		`error == "true"`,
+	} {
+		if _, err := parseAuditFilter(expr); err == nil {
+			t.Fatalf("expected error parsing %q", expr)
+		}
+	}
+}
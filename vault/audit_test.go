@@ -387,3 +387,199 @@ func TestAuditBroker_LogResponse(t *testing.T) {
 		t.Fatalf("err: %v", err)
 	}
 }
+
+func TestAuditBroker_Filter(t *testing.T) {
+	l := logformat.NewVaultLogger(log.LevelTrace)
+	b := NewAuditBroker(l)
+	a1 := &NoopAudit{}
+	a2 := &NoopAudit{}
+	a3 := &NoopAudit{}
+	errFilter, err := parseAuditFilter(`operation != "read" or error`)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	writeFilter, err := parseAuditFilter(`operation != "read"`)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	b.Register("foo", a1, nil)
+	b.RegisterWithFilter("bar", a2, nil, errFilter)
+	b.RegisterWithFilter("baz", a3, nil, writeFilter)
+
+	// A request that may fail is logged to backends filtering on errors,
+	// so that the failed response is logged along with its request
+	req := &logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "sys/mounts",
+	}
+	if err := b.LogRequest(nil, req, nil); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if err := b.LogResponse(nil, req, logical.ErrorResponse("failed"), nil); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if err := b.LogResponse(nil, req, &logical.Response{}, nil); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if len(a1.Req) != 1 || len(a1.Resp) != 2 {
+		t.Fatalf("bad: %d requests, %d responses", len(a1.Req), len(a1.Resp))
+	}
+	if len(a2.Req) != 1 || len(a2.Resp) != 1 {
+		t.Fatalf("bad: %d requests, %d responses", len(a2.Req), len(a2.Resp))
+	}
+	if len(a3.Req) != 0 || len(a3.Resp) != 0 {
+		t.Fatalf("bad: %d requests, %d responses", len(a3.Req), len(a3.Resp))
+	}
+
+	// A failing backend that the request is filtered out of does not count
+	// towards the request being audited
+	b.Deregister("bar")
+	a1.ReqErr = fmt.Errorf("failed")
+	if err := b.LogRequest(nil, req, nil); !errwrap.Contains(err, "no audit backend succeeded in logging the request") {
+		t.Fatalf("err: %v", err)
+	}
+
+	// A request or response excluded by every filter is not audited,
+	// which only fails if every request is required to be audited
+	b.Deregister("foo")
+	if err := b.LogRequest(nil, req, nil); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if err := b.LogResponse(nil, req, &logical.Response{}, nil); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	b.requireUnfiltered = true
+	if err := b.LogRequest(nil, req, nil); !errwrap.Contains(err, "request was excluded by the filters of every audit backend") {
+		t.Fatalf("err: %v", err)
+	}
+	if err := b.LogResponse(nil, req, &logical.Response{}, nil); err == nil || err.Error() != "response was excluded by the filters of every audit backend" {
+		t.Fatalf("err: %v", err)
+	}
+}
+
+func TestCore_HandleRequest_AuditFiltered(t *testing.T) {
+	c, _, root := TestCoreUnsealed(t)
+	noop := &NoopAudit{}
+	c.auditBackends["noop"] = func(config *audit.BackendConfig) (audit.Backend, error) {
+		noop.Config = config
+		return noop, nil
+	}
+
+	// Without audit_require_unfiltered, a single filtered backend is allowed
+	me := &MountEntry{
+		Table:  auditTableType,
+		Path:   "writes",
+		Type:   "noop",
+		Filter: `operation != "read"`,
+	}
+	if err := c.enableAudit(me); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	// A request outside of the filter is served without being audited
+	req := &logical.Request{
+		Operation:   logical.ReadOperation,
+		Path:        "secret/foo",
+		ClientToken: root,
+	}
+	if _, err := c.HandleRequest(req); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if len(noop.Req) != 0 || len(noop.Resp) != 0 {
+		t.Fatalf("bad: %d requests, %d responses", len(noop.Req), len(noop.Resp))
+	}
+
+	req = &logical.Request{
+		Operation:   logical.UpdateOperation,
+		Path:        "secret/foo",
+		Data:        map[string]interface{}{"foo": "bar"},
+		ClientToken: root,
+	}
+	if _, err := c.HandleRequest(req); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if len(noop.Req) != 1 || len(noop.Resp) != 1 {
+		t.Fatalf("bad: %d requests, %d responses", len(noop.Req), len(noop.Resp))
+	}
+}
+
+func TestCore_EnableAudit_Filter(t *testing.T) {
+	c, key, _ := TestCoreUnsealed(t)
+	c.auditRequireUnfiltered = true
+	c.auditBackends["noop"] = func(config *audit.BackendConfig) (audit.Backend, error) {
+		return &NoopAudit{
+			Config: config,
+		}, nil
+	}
+
+	// Invalid filters are rejected
+	me := &MountEntry{
+		Table:  auditTableType,
+		Path:   "bad",
+		Type:   "noop",
+		Filter: `mount_type ==`,
+	}
+	if err := c.enableAudit(me); err == nil {
+		t.Fatalf("expected invalid filter error")
+	}
+
+	// A filtered backend cannot be the only one
+	me = &MountEntry{
+		Table:  auditTableType,
+		Path:   "filtered",
+		Type:   "noop",
+		Filter: `mount_type != "transit"`,
+	}
+	if err := c.enableAudit(me); err == nil {
+		t.Fatalf("expected unfiltered backend error")
+	}
+
+	me2 := &MountEntry{
+		Table: auditTableType,
+		Path:  "all",
+		Type:  "noop",
+	}
+	if err := c.enableAudit(me2); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if err := c.enableAudit(me); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	// Nor can the last unfiltered backend be disabled
+	if existed, err := c.disableAudit("all"); !existed || err == nil {
+		t.Fatalf("expected unfiltered backend error")
+	}
+	if !c.auditBroker.IsRegistered("all/") {
+		t.Fatalf("missing audit backend")
+	}
+
+	// The filter is restored with the audit table
+	conf := &CoreConfig{
+		Physical:      c.physical,
+		AuditBackends: make(map[string]audit.Factory),
+		DisableMlock:  true,
+	}
+	conf.AuditBackends["noop"] = c.auditBackends["noop"]
+	c2, err := NewCore(conf)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if _, err := TestCoreUnseal(c2, key); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if !reflect.DeepEqual(c.audit, c2.audit) {
+		t.Fatalf("mismatch: %v %v", c.audit, c2.audit)
+	}
+	c2.auditBroker.RLock()
+	filter := c2.auditBroker.backends["filtered/"].filter
+	c2.auditBroker.RUnlock()
+	if filter.String() != `mount_type != "transit"` {
+		t.Fatalf("bad: %v", filter)
+	}
+
+	// Without the requirement the unfiltered backend may be disabled
+	if _, err := c2.disableAudit("all"); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+}
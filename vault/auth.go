@@ -42,14 +42,15 @@ func (c *Core) enableCredential(entry *MountEntry) error {
 	}
 
 	// Ensure there is a name
-	if entry.Path == "/" {
+	if entry.Path == "/" || entry.Path == entry.NamespacePath {
 		return fmt.Errorf("backend path must be specified")
 	}
 
 	c.authLock.Lock()
 	defer c.authLock.Unlock()
 
-	// Look for matching name
+	// Look for matching name. Entries in a namespace have its path as a
+	// prefix, so this also keeps the paths in the table unique.
 	for _, ent := range c.auth.Entries {
 		switch {
 		// Existing is oauth/github/ new is oauth/ or
@@ -66,13 +67,20 @@ func (c *Core) enableCredential(entry *MountEntry) error {
 		return fmt.Errorf("token credential backend cannot be instantiated")
 	}
 
+	// Verify there is no conflicting mount, such as the token store of a
+	// namespace
+	path := credentialRoutePath(entry)
+	if match := c.router.MatchingMount(path); match != "" {
+		return logical.CodedError(409, fmt.Sprintf("existing mount at %s", match))
+	}
+
 	// Generate a new UUID and view
 	entryUUID, err := uuid.GenerateUUID()
 	if err != nil {
 		return err
 	}
 	entry.UUID = entryUUID
-	view := NewBarrierView(c.barrier, credentialBarrierPrefix+entry.UUID+"/")
+	view := NewBarrierView(c.barrier, namespaceBarrierPath(entry.NamespaceID, credentialBarrierPrefix+entry.UUID+"/"))
 
 	// Create the new backend
 	backend, err := c.newCredentialBackend(entry.Type, c.mountEntrySysView(entry), view, nil)
@@ -90,7 +98,6 @@ func (c *Core) enableCredential(entry *MountEntry) error {
 	c.auth = newTable
 
 	// Mount the backend
-	path := credentialRoutePrefix + entry.Path
 	if err := c.router.Mount(backend, path, entry, view); err != nil {
 		return err
 	}
@@ -115,6 +122,14 @@ func (c *Core) disableCredential(path string) (bool, error) {
 
 	// Store the view for this backend
 	fullPath := credentialRoutePrefix + path
+	c.authLock.RLock()
+	for _, entry := range c.auth.Entries {
+		if entry.Path == path {
+			fullPath = credentialRoutePath(entry)
+			break
+		}
+	}
+	c.authLock.RUnlock()
 	view := c.router.MatchingStorageView(fullPath)
 	if view == nil {
 		return false, fmt.Errorf("no matching backend")
@@ -305,7 +320,7 @@ func (c *Core) setupCredentials() error {
 		}
 
 		// Create a barrier view using the UUID
-		view = NewBarrierView(c.barrier, credentialBarrierPrefix+entry.UUID+"/")
+		view = NewBarrierView(c.barrier, namespaceBarrierPath(entry.NamespaceID, credentialBarrierPrefix+entry.UUID+"/"))
 
 		// Initialize the backend
 		backend, err = c.newCredentialBackend(entry.Type, c.mountEntrySysView(entry), view, nil)
@@ -315,7 +330,7 @@ func (c *Core) setupCredentials() error {
 		}
 
 		// Mount the backend
-		path := credentialRoutePrefix + entry.Path
+		path := credentialRoutePath(entry)
 		err = c.router.Mount(backend, path, entry, view)
 		if err != nil {
 			c.logger.Error("core: failed to mount auth entry", "path", entry.Path, "error", err)
@@ -353,7 +368,7 @@ func (c *Core) teardownCredentials() error {
 	if c.auth != nil {
 		authTable := c.auth.shallowClone()
 		for _, e := range authTable.Entries {
-			prefix := e.Path
+			prefix := credentialRoutePath(e)
 			b, ok := c.router.root.Get(prefix)
 			if ok {
 				b.(*routeEntry).backend.Cleanup()
@@ -366,6 +381,13 @@ func (c *Core) teardownCredentials() error {
 	return nil
 }
 
+// credentialRoutePath returns the path an auth table entry is routed at. The
+// path of an entry in a namespace starts with the namespace path, which is
+// placed ahead of the auth prefix.
+func credentialRoutePath(entry *MountEntry) string {
+	return entry.NamespacePath + credentialRoutePrefix + strings.TrimPrefix(entry.Path, entry.NamespacePath)
+}
+
 // newCredentialBackend is used to create and configure a new credential backend by name
 func (c *Core) newCredentialBackend(
 	t string, sysView logical.SystemView, view logical.Storage, conf map[string]string) (logical.Backend, error) {
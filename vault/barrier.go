@@ -5,6 +5,7 @@ import (
 	"time"
 
 	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/physical"
 )
 
 var (
@@ -139,6 +140,24 @@ type BarrierStorage interface {
 	List(prefix string) ([]string, error)
 }
 
+// TransactionalBarrierStorage is implemented by barrier storage that can
+// apply a set of operations atomically. Transaction returns
+// physical.ErrTransactionUnsupported if the underlying physical backend
+// cannot do so.
+type TransactionalBarrierStorage interface {
+	BarrierStorage
+
+	// Transaction is used to run multiple entries via a transaction
+	Transaction([]TxnEntry) error
+}
+
+// TxnEntry is an operation that takes place atomically as part of a
+// transactional update of the barrier
+type TxnEntry struct {
+	Operation physical.Operation
+	Entry     *Entry
+}
+
 // Entry is used to represent data stored by the security barrier
 type Entry struct {
 	Key   string
@@ -678,6 +678,48 @@ func (b *AESGCMBarrier) List(prefix string) ([]string, error) {
 	return b.backend.List(prefix)
 }
 
+// Transaction is used to run multiple entries via a transaction. Values
+// are encrypted exactly as they would be by Put before being handed to the
+// physical backend.
+func (b *AESGCMBarrier) Transaction(txns []TxnEntry) error {
+	defer metrics.MeasureSince([]string{"barrier", "transaction"}, time.Now())
+	b.l.RLock()
+	defer b.l.RUnlock()
+	if b.sealed {
+		return ErrBarrierSealed
+	}
+
+	txnBackend, ok := b.backend.(physical.Transactional)
+	if !ok {
+		return physical.ErrTransactionUnsupported
+	}
+
+	term := b.keyring.ActiveTerm()
+	primary, err := b.aeadForTerm(term)
+	if err != nil {
+		return err
+	}
+
+	pTxns := make([]physical.TxnEntry, 0, len(txns))
+	for _, txn := range txns {
+		if txn.Entry == nil {
+			return fmt.Errorf("transaction entry is missing an entry")
+		}
+		pe := &physical.Entry{
+			Key: txn.Entry.Key,
+		}
+		if txn.Operation == physical.PutOperation {
+			pe.Value = b.encrypt(txn.Entry.Key, term, primary, txn.Entry.Value)
+		}
+		pTxns = append(pTxns, physical.TxnEntry{
+			Operation: txn.Operation,
+			Entry:     pe,
+		})
+	}
+
+	return txnBackend.Transaction(pTxns)
+}
+
 // aeadForTerm returns the AES-GCM AEAD for the given term
 func (b *AESGCMBarrier) aeadForTerm(term uint32) (cipher.AEAD, error) {
 	// Check for the keyring
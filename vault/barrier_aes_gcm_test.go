@@ -207,6 +207,66 @@ func TestAESGCMBarrier_Confidential(t *testing.T) {
 	}
 }
 
+func TestAESGCMBarrier_Transaction(t *testing.T) {
+	inm, b, _ := mockBarrier(t)
+
+	if err := b.Put(&Entry{Key: "delete", Value: []byte("old")}); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	txnBarrier := b.(TransactionalBarrierStorage)
+	err := txnBarrier.Transaction([]TxnEntry{
+		TxnEntry{
+			Operation: physical.PutOperation,
+			Entry:     &Entry{Key: "test", Value: []byte("test")},
+		},
+		TxnEntry{
+			Operation: physical.DeleteOperation,
+			Entry:     &Entry{Key: "delete"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	// The value should be readable through the barrier
+	out, err := b.Get("test")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if out == nil || string(out.Value) != "test" {
+		t.Fatalf("bad: %#v", out)
+	}
+	out, err = b.Get("delete")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if out != nil {
+		t.Fatalf("bad: %#v", out)
+	}
+
+	// But encrypted in the physical backend
+	pe, err := inm.Get("test")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if pe == nil || bytes.Equal(pe.Value, []byte("test")) {
+		t.Fatalf("bad: %#v", pe)
+	}
+
+	// Transactions are refused while sealed
+	b.Seal()
+	err = txnBarrier.Transaction([]TxnEntry{
+		TxnEntry{
+			Operation: physical.PutOperation,
+			Entry:     &Entry{Key: "test", Value: []byte("test")},
+		},
+	})
+	if err != ErrBarrierSealed {
+		t.Fatalf("err: %v", err)
+	}
+}
+
 // Verify data sent through cannot be tampered with
 func TestAESGCMBarrier_Integrity(t *testing.T) {
 
@@ -5,6 +5,7 @@ import (
 	"strings"
 
 	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/physical"
 )
 
 // BarrierView wraps a SecurityBarrier and ensures all access is automatically
@@ -86,6 +87,32 @@ func (v *BarrierView) Delete(key string) error {
 	return v.barrier.Delete(v.expandKey(key))
 }
 
+// logical.Transactional impl.
+func (v *BarrierView) Transaction(txns []logical.TxnEntry) error {
+	txnBarrier, ok := v.barrier.(TransactionalBarrierStorage)
+	if !ok {
+		return physical.ErrTransactionUnsupported
+	}
+
+	nested := make([]TxnEntry, 0, len(txns))
+	for _, txn := range txns {
+		if txn.Entry == nil {
+			return fmt.Errorf("transaction entry is missing an entry")
+		}
+		if err := v.sanityCheck(txn.Entry.Key); err != nil {
+			return err
+		}
+		nested = append(nested, TxnEntry{
+			Operation: txn.Operation,
+			Entry: &Entry{
+				Key:   v.expandKey(txn.Entry.Key),
+				Value: txn.Entry.Value,
+			},
+		})
+	}
+	return txnBarrier.Transaction(nested)
+}
+
 // SubView constructs a nested sub-view using the given prefix
 func (v *BarrierView) SubView(prefix string) *BarrierView {
 	sub := v.expandKey(prefix)
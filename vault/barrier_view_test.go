@@ -6,12 +6,52 @@ import (
 	"testing"
 
 	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/physical"
 )
 
 func TestBarrierView_impl(t *testing.T) {
 	var _ logical.Storage = new(BarrierView)
 }
 
+func TestBarrierView_Transaction(t *testing.T) {
+	_, barrier, _ := mockBarrier(t)
+	view := NewBarrierView(barrier, "foo/")
+
+	err := view.Transaction([]logical.TxnEntry{
+		logical.TxnEntry{
+			Operation: physical.PutOperation,
+			Entry:     &logical.StorageEntry{Key: "test", Value: []byte("test")},
+		},
+		logical.TxnEntry{
+			Operation: physical.PutOperation,
+			Entry:     &logical.StorageEntry{Key: "sub/test", Value: []byte("sub")},
+		},
+	})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	// The entries should be written under the prefix
+	out, err := barrier.Get("foo/sub/test")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if out == nil || string(out.Value) != "sub" {
+		t.Fatalf("bad: %#v", out)
+	}
+
+	// Relative paths are rejected
+	err = view.Transaction([]logical.TxnEntry{
+		logical.TxnEntry{
+			Operation: physical.DeleteOperation,
+			Entry:     &logical.StorageEntry{Key: "../test"},
+		},
+	})
+	if err == nil {
+		t.Fatalf("expected error")
+	}
+}
+
 func TestBarrierView_spec(t *testing.T) {
 	_, barrier, _ := mockBarrier(t)
 	view := NewBarrierView(barrier, "foo/")
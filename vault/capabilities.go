@@ -36,13 +36,18 @@ func (c *Core) Capabilities(token, path string) ([]string, error) {
 		return []string{DenyCapability}, nil
 	}
 
+	ps := c.namespacePolicyStore(te.NamespaceID)
+	if ps == nil {
+		return []string{DenyCapability}, nil
+	}
+
 	var policies []*Policy
 	for _, tePolicy := range te.Policies {
-		policy, err := c.policyStore.GetPolicy(tePolicy)
+		policy, err := ps.GetPolicy(tePolicy)
 		if err != nil {
 			return nil, err
 		}
-		policies = append(policies, policy)
+		policies = append(policies, ps.scopePolicy(policy))
 	}
 
 	if len(policies) == 0 {
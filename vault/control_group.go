@@ -0,0 +1,298 @@
+package vault
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/vault/helper/jsonutil"
+	"github.com/hashicorp/vault/helper/strutil"
+	"github.com/hashicorp/vault/logical"
+)
+
+const (
+	// controlGroupSubPath is the sub-path of the system view under which
+	// control group requests are stored
+	controlGroupSubPath = "control-group/"
+
+	// defaultControlGroupTTL is the TTL of the wrapping token of a control
+	// group request if the control group does not set one
+	defaultControlGroupTTL = 24 * time.Hour
+
+	// maxTokenLineageDepth bounds the number of parents followed to find
+	// the lineage of a token
+	maxTokenLineageDepth = 1000
+)
+
+var (
+	// ErrControlGroupNotAuthorized is returned when the wrapping token of a
+	// control group request is used before the request was authorized
+	ErrControlGroupNotAuthorized = errors.New("control group request has not been authorized")
+)
+
+// controlGroupRequest is a request whose response was wrapped because of a
+// control group. It is stored under the accessor of the wrapping token and
+// removed once that token is gone.
+type controlGroupRequest struct {
+	Accessor             string                       `json:"accessor"`
+	Path                 string                       `json:"path"`
+	Operation            logical.Operation            `json:"operation"`
+	RequestTime          time.Time                    `json:"request_time"`
+	RequesterAccessor    string                       `json:"requester_accessor"`
+	RequesterLineage     string                       `json:"requester_lineage"`
+	RequesterDisplayName string                       `json:"requester_display_name"`
+	Factors              []*ControlGroupFactor        `json:"factors"`
+	Authorizations       []*controlGroupAuthorization `json:"authorizations"`
+}
+
+// controlGroupAuthorization records a token authorizing a request and the
+// factors it satisfied
+type controlGroupAuthorization struct {
+	Accessor    string    `json:"accessor"`
+	Lineage     string    `json:"lineage"`
+	DisplayName string    `json:"display_name"`
+	Factors     []string  `json:"factors"`
+	Time        time.Time `json:"time"`
+}
+
+// approvals returns the number of authorizations counting towards a factor
+func (r *controlGroupRequest) approvals(factor string) int {
+	var count int
+	for _, a := range r.Authorizations {
+		if strutil.StrListContains(a.Factors, factor) {
+			count++
+		}
+	}
+	return count
+}
+
+// approved returns whether every factor has enough authorizations
+func (r *controlGroupRequest) approved() bool {
+	for _, f := range r.Factors {
+		if r.approvals(f.Name) < f.Approvals {
+			return false
+		}
+	}
+	return true
+}
+
+// controlGroupView returns the view holding the control group requests
+func (c *Core) controlGroupView() *BarrierView {
+	return c.systemBarrierView.SubView(controlGroupSubPath)
+}
+
+// registerControlGroupRequest stores the request whose response was wrapped
+// in the given wrapping token because of a control group
+func (c *Core) registerControlGroupRequest(req *logical.Request, te *TokenEntry, cg *ControlGroup, wrapInfo *logical.WrapInfo) error {
+	lineage, err := c.tokenLineage(te)
+	if err != nil {
+		return err
+	}
+
+	r := &controlGroupRequest{
+		Accessor:             wrapInfo.Accessor,
+		Path:                 req.Path,
+		Operation:            req.Operation,
+		RequestTime:          wrapInfo.CreationTime,
+		RequesterAccessor:    te.Accessor,
+		RequesterLineage:     lineage,
+		RequesterDisplayName: te.DisplayName,
+		Factors:              cg.Factors,
+	}
+
+	c.controlGroupLock.Lock()
+	defer c.controlGroupLock.Unlock()
+	return c.persistControlGroupRequest(r)
+}
+
+// tokenLineage returns the salted ID of the token at the root of the
+// token's tree, found by following its parents. Tokens created by another
+// token, directly or not, share its lineage.
+func (c *Core) tokenLineage(te *TokenEntry) (string, error) {
+	for depth := 0; te.Parent != ""; depth++ {
+		if depth >= maxTokenLineageDepth {
+			return "", fmt.Errorf("token lineage is deeper than %d tokens", maxTokenLineageDepth)
+		}
+		parent, err := c.tokenStore.Lookup(te.Parent)
+		if err != nil {
+			return "", fmt.Errorf("failed to look up parent token: %v", err)
+		}
+		if parent == nil {
+			break
+		}
+		te = parent
+	}
+	return c.tokenStore.SaltID(te.ID), nil
+}
+
+func (c *Core) persistControlGroupRequest(r *controlGroupRequest) error {
+	buf, err := jsonutil.EncodeJSON(r)
+	if err != nil {
+		return fmt.Errorf("failed to encode control group request: %v", err)
+	}
+	entry := &logical.StorageEntry{
+		Key:   r.Accessor,
+		Value: buf,
+	}
+	if err := c.controlGroupView().Put(entry); err != nil {
+		return fmt.Errorf("failed to persist control group request: %v", err)
+	}
+	return nil
+}
+
+// controlGroupRequestLocked returns the control group request of the given
+// wrapping token accessor, or nil. Requests whose wrapping token is gone are
+// removed. The control group lock must be held.
+func (c *Core) controlGroupRequestLocked(accessor string) (*controlGroupRequest, error) {
+	view := c.controlGroupView()
+	raw, err := view.Get(accessor)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read control group request: %v", err)
+	}
+	if raw == nil {
+		return nil, nil
+	}
+
+	// The accessor index of a fully used token may outlive the token, so the
+	// token itself is looked up as well
+	aEntry, err := c.tokenStore.lookupByAccessor(accessor)
+	if err != nil {
+		if _, ok := err.(*StatusBadRequest); !ok {
+			return nil, err
+		}
+	}
+	var te *TokenEntry
+	if err == nil && aEntry.TokenID != "" {
+		if te, err = c.tokenStore.Lookup(aEntry.TokenID); err != nil {
+			return nil, err
+		}
+	}
+	if te == nil {
+		// The wrapping token was unwrapped, revoked or has expired. Only
+		// the active node writes to storage.
+		if !c.standby {
+			if err := view.Delete(accessor); err != nil {
+				return nil, fmt.Errorf("failed to delete control group request: %v", err)
+			}
+		}
+		return nil, nil
+	}
+
+	var r controlGroupRequest
+	if err := jsonutil.DecodeJSON(raw.Value, &r); err != nil {
+		return nil, fmt.Errorf("failed to decode control group request: %v", err)
+	}
+	return &r, nil
+}
+
+// controlGroupRequest returns the control group request of the given
+// wrapping token accessor, or nil
+func (c *Core) controlGroupRequest(accessor string) (*controlGroupRequest, error) {
+	c.controlGroupLock.Lock()
+	defer c.controlGroupLock.Unlock()
+	return c.controlGroupRequestLocked(accessor)
+}
+
+// listControlGroupRequests returns the wrapping token accessors of the
+// control group requests that are still pending
+func (c *Core) listControlGroupRequests() ([]string, error) {
+	c.controlGroupLock.Lock()
+	defer c.controlGroupLock.Unlock()
+
+	accessors, err := c.controlGroupView().List("")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list control group requests: %v", err)
+	}
+
+	var pending []string
+	for _, accessor := range accessors {
+		r, err := c.controlGroupRequestLocked(accessor)
+		if err != nil {
+			return nil, err
+		}
+		if r != nil && !r.approved() {
+			pending = append(pending, accessor)
+		}
+	}
+	return pending, nil
+}
+
+// authorizeControlGroupRequest records the given token authorizing the
+// control group request of a wrapping token accessor for each factor it
+// satisfies
+func (c *Core) authorizeControlGroupRequest(accessor string, te *TokenEntry) (*controlGroupRequest, error) {
+	c.controlGroupLock.Lock()
+	defer c.controlGroupLock.Unlock()
+
+	r, err := c.controlGroupRequestLocked(accessor)
+	if err != nil {
+		return nil, err
+	}
+	if r == nil {
+		return nil, &StatusBadRequest{Err: "no control group request found for accessor"}
+	}
+
+	// The requester, and tokens it created or that share its lineage,
+	// can't authorize the request. An authorization from a lineage that
+	// already authorized it is not counted again.
+	lineage, err := c.tokenLineage(te)
+	if err != nil {
+		return nil, err
+	}
+	if te.Accessor == r.RequesterAccessor || lineage == r.RequesterLineage {
+		return nil, &StatusBadRequest{Err: "a request cannot be authorized by its requester"}
+	}
+	for _, a := range r.Authorizations {
+		if a.Accessor == te.Accessor || a.Lineage == lineage {
+			return r, nil
+		}
+	}
+
+	var factors []string
+	for _, f := range r.Factors {
+		for _, p := range f.Policies {
+			if strutil.StrListContains(te.Policies, p) {
+				factors = append(factors, f.Name)
+				break
+			}
+		}
+	}
+	if len(factors) == 0 {
+		return nil, logical.ErrPermissionDenied
+	}
+
+	r.Authorizations = append(r.Authorizations, &controlGroupAuthorization{
+		Accessor:    te.Accessor,
+		Lineage:     lineage,
+		DisplayName: te.DisplayName,
+		Factors:     factors,
+		Time:        time.Now(),
+	})
+	if err := c.persistControlGroupRequest(r); err != nil {
+		return nil, err
+	}
+
+	if c.logger.IsInfo() {
+		c.logger.Info("core: control group request authorized", "path", r.Path, "factors", factors, "approved", r.approved())
+	}
+	return r, nil
+}
+
+// checkControlGroupAuthorization returns ErrControlGroupNotAuthorized if the
+// given token wraps the response to a control group request that has not
+// been authorized yet
+func (c *Core) checkControlGroupAuthorization(te *TokenEntry) error {
+	if te == nil || te.Accessor == "" || !strutil.StrListContains(te.Policies, responseWrappingPolicyName) {
+		return nil
+	}
+
+	r, err := c.controlGroupRequest(te.Accessor)
+	if err != nil {
+		c.logger.Error("core: failed to look up control group request", "error", err)
+		return ErrInternalError
+	}
+	if r != nil && !r.approved() {
+		return ErrControlGroupNotAuthorized
+	}
+	return nil
+}
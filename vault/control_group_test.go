@@ -0,0 +1,191 @@
+package vault
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/hashicorp/errwrap"
+	"github.com/hashicorp/vault/logical"
+)
+
+func TestControlGroup_Authorize(t *testing.T) {
+	c, _, root := TestCoreUnsealed(t)
+
+	for name, rules := range map[string]string{
+		"reader": `
+path "secret/*" {
+	capabilities = ["read"]
+	control_group {
+		factor "managers" {
+			policies  = ["managers"]
+			approvals = 2
+		}
+	}
+}`,
+		"managers": `
+path "sys/control-group/authorize" {
+	capabilities = ["update"]
+}`,
+	} {
+		req := logical.TestRequest(t, logical.UpdateOperation, "sys/policy/"+name)
+		req.ClientToken = root
+		req.Data["rules"] = rules
+		if _, err := c.HandleRequest(req); err != nil {
+			t.Fatalf("err: %v", err)
+		}
+	}
+
+	req := logical.TestRequest(t, logical.UpdateOperation, "secret/foo")
+	req.ClientToken = root
+	req.Data["value"] = "bar"
+	if _, err := c.HandleRequest(req); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	// Tokens created by the same token share its lineage, so the requester
+	// and managers are orphans, as tokens issued by auth backends are
+	for name, policy := range map[string]string{
+		"requester": "reader",
+		"manager1":  "managers",
+		"manager2":  "managers",
+	} {
+		req = logical.TestRequest(t, logical.UpdateOperation, "auth/token/create-orphan")
+		req.ClientToken = root
+		req.Data["id"] = name
+		req.Data["policies"] = []string{policy}
+		if _, err := c.HandleRequest(req); err != nil {
+			t.Fatalf("err: %v", err)
+		}
+	}
+
+	// A token created by the requester, and a second token from the
+	// lineage of a manager
+	for id, parent := range map[string]string{
+		"requester-child": "requester",
+		"manager1-child":  "manager1",
+	} {
+		te := &TokenEntry{ID: id, Parent: parent, Policies: []string{"managers"}}
+		if err := c.tokenStore.create(te); err != nil {
+			t.Fatalf("err: %v", err)
+		}
+	}
+
+	// The response is wrapped rather than returned
+	req = logical.TestRequest(t, logical.ReadOperation, "secret/foo")
+	req.ClientToken = "requester"
+	resp, err := c.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if resp == nil || resp.Data != nil || resp.WrapInfo == nil || resp.WrapInfo.Token == "" || resp.WrapInfo.Accessor == "" {
+		t.Fatalf("bad: %#v", resp)
+	}
+	if resp.WrapInfo.TTL != defaultControlGroupTTL {
+		t.Fatalf("bad: %v", resp.WrapInfo.TTL)
+	}
+	wrappingToken, accessor := resp.WrapInfo.Token, resp.WrapInfo.Accessor
+
+	// The wrapping token cannot be unwrapped, nor used up, yet
+	for i := 0; i < 2; i++ {
+		req = logical.TestRequest(t, logical.UpdateOperation, "sys/wrapping/unwrap")
+		req.ClientToken = wrappingToken
+		if _, err := c.HandleRequest(req); err == nil || !errwrap.Contains(err, ErrControlGroupNotAuthorized.Error()) {
+			t.Fatalf("expected control group error, got %v", err)
+		}
+	}
+	req = logical.TestRequest(t, logical.UpdateOperation, "sys/wrapping/unwrap")
+	req.ClientToken = "requester"
+	req.Data["token"] = wrappingToken
+	if _, err := c.HandleRequest(req); err == nil || !errwrap.Contains(err, ErrControlGroupNotAuthorized.Error()) {
+		t.Fatalf("expected control group error, got %v", err)
+	}
+
+	// The request is pending
+	req = logical.TestRequest(t, logical.ListOperation, "sys/control-group/request")
+	req.ClientToken = root
+	resp, err = c.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if !reflect.DeepEqual(resp.Data["keys"], []string{accessor}) {
+		t.Fatalf("bad: %#v", resp)
+	}
+
+	// Requesters can check on their request through the default policy
+	req = logical.TestRequest(t, logical.UpdateOperation, "sys/control-group/request")
+	req.ClientToken = "requester"
+	req.Data["accessor"] = accessor
+	resp, err = c.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if resp.Data["request_path"] != "secret/foo" || resp.Data["approved"] != false {
+		t.Fatalf("bad: %#v", resp)
+	}
+
+	// Tokens created by the requester cannot authorize the request
+	req = logical.TestRequest(t, logical.UpdateOperation, "sys/control-group/authorize")
+	req.ClientToken = "requester-child"
+	req.Data["accessor"] = accessor
+	if _, err := c.HandleRequest(req); err == nil {
+		t.Fatalf("expected error")
+	}
+
+	// Authorizing twice with the same token, or with another token of the
+	// same lineage, counts once
+	for _, token := range []string{"manager1", "manager1", "manager1-child"} {
+		req = logical.TestRequest(t, logical.UpdateOperation, "sys/control-group/authorize")
+		req.ClientToken = token
+		req.Data["accessor"] = accessor
+		resp, err = c.HandleRequest(req)
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+	}
+	if resp.Data["approved"] != false {
+		t.Fatalf("bad: %#v", resp)
+	}
+
+	req = logical.TestRequest(t, logical.UpdateOperation, "sys/control-group/authorize")
+	req.ClientToken = "manager2"
+	req.Data["accessor"] = accessor
+	resp, err = c.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if resp.Data["approved"] != true {
+		t.Fatalf("bad: %#v", resp)
+	}
+
+	// Root does not satisfy the factor
+	req = logical.TestRequest(t, logical.UpdateOperation, "sys/control-group/authorize")
+	req.ClientToken = root
+	req.Data["accessor"] = accessor
+	if _, err := c.HandleRequest(req); err == nil {
+		t.Fatalf("expected error")
+	}
+
+	req = logical.TestRequest(t, logical.UpdateOperation, "sys/wrapping/unwrap")
+	req.ClientToken = wrappingToken
+	resp, err = c.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	var wrapped logical.HTTPResponse
+	if err := json.Unmarshal(resp.Data[logical.HTTPRawBody].([]byte), &wrapped); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if wrapped.Data["value"] != "bar" {
+		t.Fatalf("bad: %#v", wrapped)
+	}
+
+	// The request is gone along with its wrapping token
+	r, err := c.controlGroupRequest(accessor)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if r != nil {
+		t.Fatalf("bad: %#v", r)
+	}
+}
@@ -23,9 +23,11 @@ import (
 	"github.com/hashicorp/go-multierror"
 	"github.com/hashicorp/go-uuid"
 	"github.com/hashicorp/vault/audit"
+	"github.com/hashicorp/vault/helper/cidrutil"
 	"github.com/hashicorp/vault/helper/errutil"
 	"github.com/hashicorp/vault/helper/jsonutil"
 	"github.com/hashicorp/vault/helper/logformat"
+	"github.com/hashicorp/vault/helper/metricsutil"
 	"github.com/hashicorp/vault/helper/mlock"
 	"github.com/hashicorp/vault/logical"
 	"github.com/hashicorp/vault/physical"
@@ -33,9 +35,9 @@ import (
 )
 
 const (
-	// coreLockPath is the path used to acquire a coordinating lock
+	// CoreLockPath is the path used to acquire a coordinating lock
 	// for a highly-available deploy.
-	coreLockPath = "core/lock"
+	CoreLockPath = "core/lock"
 
 	// coreLeaderPrefix is the prefix used for the UUID that contains
 	// the currently elected leader.
@@ -167,6 +169,38 @@ type Core struct {
 	standbyStopCh    chan struct{}
 	manualStepDownCh chan struct{}
 
+	// perfStandby is set if this node should serve read-only requests
+	// locally while it is a standby
+	perfStandby bool
+	// perfStandbyBackend sits between the barrier and the physical backend
+	// when HA is enabled. It publishes writes on the active node and rejects
+	// them on a performance standby.
+	perfStandbyBackend *perfStandbyBackend
+	// perfStandbyLock protects the state loaded by a performance standby;
+	// it is held for reading while a request is served locally
+	perfStandbyLock sync.RWMutex
+	// perfStandbyReady is set once the performance standby state is loaded
+	perfStandbyReady bool
+
+	// drLog sits underneath the barrier when HA is enabled and records
+	// writes while this cluster is a DR primary
+	drLog *drLogBackend
+	// drLock protects the DR replication state below
+	drLock sync.RWMutex
+	// drPrimary and the CA loaded from it are set on the active node of a
+	// DR primary
+	drPrimary       *drPrimaryState
+	drPrimaryKey    *ecdsa.PrivateKey
+	drPrimaryCACert *x509.Certificate
+	// drStreams maps the stop channel of each connected DR secondary to its
+	// identifier
+	drStreams map[chan struct{}]string
+	// drSecondary is set while this node is a DR secondary
+	drSecondary       *drSecondaryState
+	drSecondaryStatus string
+	drSecondaryStopCh chan struct{}
+	drSecondaryDoneCh chan struct{}
+
 	// unlockParts has the keys provided to Unseal until
 	// the threshold number of parts is available.
 	unlockParts [][]byte
@@ -202,6 +236,22 @@ type Core struct {
 	// change underneath a calling function
 	authLock sync.RWMutex
 
+	// namespaces is loaded after unseal since it is a protected
+	// configuration
+	namespaces *NamespaceTable
+
+	// namespacePolicyStores holds the policy store of each namespace,
+	// keyed by namespace ID
+	namespacePolicyStores map[string]*PolicyStore
+
+	// namespacesLock is used to ensure that the namespace table does not
+	// change underneath a calling function
+	namespacesLock sync.RWMutex
+
+	// controlGroupLock serializes changes to the stored control group
+	// requests
+	controlGroupLock sync.Mutex
+
 	// audit is loaded after unseal since it is a protected
 	// configuration
 	audit *MountTable
@@ -210,6 +260,20 @@ type Core struct {
 	// change underneath a calling function
 	auditLock sync.RWMutex
 
+	// auditRequireUnfiltered rejects audit configurations in which every
+	// enabled audit backend has a filter, so that no request can go
+	// unaudited
+	auditRequireUnfiltered bool
+
+	// metricsHelper serves the metrics kept in memory for sys/metrics
+	metricsHelper *metricsutil.MetricsHelper
+
+	// rateLimitQuotas holds the rate limit quotas applied to requests
+	rateLimitQuotas *rateLimitQuotaStore
+
+	// leaseCountQuotas holds the lease count quotas applied to new leases
+	leaseCountQuotas *leaseCountQuotaStore
+
 	// auditBroker is used to ingest the audit events and fan
 	// out into the configured audit backends
 	auditBroker *AuditBroker
@@ -323,6 +387,16 @@ type CoreConfig struct {
 	// Custom cache size for the LRU cache on the physical backend, or zero for default
 	CacheSize int `json:"cache_size" structs:"cache_size" mapstructure:"cache_size"`
 
+	// Maximum size in bytes of the LRU cache on the physical backend, or zero for no limit
+	CacheMaxBytes int `json:"cache_max_bytes" structs:"cache_max_bytes" mapstructure:"cache_max_bytes"`
+
+	// Maximum time an entry is served from the LRU cache on the physical
+	// backend before being read again, or zero for no limit
+	CacheMaxStaleness time.Duration `json:"cache_max_staleness" structs:"cache_max_staleness" mapstructure:"cache_max_staleness"`
+
+	// Key prefixes that are never held in the LRU cache on the physical backend
+	CacheExcludedPrefixes []string `json:"cache_excluded_prefixes" structs:"cache_excluded_prefixes" mapstructure:"cache_excluded_prefixes"`
+
 	// Set as the leader address for HA
 	RedirectAddr string `json:"redirect_addr" structs:"redirect_addr" mapstructure:"redirect_addr"`
 
@@ -335,6 +409,15 @@ type CoreConfig struct {
 
 	ClusterName string `json:"cluster_name" structs:"cluster_name" mapstructure:"cluster_name"`
 
+	// Serve read-only requests locally while in standby mode
+	PerformanceStandby bool `json:"performance_standby" structs:"performance_standby" mapstructure:"performance_standby"`
+
+	// Require at least one enabled audit backend to have no filter
+	AuditRequireUnfiltered bool `json:"audit_require_unfiltered" structs:"audit_require_unfiltered" mapstructure:"audit_require_unfiltered"`
+
+	// Serves metrics kept in memory at sys/metrics
+	MetricsHelper *metricsutil.MetricsHelper `json:"-" structs:"-" mapstructure:"-"`
+
 	ReloadFuncs     *map[string][]ReloadFunc
 	ReloadFuncsLock *sync.RWMutex
 }
@@ -376,11 +459,20 @@ func NewCore(conf *CoreConfig) (*Core, error) {
 
 	// Wrap the backend in a cache unless disabled
 	if !conf.DisableCache {
-		_, isCache := conf.Physical.(*physical.Cache)
+		_, isCache := conf.Physical.(physical.Purgable)
 		_, isInmem := conf.Physical.(*physical.InmemBackend)
 		if !isCache && !isInmem {
-			cache := physical.NewCache(conf.Physical, conf.CacheSize, conf.Logger)
-			conf.Physical = cache
+			cacheConfig := &physical.CacheConfig{
+				Size:             conf.CacheSize,
+				MaxBytes:         conf.CacheMaxBytes,
+				MaxStaleness:     conf.CacheMaxStaleness,
+				ExcludedPrefixes: conf.CacheExcludedPrefixes,
+			}
+			if _, ok := conf.Physical.(physical.Transactional); ok {
+				conf.Physical = physical.NewTransactionalCacheWithConfig(conf.Physical, cacheConfig, conf.Logger)
+			} else {
+				conf.Physical = physical.NewCacheWithConfig(conf.Physical, cacheConfig, conf.Logger)
+			}
 		}
 	}
 
@@ -400,8 +492,22 @@ func NewCore(conf *CoreConfig) (*Core, error) {
 		}
 	}
 
+	// With HA enabled, writes pass through a layer that lets the active node
+	// push invalidations to performance standbys, and one that records them
+	// for DR secondaries
+	phys := conf.Physical
+	barrierBackend := conf.Physical
+	var psb *perfStandbyBackend
+	var drLog *drLogBackend
+	if conf.HAPhysical != nil && conf.HAPhysical.HAEnabled() {
+		drLog = newDRLogBackend(conf.Physical)
+		phys = drLog
+		psb = newPerfStandbyBackend(drLog)
+		barrierBackend = psb
+	}
+
 	// Construct a new AES-GCM barrier
-	barrier, err := NewAESGCMBarrier(conf.Physical)
+	barrier, err := NewAESGCMBarrier(barrierBackend)
 	if err != nil {
 		return nil, fmt.Errorf("barrier setup failed: %v", err)
 	}
@@ -410,7 +516,7 @@ func NewCore(conf *CoreConfig) (*Core, error) {
 	c := &Core{
 		redirectAddr:                     conf.RedirectAddr,
 		clusterAddr:                      conf.ClusterAddr,
-		physical:                         conf.Physical,
+		physical:                         phys,
 		seal:                             conf.Seal,
 		barrier:                          barrier,
 		router:                           NewRouter(),
@@ -421,6 +527,10 @@ func NewCore(conf *CoreConfig) (*Core, error) {
 		maxLeaseTTL:                      conf.MaxLeaseTTL,
 		cachingDisabled:                  conf.DisableCache,
 		clusterName:                      conf.ClusterName,
+		auditRequireUnfiltered:           conf.AuditRequireUnfiltered,
+		metricsHelper:                    conf.MetricsHelper,
+		rateLimitQuotas:                  newRateLimitQuotaStore(),
+		leaseCountQuotas:                 newLeaseCountQuotaStore(),
 		localClusterCertPool:             x509.NewCertPool(),
 		clusterListenerShutdownCh:        make(chan struct{}),
 		clusterListenerShutdownSuccessCh: make(chan struct{}),
@@ -428,6 +538,9 @@ func NewCore(conf *CoreConfig) (*Core, error) {
 
 	if conf.HAPhysical != nil && conf.HAPhysical.HAEnabled() {
 		c.ha = conf.HAPhysical
+		c.perfStandby = conf.PerformanceStandby
+		c.perfStandbyBackend = psb
+		c.drLog = drLog
 	}
 
 	// We create the funcs here, then populate the given config with it so that
@@ -473,6 +586,12 @@ func NewCore(conf *CoreConfig) (*Core, error) {
 	}
 	c.seal.SetCore(c)
 
+	// A DR secondary streams from its primary whether or not it is unsealed.
+	// Storage may not be reachable yet; unsealing checks again.
+	if _, err := c.loadDRSecondary(); err != nil {
+		c.logger.Warn("core: failed to check for DR secondary state", "error", err)
+	}
+
 	// Attempt unsealing with stored keys; if there are no stored keys this
 	// returns nil, otherwise returns nil or an error
 	storedKeyErr := c.UnsealWithStoredKeys()
@@ -485,6 +604,8 @@ func NewCore(conf *CoreConfig) (*Core, error) {
 // problem. It is only used to gracefully quit in the case of HA so that failover
 // happens as quickly as possible.
 func (c *Core) Shutdown() error {
+	c.stopDRSecondary()
+
 	c.stateLock.Lock()
 	defer c.stateLock.Unlock()
 	if c.sealed {
@@ -537,8 +658,15 @@ func (c *Core) fetchACLandTokenEntry(req *logical.Request) (*ACL, *TokenEntry, e
 		return nil, nil, logical.ErrPermissionDenied
 	}
 
+	// The policies of a token are those of the namespace it was created in;
+	// once the namespace is deleted the token grants nothing
+	ps := c.namespacePolicyStore(te.NamespaceID)
+	if ps == nil {
+		return nil, nil, logical.ErrPermissionDenied
+	}
+
 	// Construct the corresponding ACL object
-	acl, err := c.policyStore.ACL(te.Policies...)
+	acl, err := ps.ACL(te.Policies...)
 	if err != nil {
 		c.logger.Error("core: failed to construct ACL", "error", err)
 		return nil, nil, ErrInternalError
@@ -547,12 +675,26 @@ func (c *Core) fetchACLandTokenEntry(req *logical.Request) (*ACL, *TokenEntry, e
 	return acl, te, nil
 }
 
-func (c *Core) checkToken(req *logical.Request) (*logical.Auth, *TokenEntry, error) {
+// checkToken validates the client token of a request against the ACLs. It
+// also returns the control group that the request is subject to, if any.
+func (c *Core) checkToken(req *logical.Request) (*logical.Auth, *TokenEntry, *ControlGroup, error) {
 	defer metrics.MeasureSince([]string{"core", "check_token"}, time.Now())
 
 	acl, te, err := c.fetchACLandTokenEntry(req)
 	if err != nil {
-		return nil, te, err
+		return nil, te, nil, err
+	}
+
+	// Tokens bound to CIDR blocks can only be used from within them. The use
+	// is not counted against the token.
+	if te != nil && len(te.BoundCIDRs) > 0 {
+		if req.Connection == nil || req.Connection.RemoteAddr == "" {
+			return nil, nil, nil, logical.ErrPermissionDenied
+		}
+		belongs, err := cidrutil.IPBelongsToCIDRBlocksSlice(req.Connection.RemoteAddr, te.BoundCIDRs)
+		if err != nil || !belongs {
+			return nil, nil, nil, logical.ErrPermissionDenied
+		}
 	}
 
 	// Check if this is a root protected path
@@ -574,9 +716,9 @@ func (c *Core) checkToken(req *logical.Request) (*logical.Auth, *TokenEntry, err
 		default:
 			c.logger.Error("core: failed to run existence check", "error", err)
 			if _, ok := err.(errutil.UserError); ok {
-				return nil, nil, err
+				return nil, nil, nil, err
 			} else {
-				return nil, nil, ErrInternalError
+				return nil, nil, nil, ErrInternalError
 			}
 		}
 
@@ -599,10 +741,17 @@ func (c *Core) checkToken(req *logical.Request) (*logical.Auth, *TokenEntry, err
 	// allowed so we can decrement the use count.
 	allowed, rootPrivs := acl.AllowOperation(req.Operation, req.Path)
 	if !allowed {
-		return nil, te, logical.ErrPermissionDenied
+		return nil, te, nil, logical.ErrPermissionDenied
 	}
 	if rootPath && !rootPrivs {
-		return nil, te, logical.ErrPermissionDenied
+		return nil, te, nil, logical.ErrPermissionDenied
+	}
+
+	// The wrapping token of a control group request cannot be used, and so
+	// used up, before the request has been authorized. The use is not
+	// counted against the token.
+	if err := c.checkControlGroupAuthorization(te); err != nil {
+		return nil, nil, nil, err
 	}
 
 	// Create the auth response
@@ -612,7 +761,7 @@ func (c *Core) checkToken(req *logical.Request) (*logical.Auth, *TokenEntry, err
 		Metadata:    te.Meta,
 		DisplayName: te.DisplayName,
 	}
-	return auth, te, nil
+	return auth, te, acl.ControlGroup(req.Path), nil
 }
 
 // Sealed checks if the Vault is current sealed
@@ -629,6 +778,12 @@ func (c *Core) Standby() (bool, error) {
 	return c.standby, nil
 }
 
+// MetricsHelper returns the helper used to serve the metrics kept in memory,
+// which may be nil
+func (c *Core) MetricsHelper() *metricsutil.MetricsHelper {
+	return c.metricsHelper
+}
+
 // Leader is used to get the current active leader
 func (c *Core) Leader() (isLeader bool, leaderAddr string, err error) {
 	c.stateLock.RLock()
@@ -660,7 +815,7 @@ func (c *Core) Leader() (isLeader bool, leaderAddr string, err error) {
 	}
 
 	// Initialize a lock
-	lock, err := c.ha.LockWith(coreLockPath, "read")
+	lock, err := c.ha.LockWith(CoreLockPath, "read")
 	if err != nil {
 		return false, "", err
 	}
@@ -758,6 +913,15 @@ func (c *Core) Unseal(key []byte) (bool, error) {
 		return false, &ErrInvalidKey{fmt.Sprintf("key is longer than maximum %d bytes", max)}
 	}
 
+	// A DR secondary stays sealed until it is promoted
+	isDRSecondary, err := c.loadDRSecondary()
+	if err != nil {
+		return false, err
+	}
+	if isDRSecondary {
+		return false, ErrDRSecondary
+	}
+
 	// Get the seal configuration
 	config, err := c.seal.BarrierConfig()
 	if err != nil {
@@ -1121,7 +1285,7 @@ func (c *Core) postUnseal() (retErr error) {
 		}
 	}()
 	c.logger.Info("core: post-unseal setup starting")
-	if cache, ok := c.physical.(*physical.Cache); ok {
+	if cache, ok := c.physical.(physical.Purgable); ok {
 		cache.Purge()
 	}
 	// HA mode requires us to handle keyring rotation and rekeying
@@ -1157,6 +1321,12 @@ func (c *Core) postUnseal() (retErr error) {
 	if err := c.setupCredentials(); err != nil {
 		return err
 	}
+	if err := c.loadNamespaces(); err != nil {
+		return err
+	}
+	if err := c.setupNamespaces(); err != nil {
+		return err
+	}
 	if err := c.setupExpiration(); err != nil {
 		return err
 	}
@@ -1166,6 +1336,12 @@ func (c *Core) postUnseal() (retErr error) {
 	if err := c.setupAudits(); err != nil {
 		return err
 	}
+	if err := c.loadDRPrimary(); err != nil {
+		return err
+	}
+	if err := c.setupQuotas(); err != nil {
+		return err
+	}
 	if c.ha != nil {
 		if err := c.startClusterListener(); err != nil {
 			return err
@@ -1196,14 +1372,20 @@ func (c *Core) preSeal() error {
 	var result error
 	if c.ha != nil {
 		c.stopClusterListener()
+		c.perfStandbyBackend.broker.closeAll()
+		c.teardownDRPrimary()
 	}
 
+	c.teardownQuotas()
 	if err := c.teardownAudits(); err != nil {
 		result = multierror.Append(result, errwrap.Wrapf("error tearing down audits: {{err}}", err))
 	}
 	if err := c.stopExpiration(); err != nil {
 		result = multierror.Append(result, errwrap.Wrapf("error stopping expiration: {{err}}", err))
 	}
+	if err := c.teardownNamespaces(); err != nil {
+		result = multierror.Append(result, errwrap.Wrapf("error tearing down namespaces: {{err}}", err))
+	}
 	if err := c.teardownCredentials(); err != nil {
 		result = multierror.Append(result, errwrap.Wrapf("error tearing down credentials: {{err}}", err))
 	}
@@ -1216,7 +1398,7 @@ func (c *Core) preSeal() error {
 	if err := c.unloadMounts(); err != nil {
 		result = multierror.Append(result, errwrap.Wrapf("error unloading mounts: {{err}}", err))
 	}
-	if cache, ok := c.physical.(*physical.Cache); ok {
+	if cache, ok := c.physical.(physical.Purgable); ok {
 		cache.Purge()
 	}
 	c.logger.Info("core: pre-seal teardown complete")
@@ -1240,6 +1422,30 @@ func (c *Core) runStandby(doneCh, stopCh, manualStepDownCh chan struct{}) {
 		<-keyRotateDone
 	}()
 
+	// Serve reads locally until we become active
+	var perfStandbyDone, perfStandbyStop chan struct{}
+	startPerfStandby := func() {
+		select {
+		case <-stopCh:
+			return
+		default:
+		}
+		if c.perfStandby {
+			perfStandbyDone = make(chan struct{})
+			perfStandbyStop = make(chan struct{})
+			go c.runPerfStandby(perfStandbyDone, perfStandbyStop)
+		}
+	}
+	stopPerfStandby := func() {
+		if perfStandbyStop != nil {
+			close(perfStandbyStop)
+			<-perfStandbyDone
+			perfStandbyStop = nil
+		}
+	}
+	startPerfStandby()
+	defer stopPerfStandby()
+
 	for {
 		// Check for a shutdown
 		select {
@@ -1254,7 +1460,7 @@ func (c *Core) runStandby(doneCh, stopCh, manualStepDownCh chan struct{}) {
 			c.logger.Error("core: failed to generate uuid", "error", err)
 			return
 		}
-		lock, err := c.ha.LockWith(coreLockPath, uuid)
+		lock, err := c.ha.LockWith(CoreLockPath, uuid)
 		if err != nil {
 			c.logger.Error("core: failed to create lock", "error", err)
 			return
@@ -1269,6 +1475,10 @@ func (c *Core) runStandby(doneCh, stopCh, manualStepDownCh chan struct{}) {
 		}
 		c.logger.Info("core: acquired lock, enabling active operation")
 
+		// The performance standby state must be gone before the full
+		// post-unseal setup replaces it
+		stopPerfStandby()
+
 		// This is used later to log a metrics event; this can be helpful to
 		// detect flapping
 		activeTime := time.Now()
@@ -1281,6 +1491,7 @@ func (c *Core) runStandby(doneCh, stopCh, manualStepDownCh chan struct{}) {
 			c.logger.Error("core: cluster setup failed", "error", err)
 			lock.Unlock()
 			metrics.MeasureSince([]string{"core", "leadership_setup_failed"}, activeTime)
+			startPerfStandby()
 			continue
 		}
 
@@ -1290,6 +1501,7 @@ func (c *Core) runStandby(doneCh, stopCh, manualStepDownCh chan struct{}) {
 			c.logger.Error("core: leader advertisement setup failed", "error", err)
 			lock.Unlock()
 			metrics.MeasureSince([]string{"core", "leadership_setup_failed"}, activeTime)
+			startPerfStandby()
 			continue
 		}
 
@@ -1305,6 +1517,7 @@ func (c *Core) runStandby(doneCh, stopCh, manualStepDownCh chan struct{}) {
 			c.logger.Error("core: post-unseal setup failed", "error", err)
 			lock.Unlock()
 			metrics.MeasureSince([]string{"core", "leadership_setup_failed"}, activeTime)
+			startPerfStandby()
 			continue
 		}
 
@@ -1341,6 +1554,9 @@ func (c *Core) runStandby(doneCh, stopCh, manualStepDownCh chan struct{}) {
 			c.logger.Error("core: pre-seal teardown failed", "error", err)
 		}
 
+		// Go back to serving reads locally
+		startPerfStandby()
+
 		// If we've merely stepped down, we could instantly grab the lock
 		// again. Give the other nodes a chance.
 		if manualStepDown {
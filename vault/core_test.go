@@ -694,6 +694,89 @@ func TestCore_HandleLogin_Token(t *testing.T) {
 	}
 }
 
+func TestCore_HandleLogin_BatchToken(t *testing.T) {
+	noop := &NoopBackend{
+		Login: []string{"login"},
+		Response: &logical.Response{
+			Auth: &logical.Auth{
+				Policies:    []string{"foo"},
+				DisplayName: "armon",
+				LeaseOptions: logical.LeaseOptions{
+					Renewable: true,
+				},
+			},
+		},
+	}
+	c, _, root := TestCoreUnsealed(t)
+	c.credentialBackends["noop"] = func(conf *logical.BackendConfig) (logical.Backend, error) {
+		return noop, nil
+	}
+
+	// Enable the credential backend and have it issue batch tokens
+	req := logical.TestRequest(t, logical.UpdateOperation, "sys/auth/foo")
+	req.Data["type"] = "noop"
+	req.ClientToken = root
+	if _, err := c.HandleRequest(req); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	req = logical.TestRequest(t, logical.UpdateOperation, "sys/auth/foo/tune")
+	req.Data["token_type"] = "batch"
+	req.ClientToken = root
+	if resp, err := c.HandleRequest(req); err != nil {
+		t.Fatalf("err: %v %v", err, resp)
+	}
+
+	before, err := c.tokenStore.view.List(lookupPrefix)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	lresp, err := c.HandleRequest(&logical.Request{
+		Path: "auth/foo/login",
+	})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	clientToken := lresp.Auth.ClientToken
+	if !IsBatchToken(clientToken) || lresp.Auth.Accessor != "" || lresp.Auth.Renewable {
+		t.Fatalf("bad: %#v", lresp.Auth)
+	}
+
+	// Nothing should have been written for the token
+	after, err := c.tokenStore.view.List(lookupPrefix)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if len(after) != len(before) {
+		t.Fatalf("bad: %v %v", before, after)
+	}
+
+	te, err := c.tokenStore.Lookup(clientToken)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	expect := &TokenEntry{
+		ID:           clientToken,
+		Policies:     []string{"default", "foo"},
+		Path:         "auth/foo/login",
+		DisplayName:  "foo-armon",
+		TTL:          time.Hour * 24,
+		CreationTime: te.CreationTime,
+		Type:         TokenTypeBatch,
+	}
+	if !reflect.DeepEqual(te, expect) {
+		t.Fatalf("Bad: %#v expect: %#v", te, expect)
+	}
+
+	// The token store cannot be switched to batch tokens
+	req = logical.TestRequest(t, logical.UpdateOperation, "sys/auth/token/tune")
+	req.Data["token_type"] = "batch"
+	req.ClientToken = root
+	if _, err := c.HandleRequest(req); err == nil {
+		t.Fatalf("expected error")
+	}
+}
+
 func TestCore_HandleRequest_AuditTrail(t *testing.T) {
 	// Create a noop audit backend
 	noop := &NoopAudit{}
@@ -36,7 +36,11 @@ func (d dynamicSystemView) SudoPrivilege(path string, token string) bool {
 	}
 
 	// Construct the corresponding ACL object
-	acl, err := d.core.policyStore.ACL(te.Policies...)
+	ps := d.core.namespacePolicyStore(te.NamespaceID)
+	if ps == nil {
+		return false
+	}
+	acl, err := ps.ACL(te.Policies...)
 	if err != nil {
 		d.core.logger.Error("failed to retrieve ACL for token's policies", "token_policies", te.Policies, "error", err)
 		return false
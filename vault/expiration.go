@@ -3,9 +3,11 @@ package vault
 import (
 	"encoding/json"
 	"fmt"
+	"hash/fnv"
 	"path"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	log "github.com/mgutz/logxi/v1"
@@ -14,6 +16,7 @@ import (
 	"github.com/hashicorp/go-uuid"
 	"github.com/hashicorp/vault/helper/jsonutil"
 	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/physical"
 )
 
 const (
@@ -27,15 +30,29 @@ const (
 	// tokenViewPrefix is the prefix used for the token based lookup of leases.
 	tokenViewPrefix = "token/"
 
-	// maxRevokeAttempts limits how many revoke attempts are made
+	// irrevocableViewPrefix is the prefix used to index the leases that
+	// could not be revoked when they expired.
+	irrevocableViewPrefix = "irrevocable/"
+
+	// maxRevokeAttempts limits how many revoke attempts are made before a
+	// lease is marked irrevocable
 	maxRevokeAttempts = 6
 
-	// revokeRetryBase is a baseline retry time
+	// revokeRetryBase is a baseline retry time, doubled after each failed
+	// attempt
 	revokeRetryBase = 10 * time.Second
 
 	// minRevokeDelay is used to prevent an instant revoke on restore
 	minRevokeDelay = 5 * time.Second
 
+	// restoreWorkerCount is the number of leases loaded in parallel when
+	// restoring
+	restoreWorkerCount = 64
+
+	// restoreProgressInterval is the number of leases restored between
+	// progress log lines
+	restoreProgressInterval = 10000
+
 	// maxLeaseDuration is the default maximum lease duration
 	maxLeaseTTL = 32 * 24 * time.Hour
 
@@ -48,14 +65,42 @@ const (
 // If a secret is not renewed in timely manner, it may be expired, and
 // the ExpirationManager will handle doing automatic revocation.
 type ExpirationManager struct {
-	router     *Router
-	idView     *BarrierView
-	tokenView  *BarrierView
-	tokenStore *TokenStore
-	logger     log.Logger
+	router          *Router
+	view            *BarrierView
+	idView          *BarrierView
+	tokenView       *BarrierView
+	irrevocableView *BarrierView
+	tokenStore      *TokenStore
+	logger          log.Logger
+
+	// leaseCountQuotas, if set, limits the number of leases registered
+	leaseCountQuotas *leaseCountQuotaStore
 
 	pending     map[string]*time.Timer
 	pendingLock sync.Mutex
+
+	// maxRevokeAttempts and revokeRetryBase control the retries of failed
+	// revocations of expired leases
+	maxRevokeAttempts uint
+	revokeRetryBase   time.Duration
+
+	// quitCh is closed when the manager is stopped, ending any restore in
+	// progress. It is replaced so that the manager can be restored again.
+	quitCh chan struct{}
+
+	// restoreMode is 1 while leases are being restored in the background.
+	// Until a lease has been restored, anything touching it loads it on
+	// demand under its restore lock.
+	restoreMode       int32
+	restoreLocks      [256]sync.Mutex
+	restoreLoaded     map[string]struct{}
+	restoreLoadedLock sync.Mutex
+	restoreTotal      int64
+	restoreCount      int64
+	restoreFailed     int64
+
+	// tidyInProgress is set while a tidy operation is running
+	tidyInProgress int32
 }
 
 // NewExpirationManager creates a new ExpirationManager that is backed
@@ -66,12 +111,18 @@ func NewExpirationManager(router *Router, view *BarrierView, ts *TokenStore, log
 
 	}
 	exp := &ExpirationManager{
-		router:     router,
-		idView:     view.SubView(leaseViewPrefix),
-		tokenView:  view.SubView(tokenViewPrefix),
-		tokenStore: ts,
-		logger:     logger,
-		pending:    make(map[string]*time.Timer),
+		router:          router,
+		view:            view,
+		idView:          view.SubView(leaseViewPrefix),
+		tokenView:       view.SubView(tokenViewPrefix),
+		irrevocableView: view.SubView(irrevocableViewPrefix),
+		tokenStore:      ts,
+		logger:          logger,
+		pending:         make(map[string]*time.Timer),
+		quitCh:          make(chan struct{}),
+
+		maxRevokeAttempts: maxRevokeAttempts,
+		revokeRetryBase:   revokeRetryBase,
 	}
 	return exp
 }
@@ -86,18 +137,39 @@ func (c *Core) setupExpiration() error {
 
 	// Create the manager
 	mgr := NewExpirationManager(c.router, view, c.tokenStore, c.logger)
+	mgr.leaseCountQuotas = c.leaseCountQuotas
 	c.expiration = mgr
 
 	// Link the token store to this
 	c.tokenStore.SetExpirationManager(mgr)
 
-	// Restore the existing state
-	if err := c.expiration.Restore(); err != nil {
-		return fmt.Errorf("expiration state restore failed: %v", err)
-	}
+	// Restore the existing state in the background. Leases that fail to
+	// restore are skipped, but if the leases can't be listed at all none of
+	// them would ever expire, so the vault is sealed instead.
+	quitCh := mgr.startRestore()
+	go func() {
+		if err := mgr.restore(quitCh); err != nil {
+			c.logger.Error("core: expiration state restore failed, sealing", "error", err)
+			c.sealAfterRestoreFailure(mgr)
+		}
+	}()
 	return nil
 }
 
+// sealAfterRestoreFailure seals the vault after the given expiration
+// manager failed to restore, unless it has been replaced or the vault has
+// been sealed in the meantime
+func (c *Core) sealAfterRestoreFailure(mgr *ExpirationManager) {
+	c.stateLock.Lock()
+	defer c.stateLock.Unlock()
+	if c.sealed || c.expiration != mgr {
+		return
+	}
+	if err := c.sealInternal(); err != nil {
+		c.logger.Error("core: failed to seal", "error", err)
+	}
+}
+
 // stopExpiration is used to stop the expiration manager before
 // sealing the Vault.
 func (c *Core) stopExpiration() error {
@@ -112,64 +184,197 @@ func (c *Core) stopExpiration() error {
 	return nil
 }
 
-// Restore is used to recover the lease states when starting.
-// This is used after starting the vault.
+// Restore is used to recover the lease states when starting, returning
+// once every lease has been loaded.
 func (m *ExpirationManager) Restore() error {
+	return m.restore(m.startRestore())
+}
+
+// startRestore puts the manager in restore mode, so that leases are loaded
+// on demand until restored, and returns the channel that ends the restore
+func (m *ExpirationManager) startRestore() chan struct{} {
 	m.pendingLock.Lock()
 	defer m.pendingLock.Unlock()
 
+	m.restoreLoadedLock.Lock()
+	m.restoreLoaded = make(map[string]struct{})
+	m.restoreLoadedLock.Unlock()
+	atomic.StoreInt64(&m.restoreTotal, 0)
+	atomic.StoreInt64(&m.restoreCount, 0)
+	atomic.StoreInt64(&m.restoreFailed, 0)
+	atomic.StoreInt32(&m.restoreMode, 1)
+	return m.quitCh
+}
+
+// restore loads every lease and sets up its revocation timer, using a pool
+// of workers. Leases that fail to load are logged and skipped. It stops
+// early without error if the quit channel is closed, and only fails if the
+// leases can't be listed.
+func (m *ExpirationManager) restore(quitCh chan struct{}) error {
+	defer metrics.MeasureSince([]string{"expire", "restore"}, time.Now())
+	defer func() {
+		atomic.StoreInt32(&m.restoreMode, 0)
+		m.restoreLoadedLock.Lock()
+		m.restoreLoaded = nil
+		m.restoreLoadedLock.Unlock()
+	}()
+
 	// Accumulate existing leases
 	existing, err := CollectKeys(m.idView)
 	if err != nil {
+		select {
+		case <-quitCh:
+			return nil
+		default:
+		}
 		return fmt.Errorf("failed to scan for leases: %v", err)
 	}
+	atomic.StoreInt64(&m.restoreTotal, int64(len(existing)))
+	if m.logger.IsInfo() {
+		m.logger.Info("expire: restoring leases", "lease_count", len(existing))
+	}
+
+	// A lease that fails to load is skipped rather than stopping the
+	// restore. It gets no timer, but is still loaded by anything touching
+	// it later.
+	leaseCh := make(chan string)
+	var wg sync.WaitGroup
+	for i := 0; i < restoreWorkerCount; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for leaseID := range leaseCh {
+				if err := m.restoreLease(leaseID, quitCh); err != nil {
+					m.logger.Error("expire: failed to restore lease, skipping", "lease_id", leaseID, "error", err)
+					metrics.IncrCounter([]string{"expire", "restore", "failed"}, 1)
+					atomic.AddInt64(&m.restoreFailed, 1)
+				}
+			}
+		}()
+	}
 
-	// Restore each key
-	for _, leaseID := range existing {
-		// Load the entry
-		le, err := m.loadEntry(leaseID)
-		if err != nil {
-			return err
+	stopped := false
+dispatch:
+	for i, leaseID := range existing {
+		if i > 0 && i%restoreProgressInterval == 0 && m.logger.IsInfo() {
+			m.logger.Info("expire: lease restore progress",
+				"restored_lease_count", atomic.LoadInt64(&m.restoreCount), "lease_count", len(existing))
 		}
 
-		// If there is no entry, nothing to restore
-		if le == nil {
-			continue
+		select {
+		case <-quitCh:
+			stopped = true
+			break dispatch
+		case leaseCh <- leaseID:
 		}
+	}
+	close(leaseCh)
+	wg.Wait()
 
-		// If there is no expiry time, don't do anything
-		if le.ExpireTime.IsZero() {
-			continue
-		}
+	if stopped {
+		m.logger.Info("expire: lease restore stopped")
+		return nil
+	}
+
+	if failed := atomic.LoadInt64(&m.restoreFailed); failed > 0 {
+		m.logger.Warn("expire: leases restored with failures",
+			"restored_lease_count", atomic.LoadInt64(&m.restoreCount), "failed_lease_count", failed)
+	} else if m.logger.IsInfo() {
+		m.logger.Info("expire: leases restored", "restored_lease_count", atomic.LoadInt64(&m.restoreCount))
+	}
+	return nil
+}
 
+// restoreLock returns the lock serializing the restore of a lease
+func (m *ExpirationManager) restoreLock(leaseID string) *sync.Mutex {
+	h := fnv.New32a()
+	h.Write([]byte(leaseID))
+	return &m.restoreLocks[h.Sum32()%uint32(len(m.restoreLocks))]
+}
+
+// loadOnDemand restores a lease that the background restore has not
+// reached yet, so that it can be operated on
+func (m *ExpirationManager) loadOnDemand(leaseID string) error {
+	if atomic.LoadInt32(&m.restoreMode) == 0 {
+		return nil
+	}
+	return m.restoreLease(leaseID, nil)
+}
+
+// restoreLease loads a single lease and sets up its revocation timer, if
+// it has not been restored already
+func (m *ExpirationManager) restoreLease(leaseID string, quitCh chan struct{}) error {
+	lock := m.restoreLock(leaseID)
+	lock.Lock()
+	defer lock.Unlock()
+
+	m.restoreLoadedLock.Lock()
+	_, loaded := m.restoreLoaded[leaseID]
+	m.restoreLoadedLock.Unlock()
+	if loaded {
+		return nil
+	}
+
+	le, err := m.loadEntry(leaseID)
+	if err != nil {
+		return err
+	}
+
+	// A lease without an expiry time, deleted since the restore started or
+	// irrevocable needs no timer
+	if le != nil && !le.ExpireTime.IsZero() && le.RevokeErr == "" {
 		// Determine the remaining time to expiration
 		expires := le.ExpireTime.Sub(time.Now())
 		if expires <= 0 {
 			expires = minRevokeDelay
 		}
 
-		// Setup revocation timer
-		m.pending[le.LeaseID] = time.AfterFunc(expires, func() {
-			m.expireID(le.LeaseID)
-		})
-	}
-	if len(m.pending) > 0 {
-		if m.logger.IsInfo() {
-			m.logger.Info("expire: leases restored", "restored_lease_count", len(m.pending))
+		// Setup revocation timer, unless one was set up by a renewal in the
+		// meantime or the manager has been stopped
+		m.pendingLock.Lock()
+		select {
+		case <-quitCh:
+			m.pendingLock.Unlock()
+			return nil
+		default:
+		}
+		if _, ok := m.pending[le.LeaseID]; !ok {
+			m.pending[le.LeaseID] = time.AfterFunc(expires, func() {
+				m.expireID(le.LeaseID)
+			})
 		}
+		m.pendingLock.Unlock()
 	}
+
+	m.restoreLoadedLock.Lock()
+	if m.restoreLoaded != nil {
+		m.restoreLoaded[leaseID] = struct{}{}
+	}
+	m.restoreLoadedLock.Unlock()
+	atomic.AddInt64(&m.restoreCount, 1)
 	return nil
 }
 
+// restoreStatus returns whether a restore is in progress, along with the
+// number of leases restored so far and the number to restore
+func (m *ExpirationManager) restoreStatus() (bool, int64, int64) {
+	return atomic.LoadInt32(&m.restoreMode) == 1,
+		atomic.LoadInt64(&m.restoreCount),
+		atomic.LoadInt64(&m.restoreTotal)
+}
+
 // Stop is used to prevent further automatic revocations.
 // This must be called before sealing the view.
 func (m *ExpirationManager) Stop() error {
-	// Stop all the pending expiration timers
+	// Stop all the pending expiration timers, and any restore in progress
 	m.pendingLock.Lock()
 	for _, timer := range m.pending {
 		timer.Stop()
 	}
 	m.pending = make(map[string]*time.Timer)
+	close(m.quitCh)
+	m.quitCh = make(chan struct{})
+	atomic.StoreInt32(&m.restoreMode, 0)
 	m.pendingLock.Unlock()
 	return nil
 }
@@ -185,6 +390,10 @@ func (m *ExpirationManager) Revoke(leaseID string) error {
 // during revocation and still remove entries/index/lease timers
 func (m *ExpirationManager) revokeCommon(leaseID string, force, skipToken bool) error {
 	defer metrics.MeasureSince([]string{"expire", "revoke-common"}, time.Now())
+	if err := m.loadOnDemand(leaseID); err != nil {
+		return err
+	}
+
 	// Load the entry
 	le, err := m.loadEntry(leaseID)
 	if err != nil {
@@ -199,6 +408,8 @@ func (m *ExpirationManager) revokeCommon(leaseID string, force, skipToken bool)
 	// Revoke the entry
 	if !skipToken || le.Auth == nil {
 		if err := m.revokeEntry(le); err != nil {
+			mount := strings.Replace(m.router.MatchingMount(le.Path), "/", "-", -1)
+			metrics.IncrCounter([]string{"expire", "revoke", "failure", mount}, 1)
 			if !force {
 				return err
 			} else {
@@ -209,15 +420,11 @@ func (m *ExpirationManager) revokeCommon(leaseID string, force, skipToken bool)
 		}
 	}
 
-	// Delete the entry
-	if err := m.deleteEntry(leaseID); err != nil {
-		return err
-	}
-
-	// Delete the secondary index
-	if err := m.removeIndexByToken(le.ClientToken, le.LeaseID); err != nil {
+	// Delete the entry and its indexes
+	if err := m.deleteEntryWithIndexes(le); err != nil {
 		return err
 	}
+	m.releaseLeaseCount(leaseID)
 
 	// Clear the expiration handler
 	m.pendingLock.Lock()
@@ -306,6 +513,10 @@ func (m *ExpirationManager) revokePrefixCommon(prefix string, force bool) error
 // and a renew interval. The increment may be ignored.
 func (m *ExpirationManager) Renew(leaseID string, increment time.Duration) (*logical.Response, error) {
 	defer metrics.MeasureSince([]string{"expire", "renew"}, time.Now())
+	if err := m.loadOnDemand(leaseID); err != nil {
+		return nil, err
+	}
+
 	// Load the entry
 	le, err := m.loadEntry(leaseID)
 	if err != nil {
@@ -359,6 +570,9 @@ func (m *ExpirationManager) RenewToken(req *logical.Request, source string, toke
 	defer metrics.MeasureSince([]string{"expire", "renew-token"}, time.Now())
 	// Compute the Lease ID
 	leaseID := path.Join(source, m.tokenStore.SaltID(token))
+	if err := m.loadOnDemand(leaseID); err != nil {
+		return nil, err
+	}
 
 	// Load the entry
 	le, err := m.loadEntry(leaseID)
@@ -443,13 +657,22 @@ func (m *ExpirationManager) Register(req *logical.Request, resp *logical.Respons
 		ExpireTime:  resp.Secret.ExpirationTime(),
 	}
 
-	// Encode the entry
-	if err := m.persistEntry(&le); err != nil {
+	// Count the lease against any quotas. The backend has already created
+	// the secret, so it is revoked if the lease is not allowed.
+	if err := m.acquireLeaseCount(&le); err != nil {
 		return "", err
 	}
 
-	// Maintain secondary index by token
-	if err := m.createIndexByToken(le.ClientToken, le.LeaseID); err != nil {
+	// Encode the entry along with the secondary index by token
+	if err := m.persistEntryWithIndex(&le); err != nil {
+		// Without transactional storage the entry may have been written
+		// before the index failed. It is only uncounted once it is known
+		// to be gone, so that the counts match the leases in storage.
+		if delErr := m.deleteEntry(le.LeaseID); delErr != nil {
+			m.logger.Error("expire: failed to delete lease that could not be registered", "lease_id", le.LeaseID, "error", delErr)
+			return "", err
+		}
+		m.releaseLeaseCount(le.LeaseID)
 		return "", err
 	}
 
@@ -476,8 +699,15 @@ func (m *ExpirationManager) RegisterAuth(source string, auth *logical.Auth) erro
 		ExpireTime:  auth.ExpirationTime(),
 	}
 
+	// Count the lease against any quotas, revoking the token if the lease
+	// is not allowed
+	if err := m.acquireLeaseCount(&le); err != nil {
+		return err
+	}
+
 	// Encode the entry
 	if err := m.persistEntry(&le); err != nil {
+		m.releaseLeaseCount(le.LeaseID)
 		return err
 	}
 
@@ -486,6 +716,44 @@ func (m *ExpirationManager) RegisterAuth(source string, auth *logical.Auth) erro
 	return nil
 }
 
+// acquireLeaseCount counts a new lease against the lease count quotas. If a
+// quota has been reached, whatever the lease was for is revoked.
+func (m *ExpirationManager) acquireLeaseCount(le *leaseEntry) error {
+	if m.leaseCountQuotas == nil {
+		return nil
+	}
+
+	err := m.leaseCountQuotas.acquire(le.LeaseID)
+	if err == nil {
+		return nil
+	}
+	if isLeaseCountQuotaErr(err) {
+		if revokeErr := m.revokeEntry(le); revokeErr != nil {
+			m.logger.Error("expire: failed to revoke lease rejected by quota", "lease_id", le.LeaseID, "error", revokeErr)
+		}
+	}
+	return err
+}
+
+// releaseLeaseCount stops counting a lease against the lease count quotas
+func (m *ExpirationManager) releaseLeaseCount(leaseID string) {
+	if m.leaseCountQuotas != nil {
+		m.leaseCountQuotas.release(leaseID)
+	}
+}
+
+// listLeases returns the IDs of the leases stored under the given prefix
+func (m *ExpirationManager) listLeases(prefix string) ([]string, error) {
+	keys, err := CollectKeys(m.idView.SubView(prefix))
+	if err != nil {
+		return nil, err
+	}
+	for i, key := range keys {
+		keys[i] = prefix + key
+	}
+	return keys, nil
+}
+
 // FetchLeaseTimesByToken is a helper function to use token values to compute
 // the leaseID, rather than pushing that logic back into the token store.
 func (m *ExpirationManager) FetchLeaseTimesByToken(source, token string) (*leaseEntry, error) {
@@ -530,6 +798,18 @@ func (m *ExpirationManager) FetchLeaseTimes(leaseID string) (*leaseEntry, error)
 	return ret, nil
 }
 
+// ListLeases lists the lease IDs stored directly under the given prefix.
+// Entries ending in a slash are further prefixes.
+func (m *ExpirationManager) ListLeases(prefix string) ([]string, error) {
+	defer metrics.MeasureSince([]string{"expire", "list-leases"}, time.Now())
+
+	keys, err := m.idView.List(prefix)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list leases: %v", err)
+	}
+	return keys, nil
+}
+
 // updatePending is used to update a pending invocation for a lease
 func (m *ExpirationManager) updatePending(le *leaseEntry, leaseTotal time.Duration) {
 	m.pendingLock.Lock()
@@ -562,23 +842,137 @@ func (m *ExpirationManager) updatePending(le *leaseEntry, leaseTotal time.Durati
 
 // expireID is invoked when a given ID is expired
 func (m *ExpirationManager) expireID(leaseID string) {
+	m.expireAttempt(leaseID, 0)
+}
+
+// expireAttempt tries to revoke an expired lease. If that fails, another
+// attempt is scheduled after an exponential backoff, until the maximum
+// number of attempts is reached and the lease is marked irrevocable.
+func (m *ExpirationManager) expireAttempt(leaseID string, attempt uint) {
 	// Clear from the pending expiration
 	m.pendingLock.Lock()
 	delete(m.pending, leaseID)
+	quitCh := m.quitCh
 	m.pendingLock.Unlock()
 
-	for attempt := uint(0); attempt < maxRevokeAttempts; attempt++ {
-		err := m.Revoke(leaseID)
-		if err == nil {
-			if m.logger.IsInfo() {
-				m.logger.Info("expire: revoked lease", "lease_id", leaseID)
-			}
-			return
+	err := m.Revoke(leaseID)
+	if err == nil {
+		if m.logger.IsInfo() {
+			m.logger.Info("expire: revoked lease", "lease_id", leaseID)
+		}
+		return
+	}
+	m.logger.Error("expire: failed to revoke lease", "lease_id", leaseID, "attempt", attempt+1, "error", err)
+
+	// Nothing more is done once the manager has been stopped, or if the
+	// lease was renewed or revoked in the meantime. The lock is only held to
+	// check and update the pending timers; marking the lease irrevocable
+	// writes to storage and is done without it.
+	m.pendingLock.Lock()
+	select {
+	case <-quitCh:
+		m.pendingLock.Unlock()
+		return
+	default:
+	}
+	if _, ok := m.pending[leaseID]; ok {
+		m.pendingLock.Unlock()
+		return
+	}
+	if attempt+1 < m.maxRevokeAttempts {
+		m.pending[leaseID] = time.AfterFunc((1<<attempt)*m.revokeRetryBase, func() {
+			m.expireAttempt(leaseID, attempt+1)
+		})
+		m.pendingLock.Unlock()
+		return
+	}
+	m.pendingLock.Unlock()
+
+	m.logger.Error("expire: maximum revoke attempts reached, marking lease irrevocable", "lease_id", leaseID)
+	if err := m.markIrrevocable(leaseID, err); err != nil {
+		m.logger.Error("expire: failed to mark lease irrevocable", "lease_id", leaseID, "error", err)
+	}
+}
+
+// markIrrevocable records the error that prevented a lease from being
+// revoked and adds the lease to the irrevocable index. The lease is kept
+// without a revocation timer until it is revoked by an operator.
+func (m *ExpirationManager) markIrrevocable(leaseID string, revokeErr error) error {
+	le, err := m.loadEntry(leaseID)
+	if err != nil {
+		return err
+	}
+	if le == nil {
+		return nil
+	}
+
+	le.RevokeErr = revokeErr.Error()
+	buf, err := le.encode()
+	if err != nil {
+		return fmt.Errorf("failed to encode lease entry: %v", err)
+	}
+
+	// Write the entry and the index together so that a lease is never
+	// indexed as irrevocable without its error, or the reverse
+	txns := []logical.TxnEntry{
+		logical.TxnEntry{
+			Operation: physical.PutOperation,
+			Entry: &logical.StorageEntry{
+				Key:   leaseViewPrefix + leaseID,
+				Value: buf,
+			},
+		},
+		logical.TxnEntry{
+			Operation: physical.PutOperation,
+			Entry: &logical.StorageEntry{
+				Key:   irrevocableViewPrefix + leaseID,
+				Value: []byte(le.RevokeErr),
+			},
+		},
+	}
+	if err := logical.ApplyTxn(m.view, txns); err != nil {
+		return fmt.Errorf("failed to persist irrevocable lease: %v", err)
+	}
+	metrics.IncrCounter([]string{"expire", "irrevocable"}, 1)
+	return nil
+}
+
+// ListIrrevocable returns the leases that could not be revoked when they
+// expired, mapped to the last revocation error
+func (m *ExpirationManager) ListIrrevocable() (map[string]string, error) {
+	leaseIDs, err := CollectKeys(m.irrevocableView)
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan for irrevocable leases: %v", err)
+	}
+
+	leases := make(map[string]string, len(leaseIDs))
+	for _, leaseID := range leaseIDs {
+		out, err := m.irrevocableView.Get(leaseID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read irrevocable lease index: %v", err)
+		}
+		if out == nil {
+			continue
 		}
-		m.logger.Error("expire: failed to revoke lease", "lease_id", leaseID, "error", err)
-		time.Sleep((1 << attempt) * revokeRetryBase)
+		leases[leaseID] = string(out.Value)
 	}
-	m.logger.Error("expire: maximum revoke attempts reached", "lease_id", leaseID)
+	return leases, nil
+}
+
+// RevokeIrrevocable deletes a lease that was marked irrevocable. The
+// backend is asked to revoke it once more, but the lease is deleted even if
+// that fails.
+func (m *ExpirationManager) RevokeIrrevocable(leaseID string) error {
+	defer metrics.MeasureSince([]string{"expire", "revoke-irrevocable"}, time.Now())
+
+	le, err := m.loadEntry(leaseID)
+	if err != nil {
+		return err
+	}
+	if le == nil || le.RevokeErr == "" {
+		return fmt.Errorf("lease is not irrevocable")
+	}
+	return m.revokeCommon(leaseID, true, false)
 }
 
 // revokeEntry is used to attempt revocation of an internal entry
@@ -623,7 +1017,13 @@ func (m *ExpirationManager) renewAuthEntry(req *logical.Request, le *leaseEntry,
 	auth := *le.Auth
 	auth.IssueTime = le.IssueTime
 	auth.Increment = increment
-	if strings.HasPrefix(le.Path, "auth/token/") {
+
+	// The token store of a namespace is mounted below the namespace path
+	relativePath := le.Path
+	if me := m.router.MatchingMountEntry(le.Path); me != nil {
+		relativePath = strings.TrimPrefix(le.Path, me.NamespacePath)
+	}
+	if strings.HasPrefix(relativePath, "auth/token/") {
 		auth.ClientToken = le.ClientToken
 	} else {
 		auth.ClientToken = ""
@@ -673,6 +1073,63 @@ func (m *ExpirationManager) persistEntry(le *leaseEntry) error {
 	return nil
 }
 
+// persistEntryWithIndex is used to persist a new lease entry along with the
+// secondary index from its token, in a single transaction if the storage
+// supports it
+func (m *ExpirationManager) persistEntryWithIndex(le *leaseEntry) error {
+	buf, err := le.encode()
+	if err != nil {
+		return fmt.Errorf("failed to encode lease entry: %v", err)
+	}
+
+	txns := []logical.TxnEntry{
+		logical.TxnEntry{
+			Operation: physical.PutOperation,
+			Entry: &logical.StorageEntry{
+				Key:   leaseViewPrefix + le.LeaseID,
+				Value: buf,
+			},
+		},
+		logical.TxnEntry{
+			Operation: physical.PutOperation,
+			Entry: &logical.StorageEntry{
+				Key:   tokenViewPrefix + m.indexByTokenKey(le.ClientToken, le.LeaseID),
+				Value: []byte(le.LeaseID),
+			},
+		},
+	}
+	if err := logical.ApplyTxn(m.view, txns); err != nil {
+		return fmt.Errorf("failed to persist lease entry: %v", err)
+	}
+	return nil
+}
+
+// deleteEntryWithIndexes is used to delete a lease entry along with the
+// secondary index from its token and, for an irrevocable lease, its entry in
+// the irrevocable index, in a single transaction if the storage supports it
+func (m *ExpirationManager) deleteEntryWithIndexes(le *leaseEntry) error {
+	txns := []logical.TxnEntry{
+		logical.TxnEntry{
+			Operation: physical.DeleteOperation,
+			Entry:     &logical.StorageEntry{Key: leaseViewPrefix + le.LeaseID},
+		},
+		logical.TxnEntry{
+			Operation: physical.DeleteOperation,
+			Entry:     &logical.StorageEntry{Key: tokenViewPrefix + m.indexByTokenKey(le.ClientToken, le.LeaseID)},
+		},
+	}
+	if le.RevokeErr != "" {
+		txns = append(txns, logical.TxnEntry{
+			Operation: physical.DeleteOperation,
+			Entry:     &logical.StorageEntry{Key: irrevocableViewPrefix + le.LeaseID},
+		})
+	}
+	if err := logical.ApplyTxn(m.view, txns); err != nil {
+		return fmt.Errorf("failed to delete lease entry: %v", err)
+	}
+	return nil
+}
+
 // deleteEntry is used to delete a lease entry
 func (m *ExpirationManager) deleteEntry(leaseID string) error {
 	if err := m.idView.Delete(leaseID); err != nil {
@@ -684,7 +1141,7 @@ func (m *ExpirationManager) deleteEntry(leaseID string) error {
 // createIndexByToken creates a secondary index from the token to a lease entry
 func (m *ExpirationManager) createIndexByToken(token, leaseID string) error {
 	ent := logical.StorageEntry{
-		Key:   m.tokenStore.SaltID(token) + "/" + m.tokenStore.SaltID(leaseID),
+		Key:   m.indexByTokenKey(token, leaseID),
 		Value: []byte(leaseID),
 	}
 	if err := m.tokenView.Put(&ent); err != nil {
@@ -695,7 +1152,7 @@ func (m *ExpirationManager) createIndexByToken(token, leaseID string) error {
 
 // indexByToken looks up the secondary index from the token to a lease entry
 func (m *ExpirationManager) indexByToken(token, leaseID string) (*logical.StorageEntry, error) {
-	key := m.tokenStore.SaltID(token) + "/" + m.tokenStore.SaltID(leaseID)
+	key := m.indexByTokenKey(token, leaseID)
 	entry, err := m.tokenView.Get(key)
 	if err != nil {
 		return nil, fmt.Errorf("failed to look up secondary index entry")
@@ -705,13 +1162,19 @@ func (m *ExpirationManager) indexByToken(token, leaseID string) (*logical.Storag
 
 // removeIndexByToken removes the secondary index from the token to a lease entry
 func (m *ExpirationManager) removeIndexByToken(token, leaseID string) error {
-	key := m.tokenStore.SaltID(token) + "/" + m.tokenStore.SaltID(leaseID)
+	key := m.indexByTokenKey(token, leaseID)
 	if err := m.tokenView.Delete(key); err != nil {
 		return fmt.Errorf("failed to delete lease index entry: %v", err)
 	}
 	return nil
 }
 
+// indexByTokenKey returns the key of the secondary index from the token to a
+// lease entry within the token view
+func (m *ExpirationManager) indexByTokenKey(token, leaseID string) string {
+	return m.tokenStore.SaltID(token) + "/" + m.tokenStore.SaltID(leaseID)
+}
+
 // lookupByToken is used to lookup all the leaseID's via the
 func (m *ExpirationManager) lookupByToken(token string) ([]string, error) {
 	// Scan via the index for sub-leases
@@ -756,6 +1219,10 @@ type leaseEntry struct {
 	IssueTime       time.Time              `json:"issue_time"`
 	ExpireTime      time.Time              `json:"expire_time"`
 	LastRenewalTime time.Time              `json:"last_renewal_time"`
+
+	// RevokeErr is the last revocation error of a lease that could not be
+	// revoked when it expired, which marks the lease irrevocable
+	RevokeErr string `json:"revoke_err,omitempty"`
 }
 
 // encode is used to JSON encode the lease entry
@@ -769,6 +1236,11 @@ func (le *leaseEntry) renewable() error {
 		return fmt.Errorf("lease not found or lease is not renewable")
 	}
 
+	// An irrevocable lease is only kept around to be dealt with
+	if le.RevokeErr != "" {
+		return fmt.Errorf("lease is irrevocable")
+	}
+
 	// Determine if the lease is expired
 	if le.ExpireTime.Before(time.Now()) {
 		return fmt.Errorf("lease expired")
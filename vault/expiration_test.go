@@ -5,6 +5,7 @@ import (
 	"reflect"
 	"sort"
 	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -89,6 +90,152 @@ func TestExpiration_Restore(t *testing.T) {
 	}
 }
 
+func TestExpiration_RestoreOnDemand(t *testing.T) {
+	exp := mockExpiration(t)
+	noop := &NoopBackend{}
+	_, barrier, _ := mockBarrier(t)
+	view := NewBarrierView(barrier, "logical/")
+	meUUID, err := uuid.GenerateUUID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp.router.Mount(noop, "prod/aws/", &MountEntry{UUID: meUUID}, view)
+
+	var leaseIDs []string
+	for _, path := range []string{"prod/aws/foo", "prod/aws/bar", "prod/aws/zip"} {
+		req := &logical.Request{
+			Operation: logical.ReadOperation,
+			Path:      path,
+		}
+		resp := &logical.Response{
+			Secret: &logical.Secret{
+				LeaseOptions: logical.LeaseOptions{
+					TTL: time.Hour,
+				},
+			},
+			Data: map[string]interface{}{
+				"access_key": "xyz",
+				"secret_key": "abcd",
+			},
+		}
+		leaseID, err := exp.Register(req, resp)
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		leaseIDs = append(leaseIDs, leaseID)
+	}
+
+	// Stop everything, then start a restore without loading any lease
+	if err := exp.Stop(); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	quitCh := exp.startRestore()
+	if inProgress, restored, _ := exp.restoreStatus(); !inProgress || restored != 0 {
+		t.Fatalf("bad: %v %d", inProgress, restored)
+	}
+
+	// Revoking a lease that has not been restored loads it first
+	if err := exp.Revoke(leaseIDs[0]); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	exp.pendingLock.Lock()
+	pending := len(exp.pending)
+	exp.pendingLock.Unlock()
+	if pending != 0 {
+		t.Fatalf("bad: %d", pending)
+	}
+	if _, restored, _ := exp.restoreStatus(); restored != 1 {
+		t.Fatalf("bad: %d", restored)
+	}
+
+	// Finish the restore, which sets up the timers of the other leases
+	if err := exp.restore(quitCh); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	inProgress, restored, total := exp.restoreStatus()
+	if inProgress || restored != 3 || total != 2 {
+		t.Fatalf("bad: %v %d %d", inProgress, restored, total)
+	}
+	exp.pendingLock.Lock()
+	pending = len(exp.pending)
+	exp.pendingLock.Unlock()
+	if pending != 2 {
+		t.Fatalf("bad: %d", pending)
+	}
+
+	// A restore ended by stopping sets up no timers
+	if err := exp.Stop(); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	quitCh = exp.startRestore()
+	if err := exp.Stop(); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if err := exp.restore(quitCh); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	exp.pendingLock.Lock()
+	pending = len(exp.pending)
+	exp.pendingLock.Unlock()
+	if pending != 0 {
+		t.Fatalf("bad: %d", pending)
+	}
+}
+
+func TestExpiration_RestoreSkipsFailedLeases(t *testing.T) {
+	exp := mockExpiration(t)
+	noop := &NoopBackend{}
+	_, barrier, _ := mockBarrier(t)
+	view := NewBarrierView(barrier, "logical/")
+	meUUID, err := uuid.GenerateUUID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp.router.Mount(noop, "prod/aws/", &MountEntry{UUID: meUUID}, view)
+
+	req := &logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "prod/aws/foo",
+	}
+	resp := &logical.Response{
+		Secret: &logical.Secret{
+			LeaseOptions: logical.LeaseOptions{
+				TTL: time.Hour,
+			},
+		},
+	}
+	if _, err := exp.Register(req, resp); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	// Store a lease entry that can't be decoded
+	if err := exp.idView.Put(&logical.StorageEntry{Key: "prod/aws/corrupt", Value: []byte("{")}); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	if err := exp.Stop(); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	// The corrupt lease is skipped and the other one still restored
+	if err := exp.Restore(); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	inProgress, restored, total := exp.restoreStatus()
+	if inProgress || restored != 1 || total != 2 {
+		t.Fatalf("bad: %v %d %d", inProgress, restored, total)
+	}
+	if failed := atomic.LoadInt64(&exp.restoreFailed); failed != 1 {
+		t.Fatalf("bad: %d", failed)
+	}
+	exp.pendingLock.Lock()
+	pending := len(exp.pending)
+	exp.pendingLock.Unlock()
+	if pending != 1 {
+		t.Fatalf("bad: %d", pending)
+	}
+}
+
 func TestExpiration_Register(t *testing.T) {
 	exp := mockExpiration(t)
 	req := &logical.Request{
@@ -651,6 +798,114 @@ func TestExpiration_Renew_RevokeOnExpire(t *testing.T) {
 	}
 }
 
+func TestExpiration_Irrevocable(t *testing.T) {
+	exp := mockExpiration(t)
+	exp.maxRevokeAttempts = 2
+	exp.revokeRetryBase = 5 * time.Millisecond
+	noop := &NoopBackend{
+		Response: logical.ErrorResponse("connection refused"),
+	}
+	_, barrier, _ := mockBarrier(t)
+	view := NewBarrierView(barrier, "logical/")
+	meUUID, err := uuid.GenerateUUID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp.router.Mount(noop, "prod/aws/", &MountEntry{UUID: meUUID}, view)
+
+	req := &logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "prod/aws/foo",
+	}
+	resp := &logical.Response{
+		Secret: &logical.Secret{
+			LeaseOptions: logical.LeaseOptions{
+				TTL:       10 * time.Millisecond,
+				Renewable: true,
+			},
+		},
+		Data: map[string]interface{}{
+			"access_key": "xyz",
+			"secret_key": "abcd",
+		},
+	}
+	leaseID, err := exp.Register(req, resp)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	// Only a lease marked irrevocable can be deleted that way
+	if err := exp.RevokeIrrevocable(leaseID); err == nil {
+		t.Fatalf("expected error")
+	}
+
+	// Wait for the revocation attempts to run out
+	var leases map[string]string
+	start := time.Now()
+	for time.Now().Sub(start) < time.Second {
+		leases, err = exp.ListIrrevocable()
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		if len(leases) > 0 {
+			break
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if len(leases) != 1 || !strings.Contains(leases[leaseID], "connection refused") {
+		t.Fatalf("bad: %#v", leases)
+	}
+
+	noop.Lock()
+	attempts := len(noop.Requests)
+	noop.Unlock()
+	if attempts != 2 {
+		t.Fatalf("bad: %d", attempts)
+	}
+
+	// The lease can no longer be renewed, and gets no timer when restored
+	if _, err := exp.Renew(leaseID, 0); err == nil || !strings.Contains(err.Error(), "irrevocable") {
+		t.Fatalf("bad: %v", err)
+	}
+	if err := exp.Stop(); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if err := exp.Restore(); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	exp.pendingLock.Lock()
+	pending := len(exp.pending)
+	exp.pendingLock.Unlock()
+	if pending != 0 {
+		t.Fatalf("bad: %d", pending)
+	}
+
+	// Deleting the lease asks the backend once more but ignores the error
+	if err := exp.RevokeIrrevocable(leaseID); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	le, err := exp.loadEntry(leaseID)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if le != nil {
+		t.Fatalf("bad: %#v", le)
+	}
+	leases, err = exp.ListIrrevocable()
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if len(leases) != 0 {
+		t.Fatalf("bad: %#v", leases)
+	}
+	noop.Lock()
+	attempts = len(noop.Requests)
+	noop.Unlock()
+	if attempts != 3 {
+		t.Fatalf("bad: %d", attempts)
+	}
+}
+
 func TestExpiration_revokeEntry(t *testing.T) {
 	exp := mockExpiration(t)
 
@@ -1048,3 +1303,147 @@ func badRenewFactory(conf *logical.BackendConfig) (logical.Backend, error) {
 
 	return be.Setup(conf)
 }
+
+func TestExpiration_Tidy(t *testing.T) {
+	exp := mockExpiration(t)
+	noop := &NoopBackend{}
+	_, barrier, _ := mockBarrier(t)
+	view := NewBarrierView(barrier, "logical/")
+	meUUID, err := uuid.GenerateUUID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp.router.Mount(noop, "prod/aws/", &MountEntry{UUID: meUUID}, view)
+
+	root, err := exp.tokenStore.rootToken()
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	gone := &TokenEntry{Path: "auth/token/create", Policies: []string{"root"}}
+	if err := exp.tokenStore.create(gone); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	register := func(token string) string {
+		req := &logical.Request{
+			Operation:   logical.ReadOperation,
+			Path:        "prod/aws/foo",
+			ClientToken: token,
+		}
+		resp := &logical.Response{
+			Secret: &logical.Secret{
+				LeaseOptions: logical.LeaseOptions{
+					TTL: time.Hour,
+				},
+			},
+		}
+		id, err := exp.Register(req, resp)
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		return id
+	}
+	kept := register(root.ID)
+	orphaned := register(gone.ID)
+
+	// Simulate an interrupted revocation of the token, and a lost index
+	// entry of the lease that is kept
+	if err := exp.tokenStore.view.Delete(lookupPrefix + exp.tokenStore.SaltID(gone.ID)); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if err := exp.removeIndexByToken(root.ID, kept); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	if err := exp.Tidy(); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	// The lease of the missing token is revoked through the backend
+	le, err := exp.loadEntry(orphaned)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if le != nil {
+		t.Fatalf("lease should have been revoked")
+	}
+	if len(noop.Requests) != 1 || noop.Requests[0].Operation != logical.RevokeOperation {
+		t.Fatalf("bad: %#v", noop.Requests)
+	}
+	index, err := exp.indexByToken(gone.ID, orphaned)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if index != nil {
+		t.Fatalf("index entry should have been removed")
+	}
+
+	// The other lease is kept and its index restored
+	leases, err := exp.lookupByToken(root.ID)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if !reflect.DeepEqual(leases, []string{kept}) {
+		t.Fatalf("bad: %#v", leases)
+	}
+}
+
+func TestExpiration_TidyStopped(t *testing.T) {
+	exp := mockExpiration(t)
+	noop := &NoopBackend{}
+	_, barrier, _ := mockBarrier(t)
+	view := NewBarrierView(barrier, "logical/")
+	meUUID, err := uuid.GenerateUUID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp.router.Mount(noop, "prod/aws/", &MountEntry{UUID: meUUID}, view)
+
+	gone := &TokenEntry{Path: "auth/token/create", Policies: []string{"root"}}
+	if err := exp.tokenStore.create(gone); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	req := &logical.Request{
+		Operation:   logical.ReadOperation,
+		Path:        "prod/aws/foo",
+		ClientToken: gone.ID,
+	}
+	resp := &logical.Response{
+		Secret: &logical.Secret{
+			LeaseOptions: logical.LeaseOptions{
+				TTL: time.Hour,
+			},
+		},
+	}
+	orphaned, err := exp.Register(req, resp)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if err := exp.tokenStore.view.Delete(lookupPrefix + exp.tokenStore.SaltID(gone.ID)); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	// Once the manager is stopped, as it is at seal, a tidy stops without
+	// revoking anything
+	exp.pendingLock.Lock()
+	quitCh := exp.quitCh
+	exp.pendingLock.Unlock()
+	close(quitCh)
+	if _, _, err := exp.tidyLeases(quitCh); err != errTidyStopped {
+		t.Fatalf("err: %v", err)
+	}
+	if _, err := exp.tidyTokenIndex(quitCh); err != errTidyStopped {
+		t.Fatalf("err: %v", err)
+	}
+
+	le, err := exp.loadEntry(orphaned)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if le == nil {
+		t.Fatalf("lease should have been kept")
+	}
+	if len(noop.Requests) != 0 {
+		t.Fatalf("bad: %#v", noop.Requests)
+	}
+}
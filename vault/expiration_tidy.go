@@ -0,0 +1,171 @@
+package vault
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/armon/go-metrics"
+	"github.com/hashicorp/go-multierror"
+)
+
+// Tidy revokes the leases whose token no longer exists and repairs the
+// index from tokens to leases, such as after a revocation was interrupted.
+// It is safe to run alongside normal traffic: tokens are looked up under
+// their token lock, and revoking a lease that was revoked in the meantime
+// does nothing. The operation stops early if the manager is stopped.
+func (m *ExpirationManager) Tidy() error {
+	defer metrics.MeasureSince([]string{"expire", "tidy"}, time.Now())
+
+	m.pendingLock.Lock()
+	quitCh := m.quitCh
+	m.pendingLock.Unlock()
+
+	m.logger.Info("expire: beginning tidy operation on leases")
+
+	var tidyErrors *multierror.Error
+	revoked, restored, err := m.tidyLeases(quitCh)
+	if err == errTidyStopped {
+		return err
+	}
+	if err != nil {
+		tidyErrors = multierror.Append(tidyErrors, err)
+	}
+	metrics.IncrCounter([]string{"expire", "tidy", "revoked_leases"}, float32(revoked))
+	metrics.IncrCounter([]string{"expire", "tidy", "restored_index_entries"}, float32(restored))
+
+	deleted, err := m.tidyTokenIndex(quitCh)
+	if err == errTidyStopped {
+		return err
+	}
+	if err != nil {
+		tidyErrors = multierror.Append(tidyErrors, err)
+	}
+	metrics.IncrCounter([]string{"expire", "tidy", "deleted_index_entries"}, float32(deleted))
+
+	m.logger.Info("expire: finished tidy operation on leases",
+		"revoked_leases", revoked,
+		"restored_index_entries", restored,
+		"deleted_index_entries", deleted)
+
+	return tidyErrors.ErrorOrNil()
+}
+
+// tidyLeases revokes the leases whose token no longer exists, and restores
+// the token index entries missing for the others
+func (m *ExpirationManager) tidyLeases(quitCh chan struct{}) (int, int, error) {
+	leaseIDs, err := CollectKeys(m.idView)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to scan for leases: %v", err)
+	}
+
+	m.logger.Info("expire: checking leases", "lease_count", len(leaseIDs))
+
+	var revoked, restored int
+	var tidyErrors *multierror.Error
+	for i, leaseID := range leaseIDs {
+		select {
+		case <-quitCh:
+			return revoked, restored, errTidyStopped
+		default:
+		}
+
+		if i > 0 && i%tidyProgressInterval == 0 {
+			m.logger.Info("expire: tidy progress", "checked_leases", i, "lease_count", len(leaseIDs))
+		}
+
+		le, err := m.loadEntry(leaseID)
+		if err != nil {
+			tidyErrors = multierror.Append(tidyErrors, err)
+			continue
+		}
+		if le == nil || le.ClientToken == "" {
+			continue
+		}
+
+		te, err := m.tokenStore.Lookup(le.ClientToken)
+		if err != nil {
+			tidyErrors = multierror.Append(tidyErrors, fmt.Errorf("failed to look up token of lease %q: %v", leaseID, err))
+			continue
+		}
+
+		if te == nil {
+			// The lease of a token only needs cleaning up, while a secret
+			// is revoked as it would have been along with its token
+			if err := m.revokeCommon(leaseID, false, le.Auth != nil); err != nil {
+				tidyErrors = multierror.Append(tidyErrors, fmt.Errorf("failed to revoke lease %q: %v", leaseID, err))
+				continue
+			}
+			revoked++
+			continue
+		}
+
+		if le.Auth != nil {
+			continue
+		}
+		index, err := m.indexByToken(le.ClientToken, leaseID)
+		if err != nil {
+			tidyErrors = multierror.Append(tidyErrors, err)
+			continue
+		}
+		if index == nil {
+			if err := m.createIndexByToken(le.ClientToken, leaseID); err != nil {
+				tidyErrors = multierror.Append(tidyErrors, err)
+				continue
+			}
+			restored++
+		}
+	}
+
+	return revoked, restored, tidyErrors.ErrorOrNil()
+}
+
+// tidyTokenIndex removes the token index entries of leases that no longer
+// exist
+func (m *ExpirationManager) tidyTokenIndex(quitCh chan struct{}) (int, error) {
+	keys, err := CollectKeys(m.tokenView)
+	if err != nil {
+		return 0, fmt.Errorf("failed to scan lease index: %v", err)
+	}
+
+	m.logger.Info("expire: checking lease index", "index_entry_count", len(keys))
+
+	var deleted int
+	var tidyErrors *multierror.Error
+	for i, key := range keys {
+		select {
+		case <-quitCh:
+			return deleted, errTidyStopped
+		default:
+		}
+
+		if i > 0 && i%tidyProgressInterval == 0 {
+			m.logger.Info("expire: tidy progress", "checked_index_entries", i, "index_entry_count", len(keys))
+		}
+
+		index, err := m.tokenView.Get(key)
+		if err != nil {
+			tidyErrors = multierror.Append(tidyErrors, fmt.Errorf("failed to read lease index: %v", err))
+			continue
+		}
+		if index == nil {
+			continue
+		}
+
+		le, err := m.loadEntry(string(index.Value))
+		if err != nil {
+			tidyErrors = multierror.Append(tidyErrors, err)
+			continue
+		}
+		if le != nil {
+			continue
+		}
+
+		if err := m.tokenView.Delete(key); err != nil {
+			tidyErrors = multierror.Append(tidyErrors, fmt.Errorf("failed to delete lease index entry: %v", err))
+			continue
+		}
+		deleted++
+	}
+
+	return deleted, tidyErrors.ErrorOrNil()
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"strings"
 
+	"github.com/hashicorp/errwrap"
 	"github.com/hashicorp/vault/helper/jsonutil"
 	"github.com/hashicorp/vault/logical"
 	"github.com/hashicorp/vault/logical/framework"
@@ -16,6 +17,12 @@ func CubbyholeBackendFactory(conf *logical.BackendConfig) (logical.Backend, erro
 	b.Backend = &framework.Backend{
 		Help: strings.TrimSpace(cubbyholeHelp),
 
+		PathsSpecial: &logical.Paths{
+			PerformanceStandby: []string{
+				"*",
+			},
+		},
+
 		Paths: []*framework.Path{
 			&framework.Path{
 				Pattern: ".*",
@@ -130,7 +137,7 @@ func (b *CubbyholeBackend) handleWrite(
 		Value: buf,
 	}
 	if err := req.Storage.Put(entry); err != nil {
-		return nil, fmt.Errorf("failed to write: %v", err)
+		return nil, errwrap.Wrapf("failed to write: {{err}}", err)
 	}
 
 	return nil, nil
@@ -13,9 +13,12 @@ import (
 func TestCubbyholeBackend_RootPaths(t *testing.T) {
 	b := testCubbyholeBackend()
 	root := b.SpecialPaths()
-	if root != nil {
+	if root == nil || len(root.Root) != 0 || len(root.Unauthenticated) != 0 {
 		t.Fatalf("unexpected: %v", root)
 	}
+	if !reflect.DeepEqual(root.PerformanceStandby, []string{"*"}) {
+		t.Fatalf("unexpected: %v", root.PerformanceStandby)
+	}
 }
 
 func TestCubbyholeBackend_Write(t *testing.T) {
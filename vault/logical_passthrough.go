@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"strings"
 
+	"github.com/hashicorp/errwrap"
 	"github.com/hashicorp/vault/helper/duration"
 	"github.com/hashicorp/vault/helper/jsonutil"
 	"github.com/hashicorp/vault/logical"
@@ -31,6 +32,12 @@ func LeaseSwitchedPassthroughBackend(conf *logical.BackendConfig, leases bool) (
 	b.Backend = &framework.Backend{
 		Help: strings.TrimSpace(passthroughHelp),
 
+		PathsSpecial: &logical.Paths{
+			PerformanceStandby: []string{
+				"*",
+			},
+		},
+
 		Paths: []*framework.Path{
 			&framework.Path{
 				Pattern: ".*",
@@ -167,7 +174,7 @@ func (b *PassthroughBackend) handleWrite(
 		Value: buf,
 	}
 	if err := req.Storage.Put(entry); err != nil {
-		return nil, fmt.Errorf("failed to write: %v", err)
+		return nil, errwrap.Wrapf("failed to write: {{err}}", err)
 	}
 
 	return nil, nil
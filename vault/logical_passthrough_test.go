@@ -12,9 +12,12 @@ func TestPassthroughBackend_RootPaths(t *testing.T) {
 	b := testPassthroughBackend()
 	test := func(b logical.Backend) {
 		root := b.SpecialPaths()
-		if root != nil {
+		if root == nil || len(root.Root) != 0 || len(root.Unauthenticated) != 0 {
 			t.Fatalf("unexpected: %v", root)
 		}
+		if !reflect.DeepEqual(root.PerformanceStandby, []string{"*"}) {
+			t.Fatalf("unexpected: %v", root.PerformanceStandby)
+		}
 	}
 	test(b)
 	b = testPassthroughLeasedBackend()
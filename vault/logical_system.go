@@ -5,8 +5,10 @@ import (
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/hashicorp/vault/helper/duration"
@@ -36,10 +38,28 @@ func NewSystemBackend(core *Core, config *logical.BackendConfig) (logical.Backen
 				"auth/*",
 				"remount",
 				"revoke-prefix/*",
+				"leases/lookup/*",
+				"leases/tidy",
+				"leases/irrevocable/*",
 				"audit",
 				"audit/*",
+				"audit-hash-chain-key/*",
 				"raw/*",
 				"rotate",
+				"replication/*",
+				"quotas/*",
+				"namespaces/*",
+			},
+
+			PerformanceStandby: []string{
+				"auth",
+				"capabilities",
+				"capabilities-accessor",
+				"capabilities-self",
+				"metrics",
+				"mounts",
+				"policy",
+				"policy/*",
 			},
 		},
 
@@ -165,6 +185,18 @@ func NewSystemBackend(core *Core, config *logical.BackendConfig) (logical.Backen
 						Type:        framework.TypeString,
 						Description: strings.TrimSpace(sysHelp["tune_max_lease_ttl"][0]),
 					},
+					"audit_non_hmac_request_keys": &framework.FieldSchema{
+						Type:        framework.TypeCommaStringSlice,
+						Description: strings.TrimSpace(sysHelp["tune_audit_non_hmac_request_keys"][0]),
+					},
+					"audit_non_hmac_response_keys": &framework.FieldSchema{
+						Type:        framework.TypeCommaStringSlice,
+						Description: strings.TrimSpace(sysHelp["tune_audit_non_hmac_response_keys"][0]),
+					},
+					"token_type": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: strings.TrimSpace(sysHelp["tune_token_type"][0]),
+					},
 				},
 				Callbacks: map[logical.Operation]framework.OperationFunc{
 					logical.ReadOperation:   b.handleAuthTuneRead,
@@ -190,6 +222,18 @@ func NewSystemBackend(core *Core, config *logical.BackendConfig) (logical.Backen
 						Type:        framework.TypeString,
 						Description: strings.TrimSpace(sysHelp["tune_max_lease_ttl"][0]),
 					},
+					"audit_non_hmac_request_keys": &framework.FieldSchema{
+						Type:        framework.TypeCommaStringSlice,
+						Description: strings.TrimSpace(sysHelp["tune_audit_non_hmac_request_keys"][0]),
+					},
+					"audit_non_hmac_response_keys": &framework.FieldSchema{
+						Type:        framework.TypeCommaStringSlice,
+						Description: strings.TrimSpace(sysHelp["tune_audit_non_hmac_response_keys"][0]),
+					},
+					"token_type": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: strings.TrimSpace(sysHelp["tune_token_type"][0]),
+					},
 				},
 
 				Callbacks: map[logical.Operation]framework.OperationFunc{
@@ -291,6 +335,93 @@ func NewSystemBackend(core *Core, config *logical.BackendConfig) (logical.Backen
 				HelpDescription: strings.TrimSpace(sysHelp["renew"][1]),
 			},
 
+			&framework.Path{
+				Pattern: "leases/lookup$",
+
+				Fields: map[string]*framework.FieldSchema{
+					"lease_id": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: strings.TrimSpace(sysHelp["lease_id"][0]),
+					},
+				},
+
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.UpdateOperation: b.handleLeaseLookup,
+				},
+
+				HelpSynopsis:    strings.TrimSpace(sysHelp["leases-lookup"][0]),
+				HelpDescription: strings.TrimSpace(sysHelp["leases-lookup"][1]),
+			},
+
+			&framework.Path{
+				Pattern: "leases/lookup/(?P<prefix>.*)$",
+
+				Fields: map[string]*framework.FieldSchema{
+					"prefix": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: strings.TrimSpace(sysHelp["leases-list-prefix"][0]),
+					},
+				},
+
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.ListOperation: b.handleLeaseLookupList,
+				},
+
+				HelpSynopsis:    strings.TrimSpace(sysHelp["leases-list"][0]),
+				HelpDescription: strings.TrimSpace(sysHelp["leases-list"][1]),
+			},
+
+			&framework.Path{
+				Pattern: "leases/tidy$",
+
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.UpdateOperation: b.handleLeaseTidy,
+				},
+
+				HelpSynopsis:    strings.TrimSpace(sysHelp["leases-tidy"][0]),
+				HelpDescription: strings.TrimSpace(sysHelp["leases-tidy"][1]),
+			},
+
+			&framework.Path{
+				Pattern: "leases/restore-status$",
+
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.ReadOperation: b.handleLeaseRestoreStatus,
+				},
+
+				HelpSynopsis:    strings.TrimSpace(sysHelp["leases-restore-status"][0]),
+				HelpDescription: strings.TrimSpace(sysHelp["leases-restore-status"][1]),
+			},
+
+			&framework.Path{
+				Pattern: "leases/irrevocable/?$",
+
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.ListOperation: b.handleLeaseIrrevocableList,
+				},
+
+				HelpSynopsis:    strings.TrimSpace(sysHelp["leases-irrevocable-list"][0]),
+				HelpDescription: strings.TrimSpace(sysHelp["leases-irrevocable-list"][1]),
+			},
+
+			&framework.Path{
+				Pattern: "leases/irrevocable/(?P<lease_id>.+)",
+
+				Fields: map[string]*framework.FieldSchema{
+					"lease_id": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: strings.TrimSpace(sysHelp["leases-irrevocable-lease-id"][0]),
+					},
+				},
+
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.DeleteOperation: b.handleLeaseIrrevocableDelete,
+				},
+
+				HelpSynopsis:    strings.TrimSpace(sysHelp["leases-irrevocable"][0]),
+				HelpDescription: strings.TrimSpace(sysHelp["leases-irrevocable"][1]),
+			},
+
 			&framework.Path{
 				Pattern: "revoke/(?P<lease_id>.+)",
 
@@ -419,6 +550,37 @@ func NewSystemBackend(core *Core, config *logical.BackendConfig) (logical.Backen
 				HelpDescription: strings.TrimSpace(sysHelp["policy"][1]),
 			},
 
+			&framework.Path{
+				Pattern: "namespaces/?$",
+
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.ListOperation: b.handleNamespacesList,
+				},
+
+				HelpSynopsis:    strings.TrimSpace(sysHelp["namespaces"][0]),
+				HelpDescription: strings.TrimSpace(sysHelp["namespaces"][1]),
+			},
+
+			&framework.Path{
+				Pattern: "namespaces/(?P<path>.+)",
+
+				Fields: map[string]*framework.FieldSchema{
+					"path": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: strings.TrimSpace(sysHelp["namespace-path"][0]),
+					},
+				},
+
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.ReadOperation:   b.handleNamespaceRead,
+					logical.UpdateOperation: b.handleNamespaceCreate,
+					logical.DeleteOperation: b.handleNamespaceDelete,
+				},
+
+				HelpSynopsis:    strings.TrimSpace(sysHelp["namespace"][0]),
+				HelpDescription: strings.TrimSpace(sysHelp["namespace"][1]),
+			},
+
 			&framework.Path{
 				Pattern:         "seal-status$",
 				HelpSynopsis:    strings.TrimSpace(sysHelp["seal-status"][0]),
@@ -459,6 +621,24 @@ func NewSystemBackend(core *Core, config *logical.BackendConfig) (logical.Backen
 				HelpDescription: strings.TrimSpace(sysHelp["audit-hash"][1]),
 			},
 
+			&framework.Path{
+				Pattern: "audit-hash-chain-key/(?P<path>.+)",
+
+				Fields: map[string]*framework.FieldSchema{
+					"path": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: strings.TrimSpace(sysHelp["audit_path"][0]),
+					},
+				},
+
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.ReadOperation: b.handleAuditHashChainKey,
+				},
+
+				HelpSynopsis:    strings.TrimSpace(sysHelp["audit-hash-chain-key"][0]),
+				HelpDescription: strings.TrimSpace(sysHelp["audit-hash-chain-key"][1]),
+			},
+
 			&framework.Path{
 				Pattern: "audit$",
 
@@ -490,6 +670,10 @@ func NewSystemBackend(core *Core, config *logical.BackendConfig) (logical.Backen
 						Type:        framework.TypeMap,
 						Description: strings.TrimSpace(sysHelp["audit_opts"][0]),
 					},
+					"filter": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: strings.TrimSpace(sysHelp["audit_filter"][0]),
+					},
 				},
 
 				Callbacks: map[logical.Operation]framework.OperationFunc{
@@ -542,6 +726,199 @@ func NewSystemBackend(core *Core, config *logical.BackendConfig) (logical.Backen
 				HelpDescription: strings.TrimSpace(sysHelp["rotate"][1]),
 			},
 
+			&framework.Path{
+				Pattern: "metrics$",
+
+				Fields: map[string]*framework.FieldSchema{
+					"format": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: strings.TrimSpace(sysHelp["metrics-format"][0]),
+					},
+				},
+
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.ReadOperation: b.handleMetrics,
+				},
+
+				HelpSynopsis:    strings.TrimSpace(sysHelp["metrics"][0]),
+				HelpDescription: strings.TrimSpace(sysHelp["metrics"][1]),
+			},
+
+			&framework.Path{
+				Pattern: "quotas/rate-limit/?$",
+
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.ListOperation: b.handleRateLimitQuotasList,
+				},
+
+				HelpSynopsis:    strings.TrimSpace(sysHelp["rate-limit-quotas-list"][0]),
+				HelpDescription: strings.TrimSpace(sysHelp["rate-limit-quotas-list"][1]),
+			},
+
+			&framework.Path{
+				Pattern: "quotas/rate-limit/" + framework.GenericNameRegex("name"),
+
+				Fields: map[string]*framework.FieldSchema{
+					"name": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: strings.TrimSpace(sysHelp["rate-limit-quota-name"][0]),
+					},
+					"path": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: strings.TrimSpace(sysHelp["rate-limit-quota-path"][0]),
+					},
+					"role": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: strings.TrimSpace(sysHelp["rate-limit-quota-role"][0]),
+					},
+					"role_mount": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: strings.TrimSpace(sysHelp["rate-limit-quota-role-mount"][0]),
+					},
+					"rate": &framework.FieldSchema{
+						Type:        framework.TypeInt,
+						Description: strings.TrimSpace(sysHelp["rate-limit-quota-rate"][0]),
+					},
+					"interval": &framework.FieldSchema{
+						Type:        framework.TypeDurationSecond,
+						Default:     1,
+						Description: strings.TrimSpace(sysHelp["rate-limit-quota-interval"][0]),
+					},
+					"burst": &framework.FieldSchema{
+						Type:        framework.TypeInt,
+						Description: strings.TrimSpace(sysHelp["rate-limit-quota-burst"][0]),
+					},
+					"per_token": &framework.FieldSchema{
+						Type:        framework.TypeBool,
+						Description: strings.TrimSpace(sysHelp["rate-limit-quota-per-token"][0]),
+					},
+				},
+
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.ReadOperation:   b.handleRateLimitQuotaRead,
+					logical.UpdateOperation: b.handleRateLimitQuotaUpdate,
+					logical.DeleteOperation: b.handleRateLimitQuotaDelete,
+				},
+
+				HelpSynopsis:    strings.TrimSpace(sysHelp["rate-limit-quota"][0]),
+				HelpDescription: strings.TrimSpace(sysHelp["rate-limit-quota"][1]),
+			},
+
+			&framework.Path{
+				Pattern: "quotas/lease-count/?$",
+
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.ListOperation: b.handleLeaseCountQuotasList,
+				},
+
+				HelpSynopsis:    strings.TrimSpace(sysHelp["lease-count-quotas-list"][0]),
+				HelpDescription: strings.TrimSpace(sysHelp["lease-count-quotas-list"][1]),
+			},
+
+			&framework.Path{
+				Pattern: "quotas/lease-count/" + framework.GenericNameRegex("name"),
+
+				Fields: map[string]*framework.FieldSchema{
+					"name": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: strings.TrimSpace(sysHelp["lease-count-quota-name"][0]),
+					},
+					"path": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: strings.TrimSpace(sysHelp["lease-count-quota-path"][0]),
+					},
+					"max_leases": &framework.FieldSchema{
+						Type:        framework.TypeInt,
+						Description: strings.TrimSpace(sysHelp["lease-count-quota-max-leases"][0]),
+					},
+				},
+
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.ReadOperation:   b.handleLeaseCountQuotaRead,
+					logical.UpdateOperation: b.handleLeaseCountQuotaUpdate,
+					logical.DeleteOperation: b.handleLeaseCountQuotaDelete,
+				},
+
+				HelpSynopsis:    strings.TrimSpace(sysHelp["lease-count-quota"][0]),
+				HelpDescription: strings.TrimSpace(sysHelp["lease-count-quota"][1]),
+			},
+
+			&framework.Path{
+				Pattern: "replication/dr/primary/enable$",
+
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.UpdateOperation: b.handleDRPrimaryEnable,
+				},
+
+				HelpSynopsis:    strings.TrimSpace(sysHelp["replication-dr-primary-enable"][0]),
+				HelpDescription: strings.TrimSpace(sysHelp["replication-dr-primary-enable"][1]),
+			},
+
+			&framework.Path{
+				Pattern: "replication/dr/primary/secondary-token$",
+
+				Fields: map[string]*framework.FieldSchema{
+					"id": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: "Identifier of the secondary the token is issued to.",
+					},
+				},
+
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.UpdateOperation: b.handleDRPrimarySecondaryToken,
+				},
+
+				HelpSynopsis:    strings.TrimSpace(sysHelp["replication-dr-primary-secondary-token"][0]),
+				HelpDescription: strings.TrimSpace(sysHelp["replication-dr-primary-secondary-token"][1]),
+			},
+
+			&framework.Path{
+				Pattern: "replication/dr/primary/revoke-secondary$",
+
+				Fields: map[string]*framework.FieldSchema{
+					"id": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: "Identifier of the secondary to revoke.",
+					},
+				},
+
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.UpdateOperation: b.handleDRPrimaryRevokeSecondary,
+				},
+
+				HelpSynopsis:    strings.TrimSpace(sysHelp["replication-dr-primary-revoke-secondary"][0]),
+				HelpDescription: strings.TrimSpace(sysHelp["replication-dr-primary-revoke-secondary"][1]),
+			},
+
+			&framework.Path{
+				Pattern: "replication/dr/primary/reindex$",
+
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.UpdateOperation: b.handleDRPrimaryReindex,
+				},
+
+				HelpSynopsis:    strings.TrimSpace(sysHelp["replication-dr-primary-reindex"][0]),
+				HelpDescription: strings.TrimSpace(sysHelp["replication-dr-primary-reindex"][1]),
+			},
+
+			&framework.Path{
+				Pattern: "replication/dr/secondary/enable$",
+
+				Fields: map[string]*framework.FieldSchema{
+					"token": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: "Activation token issued by the primary.",
+					},
+				},
+
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.UpdateOperation: b.handleDRSecondaryEnable,
+				},
+
+				HelpSynopsis:    strings.TrimSpace(sysHelp["replication-dr-secondary-enable"][0]),
+				HelpDescription: strings.TrimSpace(sysHelp["replication-dr-secondary-enable"][1]),
+			},
+
 			&framework.Path{
 				Pattern: "wrapping/wrap$",
 
@@ -603,6 +980,43 @@ func NewSystemBackend(core *Core, config *logical.BackendConfig) (logical.Backen
 				HelpSynopsis:    strings.TrimSpace(sysHelp["rewrap"][0]),
 				HelpDescription: strings.TrimSpace(sysHelp["rewrap"][1]),
 			},
+
+			&framework.Path{
+				Pattern: "control-group/authorize$",
+
+				Fields: map[string]*framework.FieldSchema{
+					"accessor": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: strings.TrimSpace(sysHelp["control-group-accessor"][0]),
+					},
+				},
+
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.UpdateOperation: b.handleControlGroupAuthorize,
+				},
+
+				HelpSynopsis:    strings.TrimSpace(sysHelp["control-group-authorize"][0]),
+				HelpDescription: strings.TrimSpace(sysHelp["control-group-authorize"][1]),
+			},
+
+			&framework.Path{
+				Pattern: "control-group/request/?$",
+
+				Fields: map[string]*framework.FieldSchema{
+					"accessor": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: strings.TrimSpace(sysHelp["control-group-accessor"][0]),
+					},
+				},
+
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.ListOperation:   b.handleControlGroupRequestList,
+					logical.UpdateOperation: b.handleControlGroupRequestRead,
+				},
+
+				HelpSynopsis:    strings.TrimSpace(sysHelp["control-group-request"][0]),
+				HelpDescription: strings.TrimSpace(sysHelp["control-group-request"][1]),
+			},
 		},
 	}
 
@@ -623,7 +1037,7 @@ func (b *SystemBackend) handleCapabilities(req *logical.Request, d *framework.Fi
 	if token == "" {
 		token = req.ClientToken
 	}
-	capabilities, err := b.Core.Capabilities(token, d.Get("path").(string))
+	capabilities, err := b.Core.Capabilities(token, req.Namespace+d.Get("path").(string))
 	if err != nil {
 		return nil, err
 	}
@@ -647,8 +1061,11 @@ func (b *SystemBackend) handleCapabilitiesAccessor(req *logical.Request, d *fram
 	if err != nil {
 		return nil, err
 	}
+	if err := b.Core.tokenStore.checkTokenNamespace(req, aEntry.TokenID); err != nil {
+		return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+	}
 
-	capabilities, err := b.Core.Capabilities(aEntry.TokenID, d.Get("path").(string))
+	capabilities, err := b.Core.Capabilities(aEntry.TokenID, req.Namespace+d.Get("path").(string))
 	if err != nil {
 		return nil, err
 	}
@@ -739,14 +1156,24 @@ func (b *SystemBackend) handleRekeyDeleteRecovery(
 // handleMountTable handles the "mounts" endpoint to provide the mount table
 func (b *SystemBackend) handleMountTable(
 	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
-	b.Core.mountsLock.RLock()
-	defer b.Core.mountsLock.RUnlock()
+	nsID, err := b.requestNamespaceID(req)
+	if err != nil {
+		return handleError(err)
+	}
+
+	b.Core.mountsLock.RLock()
+	defer b.Core.mountsLock.RUnlock()
 
 	resp := &logical.Response{
 		Data: make(map[string]interface{}),
 	}
 
 	for _, entry := range b.Core.mounts.Entries {
+		// Only list the mounts of the namespace of the request
+		if entry.NamespaceID != nsID {
+			continue
+		}
+
 		info := map[string]interface{}{
 			"type":        entry.Type,
 			"description": entry.Description,
@@ -756,7 +1183,7 @@ func (b *SystemBackend) handleMountTable(
 			},
 		}
 
-		resp.Data[entry.Path] = info
+		resp.Data[strings.TrimPrefix(entry.Path, req.Namespace)] = info
 	}
 
 	return resp, nil
@@ -770,7 +1197,7 @@ func (b *SystemBackend) handleMount(
 	logicalType := data.Get("type").(string)
 	description := data.Get("description").(string)
 
-	path = sanitizeMountPath(path)
+	path = req.Namespace + sanitizeMountPath(path)
 
 	var config MountConfig
 
@@ -869,7 +1296,7 @@ func (b *SystemBackend) handleUnmount(
 		return logical.ErrorResponse("path cannot be blank"), logical.ErrInvalidRequest
 	}
 
-	suffix = sanitizeMountPath(suffix)
+	suffix = req.Namespace + sanitizeMountPath(suffix)
 
 	// Attempt unmount
 	if existed, err := b.Core.unmount(suffix); existed && err != nil {
@@ -892,8 +1319,8 @@ func (b *SystemBackend) handleRemount(
 			logical.ErrInvalidRequest
 	}
 
-	fromPath = sanitizeMountPath(fromPath)
-	toPath = sanitizeMountPath(toPath)
+	fromPath = req.Namespace + sanitizeMountPath(fromPath)
+	toPath = req.Namespace + sanitizeMountPath(toPath)
 
 	// Attempt remount
 	if err := b.Core.remount(fromPath, toPath); err != nil {
@@ -913,7 +1340,7 @@ func (b *SystemBackend) handleAuthTuneRead(
 				"path must be specified as a string"),
 			logical.ErrInvalidRequest
 	}
-	return b.handleTuneReadCommon("auth/" + path)
+	return b.handleTuneReadCommon(req.Namespace + "auth/" + path)
 }
 
 // handleMountTuneRead is used to get config settings on a backend
@@ -929,7 +1356,7 @@ func (b *SystemBackend) handleMountTuneRead(
 	// This call will read both logical backend's configuration as well as auth backends'.
 	// Retaining this behavior for backward compatibility. If this behavior is not desired,
 	// an error can be returned if path has a prefix of "auth/".
-	return b.handleTuneReadCommon(path)
+	return b.handleTuneReadCommon(req.Namespace + path)
 }
 
 // handleTuneReadCommon returns the config settings of a path
@@ -949,6 +1376,18 @@ func (b *SystemBackend) handleTuneReadCommon(path string) (*logical.Response, er
 		},
 	}
 
+	if mountEntry := b.Core.router.MatchingMountEntry(path); mountEntry != nil {
+		if len(mountEntry.Config.AuditNonHMACRequestKeys) > 0 {
+			resp.Data["audit_non_hmac_request_keys"] = mountEntry.Config.AuditNonHMACRequestKeys
+		}
+		if len(mountEntry.Config.AuditNonHMACResponseKeys) > 0 {
+			resp.Data["audit_non_hmac_response_keys"] = mountEntry.Config.AuditNonHMACResponseKeys
+		}
+		if mountEntry.Config.TokenType != "" {
+			resp.Data["token_type"] = mountEntry.Config.TokenType
+		}
+	}
+
 	return resp, nil
 }
 
@@ -960,7 +1399,7 @@ func (b *SystemBackend) handleAuthTuneWrite(
 		return logical.ErrorResponse("path must be specified as a string"),
 			logical.ErrInvalidRequest
 	}
-	return b.handleTuneWriteCommon("auth/"+path, data)
+	return b.handleTuneWriteCommon(req.Namespace+"auth/"+path, data)
 }
 
 // handleMountTuneWrite is used to set config settings on a backend
@@ -974,17 +1413,18 @@ func (b *SystemBackend) handleMountTuneWrite(
 	// This call will write both logical backend's configuration as well as auth backends'.
 	// Retaining this behavior for backward compatibility. If this behavior is not desired,
 	// an error can be returned if path has a prefix of "auth/".
-	return b.handleTuneWriteCommon(path, data)
+	return b.handleTuneWriteCommon(req.Namespace+path, data)
 }
 
 // handleTuneWriteCommon is used to set config settings on a path
 func (b *SystemBackend) handleTuneWriteCommon(
 	path string, data *framework.FieldData) (*logical.Response, error) {
 	path = sanitizeMountPath(path)
+	relativePath := b.Core.namespaceRelativePath(path)
 
 	// Prevent protected paths from being changed
 	for _, p := range untunableMounts {
-		if strings.HasPrefix(path, p) {
+		if strings.HasPrefix(relativePath, p) {
 			b.Backend.Logger().Error("sys: cannot tune this mount", "path", path)
 			return handleError(fmt.Errorf("sys: cannot tune '%s'", path))
 		}
@@ -998,11 +1438,12 @@ func (b *SystemBackend) handleTuneWriteCommon(
 
 	var lock *sync.RWMutex
 	switch {
-	case strings.HasPrefix(path, "auth/"):
+	case strings.HasPrefix(relativePath, "auth/"):
 		lock = &b.Core.authLock
 	default:
 		lock = &b.Core.mountsLock
 	}
+	var locked bool
 
 	// Timing configuration parameters
 	{
@@ -1038,6 +1479,7 @@ func (b *SystemBackend) handleTuneWriteCommon(
 		if newDefault != nil || newMax != nil {
 			lock.Lock()
 			defer lock.Unlock()
+			locked = true
 
 			if err := b.tuneMountTTLs(path, &mountEntry.Config, newDefault, newMax); err != nil {
 				b.Backend.Logger().Error("sys: tuning failed", "path", path, "error", err)
@@ -1046,6 +1488,56 @@ func (b *SystemBackend) handleTuneWriteCommon(
 		}
 	}
 
+	// Audit configuration parameters
+	{
+		var newRequestKeys, newResponseKeys *[]string
+		if raw, ok := data.GetOk("audit_non_hmac_request_keys"); ok {
+			keys := raw.([]string)
+			newRequestKeys = &keys
+		}
+		if raw, ok := data.GetOk("audit_non_hmac_response_keys"); ok {
+			keys := raw.([]string)
+			newResponseKeys = &keys
+		}
+
+		if newRequestKeys != nil || newResponseKeys != nil {
+			if !locked {
+				lock.Lock()
+				defer lock.Unlock()
+			}
+
+			if err := b.tuneMountAuditKeys(path, &mountEntry.Config, newRequestKeys, newResponseKeys); err != nil {
+				b.Backend.Logger().Error("sys: tuning failed", "path", path, "error", err)
+				return handleError(err)
+			}
+			locked = true
+		}
+	}
+
+	// Token type, which only applies to logins on auth mounts. The token
+	// store chooses the type per role or request instead.
+	if raw, ok := data.GetOk("token_type"); ok {
+		tokenType := raw.(string)
+		switch {
+		case !strings.HasPrefix(relativePath, credentialRoutePrefix) || relativePath == credentialRoutePrefix+"token/":
+			return logical.ErrorResponse("token_type can only be set on auth mounts other than the token store"),
+				logical.ErrInvalidRequest
+		case !validTokenType(tokenType):
+			return logical.ErrorResponse(fmt.Sprintf("invalid token type %q", tokenType)),
+				logical.ErrInvalidRequest
+		}
+
+		if !locked {
+			lock.Lock()
+			defer lock.Unlock()
+		}
+
+		if err := b.tuneMountTokenType(path, &mountEntry.Config, tokenType); err != nil {
+			b.Backend.Logger().Error("sys: tuning failed", "path", path, "error", err)
+			return handleError(err)
+		}
+	}
+
 	return nil, nil
 }
 
@@ -1062,6 +1554,10 @@ func (b *SystemBackend) handleRenew(
 	// Convert the increment
 	increment := time.Duration(incrementRaw) * time.Second
 
+	if !strings.HasPrefix(leaseID, req.Namespace) {
+		return nil, logical.ErrPermissionDenied
+	}
+
 	// Invoke the expiration manager directly
 	resp, err := b.Core.expiration.Renew(leaseID, increment)
 	if err != nil {
@@ -1071,11 +1567,149 @@ func (b *SystemBackend) handleRenew(
 	return resp, err
 }
 
+// handleLeaseLookup returns the timing details of a lease
+func (b *SystemBackend) handleLeaseLookup(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	leaseID := data.Get("lease_id").(string)
+	if leaseID == "" {
+		return logical.ErrorResponse("lease_id must be specified"), logical.ErrInvalidRequest
+	}
+
+	le, err := b.Core.expiration.FetchLeaseTimes(leaseID)
+	if err != nil {
+		b.Backend.Logger().Error("sys: error retrieving lease", "lease_id", leaseID, "error", err)
+		return handleError(err)
+	}
+	if le == nil {
+		return logical.ErrorResponse("invalid lease"), logical.ErrInvalidRequest
+	}
+
+	var renewable bool
+	switch {
+	case le.Secret != nil:
+		renewable = le.Secret.Renewable
+	case le.Auth != nil:
+		renewable = le.Auth.Renewable
+	}
+
+	resp := &logical.Response{
+		Data: map[string]interface{}{
+			"id":           leaseID,
+			"issue_time":   le.IssueTime,
+			"expire_time":  nil,
+			"last_renewal": nil,
+			"renewable":    renewable,
+			"ttl":          int64(0),
+		},
+	}
+	if !le.ExpireTime.IsZero() {
+		resp.Data["expire_time"] = le.ExpireTime
+		resp.Data["ttl"] = int64(le.ExpireTime.Sub(time.Now()).Seconds())
+	}
+	if !le.LastRenewalTime.IsZero() {
+		resp.Data["last_renewal"] = le.LastRenewalTime
+	}
+	return resp, nil
+}
+
+// handleLeaseLookupList lists the leases and lease prefixes under a prefix
+func (b *SystemBackend) handleLeaseLookupList(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	prefix := data.Get("prefix").(string)
+	if prefix != "" && !strings.HasSuffix(prefix, "/") {
+		prefix = prefix + "/"
+	}
+
+	keys, err := b.Core.expiration.ListLeases(prefix)
+	if err != nil {
+		b.Backend.Logger().Error("sys: error listing leases", "prefix", prefix, "error", err)
+		return handleError(err)
+	}
+	return logical.ListResponse(keys), nil
+}
+
+// handleLeaseTidy starts a tidy of the leases in the background
+func (b *SystemBackend) handleLeaseTidy(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	resp := &logical.Response{}
+	if !atomic.CompareAndSwapInt32(&b.Core.expiration.tidyInProgress, 0, 1) {
+		resp.AddWarning("Tidy operation already in progress.")
+		return resp, nil
+	}
+
+	expiration := b.Core.expiration
+	go func() {
+		defer atomic.StoreInt32(&expiration.tidyInProgress, 0)
+		if err := expiration.Tidy(); err != nil {
+			b.Backend.Logger().Error("sys: lease tidy failed", "error", err)
+		}
+	}()
+
+	resp.AddWarning("Tidy operation successfully started. Any information from the operation will be printed to Vault's server logs.")
+	return resp, nil
+}
+
+// handleLeaseRestoreStatus reports the progress of restoring the leases
+// after unsealing
+func (b *SystemBackend) handleLeaseRestoreStatus(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	inProgress, restored, total := b.Core.expiration.restoreStatus()
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"in_progress":     inProgress,
+			"restored_leases": restored,
+			"total_leases":    total,
+		},
+	}, nil
+}
+
+// handleLeaseIrrevocableList lists the leases that could not be revoked
+// when they expired, along with the last revocation error of each
+func (b *SystemBackend) handleLeaseIrrevocableList(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	leases, err := b.Core.expiration.ListIrrevocable()
+	if err != nil {
+		b.Backend.Logger().Error("sys: error listing irrevocable leases", "error", err)
+		return handleError(err)
+	}
+
+	keys := make([]string, 0, len(leases))
+	keyInfo := make(map[string]interface{}, len(leases))
+	for leaseID, revokeErr := range leases {
+		keys = append(keys, leaseID)
+		keyInfo[leaseID] = map[string]interface{}{
+			"error": revokeErr,
+		}
+	}
+	sort.Strings(keys)
+
+	resp := logical.ListResponse(keys)
+	if len(keys) > 0 {
+		resp.Data["key_info"] = keyInfo
+	}
+	return resp, nil
+}
+
+// handleLeaseIrrevocableDelete deletes an irrevocable lease
+func (b *SystemBackend) handleLeaseIrrevocableDelete(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	leaseID := data.Get("lease_id").(string)
+
+	if err := b.Core.expiration.RevokeIrrevocable(leaseID); err != nil {
+		b.Backend.Logger().Error("sys: error deleting irrevocable lease", "lease_id", leaseID, "error", err)
+		return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+	}
+	return nil, nil
+}
+
 // handleRevoke is used to revoke a given LeaseID
 func (b *SystemBackend) handleRevoke(
 	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
 	// Get all the options
 	leaseID := data.Get("lease_id").(string)
+	if !strings.HasPrefix(leaseID, req.Namespace) {
+		return nil, logical.ErrPermissionDenied
+	}
 
 	// Invoke the expiration manager directly
 	if err := b.Core.expiration.Revoke(leaseID); err != nil {
@@ -1101,7 +1735,7 @@ func (b *SystemBackend) handleRevokeForce(
 func (b *SystemBackend) handleRevokePrefixCommon(
 	req *logical.Request, data *framework.FieldData, force bool) (*logical.Response, error) {
 	// Get all the options
-	prefix := data.Get("prefix").(string)
+	prefix := req.Namespace + data.Get("prefix").(string)
 
 	// Invoke the expiration manager directly
 	var err error
@@ -1120,6 +1754,11 @@ func (b *SystemBackend) handleRevokePrefixCommon(
 // handleAuthTable handles the "auth" endpoint to provide the auth table
 func (b *SystemBackend) handleAuthTable(
 	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	nsID, err := b.requestNamespaceID(req)
+	if err != nil {
+		return handleError(err)
+	}
+
 	b.Core.authLock.RLock()
 	defer b.Core.authLock.RUnlock()
 
@@ -1127,6 +1766,11 @@ func (b *SystemBackend) handleAuthTable(
 		Data: make(map[string]interface{}),
 	}
 	for _, entry := range b.Core.auth.Entries {
+		// Only list the auth mounts of the namespace of the request
+		if entry.NamespaceID != nsID {
+			continue
+		}
+
 		info := map[string]interface{}{
 			"type":        entry.Type,
 			"description": entry.Description,
@@ -1135,7 +1779,7 @@ func (b *SystemBackend) handleAuthTable(
 				"max_lease_ttl":     int64(entry.Config.MaxLeaseTTL.Seconds()),
 			},
 		}
-		resp.Data[entry.Path] = info
+		resp.Data[strings.TrimPrefix(entry.Path, req.Namespace)] = info
 	}
 	return resp, nil
 }
@@ -1164,6 +1808,17 @@ func (b *SystemBackend) handleEnableAuth(
 		Description: description,
 	}
 
+	// Auth mounts within a namespace carry their full path
+	if req.Namespace != "" {
+		ns := b.Core.matchingNamespace(req.Namespace)
+		if ns == nil {
+			return handleError(fmt.Errorf("namespace %q not found", req.Namespace))
+		}
+		me.Path = ns.Path + path
+		me.NamespaceID = ns.ID
+		me.NamespacePath = ns.Path
+	}
+
 	// Attempt enabling
 	if err := b.Core.enableCredential(me); err != nil {
 		b.Backend.Logger().Error("sys: enable auth mount failed", "path", me.Path, "error", err)
@@ -1180,7 +1835,7 @@ func (b *SystemBackend) handleDisableAuth(
 		return logical.ErrorResponse("path cannot be blank"), logical.ErrInvalidRequest
 	}
 
-	suffix = sanitizeMountPath(suffix)
+	suffix = req.Namespace + sanitizeMountPath(suffix)
 
 	// Attempt disable
 	if existed, err := b.Core.disableCredential(suffix); existed && err != nil {
@@ -1193,11 +1848,18 @@ func (b *SystemBackend) handleDisableAuth(
 // handlePolicyList handles the "policy" endpoint to provide the enabled policies
 func (b *SystemBackend) handlePolicyList(
 	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	ps, err := b.requestPolicyStore(req)
+	if err != nil {
+		return handleError(err)
+	}
+
 	// Get all the configured policies
-	policies, err := b.Core.policyStore.ListPolicies()
+	policies, err := ps.ListPolicies()
 
-	// Add the special "root" policy
-	policies = append(policies, "root")
+	// Add the special "root" policy, which only exists in the root namespace
+	if req.Namespace == "" {
+		policies = append(policies, "root")
+	}
 	resp := logical.ListResponse(policies)
 
 	// Backwords compatibility
@@ -1211,7 +1873,12 @@ func (b *SystemBackend) handlePolicyRead(
 	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
 	name := data.Get("name").(string)
 
-	policy, err := b.Core.policyStore.GetPolicy(name)
+	ps, err := b.requestPolicyStore(req)
+	if err != nil {
+		return handleError(err)
+	}
+
+	policy, err := ps.GetPolicy(name)
 	if err != nil {
 		return handleError(err)
 	}
@@ -1243,8 +1910,13 @@ func (b *SystemBackend) handlePolicySet(
 	// Override the name
 	parse.Name = strings.ToLower(name)
 
+	ps, err := b.requestPolicyStore(req)
+	if err != nil {
+		return handleError(err)
+	}
+
 	// Update the policy
-	if err := b.Core.policyStore.SetPolicy(parse); err != nil {
+	if err := ps.SetPolicy(parse); err != nil {
 		return handleError(err)
 	}
 	return nil, nil
@@ -1255,7 +1927,97 @@ func (b *SystemBackend) handlePolicyDelete(
 	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
 	name := data.Get("name").(string)
 
-	if err := b.Core.policyStore.DeletePolicy(name); err != nil {
+	ps, err := b.requestPolicyStore(req)
+	if err != nil {
+		return handleError(err)
+	}
+
+	if err := ps.DeletePolicy(name); err != nil {
+		return handleError(err)
+	}
+	return nil, nil
+}
+
+// requestNamespaceID returns the ID of the namespace of a request; the root
+// namespace has an empty ID
+func (b *SystemBackend) requestNamespaceID(req *logical.Request) (string, error) {
+	if req.Namespace == "" {
+		return "", nil
+	}
+	ns := b.Core.matchingNamespace(req.Namespace)
+	if ns == nil || ns.Path != req.Namespace {
+		return "", fmt.Errorf("namespace %q not found", req.Namespace)
+	}
+	return ns.ID, nil
+}
+
+// requestPolicyStore returns the policy store of the namespace of a request
+func (b *SystemBackend) requestPolicyStore(req *logical.Request) (*PolicyStore, error) {
+	nsID, err := b.requestNamespaceID(req)
+	if err != nil {
+		return nil, err
+	}
+	ps := b.Core.namespacePolicyStore(nsID)
+	if ps == nil {
+		return nil, fmt.Errorf("namespace %q not found", req.Namespace)
+	}
+	return ps, nil
+}
+
+// handleNamespacesList handles the "namespaces" endpoint to list the
+// namespaces directly below the namespace of the request
+func (b *SystemBackend) handleNamespacesList(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	return logical.ListResponse(b.Core.listNamespaces(req.Namespace)), nil
+}
+
+// handleNamespaceRead handles the "namespaces/<path>" endpoint to read a
+// namespace
+func (b *SystemBackend) handleNamespaceRead(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	path := req.Namespace + sanitizeMountPath(data.Get("path").(string))
+
+	ns := b.Core.matchingNamespace(path)
+	if ns == nil || ns.Path != path {
+		return nil, nil
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"id":   ns.ID,
+			"path": strings.TrimPrefix(ns.Path, req.Namespace),
+		},
+	}, nil
+}
+
+// handleNamespaceCreate handles the "namespaces/<path>" endpoint to create a
+// namespace
+func (b *SystemBackend) handleNamespaceCreate(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	path := req.Namespace + sanitizeMountPath(data.Get("path").(string))
+
+	ns, err := b.Core.createNamespace(path)
+	if err != nil {
+		b.Backend.Logger().Error("sys: namespace creation failed", "path", path, "error", err)
+		return handleError(err)
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"id":   ns.ID,
+			"path": strings.TrimPrefix(ns.Path, req.Namespace),
+		},
+	}, nil
+}
+
+// handleNamespaceDelete handles the "namespaces/<path>" endpoint to delete a
+// namespace
+func (b *SystemBackend) handleNamespaceDelete(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	path := req.Namespace + sanitizeMountPath(data.Get("path").(string))
+
+	if existed, err := b.Core.deleteNamespace(path); existed && err != nil {
+		b.Backend.Logger().Error("sys: namespace deletion failed", "path", path, "error", err)
 		return handleError(err)
 	}
 	return nil, nil
@@ -1277,6 +2039,14 @@ func (b *SystemBackend) handleAuditTable(
 			"description": entry.Description,
 			"options":     entry.Options,
 		}
+		if entry.Filter != "" {
+			info["filter"] = entry.Filter
+		}
+		if b.Core.auditBroker != nil {
+			if status := b.Core.auditBroker.GetStatus(entry.Path); status != nil {
+				info["status"] = status
+			}
+		}
 		resp.Data[entry.Path] = info
 	}
 	return resp, nil
@@ -1306,6 +2076,24 @@ func (b *SystemBackend) handleAuditHash(
 	}, nil
 }
 
+// handleAuditHashChainKey is used to fetch the key that the specified audit
+// backend uses to chain its entries, so that its log can be verified
+func (b *SystemBackend) handleAuditHashChainKey(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	path := sanitizeMountPath(data.Get("path").(string))
+
+	key, err := b.Core.auditBroker.GetHashChainKey(path)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"key": key,
+		},
+	}, nil
+}
+
 // handleEnableAudit is used to enable a new audit backend
 func (b *SystemBackend) handleEnableAudit(
 	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
@@ -1314,6 +2102,7 @@ func (b *SystemBackend) handleEnableAudit(
 	backendType := data.Get("type").(string)
 	description := data.Get("description").(string)
 	options := data.Get("options").(map[string]interface{})
+	filter := data.Get("filter").(string)
 
 	optionMap := make(map[string]string)
 	for k, v := range options {
@@ -1332,6 +2121,7 @@ func (b *SystemBackend) handleEnableAudit(
 		Type:        backendType,
 		Description: description,
 		Options:     optionMap,
+		Filter:      filter,
 	}
 
 	// Attempt enabling
@@ -1472,66 +2262,338 @@ func (b *SystemBackend) handleRotate(
 	return nil, nil
 }
 
-func (b *SystemBackend) handleWrappingWrap(
+// handleMetrics returns the metrics kept in memory by this node in the
+// requested format
+func (b *SystemBackend) handleMetrics(
 	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
-	if req.WrapTTL == 0 {
-		return logical.ErrorResponse("endpoint requires response wrapping to be used"), logical.ErrInvalidRequest
+	resp, err := b.Core.metricsHelper.ResponseForFormat(data.Get("format").(string))
+	if err != nil {
+		return nil, err
+	}
+	if resp.IsError() {
+		return resp, logical.ErrInvalidRequest
+	}
+	return resp, nil
+}
+
+// handleRateLimitQuotasList lists the rate limit quotas
+func (b *SystemBackend) handleRateLimitQuotasList(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	names, err := b.Core.rateLimitQuotas.list()
+	if err != nil {
+		return handleError(err)
+	}
+	return logical.ListResponse(names), nil
+}
+
+// handleRateLimitQuotaRead returns the configuration of a rate limit quota
+func (b *SystemBackend) handleRateLimitQuotaRead(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	quota := b.Core.rateLimitQuotas.get(data.Get("name").(string))
+	if quota == nil {
+		return nil, nil
 	}
 
 	return &logical.Response{
-		Data: data.Raw,
+		Data: map[string]interface{}{
+			"name":       quota.Name,
+			"path":       quota.Path,
+			"role":       quota.Role,
+			"role_mount": quota.RoleMount,
+			"rate":       quota.Rate,
+			"interval":   int64(quota.Interval.Seconds()),
+			"burst":      quota.Burst,
+			"per_token":  quota.PerToken,
+		},
 	}, nil
 }
 
-func (b *SystemBackend) handleWrappingUnwrap(
+// handleRateLimitQuotaUpdate creates or updates a rate limit quota. Fields
+// that are not given keep their current value when updating.
+func (b *SystemBackend) handleRateLimitQuotaUpdate(
 	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
-	// If a third party is unwrapping (rather than the calling token being the
-	// wrapping token) we detect this so that we can revoke the original
-	// wrapping token after reading it
-	var thirdParty bool
-
-	token := data.Get("token").(string)
-	if token != "" {
-		thirdParty = true
-	} else {
-		token = req.ClientToken
-	}
+	name := data.Get("name").(string)
 
-	if thirdParty {
-		// Use the token to decrement the use count to avoid a second operation on the token.
-		_, err := b.Core.tokenStore.UseTokenByID(token)
-		if err != nil {
-			return nil, fmt.Errorf("error decrementing wrapping token's use-count: %v", err)
+	quota := &rateLimitQuota{
+		Name:     name,
+		Interval: time.Duration(data.Get("interval").(int)) * time.Second,
+	}
+	if existing := b.Core.rateLimitQuotas.get(name); existing != nil {
+		quota.Path = existing.Path
+		quota.Role = existing.Role
+		quota.RoleMount = existing.RoleMount
+		quota.RoleMountUUID = existing.RoleMountUUID
+		quota.Rate = existing.Rate
+		quota.Interval = existing.Interval
+		quota.Burst = existing.Burst
+		quota.PerToken = existing.PerToken
+	}
+
+	if raw, ok := data.GetOk("path"); ok {
+		quota.Path = strings.TrimPrefix(raw.(string), "/")
+		if quota.Path != "" && !strings.HasSuffix(quota.Path, "/") {
+			quota.Path += "/"
 		}
-
-		defer b.Core.tokenStore.Revoke(token)
 	}
-
-	cubbyReq := &logical.Request{
-		Operation:   logical.ReadOperation,
-		Path:        "cubbyhole/response",
-		ClientToken: token,
+	if raw, ok := data.GetOk("role"); ok {
+		quota.Role = raw.(string)
 	}
-	cubbyResp, err := b.Core.router.Route(cubbyReq)
-	if err != nil {
-		return nil, fmt.Errorf("error looking up wrapping information: %v", err)
+	if raw, ok := data.GetOk("role_mount"); ok {
+		quota.RoleMount = strings.Trim(raw.(string), "/") + "/"
+		quota.RoleMountUUID = ""
 	}
-	if cubbyResp == nil {
-		return logical.ErrorResponse("no information found; wrapping token may be from a previous Vault version"), nil
+	if raw, ok := data.GetOk("rate"); ok {
+		quota.Rate = raw.(int)
 	}
-	if cubbyResp != nil && cubbyResp.IsError() {
-		return cubbyResp, nil
+	if raw, ok := data.GetOk("interval"); ok {
+		quota.Interval = time.Duration(raw.(int)) * time.Second
 	}
-	if cubbyResp.Data == nil {
-		return logical.ErrorResponse("wrapping information was nil; wrapping token may be from a previous Vault version"), nil
+	if raw, ok := data.GetOk("burst"); ok {
+		quota.Burst = raw.(int)
+	}
+	if raw, ok := data.GetOk("per_token"); ok {
+		quota.PerToken = raw.(bool)
 	}
 
-	responseRaw := cubbyResp.Data["response"]
-	if responseRaw == nil {
-		return nil, fmt.Errorf("no response found inside the cubbyhole")
+	switch {
+	case quota.Rate <= 0:
+		return logical.ErrorResponse("rate must be positive"), logical.ErrInvalidRequest
+	case quota.Interval <= 0:
+		return logical.ErrorResponse("interval must be positive"), logical.ErrInvalidRequest
+	case quota.Burst < 0:
+		return logical.ErrorResponse("burst cannot be negative"), logical.ErrInvalidRequest
 	}
-	response, ok := responseRaw.(string)
-	if !ok {
+
+	// Roles are identified by the mount of their auth backend, which has to
+	// exist when the quota is set
+	switch {
+	case quota.Role == "":
+		quota.RoleMount = ""
+		quota.RoleMountUUID = ""
+	case quota.RoleMount == "" || quota.RoleMount == "/":
+		return logical.ErrorResponse("role_mount is required with role"), logical.ErrInvalidRequest
+	case quota.RoleMountUUID == "":
+		entry := b.Core.router.MatchingMountEntry(quota.RoleMount)
+		if entry == nil || entry.Table != credentialTableType || b.Core.router.MatchingMount(quota.RoleMount) != quota.RoleMount {
+			return logical.ErrorResponse(fmt.Sprintf("no auth backend mounted at %q", quota.RoleMount)), logical.ErrInvalidRequest
+		}
+		quota.RoleMountUUID = entry.UUID
+	}
+
+	if err := b.Core.rateLimitQuotas.set(quota); err != nil {
+		return handleError(err)
+	}
+	return nil, nil
+}
+
+// handleRateLimitQuotaDelete removes a rate limit quota
+func (b *SystemBackend) handleRateLimitQuotaDelete(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	if err := b.Core.rateLimitQuotas.delete(data.Get("name").(string)); err != nil {
+		return handleError(err)
+	}
+	return nil, nil
+}
+
+// handleLeaseCountQuotasList lists the lease count quotas
+func (b *SystemBackend) handleLeaseCountQuotasList(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	names, err := b.Core.leaseCountQuotas.list()
+	if err != nil {
+		return handleError(err)
+	}
+	return logical.ListResponse(names), nil
+}
+
+// handleLeaseCountQuotaRead returns the configuration of a lease count quota
+// along with the number of leases it currently counts
+func (b *SystemBackend) handleLeaseCountQuotaRead(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	quota := b.Core.leaseCountQuotas.get(data.Get("name").(string))
+	if quota == nil {
+		return nil, nil
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"name":       quota.Name,
+			"path":       quota.Path,
+			"max_leases": quota.MaxLeases,
+			"count":      quota.count,
+		},
+	}, nil
+}
+
+// handleLeaseCountQuotaUpdate creates or updates a lease count quota. Fields
+// that are not given keep their current value when updating.
+func (b *SystemBackend) handleLeaseCountQuotaUpdate(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	name := data.Get("name").(string)
+
+	quota := &leaseCountQuota{
+		Name: name,
+	}
+	if existing := b.Core.leaseCountQuotas.get(name); existing != nil {
+		quota.Path = existing.Path
+		quota.MaxLeases = existing.MaxLeases
+	}
+
+	if raw, ok := data.GetOk("path"); ok {
+		quota.Path = strings.TrimPrefix(raw.(string), "/")
+		if quota.Path != "" && !strings.HasSuffix(quota.Path, "/") {
+			quota.Path += "/"
+		}
+	}
+	if raw, ok := data.GetOk("max_leases"); ok {
+		quota.MaxLeases = raw.(int)
+	}
+
+	if quota.MaxLeases <= 0 {
+		return logical.ErrorResponse("max_leases must be positive"), logical.ErrInvalidRequest
+	}
+
+	if err := b.Core.leaseCountQuotas.set(quota); err != nil {
+		return handleError(err)
+	}
+	return nil, nil
+}
+
+// handleLeaseCountQuotaDelete removes a lease count quota
+func (b *SystemBackend) handleLeaseCountQuotaDelete(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	if err := b.Core.leaseCountQuotas.delete(data.Get("name").(string)); err != nil {
+		return handleError(err)
+	}
+	return nil, nil
+}
+
+// handleDRPrimaryEnable makes this cluster a DR primary
+func (b *SystemBackend) handleDRPrimaryEnable(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	if err := b.Core.enableDRPrimary(); err != nil {
+		return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+	}
+	return nil, nil
+}
+
+// handleDRPrimarySecondaryToken issues an activation token for a new
+// secondary
+func (b *SystemBackend) handleDRPrimarySecondaryToken(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	token, err := b.Core.issueDRSecondaryToken(data.Get("id").(string))
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+	}
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"token": token,
+		},
+	}, nil
+}
+
+// handleDRPrimaryRevokeSecondary disconnects a secondary and prevents it
+// from connecting again
+func (b *SystemBackend) handleDRPrimaryRevokeSecondary(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	id := data.Get("id").(string)
+	if id == "" {
+		return logical.ErrorResponse("missing secondary id"), logical.ErrInvalidRequest
+	}
+	if err := b.Core.revokeDRSecondary(id); err != nil {
+		return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+	}
+	return nil, nil
+}
+
+// handleDRPrimaryReindex makes all secondaries fetch a fresh snapshot
+func (b *SystemBackend) handleDRPrimaryReindex(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	if err := b.Core.reindexDRPrimary(); err != nil {
+		return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+	}
+	return nil, nil
+}
+
+// handleDRSecondaryEnable makes this cluster a DR secondary
+func (b *SystemBackend) handleDRSecondaryEnable(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	token := data.Get("token").(string)
+	if token == "" {
+		return logical.ErrorResponse("missing activation token"), logical.ErrInvalidRequest
+	}
+	if err := b.Core.enableDRSecondary(token); err != nil {
+		return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+	}
+	b.Backend.Logger().Warn("sys: enabled DR secondary; this node will seal and replace its data with the primary's")
+	return nil, nil
+}
+
+func (b *SystemBackend) handleWrappingWrap(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	if req.WrapTTL == 0 {
+		return logical.ErrorResponse("endpoint requires response wrapping to be used"), logical.ErrInvalidRequest
+	}
+
+	return &logical.Response{
+		Data: data.Raw,
+	}, nil
+}
+
+func (b *SystemBackend) handleWrappingUnwrap(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	// If a third party is unwrapping (rather than the calling token being the
+	// wrapping token) we detect this so that we can revoke the original
+	// wrapping token after reading it
+	var thirdParty bool
+
+	token := data.Get("token").(string)
+	if token != "" {
+		thirdParty = true
+	} else {
+		token = req.ClientToken
+	}
+
+	if thirdParty {
+		// The token must not be used up before its control group request,
+		// if any, has been authorized
+		if err := b.checkControlGroupToken(token); err != nil {
+			return logical.ErrorResponse(err.Error()), err
+		}
+
+		// Use the token to decrement the use count to avoid a second operation on the token.
+		_, err := b.Core.tokenStore.UseTokenByID(token)
+		if err != nil {
+			return nil, fmt.Errorf("error decrementing wrapping token's use-count: %v", err)
+		}
+
+		defer b.Core.tokenStore.Revoke(token)
+	}
+
+	cubbyReq := &logical.Request{
+		Operation:   logical.ReadOperation,
+		Path:        "cubbyhole/response",
+		ClientToken: token,
+	}
+	cubbyResp, err := b.Core.router.Route(cubbyReq)
+	if err != nil {
+		return nil, fmt.Errorf("error looking up wrapping information: %v", err)
+	}
+	if cubbyResp == nil {
+		return logical.ErrorResponse("no information found; wrapping token may be from a previous Vault version"), nil
+	}
+	if cubbyResp != nil && cubbyResp.IsError() {
+		return cubbyResp, nil
+	}
+	if cubbyResp.Data == nil {
+		return logical.ErrorResponse("wrapping information was nil; wrapping token may be from a previous Vault version"), nil
+	}
+
+	responseRaw := cubbyResp.Data["response"]
+	if responseRaw == nil {
+		return nil, fmt.Errorf("no response found inside the cubbyhole")
+	}
+	response, ok := responseRaw.(string)
+	if !ok {
 		return nil, fmt.Errorf("could not decode response inside the cubbyhole")
 	}
 
@@ -1614,6 +2676,12 @@ func (b *SystemBackend) handleWrappingRewrap(
 	}
 
 	if thirdParty {
+		// Rewrapping would drop the control group request, if any, so it
+		// has to be authorized first
+		if err := b.checkControlGroupToken(token); err != nil {
+			return logical.ErrorResponse(err.Error()), err
+		}
+
 		// Use the token to decrement the use count to avoid a second operation on the token.
 		_, err := b.Core.tokenStore.UseTokenByID(token)
 		if err != nil {
@@ -1701,6 +2769,116 @@ func sanitizeMountPath(path string) string {
 	return path
 }
 
+// checkControlGroupToken returns an error if the given wrapping token belongs
+// to a control group request that has not been authorized yet
+func (b *SystemBackend) checkControlGroupToken(token string) error {
+	te, err := b.Core.tokenStore.Lookup(token)
+	if err != nil {
+		return err
+	}
+	return b.Core.checkControlGroupAuthorization(te)
+}
+
+// controlGroupResponse returns the status of a control group request
+func controlGroupResponse(r *controlGroupRequest) *logical.Response {
+	factors := make([]map[string]interface{}, 0, len(r.Factors))
+	for _, f := range r.Factors {
+		factors = append(factors, map[string]interface{}{
+			"name":           f.Name,
+			"policies":       f.Policies,
+			"approvals":      f.Approvals,
+			"authorizations": r.approvals(f.Name),
+		})
+	}
+
+	authorizations := make([]map[string]interface{}, 0, len(r.Authorizations))
+	for _, a := range r.Authorizations {
+		authorizations = append(authorizations, map[string]interface{}{
+			"accessor":     a.Accessor,
+			"display_name": a.DisplayName,
+			"factors":      a.Factors,
+			"time":         a.Time,
+		})
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"accessor":               r.Accessor,
+			"request_path":           r.Path,
+			"request_operation":      r.Operation,
+			"request_time":           r.RequestTime,
+			"requester_accessor":     r.RequesterAccessor,
+			"requester_display_name": r.RequesterDisplayName,
+			"approved":               r.approved(),
+			"factors":                factors,
+			"authorizations":         authorizations,
+		},
+	}
+}
+
+// handleControlGroupAuthorize handles the "control-group/authorize" endpoint
+// to authorize a control group request with the calling token
+func (b *SystemBackend) handleControlGroupAuthorize(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	accessor := data.Get("accessor").(string)
+	if accessor == "" {
+		return logical.ErrorResponse("missing accessor"), logical.ErrInvalidRequest
+	}
+
+	te, err := b.Core.tokenStore.Lookup(req.ClientToken)
+	if err != nil {
+		return nil, err
+	}
+	if te == nil {
+		return nil, logical.ErrPermissionDenied
+	}
+
+	r, err := b.Core.authorizeControlGroupRequest(accessor, te)
+	switch err.(type) {
+	case nil:
+	case *StatusBadRequest:
+		return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+	default:
+		return nil, err
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"approved": r.approved(),
+		},
+	}, nil
+}
+
+// handleControlGroupRequestList handles the "control-group/request" endpoint
+// to list the accessors of the pending control group requests
+func (b *SystemBackend) handleControlGroupRequestList(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	accessors, err := b.Core.listControlGroupRequests()
+	if err != nil {
+		return nil, err
+	}
+	return logical.ListResponse(accessors), nil
+}
+
+// handleControlGroupRequestRead handles the "control-group/request" endpoint
+// to read the status of a control group request
+func (b *SystemBackend) handleControlGroupRequestRead(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	accessor := data.Get("accessor").(string)
+	if accessor == "" {
+		return logical.ErrorResponse("missing accessor"), logical.ErrInvalidRequest
+	}
+
+	r, err := b.Core.controlGroupRequest(accessor)
+	if err != nil {
+		return nil, err
+	}
+	if r == nil {
+		return logical.ErrorResponse("no control group request found for accessor"), logical.ErrInvalidRequest
+	}
+	return controlGroupResponse(r), nil
+}
+
 const sysHelpRoot = `
 The system backend is built-in to Vault and cannot be remounted or
 unmounted. It contains the paths that are used to configure Vault itself
@@ -1830,6 +3008,21 @@ and max_lease_ttl.`,
 		`The max lease TTL for this mount.`,
 	},
 
+	"tune_audit_non_hmac_request_keys": {
+		`The list of keys in the request data that audit backends will log
+without hashing their values.`,
+	},
+
+	"tune_audit_non_hmac_response_keys": {
+		`The list of keys in the response data that audit backends will log
+without hashing their values.`,
+	},
+
+	"tune_token_type": {
+		`The type of token issued by logins to this auth mount, either "service"
+or "batch".`,
+	},
+
 	"remount": {
 		"Move the mount point of an already-mounted backend.",
 		`
@@ -1862,6 +3055,75 @@ lease and to prevent an automatic revocation.
 		`,
 	},
 
+	"leases-lookup": {
+		"View or list lease metadata.",
+		`
+This endpoint returns the issue time, expiration time, time of the last
+renewal and whether it can be renewed for the lease with the given ID.
+		`,
+	},
+
+	"leases-list": {
+		"List leases by prefix.",
+		`
+This endpoint lists the leases stored under the given prefix. Lease IDs
+begin with the path of the request that created them, so entries ending in
+a slash are further prefixes that can themselves be listed. This requires
+sudo capability.
+		`,
+	},
+
+	"leases-tidy": {
+		"Clean up leases left behind by revoked tokens.",
+		`
+This endpoint revokes the leases whose token no longer exists and repairs
+the index from tokens to their leases, such as after a revocation was
+interrupted. The operation runs in the background and logs its progress.
+This requires sudo capability.
+		`,
+	},
+
+	"leases-restore-status": {
+		"Report the progress of restoring leases after unsealing.",
+		`
+After unsealing, the leases are restored in the background while requests
+are already being served; a lease that has not been restored yet is loaded
+when it is used. This endpoint returns whether the restore is still in
+progress, along with the number of leases restored so far and the total.
+		`,
+	},
+
+	"leases-irrevocable-list": {
+		"List the leases that could not be revoked.",
+		`
+When revoking an expired lease fails, such as because the server behind the
+backend is down, the revocation is retried with an exponential backoff. Once
+the maximum number of attempts is reached the lease is marked irrevocable
+and is no longer retried. This endpoint lists the irrevocable leases along
+with the last revocation error of each. This requires sudo capability.
+		`,
+	},
+
+	"leases-irrevocable": {
+		"Delete an irrevocable lease.",
+		`
+This endpoint deletes a lease that was marked irrevocable. The backend is
+asked to revoke the lease once more, but the lease is deleted even if that
+fails, so any credentials it represents must be cleaned up by other means.
+This requires sudo capability.
+		`,
+	},
+
+	"leases-irrevocable-lease-id": {
+		"The ID of the irrevocable lease to delete.",
+		"",
+	},
+
+	"leases-list-prefix": {
+		"The lease ID prefix to list, such as a mount path.",
+		"",
+	},
+
 	"lease_id": {
 		"The lease identifier to renew. This is included with a lease.",
 		"",
@@ -1985,6 +3247,29 @@ or delete a policy.
 		`,
 	},
 
+	"namespaces": {
+		`List the namespaces.`,
+		`
+List the namespaces directly below the namespace of the request. Nested
+namespaces are listed from within their parent namespace.
+		`,
+	},
+
+	"namespace": {
+		`Read, create or delete a namespace.`,
+		`
+Namespaces isolate the mounts, auth mounts, policies and tokens of a tenant.
+A namespace is addressed by prefixing request paths with its path, or by
+setting the X-Vault-Namespace header. A namespace can only be deleted once
+it holds no mounts, auth mounts or nested namespaces.
+		`,
+	},
+
+	"namespace-path": {
+		`The path of the namespace, relative to the namespace of the request. Example: "team1"`,
+		"",
+	},
+
 	"policy-name": {
 		`The name of the policy. Example: "ops"`,
 		"",
@@ -2000,6 +3285,16 @@ or delete a policy.
 		"",
 	},
 
+	"audit-hash-chain-key": {
+		"The key used to chain the entries of the given audit backend",
+		`
+This returns the key that a hash chained audit backend uses to compute the
+HMAC of each entry it writes, for use with "vault audit-verify". It is
+derived from the salt of the audit backend, but cannot be used to recover the
+values hashed in the audit log.
+		`,
+	},
+
 	"audit-table": {
 		"List the currently enabled audit backends.",
 		`
@@ -2036,6 +3331,11 @@ This path responds to the following HTTP methods.
 		"",
 	},
 
+	"audit_filter": {
+		`An expression selecting the requests sent to the audit backend.`,
+		"",
+	},
+
 	"audit": {
 		`Enable or disable audit backends.`,
 		`
@@ -2059,6 +3359,154 @@ Enable a new audit backend or disable an existing backend.
 		`,
 	},
 
+	"metrics": {
+		"Returns the metrics of this node.",
+		`
+		Returns the metrics kept in memory by the node serving the request.
+		The JSON format summarizes the most recent aggregation interval. The
+		Prometheus format is available when prometheus_retention_time is set
+		in the telemetry configuration, and can be scraped directly.
+		`,
+	},
+
+	"rate-limit-quotas-list": {
+		"Lists the rate limit quotas.",
+		"",
+	},
+
+	"rate-limit-quota": {
+		"Configures a rate limit quota.",
+		`
+		A rate limit quota limits the rate of requests using a token bucket
+		that holds up to "burst" requests and is refilled with "rate" requests
+		every "interval". A quota applies to the requests under its path, or to
+		every request if no path is set, and if a role is set only to requests
+		made with tokens issued for that role. Requests over the limit are
+		rejected with a 429 status code and a Retry-After header. The state of
+		the buckets is kept by each node separately.
+		`,
+	},
+
+	"rate-limit-quota-name": {
+		"The name of the quota.",
+		"",
+	},
+
+	"rate-limit-quota-path": {
+		`The path prefix the quota applies to, such as a mount path like "pki/". If not set, the quota applies to all requests.`,
+		"",
+	},
+
+	"rate-limit-quota-role": {
+		"If set, the quota only applies to requests made with tokens issued for this token role or auth backend role.",
+		"",
+	},
+
+	"rate-limit-quota-role-mount": {
+		`The path of the auth backend the role belongs to, such as "auth/approle/" or "auth/token/". Required with role.`,
+		"",
+	},
+
+	"rate-limit-quota-rate": {
+		"The number of requests allowed each interval.",
+		"",
+	},
+
+	"rate-limit-quota-interval": {
+		"The interval, in seconds, over which rate requests are allowed. Defaults to one second.",
+		"",
+	},
+
+	"rate-limit-quota-burst": {
+		"The number of requests that can be made at once before being limited. Defaults to the rate.",
+		"",
+	},
+
+	"rate-limit-quota-per-token": {
+		"If true, each client token has its own bucket, rather than all requests sharing one.",
+		"",
+	},
+
+	"lease-count-quotas-list": {
+		"Lists the lease count quotas.",
+		"",
+	},
+
+	"lease-count-quota": {
+		"Configures a lease count quota.",
+		`
+		A lease count quota limits the number of leases, including token
+		leases, that can exist under a path such as a mount. Once the limit is
+		reached, requests that would create a new lease under the path are
+		rejected with a 429 status code, and the secret or token they created
+		is revoked. Reading a quota also returns the number of leases it
+		currently counts.
+		`,
+	},
+
+	"lease-count-quota-name": {
+		"The name of the quota.",
+		"",
+	},
+
+	"lease-count-quota-path": {
+		`The path the quota applies to, such as a mount path like "database/". If not set, the quota applies to all leases.`,
+		"",
+	},
+
+	"lease-count-quota-max-leases": {
+		"The maximum number of leases that can exist under the path.",
+		"",
+	},
+
+	"metrics-format": {
+		`The format to return metrics in, either "json" (the default) or "prometheus".`,
+		"",
+	},
+
+	"replication-dr-primary-enable": {
+		"Enables DR replication with this cluster as the primary.",
+		`
+		Generates the CA used to authenticate DR secondaries and starts
+		recording writes so that they can be streamed to secondaries over the
+		cluster port. Requires an HA storage backend and a cluster address.
+		`,
+	},
+
+	"replication-dr-primary-secondary-token": {
+		"Issues an activation token for a DR secondary.",
+		`
+		The token contains the address of this node's cluster port and a
+		client certificate identifying the secondary. It is passed to
+		sys/replication/dr/secondary/enable on the secondary, and is needed
+		again to promote or reindex the secondary.
+		`,
+	},
+
+	"replication-dr-primary-revoke-secondary": {
+		"Revokes a DR secondary.",
+		`
+		Disconnects the secondary with the given identifier and prevents it
+		from connecting again.
+		`,
+	},
+
+	"replication-dr-primary-reindex": {
+		"Makes all DR secondaries fetch a fresh snapshot.",
+		"",
+	},
+
+	"replication-dr-secondary-enable": {
+		"Makes this cluster a DR secondary.",
+		`
+		All data in this cluster is replaced by the data of the primary that
+		issued the activation token. The node seals itself and stays sealed,
+		continuously receiving the primary's writes, until it is promoted via
+		sys/replication/dr/secondary/promote. After promotion it is unsealed
+		with the primary's unseal keys.
+		`,
+	},
+
 	"rekey_backup": {
 		"Allows fetching or deleting the backup of the rotated unseal keys.",
 		"",
@@ -2104,4 +3552,28 @@ Enable a new audit backend or disable an existing backend.
 		`Rotates a response-wrapped token; the output is a new token with the same
 		response wrapped inside and the same creation TTL. The original token is revoked.`,
 	},
+
+	"control-group-authorize": {
+		"Authorizes a control group request.",
+		`
+Authorizes the control group request wrapped in the token with the given
+accessor using the calling token. The authorization counts towards each factor
+of the control group that lists one of the policies of the calling token. Once
+every factor has enough authorizations, the wrapping token can be unwrapped.
+		`,
+	},
+
+	"control-group-request": {
+		"Lists pending control group requests or reads the status of one.",
+		`
+Listing returns the accessors of the wrapping tokens of the control group
+requests that have not been authorized yet. Writing an accessor returns the
+path, requester, factors and authorizations of its request.
+		`,
+	},
+
+	"control-group-accessor": {
+		"The accessor of the wrapping token returned for the control group request.",
+		"",
+	},
 }
@@ -64,7 +64,7 @@ func (b *SystemBackend) tuneMountTTLs(path string, meConfig *MountConfig, newDef
 	// Update the mount table
 	var err error
 	switch {
-	case strings.HasPrefix(path, "auth/"):
+	case strings.HasPrefix(b.Core.namespaceRelativePath(path), "auth/"):
 		err = b.Core.persistAuth(b.Core.auth)
 	default:
 		err = b.Core.persistMounts(b.Core.mounts)
@@ -81,3 +81,55 @@ func (b *SystemBackend) tuneMountTTLs(path string, meConfig *MountConfig, newDef
 
 	return nil
 }
+
+// tuneMountAuditKeys is used to set the request and response data keys that
+// are audited without hashing. A nil argument leaves that list unchanged.
+func (b *SystemBackend) tuneMountAuditKeys(path string, meConfig *MountConfig, newRequestKeys, newResponseKeys *[]string) error {
+	origRequestKeys := meConfig.AuditNonHMACRequestKeys
+	origResponseKeys := meConfig.AuditNonHMACResponseKeys
+
+	if newRequestKeys != nil {
+		meConfig.AuditNonHMACRequestKeys = *newRequestKeys
+	}
+	if newResponseKeys != nil {
+		meConfig.AuditNonHMACResponseKeys = *newResponseKeys
+	}
+
+	// Update the mount table
+	var err error
+	switch {
+	case strings.HasPrefix(b.Core.namespaceRelativePath(path), "auth/"):
+		err = b.Core.persistAuth(b.Core.auth)
+	default:
+		err = b.Core.persistMounts(b.Core.mounts)
+	}
+	if err != nil {
+		meConfig.AuditNonHMACRequestKeys = origRequestKeys
+		meConfig.AuditNonHMACResponseKeys = origResponseKeys
+		return fmt.Errorf("failed to update mount table, rolling back audit key changes")
+	}
+
+	if b.Core.logger.IsInfo() {
+		b.Core.logger.Info("core: mount tuning successful", "path", path)
+	}
+
+	return nil
+}
+
+// tuneMountTokenType is used to set the type of token issued by logins to an
+// auth mount. The empty string resets it to the default.
+func (b *SystemBackend) tuneMountTokenType(path string, meConfig *MountConfig, tokenType string) error {
+	origTokenType := meConfig.TokenType
+	meConfig.TokenType = tokenType
+
+	if err := b.Core.persistAuth(b.Core.auth); err != nil {
+		meConfig.TokenType = origTokenType
+		return fmt.Errorf("failed to update mount table, rolling back token type change")
+	}
+
+	if b.Core.logger.IsInfo() {
+		b.Core.logger.Info("core: mount tuning successful", "path", path)
+	}
+
+	return nil
+}
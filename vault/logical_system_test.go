@@ -7,8 +7,10 @@ import (
 	"testing"
 	"time"
 
+	"github.com/armon/go-metrics"
 	"github.com/fatih/structs"
 	"github.com/hashicorp/vault/audit"
+	"github.com/hashicorp/vault/helper/metricsutil"
 	"github.com/hashicorp/vault/helper/salt"
 	"github.com/hashicorp/vault/logical"
 )
@@ -18,10 +20,17 @@ func TestSystemBackend_RootPaths(t *testing.T) {
 		"auth/*",
 		"remount",
 		"revoke-prefix/*",
+		"leases/lookup/*",
+		"leases/tidy",
+		"leases/irrevocable/*",
 		"audit",
 		"audit/*",
+		"audit-hash-chain-key/*",
 		"raw/*",
 		"rotate",
+		"replication/*",
+		"quotas/*",
+		"namespaces/*",
 	}
 
 	b := testSystemBackend(t)
@@ -114,6 +123,55 @@ func TestSystemBackend_unmount(t *testing.T) {
 	}
 }
 
+func TestSystemBackend_tuneAuditNonHMACKeys(t *testing.T) {
+	b := testSystemBackend(t)
+
+	for _, path := range []string{"mounts/secret/tune", "auth/token/tune"} {
+		req := logical.TestRequest(t, logical.UpdateOperation, path)
+		req.Data["audit_non_hmac_request_keys"] = "ttl,common_name"
+		req.Data["audit_non_hmac_response_keys"] = []string{"serial_number"}
+		resp, err := b.HandleRequest(req)
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		if resp != nil {
+			t.Fatalf("bad: %v", resp)
+		}
+
+		req = logical.TestRequest(t, logical.ReadOperation, path)
+		resp, err = b.HandleRequest(req)
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		if !reflect.DeepEqual(resp.Data["audit_non_hmac_request_keys"], []string{"ttl", "common_name"}) {
+			t.Fatalf("bad: %s: %#v", path, resp.Data)
+		}
+		if !reflect.DeepEqual(resp.Data["audit_non_hmac_response_keys"], []string{"serial_number"}) {
+			t.Fatalf("bad: %s: %#v", path, resp.Data)
+		}
+
+		// Tuning only one list leaves the other as it was, and an empty
+		// value clears it
+		req = logical.TestRequest(t, logical.UpdateOperation, path)
+		req.Data["audit_non_hmac_request_keys"] = ""
+		if _, err := b.HandleRequest(req); err != nil {
+			t.Fatalf("err: %v", err)
+		}
+
+		req = logical.TestRequest(t, logical.ReadOperation, path)
+		resp, err = b.HandleRequest(req)
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		if _, ok := resp.Data["audit_non_hmac_request_keys"]; ok {
+			t.Fatalf("bad: %s: %#v", path, resp.Data)
+		}
+		if !reflect.DeepEqual(resp.Data["audit_non_hmac_response_keys"], []string{"serial_number"}) {
+			t.Fatalf("bad: %s: %#v", path, resp.Data)
+		}
+	}
+}
+
 var capabilitiesPolicy = `
 name = "test"
 path "foo/bar*" {
@@ -390,6 +448,78 @@ func TestSystemBackend_renew_invalidID(t *testing.T) {
 	}
 }
 
+func TestSystemBackend_leases(t *testing.T) {
+	core, b, root := testCoreSystemBackend(t)
+
+	// Create a key with a lease
+	req := logical.TestRequest(t, logical.UpdateOperation, "secret/foo")
+	req.Data["foo"] = "bar"
+	req.Data["lease"] = "1h"
+	req.ClientToken = root
+	resp, err := core.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if resp != nil {
+		t.Fatalf("bad: %#v", resp)
+	}
+
+	// Read a key with a LeaseID
+	req = logical.TestRequest(t, logical.ReadOperation, "secret/foo")
+	req.ClientToken = root
+	resp, err = core.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if resp == nil || resp.Secret == nil || resp.Secret.LeaseID == "" {
+		t.Fatalf("bad: %#v", resp)
+	}
+	leaseID := resp.Secret.LeaseID
+
+	// Lookup the lease
+	req = logical.TestRequest(t, logical.UpdateOperation, "leases/lookup")
+	req.Data["lease_id"] = leaseID
+	resp, err = b.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v %#v", err, resp)
+	}
+	if resp.Data["id"] != leaseID || resp.Data["renewable"] != true || resp.Data["last_renewal"] != nil {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+	if resp.Data["issue_time"].(time.Time).IsZero() || resp.Data["expire_time"].(time.Time).IsZero() {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+	if ttl := resp.Data["ttl"].(int64); ttl <= 0 || ttl > 3600 {
+		t.Fatalf("bad ttl: %d", ttl)
+	}
+
+	// List the leases by prefix
+	req = logical.TestRequest(t, logical.ListOperation, "leases/lookup/secret/")
+	resp, err = b.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if !reflect.DeepEqual(resp.Data["keys"], []string{"foo/"}) {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+	req = logical.TestRequest(t, logical.ListOperation, "leases/lookup/secret/foo/")
+	resp, err = b.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if !reflect.DeepEqual(resp.Data["keys"], []string{strings.TrimPrefix(leaseID, "secret/foo/")}) {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+
+	// Unknown leases are an error
+	req = logical.TestRequest(t, logical.UpdateOperation, "leases/lookup")
+	req.Data["lease_id"] = "secret/foo/bar"
+	resp, err = b.HandleRequest(req)
+	if err != logical.ErrInvalidRequest || resp.Data["error"] != "invalid lease" {
+		t.Fatalf("bad: %v %#v", err, resp)
+	}
+}
+
 func TestSystemBackend_revoke(t *testing.T) {
 	core, b, root := testCoreSystemBackend(t)
 
@@ -815,6 +945,67 @@ func TestSystemBackend_auditHash(t *testing.T) {
 	}
 }
 
+// hashChainAudit is a NoopAudit that hash chains its entries
+type hashChainAudit struct {
+	NoopAudit
+}
+
+func (h *hashChainAudit) HashChainKey() string {
+	return audit.HashChainKey(h.Config.Salt)
+}
+
+func TestSystemBackend_auditHashChainKey(t *testing.T) {
+	c, b, _ := testCoreSystemBackend(t)
+	c.auditBackends["noop"] = func(config *audit.BackendConfig) (audit.Backend, error) {
+		return &NoopAudit{
+			Config: config,
+		}, nil
+	}
+	c.auditBackends["chained"] = func(config *audit.BackendConfig) (audit.Backend, error) {
+		return &hashChainAudit{NoopAudit{
+			Config: config,
+		}}, nil
+	}
+
+	for _, backendType := range []string{"noop", "chained"} {
+		req := logical.TestRequest(t, logical.UpdateOperation, "audit/"+backendType)
+		req.Data["type"] = backendType
+		if _, err := b.HandleRequest(req); err != nil {
+			t.Fatalf("err: %v", err)
+		}
+	}
+
+	req := logical.TestRequest(t, logical.ReadOperation, "audit-hash-chain-key/noop")
+	resp, err := b.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if !resp.IsError() {
+		t.Fatalf("expected error: %#v", resp)
+	}
+
+	req = logical.TestRequest(t, logical.ReadOperation, "audit-hash-chain-key/chained")
+	resp, err = b.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	key, _ := resp.Data["key"].(string)
+	if len(key) != 64 {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+
+	// The key is not available through the audit hash endpoint
+	req = logical.TestRequest(t, logical.UpdateOperation, "audit-hash/chained")
+	req.Data["input"] = "audit-hash-chain"
+	resp, err = b.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if strings.Contains(resp.Data["hash"].(string), key) {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+}
+
 func TestSystemBackend_enableAudit_invalid(t *testing.T) {
 	b := testSystemBackend(t)
 	req := logical.TestRequest(t, logical.UpdateOperation, "audit/foo")
@@ -865,6 +1056,44 @@ func TestSystemBackend_auditTable(t *testing.T) {
 	}
 }
 
+// statusAudit is a NoopAudit that reports a status
+type statusAudit struct {
+	NoopAudit
+}
+
+func (n *statusAudit) Status() map[string]interface{} {
+	return map[string]interface{}{
+		"file_position": int64(42),
+	}
+}
+
+func TestSystemBackend_auditTable_status(t *testing.T) {
+	c, b, _ := testCoreSystemBackend(t)
+	c.auditBackends["status"] = func(config *audit.BackendConfig) (audit.Backend, error) {
+		return &statusAudit{NoopAudit{Config: config}}, nil
+	}
+
+	req := logical.TestRequest(t, logical.UpdateOperation, "audit/foo")
+	req.Data["type"] = "status"
+	if _, err := b.HandleRequest(req); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	req = logical.TestRequest(t, logical.ReadOperation, "audit")
+	resp, err := b.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	exp := map[string]interface{}{
+		"file_position": int64(42),
+	}
+	info := resp.Data["foo/"].(map[string]interface{})
+	if !reflect.DeepEqual(info["status"], exp) {
+		t.Fatalf("got: %#v expect: %#v", info["status"], exp)
+	}
+}
+
 func TestSystemBackend_disableAudit(t *testing.T) {
 	c, b, _ := testCoreSystemBackend(t)
 	c.auditBackends["noop"] = func(config *audit.BackendConfig) (audit.Backend, error) {
@@ -1006,6 +1235,44 @@ func TestSystemBackend_keyStatus(t *testing.T) {
 	}
 }
 
+func TestSystemBackend_metrics(t *testing.T) {
+	c, b, _ := testCoreSystemBackend(t)
+
+	inm := metrics.NewInmemSink(10*time.Second, time.Minute)
+	inm.SetGauge([]string{"vault", "expire", "num_leases"}, 1)
+	prom := metricsutil.NewPrometheusSink("vault", "node1", time.Hour)
+	prom.SetGauge([]string{"vault", "expire", "num_leases"}, 1)
+	c.metricsHelper = metricsutil.NewMetricsHelper(inm, prom)
+
+	req := logical.TestRequest(t, logical.ReadOperation, "metrics")
+	resp, err := b.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if resp.Data["gauges"].(map[string]interface{})["vault.expire.num_leases"] != float32(1) {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+
+	req.Data["format"] = "prometheus"
+	resp, err = b.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if resp.Data[logical.HTTPContentType] != metricsutil.PrometheusContentType {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+	body := string(resp.Data[logical.HTTPRawBody].([]byte))
+	if !strings.Contains(body, `vault_expire_num_leases{node="node1"} 1`) {
+		t.Fatalf("bad: %s", body)
+	}
+
+	req.Data["format"] = "xml"
+	resp, err = b.HandleRequest(req)
+	if err != logical.ErrInvalidRequest || !resp.IsError() {
+		t.Fatalf("expected error: %v %#v", err, resp)
+	}
+}
+
 func TestSystemBackend_rotate(t *testing.T) {
 	b := testSystemBackend(t)
 
@@ -1067,3 +1334,203 @@ func testCoreSystemBackend(t *testing.T) (*Core, logical.Backend, string) {
 	}
 	return c, b, root
 }
+
+func TestSystemBackend_rateLimitQuotas(t *testing.T) {
+	_, b, _ := testCoreSystemBackend(t)
+
+	req := logical.TestRequest(t, logical.UpdateOperation, "quotas/rate-limit/foo")
+	req.Data["path"] = "/secret/"
+	req.Data["rate"] = 10
+	resp, err := b.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v %#v", err, resp)
+	}
+
+	// Fields not given keep their value
+	req = logical.TestRequest(t, logical.UpdateOperation, "quotas/rate-limit/foo")
+	req.Data["burst"] = 50
+	resp, err = b.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v %#v", err, resp)
+	}
+
+	req = logical.TestRequest(t, logical.ReadOperation, "quotas/rate-limit/foo")
+	resp, err = b.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	exp := map[string]interface{}{
+		"name":       "foo",
+		"path":       "secret/",
+		"role":       "",
+		"role_mount": "",
+		"rate":       10,
+		"interval":   int64(1),
+		"burst":      50,
+		"per_token":  false,
+	}
+	if !reflect.DeepEqual(resp.Data, exp) {
+		t.Fatalf("got: %#v expect: %#v", resp.Data, exp)
+	}
+
+	req = logical.TestRequest(t, logical.ListOperation, "quotas/rate-limit/")
+	resp, err = b.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if !reflect.DeepEqual(resp.Data["keys"], []string{"foo"}) {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+
+	req = logical.TestRequest(t, logical.UpdateOperation, "quotas/rate-limit/bar")
+	req.Data["path"] = "secret/"
+	resp, err = b.HandleRequest(req)
+	if err != logical.ErrInvalidRequest || !resp.IsError() {
+		t.Fatalf("expected error without a rate: %v %#v", err, resp)
+	}
+
+	// The path gets a trailing slash and an unset burst is stored as zero
+	req = logical.TestRequest(t, logical.UpdateOperation, "quotas/rate-limit/pki")
+	req.Data["path"] = "pki"
+	req.Data["rate"] = 10
+	resp, err = b.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v %#v", err, resp)
+	}
+	req = logical.TestRequest(t, logical.ReadOperation, "quotas/rate-limit/pki")
+	resp, err = b.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if resp.Data["path"] != "pki/" || resp.Data["burst"] != 0 {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+
+	req = logical.TestRequest(t, logical.DeleteOperation, "quotas/rate-limit/foo")
+	if _, err := b.HandleRequest(req); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	req = logical.TestRequest(t, logical.ReadOperation, "quotas/rate-limit/foo")
+	resp, err = b.HandleRequest(req)
+	if err != nil || resp != nil {
+		t.Fatalf("expected no quota: %v %#v", err, resp)
+	}
+}
+
+func TestSystemBackend_leaseCountQuotas(t *testing.T) {
+	_, b, _ := testCoreSystemBackend(t)
+
+	req := logical.TestRequest(t, logical.UpdateOperation, "quotas/lease-count/foo")
+	req.Data["path"] = "/auth/token"
+	req.Data["max_leases"] = 100
+	resp, err := b.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v %#v", err, resp)
+	}
+
+	req = logical.TestRequest(t, logical.ReadOperation, "quotas/lease-count/foo")
+	resp, err = b.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	exp := map[string]interface{}{
+		"name":       "foo",
+		"path":       "auth/token/",
+		"max_leases": 100,
+		"count":      0,
+	}
+	if !reflect.DeepEqual(resp.Data, exp) {
+		t.Fatalf("got: %#v expect: %#v", resp.Data, exp)
+	}
+
+	req = logical.TestRequest(t, logical.ListOperation, "quotas/lease-count/")
+	resp, err = b.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if !reflect.DeepEqual(resp.Data["keys"], []string{"foo"}) {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+
+	req = logical.TestRequest(t, logical.UpdateOperation, "quotas/lease-count/foo")
+	req.Data["max_leases"] = 0
+	resp, err = b.HandleRequest(req)
+	if err != logical.ErrInvalidRequest || !resp.IsError() {
+		t.Fatalf("expected error: %v %#v", err, resp)
+	}
+
+	req = logical.TestRequest(t, logical.DeleteOperation, "quotas/lease-count/foo")
+	if _, err := b.HandleRequest(req); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	req = logical.TestRequest(t, logical.ReadOperation, "quotas/lease-count/foo")
+	resp, err = b.HandleRequest(req)
+	if err != nil || resp != nil {
+		t.Fatalf("expected no quota: %v %#v", err, resp)
+	}
+}
+
+func TestSystemBackend_leasesRestoreStatus(t *testing.T) {
+	_, b, _ := testCoreSystemBackend(t)
+
+	// The restore started on unseal runs in the background
+	var resp *logical.Response
+	start := time.Now()
+	for time.Now().Sub(start) < time.Second {
+		req := logical.TestRequest(t, logical.ReadOperation, "leases/restore-status")
+		var err error
+		resp, err = b.HandleRequest(req)
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		if !resp.Data["in_progress"].(bool) {
+			break
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	exp := map[string]interface{}{
+		"in_progress":     false,
+		"restored_leases": int64(0),
+		"total_leases":    int64(0),
+	}
+	if !reflect.DeepEqual(resp.Data, exp) {
+		t.Fatalf("bad: got %#v expect %#v", resp.Data, exp)
+	}
+}
+
+func TestSystemBackend_leasesIrrevocable(t *testing.T) {
+	_, b, _ := testCoreSystemBackend(t)
+
+	req := logical.TestRequest(t, logical.ListOperation, "leases/irrevocable/")
+	resp, err := b.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if len(resp.Data) != 0 {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+
+	// Only irrevocable leases can be deleted
+	req = logical.TestRequest(t, logical.DeleteOperation, "leases/irrevocable/secret/foo/abcd")
+	resp, err = b.HandleRequest(req)
+	if err != logical.ErrInvalidRequest {
+		t.Fatalf("err: %v", err)
+	}
+	if resp.Data["error"] != "lease is not irrevocable" {
+		t.Fatalf("bad: %#v", resp)
+	}
+}
+
+func TestSystemBackend_leasesTidy(t *testing.T) {
+	_, b, _ := testCoreSystemBackend(t)
+
+	req := logical.TestRequest(t, logical.UpdateOperation, "leases/tidy")
+	resp, err := b.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if resp == nil || len(resp.Warnings()) != 1 {
+		t.Fatalf("bad: %#v", resp)
+	}
+}
@@ -11,6 +11,7 @@ import (
 	"github.com/hashicorp/go-uuid"
 	"github.com/hashicorp/vault/helper/jsonutil"
 	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/physical"
 )
 
 const (
@@ -125,12 +126,19 @@ type MountEntry struct {
 	Config      MountConfig       `json:"config"`            // Configuration related to this mount (but not backend-derived)
 	Options     map[string]string `json:"options"`           // Backend options
 	Tainted     bool              `json:"tainted,omitempty"` // Set as a Write-Ahead flag for unmount/remount
+	Filter      string            `json:"filter,omitempty"`  // Audit filter expression, only used in the audit table
+
+	NamespaceID   string `json:"namespace_id,omitempty"`   // ID of the namespace holding the mount, empty for the root namespace
+	NamespacePath string `json:"namespace_path,omitempty"` // Path of the namespace holding the mount
 }
 
 // MountConfig is used to hold settable options
 type MountConfig struct {
-	DefaultLeaseTTL time.Duration `json:"default_lease_ttl" structs:"default_lease_ttl" mapstructure:"default_lease_ttl"` // Override for global default
-	MaxLeaseTTL     time.Duration `json:"max_lease_ttl" structs:"max_lease_ttl" mapstructure:"max_lease_ttl"`             // Override for global default
+	DefaultLeaseTTL          time.Duration `json:"default_lease_ttl" structs:"default_lease_ttl" mapstructure:"default_lease_ttl"`                                            // Override for global default
+	MaxLeaseTTL              time.Duration `json:"max_lease_ttl" structs:"max_lease_ttl" mapstructure:"max_lease_ttl"`                                                        // Override for global default
+	AuditNonHMACRequestKeys  []string      `json:"audit_non_hmac_request_keys,omitempty" structs:"audit_non_hmac_request_keys" mapstructure:"audit_non_hmac_request_keys"`    // Request data keys audited without hashing
+	AuditNonHMACResponseKeys []string      `json:"audit_non_hmac_response_keys,omitempty" structs:"audit_non_hmac_response_keys" mapstructure:"audit_non_hmac_response_keys"` // Response data keys audited without hashing
+	TokenType                string        `json:"token_type,omitempty" structs:"token_type" mapstructure:"token_type"`                                                       // Type of token issued on login, only used for auth mounts
 }
 
 // Returns a deep copy of the mount entry
@@ -147,6 +155,10 @@ func (e *MountEntry) Clone() *MountEntry {
 		UUID:        e.UUID,
 		Config:      e.Config,
 		Options:     optClone,
+		Filter:      e.Filter,
+
+		NamespaceID:   e.NamespaceID,
+		NamespacePath: e.NamespacePath,
 	}
 }
 
@@ -157,9 +169,20 @@ func (c *Core) mount(me *MountEntry) error {
 		me.Path += "/"
 	}
 
+	// The mount belongs to the namespace holding its path
+	c.namespacesLock.RLock()
+	defer c.namespacesLock.RUnlock()
+	me.NamespaceID, me.NamespacePath = "", ""
+	if ns := c.matchingNamespaceLocked(me.Path); ns != nil {
+		if ns.Path == me.Path {
+			return logical.CodedError(409, fmt.Sprintf("existing namespace at %s", ns.Path))
+		}
+		me.NamespaceID, me.NamespacePath = ns.ID, ns.Path
+	}
+
 	// Prevent protected paths from being mounted
 	for _, p := range protectedMounts {
-		if strings.HasPrefix(me.Path, p) {
+		if strings.HasPrefix(strings.TrimPrefix(me.Path, me.NamespacePath), p) {
 			return logical.CodedError(403, fmt.Sprintf("cannot mount '%s'", me.Path))
 		}
 	}
@@ -182,7 +205,7 @@ func (c *Core) mount(me *MountEntry) error {
 		return err
 	}
 	me.UUID = meUUID
-	view := NewBarrierView(c.barrier, backendBarrierPrefix+me.UUID+"/")
+	view := NewBarrierView(c.barrier, namespaceBarrierPath(me.NamespaceID, backendBarrierPrefix+me.UUID+"/"))
 
 	backend, err := c.newLogicalBackend(me.Type, c.mountEntrySysView(me), view, nil)
 	if err != nil {
@@ -220,7 +243,7 @@ func (c *Core) unmount(path string) (bool, error) {
 
 	// Prevent protected paths from being unmounted
 	for _, p := range protectedMounts {
-		if strings.HasPrefix(path, p) {
+		if strings.HasPrefix(c.namespaceRelativePath(path), p) {
 			return true, fmt.Errorf("cannot unmount '%s'", path)
 		}
 	}
@@ -260,13 +283,8 @@ func (c *Core) unmount(path string) (bool, error) {
 		return true, err
 	}
 
-	// Clear the data in the view
-	if err := ClearView(view); err != nil {
-		return true, err
-	}
-
-	// Remove the mount table entry
-	if err := c.removeMountEntry(path); err != nil {
+	// Remove the mount table entry and clear the data in the view
+	if err := c.removeMountEntry(path, view); err != nil {
 		return true, err
 	}
 	if c.logger.IsInfo() {
@@ -275,8 +293,9 @@ func (c *Core) unmount(path string) (bool, error) {
 	return true, nil
 }
 
-// removeMountEntry is used to remove an entry from the mount table
-func (c *Core) removeMountEntry(path string) error {
+// removeMountEntry is used to remove an entry from the mount table and
+// clear the data in the view of the mount
+func (c *Core) removeMountEntry(path string, view *BarrierView) error {
 	c.mountsLock.Lock()
 	defer c.mountsLock.Unlock()
 
@@ -285,7 +304,12 @@ func (c *Core) removeMountEntry(path string) error {
 	newTable.remove(path)
 
 	// Update the mount table
-	if err := c.persistMounts(newTable); err != nil {
+	entry, err := c.mountTableEntry(newTable)
+	if err != nil {
+		return logical.CodedError(500, "failed to update mount table")
+	}
+	if err := c.putClearingView(entry, view); err != nil {
+		c.logger.Error("core: failed to persist mount table", "error", err)
 		return logical.CodedError(500, "failed to update mount table")
 	}
 
@@ -322,11 +346,26 @@ func (c *Core) remount(src, dst string) error {
 
 	// Prevent protected paths from being remounted
 	for _, p := range protectedMounts {
-		if strings.HasPrefix(src, p) {
+		if strings.HasPrefix(c.namespaceRelativePath(src), p) {
 			return fmt.Errorf("cannot remount '%s'", src)
 		}
 	}
 
+	// A mount keeps its storage within its namespace, so it cannot be moved
+	// to another one
+	srcNS, dstNS := c.matchingNamespace(src), c.matchingNamespace(dst)
+	if srcNS != dstNS {
+		return fmt.Errorf("cannot remount '%s' to another namespace", src)
+	}
+	if dstNS != nil && dstNS.Path == dst {
+		return fmt.Errorf("existing namespace at '%s'", dst)
+	}
+	for _, p := range protectedMounts {
+		if strings.HasPrefix(c.namespaceRelativePath(dst), p) {
+			return fmt.Errorf("cannot remount to '%s'", dst)
+		}
+	}
+
 	// Verify exact match of the route
 	match := c.router.MatchingMount(src)
 	if match == "" || src != match {
@@ -469,15 +508,31 @@ func (c *Core) loadMounts() error {
 
 // persistMounts is used to persist the mount table after modification
 func (c *Core) persistMounts(table *MountTable) error {
+	entry, err := c.mountTableEntry(table)
+	if err != nil {
+		return err
+	}
+
+	// Write to the physical backend
+	if err := c.barrier.Put(entry); err != nil {
+		c.logger.Error("core: failed to persist mount table", "error", err)
+		return err
+	}
+	return nil
+}
+
+// mountTableEntry validates and encodes the mount table into the entry it
+// is persisted as
+func (c *Core) mountTableEntry(table *MountTable) (*Entry, error) {
 	if table.Type != mountTableType {
 		c.logger.Error("core: given table to persist has wrong type", "actual_type", table.Type, "expected_type", mountTableType)
-		return fmt.Errorf("invalid table type given, not persisting")
+		return nil, fmt.Errorf("invalid table type given, not persisting")
 	}
 
 	for _, entry := range table.Entries {
 		if entry.Table != table.Type {
 			c.logger.Error("core: given entry to persist in mount table has wrong table value", "path", entry.Path, "entry_table_type", entry.Table, "actual_type", table.Type)
-			return fmt.Errorf("invalid mount entry found, not persisting")
+			return nil, fmt.Errorf("invalid mount entry found, not persisting")
 		}
 	}
 
@@ -485,21 +540,71 @@ func (c *Core) persistMounts(table *MountTable) error {
 	compressedBytes, err := jsonutil.EncodeJSONAndCompress(table, nil)
 	if err != nil {
 		c.logger.Error("core: failed to encode and/or compress the mount table", "error", err)
-		return err
+		return nil, err
 	}
 
 	// Create an entry
-	entry := &Entry{
+	return &Entry{
 		Key:   coreMountConfigPath,
 		Value: compressedBytes,
-	}
+	}, nil
+}
 
-	// Write to the physical backend
-	if err := c.barrier.Put(entry); err != nil {
-		c.logger.Error("core: failed to persist mount table", "error", err)
+// clearViewTxnMaxOps bounds the number of operations in each transaction
+// used to clear a view. It matches the smallest limit of the transactional
+// physical backends, Consul's.
+const clearViewTxnMaxOps = 64
+
+// putClearingView deletes all the keys in the view and writes the entry. The
+// keys are deleted in transactions of at most clearViewTxnMaxOps operations,
+// the last of which also writes the entry. If the storage cannot apply them,
+// the remaining keys are deleted one by one before the entry is written. In
+// both cases an interruption never leaves data behind that nothing refers to.
+func (c *Core) putClearingView(entry *Entry, view *BarrierView) error {
+	keys, err := CollectKeys(view)
+	if err != nil {
 		return err
 	}
-	return nil
+
+	if txnBarrier, ok := c.barrier.(TransactionalBarrierStorage); ok {
+		for {
+			batch := keys
+			if len(batch) > clearViewTxnMaxOps-1 {
+				batch = batch[:clearViewTxnMaxOps-1]
+			}
+			final := len(batch) == len(keys)
+
+			txns := make([]TxnEntry, 0, len(batch)+1)
+			for _, key := range batch {
+				txns = append(txns, TxnEntry{
+					Operation: physical.DeleteOperation,
+					Entry:     &Entry{Key: view.expandKey(key)},
+				})
+			}
+			if final {
+				txns = append(txns, TxnEntry{
+					Operation: physical.PutOperation,
+					Entry:     entry,
+				})
+			}
+
+			err := txnBarrier.Transaction(txns)
+			if err == physical.ErrTransactionUnsupported || err == physical.ErrTransactionTooLarge {
+				break
+			}
+			if err != nil || final {
+				return err
+			}
+			keys = keys[len(batch):]
+		}
+	}
+
+	for _, key := range keys {
+		if err := view.Delete(key); err != nil {
+			return err
+		}
+	}
+	return c.barrier.Put(entry)
 }
 
 // setupMounts is invoked after we've loaded the mount table to
@@ -514,7 +619,7 @@ func (c *Core) setupMounts() error {
 
 	for _, entry := range c.mounts.Entries {
 		// Initialize the backend, special casing for system
-		barrierPath := backendBarrierPrefix + entry.UUID + "/"
+		barrierPath := namespaceBarrierPath(entry.NamespaceID, backendBarrierPrefix+entry.UUID+"/")
 		if entry.Type == "system" {
 			barrierPath = systemBarrierPrefix
 		}
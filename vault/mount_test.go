@@ -2,6 +2,7 @@ package vault
 
 import (
 	"encoding/json"
+	"fmt"
 	"reflect"
 	"strings"
 	"testing"
@@ -10,6 +11,7 @@ import (
 	"github.com/hashicorp/vault/audit"
 	"github.com/hashicorp/vault/helper/compressutil"
 	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/physical"
 )
 
 func TestCore_DefaultMountTable(t *testing.T) {
@@ -514,3 +516,79 @@ func verifyDefaultTable(t *testing.T, table *MountTable) {
 	}
 
 }
+
+// txnLimitBarrier wraps a barrier so that transactions with more than
+// maxOps operations are rejected, the way Consul rejects them.
+type txnLimitBarrier struct {
+	SecurityBarrier
+	maxOps int
+	txns   int
+}
+
+func (b *txnLimitBarrier) Transaction(txns []TxnEntry) error {
+	if len(txns) > b.maxOps {
+		return physical.ErrTransactionTooLarge
+	}
+	b.txns++
+	return b.SecurityBarrier.(TransactionalBarrierStorage).Transaction(txns)
+}
+
+func TestCore_Unmount_ClearsViewInBatches(t *testing.T) {
+	c, _, _ := TestCoreUnsealed(t)
+
+	view := c.router.MatchingStorageView("secret/")
+	for i := 0; i < 150; i++ {
+		se := &logical.StorageEntry{
+			Key:   fmt.Sprintf("key%d", i),
+			Value: []byte("test"),
+		}
+		if err := view.Put(se); err != nil {
+			t.Fatalf("err: %v", err)
+		}
+	}
+
+	limited := &txnLimitBarrier{
+		SecurityBarrier: c.barrier,
+		maxOps:          clearViewTxnMaxOps,
+	}
+	c.barrier = limited
+	defer func() {
+		c.barrier = limited.SecurityBarrier
+	}()
+
+	existed, err := c.unmount("secret")
+	if !existed || err != nil {
+		t.Fatalf("existed: %v; err: %v", existed, err)
+	}
+
+	// 150 deletes and the mount table write fit in three transactions
+	if limited.txns != 3 {
+		t.Fatalf("bad: %d transactions", limited.txns)
+	}
+
+	keys, err := CollectKeys(view)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if len(keys) != 0 {
+		t.Fatalf("bad: %v", keys)
+	}
+
+	raw, err := limited.SecurityBarrier.Get(coreMountConfigPath)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if raw == nil {
+		t.Fatalf("missing mount table")
+	}
+	table, uncompressed, err := compressutil.Decompress(raw.Value)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if uncompressed {
+		table = raw.Value
+	}
+	if strings.Contains(string(table), `"secret/"`) {
+		t.Fatalf("mount table still references the mount: %s", table)
+	}
+}
@@ -0,0 +1,526 @@
+package vault
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/hashicorp/errwrap"
+	"github.com/hashicorp/go-uuid"
+	"github.com/hashicorp/vault/helper/jsonutil"
+	"github.com/hashicorp/vault/helper/strutil"
+	"github.com/hashicorp/vault/logical"
+)
+
+const (
+	// coreNamespaceConfigPath is used to store the namespace table.
+	// Namespaces are protected within the Vault itself, which means they
+	// can only be viewed or modified after an unseal.
+	coreNamespaceConfigPath = "core/namespaces"
+
+	// namespaceBarrierPrefix is the prefix to the ID used in the barrier
+	// view for a namespace. The policies of the namespace and the storage of
+	// the backends mounted in it are nested under that view.
+	namespaceBarrierPrefix = "namespaces/"
+)
+
+var (
+	// errLoadNamespacesFailed if loadNamespaces encounters an error
+	errLoadNamespacesFailed = errors.New("failed to setup namespace table")
+
+	// reservedNamespaceNames cannot be used as the name of a namespace as
+	// they would shadow the paths served within its parent
+	reservedNamespaceNames = []string{
+		"audit",
+		"auth",
+		"cubbyhole",
+		"sys",
+	}
+
+	// namespaceSysPaths are the system endpoints served within a namespace
+	namespaceSysPaths = []string{
+		"auth",
+		"capabilities",
+		"capabilities-accessor",
+		"capabilities-self",
+		"mounts",
+		"namespaces",
+		"policy",
+		"remount",
+		"renew",
+		"revoke",
+		"revoke-force",
+		"revoke-prefix",
+	}
+
+	// namespaceTokenPaths are the token store endpoints served within a
+	// namespace. Roles are shared by all namespaces so they are left out.
+	namespaceTokenPaths = []string{
+		"create",
+		"create-orphan",
+		"lookup",
+		"lookup-accessor",
+		"lookup-self",
+		"renew",
+		"renew-self",
+		"revoke",
+		"revoke-accessor",
+		"revoke-orphan",
+		"revoke-self",
+	}
+)
+
+// NamespaceTable is used to represent the internal namespace table
+type NamespaceTable struct {
+	Entries []*NamespaceEntry `json:"entries"`
+}
+
+// NamespaceEntry is used to represent a namespace table entry
+type NamespaceEntry struct {
+	ID   string `json:"id"`   // Barrier view ID
+	Path string `json:"path"` // Full path of the namespace, ending in a slash
+}
+
+// namespaceBackend exposes a backend shared with the root namespace within
+// a namespace, limited to the paths that make sense there
+type namespaceBackend struct {
+	logical.Backend
+
+	// paths lists the first path segments that are served; nil serves all
+	paths []string
+}
+
+func (b *namespaceBackend) allowed(req *logical.Request) bool {
+	switch req.Operation {
+	case logical.RenewOperation, logical.RevokeOperation, logical.RollbackOperation:
+		return true
+	}
+	if b.paths == nil {
+		return true
+	}
+
+	segment := strings.SplitN(req.Path, "/", 2)[0]
+	if !strutil.StrListContains(b.paths, segment) {
+		return false
+	}
+
+	// Creating a token against a role is not possible in a namespace
+	return segment != "create" || req.Path == segment
+}
+
+func (b *namespaceBackend) HandleRequest(req *logical.Request) (*logical.Response, error) {
+	if !b.allowed(req) {
+		return logical.ErrorResponse(fmt.Sprintf("no handler for route '%s'", req.MountPoint+req.Path)), logical.ErrUnsupportedPath
+	}
+	return b.Backend.HandleRequest(req)
+}
+
+func (b *namespaceBackend) HandleExistenceCheck(req *logical.Request) (bool, bool, error) {
+	if !b.allowed(req) {
+		return false, false, logical.ErrUnsupportedPath
+	}
+	return b.Backend.HandleExistenceCheck(req)
+}
+
+// Cleanup is a no-op as the backend is owned by the root namespace
+func (b *namespaceBackend) Cleanup() {}
+
+// namespaceBarrierPath nests a barrier path under the view of the namespace
+// with the given ID; the root namespace has an empty ID
+func namespaceBarrierPath(namespaceID, path string) string {
+	if namespaceID == "" {
+		return path
+	}
+	return namespaceBarrierPrefix + namespaceID + "/" + path
+}
+
+// matchingNamespace returns the innermost namespace holding a path, or nil
+// for the root namespace
+func (c *Core) matchingNamespace(path string) *NamespaceEntry {
+	c.namespacesLock.RLock()
+	defer c.namespacesLock.RUnlock()
+	return c.matchingNamespaceLocked(path)
+}
+
+func (c *Core) matchingNamespaceLocked(path string) *NamespaceEntry {
+	if c.namespaces == nil {
+		return nil
+	}
+
+	var match *NamespaceEntry
+	for _, entry := range c.namespaces.Entries {
+		if !strings.HasPrefix(path, entry.Path) {
+			continue
+		}
+		if match == nil || len(entry.Path) > len(match.Path) {
+			match = entry
+		}
+	}
+	return match
+}
+
+// namespaceByID returns the namespace with the given ID, or nil
+func (c *Core) namespaceByID(id string) *NamespaceEntry {
+	c.namespacesLock.RLock()
+	defer c.namespacesLock.RUnlock()
+
+	if c.namespaces == nil {
+		return nil
+	}
+	for _, entry := range c.namespaces.Entries {
+		if entry.ID == id {
+			return entry
+		}
+	}
+	return nil
+}
+
+// namespaceRelativePath strips the path of the namespace holding a path
+func (c *Core) namespaceRelativePath(path string) string {
+	if ns := c.matchingNamespace(path); ns != nil {
+		return strings.TrimPrefix(path, ns.Path)
+	}
+	return path
+}
+
+// namespacePolicyStore returns the policy store of the namespace with the
+// given ID; the root namespace has an empty ID. It returns nil if the
+// namespace does not exist.
+func (c *Core) namespacePolicyStore(id string) *PolicyStore {
+	if id == "" {
+		return c.policyStore
+	}
+
+	c.namespacesLock.RLock()
+	defer c.namespacesLock.RUnlock()
+	return c.namespacePolicyStores[id]
+}
+
+// listNamespaces returns the namespaces directly below the given one, by
+// path relative to it
+func (c *Core) listNamespaces(parent string) []string {
+	c.namespacesLock.RLock()
+	defer c.namespacesLock.RUnlock()
+
+	keys := []string{}
+	if c.namespaces == nil {
+		return keys
+	}
+	for _, entry := range c.namespaces.Entries {
+		if !strings.HasPrefix(entry.Path, parent) || entry.Path == parent {
+			continue
+		}
+		rel := strings.TrimPrefix(entry.Path, parent)
+		if strings.Count(rel, "/") == 1 {
+			keys = append(keys, rel)
+		}
+	}
+	return keys
+}
+
+// createNamespace is used to create a namespace at the given full path,
+// directly below an existing namespace
+func (c *Core) createNamespace(path string) (*NamespaceEntry, error) {
+	// Ensure we end the path in a slash
+	if !strings.HasSuffix(path, "/") {
+		path += "/"
+	}
+
+	c.namespacesLock.Lock()
+	defer c.namespacesLock.Unlock()
+
+	// The namespace must be a direct child of an existing namespace
+	parent := c.matchingNamespaceLocked(path)
+	parentPath := ""
+	if parent != nil {
+		if parent.Path == path {
+			return nil, logical.CodedError(409, fmt.Sprintf("existing namespace at %s", path))
+		}
+		parentPath = parent.Path
+	}
+	name := strings.TrimSuffix(strings.TrimPrefix(path, parentPath), "/")
+	switch {
+	case name == "":
+		return nil, fmt.Errorf("namespace path must be specified")
+	case strings.Contains(name, "/"):
+		return nil, fmt.Errorf("namespace %q must be created within namespace %q", name, parentPath+strings.SplitN(name, "/", 2)[0]+"/")
+	case strutil.StrListContains(reservedNamespaceNames, name):
+		return nil, logical.CodedError(403, fmt.Sprintf("cannot create namespace '%s'", path))
+	}
+
+	// Verify there is no conflicting mount
+	c.mountsLock.RLock()
+	for _, entry := range c.mounts.Entries {
+		if strings.HasPrefix(entry.Path, path) || strings.HasPrefix(path, entry.Path) {
+			c.mountsLock.RUnlock()
+			return nil, logical.CodedError(409, fmt.Sprintf("existing mount at %s", entry.Path))
+		}
+	}
+	c.mountsLock.RUnlock()
+
+	id, err := uuid.GenerateUUID()
+	if err != nil {
+		return nil, err
+	}
+	entry := &NamespaceEntry{
+		ID:   id,
+		Path: path,
+	}
+
+	if err := c.setupNamespace(entry); err != nil {
+		c.teardownNamespace(entry)
+		return nil, err
+	}
+
+	// Update the namespace table
+	newTable := c.namespaces.shallowClone()
+	newTable.Entries = append(newTable.Entries, entry)
+	if err := c.persistNamespaces(newTable); err != nil {
+		c.teardownNamespace(entry)
+		return nil, logical.CodedError(500, "failed to update namespace table")
+	}
+	c.namespaces = newTable
+
+	if c.logger.IsInfo() {
+		c.logger.Info("core: created namespace", "path", path)
+	}
+	return entry, nil
+}
+
+// deleteNamespace is used to delete the namespace at the given full path.
+// The namespace must be empty. The boolean indicates if it existed.
+func (c *Core) deleteNamespace(path string) (bool, error) {
+	// Ensure we end the path in a slash
+	if !strings.HasSuffix(path, "/") {
+		path += "/"
+	}
+
+	c.namespacesLock.Lock()
+	defer c.namespacesLock.Unlock()
+
+	var entry *NamespaceEntry
+	for _, ns := range c.namespaces.Entries {
+		switch {
+		case ns.Path == path:
+			entry = ns
+		case strings.HasPrefix(ns.Path, path):
+			return true, logical.CodedError(409, fmt.Sprintf("namespace %s contains namespace %s", path, ns.Path))
+		}
+	}
+	if entry == nil {
+		return false, fmt.Errorf("no namespace at %s", path)
+	}
+
+	// Everything mounted within the namespace must be removed first
+	c.mountsLock.RLock()
+	for _, me := range c.mounts.Entries {
+		if me.NamespaceID == entry.ID {
+			c.mountsLock.RUnlock()
+			return true, logical.CodedError(409, fmt.Sprintf("namespace %s contains mount %s", path, me.Path))
+		}
+	}
+	c.mountsLock.RUnlock()
+
+	c.authLock.RLock()
+	for _, me := range c.auth.Entries {
+		if me.NamespaceID == entry.ID {
+			c.authLock.RUnlock()
+			return true, logical.CodedError(409, fmt.Sprintf("namespace %s contains auth mount %s", path, credentialRoutePath(me)))
+		}
+	}
+	c.authLock.RUnlock()
+
+	// Revoke the tokens created within the namespace
+	if err := c.expiration.RevokePrefix(path); err != nil {
+		return true, err
+	}
+
+	// Remove the namespace table entry
+	newTable := c.namespaces.shallowClone()
+	newTable.remove(path)
+	if err := c.persistNamespaces(newTable); err != nil {
+		return true, logical.CodedError(500, "failed to update namespace table")
+	}
+	c.namespaces = newTable
+
+	c.teardownNamespace(entry)
+
+	// Clear the data of the namespace
+	if err := ClearView(NewBarrierView(c.barrier, namespaceBarrierPath(entry.ID, ""))); err != nil {
+		return true, err
+	}
+
+	if c.logger.IsInfo() {
+		c.logger.Info("core: deleted namespace", "path", path)
+	}
+	return true, nil
+}
+
+// loadNamespaces is invoked as part of postUnseal to load the namespace table
+func (c *Core) loadNamespaces() error {
+	namespaceTable := &NamespaceTable{}
+
+	// Load the existing namespace table
+	raw, err := c.barrier.Get(coreNamespaceConfigPath)
+	if err != nil {
+		c.logger.Error("core: failed to read namespace table", "error", err)
+		return errLoadNamespacesFailed
+	}
+	if raw != nil {
+		if err := jsonutil.DecodeJSON(raw.Value, namespaceTable); err != nil {
+			c.logger.Error("core: failed to decode namespace table", "error", err)
+			return errLoadNamespacesFailed
+		}
+	}
+
+	c.namespacesLock.Lock()
+	c.namespaces = namespaceTable
+	c.namespacesLock.Unlock()
+	return nil
+}
+
+// persistNamespaces is used to persist the namespace table after modification
+func (c *Core) persistNamespaces(table *NamespaceTable) error {
+	// Marshal the table
+	raw, err := json.Marshal(table)
+	if err != nil {
+		c.logger.Error("core: failed to encode namespace table", "error", err)
+		return err
+	}
+
+	// Create an entry
+	entry := &Entry{
+		Key:   coreNamespaceConfigPath,
+		Value: raw,
+	}
+
+	// Write to the physical backend
+	if err := c.barrier.Put(entry); err != nil {
+		c.logger.Error("core: failed to persist namespace table", "error", err)
+		return err
+	}
+	return nil
+}
+
+// setupNamespaces is invoked after we've loaded the namespace table and set
+// up the mounts and credential backends, to set up each namespace
+func (c *Core) setupNamespaces() error {
+	c.namespacesLock.Lock()
+	defer c.namespacesLock.Unlock()
+
+	for _, entry := range c.namespaces.Entries {
+		if err := c.setupNamespace(entry); err != nil {
+			c.logger.Error("core: failed to setup namespace", "path", entry.Path, "error", err)
+			return errLoadNamespacesFailed
+		}
+	}
+	return nil
+}
+
+// setupNamespace creates the policy store of a namespace and mounts the
+// system, cubbyhole and token backends within it. The namespace lock must
+// be held.
+func (c *Core) setupNamespace(entry *NamespaceEntry) error {
+	view := NewBarrierView(c.barrier, namespaceBarrierPath(entry.ID, systemBarrierPrefix+policySubPath))
+	ps := NewPolicyStore(view, &dynamicSystemView{core: c})
+	ps.pathPrefix = entry.Path
+
+	// Ensure that the default policy exists, and if not, create it
+	policy, err := ps.GetPolicy("default")
+	if err != nil {
+		return errwrap.Wrapf("error fetching default policy from store: {{err}}", err)
+	}
+	if policy == nil {
+		if err := ps.createDefaultPolicy(); err != nil {
+			return err
+		}
+	}
+
+	if c.namespacePolicyStores == nil {
+		c.namespacePolicyStores = make(map[string]*PolicyStore)
+	}
+	c.namespacePolicyStores[entry.ID] = ps
+
+	// The backends are shared with the root namespace; the salt of their
+	// mount entry is kept so that they see the same salted tokens
+	shared := []struct {
+		prefix string
+		paths  []string
+	}{
+		{"sys/", namespaceSysPaths},
+		{"cubbyhole/", nil},
+		{credentialRoutePrefix + "token/", namespaceTokenPaths},
+	}
+	for _, s := range shared {
+		backend := c.router.MatchingBackend(s.prefix)
+		rootEntry := c.router.MatchingMountEntry(s.prefix)
+		if backend == nil || rootEntry == nil {
+			return fmt.Errorf("no backend mounted at %s", s.prefix)
+		}
+
+		me := rootEntry.Clone()
+		me.Path = entry.Path + rootEntry.Path
+		me.NamespaceID = entry.ID
+		me.NamespacePath = entry.Path
+
+		nsBackend := &namespaceBackend{
+			Backend: backend,
+			paths:   s.paths,
+		}
+		if err := c.router.Mount(nsBackend, entry.Path+s.prefix, me, c.router.MatchingStorageView(s.prefix)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// teardownNamespace reverses setupNamespace. The namespace lock must be held.
+func (c *Core) teardownNamespace(entry *NamespaceEntry) {
+	for _, prefix := range []string{"sys/", "cubbyhole/", credentialRoutePrefix + "token/"} {
+		if c.router.MatchingMount(entry.Path+prefix) == entry.Path+prefix {
+			c.router.Unmount(entry.Path + prefix)
+		}
+	}
+	delete(c.namespacePolicyStores, entry.ID)
+}
+
+// teardownNamespaces is used before we seal the vault to reset the
+// namespaces to their unloaded state. This is reversed by loadNamespaces and
+// setupNamespaces.
+func (c *Core) teardownNamespaces() error {
+	c.namespacesLock.Lock()
+	defer c.namespacesLock.Unlock()
+
+	if c.namespaces != nil {
+		for _, entry := range c.namespaces.Entries {
+			c.teardownNamespace(entry)
+		}
+	}
+
+	c.namespaces = nil
+	c.namespacePolicyStores = nil
+	return nil
+}
+
+// shallowClone returns a copy of the namespace table that keeps the
+// NamespaceEntry locations
+func (t *NamespaceTable) shallowClone() *NamespaceTable {
+	nt := &NamespaceTable{
+		Entries: make([]*NamespaceEntry, len(t.Entries)),
+	}
+	copy(nt.Entries, t.Entries)
+	return nt
+}
+
+// remove is used to remove a given path entry
+func (t *NamespaceTable) remove(path string) {
+	n := len(t.Entries)
+	for i := 0; i < n; i++ {
+		if t.Entries[i].Path == path {
+			t.Entries[i], t.Entries[n-1] = t.Entries[n-1], nil
+			t.Entries = t.Entries[:n-1]
+			return
+		}
+	}
+}
@@ -0,0 +1,200 @@
+package vault
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/errwrap"
+	"github.com/hashicorp/vault/logical"
+)
+
+func testNamespaceRequest(t *testing.T, c *Core, token string, op logical.Operation, path string, data map[string]interface{}) *logical.Response {
+	req := &logical.Request{
+		Operation:   op,
+		Path:        path,
+		Data:        data,
+		ClientToken: token,
+	}
+	resp, err := c.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("%s %s: err: %v resp: %#v", op, path, err, resp)
+	}
+	return resp
+}
+
+func TestNamespaces_CreateListDelete(t *testing.T) {
+	c, _, root := TestCoreUnsealed(t)
+
+	resp := testNamespaceRequest(t, c, root, logical.UpdateOperation, "sys/namespaces/team1", nil)
+	if resp.Data["path"] != "team1/" || resp.Data["id"] == "" {
+		t.Fatalf("bad: %#v", resp)
+	}
+
+	// Nested namespaces are created from within their parent
+	resp = testNamespaceRequest(t, c, root, logical.UpdateOperation, "team1/sys/namespaces/sub", nil)
+	if resp.Data["path"] != "sub/" {
+		t.Fatalf("bad: %#v", resp)
+	}
+
+	resp = testNamespaceRequest(t, c, root, logical.ListOperation, "sys/namespaces", nil)
+	if !reflect.DeepEqual(resp.Data["keys"], []string{"team1/"}) {
+		t.Fatalf("bad: %#v", resp)
+	}
+	resp = testNamespaceRequest(t, c, root, logical.ListOperation, "team1/sys/namespaces", nil)
+	if !reflect.DeepEqual(resp.Data["keys"], []string{"sub/"}) {
+		t.Fatalf("bad: %#v", resp)
+	}
+
+	// Reserved names and paths of mounts may not be used
+	for _, path := range []string{"sys/namespaces/sys", "sys/namespaces/secret", "sys/namespaces/team1"} {
+		req := logical.TestRequest(t, logical.UpdateOperation, path)
+		req.ClientToken = root
+		if _, err := c.HandleRequest(req); err == nil {
+			t.Fatalf("expected error creating %s", path)
+		}
+	}
+
+	// A namespace holding other namespaces cannot be deleted
+	req := logical.TestRequest(t, logical.DeleteOperation, "sys/namespaces/team1")
+	req.ClientToken = root
+	if _, err := c.HandleRequest(req); err == nil {
+		t.Fatalf("expected error deleting non-empty namespace")
+	}
+
+	testNamespaceRequest(t, c, root, logical.DeleteOperation, "team1/sys/namespaces/sub", nil)
+	testNamespaceRequest(t, c, root, logical.DeleteOperation, "sys/namespaces/team1", nil)
+
+	resp = testNamespaceRequest(t, c, root, logical.ListOperation, "sys/namespaces", nil)
+	if _, ok := resp.Data["keys"]; ok {
+		t.Fatalf("bad: %#v", resp)
+	}
+	if c.matchingNamespace("team1/") != nil {
+		t.Fatalf("namespace should be deleted")
+	}
+}
+
+func TestNamespaces_Mounts(t *testing.T) {
+	c, key, root := TestCoreUnsealed(t)
+
+	resp := testNamespaceRequest(t, c, root, logical.UpdateOperation, "sys/namespaces/team1", nil)
+	nsID := resp.Data["id"].(string)
+
+	testNamespaceRequest(t, c, root, logical.UpdateOperation, "team1/sys/mounts/secret", map[string]interface{}{
+		"type": "generic",
+	})
+	testNamespaceRequest(t, c, root, logical.UpdateOperation, "team1/secret/foo", map[string]interface{}{
+		"value": "team1",
+	})
+
+	// The mount is not visible from the root namespace
+	resp = testNamespaceRequest(t, c, root, logical.ReadOperation, "sys/mounts", nil)
+	if _, ok := resp.Data["team1/secret/"]; ok {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+	resp = testNamespaceRequest(t, c, root, logical.ReadOperation, "team1/sys/mounts", nil)
+	if _, ok := resp.Data["secret/"]; !ok || len(resp.Data) != 1 {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+	resp = testNamespaceRequest(t, c, root, logical.ReadOperation, "secret/foo", nil)
+	if resp != nil {
+		t.Fatalf("bad: %#v", resp)
+	}
+
+	// The data is stored below the view of the namespace
+	keys, err := CollectKeys(NewBarrierView(c.barrier, namespaceBarrierPath(nsID, backendBarrierPrefix)))
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if len(keys) != 1 || !strings.HasSuffix(keys[0], "/foo") {
+		t.Fatalf("bad: %v", keys)
+	}
+
+	// A namespace holding mounts cannot be deleted
+	req := logical.TestRequest(t, logical.DeleteOperation, "sys/namespaces/team1")
+	req.ClientToken = root
+	if _, err := c.HandleRequest(req); err == nil {
+		t.Fatalf("expected error deleting non-empty namespace")
+	}
+
+	// Namespaces and their mounts survive a seal
+	if err := c.Seal(root); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if _, err := TestCoreUnseal(c, TestKeyCopy(key)); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	resp = testNamespaceRequest(t, c, root, logical.ReadOperation, "team1/secret/foo", nil)
+	if resp == nil || resp.Data["value"] != "team1" {
+		t.Fatalf("bad: %#v", resp)
+	}
+}
+
+func TestNamespaces_PoliciesAndTokens(t *testing.T) {
+	c, _, root := TestCoreUnsealed(t)
+
+	testNamespaceRequest(t, c, root, logical.UpdateOperation, "sys/namespaces/team1", nil)
+	testNamespaceRequest(t, c, root, logical.UpdateOperation, "team1/sys/mounts/secret", map[string]interface{}{
+		"type": "generic",
+	})
+	testNamespaceRequest(t, c, root, logical.UpdateOperation, "team1/sys/policy/dev", map[string]interface{}{
+		"rules": `path "secret/*" { policy = "write" }`,
+	})
+
+	// The policy only exists within the namespace
+	resp := testNamespaceRequest(t, c, root, logical.ReadOperation, "sys/policy/dev", nil)
+	if resp != nil {
+		t.Fatalf("bad: %#v", resp)
+	}
+	resp = testNamespaceRequest(t, c, root, logical.ListOperation, "team1/sys/policy", nil)
+	if !reflect.DeepEqual(resp.Data["keys"], []string{"default", "dev"}) {
+		t.Fatalf("bad: %#v", resp)
+	}
+
+	// Root tokens cannot be created within a namespace
+	req := logical.TestRequest(t, logical.UpdateOperation, "team1/auth/token/create")
+	req.ClientToken = root
+	if _, err := c.HandleRequest(req); err == nil {
+		t.Fatalf("expected error creating root token in namespace")
+	}
+
+	resp = testNamespaceRequest(t, c, root, logical.UpdateOperation, "team1/auth/token/create", map[string]interface{}{
+		"policies": []string{"dev"},
+	})
+	token := resp.Auth.ClientToken
+
+	te, err := c.tokenStore.Lookup(token)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if te.NamespaceID == "" || te.Path != "team1/auth/token/create" {
+		t.Fatalf("bad: %#v", te)
+	}
+
+	// The policy of the token is scoped to the namespace
+	testNamespaceRequest(t, c, token, logical.UpdateOperation, "team1/secret/foo", map[string]interface{}{
+		"value": "bar",
+	})
+	for _, path := range []string{"secret/foo", "team1/sys/policy/dev", "sys/policy/dev"} {
+		req := logical.TestRequest(t, logical.UpdateOperation, path)
+		req.ClientToken = token
+		if _, err := c.HandleRequest(req); err == nil || !errwrap.Contains(err, logical.ErrPermissionDenied.Error()) {
+			t.Fatalf("%s: expected permission denied, got %v", path, err)
+		}
+	}
+
+	// The token can look itself up through the namespace
+	resp = testNamespaceRequest(t, c, token, logical.ReadOperation, "team1/auth/token/lookup-self", nil)
+	if resp.Data["id"] != token {
+		t.Fatalf("bad: %#v", resp)
+	}
+
+	// Capabilities are relative to the namespace
+	resp = testNamespaceRequest(t, c, root, logical.UpdateOperation, "team1/sys/capabilities", map[string]interface{}{
+		"token": token,
+		"path":  "secret/foo",
+	})
+	if !reflect.DeepEqual(resp.Data["capabilities"], []string{"create", "delete", "list", "read", "update"}) {
+		t.Fatalf("bad: %#v", resp)
+	}
+}
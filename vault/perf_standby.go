@@ -0,0 +1,604 @@
+package vault
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/net/http2"
+
+	"github.com/hashicorp/errwrap"
+	"github.com/hashicorp/vault/helper/jsonutil"
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/physical"
+)
+
+const (
+	// perfStandbyInvalidationPath is the cluster path on which the active
+	// node streams the keys it modifies to performance standbys
+	perfStandbyInvalidationPath = "/cluster/local/invalidations"
+
+	// invalidationBufferSize is the number of keys that can be queued for a
+	// single performance standby before it is disconnected and has to
+	// reload its state
+	invalidationBufferSize = 4096
+)
+
+var (
+	// perfStandbyHeartbeatInterval is how often the active node writes to an
+	// idle invalidation stream. A standby drops the stream if it hears
+	// nothing for three intervals.
+	perfStandbyHeartbeatInterval = 10 * time.Second
+
+	// perfStandbyRetryInterval is how long a performance standby waits
+	// before reconnecting to the active node after losing the stream
+	perfStandbyRetryInterval = 5 * time.Second
+)
+
+// invalidationMessage is a single message on the invalidation stream. An
+// empty message is used as a heartbeat.
+type invalidationMessage struct {
+	Keys []string `json:"keys"`
+}
+
+// perfStandbyBackend wraps the physical backend underneath the barrier. On
+// the active node it publishes the keys of successful writes so that
+// performance standbys can drop anything they have cached for them. On a
+// performance standby it rejects all writes, which causes any request that
+// needs one to be forwarded to the active node.
+type perfStandbyBackend struct {
+	backend  physical.Backend
+	broker   *invalidationBroker
+	readOnly uint32
+}
+
+func newPerfStandbyBackend(b physical.Backend) *perfStandbyBackend {
+	return &perfStandbyBackend{
+		backend: b,
+		broker:  newInvalidationBroker(),
+	}
+}
+
+func (p *perfStandbyBackend) setReadOnly(readOnly bool) {
+	var val uint32
+	if readOnly {
+		val = 1
+	}
+	atomic.StoreUint32(&p.readOnly, val)
+}
+
+func (p *perfStandbyBackend) isReadOnly() bool {
+	return atomic.LoadUint32(&p.readOnly) == 1
+}
+
+func (p *perfStandbyBackend) Put(entry *physical.Entry) error {
+	if p.isReadOnly() {
+		return logical.ErrReadOnly
+	}
+	if err := p.backend.Put(entry); err != nil {
+		return err
+	}
+	p.broker.publish(entry.Key)
+	return nil
+}
+
+func (p *perfStandbyBackend) Get(key string) (*physical.Entry, error) {
+	return p.backend.Get(key)
+}
+
+func (p *perfStandbyBackend) Delete(key string) error {
+	if p.isReadOnly() {
+		return logical.ErrReadOnly
+	}
+	if err := p.backend.Delete(key); err != nil {
+		return err
+	}
+	p.broker.publish(key)
+	return nil
+}
+
+func (p *perfStandbyBackend) List(prefix string) ([]string, error) {
+	return p.backend.List(prefix)
+}
+
+func (p *perfStandbyBackend) Transaction(txns []physical.TxnEntry) error {
+	if p.isReadOnly() {
+		return logical.ErrReadOnly
+	}
+	txnBackend, ok := p.backend.(physical.Transactional)
+	if !ok {
+		return physical.ErrTransactionUnsupported
+	}
+	if err := txnBackend.Transaction(txns); err != nil {
+		return err
+	}
+
+	keys := make([]string, 0, len(txns))
+	for _, txn := range txns {
+		keys = append(keys, txn.Entry.Key)
+	}
+	p.broker.publish(keys...)
+	return nil
+}
+
+// invalidationBroker fans the keys modified on the active node out to all
+// connected performance standbys
+type invalidationBroker struct {
+	l           sync.Mutex
+	subscribers map[chan string]struct{}
+}
+
+func newInvalidationBroker() *invalidationBroker {
+	return &invalidationBroker{
+		subscribers: make(map[chan string]struct{}),
+	}
+}
+
+// subscribe returns a channel on which modified keys are delivered. The
+// channel is closed if the subscriber falls too far behind, in which case it
+// must assume it missed modifications.
+func (b *invalidationBroker) subscribe() chan string {
+	ch := make(chan string, invalidationBufferSize)
+	b.l.Lock()
+	b.subscribers[ch] = struct{}{}
+	b.l.Unlock()
+	return ch
+}
+
+func (b *invalidationBroker) unsubscribe(ch chan string) {
+	b.l.Lock()
+	defer b.l.Unlock()
+	if _, ok := b.subscribers[ch]; ok {
+		delete(b.subscribers, ch)
+		close(ch)
+	}
+}
+
+// closeAll disconnects all subscribers, which is used when this node stops
+// being the active node
+func (b *invalidationBroker) closeAll() {
+	b.l.Lock()
+	defer b.l.Unlock()
+	for ch := range b.subscribers {
+		delete(b.subscribers, ch)
+		close(ch)
+	}
+}
+
+func (b *invalidationBroker) publish(keys ...string) {
+	b.l.Lock()
+	defer b.l.Unlock()
+
+	for ch := range b.subscribers {
+	SEND:
+		for _, key := range keys {
+			select {
+			case ch <- key:
+			default:
+				// Never block writes on a slow standby; cut it off instead
+				delete(b.subscribers, ch)
+				close(ch)
+				break SEND
+			}
+		}
+	}
+}
+
+// PerformanceStandby returns true if this node is a standby that is
+// currently able to serve read-only requests locally
+func (c *Core) PerformanceStandby() bool {
+	c.stateLock.RLock()
+	defer c.stateLock.RUnlock()
+	if !c.perfStandby || !c.standby || c.sealed {
+		return false
+	}
+
+	c.perfStandbyLock.RLock()
+	defer c.perfStandbyLock.RUnlock()
+	return c.perfStandbyReady
+}
+
+// perfStandbyLocalRequest returns whether the given request may be attempted
+// locally by a performance standby. The state lock and the performance
+// standby lock must be held.
+func (c *Core) perfStandbyLocalRequest(req *logical.Request) bool {
+	if !c.perfStandbyReady {
+		return false
+	}
+
+	switch req.Operation {
+	case logical.DeleteOperation, logical.RevokeOperation, logical.RenewOperation, logical.RollbackOperation:
+		return false
+	}
+
+	// Wrapping creates a token and logins create tokens and leases
+	if req.WrapTTL != 0 || c.router.LoginPath(req.Path) {
+		return false
+	}
+
+	return c.router.PerformanceStandbyPath(req.Path)
+}
+
+// perfStandbyNeedsForward returns whether the result of a request handled by
+// a performance standby shows that it must be handled by the active node
+func perfStandbyNeedsForward(err error) bool {
+	if err == nil {
+		return false
+	}
+	return err == ErrStandby || errwrap.Contains(err, ErrStandby.Error()) || isReadOnlyErr(err)
+}
+
+// isReadOnlyErr returns whether the error was caused by a write to storage
+// on a performance standby. Storage errors must be wrapped with errwrap for
+// this to see through them.
+func isReadOnlyErr(err error) bool {
+	if err == nil {
+		return false
+	}
+	return err == logical.ErrReadOnly || errwrap.Contains(err, logical.ErrReadOnly.Error())
+}
+
+// handleInvalidationStream is served on the cluster port of the active node.
+// It streams the keys modified on this node to a performance standby as
+// newline-delimited JSON until the standby disconnects.
+func (c *Core) handleInvalidationStream(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok || c.perfStandbyBackend == nil {
+		w.WriteHeader(http.StatusNotImplemented)
+		return
+	}
+
+	standby, _ := c.Standby()
+	if standby {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+
+	ch := c.perfStandbyBackend.broker.subscribe()
+	defer c.perfStandbyBackend.broker.unsubscribe(ch)
+
+	if c.logger.IsDebug() {
+		c.logger.Debug("core: performance standby connected to invalidation stream", "remote_address", r.RemoteAddr)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(perfStandbyHeartbeatInterval)
+	defer heartbeat.Stop()
+
+	enc := json.NewEncoder(w)
+	for {
+		var msg invalidationMessage
+		select {
+		case key, ok := <-ch:
+			if !ok {
+				// Either the standby fell behind or this node is stepping
+				// down; either way the standby has to start over
+				if c.logger.IsDebug() {
+					c.logger.Debug("core: closing invalidation stream", "remote_address", r.RemoteAddr)
+				}
+				return
+			}
+
+			// Batch up whatever else is already queued
+			msg.Keys = append(msg.Keys, key)
+		BATCH:
+			for {
+				select {
+				case key, ok := <-ch:
+					if !ok {
+						break BATCH
+					}
+					msg.Keys = append(msg.Keys, key)
+				default:
+					break BATCH
+				}
+			}
+
+		case <-heartbeat.C:
+
+		case <-r.Context().Done():
+			return
+		}
+
+		if err := enc.Encode(&msg); err != nil {
+			return
+		}
+		flusher.Flush()
+	}
+}
+
+// runPerfStandby is a long running routine used by a performance standby. It
+// keeps an invalidation stream open to the active node, loads the state
+// needed to serve requests locally once the stream is up, and applies
+// invalidations to it. The state is torn down whenever the stream is lost.
+func (c *Core) runPerfStandby(doneCh, stopCh chan struct{}) {
+	defer close(doneCh)
+	c.logger.Info("core: starting performance standby")
+
+	c.perfStandbyBackend.setReadOnly(true)
+	defer func() {
+		c.perfStandbyLock.Lock()
+		c.teardownPerfStandby()
+		c.perfStandbyLock.Unlock()
+		c.perfStandbyBackend.setReadOnly(false)
+		c.logger.Info("core: stopped performance standby")
+	}()
+
+	for {
+		err := c.perfStandbyStream(stopCh)
+
+		c.perfStandbyLock.Lock()
+		c.teardownPerfStandby()
+		c.perfStandbyLock.Unlock()
+
+		select {
+		case <-stopCh:
+			return
+		default:
+		}
+
+		if err != nil {
+			c.logger.Warn("core: performance standby lost connection to active node", "error", err)
+		}
+
+		select {
+		case <-stopCh:
+			return
+		case <-time.After(perfStandbyRetryInterval):
+		}
+	}
+}
+
+// perfStandbyStream connects to the invalidation stream of the active node
+// and processes it until it ends or stopCh is closed
+func (c *Core) perfStandbyStream(stopCh chan struct{}) error {
+	clusterAddr, err := c.activeClusterAddr()
+	if err != nil {
+		return err
+	}
+	if clusterAddr == "" {
+		return errors.New("no active node cluster address known")
+	}
+
+	tlsConfig, err := c.ClusterTLSConfig()
+	if err != nil {
+		return err
+	}
+	tp := &http2.Transport{
+		TLSClientConfig: tlsConfig,
+	}
+	defer tp.CloseIdleConnections()
+
+	req, err := http.NewRequest("GET", clusterAddr+perfStandbyInvalidationPath, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := tp.RoundTrip(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status code %d from active node", resp.StatusCode)
+	}
+
+	// Closing the body unblocks the decoder below, both on shutdown and when
+	// the active node stops sending heartbeats
+	streamDoneCh := make(chan struct{})
+	defer close(streamDoneCh)
+	go func() {
+		select {
+		case <-stopCh:
+			resp.Body.Close()
+		case <-streamDoneCh:
+		}
+	}()
+	watchdog := time.AfterFunc(3*perfStandbyHeartbeatInterval, func() {
+		resp.Body.Close()
+	})
+	defer watchdog.Stop()
+
+	// Changes are now being streamed to us, so load up a fresh copy of the
+	// state needed to serve requests
+	if err := c.setupPerfStandby(); err != nil {
+		return err
+	}
+
+	dec := json.NewDecoder(resp.Body)
+	for {
+		var msg invalidationMessage
+		if err := dec.Decode(&msg); err != nil {
+			return err
+		}
+		watchdog.Reset(3 * perfStandbyHeartbeatInterval)
+
+		if len(msg.Keys) == 0 {
+			continue
+		}
+		if err := c.perfStandbyInvalidate(msg.Keys); err != nil {
+			return err
+		}
+	}
+}
+
+// activeClusterAddr returns the cluster address advertised by the current
+// active node, loading the cluster TLS parameters it advertises along the
+// way. Unlike Leader it does not take the state lock.
+func (c *Core) activeClusterAddr() (string, error) {
+	lock, err := c.ha.LockWith(CoreLockPath, "read")
+	if err != nil {
+		return "", err
+	}
+	held, leaderUUID, err := lock.Value()
+	if err != nil {
+		return "", err
+	}
+	if !held {
+		return "", nil
+	}
+
+	entry, err := c.barrier.Get(coreLeaderPrefix + leaderUUID)
+	if err != nil {
+		return "", err
+	}
+	if entry == nil {
+		return "", nil
+	}
+
+	var adv activeAdvertisement
+	if err := jsonutil.DecodeJSON(entry.Value, &adv); err != nil {
+		// Older active nodes only advertise a redirect address
+		return "", nil
+	}
+	if err := c.loadClusterTLS(adv); err != nil {
+		return "", err
+	}
+	return adv.ClusterAddr, nil
+}
+
+// setupPerfStandby loads the read-only state a performance standby needs to
+// serve requests, replacing any state that was loaded before
+func (c *Core) setupPerfStandby() (retErr error) {
+	c.perfStandbyLock.Lock()
+	defer c.perfStandbyLock.Unlock()
+
+	c.teardownPerfStandby()
+	defer func() {
+		if retErr != nil {
+			c.teardownPerfStandby()
+		}
+	}()
+
+	if err := c.checkKeyUpgrades(); err != nil {
+		return err
+	}
+	if err := c.barrier.ReloadMasterKey(); err != nil {
+		return err
+	}
+	if err := c.barrier.ReloadKeyring(); err != nil {
+		return err
+	}
+	if err := c.loadMounts(); err != nil {
+		return err
+	}
+	if err := c.setupMounts(); err != nil {
+		return err
+	}
+	if err := c.setupPolicyStore(); err != nil {
+		return err
+	}
+	if err := c.loadCredentials(); err != nil {
+		return err
+	}
+	if err := c.setupCredentials(); err != nil {
+		return err
+	}
+	if err := c.loadNamespaces(); err != nil {
+		return err
+	}
+	if err := c.setupNamespaces(); err != nil {
+		return err
+	}
+	if err := c.loadAudits(); err != nil {
+		return err
+	}
+	if err := c.setupAudits(); err != nil {
+		return err
+	}
+	if err := c.setupQuotas(); err != nil {
+		return err
+	}
+
+	c.perfStandbyReady = true
+	c.logger.Info("core: performance standby ready to serve requests")
+	return nil
+}
+
+// teardownPerfStandby reverses setupPerfStandby. The performance standby
+// lock must be held.
+func (c *Core) teardownPerfStandby() {
+	c.perfStandbyReady = false
+
+	c.teardownQuotas()
+	if err := c.teardownAudits(); err != nil {
+		c.logger.Error("core: error tearing down performance standby audits", "error", err)
+	}
+	if err := c.teardownNamespaces(); err != nil {
+		c.logger.Error("core: error tearing down performance standby namespaces", "error", err)
+	}
+	if err := c.teardownCredentials(); err != nil {
+		c.logger.Error("core: error tearing down performance standby credentials", "error", err)
+	}
+	if err := c.teardownPolicyStore(); err != nil {
+		c.logger.Error("core: error tearing down performance standby policy store", "error", err)
+	}
+	if err := c.unloadMounts(); err != nil {
+		c.logger.Error("core: error unloading performance standby mounts", "error", err)
+	}
+	if cache, ok := c.physical.(physical.Purgable); ok {
+		cache.Purge()
+	}
+}
+
+// perfStandbyInvalidate applies a set of keys modified on the active node
+func (c *Core) perfStandbyInvalidate(keys []string) error {
+	var reload bool
+
+	c.perfStandbyLock.RLock()
+	for _, key := range keys {
+		if cache, ok := c.physical.(physical.Invalidatable); ok {
+			cache.Invalidate(key)
+		}
+
+		var err error
+		switch {
+		case key == coreMountConfigPath, key == coreAuthConfigPath, key == coreAuditConfigPath, key == coreNamespaceConfigPath:
+			reload = true
+		case key == masterKeyPath:
+			err = c.barrier.ReloadMasterKey()
+		case key == keyringPath:
+			err = c.barrier.ReloadKeyring()
+		case strings.HasPrefix(key, keyringUpgradePrefix):
+			err = c.checkKeyUpgrades()
+		case strings.HasPrefix(key, systemBarrierPrefix+policySubPath):
+			if c.policyStore != nil {
+				c.policyStore.invalidate(strings.TrimPrefix(key, systemBarrierPrefix+policySubPath))
+			}
+		case strings.HasPrefix(key, namespaceBarrierPrefix) && strings.Contains(key, "/"+systemBarrierPrefix+policySubPath):
+			// The key is namespaces/<id>/sys/policy/<name>
+			parts := strings.SplitN(strings.TrimPrefix(key, namespaceBarrierPrefix), "/"+systemBarrierPrefix+policySubPath, 2)
+			if ps := c.namespacePolicyStore(parts[0]); ps != nil && parts[0] != "" {
+				ps.invalidate(parts[1])
+			}
+		case strings.HasPrefix(key, systemBarrierPrefix+quotaRateLimitSubPath):
+			err = c.rateLimitQuotas.invalidate(strings.TrimPrefix(key, systemBarrierPrefix+quotaRateLimitSubPath))
+		}
+		if err != nil {
+			c.perfStandbyLock.RUnlock()
+			return err
+		}
+
+		if c.perfStandbyReady {
+			c.router.InvalidateKey(key)
+		}
+	}
+	c.perfStandbyLock.RUnlock()
+
+	// A change to one of the tables means mounts may have come or gone, so
+	// the simplest correct thing is to load everything again
+	if reload {
+		if c.logger.IsDebug() {
+			c.logger.Debug("core: reloading performance standby state after table change")
+		}
+		return c.setupPerfStandby()
+	}
+	return nil
+}
@@ -0,0 +1,324 @@
+package vault
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/errwrap"
+	"github.com/hashicorp/go-multierror"
+	"github.com/hashicorp/vault/helper/logformat"
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/physical"
+	log "github.com/mgutz/logxi/v1"
+)
+
+func TestPerfStandbyBackend(t *testing.T) {
+	logger := logformat.NewVaultLogger(log.LevelTrace)
+	inm := physical.NewInmem(logger)
+	psb := newPerfStandbyBackend(inm)
+
+	ch := psb.broker.subscribe()
+	defer psb.broker.unsubscribe(ch)
+
+	// Writes are published
+	if err := psb.Put(&physical.Entry{Key: "foo", Value: []byte("bar")}); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if err := psb.Delete("foo"); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	err := psb.Transaction([]physical.TxnEntry{
+		physical.TxnEntry{
+			Operation: physical.PutOperation,
+			Entry:     &physical.Entry{Key: "zip", Value: []byte("zap")},
+		},
+		physical.TxnEntry{
+			Operation: physical.DeleteOperation,
+			Entry:     &physical.Entry{Key: "foo"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	var keys []string
+	for i := 0; i < 4; i++ {
+		select {
+		case key := <-ch:
+			keys = append(keys, key)
+		case <-time.After(time.Second):
+			t.Fatalf("timed out waiting for invalidation")
+		}
+	}
+	if !reflect.DeepEqual(keys, []string{"foo", "foo", "zip", "foo"}) {
+		t.Fatalf("bad: %v", keys)
+	}
+
+	// Read-only mode rejects writes but still serves reads
+	psb.setReadOnly(true)
+	if err := psb.Put(&physical.Entry{Key: "foo", Value: []byte("bar")}); err != logical.ErrReadOnly {
+		t.Fatalf("bad: %v", err)
+	}
+	if err := psb.Delete("zip"); err != logical.ErrReadOnly {
+		t.Fatalf("bad: %v", err)
+	}
+	out, err := psb.Get("zip")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if out == nil || string(out.Value) != "zap" {
+		t.Fatalf("bad: %#v", out)
+	}
+	select {
+	case key := <-ch:
+		t.Fatalf("unexpected invalidation: %s", key)
+	default:
+	}
+}
+
+func TestInvalidationBroker_SlowSubscriber(t *testing.T) {
+	b := newInvalidationBroker()
+	slow := b.subscribe()
+
+	for i := 0; i <= invalidationBufferSize; i++ {
+		b.publish("foo")
+	}
+
+	// Drain what was buffered; the channel must then be closed
+	for i := 0; i < invalidationBufferSize; i++ {
+		<-slow
+	}
+	if _, ok := <-slow; ok {
+		t.Fatalf("expected slow subscriber to be closed")
+	}
+
+	// Unsubscribing afterwards is harmless
+	b.unsubscribe(slow)
+}
+
+func TestCluster_PerformanceStandby(t *testing.T) {
+	handlers := []http.Handler{http.NewServeMux(), http.NewServeMux(), http.NewServeMux()}
+	cores := TestCluster(t, handlers, &CoreConfig{PerformanceStandby: true}, true)
+	for _, core := range cores {
+		defer core.CloseListeners()
+	}
+	active, standby := cores[0], cores[1]
+	root := active.Root
+
+	TestWaitActive(t, active.Core)
+	if active.PerformanceStandby() {
+		t.Fatalf("active node should not be a performance standby")
+	}
+	waitPerfStandby(t, standby.Core)
+
+	// Write on the active node and read it back on the standby
+	req := &logical.Request{
+		Operation:   logical.UpdateOperation,
+		Path:        "secret/foo",
+		ClientToken: root,
+		Data: map[string]interface{}{
+			"value": "bar",
+		},
+	}
+	if _, err := active.HandleRequest(req); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	req = &logical.Request{
+		Operation:   logical.ReadOperation,
+		Path:        "secret/foo",
+		ClientToken: root,
+	}
+	resp, err := standby.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if resp == nil || resp.Data["value"] != "bar" {
+		t.Fatalf("bad: %#v", resp)
+	}
+
+	// Writes must be forwarded
+	req = &logical.Request{
+		Operation:   logical.UpdateOperation,
+		Path:        "secret/foo",
+		ClientToken: root,
+		Data: map[string]interface{}{
+			"value": "baz",
+		},
+	}
+	if _, err := standby.HandleRequest(req); err != ErrStandby {
+		t.Fatalf("expected standby error, got: %v", err)
+	}
+
+	// So must anything not marked as safe for a performance standby
+	req = &logical.Request{
+		Operation:   logical.UpdateOperation,
+		Path:        "auth/token/create",
+		ClientToken: root,
+	}
+	if _, err := standby.HandleRequest(req); err != ErrStandby {
+		t.Fatalf("expected standby error, got: %v", err)
+	}
+
+	// Cache a policy on the standby, change it on the active node, and
+	// ensure the standby picks up the change
+	policyReq := func(core *Core, op logical.Operation, rules string) *logical.Response {
+		req := &logical.Request{
+			Operation:   op,
+			Path:        "sys/policy/foo",
+			ClientToken: root,
+		}
+		if rules != "" {
+			req.Data = map[string]interface{}{
+				"rules": rules,
+			}
+		}
+		resp, err := core.HandleRequest(req)
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		return resp
+	}
+	policyReq(active.Core, logical.UpdateOperation, `path "secret/foo" { policy = "read" }`)
+	policyReq(standby.Core, logical.ReadOperation, "")
+	policyReq(active.Core, logical.UpdateOperation, `path "secret/bar" { policy = "read" }`)
+
+	start := time.Now()
+	for {
+		resp := policyReq(standby.Core, logical.ReadOperation, "")
+		if resp.Data["rules"] == `path "secret/bar" { policy = "read" }` {
+			break
+		}
+		if time.Since(start) > 5*time.Second {
+			t.Fatalf("standby did not pick up policy change: %#v", resp)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	// Mounts made on the active node show up on the standby
+	req = &logical.Request{
+		Operation:   logical.UpdateOperation,
+		Path:        "sys/mounts/kv",
+		ClientToken: root,
+		Data: map[string]interface{}{
+			"type": "generic",
+		},
+	}
+	if _, err := active.HandleRequest(req); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	req = &logical.Request{
+		Operation:   logical.UpdateOperation,
+		Path:        "kv/foo",
+		ClientToken: root,
+		Data: map[string]interface{}{
+			"value": "zip",
+		},
+	}
+	if _, err := active.HandleRequest(req); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	start = time.Now()
+	for {
+		waitPerfStandby(t, standby.Core)
+		resp, err := standby.HandleRequest(&logical.Request{
+			Operation:   logical.ReadOperation,
+			Path:        "kv/foo",
+			ClientToken: root,
+		})
+		if err == nil && resp != nil && resp.Data["value"] == "zip" {
+			break
+		}
+		if time.Since(start) > 5*time.Second {
+			t.Fatalf("standby did not pick up new mount: %#v %v", resp, err)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+func TestCluster_PerformanceStandby_TokenUpgrade(t *testing.T) {
+	handlers := []http.Handler{http.NewServeMux(), http.NewServeMux(), http.NewServeMux()}
+	cores := TestCluster(t, handlers, &CoreConfig{PerformanceStandby: true}, true)
+	for _, core := range cores {
+		defer core.CloseListeners()
+	}
+	active, standby := cores[0], cores[1]
+
+	TestWaitActive(t, active.Core)
+	waitPerfStandby(t, standby.Core)
+
+	// Store a token that still uses a deprecated field, so looking it up
+	// needs to upgrade the entry
+	te := &TokenEntry{
+		ID:                    "deprecated",
+		Path:                  "auth/token/create",
+		Policies:              []string{"default"},
+		DisplayNameDeprecated: "old",
+		CreationTime:          time.Now().Unix(),
+	}
+	enc, err := json.Marshal(te)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	le := &logical.StorageEntry{
+		Key:   lookupPrefix + active.tokenStore.SaltID(te.ID),
+		Value: enc,
+	}
+	if err := active.tokenStore.view.Put(le); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	// The standby can't persist the upgrade but still serves the lookup
+	out, err := standby.tokenStore.Lookup(te.ID)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if out == nil || out.DisplayName != "old" {
+		t.Fatalf("bad: %#v", out)
+	}
+
+	raw, err := standby.tokenStore.view.Get(le.Key)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if raw == nil || string(raw.Value) != string(enc) {
+		t.Fatalf("standby modified the entry: %#v", raw)
+	}
+}
+
+func waitPerfStandby(t *testing.T, core *Core) {
+	start := time.Now()
+	for !core.PerformanceStandby() {
+		if time.Since(start) > 10*time.Second {
+			t.Fatalf("core did not become a performance standby")
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+func TestPerfStandbyNeedsForward(t *testing.T) {
+	cases := []struct {
+		err      error
+		expected bool
+	}{
+		{nil, false},
+		{ErrStandby, true},
+		{logical.ErrReadOnly, true},
+		{errwrap.Wrapf("failed to write: {{err}}", logical.ErrReadOnly), true},
+		{multierror.Append(nil, logical.ErrReadOnly), true},
+		// Only the errors themselves count, not text that looks like them
+		{fmt.Errorf("backend said: %v", logical.ErrReadOnly), false},
+		{errors.New(ErrStandby.Error() + "!"), false},
+	}
+	for i, tc := range cases {
+		if actual := perfStandbyNeedsForward(tc.err); actual != tc.expected {
+			t.Fatalf("case %d: %v: expected %v, got %v", i, tc.err, tc.expected, actual)
+		}
+	}
+}
@@ -3,10 +3,12 @@ package vault
 import (
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/hashicorp/go-multierror"
 	"github.com/hashicorp/hcl"
 	"github.com/hashicorp/hcl/hcl/ast"
+	"github.com/hashicorp/vault/helper/duration"
 )
 
 const (
@@ -63,6 +65,24 @@ type PathCapabilities struct {
 	Capabilities       []string
 	CapabilitiesBitmap uint32 `hcl:"-"`
 	Glob               bool
+	ControlGroup       *ControlGroup `hcl:"-"`
+}
+
+// ControlGroup requires requests on a path to be authorized by other tokens
+// before their response, which is returned wrapped, can be unwrapped
+type ControlGroup struct {
+	// TTL is the TTL of the wrapping token, and so the time the request has
+	// to be authorized and unwrapped
+	TTL     time.Duration
+	Factors []*ControlGroupFactor
+}
+
+// ControlGroupFactor is satisfied once the given number of distinct tokens
+// holding one of its policies have authorized a request
+type ControlGroupFactor struct {
+	Name      string   `hcl:"-" json:"name"`
+	Policies  []string `hcl:"policies" json:"policies"`
+	Approvals int      `hcl:"approvals" json:"approvals"`
 }
 
 // Parse is used to parse the specified ACL rules into an
@@ -117,6 +137,7 @@ func parsePaths(result *Policy, list *ast.ObjectList) error {
 		valid := []string{
 			"policy",
 			"capabilities",
+			"control_group",
 		}
 		if err := checkHCLKeys(item.Val, valid); err != nil {
 			return multierror.Prefix(err, fmt.Sprintf("path %q:", key))
@@ -173,6 +194,14 @@ func parsePaths(result *Policy, list *ast.ObjectList) error {
 
 	PathFinished:
 
+		if o := item.Val.(*ast.ObjectType).List.Filter("control_group"); len(o.Items) > 0 {
+			cg, err := parseControlGroup(o.Items[0])
+			if err != nil {
+				return multierror.Prefix(err, fmt.Sprintf("path %q: control_group:", key))
+			}
+			pc.ControlGroup = cg
+		}
+
 		paths = append(paths, &pc)
 	}
 
@@ -180,6 +209,71 @@ func parsePaths(result *Policy, list *ast.ObjectList) error {
 	return nil
 }
 
+func parseControlGroup(item *ast.ObjectItem) (*ControlGroup, error) {
+	if _, ok := item.Val.(*ast.ObjectType); !ok {
+		return nil, fmt.Errorf("must be an object")
+	}
+
+	valid := []string{
+		"ttl",
+		"factor",
+	}
+	if err := checkHCLKeys(item.Val, valid); err != nil {
+		return nil, err
+	}
+
+	var raw struct {
+		TTL string `hcl:"ttl"`
+	}
+	if err := hcl.DecodeObject(&raw, item.Val); err != nil {
+		return nil, err
+	}
+
+	var cg ControlGroup
+	if raw.TTL != "" {
+		ttl, err := duration.ParseDurationSecond(raw.TTL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid ttl: %v", err)
+		}
+		cg.TTL = ttl
+	}
+
+	for _, factorItem := range item.Val.(*ast.ObjectType).List.Filter("factor").Items {
+		if len(factorItem.Keys) == 0 {
+			return nil, fmt.Errorf("factor must be named")
+		}
+		name := factorItem.Keys[0].Token.Value().(string)
+
+		valid := []string{
+			"policies",
+			"approvals",
+		}
+		if err := checkHCLKeys(factorItem.Val, valid); err != nil {
+			return nil, multierror.Prefix(err, fmt.Sprintf("factor %q:", name))
+		}
+
+		factor := ControlGroupFactor{
+			Name:      name,
+			Approvals: 1,
+		}
+		if err := hcl.DecodeObject(&factor, factorItem.Val); err != nil {
+			return nil, multierror.Prefix(err, fmt.Sprintf("factor %q:", name))
+		}
+		if len(factor.Policies) == 0 {
+			return nil, fmt.Errorf("factor %q: no policies given", name)
+		}
+		if factor.Approvals < 1 {
+			return nil, fmt.Errorf("factor %q: approvals must be at least 1", name)
+		}
+		cg.Factors = append(cg.Factors, &factor)
+	}
+	if len(cg.Factors) == 0 {
+		return nil, fmt.Errorf("no factors given")
+	}
+
+	return &cg, nil
+}
+
 func checkHCLKeys(node ast.Node, valid []string) error {
 	var list *ast.ObjectList
 	switch n := node.(type) {
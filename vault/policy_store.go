@@ -90,6 +90,11 @@ path "sys/wrapping/lookup" {
 path "sys/wrapping/unwrap" {
     capabilities = ["update"]
 }
+
+# Allow a token to check the status of a control group request
+path "sys/control-group/request" {
+    capabilities = ["update"]
+}
 `
 )
 
@@ -108,6 +113,11 @@ var (
 type PolicyStore struct {
 	view *BarrierView
 	lru  *lru.TwoQueueCache
+
+	// pathPrefix is set for the policy store of a namespace. The paths in
+	// its policies are relative to the namespace, so they cannot grant
+	// anything outside of it.
+	pathPrefix string
 }
 
 // PolicyEntry is used to store a policy by name
@@ -216,8 +226,8 @@ func (ps *PolicyStore) GetPolicy(name string) (*Policy, error) {
 		}
 	}
 
-	// Special case the root policy
-	if name == "root" {
+	// Special case the root policy, which does not exist in a namespace
+	if name == "root" && ps.pathPrefix == "" {
 		p := &Policy{Name: "root"}
 		if ps.lru != nil {
 			ps.lru.Add(p.Name, p)
@@ -270,6 +280,14 @@ func (ps *PolicyStore) GetPolicy(name string) (*Policy, error) {
 	return policy, nil
 }
 
+// invalidate is used to drop a policy from the cache after it has been
+// modified by another node
+func (ps *PolicyStore) invalidate(name string) {
+	if ps.lru != nil {
+		ps.lru.Remove(name)
+	}
+}
+
 // ListPolicies is used to list the available policies
 func (ps *PolicyStore) ListPolicies() ([]string, error) {
 	defer metrics.MeasureSince([]string{"policy", "list_policies"}, time.Now())
@@ -326,7 +344,7 @@ func (ps *PolicyStore) ACL(names ...string) (*ACL, error) {
 		if err != nil {
 			return nil, fmt.Errorf("failed to get policy '%s': %v", name, err)
 		}
-		policy = append(policy, p)
+		policy = append(policy, ps.scopePolicy(p))
 	}
 
 	// Construct the ACL
@@ -337,6 +355,25 @@ func (ps *PolicyStore) ACL(names ...string) (*ACL, error) {
 	return acl, nil
 }
 
+// scopePolicy returns the policy with its paths placed under the path prefix
+// of the store
+func (ps *PolicyStore) scopePolicy(p *Policy) *Policy {
+	if p == nil || ps.pathPrefix == "" {
+		return p
+	}
+
+	scoped := &Policy{
+		Name: p.Name,
+		Raw:  p.Raw,
+	}
+	for _, pc := range p.Paths {
+		scopedPC := *pc
+		scopedPC.Prefix = ps.pathPrefix + pc.Prefix
+		scoped.Paths = append(scoped.Paths, &scopedPC)
+	}
+	return scoped
+}
+
 func (ps *PolicyStore) createDefaultPolicy() error {
 	policy, err := Parse(defaultPolicy)
 	if err != nil {
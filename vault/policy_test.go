@@ -1,9 +1,11 @@
 package vault
 
 import (
+	"fmt"
 	"reflect"
 	"strings"
 	"testing"
+	"time"
 )
 
 var rawPolicy = strings.TrimSpace(`
@@ -52,7 +54,7 @@ func TestPolicy_Parse(t *testing.T) {
 		&PathCapabilities{"", "deny",
 			[]string{
 				"deny",
-			}, DenyCapabilityInt, true},
+			}, DenyCapabilityInt, true, nil},
 		&PathCapabilities{"stage/", "sudo",
 			[]string{
 				"create",
@@ -62,22 +64,22 @@ func TestPolicy_Parse(t *testing.T) {
 				"list",
 				"sudo",
 			}, CreateCapabilityInt | ReadCapabilityInt | UpdateCapabilityInt |
-				DeleteCapabilityInt | ListCapabilityInt | SudoCapabilityInt, true},
+				DeleteCapabilityInt | ListCapabilityInt | SudoCapabilityInt, true, nil},
 		&PathCapabilities{"prod/version", "read",
 			[]string{
 				"read",
 				"list",
-			}, ReadCapabilityInt | ListCapabilityInt, false},
+			}, ReadCapabilityInt | ListCapabilityInt, false, nil},
 		&PathCapabilities{"foo/bar", "read",
 			[]string{
 				"read",
 				"list",
-			}, ReadCapabilityInt | ListCapabilityInt, false},
+			}, ReadCapabilityInt | ListCapabilityInt, false, nil},
 		&PathCapabilities{"foo/bar", "",
 			[]string{
 				"create",
 				"sudo",
-			}, CreateCapabilityInt | SudoCapabilityInt, false},
+			}, CreateCapabilityInt | SudoCapabilityInt, false, nil},
 	}
 	if !reflect.DeepEqual(p.Paths, expect) {
 		t.Errorf("expected \n\n%#v\n\n to be \n\n%#v\n\n", p.Paths, expect)
@@ -148,3 +150,71 @@ path "/" {
 		t.Errorf("bad error: %s", err)
 	}
 }
+
+func TestPolicy_ParseControlGroup(t *testing.T) {
+	p, err := Parse(strings.TrimSpace(`
+path "secret/breakglass/*" {
+	capabilities = ["read"]
+	control_group {
+		ttl = "4h"
+		factor "managers" {
+			policies  = ["managers"]
+			approvals = 2
+		}
+		factor "security" {
+			policies = ["security", "admins"]
+		}
+	}
+}
+`))
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	expect := &ControlGroup{
+		TTL: 4 * time.Hour,
+		Factors: []*ControlGroupFactor{
+			&ControlGroupFactor{
+				Name:      "managers",
+				Policies:  []string{"managers"},
+				Approvals: 2,
+			},
+			&ControlGroupFactor{
+				Name:      "security",
+				Policies:  []string{"security", "admins"},
+				Approvals: 1,
+			},
+		},
+	}
+	if len(p.Paths) != 1 || !reflect.DeepEqual(p.Paths[0].ControlGroup, expect) {
+		t.Fatalf("bad: %#v", p.Paths)
+	}
+}
+
+func TestPolicy_ParseBadControlGroup(t *testing.T) {
+	cases := map[string]string{
+		`factor "a" { policies = ["a"] }
+		bad = 1`: "invalid key 'bad'",
+		`ttl = "4h"`:                   "no factors given",
+		`factor "a" { approvals = 2 }`: `factor "a": no policies given`,
+		`factor "a" {
+			policies  = ["a"]
+			approvals = 0
+		}`: `factor "a": approvals must be at least 1`,
+		`ttl = "banana"
+		factor "a" { policies = ["a"] }`: "invalid ttl",
+	}
+	for cg, expected := range cases {
+		_, err := Parse(fmt.Sprintf(`
+path "secret/*" {
+	capabilities = ["read"]
+	control_group {
+		%s
+	}
+}
+`, cg))
+		if err == nil || !strings.Contains(err.Error(), expected) {
+			t.Errorf("%s: expected error containing %q, got %v", cg, expected, err)
+		}
+	}
+}
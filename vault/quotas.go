@@ -0,0 +1,456 @@
+package vault
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/armon/go-metrics"
+	"github.com/hashicorp/vault/helper/jsonutil"
+	"github.com/hashicorp/vault/logical"
+)
+
+const (
+	// quotaRateLimitSubPath is the sub-path of the system view under which
+	// rate limit quotas are stored
+	quotaRateLimitSubPath = "quotas/rate-limit/"
+
+	// quotaPerTokenSweepSize is the number of per-token buckets a quota can
+	// hold before buckets that have filled up again are removed
+	quotaPerTokenSweepSize = 1024
+)
+
+var (
+	// quotaExemptPaths are never rate limited, so that the state of Vault
+	// can always be checked and a quota that is too strict can be fixed
+	quotaExemptPaths = []string{
+		"sys/health",
+		"sys/leader",
+		"sys/seal-status",
+		"sys/unseal",
+		"sys/quotas/",
+	}
+)
+
+// QuotaRequest holds the parts of a request that rate limit quotas are
+// applied to
+type QuotaRequest struct {
+	// Path is the request path, without the API version prefix
+	Path string
+
+	// ClientToken is the token of the request, if any
+	ClientToken string
+
+	// ClientAddress is the remote address of the client
+	ClientAddress string
+}
+
+// rateLimitQuota is a rule limiting the rate of requests using a token
+// bucket. A quota applies to the requests under its path, or to all
+// requests if it has no path, and if it has a role only to requests made
+// with tokens issued for that role by the auth backend mounted at
+// RoleMount. The backend is identified by the UUID of its mount, so that a
+// role of the same name on another backend does not match.
+type rateLimitQuota struct {
+	Name          string        `json:"name"`
+	Path          string        `json:"path"`
+	Role          string        `json:"role"`
+	RoleMount     string        `json:"role_mount"`
+	RoleMountUUID string        `json:"role_mount_uuid"`
+	Rate          int           `json:"rate"`
+	Interval      time.Duration `json:"interval"`
+	Burst         int           `json:"burst"`
+	PerToken      bool          `json:"per_token"`
+
+	lock         sync.Mutex
+	bucket       *tokenBucket
+	tokenBuckets map[string]*tokenBucket
+}
+
+// tokenBucket is the state of a single bucket of a quota
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// refill adds the tokens accrued since the bucket was last used
+func (q *rateLimitQuota) refill(b *tokenBucket, now time.Time) {
+	elapsed := now.Sub(b.last)
+	b.tokens = math.Min(q.burst(), b.tokens+elapsed.Seconds()*q.perSecond())
+	b.last = now
+}
+
+// burst returns the size of the quota's buckets, which is the rate unless a
+// burst was set
+func (q *rateLimitQuota) burst() float64 {
+	if q.Burst == 0 {
+		return float64(q.Rate)
+	}
+	return float64(q.Burst)
+}
+
+// perSecond returns the number of tokens added to a bucket each second
+func (q *rateLimitQuota) perSecond() float64 {
+	return float64(q.Rate) / q.Interval.Seconds()
+}
+
+// bucketFor returns the bucket used for the given client, creating it full
+// if needed. The quota lock must be held.
+func (q *rateLimitQuota) bucketFor(client string, now time.Time) *tokenBucket {
+	if !q.PerToken {
+		if q.bucket == nil {
+			q.bucket = &tokenBucket{tokens: q.burst(), last: now}
+		}
+		return q.bucket
+	}
+
+	if q.tokenBuckets == nil {
+		q.tokenBuckets = make(map[string]*tokenBucket)
+	}
+	b, ok := q.tokenBuckets[client]
+	if !ok {
+		// A full bucket behaves exactly like a missing one, so drop those
+		// rather than growing without bound
+		if len(q.tokenBuckets) >= quotaPerTokenSweepSize {
+			for k, other := range q.tokenBuckets {
+				q.refill(other, now)
+				if other.tokens >= q.burst() {
+					delete(q.tokenBuckets, k)
+				}
+			}
+		}
+		b = &tokenBucket{tokens: q.burst(), last: now}
+		q.tokenBuckets[client] = b
+	}
+	return b
+}
+
+// matchesPath returns whether the quota applies to requests to the path,
+// regardless of their role
+func (q *rateLimitQuota) matchesPath(path string) bool {
+	if q.Path == "" {
+		return true
+	}
+
+	// Quotas stored before paths were normalized may lack the trailing
+	// slash; either way a quota on "pki" must not match "pki2/"
+	prefix := strings.TrimSuffix(q.Path, "/")
+	return path == prefix || strings.HasPrefix(path, prefix+"/")
+}
+
+// matchesRoles returns whether the quota applies to a request made with a
+// token issued for the given roles, as keyed by quotaRoleKey
+func (q *rateLimitQuota) matchesRoles(roles []string) bool {
+	if q.Role == "" {
+		return true
+	}
+	key := quotaRoleKey(q.RoleMountUUID, q.Role)
+	for _, role := range roles {
+		if role == key {
+			return true
+		}
+	}
+	return false
+}
+
+// quotaRoleKey identifies a role by the UUID of the mount of the auth
+// backend it belongs to and its name
+func quotaRoleKey(mountUUID, role string) string {
+	return mountUUID + ":" + role
+}
+
+// rateLimitQuotasByName sorts quotas by name
+type rateLimitQuotasByName []*rateLimitQuota
+
+func (s rateLimitQuotasByName) Len() int           { return len(s) }
+func (s rateLimitQuotasByName) Less(i, j int) bool { return s[i].Name < s[j].Name }
+func (s rateLimitQuotasByName) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+
+// rateLimitQuotaStore holds the rate limit quotas loaded from storage and
+// the state of their buckets. Bucket state is kept in memory only, so each
+// node applies the quotas independently.
+type rateLimitQuotaStore struct {
+	lock   sync.RWMutex
+	view   *BarrierView
+	quotas map[string]*rateLimitQuota
+}
+
+// newRateLimitQuotaStore returns an empty store that applies no quotas
+// until it is loaded
+func newRateLimitQuotaStore() *rateLimitQuotaStore {
+	return &rateLimitQuotaStore{
+		quotas: make(map[string]*rateLimitQuota),
+	}
+}
+
+// load reads all of the quotas from the given view, replacing any quotas
+// and bucket state already held
+func (s *rateLimitQuotaStore) load(view *BarrierView) error {
+	names, err := view.List("")
+	if err != nil {
+		return fmt.Errorf("failed to list rate limit quotas: %v", err)
+	}
+
+	quotas := make(map[string]*rateLimitQuota, len(names))
+	for _, name := range names {
+		quota, err := s.read(view, name)
+		if err != nil {
+			return err
+		}
+		if quota != nil {
+			quotas[name] = quota
+		}
+	}
+
+	s.lock.Lock()
+	s.view = view
+	s.quotas = quotas
+	s.lock.Unlock()
+	return nil
+}
+
+// reset drops all of the quotas, such as when sealing
+func (s *rateLimitQuotaStore) reset() {
+	s.lock.Lock()
+	s.view = nil
+	s.quotas = make(map[string]*rateLimitQuota)
+	s.lock.Unlock()
+}
+
+// read fetches a single quota from storage
+func (s *rateLimitQuotaStore) read(view *BarrierView, name string) (*rateLimitQuota, error) {
+	raw, err := view.Get(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read rate limit quota %q: %v", name, err)
+	}
+	if raw == nil {
+		return nil, nil
+	}
+
+	var quota rateLimitQuota
+	if err := jsonutil.DecodeJSON(raw.Value, &quota); err != nil {
+		return nil, fmt.Errorf("failed to decode rate limit quota %q: %v", name, err)
+	}
+	return &quota, nil
+}
+
+// invalidate reloads a single quota after it was changed on another node
+func (s *rateLimitQuotaStore) invalidate(name string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.view == nil {
+		return nil
+	}
+
+	quota, err := s.read(s.view, name)
+	if err != nil {
+		return err
+	}
+	if quota == nil {
+		delete(s.quotas, name)
+	} else {
+		s.quotas[name] = quota
+	}
+	return nil
+}
+
+// list returns the names of the quotas
+func (s *rateLimitQuotaStore) list() ([]string, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	if s.view == nil {
+		return nil, fmt.Errorf("rate limit quotas are not loaded")
+	}
+
+	names := make([]string, 0, len(s.quotas))
+	for name := range s.quotas {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// get returns the quota with the given name, or nil if there is none
+func (s *rateLimitQuotaStore) get(name string) *rateLimitQuota {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return s.quotas[name]
+}
+
+// set persists the given quota, replacing any existing quota of the same
+// name and so resetting its buckets
+func (s *rateLimitQuotaStore) set(quota *rateLimitQuota) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.view == nil {
+		return fmt.Errorf("rate limit quotas are not loaded")
+	}
+
+	entry, err := logical.StorageEntryJSON(quota.Name, quota)
+	if err != nil {
+		return fmt.Errorf("failed to encode rate limit quota: %v", err)
+	}
+	if err := s.view.Put(entry); err != nil {
+		return fmt.Errorf("failed to persist rate limit quota: %v", err)
+	}
+
+	s.quotas[quota.Name] = quota
+	return nil
+}
+
+// delete removes the quota with the given name
+func (s *rateLimitQuotaStore) delete(name string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.view == nil {
+		return fmt.Errorf("rate limit quotas are not loaded")
+	}
+
+	if err := s.view.Delete(name); err != nil {
+		return fmt.Errorf("failed to delete rate limit quota: %v", err)
+	}
+
+	delete(s.quotas, name)
+	return nil
+}
+
+// allow takes a token from the bucket of every quota that applies to the
+// request. If any of them is empty no tokens are taken, and the time until
+// the request would be allowed is returned. The roles of the request are
+// only looked up if a quota with a role applies to its path.
+func (s *rateLimitQuotaStore) allow(req *QuotaRequest, lookupRoles func() []string) (bool, time.Duration) {
+	for _, exempt := range quotaExemptPaths {
+		if strings.HasPrefix(req.Path, exempt) {
+			return true, 0
+		}
+	}
+
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	if len(s.quotas) == 0 {
+		return true, 0
+	}
+
+	var roles []string
+	var rolesLoaded bool
+	var matched []*rateLimitQuota
+	for _, quota := range s.quotas {
+		if !quota.matchesPath(req.Path) {
+			continue
+		}
+		if quota.Role != "" && !rolesLoaded {
+			roles = lookupRoles()
+			rolesLoaded = true
+		}
+		if quota.matchesRoles(roles) {
+			matched = append(matched, quota)
+		}
+	}
+
+	client := req.ClientToken
+	if client == "" {
+		client = req.ClientAddress
+	}
+
+	// Lock every matching quota so that the check and the take are atomic,
+	// always in the same order
+	sort.Sort(rateLimitQuotasByName(matched))
+	now := time.Now()
+	for _, quota := range matched {
+		quota.lock.Lock()
+		defer quota.lock.Unlock()
+	}
+
+	var retryAfter time.Duration
+	buckets := make([]*tokenBucket, len(matched))
+	for i, quota := range matched {
+		b := quota.bucketFor(client, now)
+		quota.refill(b, now)
+		buckets[i] = b
+
+		if b.tokens < 1 {
+			metrics.IncrCounter([]string{"quota", "rate_limit", quota.Name, "violation"}, 1)
+			wait := time.Duration((1 - b.tokens) / quota.perSecond() * float64(time.Second))
+			if wait > retryAfter {
+				retryAfter = wait
+			}
+		}
+	}
+	if retryAfter > 0 {
+		return false, retryAfter
+	}
+
+	for _, b := range buckets {
+		b.tokens--
+	}
+	return true, 0
+}
+
+// setupQuotas loads the rate limit quotas, and the lease count quotas if
+// this node manages leases
+func (c *Core) setupQuotas() error {
+	if err := c.rateLimitQuotas.load(c.systemBarrierView.SubView(quotaRateLimitSubPath)); err != nil {
+		return err
+	}
+	if c.expiration == nil {
+		return nil
+	}
+	return c.leaseCountQuotas.load(c.systemBarrierView.SubView(quotaLeaseCountSubPath), c.expiration.listLeases)
+}
+
+// teardownQuotas drops the rate limit and lease count quotas
+func (c *Core) teardownQuotas() {
+	c.rateLimitQuotas.reset()
+	c.leaseCountQuotas.reset()
+}
+
+// ApplyRateLimitQuota checks the request against the rate limit quotas. If
+// it is not allowed, the returned duration is how long the client should
+// wait before retrying.
+func (c *Core) ApplyRateLimitQuota(req *QuotaRequest) (bool, time.Duration) {
+	return c.rateLimitQuotas.allow(req, func() []string {
+		if req.ClientToken == "" || c.tokenStore == nil {
+			return nil
+		}
+		te, err := c.tokenStore.Lookup(req.ClientToken)
+		if err != nil || te == nil {
+			return nil
+		}
+		return c.tokenRoles(te)
+	})
+}
+
+// tokenRoles returns the roles a token was issued for, keyed by the mount
+// of the auth backend that issued it: the token store role it was created
+// against, or the role reported by any other auth backend. The metadata of
+// tokens created through the token store is set by their creator, so it is
+// not used for them.
+func (c *Core) tokenRoles(te *TokenEntry) []string {
+	entry := c.router.MatchingMountEntry(te.Path)
+	if entry == nil {
+		return nil
+	}
+
+	if entry.Type == "token" {
+		if te.Role == "" {
+			return nil
+		}
+		return []string{quotaRoleKey(entry.UUID, te.Role)}
+	}
+
+	var roles []string
+	for _, key := range []string{"role", "role_name"} {
+		if role := te.Meta[key]; role != "" {
+			roles = append(roles, quotaRoleKey(entry.UUID, role))
+		}
+	}
+	return roles
+}
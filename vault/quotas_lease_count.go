@@ -0,0 +1,323 @@
+package vault
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/hashicorp/errwrap"
+	"github.com/hashicorp/vault/helper/jsonutil"
+	"github.com/hashicorp/vault/logical"
+)
+
+const (
+	// quotaLeaseCountSubPath is the sub-path of the system view under which
+	// lease count quotas are stored
+	quotaLeaseCountSubPath = "quotas/lease-count/"
+)
+
+var (
+	// ErrLeaseCountQuotaExceeded is returned when a lease cannot be
+	// registered because a lease count quota has been reached
+	ErrLeaseCountQuotaExceeded = errors.New("lease count quota exceeded")
+)
+
+// leaseCountQuota limits the number of leases that can exist under a path.
+// The count itself is not persisted; it is computed from the stored leases
+// when the quota is loaded or created and kept up to date by the expiration
+// manager.
+type leaseCountQuota struct {
+	Name      string `json:"name"`
+	Path      string `json:"path"`
+	MaxLeases int    `json:"max_leases"`
+
+	count int
+}
+
+// matches returns whether the quota applies to the given lease ID
+func (q *leaseCountQuota) matches(leaseID string) bool {
+	return strings.HasPrefix(leaseID, q.Path)
+}
+
+// leaseCountQuotaStore holds the lease count quotas loaded from storage and
+// the number of leases under each of them. It is only loaded on the active
+// node, which is the only node registering and revoking leases.
+//
+// Leases are listed from storage without holding the lock, so that leases
+// can still be registered and revoked meanwhile. Those changes are recorded
+// by every scan in progress and applied to what it listed.
+type leaseCountQuotaStore struct {
+	lock   sync.Mutex
+	view   *BarrierView
+	quotas map[string]*leaseCountQuota
+	scans  map[*leaseCountScan]struct{}
+
+	// listLeases returns the IDs of the leases stored under a prefix
+	listLeases func(prefix string) ([]string, error)
+}
+
+// leaseCountScan records the leases registered and revoked under a prefix
+// while the leases under it are listed
+type leaseCountScan struct {
+	prefix   string
+	acquired map[string]struct{}
+	released map[string]struct{}
+}
+
+// leaseIDs returns the lease IDs listed by the scan, updated with the
+// leases registered and revoked while listing
+func (scan *leaseCountScan) leaseIDs(listed []string) map[string]struct{} {
+	ids := make(map[string]struct{}, len(listed)+len(scan.acquired))
+	for _, id := range listed {
+		ids[id] = struct{}{}
+	}
+	for id := range scan.acquired {
+		ids[id] = struct{}{}
+	}
+	for id := range scan.released {
+		delete(ids, id)
+	}
+	return ids
+}
+
+// newLeaseCountQuotaStore returns an empty store that applies no quotas
+// until it is loaded
+func newLeaseCountQuotaStore() *leaseCountQuotaStore {
+	return &leaseCountQuotaStore{
+		quotas: make(map[string]*leaseCountQuota),
+		scans:  make(map[*leaseCountScan]struct{}),
+	}
+}
+
+// scan lists the IDs of the leases under the prefix. The lock must not be
+// held.
+func (s *leaseCountQuotaStore) scan(prefix string, listLeases func(string) ([]string, error)) (map[string]struct{}, error) {
+	scan := &leaseCountScan{
+		prefix:   prefix,
+		acquired: make(map[string]struct{}),
+		released: make(map[string]struct{}),
+	}
+	s.lock.Lock()
+	s.scans[scan] = struct{}{}
+	s.lock.Unlock()
+
+	listed, err := listLeases(prefix)
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	delete(s.scans, scan)
+	if err != nil {
+		return nil, err
+	}
+	return scan.leaseIDs(listed), nil
+}
+
+// recordScans records a registered or revoked lease in the scans in
+// progress. The lock must be held.
+func (s *leaseCountQuotaStore) recordScans(leaseID string, acquired bool) {
+	for scan := range s.scans {
+		if !strings.HasPrefix(leaseID, scan.prefix) {
+			continue
+		}
+		if acquired {
+			scan.acquired[leaseID] = struct{}{}
+			delete(scan.released, leaseID)
+		} else {
+			scan.released[leaseID] = struct{}{}
+			delete(scan.acquired, leaseID)
+		}
+	}
+}
+
+// countLeaseIDs returns the number of the lease IDs under the prefix
+func countLeaseIDs(ids map[string]struct{}, prefix string) int {
+	count := 0
+	for id := range ids {
+		if strings.HasPrefix(id, prefix) {
+			count++
+		}
+	}
+	return count
+}
+
+// load reads all of the quotas from the given view and counts the leases
+// under each of them, listing the leases once for all of the quotas
+func (s *leaseCountQuotaStore) load(view *BarrierView, listLeases func(string) ([]string, error)) error {
+	names, err := view.List("")
+	if err != nil {
+		return fmt.Errorf("failed to list lease count quotas: %v", err)
+	}
+
+	quotas := make(map[string]*leaseCountQuota, len(names))
+	for _, name := range names {
+		raw, err := view.Get(name)
+		if err != nil {
+			return fmt.Errorf("failed to read lease count quota %q: %v", name, err)
+		}
+		if raw == nil {
+			continue
+		}
+
+		var quota leaseCountQuota
+		if err := jsonutil.DecodeJSON(raw.Value, &quota); err != nil {
+			return fmt.Errorf("failed to decode lease count quota %q: %v", name, err)
+		}
+		quotas[name] = &quota
+	}
+
+	if len(quotas) > 0 {
+		ids, err := s.scan("", listLeases)
+		if err != nil {
+			return fmt.Errorf("failed to count leases of lease count quotas: %v", err)
+		}
+		for _, quota := range quotas {
+			quota.count = countLeaseIDs(ids, quota.Path)
+		}
+	}
+
+	s.lock.Lock()
+	s.view = view
+	s.quotas = quotas
+	s.listLeases = listLeases
+	s.lock.Unlock()
+	return nil
+}
+
+// reset drops all of the quotas, such as when sealing
+func (s *leaseCountQuotaStore) reset() {
+	s.lock.Lock()
+	s.view = nil
+	s.quotas = make(map[string]*leaseCountQuota)
+	s.listLeases = nil
+	s.lock.Unlock()
+}
+
+// list returns the names of the quotas
+func (s *leaseCountQuotaStore) list() ([]string, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.view == nil {
+		return nil, fmt.Errorf("lease count quotas are not loaded")
+	}
+
+	names := make([]string, 0, len(s.quotas))
+	for name := range s.quotas {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// get returns a copy of the quota with the given name, including its
+// current count, or nil if there is none
+func (s *leaseCountQuotaStore) get(name string) *leaseCountQuota {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	quota, ok := s.quotas[name]
+	if !ok {
+		return nil
+	}
+	copied := *quota
+	return &copied
+}
+
+// set persists the given quota, replacing any existing quota of the same
+// name, and counts the leases it applies to
+func (s *leaseCountQuotaStore) set(quota *leaseCountQuota) error {
+	s.lock.Lock()
+	listLeases := s.listLeases
+	s.lock.Unlock()
+	if listLeases == nil {
+		return fmt.Errorf("lease count quotas are not loaded")
+	}
+
+	ids, err := s.scan(quota.Path, listLeases)
+	if err != nil {
+		return fmt.Errorf("failed to count leases: %v", err)
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.view == nil {
+		return fmt.Errorf("lease count quotas are not loaded")
+	}
+
+	entry, err := logical.StorageEntryJSON(quota.Name, quota)
+	if err != nil {
+		return fmt.Errorf("failed to encode lease count quota: %v", err)
+	}
+	if err := s.view.Put(entry); err != nil {
+		return fmt.Errorf("failed to persist lease count quota: %v", err)
+	}
+
+	quota.count = len(ids)
+	s.quotas[quota.Name] = quota
+	return nil
+}
+
+// delete removes the quota with the given name
+func (s *leaseCountQuotaStore) delete(name string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.view == nil {
+		return fmt.Errorf("lease count quotas are not loaded")
+	}
+
+	if err := s.view.Delete(name); err != nil {
+		return fmt.Errorf("failed to delete lease count quota: %v", err)
+	}
+
+	delete(s.quotas, name)
+	return nil
+}
+
+// acquire counts a new lease against every quota that applies to it. If
+// any of them has been reached nothing is counted and an error is returned.
+func (s *leaseCountQuotaStore) acquire(leaseID string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	var matched []*leaseCountQuota
+	for _, quota := range s.quotas {
+		if !quota.matches(leaseID) {
+			continue
+		}
+		if quota.count >= quota.MaxLeases {
+			return errwrap.Wrap(fmt.Errorf("%s: quota %q allows at most %d leases under %q",
+				ErrLeaseCountQuotaExceeded, quota.Name, quota.MaxLeases, quota.Path),
+				ErrLeaseCountQuotaExceeded)
+		}
+		matched = append(matched, quota)
+	}
+
+	for _, quota := range matched {
+		quota.count++
+	}
+	s.recordScans(leaseID, true)
+	return nil
+}
+
+// release stops counting a lease that was revoked or failed to register
+func (s *leaseCountQuotaStore) release(leaseID string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for _, quota := range s.quotas {
+		if quota.matches(leaseID) && quota.count > 0 {
+			quota.count--
+		}
+	}
+	s.recordScans(leaseID, false)
+}
+
+// isLeaseCountQuotaErr returns whether the error was caused by a lease
+// count quota being reached
+func isLeaseCountQuotaErr(err error) bool {
+	return err == ErrLeaseCountQuotaExceeded || errwrap.Contains(err, ErrLeaseCountQuotaExceeded.Error())
+}
@@ -0,0 +1,192 @@
+package vault
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-uuid"
+	"github.com/hashicorp/vault/logical"
+)
+
+func TestLeaseCountQuota(t *testing.T) {
+	c, _, _ := TestCoreUnsealed(t)
+	noop := &NoopBackend{}
+	_, barrier, _ := mockBarrier(t)
+	view := NewBarrierView(barrier, "logical/")
+	meUUID, err := uuid.GenerateUUID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.router.Mount(noop, "prod/aws/", &MountEntry{UUID: meUUID}, view)
+
+	register := func() (string, error) {
+		req := &logical.Request{
+			Operation: logical.ReadOperation,
+			Path:      "prod/aws/foo",
+		}
+		resp := &logical.Response{
+			Secret: &logical.Secret{
+				LeaseOptions: logical.LeaseOptions{
+					TTL: time.Hour,
+				},
+			},
+		}
+		return c.expiration.Register(req, resp)
+	}
+
+	// Leases that exist before the quota is created are counted
+	first, err := register()
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	if err := c.leaseCountQuotas.set(&leaseCountQuota{
+		Name:      "aws",
+		Path:      "prod/aws/",
+		MaxLeases: 2,
+	}); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if count := c.leaseCountQuotas.get("aws").count; count != 1 {
+		t.Fatalf("bad count: %d", count)
+	}
+
+	if _, err := register(); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	_, err = register()
+	if !isLeaseCountQuotaErr(err) {
+		t.Fatalf("expected quota error, got: %v", err)
+	}
+	if count := c.leaseCountQuotas.get("aws").count; count != 2 {
+		t.Fatalf("bad count: %d", count)
+	}
+
+	// The secret of the rejected lease is revoked
+	last := noop.Requests[len(noop.Requests)-1]
+	if last.Operation != logical.RevokeOperation {
+		t.Fatalf("expected revocation, got: %#v", last)
+	}
+
+	// Revoking a lease makes room for another
+	if err := c.expiration.Revoke(first); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if count := c.leaseCountQuotas.get("aws").count; count != 1 {
+		t.Fatalf("bad count: %d", count)
+	}
+	if _, err := register(); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	// Counts are recomputed from storage when the quotas are loaded
+	if err := c.setupQuotas(); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if count := c.leaseCountQuotas.get("aws").count; count != 2 {
+		t.Fatalf("bad count: %d", count)
+	}
+}
+
+func TestLeaseCountQuota_ScanConcurrentChanges(t *testing.T) {
+	_, barrier, _ := mockBarrier(t)
+	s := newLeaseCountQuotaStore()
+	s.view = NewBarrierView(barrier, "")
+
+	// Leases registered and revoked while listing are accounted for,
+	// without holding the lock of the store
+	s.listLeases = func(prefix string) ([]string, error) {
+		if err := s.acquire("prod/aws/new"); err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		s.release("prod/aws/old")
+		s.release("prod/aws/gone")
+		return []string{"prod/aws/old", "prod/aws/kept", "prod/aws/new"}, nil
+	}
+	if err := s.set(&leaseCountQuota{
+		Name:      "aws",
+		Path:      "prod/aws/",
+		MaxLeases: 2,
+	}); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if count := s.get("aws").count; count != 2 {
+		t.Fatalf("bad count: %d", count)
+	}
+	if len(s.scans) != 0 {
+		t.Fatalf("scan was not removed")
+	}
+
+	err := s.acquire("prod/aws/another")
+	if err == nil || !isLeaseCountQuotaErr(err) {
+		t.Fatalf("expected quota error, got: %v", err)
+	}
+	if isLeaseCountQuotaErr(errors.New("lease count quota exceeded elsewhere")) {
+		t.Fatalf("unrelated error matched")
+	}
+}
+
+// failIndexBarrier fails writes to the lease index by token and does not
+// support transactions, so that a lease entry can be written without it
+type failIndexBarrier struct {
+	SecurityBarrier
+}
+
+func (b *failIndexBarrier) Put(entry *Entry) error {
+	if strings.HasPrefix(entry.Key, systemBarrierPrefix+expirationSubPath+tokenViewPrefix) {
+		return errors.New("index write failed")
+	}
+	return b.SecurityBarrier.Put(entry)
+}
+
+func TestLeaseCountQuota_RegisterFailure(t *testing.T) {
+	c, _, _ := TestCoreUnsealed(t)
+	noop := &NoopBackend{}
+	_, barrier, _ := mockBarrier(t)
+	view := NewBarrierView(barrier, "logical/")
+	meUUID, err := uuid.GenerateUUID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.router.Mount(noop, "prod/aws/", &MountEntry{UUID: meUUID}, view)
+
+	if err := c.leaseCountQuotas.set(&leaseCountQuota{
+		Name:      "aws",
+		Path:      "prod/aws/",
+		MaxLeases: 2,
+	}); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	c.expiration.view = NewBarrierView(&failIndexBarrier{c.barrier}, systemBarrierPrefix+expirationSubPath)
+
+	req := &logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "prod/aws/foo",
+	}
+	resp := &logical.Response{
+		Secret: &logical.Secret{
+			LeaseOptions: logical.LeaseOptions{
+				TTL: time.Hour,
+			},
+		},
+	}
+	_, err = c.expiration.Register(req, resp)
+	if err == nil || !strings.Contains(err.Error(), "index write failed") {
+		t.Fatalf("expected index write error, got: %v", err)
+	}
+
+	// The partially written lease is removed and no longer counted
+	leases, err := c.expiration.listLeases("prod/aws/")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if len(leases) != 0 {
+		t.Fatalf("bad: %v", leases)
+	}
+	if count := c.leaseCountQuotas.get("aws").count; count != 0 {
+		t.Fatalf("bad count: %d", count)
+	}
+}
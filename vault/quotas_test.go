@@ -0,0 +1,244 @@
+package vault
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/logical"
+)
+
+func TestRateLimitQuota_Allow(t *testing.T) {
+	c, _, _ := TestCoreUnsealed(t)
+	s := c.rateLimitQuotas
+
+	if err := s.set(&rateLimitQuota{
+		Name:     "pki",
+		Path:     "pki/",
+		Rate:     1,
+		Interval: time.Hour,
+		Burst:    2,
+	}); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	noRoles := func() []string { return nil }
+	req := &QuotaRequest{Path: "pki/issue/foo", ClientAddress: "127.0.0.1"}
+	for i := 0; i < 2; i++ {
+		if ok, _ := s.allow(req, noRoles); !ok {
+			t.Fatalf("request %d should be allowed", i)
+		}
+	}
+	ok, retryAfter := s.allow(req, noRoles)
+	if ok {
+		t.Fatalf("request over the burst should be rejected")
+	}
+	if retryAfter <= 0 || retryAfter > time.Hour {
+		t.Fatalf("bad retry after: %v", retryAfter)
+	}
+
+	// Other paths and exempt paths are not limited
+	if ok, _ := s.allow(&QuotaRequest{Path: "secret/foo"}, noRoles); !ok {
+		t.Fatalf("other path should be allowed")
+	}
+	if err := s.set(&rateLimitQuota{
+		Name:     "global",
+		Rate:     1,
+		Interval: time.Hour,
+		Burst:    1,
+	}); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		if ok, _ := s.allow(&QuotaRequest{Path: "sys/health"}, noRoles); !ok {
+			t.Fatalf("exempt path should be allowed")
+		}
+	}
+}
+
+func TestRateLimitQuota_MatchesPath(t *testing.T) {
+	// "pki" is a quota stored before paths were normalized
+	for _, path := range []string{"pki", "pki/"} {
+		q := &rateLimitQuota{Path: path}
+		for _, p := range []string{"pki", "pki/", "pki/issue/foo"} {
+			if !q.matchesPath(p) {
+				t.Fatalf("quota on %q should match %q", path, p)
+			}
+		}
+		for _, p := range []string{"pki2", "pki2/", "pki2/issue/foo"} {
+			if q.matchesPath(p) {
+				t.Fatalf("quota on %q should not match %q", path, p)
+			}
+		}
+	}
+}
+
+func TestRateLimitQuota_DefaultBurst(t *testing.T) {
+	c, _, _ := TestCoreUnsealed(t)
+	s := c.rateLimitQuotas
+
+	quota := &rateLimitQuota{
+		Name:     "pki",
+		Path:     "pki/",
+		Rate:     2,
+		Interval: time.Hour,
+	}
+	if err := s.set(quota); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	noRoles := func() []string { return nil }
+	req := &QuotaRequest{Path: "pki/issue/foo", ClientAddress: "127.0.0.1"}
+	for i := 0; i < 2; i++ {
+		if ok, _ := s.allow(req, noRoles); !ok {
+			t.Fatalf("request %d should be allowed", i)
+		}
+	}
+	if ok, _ := s.allow(req, noRoles); ok {
+		t.Fatalf("request over the rate should be rejected")
+	}
+
+	// Raising the rate raises the default burst with it
+	quota = &rateLimitQuota{
+		Name:     "pki",
+		Path:     "pki/",
+		Rate:     3,
+		Interval: time.Hour,
+	}
+	if err := s.set(quota); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		if ok, _ := s.allow(req, noRoles); !ok {
+			t.Fatalf("request %d should be allowed", i)
+		}
+	}
+}
+
+func TestRateLimitQuota_PerTokenAndRole(t *testing.T) {
+	c, _, _ := TestCoreUnsealed(t)
+	s := c.rateLimitQuotas
+
+	if err := s.set(&rateLimitQuota{
+		Name:          "role",
+		Path:          "secret/",
+		Role:          "web",
+		RoleMount:     "auth/approle/",
+		RoleMountUUID: "approle-uuid",
+		Rate:          1,
+		Interval:      time.Hour,
+		Burst:         1,
+		PerToken:      true,
+	}); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	web := func() []string { return []string{quotaRoleKey("approle-uuid", "web")} }
+	other := func() []string { return []string{quotaRoleKey("approle-uuid", "db")} }
+	otherMount := func() []string { return []string{quotaRoleKey("userpass-uuid", "web")} }
+
+	if ok, _ := s.allow(&QuotaRequest{Path: "secret/foo", ClientToken: "a"}, web); !ok {
+		t.Fatalf("first request should be allowed")
+	}
+	if ok, _ := s.allow(&QuotaRequest{Path: "secret/foo", ClientToken: "a"}, web); ok {
+		t.Fatalf("second request with the same token should be rejected")
+	}
+	if ok, _ := s.allow(&QuotaRequest{Path: "secret/foo", ClientToken: "b"}, web); !ok {
+		t.Fatalf("request with another token should be allowed")
+	}
+	for i := 0; i < 3; i++ {
+		if ok, _ := s.allow(&QuotaRequest{Path: "secret/foo", ClientToken: "c"}, other); !ok {
+			t.Fatalf("request for another role should be allowed")
+		}
+		if ok, _ := s.allow(&QuotaRequest{Path: "secret/foo", ClientToken: "d"}, otherMount); !ok {
+			t.Fatalf("request for a role of another mount should be allowed")
+		}
+	}
+
+	// Roles are not looked up for paths no role quota applies to
+	lookups := 0
+	counting := func() []string {
+		lookups++
+		return nil
+	}
+	if ok, _ := s.allow(&QuotaRequest{Path: "sys/mounts", ClientToken: "a"}, counting); !ok || lookups != 0 {
+		t.Fatalf("bad: allowed %v, %d lookups", ok, lookups)
+	}
+}
+
+func TestCore_TokenRoles(t *testing.T) {
+	c, _, _ := TestCoreUnsealed(t)
+	c.credentialBackends["noop"] = func(*logical.BackendConfig) (logical.Backend, error) {
+		return &NoopBackend{}, nil
+	}
+	tokenMount := c.router.MatchingMountEntry("auth/token/")
+
+	// Token store roles are keyed by the token store mount
+	te := &TokenEntry{Path: "auth/token/create/web", Role: "web"}
+	if roles := c.tokenRoles(te); !reflect.DeepEqual(roles, []string{quotaRoleKey(tokenMount.UUID, "web")}) {
+		t.Fatalf("bad: %v", roles)
+	}
+
+	// Metadata set by the creator of a token store token is not a role
+	te = &TokenEntry{Path: "auth/token/create", Meta: map[string]string{"role": "web"}}
+	if roles := c.tokenRoles(te); len(roles) != 0 {
+		t.Fatalf("bad: %v", roles)
+	}
+
+	// Other auth backends report the role in the metadata
+	if err := c.enableCredential(&MountEntry{
+		Table: credentialTableType,
+		Path:  "approle/",
+		Type:  "noop",
+	}); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	mount := c.router.MatchingMountEntry("auth/approle/")
+	te = &TokenEntry{Path: "auth/approle/login", Meta: map[string]string{"role_name": "web"}}
+	if roles := c.tokenRoles(te); !reflect.DeepEqual(roles, []string{quotaRoleKey(mount.UUID, "web")}) {
+		t.Fatalf("bad: %v", roles)
+	}
+}
+
+func TestRateLimitQuota_Persist(t *testing.T) {
+	c, _, _ := TestCoreUnsealed(t)
+
+	quota := &rateLimitQuota{
+		Name:     "foo",
+		Path:     "secret/",
+		Rate:     10,
+		Interval: time.Minute,
+		Burst:    20,
+	}
+	if err := c.rateLimitQuotas.set(quota); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	// Reloading from storage, as another node would, sees the quota
+	s := newRateLimitQuotaStore()
+	if err := s.load(c.systemBarrierView.SubView(quotaRateLimitSubPath)); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	names, err := s.list()
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if !reflect.DeepEqual(names, []string{"foo"}) {
+		t.Fatalf("bad: %v", names)
+	}
+	loaded := s.get("foo")
+	if loaded.Path != "secret/" || loaded.Rate != 10 || loaded.Interval != time.Minute || loaded.Burst != 20 {
+		t.Fatalf("bad: %#v", loaded)
+	}
+
+	// Deleting and invalidating removes it
+	if err := c.rateLimitQuotas.delete("foo"); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if err := s.invalidate("foo"); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if s.get("foo") != nil {
+		t.Fatalf("quota should be removed")
+	}
+}
@@ -0,0 +1,1686 @@
+package vault
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	mathrand "math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/net/http2"
+
+	"github.com/hashicorp/go-uuid"
+	"github.com/hashicorp/vault/helper/jsonutil"
+	"github.com/hashicorp/vault/physical"
+)
+
+const (
+	// drPrimaryStatePath is where a DR primary keeps its replication CA and
+	// the secondaries it has issued activation tokens to
+	drPrimaryStatePath = "core/replication/dr/primary"
+
+	// drSecondaryStatePath is where a DR secondary keeps its activation and
+	// stream position. It is stored outside of the barrier, since the
+	// secondary's keyring is replaced by the primary's.
+	drSecondaryStatePath = "core/replication/dr/secondary"
+
+	// drLocalPrefix is the storage prefix that is never replicated
+	drLocalPrefix = "core/replication/"
+
+	// drStreamPath is the path on the cluster port from which secondaries
+	// stream writes
+	drStreamPath = "/replication/dr/stream"
+
+	// drActivatePath is the path on the cluster port where a secondary
+	// exchanges the one-time secret of its activation token for a client
+	// certificate
+	drActivatePath = "/replication/dr/activate"
+
+	// drALPNProto is the protocol DR secondaries negotiate on the cluster
+	// port. It selects the replication TLS parameters instead of the ones
+	// used between members of the same cluster.
+	drALPNProto = "repl_dr_v1"
+
+	// drLogSize is the number of writes a DR primary keeps in memory. A
+	// secondary that falls further behind than this is sent a snapshot.
+	drLogSize = 16384
+
+	// drApplyBatchSize is the maximum number of streamed writes a DR
+	// secondary applies together with a single update of its position. It
+	// leaves room for the position in a Consul transaction.
+	drApplyBatchSize = 63
+
+	DRModeDisabled  = "disabled"
+	DRModePrimary   = "primary"
+	DRModeSecondary = "secondary"
+
+	drMessageSnapshotStart = "snapshot-start"
+	drMessageSnapshotEntry = "snapshot-entry"
+	drMessageSnapshotEnd   = "snapshot-end"
+	drMessageWAL           = "wal"
+	drMessageHeartbeat     = "heartbeat"
+)
+
+var (
+	// drHeartbeatInterval is how often a DR primary writes to an idle
+	// stream. A secondary drops the stream if it hears nothing for three
+	// intervals.
+	drHeartbeatInterval = 10 * time.Second
+
+	// drRetryInterval is how long a DR secondary waits before reconnecting
+	// to the primary after losing the stream
+	drRetryInterval = 5 * time.Second
+
+	// ErrDRSecondary is returned for operations that are not allowed while
+	// this node is a DR secondary
+	ErrDRSecondary = errors.New("operation not allowed on a DR secondary; it must be promoted first")
+
+	// ErrNotDRSecondary is returned when promoting or reindexing a node that
+	// is not a DR secondary
+	ErrNotDRSecondary = errors.New("this node is not a DR secondary")
+
+	// ErrInvalidActivationToken is returned when a DR activation token
+	// cannot be decoded or does not match the one this secondary was
+	// activated with
+	ErrInvalidActivationToken = errors.New("invalid DR activation token")
+)
+
+// isDRLocalKey returns whether a storage key is kept out of DR replication
+func isDRLocalKey(key string) bool {
+	return strings.HasPrefix(key, drLocalPrefix) || key == CoreLockPath
+}
+
+// drLogEntry is a single write recorded by a DR primary
+type drLogEntry struct {
+	Index     uint64
+	Operation physical.Operation
+	Key       string
+	Value     []byte
+}
+
+// drLogBackend wraps the physical backend when HA is enabled. While this
+// cluster is a DR primary it records writes, in the order they were
+// applied, so that they can be streamed to DR secondaries. It sits below
+// the barrier, so everything it records is already encrypted.
+type drLogBackend struct {
+	backend physical.Backend
+
+	// writeLock keeps the order of the log the same as the order in which
+	// writes were applied. It is only taken while the log is enabled.
+	writeLock sync.Mutex
+
+	l        sync.Mutex
+	enabled  uint32
+	epoch    string
+	index    uint64
+	entries  []*drLogEntry
+	notifyCh chan struct{}
+}
+
+func newDRLogBackend(b physical.Backend) *drLogBackend {
+	return &drLogBackend{
+		backend:  b,
+		notifyCh: make(chan struct{}),
+	}
+}
+
+// enable starts a new log. Secondaries streaming from an earlier log are
+// sent a snapshot when they reconnect.
+func (d *drLogBackend) enable() error {
+	epoch, err := uuid.GenerateUUID()
+	if err != nil {
+		return err
+	}
+
+	d.l.Lock()
+	defer d.l.Unlock()
+	d.epoch = epoch
+	d.index = 0
+	d.entries = nil
+	atomic.StoreUint32(&d.enabled, 1)
+	d.notifyLocked()
+	return nil
+}
+
+// disable stops recording and drops the log
+func (d *drLogBackend) disable() {
+	d.l.Lock()
+	defer d.l.Unlock()
+	atomic.StoreUint32(&d.enabled, 0)
+	d.epoch = ""
+	d.index = 0
+	d.entries = nil
+	d.notifyLocked()
+}
+
+// notifyLocked wakes up everything waiting on the log. The lock must be
+// held.
+func (d *drLogBackend) notifyLocked() {
+	close(d.notifyCh)
+	d.notifyCh = make(chan struct{})
+}
+
+// position returns the current epoch and index of the log
+func (d *drLogBackend) position() (string, uint64) {
+	d.l.Lock()
+	defer d.l.Unlock()
+	return d.epoch, d.index
+}
+
+// since returns the writes recorded after the given position along with a
+// channel that is closed on the next write. If the position is no longer
+// covered by the log, false is returned and the caller needs a snapshot.
+func (d *drLogBackend) since(epoch string, index uint64) ([]*drLogEntry, <-chan struct{}, bool) {
+	d.l.Lock()
+	defer d.l.Unlock()
+
+	if atomic.LoadUint32(&d.enabled) == 0 || epoch != d.epoch || index > d.index {
+		return nil, nil, false
+	}
+	if d.index-index > uint64(len(d.entries)) {
+		return nil, nil, false
+	}
+
+	pending := d.entries[len(d.entries)-int(d.index-index):]
+	ret := make([]*drLogEntry, len(pending))
+	copy(ret, pending)
+	return ret, d.notifyCh, true
+}
+
+func (d *drLogBackend) record(op physical.Operation, key string, value []byte) {
+	if isDRLocalKey(key) {
+		return
+	}
+
+	d.l.Lock()
+	defer d.l.Unlock()
+	if atomic.LoadUint32(&d.enabled) == 0 {
+		return
+	}
+
+	var val []byte
+	if value != nil {
+		val = make([]byte, len(value))
+		copy(val, value)
+	}
+
+	d.index++
+	d.entries = append(d.entries, &drLogEntry{
+		Index:     d.index,
+		Operation: op,
+		Key:       key,
+		Value:     val,
+	})
+	if len(d.entries) > 2*drLogSize {
+		d.entries = append([]*drLogEntry(nil), d.entries[len(d.entries)-drLogSize:]...)
+	}
+	d.notifyLocked()
+}
+
+// lockWrites serializes writes while the log is enabled and returns the
+// function that releases them
+func (d *drLogBackend) lockWrites() func() {
+	if atomic.LoadUint32(&d.enabled) == 0 {
+		return func() {}
+	}
+	d.writeLock.Lock()
+	return d.writeLock.Unlock
+}
+
+func (d *drLogBackend) Put(entry *physical.Entry) error {
+	defer d.lockWrites()()
+	if err := d.backend.Put(entry); err != nil {
+		return err
+	}
+	d.record(physical.PutOperation, entry.Key, entry.Value)
+	return nil
+}
+
+func (d *drLogBackend) Get(key string) (*physical.Entry, error) {
+	return d.backend.Get(key)
+}
+
+func (d *drLogBackend) Delete(key string) error {
+	defer d.lockWrites()()
+	if err := d.backend.Delete(key); err != nil {
+		return err
+	}
+	d.record(physical.DeleteOperation, key, nil)
+	return nil
+}
+
+func (d *drLogBackend) List(prefix string) ([]string, error) {
+	return d.backend.List(prefix)
+}
+
+func (d *drLogBackend) Transaction(txns []physical.TxnEntry) error {
+	txnBackend, ok := d.backend.(physical.Transactional)
+	if !ok {
+		return physical.ErrTransactionUnsupported
+	}
+
+	defer d.lockWrites()()
+	if err := txnBackend.Transaction(txns); err != nil {
+		return err
+	}
+	for _, txn := range txns {
+		d.record(txn.Operation, txn.Entry.Key, txn.Entry.Value)
+	}
+	return nil
+}
+
+// Purge passes through to the underlying cache, if any
+func (d *drLogBackend) Purge() {
+	if purgable, ok := d.backend.(physical.Purgable); ok {
+		purgable.Purge()
+	}
+}
+
+// Invalidate passes through to the underlying cache, if any
+func (d *drLogBackend) Invalidate(key string) {
+	if invalidatable, ok := d.backend.(physical.Invalidatable); ok {
+		invalidatable.Invalidate(key)
+	}
+}
+
+// InvalidatePrefix passes through to the underlying cache, if any
+func (d *drLogBackend) InvalidatePrefix(prefix string) {
+	if invalidatable, ok := d.backend.(physical.Invalidatable); ok {
+		invalidatable.InvalidatePrefix(prefix)
+	}
+}
+
+// drWalk calls fn for every key in the backend under the given prefix,
+// skipping keys that are not replicated
+func drWalk(b physical.Backend, prefix string, fn func(key string) error) error {
+	keys, err := b.List(prefix)
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		key = prefix + key
+		if strings.HasSuffix(key, "/") {
+			if err := drWalk(b, key, fn); err != nil {
+				return err
+			}
+			continue
+		}
+		if isDRLocalKey(key) {
+			continue
+		}
+		if err := fn(key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// drPrimaryState is stored in the barrier of a DR primary
+type drPrimaryState struct {
+	CACert      []byte                       `json:"ca_cert"`
+	CAKeyParams *clusterKeyParams            `json:"ca_key_params"`
+	Secondaries map[string]*drSecondaryEntry `json:"secondaries"`
+}
+
+// drSecondaryEntry records a secondary that was issued an activation token
+type drSecondaryEntry struct {
+	ID        string    `json:"id"`
+	IssueTime time.Time `json:"issue_time"`
+
+	// SecretHash is the hash of the one-time secret of the activation token.
+	// It is cleared once the secondary has been issued its certificate.
+	SecretHash string `json:"secret_hash,omitempty"`
+}
+
+// drActivationToken carries what a secondary needs to reach the primary
+// and to obtain a client certificate from it. It is handed out
+// base64-encoded, and holds no private key material.
+type drActivationToken struct {
+	ID                 string `json:"id"`
+	PrimaryClusterAddr string `json:"primary_cluster_addr"`
+	CACert             []byte `json:"ca_cert"`
+	Secret             string `json:"secret"`
+}
+
+// drActivationRequest is sent by a secondary to the primary to exchange the
+// secret of its activation token for a client certificate
+type drActivationRequest struct {
+	ID        string `json:"id"`
+	Secret    string `json:"secret"`
+	PublicKey []byte `json:"public_key"`
+}
+
+// drActivationResponse carries the client certificate issued to a secondary
+type drActivationResponse struct {
+	ClientCert []byte `json:"client_cert"`
+}
+
+// drSecondaryState is stored unencrypted by a DR secondary
+type drSecondaryState struct {
+	ID                 string `json:"id"`
+	PrimaryClusterAddr string `json:"primary_cluster_addr"`
+	CACert             []byte `json:"ca_cert"`
+	ClientCert         []byte `json:"client_cert"`
+
+	// ClientKeyParams is the private key the secondary generated for its
+	// client certificate. It never leaves the secondary.
+	ClientKeyParams *clusterKeyParams `json:"client_key_params"`
+
+	// TokenHash is the hash of the activation token, which is required to
+	// promote or reindex the secondary
+	TokenHash string `json:"token_hash"`
+
+	// Epoch and Index are the position in the primary's log that has been
+	// applied. Epoch is empty until the first snapshot completes.
+	Epoch string `json:"epoch"`
+	Index uint64 `json:"index"`
+}
+
+// drStreamMessage is a single message on the DR stream
+type drStreamMessage struct {
+	Type      string             `json:"type"`
+	Epoch     string             `json:"epoch,omitempty"`
+	Index     uint64             `json:"index,omitempty"`
+	Operation physical.Operation `json:"operation,omitempty"`
+	Key       string             `json:"key,omitempty"`
+	Value     []byte             `json:"value,omitempty"`
+}
+
+func drKeyParams(key *ecdsa.PrivateKey) *clusterKeyParams {
+	return &clusterKeyParams{
+		Type: corePrivateKeyTypeP521,
+		X:    key.X,
+		Y:    key.Y,
+		D:    key.D,
+	}
+}
+
+func drPrivateKey(params *clusterKeyParams) (*ecdsa.PrivateKey, error) {
+	if params == nil || params.X == nil || params.Y == nil || params.D == nil {
+		return nil, fmt.Errorf("missing key parameters")
+	}
+	if params.Type != corePrivateKeyTypeP521 {
+		return nil, fmt.Errorf("unknown key type %q", params.Type)
+	}
+	return &ecdsa.PrivateKey{
+		PublicKey: ecdsa.PublicKey{
+			Curve: elliptic.P521(),
+			X:     params.X,
+			Y:     params.Y,
+		},
+		D: params.D,
+	}, nil
+}
+
+func drTokenHash(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// decodeDRActivationToken parses and sanity checks an activation token
+func decodeDRActivationToken(token string) (*drActivationToken, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(strings.TrimSpace(token))
+	if err != nil {
+		return nil, ErrInvalidActivationToken
+	}
+	var act drActivationToken
+	if err := jsonutil.DecodeJSON(raw, &act); err != nil {
+		return nil, ErrInvalidActivationToken
+	}
+	if act.ID == "" || act.PrimaryClusterAddr == "" || len(act.CACert) == 0 || act.Secret == "" {
+		return nil, ErrInvalidActivationToken
+	}
+	if _, err := x509.ParseCertificate(act.CACert); err != nil {
+		return nil, ErrInvalidActivationToken
+	}
+	return &act, nil
+}
+
+// drClientTLSConfig returns the TLS configuration used to connect to the
+// primary with the given CA certificate. The client key may be nil before
+// the secondary has been issued a certificate.
+func drClientTLSConfig(caCertBytes, clientCert []byte, clientKey *ecdsa.PrivateKey) (*tls.Config, error) {
+	caCert, err := x509.ParseCertificate(caCertBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	pool := x509.NewCertPool()
+	pool.AddCert(caCert)
+	tlsConfig := &tls.Config{
+		RootCAs:    pool,
+		ServerName: caCert.Subject.CommonName,
+		NextProtos: []string{drALPNProto},
+	}
+	if clientKey != nil {
+		tlsConfig.Certificates = []tls.Certificate{
+			tls.Certificate{
+				Certificate: [][]byte{clientCert},
+				PrivateKey:  clientKey,
+			},
+		}
+	}
+	return tlsConfig, nil
+}
+
+// drTransport returns an HTTP/2 transport that connects to the primary with
+// the given TLS configuration
+func drTransport(tlsConfig *tls.Config) *http2.Transport {
+	return &http2.Transport{
+		TLSClientConfig: tlsConfig,
+		DialTLS: func(network, addr string, _ *tls.Config) (net.Conn, error) {
+			dialer := &net.Dialer{
+				Timeout: 10 * time.Second,
+			}
+			return tls.DialWithDialer(dialer, network, addr, tlsConfig)
+		},
+	}
+}
+
+// tlsConfig returns the client TLS configuration used to stream from the
+// primary
+func (s *drSecondaryState) tlsConfig() (*tls.Config, error) {
+	if _, err := x509.ParseCertificate(s.ClientCert); err != nil {
+		return nil, err
+	}
+	key, err := drPrivateKey(s.ClientKeyParams)
+	if err != nil {
+		return nil, err
+	}
+	return drClientTLSConfig(s.CACert, s.ClientCert, key)
+}
+
+// activate sends the public key of the secondary and the one-time secret of
+// the token to the primary, which returns a client certificate for the key
+func (a *drActivationToken) activate(key *ecdsa.PrivateKey) ([]byte, error) {
+	tlsConfig, err := drClientTLSConfig(a.CACert, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	tp := drTransport(tlsConfig)
+	defer tp.CloseIdleConnections()
+
+	pub, err := x509.MarshalPKIXPublicKey(key.Public())
+	if err != nil {
+		return nil, err
+	}
+	body, err := json.Marshal(&drActivationRequest{
+		ID:        a.ID,
+		Secret:    a.Secret,
+		PublicKey: pub,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest("POST", a.PrimaryClusterAddr+drActivatePath, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	resp, err := tp.RoundTrip(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reach the primary: %v", err)
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusForbidden:
+		return nil, ErrInvalidActivationToken
+	default:
+		return nil, fmt.Errorf("unexpected status code %d from primary", resp.StatusCode)
+	}
+
+	var actResp drActivationResponse
+	if err := jsonutil.DecodeJSONFromReader(resp.Body, &actResp); err != nil {
+		return nil, fmt.Errorf("failed to decode activation response: %v", err)
+	}
+	if _, err := x509.ParseCertificate(actResp.ClientCert); err != nil {
+		return nil, fmt.Errorf("primary returned an invalid certificate: %v", err)
+	}
+	return actResp.ClientCert, nil
+}
+
+// drCreateCert creates a certificate for the given key, signed by the
+// parent. A nil parent creates a self-signed CA.
+func drCreateCert(commonName string, pub interface{}, parent *x509.Certificate, signer *ecdsa.PrivateKey) ([]byte, error) {
+	template := &x509.Certificate{
+		Subject: pkix.Name{
+			CommonName: commonName,
+		},
+		DNSNames: []string{commonName},
+		ExtKeyUsage: []x509.ExtKeyUsage{
+			x509.ExtKeyUsageServerAuth,
+			x509.ExtKeyUsageClientAuth,
+		},
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment | x509.KeyUsageKeyAgreement,
+		SerialNumber: big.NewInt(mathrand.Int63()),
+		NotBefore:    time.Now().Add(-30 * time.Second),
+		NotAfter:     time.Now().Add(262980 * time.Hour),
+	}
+	if parent == nil {
+		template.KeyUsage |= x509.KeyUsageCertSign
+		template.BasicConstraintsValid = true
+		template.IsCA = true
+		parent = template
+	}
+	return x509.CreateCertificate(rand.Reader, template, parent, pub, signer)
+}
+
+// loadDRPrimary loads the DR primary state during post-unseal and starts
+// recording writes if this cluster is a DR primary. It also refuses to
+// bring up a node that is a DR secondary.
+func (c *Core) loadDRPrimary() error {
+	c.drLock.RLock()
+	secondary := c.drSecondary != nil
+	c.drLock.RUnlock()
+	if secondary {
+		return ErrDRSecondary
+	}
+
+	if c.drLog == nil {
+		return nil
+	}
+
+	entry, err := c.barrier.Get(drPrimaryStatePath)
+	if err != nil {
+		return fmt.Errorf("failed to read DR primary state: %v", err)
+	}
+	if entry == nil {
+		return nil
+	}
+
+	var state drPrimaryState
+	if err := jsonutil.DecodeJSON(entry.Value, &state); err != nil {
+		return fmt.Errorf("failed to decode DR primary state: %v", err)
+	}
+
+	c.drLock.Lock()
+	defer c.drLock.Unlock()
+	return c.activateDRPrimaryLocked(&state)
+}
+
+// activateDRPrimaryLocked puts the given state in place and starts a new
+// log. The DR lock must be held.
+func (c *Core) activateDRPrimaryLocked(state *drPrimaryState) error {
+	key, err := drPrivateKey(state.CAKeyParams)
+	if err != nil {
+		return fmt.Errorf("failed to load DR CA key: %v", err)
+	}
+	caCert, err := x509.ParseCertificate(state.CACert)
+	if err != nil {
+		return fmt.Errorf("failed to parse DR CA certificate: %v", err)
+	}
+	if state.Secondaries == nil {
+		state.Secondaries = make(map[string]*drSecondaryEntry)
+	}
+	if err := c.drLog.enable(); err != nil {
+		return err
+	}
+
+	c.drPrimary = state
+	c.drPrimaryKey = key
+	c.drPrimaryCACert = caCert
+	c.drStreams = make(map[chan struct{}]string)
+	c.logger.Info("core: DR primary replication active")
+	return nil
+}
+
+// teardownDRPrimary stops recording writes and closes all streams. It is
+// called during pre-seal.
+func (c *Core) teardownDRPrimary() {
+	if c.drLog == nil {
+		return
+	}
+
+	c.drLock.Lock()
+	defer c.drLock.Unlock()
+	if c.drPrimary == nil {
+		return
+	}
+	c.drLog.disable()
+	for ch := range c.drStreams {
+		close(ch)
+	}
+	c.drPrimary = nil
+	c.drPrimaryKey = nil
+	c.drPrimaryCACert = nil
+	c.drStreams = nil
+}
+
+// persistDRPrimaryLocked writes the given DR primary state to the barrier
+func (c *Core) persistDRPrimaryLocked(state *drPrimaryState) error {
+	buf, err := json.Marshal(state)
+	if err != nil {
+		return fmt.Errorf("failed to encode DR primary state: %v", err)
+	}
+	if err := c.barrier.Put(&Entry{
+		Key:   drPrimaryStatePath,
+		Value: buf,
+	}); err != nil {
+		return fmt.Errorf("failed to persist DR primary state: %v", err)
+	}
+	return nil
+}
+
+// enableDRPrimary makes this cluster a DR primary
+func (c *Core) enableDRPrimary() error {
+	if c.drLog == nil || c.clusterAddr == "" {
+		return fmt.Errorf("DR replication requires HA storage and a cluster address")
+	}
+
+	c.drLock.Lock()
+	defer c.drLock.Unlock()
+	if c.drPrimary != nil {
+		return fmt.Errorf("this cluster is already a DR primary")
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P521(), rand.Reader)
+	if err != nil {
+		return fmt.Errorf("failed to generate DR CA key: %v", err)
+	}
+	host, err := uuid.GenerateUUID()
+	if err != nil {
+		return err
+	}
+	caCert, err := drCreateCert(host, key.Public(), nil, key)
+	if err != nil {
+		return fmt.Errorf("failed to generate DR CA certificate: %v", err)
+	}
+
+	state := &drPrimaryState{
+		CACert:      caCert,
+		CAKeyParams: drKeyParams(key),
+		Secondaries: make(map[string]*drSecondaryEntry),
+	}
+	if err := c.persistDRPrimaryLocked(state); err != nil {
+		return err
+	}
+	return c.activateDRPrimaryLocked(state)
+}
+
+// issueDRSecondaryToken returns the activation token for a new secondary.
+// The token carries a one-time secret that the secondary exchanges for a
+// client certificate for a key it generates itself.
+func (c *Core) issueDRSecondaryToken(id string) (string, error) {
+	if id == "" {
+		return "", fmt.Errorf("missing secondary id")
+	}
+
+	c.drLock.Lock()
+	defer c.drLock.Unlock()
+	if c.drPrimary == nil {
+		return "", fmt.Errorf("this cluster is not a DR primary")
+	}
+	if _, ok := c.drPrimary.Secondaries[id]; ok {
+		return "", fmt.Errorf("secondary id %q is already in use", id)
+	}
+
+	secret, err := uuid.GenerateUUID()
+	if err != nil {
+		return "", err
+	}
+	buf, err := json.Marshal(&drActivationToken{
+		ID:                 id,
+		PrimaryClusterAddr: c.clusterAddr,
+		CACert:             c.drPrimary.CACert,
+		Secret:             secret,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	c.drPrimary.Secondaries[id] = &drSecondaryEntry{
+		ID:         id,
+		IssueTime:  time.Now().UTC(),
+		SecretHash: drTokenHash(secret),
+	}
+	if err := c.persistDRPrimaryLocked(c.drPrimary); err != nil {
+		delete(c.drPrimary.Secondaries, id)
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// signDRSecondaryCert issues the client certificate of a secondary in
+// exchange for the one-time secret of its activation token
+func (c *Core) signDRSecondaryCert(id, secret string, pub *ecdsa.PublicKey) ([]byte, error) {
+	c.drLock.Lock()
+	defer c.drLock.Unlock()
+	if c.drPrimary == nil {
+		return nil, fmt.Errorf("this cluster is not a DR primary")
+	}
+
+	entry, ok := c.drPrimary.Secondaries[id]
+	if !ok || entry.SecretHash == "" {
+		return nil, ErrInvalidActivationToken
+	}
+	if subtle.ConstantTimeCompare([]byte(drTokenHash(secret)), []byte(entry.SecretHash)) != 1 {
+		return nil, ErrInvalidActivationToken
+	}
+
+	clientCert, err := drCreateCert(id, pub, c.drPrimaryCACert, c.drPrimaryKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate secondary certificate: %v", err)
+	}
+
+	// The secret can only be used once
+	secretHash := entry.SecretHash
+	entry.SecretHash = ""
+	if err := c.persistDRPrimaryLocked(c.drPrimary); err != nil {
+		entry.SecretHash = secretHash
+		return nil, err
+	}
+	return clientCert, nil
+}
+
+// handleDRActivate is served on the cluster port of a DR primary. It issues
+// a client certificate to a secondary presenting the one-time secret of its
+// activation token.
+func (c *Core) handleDRActivate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req drActivationRequest
+	if err := jsonutil.DecodeJSONFromReader(io.LimitReader(r.Body, 64*1024), &req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	parsed, err := x509.ParsePKIXPublicKey(req.PublicKey)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	pub, ok := parsed.(*ecdsa.PublicKey)
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	clientCert, err := c.signDRSecondaryCert(req.ID, req.Secret, pub)
+	switch {
+	case err == ErrInvalidActivationToken:
+		c.logger.Warn("core: DR secondary presented an invalid activation secret", "secondary_id", req.ID, "remote_address", r.RemoteAddr)
+		w.WriteHeader(http.StatusForbidden)
+		return
+	case err != nil:
+		c.logger.Error("core: failed to activate DR secondary", "secondary_id", req.ID, "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if c.logger.IsInfo() {
+		c.logger.Info("core: DR secondary activated", "secondary_id", req.ID, "remote_address", r.RemoteAddr)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(&drActivationResponse{
+		ClientCert: clientCert,
+	})
+}
+
+// revokeDRSecondary removes a secondary and disconnects it
+func (c *Core) revokeDRSecondary(id string) error {
+	c.drLock.Lock()
+	defer c.drLock.Unlock()
+	if c.drPrimary == nil {
+		return fmt.Errorf("this cluster is not a DR primary")
+	}
+	entry, ok := c.drPrimary.Secondaries[id]
+	if !ok {
+		return nil
+	}
+
+	delete(c.drPrimary.Secondaries, id)
+	if err := c.persistDRPrimaryLocked(c.drPrimary); err != nil {
+		c.drPrimary.Secondaries[id] = entry
+		return err
+	}
+
+	for ch, streamID := range c.drStreams {
+		if streamID == id {
+			close(ch)
+			delete(c.drStreams, ch)
+		}
+	}
+	return nil
+}
+
+// reindexDRPrimary starts a new log, which causes every secondary to
+// receive a fresh snapshot
+func (c *Core) reindexDRPrimary() error {
+	c.drLock.Lock()
+	defer c.drLock.Unlock()
+	if c.drPrimary == nil {
+		return fmt.Errorf("this cluster is not a DR primary")
+	}
+	if err := c.drLog.enable(); err != nil {
+		return err
+	}
+	for ch := range c.drStreams {
+		close(ch)
+	}
+	c.drStreams = make(map[chan struct{}]string)
+	return nil
+}
+
+// drServerTLSConfig returns the TLS configuration the cluster listener uses
+// for connections from DR secondaries
+func (c *Core) drServerTLSConfig() (*tls.Config, error) {
+	c.drLock.RLock()
+	defer c.drLock.RUnlock()
+	if c.drPrimary == nil {
+		return nil, fmt.Errorf("DR replication is not enabled")
+	}
+
+	pool := x509.NewCertPool()
+	pool.AddCert(c.drPrimaryCACert)
+	return &tls.Config{
+		Certificates: []tls.Certificate{
+			tls.Certificate{
+				Certificate: [][]byte{c.drPrimary.CACert},
+				PrivateKey:  c.drPrimaryKey,
+			},
+		},
+		// Secondaries being activated do not have a certificate yet; the
+		// stream itself requires one
+		ClientAuth: tls.VerifyClientCertIfGiven,
+		ClientCAs:  pool,
+		NextProtos: []string{drALPNProto},
+	}, nil
+}
+
+// registerDRStream returns a channel that is closed when the stream for the
+// given secondary has to end, or false if the secondary is not known
+func (c *Core) registerDRStream(id string) (chan struct{}, bool) {
+	c.drLock.Lock()
+	defer c.drLock.Unlock()
+	if c.drPrimary == nil {
+		return nil, false
+	}
+	if _, ok := c.drPrimary.Secondaries[id]; !ok {
+		return nil, false
+	}
+	ch := make(chan struct{})
+	c.drStreams[ch] = id
+	return ch, true
+}
+
+func (c *Core) unregisterDRStream(ch chan struct{}) {
+	c.drLock.Lock()
+	defer c.drLock.Unlock()
+	if _, ok := c.drStreams[ch]; ok {
+		delete(c.drStreams, ch)
+		close(ch)
+	}
+}
+
+// handleDRStream is served on the cluster port of a DR primary. It sends a
+// secondary a snapshot if it is not caught up with the current log and then
+// streams every write as newline-delimited JSON.
+func (c *Core) handleDRStream(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		w.WriteHeader(http.StatusNotImplemented)
+		return
+	}
+	if r.TLS == nil || len(r.TLS.PeerCertificates) == 0 {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	id := r.TLS.PeerCertificates[0].Subject.CommonName
+	stopCh, ok := c.registerDRStream(id)
+	if !ok {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+	defer c.unregisterDRStream(stopCh)
+
+	epoch := r.URL.Query().Get("epoch")
+	index, _ := strconv.ParseUint(r.URL.Query().Get("index"), 10, 64)
+
+	if c.logger.IsInfo() {
+		c.logger.Info("core: DR secondary connected", "secondary_id", id, "remote_address", r.RemoteAddr)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	enc := json.NewEncoder(w)
+	send := func(msg *drStreamMessage) error {
+		if err := enc.Encode(msg); err != nil {
+			return err
+		}
+		flusher.Flush()
+		return nil
+	}
+
+	entries, notifyCh, ok := c.drLog.since(epoch, index)
+	if !ok {
+		var err error
+		epoch, index, err = c.drSendSnapshot(send)
+		if err != nil {
+			c.logger.Error("core: failed to send DR snapshot", "secondary_id", id, "error", err)
+			return
+		}
+		entries, notifyCh, ok = c.drLog.since(epoch, index)
+		if !ok {
+			return
+		}
+	}
+
+	heartbeat := time.NewTicker(drHeartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		for _, entry := range entries {
+			err := send(&drStreamMessage{
+				Type:      drMessageWAL,
+				Epoch:     epoch,
+				Index:     entry.Index,
+				Operation: entry.Operation,
+				Key:       entry.Key,
+				Value:     entry.Value,
+			})
+			if err != nil {
+				return
+			}
+			index = entry.Index
+		}
+
+		select {
+		case <-notifyCh:
+		case <-heartbeat.C:
+			if err := send(&drStreamMessage{Type: drMessageHeartbeat}); err != nil {
+				return
+			}
+		case <-r.Context().Done():
+			return
+		case <-stopCh:
+			return
+		}
+
+		entries, notifyCh, ok = c.drLog.since(epoch, index)
+		if !ok {
+			// The log was restarted; the secondary will get a snapshot
+			// when it reconnects
+			return
+		}
+	}
+}
+
+// drSendSnapshot sends every replicated key in storage, returning the log
+// position that the secondary continues from
+func (c *Core) drSendSnapshot(send func(*drStreamMessage) error) (string, uint64, error) {
+	epoch, index := c.drLog.position()
+	if err := send(&drStreamMessage{Type: drMessageSnapshotStart, Epoch: epoch}); err != nil {
+		return "", 0, err
+	}
+
+	err := drWalk(c.drLog.backend, "", func(key string) error {
+		entry, err := c.drLog.backend.Get(key)
+		if err != nil {
+			return err
+		}
+		if entry == nil {
+			return nil
+		}
+		return send(&drStreamMessage{
+			Type:  drMessageSnapshotEntry,
+			Key:   entry.Key,
+			Value: entry.Value,
+		})
+	})
+	if err != nil {
+		return "", 0, err
+	}
+
+	if err := send(&drStreamMessage{Type: drMessageSnapshotEnd, Epoch: epoch, Index: index}); err != nil {
+		return "", 0, err
+	}
+	return epoch, index, nil
+}
+
+// loadDRSecondary returns whether this node is a DR secondary, loading the
+// secondary state from storage if it has not been loaded yet. A DR
+// secondary starts streaming from the primary right away, since that does
+// not require the node to be unsealed.
+func (c *Core) loadDRSecondary() (bool, error) {
+	if c.isDRSecondary() {
+		return true, nil
+	}
+
+	entry, err := c.physical.Get(drSecondaryStatePath)
+	if err != nil {
+		return false, fmt.Errorf("failed to read DR secondary state: %v", err)
+	}
+	if entry == nil {
+		return false, nil
+	}
+
+	var state drSecondaryState
+	if err := jsonutil.DecodeJSON(entry.Value, &state); err != nil {
+		return false, fmt.Errorf("failed to decode DR secondary state: %v", err)
+	}
+
+	c.drLock.Lock()
+	if c.drSecondary == nil {
+		c.drSecondary = &state
+	}
+	c.drLock.Unlock()
+
+	c.startDRSecondary()
+	return true, nil
+}
+
+// persistDRSecondary writes the secondary state to storage, outside of the
+// barrier
+func (c *Core) persistDRSecondary(state *drSecondaryState) error {
+	entry, err := drSecondaryStateEntry(state)
+	if err != nil {
+		return err
+	}
+	if err := c.physical.Put(entry); err != nil {
+		return fmt.Errorf("failed to persist DR secondary state: %v", err)
+	}
+	return nil
+}
+
+// drSecondaryStateEntry encodes the secondary state into the entry it is
+// stored as
+func drSecondaryStateEntry(state *drSecondaryState) (*physical.Entry, error) {
+	buf, err := json.Marshal(state)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode DR secondary state: %v", err)
+	}
+	return &physical.Entry{
+		Key:   drSecondaryStatePath,
+		Value: buf,
+	}, nil
+}
+
+// enableDRSecondary turns this cluster into a DR secondary of the primary
+// that issued the token. The secondary generates its own key and has the
+// primary issue a certificate for it. The node seals itself once the
+// current request has completed and from then on replaces its storage with
+// the primary's.
+func (c *Core) enableDRSecondary(token string) error {
+	act, err := decodeDRActivationToken(token)
+	if err != nil {
+		return err
+	}
+
+	checkLocked := func() error {
+		if c.drPrimary != nil {
+			return fmt.Errorf("this cluster is a DR primary")
+		}
+		if c.drSecondary != nil {
+			return fmt.Errorf("this cluster is already a DR secondary")
+		}
+		return nil
+	}
+	c.drLock.RLock()
+	err = checkLocked()
+	c.drLock.RUnlock()
+	if err != nil {
+		return err
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P521(), rand.Reader)
+	if err != nil {
+		return fmt.Errorf("failed to generate secondary key: %v", err)
+	}
+	clientCert, err := act.activate(key)
+	if err != nil {
+		return err
+	}
+
+	c.drLock.Lock()
+	defer c.drLock.Unlock()
+	if err := checkLocked(); err != nil {
+		return err
+	}
+
+	state := &drSecondaryState{
+		ID:                 act.ID,
+		PrimaryClusterAddr: act.PrimaryClusterAddr,
+		CACert:             act.CACert,
+		ClientCert:         clientCert,
+		ClientKeyParams:    drKeyParams(key),
+		TokenHash:          drTokenHash(token),
+	}
+	if err := c.persistDRSecondary(state); err != nil {
+		return err
+	}
+	c.drSecondary = state
+
+	// Sealing needs the state lock, which is held for reading while the
+	// current request is handled
+	go func() {
+		c.stateLock.Lock()
+		if !c.sealed {
+			if err := c.sealInternal(); err != nil {
+				c.logger.Error("core: failed to seal DR secondary", "error", err)
+			}
+		}
+		c.stateLock.Unlock()
+		c.startDRSecondary()
+	}()
+	return nil
+}
+
+// checkDRSecondaryToken verifies the activation token this secondary was
+// enabled with
+func (c *Core) checkDRSecondaryToken(token string) (*drSecondaryState, error) {
+	c.drLock.RLock()
+	defer c.drLock.RUnlock()
+	if c.drSecondary == nil {
+		return nil, ErrNotDRSecondary
+	}
+	if subtle.ConstantTimeCompare([]byte(drTokenHash(token)), []byte(c.drSecondary.TokenHash)) != 1 {
+		return nil, ErrInvalidActivationToken
+	}
+	state := *c.drSecondary
+	return &state, nil
+}
+
+// PromoteDRSecondary stops replication on a DR secondary. The node stays
+// sealed; its storage now holds the primary's data, so it is unsealed with
+// the primary's unseal keys.
+func (c *Core) PromoteDRSecondary(token string) error {
+	state, err := c.checkDRSecondaryToken(token)
+	if err != nil {
+		return err
+	}
+	if state.Epoch == "" {
+		return fmt.Errorf("cannot promote a DR secondary that has not completed its initial sync")
+	}
+
+	c.stopDRSecondary()
+	if err := c.physical.Delete(drSecondaryStatePath); err != nil {
+		c.startDRSecondary()
+		return fmt.Errorf("failed to clear DR secondary state: %v", err)
+	}
+
+	c.drLock.Lock()
+	c.drSecondary = nil
+	c.drSecondaryStatus = ""
+	c.drLock.Unlock()
+
+	if cache, ok := c.physical.(physical.Purgable); ok {
+		cache.Purge()
+	}
+	c.logger.Info("core: DR secondary promoted; unseal with the primary's keys")
+	return nil
+}
+
+// ReindexDRSecondary makes a DR secondary fetch a fresh snapshot from the
+// primary
+func (c *Core) ReindexDRSecondary(token string) error {
+	if _, err := c.checkDRSecondaryToken(token); err != nil {
+		return err
+	}
+
+	c.stopDRSecondary()
+	defer c.startDRSecondary()
+
+	c.drLock.Lock()
+	defer c.drLock.Unlock()
+	state := *c.drSecondary
+	state.Epoch = ""
+	state.Index = 0
+	if err := c.persistDRSecondary(&state); err != nil {
+		return err
+	}
+	c.drSecondary = &state
+	return nil
+}
+
+// startDRSecondary starts streaming from the primary if it is not already
+// running
+func (c *Core) startDRSecondary() {
+	c.drLock.Lock()
+	defer c.drLock.Unlock()
+	if c.drSecondary == nil || c.drSecondaryStopCh != nil {
+		return
+	}
+	c.drSecondaryStopCh = make(chan struct{})
+	c.drSecondaryDoneCh = make(chan struct{})
+	go c.runDRSecondary(c.drSecondaryDoneCh, c.drSecondaryStopCh)
+}
+
+// stopDRSecondary stops streaming from the primary and waits for it to
+// finish
+func (c *Core) stopDRSecondary() {
+	c.drLock.Lock()
+	stopCh, doneCh := c.drSecondaryStopCh, c.drSecondaryDoneCh
+	c.drSecondaryStopCh, c.drSecondaryDoneCh = nil, nil
+	c.drLock.Unlock()
+
+	if stopCh != nil {
+		close(stopCh)
+		<-doneCh
+	}
+}
+
+func (c *Core) setDRSecondaryStatus(status string) {
+	c.drLock.Lock()
+	c.drSecondaryStatus = status
+	c.drLock.Unlock()
+}
+
+// runDRSecondary is a long running routine used by a DR secondary. If HA is
+// enabled it takes the HA lock first, so that only one node of the
+// secondary cluster streams from the primary.
+func (c *Core) runDRSecondary(doneCh, stopCh chan struct{}) {
+	defer close(doneCh)
+	c.logger.Info("core: starting DR secondary replication")
+	defer c.logger.Info("core: stopped DR secondary replication")
+	defer c.setDRSecondaryStatus("")
+
+	for {
+		select {
+		case <-stopCh:
+			return
+		default:
+		}
+
+		streamStopCh := stopCh
+		var lock physical.Lock
+		if c.ha != nil {
+			c.setDRSecondaryStatus("waiting-for-lock")
+			lockUUID, err := uuid.GenerateUUID()
+			if err != nil {
+				c.logger.Error("core: failed to generate uuid", "error", err)
+				return
+			}
+			lock, err = c.ha.LockWith(CoreLockPath, lockUUID)
+			if err != nil {
+				c.logger.Error("core: failed to create lock", "error", err)
+				return
+			}
+			leaderLostCh := c.acquireLock(lock, stopCh)
+			if leaderLostCh == nil {
+				return
+			}
+
+			streamStopCh = make(chan struct{})
+			go func(ch chan struct{}) {
+				select {
+				case <-stopCh:
+				case <-leaderLostCh:
+				}
+				close(ch)
+			}(streamStopCh)
+		}
+
+		c.runDRSecondaryStreams(streamStopCh)
+		if lock != nil {
+			lock.Unlock()
+		}
+	}
+}
+
+// runDRSecondaryStreams keeps a stream open to the primary until stopCh is
+// closed
+func (c *Core) runDRSecondaryStreams(stopCh chan struct{}) {
+	for {
+		c.setDRSecondaryStatus("connecting")
+		err := c.drSecondaryStream(stopCh)
+
+		select {
+		case <-stopCh:
+			return
+		default:
+		}
+
+		if err != nil {
+			c.logger.Warn("core: DR secondary lost connection to primary", "error", err)
+		}
+
+		select {
+		case <-stopCh:
+			return
+		case <-time.After(drRetryInterval):
+		}
+	}
+}
+
+// drSecondaryStream connects to the primary and applies what it sends until
+// the stream ends or stopCh is closed
+func (c *Core) drSecondaryStream(stopCh chan struct{}) error {
+	c.drLock.RLock()
+	if c.drSecondary == nil {
+		c.drLock.RUnlock()
+		return ErrNotDRSecondary
+	}
+	state := *c.drSecondary
+	c.drLock.RUnlock()
+
+	tlsConfig, err := state.tlsConfig()
+	if err != nil {
+		return err
+	}
+	tp := drTransport(tlsConfig)
+	defer tp.CloseIdleConnections()
+
+	query := url.Values{}
+	query.Set("epoch", state.Epoch)
+	query.Set("index", strconv.FormatUint(state.Index, 10))
+	req, err := http.NewRequest("GET", state.PrimaryClusterAddr+drStreamPath+"?"+query.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	resp, err := tp.RoundTrip(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status code %d from primary", resp.StatusCode)
+	}
+
+	// Closing the body unblocks the decoder below, both on shutdown and when
+	// the primary stops sending heartbeats
+	streamDoneCh := make(chan struct{})
+	defer close(streamDoneCh)
+	go func() {
+		select {
+		case <-stopCh:
+			resp.Body.Close()
+		case <-streamDoneCh:
+		}
+	}()
+	watchdog := time.AfterFunc(3*drHeartbeatInterval, func() {
+		resp.Body.Close()
+	})
+	defer watchdog.Stop()
+
+	c.setDRSecondaryStatus("stream-wals")
+	c.logger.Info("core: DR secondary connected to primary", "primary_cluster_addr", state.PrimaryClusterAddr)
+
+	// Messages are decoded in the background, so that writes which have
+	// already arrived can be applied as a batch
+	msgCh := make(chan *drStreamMessage, drApplyBatchSize)
+	decodeErrCh := make(chan error, 1)
+	go func() {
+		defer close(msgCh)
+		dec := json.NewDecoder(resp.Body)
+		for {
+			var msg drStreamMessage
+			if err := dec.Decode(&msg); err != nil {
+				decodeErrCh <- err
+				return
+			}
+			watchdog.Reset(3 * drHeartbeatInterval)
+			select {
+			case msgCh <- &msg:
+			case <-streamDoneCh:
+				return
+			}
+		}
+	}()
+
+	var snapshotKeys map[string]struct{}
+	var pending *drStreamMessage
+	for {
+		msg := pending
+		pending = nil
+		if msg == nil {
+			var ok bool
+			msg, ok = <-msgCh
+			if !ok {
+				return <-decodeErrCh
+			}
+		}
+
+		switch msg.Type {
+		case drMessageHeartbeat:
+
+		case drMessageSnapshotStart:
+			c.setDRSecondaryStatus("snapshot")
+			snapshotKeys = make(map[string]struct{})
+
+		case drMessageSnapshotEntry:
+			if snapshotKeys == nil {
+				return fmt.Errorf("snapshot entry received outside of a snapshot")
+			}
+			if err := c.drApply(physical.PutOperation, msg.Key, msg.Value); err != nil {
+				return err
+			}
+			snapshotKeys[msg.Key] = struct{}{}
+
+		case drMessageSnapshotEnd:
+			if snapshotKeys == nil {
+				return fmt.Errorf("snapshot end received outside of a snapshot")
+			}
+
+			// Anything the primary did not send does not exist there
+			var stale []string
+			err := drWalk(c.physical, "", func(key string) error {
+				if _, ok := snapshotKeys[key]; !ok {
+					stale = append(stale, key)
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			for _, key := range stale {
+				if err := c.drApply(physical.DeleteOperation, key, nil); err != nil {
+					return err
+				}
+			}
+
+			snapshotKeys = nil
+			if err := c.drUpdatePosition(msg.Epoch, msg.Index); err != nil {
+				return err
+			}
+			c.setDRSecondaryStatus("stream-wals")
+
+		case drMessageWAL:
+			batch := []*drStreamMessage{msg}
+		BATCH:
+			for len(batch) < drApplyBatchSize {
+				select {
+				case next, ok := <-msgCh:
+					if !ok {
+						break BATCH
+					}
+					if next.Type != drMessageWAL {
+						pending = next
+						break BATCH
+					}
+					batch = append(batch, next)
+				default:
+					break BATCH
+				}
+			}
+			if err := c.drApplyWALs(batch); err != nil {
+				return err
+			}
+
+		default:
+			return fmt.Errorf("unknown DR stream message type %q", msg.Type)
+		}
+	}
+}
+
+// drApply applies a single replicated write to local storage
+func (c *Core) drApply(op physical.Operation, key string, value []byte) error {
+	if isDRLocalKey(key) {
+		return nil
+	}
+	switch op {
+	case physical.PutOperation:
+		return c.physical.Put(&physical.Entry{
+			Key:   key,
+			Value: value,
+		})
+	case physical.DeleteOperation:
+		return c.physical.Delete(key)
+	default:
+		return fmt.Errorf("unknown operation %q", op)
+	}
+}
+
+// drApplyWALs applies a batch of streamed writes to local storage and
+// records the position of the last one. If the storage supports it, the
+// writes and the position are committed in a single transaction; otherwise
+// the position is written once after the whole batch has been applied.
+func (c *Core) drApplyWALs(batch []*drStreamMessage) error {
+	if txnBackend, ok := c.physical.(physical.Transactional); ok {
+		err := c.drCommitWALs(txnBackend, batch)
+		switch err {
+		case nil:
+			return nil
+		case physical.ErrTransactionUnsupported, physical.ErrTransactionTooLarge:
+		default:
+			return fmt.Errorf("failed to apply replicated writes: %v", err)
+		}
+	}
+
+	for _, msg := range batch {
+		if err := c.drApply(msg.Operation, msg.Key, msg.Value); err != nil {
+			return err
+		}
+	}
+	last := batch[len(batch)-1]
+	return c.drUpdatePosition(last.Epoch, last.Index)
+}
+
+// drCommitWALs applies a batch of streamed writes along with the position
+// of the last one in a single transaction
+func (c *Core) drCommitWALs(txnBackend physical.Transactional, batch []*drStreamMessage) error {
+	txns := make([]physical.TxnEntry, 0, len(batch)+1)
+	for _, msg := range batch {
+		if isDRLocalKey(msg.Key) {
+			continue
+		}
+		switch msg.Operation {
+		case physical.PutOperation, physical.DeleteOperation:
+		default:
+			return fmt.Errorf("unknown operation %q", msg.Operation)
+		}
+		txns = append(txns, physical.TxnEntry{
+			Operation: msg.Operation,
+			Entry: &physical.Entry{
+				Key:   msg.Key,
+				Value: msg.Value,
+			},
+		})
+	}
+
+	c.drLock.Lock()
+	defer c.drLock.Unlock()
+	if c.drSecondary == nil {
+		return ErrNotDRSecondary
+	}
+	state := *c.drSecondary
+	last := batch[len(batch)-1]
+	state.Epoch = last.Epoch
+	state.Index = last.Index
+	stateEntry, err := drSecondaryStateEntry(&state)
+	if err != nil {
+		return err
+	}
+	txns = append(txns, physical.TxnEntry{
+		Operation: physical.PutOperation,
+		Entry:     stateEntry,
+	})
+
+	if err := txnBackend.Transaction(txns); err != nil {
+		return err
+	}
+	c.drSecondary = &state
+	return nil
+}
+
+// drUpdatePosition records the position in the primary's log that has been
+// applied
+func (c *Core) drUpdatePosition(epoch string, index uint64) error {
+	c.drLock.Lock()
+	defer c.drLock.Unlock()
+	if c.drSecondary == nil {
+		return ErrNotDRSecondary
+	}
+	state := *c.drSecondary
+	state.Epoch = epoch
+	state.Index = index
+	if err := c.persistDRSecondary(&state); err != nil {
+		return err
+	}
+	c.drSecondary = &state
+	return nil
+}
+
+// DRReplicationStatus returns the DR replication mode of this node along
+// with details about its progress
+func (c *Core) DRReplicationStatus() map[string]interface{} {
+	c.drLock.RLock()
+	defer c.drLock.RUnlock()
+
+	switch {
+	case c.drPrimary != nil:
+		epoch, index := c.drLog.position()
+		secondaries := make([]string, 0, len(c.drPrimary.Secondaries))
+		for id := range c.drPrimary.Secondaries {
+			secondaries = append(secondaries, id)
+		}
+		sort.Strings(secondaries)
+		return map[string]interface{}{
+			"mode":                  DRModePrimary,
+			"cluster_addr":          c.clusterAddr,
+			"epoch":                 epoch,
+			"last_wal":              index,
+			"known_secondaries":     secondaries,
+			"connected_secondaries": len(c.drStreams),
+		}
+
+	case c.drSecondary != nil:
+		return map[string]interface{}{
+			"mode":                 DRModeSecondary,
+			"state":                c.drSecondaryStatus,
+			"secondary_id":         c.drSecondary.ID,
+			"primary_cluster_addr": c.drSecondary.PrimaryClusterAddr,
+			"epoch":                c.drSecondary.Epoch,
+			"last_remote_wal":      c.drSecondary.Index,
+		}
+
+	default:
+		return map[string]interface{}{
+			"mode": DRModeDisabled,
+		}
+	}
+}
+
+// isDRSecondary returns whether this node is a DR secondary
+func (c *Core) isDRSecondary() bool {
+	c.drLock.RLock()
+	defer c.drLock.RUnlock()
+	return c.drSecondary != nil
+}
@@ -0,0 +1,231 @@
+package vault
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/helper/logformat"
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/physical"
+	log "github.com/mgutz/logxi/v1"
+)
+
+func TestDRLogBackend(t *testing.T) {
+	logger := logformat.NewVaultLogger(log.LevelTrace)
+	inm := physical.NewInmem(logger)
+	d := newDRLogBackend(inm)
+
+	// Nothing is recorded until the log is enabled
+	if err := d.Put(&physical.Entry{Key: "foo", Value: []byte("bar")}); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if _, _, ok := d.since("", 0); ok {
+		t.Fatalf("expected disabled log to require a snapshot")
+	}
+
+	if err := d.enable(); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	epoch, index := d.position()
+	if epoch == "" || index != 0 {
+		t.Fatalf("bad: %q %d", epoch, index)
+	}
+
+	entries, notifyCh, ok := d.since(epoch, 0)
+	if !ok || len(entries) != 0 {
+		t.Fatalf("bad: %v %v", entries, ok)
+	}
+
+	if err := d.Put(&physical.Entry{Key: "foo", Value: []byte("baz")}); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	select {
+	case <-notifyCh:
+	default:
+		t.Fatalf("expected write to notify")
+	}
+
+	// Local keys are never recorded
+	if err := d.Put(&physical.Entry{Key: drSecondaryStatePath, Value: []byte("{}")}); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if err := d.Delete("foo"); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	entries, _, ok = d.since(epoch, 0)
+	if !ok {
+		t.Fatalf("expected entries")
+	}
+	var actual []string
+	for _, entry := range entries {
+		actual = append(actual, string(entry.Operation)+":"+entry.Key)
+	}
+	expected := []string{"put:foo", "delete:foo"}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("bad: %v", actual)
+	}
+	if string(entries[0].Value) != "baz" || entries[1].Index != 2 {
+		t.Fatalf("bad: %#v %#v", entries[0], entries[1])
+	}
+
+	entries, _, ok = d.since(epoch, 1)
+	if !ok || len(entries) != 1 || entries[0].Key != "foo" {
+		t.Fatalf("bad: %v %v", entries, ok)
+	}
+
+	// Unknown positions require a snapshot
+	if _, _, ok := d.since("other", 0); ok {
+		t.Fatalf("expected epoch mismatch to require a snapshot")
+	}
+	if _, _, ok := d.since(epoch, 3); ok {
+		t.Fatalf("expected future index to require a snapshot")
+	}
+
+	// Positions that have been trimmed require a snapshot
+	for i := 0; i <= 2*drLogSize; i++ {
+		if err := d.Put(&physical.Entry{Key: "foo", Value: []byte("bar")}); err != nil {
+			t.Fatalf("err: %v", err)
+		}
+	}
+	if _, _, ok := d.since(epoch, 0); ok {
+		t.Fatalf("expected trimmed position to require a snapshot")
+	}
+	_, index = d.position()
+	if _, _, ok := d.since(epoch, index-drLogSize); !ok {
+		t.Fatalf("expected recent position to be available")
+	}
+
+	d.disable()
+	if _, _, ok := d.since(epoch, index); ok {
+		t.Fatalf("expected disabled log to require a snapshot")
+	}
+}
+
+func TestDRActivationToken_Invalid(t *testing.T) {
+	for _, token := range []string{"", "not base64!", "e30"} {
+		if _, err := decodeDRActivationToken(token); err != ErrInvalidActivationToken {
+			t.Fatalf("token %q: bad: %v", token, err)
+		}
+	}
+}
+
+func TestCluster_DRReplication(t *testing.T) {
+	primaryCores := TestCluster(t, []http.Handler{http.NewServeMux(), http.NewServeMux(), http.NewServeMux()}, nil, false)
+	for _, core := range primaryCores {
+		defer core.CloseListeners()
+	}
+	secondaryCores := TestCluster(t, []http.Handler{http.NewServeMux(), http.NewServeMux(), http.NewServeMux()}, nil, false)
+	for _, core := range secondaryCores {
+		defer core.CloseListeners()
+	}
+	primary, secondary := primaryCores[0], secondaryCores[0]
+
+	write := func(core *TestClusterCore, path string, data map[string]interface{}) *logical.Response {
+		resp, err := core.HandleRequest(&logical.Request{
+			Operation:   logical.UpdateOperation,
+			Path:        path,
+			ClientToken: core.Root,
+			Data:        data,
+		})
+		if err != nil {
+			t.Fatalf("%s: err: %v %#v", path, err, resp)
+		}
+		return resp
+	}
+
+	write(primary, "sys/replication/dr/primary/enable", nil)
+	write(primary, "secret/foo", map[string]interface{}{"value": "bar"})
+	resp := write(primary, "sys/replication/dr/primary/secondary-token", map[string]interface{}{"id": "dr1"})
+	token := resp.Data["token"].(string)
+
+	// Tokens are only issued once per secondary
+	_, err := primary.HandleRequest(&logical.Request{
+		Operation:   logical.UpdateOperation,
+		Path:        "sys/replication/dr/primary/secondary-token",
+		ClientToken: primary.Root,
+		Data:        map[string]interface{}{"id": "dr1"},
+	})
+	if err == nil {
+		t.Fatalf("expected duplicate secondary id to fail")
+	}
+
+	write(secondary, "sys/replication/dr/secondary/enable", map[string]interface{}{"token": token})
+
+	// The secret of the token can only be exchanged for a certificate once
+	other, _, _ := TestCoreUnsealed(t)
+	if err := other.enableDRSecondary(token); err != ErrInvalidActivationToken {
+		t.Fatalf("expected invalid token error, got: %v", err)
+	}
+
+	waitForSync := func() {
+		start := time.Now()
+		for {
+			status := secondary.DRReplicationStatus()
+			_, lastWAL := primary.drLog.position()
+			sealed, _ := secondary.Sealed()
+			if sealed && status["state"] == "stream-wals" && status["epoch"] != "" && status["last_remote_wal"] == lastWAL {
+				return
+			}
+			if time.Since(start) > 10*time.Second {
+				t.Fatalf("secondary did not sync: %#v", status)
+			}
+			time.Sleep(50 * time.Millisecond)
+		}
+	}
+	waitForSync()
+
+	status := primary.DRReplicationStatus()
+	if status["mode"] != DRModePrimary || !reflect.DeepEqual(status["known_secondaries"], []string{"dr1"}) {
+		t.Fatalf("bad: %#v", status)
+	}
+	if secondary.DRReplicationStatus()["mode"] != DRModeSecondary {
+		t.Fatalf("bad: %#v", secondary.DRReplicationStatus())
+	}
+
+	// Writes after the snapshot are streamed
+	write(primary, "secret/bar", map[string]interface{}{"value": "baz"})
+	waitForSync()
+
+	// The secondary stays sealed until promoted
+	if _, err := secondary.Unseal(TestKeyCopy(primary.Key)); err != ErrDRSecondary {
+		t.Fatalf("expected DR secondary error, got: %v", err)
+	}
+	if err := secondary.PromoteDRSecondary("bad"); err != ErrInvalidActivationToken {
+		t.Fatalf("expected invalid token error, got: %v", err)
+	}
+	if err := secondary.PromoteDRSecondary(token); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if secondary.DRReplicationStatus()["mode"] != DRModeDisabled {
+		t.Fatalf("bad: %#v", secondary.DRReplicationStatus())
+	}
+
+	// The promoted secondary holds the primary's data and keys
+	if _, err := secondary.Unseal(TestKeyCopy(primary.Key)); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	TestWaitActive(t, secondary.Core)
+	for path, value := range map[string]string{"secret/foo": "bar", "secret/bar": "baz"} {
+		resp, err := secondary.HandleRequest(&logical.Request{
+			Operation:   logical.ReadOperation,
+			Path:        path,
+			ClientToken: primary.Root,
+		})
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		if resp == nil || resp.Data["value"] != value {
+			t.Fatalf("%s: bad: %#v", path, resp)
+		}
+	}
+
+	// Revoked secondaries are forgotten by the primary
+	write(primary, "sys/replication/dr/primary/revoke-secondary", map[string]interface{}{"id": "dr1"})
+	status = primary.DRReplicationStatus()
+	if !reflect.DeepEqual(status["known_secondaries"], []string{}) {
+		t.Fatalf("bad: %#v", status)
+	}
+}
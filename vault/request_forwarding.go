@@ -31,6 +31,12 @@ func (c *Core) startForwarding() error {
 	// straight HTTP/2 forwarding)
 	baseHandler, wrappedHandler := c.clusterHandlerSetupFunc()
 
+	// Performance standbys subscribe to invalidations over the same HTTP/2
+	// connections used for forwarding
+	clusterMux := http.NewServeMux()
+	clusterMux.HandleFunc(perfStandbyInvalidationPath, c.handleInvalidationStream)
+	clusterMux.Handle("/", wrappedHandler)
+
 	// Get our TLS config
 	tlsConfig, err := c.ClusterTLSConfig()
 	if err != nil {
@@ -41,6 +47,23 @@ func (c *Core) startForwarding() error {
 	// The server supports all of the possible protos
 	tlsConfig.NextProtos = []string{"h2", "req_fw_sb-act_v1"}
 
+	// DR secondaries authenticate with certificates issued by the DR
+	// primary's own CA rather than the cluster's, so they get a different
+	// configuration
+	tlsConfig.GetConfigForClient = func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+		for _, proto := range hello.SupportedProtos {
+			if proto == drALPNProto {
+				return c.drServerTLSConfig()
+			}
+		}
+		return nil, nil
+	}
+
+	// DR secondaries stream writes over their own connections
+	drMux := http.NewServeMux()
+	drMux.HandleFunc(drStreamPath, c.handleDRStream)
+	drMux.HandleFunc(drActivatePath, c.handleDRActivate)
+
 	// Create our RPC server and register the request handler server
 	c.rpcServer = grpc.NewServer()
 	RegisterRequestForwardingServer(c.rpcServer, &forwardedRequestRPCServer{
@@ -125,7 +148,7 @@ func (c *Core) startForwarding() error {
 				case "h2":
 					c.logger.Debug("core/startClusterListener/Accept: got h2 connection")
 					go fws.ServeConn(conn, &http2.ServeConnOpts{
-						Handler: wrappedHandler,
+						Handler: clusterMux,
 					})
 
 				case "req_fw_sb-act_v1":
@@ -134,6 +157,12 @@ func (c *Core) startForwarding() error {
 						Handler: c.rpcServer,
 					})
 
+				case drALPNProto:
+					c.logger.Debug("core/startClusterListener/Accept: got repl_dr_v1 connection")
+					go fws.ServeConn(conn, &http2.ServeConnOpts{
+						Handler: drMux,
+					})
+
 				default:
 					c.logger.Debug("core/startClusterListener/Accept: unknown negotiated protocol")
 					conn.Close()
@@ -22,7 +22,17 @@ func (c *Core) HandleRequest(req *logical.Request) (resp *logical.Response, err
 		return nil, ErrSealed
 	}
 	if c.standby {
-		return nil, ErrStandby
+		if !c.perfStandby {
+			return nil, ErrStandby
+		}
+
+		// A performance standby serves some requests itself; anything else
+		// is handed back so that it can be forwarded to the active node
+		c.perfStandbyLock.RLock()
+		defer c.perfStandbyLock.RUnlock()
+		if !c.perfStandbyLocalRequest(req) {
+			return nil, ErrStandby
+		}
 	}
 
 	// Allowing writing to a path ending in / makes it extremely difficult to
@@ -37,6 +47,19 @@ func (c *Core) HandleRequest(req *logical.Request) (resp *logical.Response, err
 		return logical.ErrorResponse("cannot write to a path ending in '/'"), nil
 	}
 
+	// Requests under the path of a namespace are made within it
+	req.Namespace = ""
+	if ns := c.matchingNamespace(req.Path); ns != nil {
+		req.Namespace = ns.Path
+	}
+
+	// Pick up the audit settings of the mount serving the request so that
+	// audit backends can leave the configured keys unhashed
+	if entry := c.router.MatchingMountEntry(req.Path); entry != nil {
+		req.AuditNonHMACRequestKeys = entry.Config.AuditNonHMACRequestKeys
+		req.AuditNonHMACResponseKeys = entry.Config.AuditNonHMACResponseKeys
+	}
+
 	var auth *logical.Auth
 	if c.router.LoginPath(req.Path) {
 		resp, auth, err = c.handleLoginRequest(req)
@@ -44,6 +67,12 @@ func (c *Core) HandleRequest(req *logical.Request) (resp *logical.Response, err
 		resp, auth, err = c.handleRequest(req)
 	}
 
+	// If a request served by a performance standby turned out to need a
+	// write, it is retried on the active node
+	if c.standby && perfStandbyNeedsForward(err) {
+		return nil, ErrStandby
+	}
+
 	// Ensure we don't leak internal data
 	if resp != nil {
 		if resp.Secret != nil {
@@ -62,7 +91,13 @@ func (c *Core) HandleRequest(req *logical.Request) (resp *logical.Response, err
 		err == nil &&
 		!resp.IsError() &&
 		resp.WrapInfo != nil &&
-		resp.WrapInfo.TTL != 0
+		resp.WrapInfo.TTL != 0 &&
+		resp.WrapInfo.Token == ""
+
+	// Wrapping has to write the response to storage
+	if wrapping && c.standby {
+		return nil, ErrStandby
+	}
 
 	if wrapping {
 		cubbyResp, cubbyErr := c.wrapInCubbyhole(req, resp)
@@ -114,10 +149,24 @@ func (c *Core) HandleRequest(req *logical.Request) (resp *logical.Response, err
 func (c *Core) handleRequest(req *logical.Request) (retResp *logical.Response, retAuth *logical.Auth, retErr error) {
 	defer metrics.MeasureSince([]string{"core", "handle_request"}, time.Now())
 
+	// The paths of the backends shared by all namespaces are checked
+	// relative to the namespace of the request
+	relativePath := strings.TrimPrefix(req.Path, req.Namespace)
+
 	// Validate the token
-	auth, te, ctErr := c.checkToken(req)
+	auth, te, cg, ctErr := c.checkToken(req)
+	// Batch tokens are never revoked, so nothing would ever clean up what
+	// they wrote to a cubbyhole
+	if ctErr == nil && te != nil && te.Type == TokenTypeBatch && strings.HasPrefix(relativePath, "cubbyhole/") {
+		ctErr = fmt.Errorf("batch tokens cannot access cubbyhole")
+	}
 	// We run this logic first because we want to decrement the use count even in the case of an error
 	if te != nil {
+		// Tracking uses needs a write, which only the active node can do
+		if c.standby && te.NumUses != 0 {
+			return nil, nil, ErrStandby
+		}
+
 		// Attempt to use the token (decrement NumUses)
 		var err error
 		te, err = c.tokenStore.UseToken(te)
@@ -157,7 +206,7 @@ func (c *Core) handleRequest(req *logical.Request) (retResp *logical.Response, r
 		// return invalid request so that the status codes can be correct
 		var errType error
 		switch ctErr {
-		case ErrInternalError, logical.ErrPermissionDenied:
+		case ErrInternalError, logical.ErrPermissionDenied, ErrControlGroupNotAuthorized:
 			errType = ctErr
 		default:
 			errType = logical.ErrInvalidRequest
@@ -176,15 +225,36 @@ func (c *Core) handleRequest(req *logical.Request) (retResp *logical.Response, r
 	// Attach the display name
 	req.DisplayName = auth.DisplayName
 
-	// Create an audit trail of the request
-	if err := c.auditBroker.LogRequest(auth, req, nil); err != nil {
-		c.logger.Error("core: failed to audit request", "path", req.Path, "error", err)
-		retErr = multierror.Append(retErr, ErrInternalError)
-		return nil, auth, retErr
+	// The response to a request under a control group is wrapped, which
+	// only the active node can do
+	if cg != nil && c.standby {
+		return nil, auth, ErrStandby
+	}
+
+	// Create an audit trail of the request. A performance standby only
+	// knows whether it can serve the request once it has been routed, and
+	// a request it forwards is audited by the active node instead, so its
+	// audit trail is created after routing.
+	if !c.standby {
+		if err := c.auditBroker.LogRequest(auth, req, nil); err != nil {
+			c.logger.Error("core: failed to audit request", "path", req.Path, "error", err)
+			retErr = multierror.Append(retErr, ErrInternalError)
+			return nil, auth, retErr
+		}
 	}
 
 	// Route the request
 	resp, err := c.router.Route(req)
+	if c.standby {
+		if perfStandbyNeedsForward(err) {
+			return nil, auth, ErrStandby
+		}
+		if err := c.auditBroker.LogRequest(auth, req, nil); err != nil {
+			c.logger.Error("core: failed to audit request", "path", req.Path, "error", err)
+			retErr = multierror.Append(retErr, ErrInternalError)
+			return nil, auth, retErr
+		}
+	}
 	if resp != nil {
 		// If wrapping is used, use the shortest between the request and response
 		var wrapTTL time.Duration
@@ -215,7 +285,7 @@ func (c *Core) handleRequest(req *logical.Request) (retResp *logical.Response, r
 
 	// If there is a secret, we must register it with the expiration manager.
 	// We exclude renewal of a lease, since it does not need to be re-registered
-	if resp != nil && resp.Secret != nil && !strings.HasPrefix(req.Path, "sys/renew") {
+	if resp != nil && resp.Secret != nil && !strings.HasPrefix(relativePath, "sys/renew") {
 		// Get the SystemView for the mount
 		sysView := c.router.MatchingSystemView(req.Path)
 		if sysView == nil {
@@ -252,7 +322,13 @@ func (c *Core) handleRequest(req *logical.Request) (retResp *logical.Response, r
 		}
 
 		if registerLease {
+			if c.standby {
+				return nil, auth, ErrStandby
+			}
 			leaseID, err := c.expiration.Register(req, resp)
+			if isLeaseCountQuotaErr(err) {
+				return nil, auth, logical.CodedError(429, err.Error())
+			}
 			if err != nil {
 				c.logger.Error("core: failed to register lease", "request_path", req.Path, "error", err)
 				retErr = multierror.Append(retErr, ErrInternalError)
@@ -265,13 +341,17 @@ func (c *Core) handleRequest(req *logical.Request) (retResp *logical.Response, r
 	// Only the token store is allowed to return an auth block, for any
 	// other request this is an internal error. We exclude renewal of a token,
 	// since it does not need to be re-registered
-	if resp != nil && resp.Auth != nil && !strings.HasPrefix(req.Path, "auth/token/renew") {
-		if !strings.HasPrefix(req.Path, "auth/token/") {
+	if resp != nil && resp.Auth != nil && !strings.HasPrefix(relativePath, "auth/token/renew") {
+		if !strings.HasPrefix(relativePath, "auth/token/") {
 			c.logger.Error("core: unexpected Auth response for non-token backend", "request_path", req.Path)
 			retErr = multierror.Append(retErr, ErrInternalError)
 			return nil, auth, retErr
 		}
 
+		if c.standby {
+			return nil, auth, ErrStandby
+		}
+
 		// Register with the expiration manager. We use the token's actual path
 		// here because roles allow suffixes.
 		te, err := c.tokenStore.Lookup(resp.Auth.ClientToken)
@@ -281,10 +361,17 @@ func (c *Core) handleRequest(req *logical.Request) (retResp *logical.Response, r
 			return nil, nil, retErr
 		}
 
-		if err := c.expiration.RegisterAuth(te.Path, resp.Auth); err != nil {
-			c.logger.Error("core: failed to register token lease", "request_path", req.Path, "error", err)
-			retErr = multierror.Append(retErr, ErrInternalError)
-			return nil, auth, retErr
+		// Batch tokens are never persisted and so have no lease
+		if te.Type != TokenTypeBatch {
+			err := c.expiration.RegisterAuth(te.Path, resp.Auth)
+			if isLeaseCountQuotaErr(err) {
+				return nil, auth, logical.CodedError(429, err.Error())
+			}
+			if err != nil {
+				c.logger.Error("core: failed to register token lease", "request_path", req.Path, "error", err)
+				retErr = multierror.Append(retErr, ErrInternalError)
+				return nil, auth, retErr
+			}
 		}
 	}
 
@@ -295,6 +382,39 @@ func (c *Core) handleRequest(req *logical.Request) (retResp *logical.Response, r
 		resp.AddWarning("Reading from 'cubbyhole/response' is deprecated. Please use sys/wrapping/unwrap to unwrap responses, as it provides additional security checks and other benefits.")
 	}
 
+	// The response to a request under a control group is wrapped here,
+	// rather than along with other wrapped responses, so that the request can
+	// be stored under the accessor of the wrapping token
+	if cg != nil && err == nil && resp != nil && !resp.IsError() {
+		resp.WrapInfo = &logical.WrapInfo{
+			TTL: cg.TTL,
+		}
+		if resp.WrapInfo.TTL == 0 {
+			resp.WrapInfo.TTL = defaultControlGroupTTL
+		}
+
+		cubbyResp, cubbyErr := c.wrapInCubbyhole(req, resp)
+		if cubbyResp != nil || cubbyErr != nil {
+			if cubbyErr != nil {
+				retErr = multierror.Append(retErr, cubbyErr)
+			}
+			return cubbyResp, auth, retErr
+		}
+
+		if err := c.registerControlGroupRequest(req, te, cg, resp.WrapInfo); err != nil {
+			c.tokenStore.Revoke(resp.WrapInfo.Token)
+			c.logger.Error("core: failed to register control group request", "request_path", req.Path, "error", err)
+			retErr = multierror.Append(retErr, ErrInternalError)
+			return nil, auth, retErr
+		}
+
+		wrappingResp := &logical.Response{
+			WrapInfo: resp.WrapInfo,
+		}
+		wrappingResp.CloneWarnings(resp)
+		resp = wrappingResp
+	}
+
 	// Return the response and error
 	if err != nil {
 		retErr = multierror.Append(retErr, err)
@@ -315,7 +435,7 @@ func (c *Core) handleLoginRequest(req *logical.Request) (*logical.Response, *log
 
 	// The token store uses authentication even when creating a new token,
 	// so it's handled in handleRequest. It should not be reached here.
-	if strings.HasPrefix(req.Path, "auth/token/") {
+	if strings.HasPrefix(strings.TrimPrefix(req.Path, req.Namespace), "auth/token/") {
 		c.logger.Error("core: unexpected login request for token backend", "request_path", req.Path)
 		return nil, nil, ErrInternalError
 	}
@@ -368,6 +488,7 @@ func (c *Core) handleLoginRequest(req *logical.Request) (*logical.Response, *log
 
 		// Determine the source of the login
 		source := c.router.MatchingMount(req.Path)
+		source = strings.TrimPrefix(source, req.Namespace)
 		source = strings.TrimPrefix(source, credentialRoutePrefix)
 		source = strings.Replace(source, "/", "-", -1)
 
@@ -409,7 +530,21 @@ func (c *Core) handleLoginRequest(req *logical.Request) (*logical.Response, *log
 			}
 		}
 
-		if err := c.tokenStore.create(&te); err != nil {
+		// The mount decides whether logins are issued batch tokens, and the
+		// token belongs to the namespace of the mount
+		var tokenType string
+		if entry := c.router.MatchingMountEntry(req.Path); entry != nil {
+			tokenType = entry.Config.TokenType
+			te.NamespaceID = entry.NamespaceID
+		}
+
+		if tokenType == TokenTypeBatch {
+			if err := c.tokenStore.createBatchToken(&te); err != nil {
+				c.logger.Error("core: failed to create batch token", "error", err)
+				return nil, auth, ErrInternalError
+			}
+			auth.Renewable = false
+		} else if err := c.tokenStore.create(&te); err != nil {
 			c.logger.Error("core: failed to create token", "error", err)
 			return nil, auth, ErrInternalError
 		}
@@ -419,10 +554,16 @@ func (c *Core) handleLoginRequest(req *logical.Request) (*logical.Response, *log
 		auth.Accessor = te.Accessor
 		auth.Policies = te.Policies
 
-		// Register with the expiration manager
-		if err := c.expiration.RegisterAuth(te.Path, auth); err != nil {
-			c.logger.Error("core: failed to register token lease", "request_path", req.Path, "error", err)
-			return nil, auth, ErrInternalError
+		// Register with the expiration manager; batch tokens have no lease
+		if te.Type != TokenTypeBatch {
+			err := c.expiration.RegisterAuth(te.Path, auth)
+			if isLeaseCountQuotaErr(err) {
+				return nil, auth, logical.CodedError(429, err.Error())
+			}
+			if err != nil {
+				c.logger.Error("core: failed to register token lease", "request_path", req.Path, "error", err)
+				return nil, auth, ErrInternalError
+			}
 		}
 
 		// Attach the display name, might be used by audit backends
@@ -472,6 +613,7 @@ func (c *Core) wrapInCubbyhole(req *logical.Request, resp *logical.Response) (*l
 	}
 
 	resp.WrapInfo.Token = te.ID
+	resp.WrapInfo.Accessor = te.Accessor
 	resp.WrapInfo.CreationTime = creationTime
 
 	// This will only be non-nil if this response contains a token, so in that
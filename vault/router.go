@@ -35,6 +35,8 @@ type routeEntry struct {
 	storageView *BarrierView
 	rootPaths   *radix.Tree
 	loginPaths  *radix.Tree
+	// perfStandbyPaths are the paths a performance standby may serve locally
+	perfStandbyPaths *radix.Tree
 }
 
 // SaltID is used to apply a salt and hash to an ID to make sure its not reversible
@@ -61,12 +63,13 @@ func (r *Router) Mount(backend logical.Backend, prefix string, mountEntry *Mount
 
 	// Create a mount entry
 	re := &routeEntry{
-		tainted:     false,
-		backend:     backend,
-		mountEntry:  mountEntry,
-		storageView: storageView,
-		rootPaths:   pathsToRadix(paths.Root),
-		loginPaths:  pathsToRadix(paths.Unauthenticated),
+		tainted:          false,
+		backend:          backend,
+		mountEntry:       mountEntry,
+		storageView:      storageView,
+		rootPaths:        pathsToRadix(paths.Root),
+		loginPaths:       pathsToRadix(paths.Unauthenticated),
+		perfStandbyPaths: pathsToRadix(paths.PerformanceStandby),
 	}
 	r.root.Insert(prefix, re)
 
@@ -233,12 +236,14 @@ func (r *Router) routeCommon(req *logical.Request, existenceCheck bool) (*logica
 	// Attach the storage view for the request
 	req.Storage = re.storageView
 
-	// Hash the request token unless this is the token backend
+	// Hash the request token unless this is the token backend. Within a
+	// namespace, these paths are relative to the namespace.
 	clientToken := req.ClientToken
+	relativePath := strings.TrimPrefix(originalPath, re.mountEntry.NamespacePath)
 	switch {
-	case strings.HasPrefix(originalPath, "auth/token/"):
-	case strings.HasPrefix(originalPath, "sys/"):
-	case strings.HasPrefix(originalPath, "cubbyhole/"):
+	case strings.HasPrefix(relativePath, "auth/token/"):
+	case strings.HasPrefix(relativePath, "sys/"):
+	case strings.HasPrefix(relativePath, "cubbyhole/"):
 		// In order for the token store to revoke later, we need to have the same
 		// salted ID, so we double-salt what's going to the cubbyhole backend
 		req.ClientToken = re.SaltID(r.tokenStoreSalt.SaltID(req.ClientToken))
@@ -334,6 +339,60 @@ func (r *Router) LoginPath(path string) bool {
 	return match == remain
 }
 
+// PerformanceStandbyPath checks if the given path may be served locally by a
+// performance standby
+func (r *Router) PerformanceStandbyPath(path string) bool {
+	r.l.RLock()
+	mount, raw, ok := r.root.LongestPrefix(path)
+	r.l.RUnlock()
+	if !ok {
+		return false
+	}
+	re := raw.(*routeEntry)
+
+	// Trim to get remaining path
+	remain := strings.TrimPrefix(path, mount)
+
+	// Check the perfStandbyPaths of this backend
+	match, raw, ok := re.perfStandbyPaths.LongestPrefix(remain)
+	if !ok {
+		return false
+	}
+	prefixMatch := raw.(bool)
+
+	// Handle the prefix match case
+	if prefixMatch {
+		return strings.HasPrefix(remain, match)
+	}
+
+	// Handle the exact match case
+	return match == remain
+}
+
+// InvalidateKey notifies the backend whose storage view holds the given
+// physical key that the key has been modified elsewhere. The key is passed
+// to the backend relative to its storage view.
+func (r *Router) InvalidateKey(key string) {
+	var backend logical.Backend
+	var remain string
+
+	r.l.RLock()
+	r.root.Walk(func(_ string, raw interface{}) bool {
+		re := raw.(*routeEntry)
+		if re.storageView == nil || !strings.HasPrefix(key, re.storageView.prefix) {
+			return false
+		}
+		backend = re.backend
+		remain = strings.TrimPrefix(key, re.storageView.prefix)
+		return true
+	})
+	r.l.RUnlock()
+
+	if backend != nil {
+		backend.InvalidateKey(remain)
+	}
+}
+
 // pathsToRadix converts a the mapping of special paths to a mapping
 // of special paths to radix trees.
 func pathsToRadix(paths []string) *radix.Tree {
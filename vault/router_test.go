@@ -14,11 +14,13 @@ import (
 type NoopBackend struct {
 	sync.Mutex
 
-	Root     []string
-	Login    []string
-	Paths    []string
-	Requests []*logical.Request
-	Response *logical.Response
+	Root          []string
+	Login         []string
+	PerfStandby   []string
+	Paths         []string
+	Requests      []*logical.Request
+	Response      *logical.Response
+	Invalidations []string
 }
 
 func (n *NoopBackend) HandleRequest(req *logical.Request) (*logical.Response, error) {
@@ -41,8 +43,9 @@ func (n *NoopBackend) HandleExistenceCheck(req *logical.Request) (bool, bool, er
 
 func (n *NoopBackend) SpecialPaths() *logical.Paths {
 	return &logical.Paths{
-		Root:            n.Root,
-		Unauthenticated: n.Login,
+		Root:               n.Root,
+		Unauthenticated:    n.Login,
+		PerformanceStandby: n.PerfStandby,
 	}
 }
 
@@ -57,6 +60,12 @@ func (n *NoopBackend) Cleanup() {
 	// noop
 }
 
+func (n *NoopBackend) InvalidateKey(k string) {
+	n.Lock()
+	defer n.Unlock()
+	n.Invalidations = append(n.Invalidations, k)
+}
+
 func TestRouter_Mount(t *testing.T) {
 	r := NewRouter()
 	_, barrier, _ := mockBarrier(t)
@@ -272,6 +281,74 @@ func TestRouter_LoginPath(t *testing.T) {
 	}
 }
 
+func TestRouter_PerformanceStandbyPath(t *testing.T) {
+	r := NewRouter()
+	_, barrier, _ := mockBarrier(t)
+	view := NewBarrierView(barrier, "logical/")
+
+	meUUID, err := uuid.GenerateUUID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := &NoopBackend{
+		PerfStandby: []string{
+			"config",
+			"encrypt/*",
+		},
+	}
+	err = r.Mount(n, "transit/", &MountEntry{UUID: meUUID}, view)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	type tcase struct {
+		path   string
+		expect bool
+	}
+	tcases := []tcase{
+		{"random", false},
+		{"transit/keys/foo", false},
+		{"transit/config", true},
+		{"transit/config/foo", false},
+		{"transit/encrypt", false},
+		{"transit/encrypt/foo", true},
+	}
+
+	for _, tc := range tcases {
+		out := r.PerformanceStandbyPath(tc.path)
+		if out != tc.expect {
+			t.Fatalf("bad: path: %s expect: %v got %v", tc.path, tc.expect, out)
+		}
+	}
+}
+
+func TestRouter_InvalidateKey(t *testing.T) {
+	r := NewRouter()
+	_, barrier, _ := mockBarrier(t)
+
+	n1 := &NoopBackend{}
+	err := r.Mount(n1, "prod/aws/", &MountEntry{UUID: "uuid1"}, NewBarrierView(barrier, "logical/uuid1/"))
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	n2 := &NoopBackend{}
+	err = r.Mount(n2, "prod/gcp/", &MountEntry{UUID: "uuid2"}, NewBarrierView(barrier, "logical/uuid2/"))
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	r.InvalidateKey("logical/uuid2/policy/foo")
+	r.InvalidateKey("logical/uuid3/bar")
+	r.InvalidateKey("core/mounts")
+
+	if len(n1.Invalidations) != 0 {
+		t.Fatalf("bad: %v", n1.Invalidations)
+	}
+	if len(n2.Invalidations) != 1 || n2.Invalidations[0] != "policy/foo" {
+		t.Fatalf("bad: %v", n2.Invalidations)
+	}
+}
+
 func TestRouter_Taint(t *testing.T) {
 	r := NewRouter()
 	_, barrier, _ := mockBarrier(t)
@@ -110,6 +110,13 @@ func TestCoreWithSeal(t *testing.T, testSeal Seal) *Core {
 	for backendName, backendFactory := range testLogicalBackends {
 		logicalBackends[backendName] = backendFactory
 	}
+	credentialBackends := make(map[string]logical.Factory)
+	for backendName, backendFactory := range noopBackends {
+		credentialBackends[backendName] = backendFactory
+	}
+	for backendName, backendFactory := range testCredentialBackends {
+		credentialBackends[backendName] = backendFactory
+	}
 
 	logger := logformat.NewVaultLogger(log.LevelTrace)
 
@@ -118,7 +125,7 @@ func TestCoreWithSeal(t *testing.T, testSeal Seal) *Core {
 		Physical:           physicalBackend,
 		AuditBackends:      noopAudits,
 		LogicalBackends:    logicalBackends,
-		CredentialBackends: noopBackends,
+		CredentialBackends: credentialBackends,
 		DisableMlock:       true,
 		Logger:             logger,
 	}
@@ -225,6 +232,7 @@ func TestKeyCopy(key []byte) []byte {
 }
 
 var testLogicalBackends = map[string]logical.Factory{}
+var testCredentialBackends = map[string]logical.Factory{}
 
 // Starts the test server which responds to SSH authentication.
 // Used to test the SSH secret backend.
@@ -330,6 +338,19 @@ func AddTestLogicalBackend(name string, factory logical.Factory) error {
 	return nil
 }
 
+// This adds a credential backend for the test core. This needs to be
+// invoked before the test core is created.
+func AddTestCredentialBackend(name string, factory logical.Factory) error {
+	if name == "" {
+		return fmt.Errorf("Missing backend name")
+	}
+	if factory == nil {
+		return fmt.Errorf("Missing backend factory function")
+	}
+	testCredentialBackends[name] = factory
+	return nil
+}
+
 type noopAudit struct {
 	Config *audit.BackendConfig
 }
@@ -381,6 +402,10 @@ func (n *rawHTTP) Cleanup() {
 	// noop
 }
 
+func (n *rawHTTP) InvalidateKey(string) {
+	// noop
+}
+
 func GenerateRandBytes(length int) ([]byte, error) {
 	if length < 0 {
 		return nil, fmt.Errorf("length must be >= 0")
@@ -628,6 +653,8 @@ func TestCluster(t *testing.T, handlers []http.Handler, base *CoreConfig, unseal
 		if base.Logger != nil {
 			coreConfig.Logger = base.Logger
 		}
+
+		coreConfig.PerformanceStandby = base.PerformanceStandby
 	}
 
 	c1, err := NewCore(coreConfig)
@@ -1,6 +1,7 @@
 package vault
 
 import (
+	"crypto/cipher"
 	"encoding/json"
 	"fmt"
 	"regexp"
@@ -9,7 +10,9 @@ import (
 	"time"
 
 	"github.com/armon/go-metrics"
+	"github.com/hashicorp/errwrap"
 	"github.com/hashicorp/go-uuid"
+	"github.com/hashicorp/vault/helper/cidrutil"
 	"github.com/hashicorp/vault/helper/duration"
 	"github.com/hashicorp/vault/helper/jsonutil"
 	"github.com/hashicorp/vault/helper/locksutil"
@@ -18,6 +21,7 @@ import (
 	"github.com/hashicorp/vault/helper/strutil"
 	"github.com/hashicorp/vault/logical"
 	"github.com/hashicorp/vault/logical/framework"
+	"github.com/hashicorp/vault/physical"
 	"github.com/mitchellh/mapstructure"
 )
 
@@ -63,9 +67,27 @@ type TokenStore struct {
 
 	cubbyholeBackend *CubbyholeBackend
 
-	policyLookupFunc func(string) (*Policy, error)
+	policyLookupFunc func(string, string) (*Policy, error)
+
+	// core is used to resolve the namespaces of requests and tokens
+	core *Core
 
 	tokenLocks map[string]*sync.RWMutex
+
+	// parentLocks guard the parent index entries of tokens, keyed by the
+	// salted ID of the parent
+	parentLocks map[string]*sync.RWMutex
+
+	batchTokenLock   sync.Mutex
+	batchTokenCipher cipher.AEAD
+
+	// tidyInProgress is set while a tidy operation is running
+	tidyInProgress int32
+
+	// quitCh is closed when the token store is cleaned up at seal, ending
+	// any tidy operation in progress
+	quitCh   chan struct{}
+	quitOnce sync.Once
 }
 
 // NewTokenStore is used to construct a token store that is
@@ -76,11 +98,19 @@ func NewTokenStore(c *Core, config *logical.BackendConfig) (*TokenStore, error)
 
 	// Initialize the store
 	t := &TokenStore{
-		view: view,
+		view:   view,
+		core:   c,
+		quitCh: make(chan struct{}),
 	}
 
 	if c.policyStore != nil {
-		t.policyLookupFunc = c.policyStore.GetPolicy
+		t.policyLookupFunc = func(namespaceID, name string) (*Policy, error) {
+			ps := c.namespacePolicyStore(namespaceID)
+			if ps == nil {
+				return nil, nil
+			}
+			return ps.GetPolicy(name)
+		}
 	}
 
 	// Setup the salt
@@ -101,14 +131,30 @@ func NewTokenStore(c *Core, config *logical.BackendConfig) (*TokenStore, error)
 
 	t.tokenLocks["custom"] = &sync.RWMutex{}
 
+	t.parentLocks = map[string]*sync.RWMutex{}
+	if err = locksutil.CreateLocks(t.parentLocks, 256); err != nil {
+		return nil, fmt.Errorf("failed to create locks: %v", err)
+	}
+	t.parentLocks["custom"] = &sync.RWMutex{}
+
 	// Setup the framework endpoints
 	t.Backend = &framework.Backend{
 		AuthRenew: t.authRenew,
+		Clean:     t.cleanup,
 
 		PathsSpecial: &logical.Paths{
 			Root: []string{
 				"revoke-orphan/*",
 				"accessors*",
+				"tidy",
+			},
+
+			PerformanceStandby: []string{
+				"lookup",
+				"lookup/*",
+				"lookup-accessor",
+				"lookup-accessor/*",
+				"lookup-self",
 			},
 		},
 
@@ -184,6 +230,17 @@ func NewTokenStore(c *Core, config *logical.BackendConfig) (*TokenStore, error)
 						Default:     true,
 						Description: tokenRenewableHelp,
 					},
+
+					"token_type": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Default:     TokenTypeService,
+						Description: tokenTypeHelp,
+					},
+
+					"bound_cidrs": &framework.FieldSchema{
+						Type:        framework.TypeCommaStringSlice,
+						Description: tokenBoundCIDRsHelp,
+					},
 				},
 
 				Callbacks: map[logical.Operation]framework.OperationFunc{
@@ -284,6 +341,17 @@ func NewTokenStore(c *Core, config *logical.BackendConfig) (*TokenStore, error)
 				HelpDescription: strings.TrimSpace(tokenLookupAccessorHelp),
 			},
 
+			&framework.Path{
+				Pattern: "tidy$",
+
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.UpdateOperation: t.handleTidy,
+				},
+
+				HelpSynopsis:    strings.TrimSpace(tokenTidyHelp),
+				HelpDescription: strings.TrimSpace(tokenTidyDesc),
+			},
+
 			&framework.Path{
 				Pattern: "lookup-self$",
 
@@ -480,6 +548,17 @@ type TokenEntry struct {
 	// backends are subject to those renewal rules.
 	Period time.Duration `json:"period" mapstructure:"period" structs:"period"`
 
+	// The type of the token, either service or batch. Empty for tokens
+	// created before token types existed, which are service tokens.
+	Type string `json:"type,omitempty" mapstructure:"type" structs:"type"`
+
+	// If set, the CIDR blocks from which the token can be used
+	BoundCIDRs []string `json:"bound_cidrs,omitempty" mapstructure:"bound_cidrs" structs:"bound_cidrs"`
+
+	// The ID of the namespace the token was created in, whose policies it
+	// carries. Empty for the root namespace.
+	NamespaceID string `json:"namespace_id,omitempty" mapstructure:"namespace_id" structs:"namespace_id"`
+
 	// These are the deprecated fields
 	DisplayNameDeprecated    string        `json:"DisplayName" mapstructure:"DisplayName" structs:"DisplayName"`
 	NumUsesDeprecated        int           `json:"NumUses" mapstructure:"NumUses" structs:"NumUses"`
@@ -516,6 +595,13 @@ type tsRoleEntry struct {
 	// If set, the token entry will have an explicit maximum TTL set, rather
 	// than deferring to role/mount values
 	ExplicitMaxTTL time.Duration `json:"explicit_max_ttl" mapstructure:"explicit_max_ttl" structs:"explicit_max_ttl"`
+
+	// The type of token created using this role, either service or batch
+	TokenType string `json:"token_type" mapstructure:"token_type" structs:"token_type"`
+
+	// If set, tokens created using this role can only be used from these
+	// CIDR blocks
+	BoundCIDRs []string `json:"bound_cidrs" mapstructure:"bound_cidrs" structs:"bound_cidrs"`
 }
 
 type accessorEntry struct {
@@ -579,7 +665,7 @@ func (ts *TokenStore) tokenStoreAccessorList(
 }
 
 // createAccessor is used to create an identifier for the token ID.
-// A storage index, mapping the accessor to the token ID is also created.
+// The accessor index entry is written along with the token by storeCommon.
 func (ts *TokenStore) createAccessor(entry *TokenEntry) error {
 	defer metrics.MeasureSince([]string{"token", "createAccessor"}, time.Now())
 
@@ -589,23 +675,6 @@ func (ts *TokenStore) createAccessor(entry *TokenEntry) error {
 		return err
 	}
 	entry.Accessor = accessorUUID
-
-	// Create index entry, mapping the accessor to the token ID
-	path := accessorPrefix + ts.SaltID(entry.Accessor)
-
-	aEntry := &accessorEntry{
-		TokenID:    entry.ID,
-		AccessorID: entry.Accessor,
-	}
-	aEntryBytes, err := jsonutil.EncodeJSON(aEntry)
-	if err != nil {
-		return fmt.Errorf("failed to marshal accessor index entry: %v", err)
-	}
-
-	le := &logical.StorageEntry{Key: path, Value: aEntryBytes}
-	if err := ts.view.Put(le); err != nil {
-		return fmt.Errorf("failed to persist accessor index entry: %v", err)
-	}
 	return nil
 }
 
@@ -624,6 +693,12 @@ func (ts *TokenStore) create(entry *TokenEntry) error {
 
 	entry.Policies = policyutil.SanitizePolicies(entry.Policies, policyutil.DoNotAddDefaultPolicy)
 
+	// Hold the lock of the new token so that a tidy can't remove its
+	// accessor before the token itself is written
+	lock := ts.getTokenLock(entry.ID)
+	lock.Lock()
+	defer lock.Unlock()
+
 	err := ts.createAccessor(entry)
 	if err != nil {
 		return err
@@ -640,7 +715,8 @@ func (ts *TokenStore) store(entry *TokenEntry) error {
 }
 
 // storeCommon handles the actual storage of an entry, possibly generating
-// secondary indexes
+// secondary indexes. The entry and its indexes are written in a single
+// transaction when the storage supports it.
 func (ts *TokenStore) storeCommon(entry *TokenEntry, writeSecondary bool) error {
 	saltedId := ts.SaltID(entry.ID)
 
@@ -650,14 +726,44 @@ func (ts *TokenStore) storeCommon(entry *TokenEntry, writeSecondary bool) error
 		return fmt.Errorf("failed to encode entry: %v", err)
 	}
 
+	var txns []logical.TxnEntry
 	if writeSecondary {
+		// Create index entry, mapping the accessor to the token ID
+		if entry.Accessor != "" {
+			aEntry := &accessorEntry{
+				TokenID:    entry.ID,
+				AccessorID: entry.Accessor,
+			}
+			aEntryBytes, err := jsonutil.EncodeJSON(aEntry)
+			if err != nil {
+				return fmt.Errorf("failed to marshal accessor index entry: %v", err)
+			}
+			txns = append(txns, logical.TxnEntry{
+				Operation: physical.PutOperation,
+				Entry: &logical.StorageEntry{
+					Key:   accessorPrefix + ts.SaltID(entry.Accessor),
+					Value: aEntryBytes,
+				},
+			})
+		}
+
 		// Write the secondary index if necessary. This is done before the
-		// primary index because we'd rather have a dangling pointer with
+		// primary index because, if the storage cannot apply all of the
+		// writes atomically, we'd rather have a dangling pointer with
 		// a missing primary instead of missing the parent index and potentially
 		// escaping the revocation chain.
 		if entry.Parent != "" {
-			// Ensure the parent exists
-			parent, err := ts.Lookup(entry.Parent)
+			// Hold the parent index lock until the entries are written so
+			// that a tidy doesn't remove the index entry of the new child
+			saltedParent := ts.SaltID(entry.Parent)
+			parentLock := ts.getParentLock(saltedParent)
+			parentLock.RLock()
+			defer parentLock.RUnlock()
+
+			// Ensure the parent exists. This calls lookupSalted since the
+			// lock of the new token, which may be shared with the parent,
+			// is already held.
+			parent, err := ts.lookupSalted(saltedParent)
 			if err != nil {
 				return fmt.Errorf("failed to lookup parent: %v", err)
 			}
@@ -666,38 +772,62 @@ func (ts *TokenStore) storeCommon(entry *TokenEntry, writeSecondary bool) error
 			}
 
 			// Create the index entry
-			path := parentPrefix + ts.SaltID(entry.Parent) + "/" + saltedId
-			le := &logical.StorageEntry{Key: path}
-			if err := ts.view.Put(le); err != nil {
-				return fmt.Errorf("failed to persist entry: %v", err)
-			}
+			txns = append(txns, logical.TxnEntry{
+				Operation: physical.PutOperation,
+				Entry: &logical.StorageEntry{
+					Key: parentPrefix + saltedParent + "/" + saltedId,
+				},
+			})
 		}
 	}
 
 	// Write the primary ID
-	path := lookupPrefix + saltedId
-	le := &logical.StorageEntry{Key: path, Value: enc}
-	if err := ts.view.Put(le); err != nil {
-		return fmt.Errorf("failed to persist entry: %v", err)
+	txns = append(txns, logical.TxnEntry{
+		Operation: physical.PutOperation,
+		Entry: &logical.StorageEntry{
+			Key:   lookupPrefix + saltedId,
+			Value: enc,
+		},
+	})
+	if err := logical.ApplyTxn(ts.view, txns); err != nil {
+		return errwrap.Wrapf("failed to persist entry: {{err}}", err)
 	}
 	return nil
 }
 
 func (ts *TokenStore) getTokenLock(id string) *sync.RWMutex {
+	return lockForKey(ts.tokenLocks, id)
+}
+
+// getParentLock returns the lock guarding the parent index entries of the
+// token with the given salted ID
+func (ts *TokenStore) getParentLock(saltedParent string) *sync.RWMutex {
+	return lockForKey(ts.parentLocks, saltedParent)
+}
+
+func lockForKey(locks map[string]*sync.RWMutex, key string) *sync.RWMutex {
 	// Find our multilevel lock, or fall back to global
 	var lock *sync.RWMutex
 	var ok bool
-	if len(id) >= 2 {
-		lock, ok = ts.tokenLocks[id[0:2]]
+	if len(key) >= 2 {
+		lock, ok = locks[key[0:2]]
 	}
 	if !ok || lock == nil {
 		// Fall back for custom token IDs
-		lock = ts.tokenLocks["custom"]
+		lock = locks["custom"]
 	}
 
 	return lock
 }
 
+// cleanup is called when the token store is unloaded at seal and stops any
+// tidy operation in progress
+func (ts *TokenStore) cleanup() {
+	ts.quitOnce.Do(func() {
+		close(ts.quitCh)
+	})
+}
+
 // UseToken is used to manage restricted use tokens and decrement their
 // available uses. Returns two values: a potentially updated entry or, if the
 // token has been revoked, nil; and whether an error was encountered. The
@@ -757,7 +887,7 @@ func (ts *TokenStore) UseToken(te *TokenEntry) (*TokenEntry, error) {
 	path := lookupPrefix + saltedId
 	le := &logical.StorageEntry{Key: path, Value: enc}
 	if err := ts.view.Put(le); err != nil {
-		return nil, fmt.Errorf("failed to persist entry: %v", err)
+		return nil, errwrap.Wrapf("failed to persist entry: {{err}}", err)
 	}
 
 	return te, nil
@@ -779,6 +909,10 @@ func (ts *TokenStore) Lookup(id string) (*TokenEntry, error) {
 		return nil, fmt.Errorf("cannot lookup blank token")
 	}
 
+	if IsBatchToken(id) {
+		return ts.lookupBatchToken(id)
+	}
+
 	lock := ts.getTokenLock(id)
 	lock.RLock()
 	defer lock.RUnlock()
@@ -846,9 +980,11 @@ func (ts *TokenStore) lookupSalted(saltedId string) (*TokenEntry, error) {
 		persistNeeded = true
 	}
 
-	// If fields are getting upgraded, store the changes
+	// If fields are getting upgraded, store the changes. A performance
+	// standby can't write, so it uses the upgraded entry as-is and leaves
+	// persisting it to the active node.
 	if persistNeeded {
-		if err := ts.storeCommon(entry, false); err != nil {
+		if err := ts.storeCommon(entry, false); err != nil && !isReadOnlyErr(err) {
 			return nil, fmt.Errorf("failed to persist token upgrade: %v", err)
 		}
 	}
@@ -863,6 +999,9 @@ func (ts *TokenStore) Revoke(id string) error {
 	if id == "" {
 		return fmt.Errorf("cannot revoke blank token")
 	}
+	if IsBatchToken(id) {
+		return fmt.Errorf("batch tokens cannot be revoked")
+	}
 
 	return ts.revokeSalted(ts.SaltID(id))
 }
@@ -884,8 +1023,13 @@ func (ts *TokenStore) revokeSalted(saltedId string) error {
 
 	// Clear the secondary index if any
 	if entry != nil && entry.Parent != "" {
-		path := parentPrefix + ts.SaltID(entry.Parent) + "/" + saltedId
-		if ts.view.Delete(path); err != nil {
+		saltedParent := ts.SaltID(entry.Parent)
+		parentLock := ts.getParentLock(saltedParent)
+		parentLock.Lock()
+		path := parentPrefix + saltedParent + "/" + saltedId
+		err := ts.view.Delete(path)
+		parentLock.Unlock()
+		if err != nil {
 			return fmt.Errorf("failed to delete entry: %v", err)
 		}
 	}
@@ -922,6 +1066,9 @@ func (ts *TokenStore) RevokeTree(id string) error {
 	if id == "" {
 		return fmt.Errorf("cannot revoke blank token")
 	}
+	if IsBatchToken(id) {
+		return fmt.Errorf("batch tokens cannot be revoked")
+	}
 
 	// Get the salted ID
 	saltedId := ts.SaltID(id)
@@ -1081,6 +1228,9 @@ func (ts *TokenStore) handleUpdateRevokeAccessor(req *logical.Request, data *fra
 	if err != nil {
 		return nil, err
 	}
+	if err := ts.checkTokenNamespace(req, aEntry.TokenID); err != nil {
+		return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+	}
 
 	// Revoke the token and its children
 	if err := ts.RevokeTree(aEntry.TokenID); err != nil {
@@ -1126,6 +1276,13 @@ func (ts *TokenStore) handleCreateCommon(
 			logical.ErrInvalidRequest
 	}
 
+	// Batch tokens are not tracked, so there would be nothing tying the
+	// lifetime of a child to its parent
+	if parent.Type == TokenTypeBatch {
+		return logical.ErrorResponse("batch tokens cannot generate child tokens"),
+			logical.ErrInvalidRequest
+	}
+
 	// Check if the client token has sudo/root privileges for the requested path
 	isSudo := ts.System().SudoPrivilege(req.MountPoint+req.Path, req.ClientToken)
 
@@ -1143,6 +1300,7 @@ func (ts *TokenStore) handleCreateCommon(
 		DisplayName     string `mapstructure:"display_name"`
 		NumUses         int    `mapstructure:"num_uses"`
 		Period          string
+		Type            string
 	}
 	if err := mapstructure.WeakDecode(req.Data, &data); err != nil {
 		return logical.ErrorResponse(fmt.Sprintf(
@@ -1155,14 +1313,56 @@ func (ts *TokenStore) handleCreateCommon(
 			logical.ErrInvalidRequest
 	}
 
+	if !validTokenType(data.Type) {
+		return logical.ErrorResponse(fmt.Sprintf("invalid token type %q", data.Type)),
+			logical.ErrInvalidRequest
+	}
+	tokenType := data.Type
+	if tokenType == "" && role != nil {
+		tokenType = role.TokenType
+	}
+
+	// CIDR blocks may be given as a list or a comma-separated string
+	boundCIDRsRaw, _, err := (&framework.FieldData{
+		Raw: req.Data,
+		Schema: map[string]*framework.FieldSchema{
+			"bound_cidrs": &framework.FieldSchema{Type: framework.TypeCommaStringSlice},
+		},
+	}).GetOkErr("bound_cidrs")
+	if err != nil {
+		return logical.ErrorResponse(fmt.Sprintf("invalid bound_cidrs: %v", err)), logical.ErrInvalidRequest
+	}
+	var boundCIDRs []string
+	if boundCIDRsRaw != nil {
+		boundCIDRs = strutil.RemoveDuplicates(boundCIDRsRaw.([]string))
+	}
+	if len(boundCIDRs) > 0 {
+		if valid, err := cidrutil.ValidateCIDRListSlice(boundCIDRs); !valid || err != nil {
+			return logical.ErrorResponse(fmt.Sprintf("invalid bound_cidrs: %v", err)), logical.ErrInvalidRequest
+		}
+	}
+
+	// Tokens created within a namespace belong to it
+	var namespaceID string
+	if req.Namespace != "" {
+		ns := ts.core.matchingNamespace(req.Namespace)
+		if ns == nil || ns.Path != req.Namespace {
+			return logical.ErrorResponse(fmt.Sprintf("namespace %q not found", req.Namespace)), logical.ErrInvalidRequest
+		}
+		namespaceID = ns.ID
+	}
+
 	// Setup the token entry
 	te := TokenEntry{
 		Parent: req.ClientToken,
 
 		// The mount point is always the same since we have only one token
-		// store; using req.MountPoint causes trouble in tests since they don't
-		// have an official mount
-		Path: fmt.Sprintf("auth/token/%s", req.Path),
+		// store, placed below the path of the namespace if any; using
+		// req.MountPoint causes trouble in tests since they don't have an
+		// official mount
+		Path: fmt.Sprintf("%sauth/token/%s", req.Namespace, req.Path),
+
+		NamespaceID: namespaceID,
 
 		Meta:         data.Metadata,
 		DisplayName:  "token",
@@ -1192,7 +1392,17 @@ func (ts *TokenStore) handleCreateCommon(
 		if role.PathSuffix != "" {
 			te.Path = fmt.Sprintf("%s/%s", te.Path, role.PathSuffix)
 		}
+
+		// The request may narrow, but not widen, the blocks bound on the role
+		if len(role.BoundCIDRs) > 0 {
+			if len(boundCIDRs) == 0 {
+				boundCIDRs = role.BoundCIDRs
+			} else if subset, err := cidrutil.SubsetBlocks(role.BoundCIDRs, boundCIDRs); !subset || err != nil {
+				return logical.ErrorResponse("bound_cidrs must be a subset of the role's bound_cidrs"), logical.ErrInvalidRequest
+			}
+		}
 	}
+	te.BoundCIDRs = boundCIDRs
 
 	// Attach the given display name if any
 	if data.DisplayName != "" {
@@ -1340,6 +1550,11 @@ func (ts *TokenStore) handleCreateCommon(
 		return logical.ErrorResponse("root tokens may not be created without parent token being root"), logical.ErrInvalidRequest
 	}
 
+	// A namespace has no root policy
+	if namespaceID != "" && strutil.StrListContains(te.Policies, "root") {
+		return logical.ErrorResponse("root tokens may not be created within a namespace"), logical.ErrInvalidRequest
+	}
+
 	//
 	// NOTE: Do not modify policies below this line. We need the checks above
 	// to be the last checks as they must look at the final policy set.
@@ -1443,6 +1658,14 @@ func (ts *TokenStore) handleCreateCommon(
 		}
 	}
 
+	// Batch tokens are never renewable, whatever was requested
+	if tokenType == TokenTypeBatch {
+		if periodToUse > 0 {
+			return logical.ErrorResponse("batch tokens cannot be periodic"), logical.ErrInvalidRequest
+		}
+		renewable = false
+	}
+
 	sysView := ts.System()
 
 	if periodToUse > 0 {
@@ -1489,11 +1712,18 @@ func (ts *TokenStore) handleCreateCommon(
 		if parent.TTL != 0 {
 			return logical.ErrorResponse("expiring root tokens cannot create non-expiring root tokens"), logical.ErrInvalidRequest
 		}
+		if tokenType == TokenTypeBatch {
+			return logical.ErrorResponse("batch tokens must have a TTL"), logical.ErrInvalidRequest
+		}
 		renewable = false
 	}
 
 	// Create the token
-	if err := ts.create(&te); err != nil {
+	if tokenType == TokenTypeBatch {
+		if err := ts.createBatchToken(&te); err != nil {
+			return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+		}
+	} else if err := ts.create(&te); err != nil {
 		return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
 	}
 
@@ -1512,7 +1742,7 @@ func (ts *TokenStore) handleCreateCommon(
 
 	if ts.policyLookupFunc != nil {
 		for _, p := range te.Policies {
-			policy, err := ts.policyLookupFunc(p)
+			policy, err := ts.policyLookupFunc(te.NamespaceID, p)
 			if err != nil {
 				return logical.ErrorResponse(fmt.Sprintf("could not look up policy %s", p)), nil
 			}
@@ -1551,6 +1781,9 @@ func (ts *TokenStore) handleRevokeTree(
 		}
 		urltoken = true
 	}
+	if err := ts.checkTokenNamespace(req, id); err != nil {
+		return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+	}
 
 	// Revoke the token and its children
 	if err := ts.RevokeTree(id); err != nil {
@@ -1598,6 +1831,10 @@ func (ts *TokenStore) handleRevokeOrphan(
 			logical.ErrInvalidRequest
 	}
 
+	if err := ts.checkTokenNamespace(req, id); err != nil {
+		return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+	}
+
 	// Revoke and orphan
 	if err := ts.Revoke(id); err != nil {
 		return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
@@ -1644,7 +1881,7 @@ func (ts *TokenStore) handleLookup(
 		return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
 	}
 
-	if out == nil {
+	if out == nil || (id != req.ClientToken && !ts.tokenInNamespace(req, out)) {
 		return logical.ErrorResponse("bad token"), logical.ErrPermissionDenied
 	}
 
@@ -1664,6 +1901,7 @@ func (ts *TokenStore) handleLookup(
 			"creation_ttl":     int64(out.TTL.Seconds()),
 			"ttl":              int64(0),
 			"explicit_max_ttl": int64(out.ExplicitMaxTTL.Seconds()),
+			"type":             TokenTypeService,
 		},
 	}
 
@@ -1677,6 +1915,24 @@ func (ts *TokenStore) handleLookup(
 	if out.Period != 0 {
 		resp.Data["period"] = int64(out.Period.Seconds())
 	}
+	if len(out.BoundCIDRs) > 0 {
+		resp.Data["bound_cidrs"] = out.BoundCIDRs
+	}
+
+	// Batch tokens have no lease, so their TTL is derived from the token
+	// itself and they are never renewable
+	if out.Type == TokenTypeBatch {
+		resp.Data["type"] = TokenTypeBatch
+		resp.Data["renewable"] = false
+		if out.TTL != 0 {
+			expireTime := time.Unix(out.CreationTime, 0).Add(out.TTL)
+			resp.Data["ttl"] = int64(expireTime.Sub(time.Now().Round(time.Second)).Seconds())
+		}
+		if urltoken {
+			resp.AddWarning(`Using a token in the path is unsafe as the token can be logged in many places. Please use POST or PUT with the token passed in via the "token" parameter.`)
+		}
+		return resp, nil
+	}
 
 	// Fetch the last renewal time
 	leaseTimes, err := ts.expiration.FetchLeaseTimesByToken(out.Path, out.ID)
@@ -1735,10 +1991,14 @@ func (ts *TokenStore) handleRenew(
 	}
 
 	// Verify the token exists
-	if te == nil {
+	if te == nil || (id != req.ClientToken && !ts.tokenInNamespace(req, te)) {
 		return logical.ErrorResponse("token not found"), logical.ErrInvalidRequest
 	}
 
+	if te.Type == TokenTypeBatch {
+		return logical.ErrorResponse("batch tokens cannot be renewed"), logical.ErrInvalidRequest
+	}
+
 	// Renew the token and its children
 	resp, err := ts.expiration.RenewToken(req, te.Path, te.ID, increment)
 
@@ -1749,6 +2009,35 @@ func (ts *TokenStore) handleRenew(
 	return resp, err
 }
 
+// tokenInNamespace returns whether a token was created within the namespace
+// of the request or one below it
+func (ts *TokenStore) tokenInNamespace(req *logical.Request, te *TokenEntry) bool {
+	if req.Namespace == "" {
+		return true
+	}
+	if te.NamespaceID == "" {
+		return false
+	}
+	ns := ts.core.namespaceByID(te.NamespaceID)
+	return ns != nil && strings.HasPrefix(ns.Path, req.Namespace)
+}
+
+// checkTokenNamespace returns an error if the given token, other than the
+// client token, cannot be reached from the namespace of the request
+func (ts *TokenStore) checkTokenNamespace(req *logical.Request, id string) error {
+	if req.Namespace == "" || id == req.ClientToken {
+		return nil
+	}
+	te, err := ts.Lookup(id)
+	if err != nil {
+		return err
+	}
+	if te == nil || !ts.tokenInNamespace(req, te) {
+		return fmt.Errorf("token not found")
+	}
+	return nil
+}
+
 func (ts *TokenStore) destroyCubbyhole(saltedID string) error {
 	if ts.cubbyholeBackend == nil {
 		// Should only ever happen in testing
@@ -1897,9 +2186,17 @@ func (ts *TokenStore) tokenStoreRoleRead(
 			"orphan":              role.Orphan,
 			"path_suffix":         role.PathSuffix,
 			"renewable":           role.Renewable,
+			"token_type":          role.TokenType,
 		},
 	}
 
+	if role.TokenType == "" {
+		resp.Data["token_type"] = TokenTypeService
+	}
+	if len(role.BoundCIDRs) > 0 {
+		resp.Data["bound_cidrs"] = role.BoundCIDRs
+	}
+
 	return resp, nil
 }
 
@@ -1960,6 +2257,29 @@ func (ts *TokenStore) tokenStoreRoleCreateUpdate(
 		entry.Renewable = data.Get("renewable").(bool)
 	}
 
+	tokenTypeStr, ok := data.GetOk("token_type")
+	if ok {
+		entry.TokenType = tokenTypeStr.(string)
+	} else if req.Operation == logical.CreateOperation {
+		entry.TokenType = data.Get("token_type").(string)
+	}
+	if !validTokenType(entry.TokenType) {
+		return logical.ErrorResponse(fmt.Sprintf("invalid token type %q", entry.TokenType)), nil
+	}
+	if entry.TokenType == TokenTypeBatch && entry.Period != 0 {
+		return logical.ErrorResponse("batch tokens cannot be periodic"), nil
+	}
+
+	boundCIDRsRaw, ok := data.GetOk("bound_cidrs")
+	if ok {
+		entry.BoundCIDRs = strutil.RemoveDuplicates(boundCIDRsRaw.([]string))
+		if len(entry.BoundCIDRs) > 0 {
+			if valid, err := cidrutil.ValidateCIDRListSlice(entry.BoundCIDRs); !valid || err != nil {
+				return logical.ErrorResponse(fmt.Sprintf("invalid bound_cidrs: %v", err)), nil
+			}
+		}
+	}
+
 	var resp *logical.Response
 
 	explicitMaxTTLInt, ok := data.GetOk("explicit_max_ttl")
@@ -2069,10 +2389,23 @@ no effect on the token being renewed.`
 	tokenRenewableHelp = `Tokens created via this role will be
 renewable or not according to this value.
 Defaults to "true".`
+	tokenBoundCIDRsHelp = `Comma separated list of CIDR blocks. If set,
+tokens created using this role can only be used
+from these blocks.`
+	tokenTypeHelp = `The type of token to create using this role,
+either "service" or "batch". Batch tokens are not
+persisted to storage and cannot be renewed, revoked
+or used to create child tokens. Defaults to "service".`
 	tokenListAccessorsHelp = `List token accessors, which can then be
 be used to iterate and discover their properities
 or revoke them. Because this can be used to
 cause a denial of service, this endpoint
 requires 'sudo' capability in addition to
 'list'.`
+	tokenTidyHelp = `Clean up the token store indexes.`
+	tokenTidyDesc = `Removes accessor and parent index entries that
+refer to tokens that no longer exist, such as those
+left behind when a revocation was interrupted. The
+operation runs in the background and logs its
+progress. This endpoint requires 'sudo' capability.`
 )
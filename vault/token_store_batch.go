@@ -0,0 +1,214 @@
+package vault
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/vault/helper/jsonutil"
+	"github.com/hashicorp/vault/logical"
+)
+
+const (
+	// TokenTypeService is the default token type. Service tokens are
+	// persisted to storage, have an accessor and lease, and can be renewed,
+	// revoked and used to create child tokens.
+	TokenTypeService = "service"
+
+	// TokenTypeBatch tokens are encrypted blobs carrying everything needed
+	// to authorize a request. They are never written to storage and so
+	// cannot be renewed, revoked individually, or create child tokens.
+	TokenTypeBatch = "batch"
+
+	// batchTokenPrefix is prepended to every batch token so that it can be
+	// told apart from a service token without touching storage
+	batchTokenPrefix = "b."
+
+	// batchTokenKeyPath is the path in the token store view holding the
+	// key used to encrypt batch tokens
+	batchTokenKeyPath = "batch-token-key"
+)
+
+// batchTokenEntry is the subset of a TokenEntry carried inside a batch token
+type batchTokenEntry struct {
+	Parent       string            `json:"parent,omitempty"`
+	Policies     []string          `json:"policies"`
+	Path         string            `json:"path"`
+	Meta         map[string]string `json:"meta,omitempty"`
+	DisplayName  string            `json:"display_name"`
+	CreationTime int64             `json:"creation_time"`
+	TTL          time.Duration     `json:"ttl"`
+	Role         string            `json:"role,omitempty"`
+	BoundCIDRs   []string          `json:"bound_cidrs,omitempty"`
+	NamespaceID  string            `json:"namespace_id,omitempty"`
+}
+
+// IsBatchToken returns whether the given token ID is a batch token
+func IsBatchToken(id string) bool {
+	return strings.HasPrefix(id, batchTokenPrefix)
+}
+
+// validTokenType returns whether the given value names a token type. The
+// empty string is accepted and means the default, service.
+func validTokenType(tokenType string) bool {
+	switch tokenType {
+	case "", TokenTypeService, TokenTypeBatch:
+		return true
+	}
+	return false
+}
+
+// batchTokenAEAD returns the cipher used to seal batch tokens, loading the
+// key from storage or generating it on first use.
+func (ts *TokenStore) batchTokenAEAD() (cipher.AEAD, error) {
+	ts.batchTokenLock.Lock()
+	defer ts.batchTokenLock.Unlock()
+
+	if ts.batchTokenCipher != nil {
+		return ts.batchTokenCipher, nil
+	}
+
+	raw, err := ts.view.Get(batchTokenKeyPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read batch token key: %v", err)
+	}
+
+	var key []byte
+	if raw != nil {
+		key = raw.Value
+	} else {
+		key = make([]byte, 32)
+		if _, err := io.ReadFull(rand.Reader, key); err != nil {
+			return nil, fmt.Errorf("failed to generate batch token key: %v", err)
+		}
+		if err := ts.view.Put(&logical.StorageEntry{
+			Key:   batchTokenKeyPath,
+			Value: key,
+		}); err != nil {
+			if isReadOnlyErr(err) {
+				return nil, fmt.Errorf("batch token key has not been generated by the active node")
+			}
+			return nil, fmt.Errorf("failed to persist batch token key: %v", err)
+		}
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create batch token cipher: %v", err)
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create batch token cipher: %v", err)
+	}
+
+	ts.batchTokenCipher = gcm
+	return gcm, nil
+}
+
+// createBatchToken fills in the ID of the given entry with an encrypted
+// batch token. Nothing is written to storage.
+func (ts *TokenStore) createBatchToken(entry *TokenEntry) error {
+	switch {
+	case entry.ID != "":
+		return fmt.Errorf("batch tokens cannot have a custom ID")
+	case entry.NumUses != 0:
+		return fmt.Errorf("batch tokens cannot have a use limit")
+	case entry.Period != 0:
+		return fmt.Errorf("batch tokens cannot be periodic")
+	}
+
+	gcm, err := ts.batchTokenAEAD()
+	if err != nil {
+		return err
+	}
+
+	plaintext, err := jsonutil.EncodeJSON(&batchTokenEntry{
+		Parent:       entry.Parent,
+		Policies:     entry.Policies,
+		Path:         entry.Path,
+		Meta:         entry.Meta,
+		DisplayName:  entry.DisplayName,
+		CreationTime: entry.CreationTime,
+		TTL:          entry.TTL,
+		Role:         entry.Role,
+		BoundCIDRs:   entry.BoundCIDRs,
+		NamespaceID:  entry.NamespaceID,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to encode batch token: %v", err)
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return fmt.Errorf("failed to generate batch token nonce: %v", err)
+	}
+
+	sealed := gcm.Seal(nonce, nonce, plaintext, nil)
+	entry.ID = batchTokenPrefix + base64.RawURLEncoding.EncodeToString(sealed)
+	entry.Accessor = ""
+	entry.Type = TokenTypeBatch
+	return nil
+}
+
+// lookupBatchToken decrypts the given batch token. A token that cannot be
+// decrypted, has expired, or whose parent has been revoked is treated as
+// not found.
+func (ts *TokenStore) lookupBatchToken(id string) (*TokenEntry, error) {
+	sealed, err := base64.RawURLEncoding.DecodeString(strings.TrimPrefix(id, batchTokenPrefix))
+	if err != nil {
+		return nil, nil
+	}
+
+	gcm, err := ts.batchTokenAEAD()
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return nil, nil
+	}
+	nonce, ciphertext := sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():]
+	plaintext, err := gcm.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return nil, nil
+	}
+
+	var bte batchTokenEntry
+	if err := jsonutil.DecodeJSON(plaintext, &bte); err != nil {
+		return nil, fmt.Errorf("failed to decode batch token: %v", err)
+	}
+
+	if bte.TTL != 0 && time.Now().After(time.Unix(bte.CreationTime, 0).Add(bte.TTL)) {
+		return nil, nil
+	}
+
+	// A batch token does not outlive the token that created it
+	if bte.Parent != "" {
+		parent, err := ts.Lookup(bte.Parent)
+		if err != nil {
+			return nil, fmt.Errorf("failed to lookup parent of batch token: %v", err)
+		}
+		if parent == nil {
+			return nil, nil
+		}
+	}
+
+	return &TokenEntry{
+		ID:           id,
+		Parent:       bte.Parent,
+		Policies:     bte.Policies,
+		Path:         bte.Path,
+		Meta:         bte.Meta,
+		DisplayName:  bte.DisplayName,
+		CreationTime: bte.CreationTime,
+		TTL:          bte.TTL,
+		Role:         bte.Role,
+		BoundCIDRs:   bte.BoundCIDRs,
+		NamespaceID:  bte.NamespaceID,
+		Type:         TokenTypeBatch,
+	}, nil
+}
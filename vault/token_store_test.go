@@ -1219,6 +1219,171 @@ func TestTokenStore_HandleRequest_CreateToken_TTL(t *testing.T) {
 	}
 }
 
+func TestTokenStore_HandleRequest_CreateToken_Batch(t *testing.T) {
+	c, _, root := TestCoreUnsealed(t)
+	ts := c.tokenStore
+
+	before, err := ts.view.List(lookupPrefix)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	req := logical.TestRequest(t, logical.UpdateOperation, "auth/token/create")
+	req.ClientToken = root
+	req.Data["type"] = "batch"
+	req.Data["policies"] = []string{"foo"}
+	req.Data["ttl"] = "1h"
+	req.Data["meta"] = map[string]string{"user": "armon"}
+	resp, err := c.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v %v", err, resp)
+	}
+	batch := resp.Auth.ClientToken
+	if !IsBatchToken(batch) || resp.Auth.Accessor != "" || resp.Auth.Renewable {
+		t.Fatalf("bad: %#v", resp.Auth)
+	}
+
+	// Nothing should have been written for the token
+	after, err := ts.view.List(lookupPrefix)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if len(after) != len(before) {
+		t.Fatalf("bad: %v %v", before, after)
+	}
+
+	req = logical.TestRequest(t, logical.ReadOperation, "auth/token/lookup-self")
+	req.ClientToken = batch
+	resp, err = c.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v %v", err, resp)
+	}
+	if resp.Data["type"] != TokenTypeBatch || resp.Data["renewable"] != false ||
+		resp.Data["meta"].(map[string]string)["user"] != "armon" {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+	if ttl := resp.Data["ttl"].(int64); ttl <= 3500 || ttl > 3600 {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+
+	// Batch tokens cannot be renewed, revoked, create children or use a
+	// cubbyhole
+	for _, path := range []string{"auth/token/renew-self", "auth/token/revoke-self", "cubbyhole/foo"} {
+		req = logical.TestRequest(t, logical.UpdateOperation, path)
+		req.ClientToken = batch
+		req.Data["foo"] = "bar"
+		resp, err = c.HandleRequest(req)
+		if err == nil {
+			t.Fatalf("%s: expected error: %#v", path, resp)
+		}
+	}
+
+	req = logical.TestRequest(t, logical.UpdateOperation, "create")
+	req.ClientToken = batch
+	resp, err = ts.HandleRequest(req)
+	if err == nil || !strings.Contains(resp.Data["error"].(string), "batch tokens cannot generate child tokens") {
+		t.Fatalf("expected error: %#v", resp)
+	}
+
+	// Tampering with the token invalidates it
+	te, err := ts.Lookup(batch[:len(batch)-2] + "AA")
+	if err != nil || te != nil {
+		t.Fatalf("bad: %#v %v", te, err)
+	}
+
+	// A batch token is invalid once its parent has been revoked
+	testMakeToken(t, ts, root, "parent", "", []string{"foo"})
+	req = logical.TestRequest(t, logical.UpdateOperation, "create")
+	req.ClientToken = "parent"
+	req.Data["type"] = "batch"
+	resp, err = ts.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v %v", err, resp)
+	}
+	child := resp.Auth.ClientToken
+	if te, err = ts.Lookup(child); err != nil || te == nil || te.Parent != "parent" {
+		t.Fatalf("bad: %#v %v", te, err)
+	}
+	if err := ts.RevokeTree("parent"); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if te, err = ts.Lookup(child); err != nil || te != nil {
+		t.Fatalf("bad: %#v %v", te, err)
+	}
+}
+
+func TestTokenStore_HandleRequest_CreateToken_Batch_Invalid(t *testing.T) {
+	_, ts, _, root := TestCoreWithTokenStore(t)
+
+	for _, data := range []map[string]interface{}{
+		{"type": "foo"},
+		{"type": "batch"},
+		{"type": "batch", "ttl": "1h", "num_uses": 1},
+		{"type": "batch", "ttl": "1h", "period": "1h"},
+		{"type": "batch", "ttl": "1h", "id": "foo"},
+	} {
+		req := logical.TestRequest(t, logical.UpdateOperation, "create")
+		req.ClientToken = root
+		req.Data = data
+		resp, err := ts.HandleRequest(req)
+		if err == nil || !resp.IsError() {
+			t.Fatalf("%v: expected error: %#v", data, resp)
+		}
+	}
+}
+
+func TestTokenStore_HandleRequest_CreateToken_BoundCIDRs(t *testing.T) {
+	c, _, root := TestCoreUnsealed(t)
+
+	req := logical.TestRequest(t, logical.UpdateOperation, "auth/token/create")
+	req.ClientToken = root
+	req.Data["policies"] = []string{"default"}
+	req.Data["bound_cidrs"] = "10.0.0.0/8,192.168.1.0/24"
+	resp, err := c.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v %v", err, resp)
+	}
+	client := resp.Auth.ClientToken
+
+	te, err := c.tokenStore.Lookup(client)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if !reflect.DeepEqual(te.BoundCIDRs, []string{"10.0.0.0/8", "192.168.1.0/24"}) {
+		t.Fatalf("bad: %#v", te.BoundCIDRs)
+	}
+
+	for addr, allowed := range map[string]bool{
+		"10.1.2.3":    true,
+		"192.168.1.5": true,
+		"192.168.2.5": false,
+		"":            false,
+	} {
+		req = logical.TestRequest(t, logical.ReadOperation, "auth/token/lookup-self")
+		req.ClientToken = client
+		if addr != "" {
+			req.Connection = &logical.Connection{RemoteAddr: addr}
+		}
+		resp, err = c.HandleRequest(req)
+		switch {
+		case allowed && err != nil:
+			t.Fatalf("%q: err: %v %v", addr, err, resp)
+		case !allowed && (err == nil || !strings.Contains(err.Error(), logical.ErrPermissionDenied.Error())):
+			t.Fatalf("%q: expected permission denied: %v %v", addr, err, resp)
+		case allowed && !reflect.DeepEqual(resp.Data["bound_cidrs"], te.BoundCIDRs):
+			t.Fatalf("%q: bad: %#v", addr, resp.Data)
+		}
+	}
+
+	req = logical.TestRequest(t, logical.UpdateOperation, "auth/token/create")
+	req.ClientToken = root
+	req.Data["bound_cidrs"] = "10.0.0.0"
+	resp, err = c.HandleRequest(req)
+	if err == nil {
+		t.Fatalf("expected error: %#v", resp)
+	}
+}
+
 func TestTokenStore_HandleRequest_Revoke(t *testing.T) {
 	_, ts, _, root := TestCoreWithTokenStore(t)
 	testMakeToken(t, ts, root, "child", "", []string{"root", "foo"})
@@ -1348,6 +1513,7 @@ func TestTokenStore_HandleRequest_Lookup(t *testing.T) {
 		"creation_ttl":     int64(0),
 		"ttl":              int64(0),
 		"explicit_max_ttl": int64(0),
+		"type":             "service",
 	}
 
 	if resp.Data["creation_time"].(int64) == 0 {
@@ -1386,6 +1552,7 @@ func TestTokenStore_HandleRequest_Lookup(t *testing.T) {
 		"creation_ttl":     int64(3600),
 		"ttl":              int64(3600),
 		"explicit_max_ttl": int64(0),
+		"type":             "service",
 		"renewable":        true,
 	}
 
@@ -1428,6 +1595,7 @@ func TestTokenStore_HandleRequest_Lookup(t *testing.T) {
 		"creation_ttl":     int64(3600),
 		"ttl":              int64(3600),
 		"explicit_max_ttl": int64(0),
+		"type":             "service",
 		"renewable":        true,
 	}
 
@@ -1499,6 +1667,7 @@ func TestTokenStore_HandleRequest_LookupSelf(t *testing.T) {
 		"creation_ttl":     int64(0),
 		"ttl":              int64(0),
 		"explicit_max_ttl": int64(0),
+		"type":             "service",
 	}
 
 	if resp.Data["creation_time"].(int64) == 0 {
@@ -1656,6 +1825,7 @@ func TestTokenStore_RoleCRUD(t *testing.T) {
 		"path_suffix":         "happenin",
 		"explicit_max_ttl":    int64(0),
 		"renewable":           true,
+		"token_type":          "service",
 	}
 
 	if !reflect.DeepEqual(expected, resp.Data) {
@@ -1700,6 +1870,7 @@ func TestTokenStore_RoleCRUD(t *testing.T) {
 		"path_suffix":         "happenin",
 		"explicit_max_ttl":    int64(0),
 		"renewable":           false,
+		"token_type":          "service",
 	}
 
 	if !reflect.DeepEqual(expected, resp.Data) {
@@ -1737,6 +1908,7 @@ func TestTokenStore_RoleCRUD(t *testing.T) {
 		"path_suffix":         "happenin",
 		"period":              int64(0),
 		"renewable":           false,
+		"token_type":          "service",
 	}
 
 	if !reflect.DeepEqual(expected, resp.Data) {
@@ -2041,6 +2213,136 @@ func TestTokenStore_RoleOrphan(t *testing.T) {
 	}
 }
 
+func TestTokenStore_RoleTokenType(t *testing.T) {
+	_, ts, _, root := TestCoreWithTokenStore(t)
+
+	req := logical.TestRequest(t, logical.CreateOperation, "roles/test")
+	req.ClientToken = root
+	req.Data = map[string]interface{}{
+		"token_type": "batch",
+		"period":     3600,
+	}
+	resp, err := ts.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if !resp.IsError() {
+		t.Fatalf("expected error: %#v", resp)
+	}
+
+	req.Data = map[string]interface{}{
+		"token_type": "batch",
+	}
+	resp, err = ts.HandleRequest(req)
+	if err != nil || resp != nil {
+		t.Fatalf("err: %v %v", err, resp)
+	}
+
+	req = logical.TestRequest(t, logical.UpdateOperation, "create/test")
+	req.ClientToken = root
+	req.Data["ttl"] = "1h"
+	resp, err = ts.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v %v", err, resp)
+	}
+	if !IsBatchToken(resp.Auth.ClientToken) || resp.Auth.Renewable {
+		t.Fatalf("bad: %#v", resp.Auth)
+	}
+
+	te, err := ts.Lookup(resp.Auth.ClientToken)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if te == nil || te.Role != "test" || te.Type != TokenTypeBatch {
+		t.Fatalf("bad: %#v", te)
+	}
+
+	// The request can override the role
+	req = logical.TestRequest(t, logical.UpdateOperation, "create/test")
+	req.ClientToken = root
+	req.Data["type"] = "service"
+	resp, err = ts.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v %v", err, resp)
+	}
+	if IsBatchToken(resp.Auth.ClientToken) {
+		t.Fatalf("bad: %#v", resp.Auth)
+	}
+}
+
+func TestTokenStore_RoleBoundCIDRs(t *testing.T) {
+	_, ts, _, root := TestCoreWithTokenStore(t)
+
+	req := logical.TestRequest(t, logical.CreateOperation, "roles/test")
+	req.ClientToken = root
+	req.Data = map[string]interface{}{
+		"bound_cidrs": "10.0.0.0/8,bad",
+	}
+	resp, err := ts.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if !resp.IsError() {
+		t.Fatalf("expected error: %#v", resp)
+	}
+
+	req.Data = map[string]interface{}{
+		"bound_cidrs": "10.0.0.0/8",
+	}
+	resp, err = ts.HandleRequest(req)
+	if err != nil || resp != nil {
+		t.Fatalf("err: %v %v", err, resp)
+	}
+
+	req = logical.TestRequest(t, logical.ReadOperation, "roles/test")
+	resp, err = ts.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if !reflect.DeepEqual(resp.Data["bound_cidrs"], []string{"10.0.0.0/8"}) {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+
+	// Tokens take the role's blocks by default
+	req = logical.TestRequest(t, logical.UpdateOperation, "create/test")
+	req.ClientToken = root
+	resp, err = ts.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v %v", err, resp)
+	}
+	te, err := ts.Lookup(resp.Auth.ClientToken)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if !reflect.DeepEqual(te.BoundCIDRs, []string{"10.0.0.0/8"}) {
+		t.Fatalf("bad: %#v", te)
+	}
+
+	// The request can narrow the blocks but not widen them
+	req = logical.TestRequest(t, logical.UpdateOperation, "create/test")
+	req.ClientToken = root
+	req.Data["bound_cidrs"] = "10.1.0.0/16"
+	resp, err = ts.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v %v", err, resp)
+	}
+	te, err = ts.Lookup(resp.Auth.ClientToken)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if !reflect.DeepEqual(te.BoundCIDRs, []string{"10.1.0.0/16"}) {
+		t.Fatalf("bad: %#v", te)
+	}
+
+	req = logical.TestRequest(t, logical.UpdateOperation, "create/test")
+	req.ClientToken = root
+	req.Data["bound_cidrs"] = "192.168.0.0/16"
+	resp, err = ts.HandleRequest(req)
+	if err == nil || !resp.IsError() {
+		t.Fatalf("expected error: %#v", resp)
+	}
+}
+
 func TestTokenStore_RolePathSuffix(t *testing.T) {
 	_, ts, _, root := TestCoreWithTokenStore(t)
 
@@ -2987,3 +3289,113 @@ func TestTokenStore_AllowedDisallowedPolicies(t *testing.T) {
 		t.Fatalf("expected an error")
 	}
 }
+
+func TestTokenStore_Tidy(t *testing.T) {
+	_, ts, _, root := TestCoreWithTokenStore(t)
+
+	testMakeToken(t, ts, root, "parent", "", []string{"root"})
+	testMakeToken(t, ts, "parent", "child", "", []string{"root"})
+	testMakeToken(t, ts, root, "gone", "", []string{"root"})
+
+	parent, err := ts.Lookup("parent")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	gone, err := ts.Lookup("gone")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	// Simulate a revocation of "gone" that was interrupted after its
+	// primary entry was removed, leaving the accessor and the parent index
+	// entries of a live and a revoked child behind
+	if err := ts.view.Delete(lookupPrefix + ts.SaltID("gone")); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	liveOrphan := parentPrefix + ts.SaltID("gone") + "/" + ts.SaltID("child")
+	if err := ts.view.Put(&logical.StorageEntry{Key: liveOrphan}); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	danglingChild := parentPrefix + ts.SaltID("gone") + "/" + ts.SaltID("revoked")
+	if err := ts.view.Put(&logical.StorageEntry{Key: danglingChild}); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	danglingParent := parentPrefix + ts.SaltID("parent") + "/" + ts.SaltID("missing")
+	if err := ts.view.Put(&logical.StorageEntry{Key: danglingParent}); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	if err := ts.tidy(); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	for _, key := range []string{
+		accessorPrefix + ts.SaltID(gone.Accessor),
+		danglingChild,
+		danglingParent,
+	} {
+		out, err := ts.view.Get(key)
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		if out != nil {
+			t.Fatalf("%s should have been removed", key)
+		}
+	}
+
+	// The valid entries are kept, including that of a child that still
+	// exists although its parent is gone
+	for _, key := range []string{
+		accessorPrefix + ts.SaltID(parent.Accessor),
+		parentPrefix + ts.SaltID("parent") + "/" + ts.SaltID("child"),
+		liveOrphan,
+	} {
+		out, err := ts.view.Get(key)
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		if out == nil {
+			t.Fatalf("%s should have been kept", key)
+		}
+	}
+
+	// Starting a tidy through the API returns at once
+	req := logical.TestRequest(t, logical.UpdateOperation, "tidy")
+	req.ClientToken = root
+	resp, err := ts.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if resp == nil || len(resp.Warnings()) != 1 {
+		t.Fatalf("bad: %#v", resp)
+	}
+}
+
+func TestTokenStore_TidyStoppedAtCleanup(t *testing.T) {
+	_, ts, _, root := TestCoreWithTokenStore(t)
+
+	testMakeToken(t, ts, root, "gone", "", []string{"root"})
+	gone, err := ts.Lookup("gone")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if err := ts.view.Delete(lookupPrefix + ts.SaltID("gone")); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	// Once the token store is cleaned up, as it is at seal, a tidy stops
+	// without touching storage
+	ts.Cleanup()
+	ts.Cleanup()
+
+	if err := ts.tidy(); err != errTidyStopped {
+		t.Fatalf("err: %v", err)
+	}
+	out, err := ts.view.Get(accessorPrefix + ts.SaltID(gone.Accessor))
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if out == nil {
+		t.Fatalf("accessor should have been kept")
+	}
+}
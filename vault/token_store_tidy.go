@@ -0,0 +1,221 @@
+package vault
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/armon/go-metrics"
+	"github.com/hashicorp/go-multierror"
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+)
+
+const (
+	// tidyProgressInterval is the number of entries a tidy operation checks
+	// between progress log lines
+	tidyProgressInterval = 1000
+)
+
+// errTidyStopped is returned when a token or lease tidy operation is
+// stopped by sealing
+var errTidyStopped = errors.New("tidy operation stopped by seal")
+
+// handleTidy starts a tidy of the token store indexes in the background
+func (ts *TokenStore) handleTidy(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	resp := &logical.Response{}
+	if !atomic.CompareAndSwapInt32(&ts.tidyInProgress, 0, 1) {
+		resp.AddWarning("Tidy operation already in progress.")
+		return resp, nil
+	}
+
+	go func() {
+		defer atomic.StoreInt32(&ts.tidyInProgress, 0)
+		if err := ts.tidy(); err != nil {
+			ts.Logger().Error("token: tidy failed", "error", err)
+		}
+	}()
+
+	resp.AddWarning("Tidy operation successfully started. Any information from the operation will be printed to Vault's server logs.")
+	return resp, nil
+}
+
+// tidy removes the accessor and parent index entries that refer to tokens
+// that no longer exist, such as those left behind when a revocation was
+// interrupted. Each entry is checked and removed under the same locks that
+// token creation and revocation take, so that tidying is safe alongside
+// normal traffic. The operation stops early if the token store is cleaned
+// up at seal.
+func (ts *TokenStore) tidy() error {
+	defer metrics.MeasureSince([]string{"token", "tidy"}, time.Now())
+
+	logger := ts.Logger()
+	logger.Info("token: beginning tidy operation on tokens")
+
+	var tidyErrors *multierror.Error
+
+	deletedAccessors, err := ts.tidyAccessors()
+	if err == errTidyStopped {
+		return err
+	}
+	if err != nil {
+		tidyErrors = multierror.Append(tidyErrors, err)
+	}
+	metrics.IncrCounter([]string{"token", "tidy", "deleted_accessors"}, float32(deletedAccessors))
+
+	deletedParentLinks, err := ts.tidyParentIndex()
+	if err == errTidyStopped {
+		return err
+	}
+	if err != nil {
+		tidyErrors = multierror.Append(tidyErrors, err)
+	}
+	metrics.IncrCounter([]string{"token", "tidy", "deleted_parent_links"}, float32(deletedParentLinks))
+
+	logger.Info("token: finished tidy operation on tokens",
+		"deleted_accessors", deletedAccessors,
+		"deleted_parent_links", deletedParentLinks)
+
+	return tidyErrors.ErrorOrNil()
+}
+
+// tidyAccessors removes the accessor index entries of tokens that no
+// longer exist
+func (ts *TokenStore) tidyAccessors() (int, error) {
+	saltedAccessors, err := ts.view.List(accessorPrefix)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list accessors: %v", err)
+	}
+
+	logger := ts.Logger()
+	logger.Info("token: checking accessors", "accessor_count", len(saltedAccessors))
+
+	var deleted int
+	var tidyErrors *multierror.Error
+	for i, saltedAccessor := range saltedAccessors {
+		select {
+		case <-ts.quitCh:
+			return deleted, errTidyStopped
+		default:
+		}
+
+		if i > 0 && i%tidyProgressInterval == 0 {
+			logger.Info("token: tidy progress", "checked_accessors", i, "accessor_count", len(saltedAccessors))
+		}
+
+		aEntry, err := ts.lookupBySaltedAccessor(saltedAccessor)
+		if err != nil {
+			tidyErrors = multierror.Append(tidyErrors, fmt.Errorf("failed to read accessor %q: %v", saltedAccessor, err))
+			continue
+		}
+
+		removed, err := ts.tidyAccessor(saltedAccessor, aEntry.TokenID)
+		if err != nil {
+			tidyErrors = multierror.Append(tidyErrors, err)
+			continue
+		}
+		if removed {
+			deleted++
+		}
+	}
+
+	return deleted, tidyErrors.ErrorOrNil()
+}
+
+// tidyAccessor removes a single accessor index entry if the token it refers
+// to no longer exists
+func (ts *TokenStore) tidyAccessor(saltedAccessor, tokenID string) (bool, error) {
+	if tokenID != "" {
+		lock := ts.getTokenLock(tokenID)
+		lock.Lock()
+		defer lock.Unlock()
+
+		raw, err := ts.view.Get(lookupPrefix + ts.SaltID(tokenID))
+		if err != nil {
+			return false, fmt.Errorf("failed to read token of accessor %q: %v", saltedAccessor, err)
+		}
+		if raw != nil {
+			return false, nil
+		}
+	}
+
+	if err := ts.view.Delete(accessorPrefix + saltedAccessor); err != nil {
+		return false, fmt.Errorf("failed to delete accessor %q: %v", saltedAccessor, err)
+	}
+	return true, nil
+}
+
+// tidyParentIndex removes the parent index entries of child tokens that no
+// longer exist
+func (ts *TokenStore) tidyParentIndex() (int, error) {
+	parents, err := ts.view.List(parentPrefix)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list token parents: %v", err)
+	}
+
+	logger := ts.Logger()
+	logger.Info("token: checking parent index", "parent_count", len(parents))
+
+	var deleted int
+	var tidyErrors *multierror.Error
+	for i, parent := range parents {
+		select {
+		case <-ts.quitCh:
+			return deleted, errTidyStopped
+		default:
+		}
+
+		if i > 0 && i%tidyProgressInterval == 0 {
+			logger.Info("token: tidy progress", "checked_parents", i, "parent_count", len(parents))
+		}
+
+		removed, err := ts.tidyParent(strings.TrimSuffix(parent, "/"))
+		deleted += removed
+		if err != nil {
+			tidyErrors = multierror.Append(tidyErrors, err)
+		}
+	}
+
+	return deleted, tidyErrors.ErrorOrNil()
+}
+
+// tidyParent removes the index entries of a single parent token whose child
+// no longer exists. Entries of children that still exist are kept even if
+// the parent is gone, since they are still needed to find those children.
+// The lock of the parent's index entries is held throughout, as it is by
+// create and revocation, so that a child created or revoked alongside is
+// never removed from the index while it exists.
+func (ts *TokenStore) tidyParent(saltedParent string) (int, error) {
+	lock := ts.getParentLock(saltedParent)
+	lock.Lock()
+	defer lock.Unlock()
+
+	children, err := ts.view.List(parentPrefix + saltedParent + "/")
+	if err != nil {
+		return 0, fmt.Errorf("failed to list children of %q: %v", saltedParent, err)
+	}
+
+	var deleted int
+	var tidyErrors *multierror.Error
+	for _, child := range children {
+		childEntry, err := ts.view.Get(lookupPrefix + child)
+		if err != nil {
+			tidyErrors = multierror.Append(tidyErrors, fmt.Errorf("failed to read child token %q: %v", child, err))
+			continue
+		}
+		if childEntry != nil {
+			continue
+		}
+
+		if err := ts.view.Delete(parentPrefix + saltedParent + "/" + child); err != nil {
+			tidyErrors = multierror.Append(tidyErrors, fmt.Errorf("failed to delete parent index entry: %v", err))
+			continue
+		}
+		deleted++
+	}
+
+	return deleted, tidyErrors.ErrorOrNil()
+}